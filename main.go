@@ -2,15 +2,21 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"glox/src/compiler"
 	"glox/src/core"
 	dbg "glox/src/debug"
+	loxfmt "glox/src/format"
+	"glox/src/lsp"
 	"glox/src/vm"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -30,10 +36,30 @@ type Options struct {
 	printTokens bool
 	cpuProfile  string
 	memProfile  string
+	timeout     time.Duration // --timeout: stop the script after this long, 0 for never
+	budget      int           // --budget: stop the script after about this many instructions, 0 for no limit
+	sandbox     bool          // --sandbox: run the script confined to a vm.Sandbox rooted at the working directory
+	maxMemory   int           // --max-memory: raise MemoryError past about this many bytes, 0 for no limit
+	watch       bool          // --watch: reload modules whose files change while the script runs
+	diagnostics string                 // "text" or "json": how compile errors are printed
+	warnings    compiler.WarningConfig // set by -W flags; nil reports no warnings
+	warnFlags   []string
 	args        []string
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(checkCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lintCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(fmtCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		os.Exit(lspCommand(os.Args[2:]))
+	}
 	opts := parseArgs()
 
 	if opts.doRepl {
@@ -55,10 +81,21 @@ func parseArgs() *Options {
 	if len(os.Args) == 1 {
 		usage()
 	}
-	opts := &Options{args: []string{}}
+	opts := &Options{args: []string{}, diagnostics: "text"}
 	rawArgs := os.Args[1:]
 	for i := 0; i < len(rawArgs); i++ {
 		arg := rawArgs[i]
+		if format, ok := strings.CutPrefix(arg, "--diagnostics="); ok {
+			if !validDiagnosticsFormat(format) {
+				usage()
+			}
+			opts.diagnostics = format
+			continue
+		}
+		if strings.HasPrefix(arg, "-W") {
+			opts.warnFlags = append(opts.warnFlags, arg)
+			continue
+		}
 		if arg[0] == '-' {
 			switch arg {
 			case "--info":
@@ -96,6 +133,40 @@ func parseArgs() *Options {
 					usage()
 				}
 				opts.memProfile = rawArgs[i]
+			case "--timeout":
+				i++
+				if i >= len(rawArgs) {
+					usage()
+				}
+				d, err := time.ParseDuration(rawArgs[i])
+				if err != nil || d <= 0 {
+					usage()
+				}
+				opts.timeout = d
+			case "--budget":
+				i++
+				if i >= len(rawArgs) {
+					usage()
+				}
+				n, err := strconv.Atoi(rawArgs[i])
+				if err != nil || n <= 0 {
+					usage()
+				}
+				opts.budget = n
+			case "--sandbox":
+				opts.sandbox = true
+			case "--max-memory":
+				i++
+				if i >= len(rawArgs) {
+					usage()
+				}
+				n, err := strconv.Atoi(rawArgs[i])
+				if err != nil || n <= 0 {
+					usage()
+				}
+				opts.maxMemory = n
+			case "--watch":
+				opts.watch = true
 			default:
 				usage()
 			}
@@ -103,17 +174,50 @@ func parseArgs() *Options {
 			opts.args = append(opts.args, arg)
 		}
 	}
+	if len(opts.warnFlags) > 0 {
+		opts.warnings = compiler.WarningConfig{}
+		if err := applyWarningFlags(opts.warnings, opts.warnFlags); err != nil {
+			fmt.Println(err)
+			usage()
+		}
+	}
 	return opts
 }
 
+// applyWarningFlags applies -W flags to config in order, except that -Werror
+// comes last so it covers every warning the other flags enabled.
+func applyWarningFlags(config compiler.WarningConfig, flags []string) error {
+
+	werror := false
+	for _, flag := range flags {
+		if flag == "-Werror" {
+			werror = true
+			continue
+		}
+		if err := config.Set(flag); err != nil {
+			return err
+		}
+	}
+	if werror {
+		return config.Set("-Werror")
+	}
+	return nil
+}
+
 // replInputComplete reports whether buffered REPL input forms a complete
 // statement, i.e. all (){}[] are balanced and no string is left open. Strings,
 // comments, and ${} interpolation never contribute stray/unbalanced brackets,
-// so a simple net-depth count over the token stream is reliable.
+// so a simple net-depth count over the token stream is reliable. A trailing
+// `@decorator` line also needs more input: the declaration it decorates.
 func replInputComplete(src string) bool {
 	s := compiler.NewScanner(src)
 	depth := 0
+	lineStart, decorator := true, false
 	for _, t := range s.Tokens.Tokens {
+		if depth == 0 && lineStart && t.Tokentype != compiler.TOKEN_EOL && t.Tokentype != compiler.TOKEN_EOF {
+			decorator = t.Tokentype == compiler.TOKEN_AT
+		}
+		lineStart = t.Tokentype == compiler.TOKEN_EOL || t.Tokentype == compiler.TOKEN_SEMICOLON
 		switch t.Tokentype {
 		case compiler.TOKEN_LEFT_BRACE, compiler.TOKEN_LEFT_PAREN, compiler.TOKEN_LEFT_BRACKET:
 			depth++
@@ -125,7 +229,7 @@ func replInputComplete(src string) bool {
 			}
 		}
 	}
-	return depth <= 0
+	return depth <= 0 && !decorator
 }
 
 func repl(vmInstance *vm.VM) {
@@ -167,7 +271,7 @@ func repl(vmInstance *vm.VM) {
 				fmt.Println(result)
 			}
 		case vm.INTERPRET_RUNTIME_ERROR:
-			fmt.Println(vmInstance.ErrorMsg)
+			fmt.Fprintln(vmInstance.Stdout(), vmInstance.ErrorMsg)
 			vmInstance.PrintStackTrace()
 			// compile errors are already reported by the compiler as they occur
 		}
@@ -235,6 +339,10 @@ func runFile(opts *Options) {
 	vmInstance := vm.NewVM(path, defineBuiltins)
 	vmInstance.SetArgs(args)
 
+	if opts.diagnostics == "json" {
+		vmInstance.ReportDiagnostics = printDiagnosticsJSON
+	}
+	vmInstance.Warnings = opts.warnings
 	if core.DebugTraceExecution {
 		warnIfNoDebugHook("--debug/--info", "trace output will be empty")
 		vmInstance.DebugHook = dbg.TraceHook
@@ -243,12 +351,28 @@ func runFile(opts *Options) {
 		warnIfNoDebugHook("--instrument", "instruction counts will be zero")
 		vmInstance.DebugHook = dbg.InstrumentHook
 	}
+	if opts.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		defer cancel()
+		vmInstance.SetContext(ctx)
+	}
+	vmInstance.SetBudget(opts.budget)
+	vmInstance.SetMemoryLimit(opts.maxMemory)
+	if opts.sandbox {
+		root, err := core.OpenRootFileSystem(".")
+		if err != nil {
+			fmt.Printf("Could not open sandbox root : %s", err)
+			os.Exit(1)
+		}
+		vmInstance.SetSandbox(vm.Sandbox{FS: root})
+	}
+	vmInstance.SetWatch(opts.watch)
 	status, result := vmInstance.Interpret(source, "__main__")
 	if status == vm.INTERPRET_COMPILE_ERROR {
 		exit(65)
 	}
-	if status == vm.INTERPRET_RUNTIME_ERROR {
-		fmt.Println(vmInstance.ErrorMsg)
+	if status == vm.INTERPRET_RUNTIME_ERROR || status == vm.INTERPRET_INTERRUPTED {
+		fmt.Fprintln(vmInstance.Stdout(), vmInstance.ErrorMsg)
 		vmInstance.PrintStackTrace()
 		exit(70)
 	}
@@ -278,11 +402,294 @@ func runFile(opts *Options) {
 		fmt.Printf("Executed %d instructions\n", dbg.InstructionCount)
 		fmt.Printf("Average instructions per second: %.2f\n", float64(dbg.InstructionCount)/runtime.Seconds())
 		dbg.InstructionCount = 0 // Reset for next run
+		dbg.ReportOpcodePairs(os.Stdout, 10)
+	}
+}
+
+// checkCommand implements `glox check <file|dir>...`: statically type-check
+// each .lox file (directories are walked recursively) against its own type
+// annotations and the signatures of the native builtins, without running
+// anything. Returns the process exit code: 0 if clean, 1 if type errors were
+// found, 65 (as for a normal run) if any file failed to compile.
+func checkCommand(args []string) int {
+
+	format := "text"
+	var paths []string
+	for _, arg := range args {
+		if f, ok := strings.CutPrefix(arg, "--diagnostics="); ok && validDiagnosticsFormat(f) {
+			format = f
+		} else {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Println("Usage: glox check [--diagnostics=text|json] <file.lox|directory>...")
+		return 1
+	}
+	files, err := collectLoxFiles(paths)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	signatures := vm.NewVM("check", true).BuiltInSignatures()
+	errorCount, compileFailed := 0, false
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Could not open file %s : %s\n", path, err)
+			compileFailed = true
+			continue
+		}
+		diags, ok := compiler.Check(path, string(source), signatures)
+		for _, d := range diags {
+			if format == "json" {
+				fmt.Println(d.JSON())
+			} else {
+				fmt.Println(d)
+			}
+			if d.Code == compiler.CodeType {
+				errorCount++
+			}
+		}
+		if !ok {
+			compileFailed = true
+		}
+	}
+
+	switch {
+	case compileFailed:
+		return 65
+	case errorCount > 0:
+		if format == "text" {
+			fmt.Printf("%d type error(s) found.\n", errorCount)
+		}
+		return 1
+	}
+	return 0
+}
+
+// lintCommand implements `glox lint [-W...] <file|dir>...`: compile each
+// .lox file (directories are walked recursively) with the compiler's
+// warnings enabled, without running anything. The -W flags adjust the
+// default set (every warning but implicit-declaration). Returns
+// the process exit code: 0 if nothing was reported at error severity, 1 if
+// a warning configured as an error (-Werror) was, 65 if any file failed to
+// compile.
+func lintCommand(args []string) int {
+
+	format := "text"
+	var flags, paths []string
+	for _, arg := range args {
+		if f, ok := strings.CutPrefix(arg, "--diagnostics="); ok && validDiagnosticsFormat(f) {
+			format = f
+		} else if strings.HasPrefix(arg, "-W") {
+			flags = append(flags, arg)
+		} else {
+			paths = append(paths, arg)
+		}
+	}
+	warnings := compiler.DefaultWarnings()
+	if err := applyWarningFlags(warnings, flags); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(paths) == 0 {
+		fmt.Println("Usage: glox lint [--diagnostics=text|json] [-W<flag>...] <file.lox|directory>...")
+		return 1
+	}
+	files, err := collectLoxFiles(paths)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	signatures := vm.NewVM("lint", true).BuiltInSignatures()
+	warningCount, errorCount, compileFailed := 0, 0, false
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Could not open file %s : %s\n", path, err)
+			compileFailed = true
+			continue
+		}
+		diags, ok := compiler.Lint(path, string(source), signatures)
+		for _, d := range warnings.Apply(diags) {
+			if format == "json" {
+				fmt.Println(d.JSON())
+			} else {
+				fmt.Println(d)
+			}
+			switch {
+			case d.Code == compiler.CodeSyntax:
+			case d.Severity == compiler.SeverityError:
+				errorCount++
+			default:
+				warningCount++
+			}
+		}
+		if !ok {
+			compileFailed = true
+		}
+	}
+
+	if format == "text" && warningCount+errorCount > 0 {
+		fmt.Printf("%d warning(s), %d error(s) found.\n", warningCount, errorCount)
+	}
+	switch {
+	case compileFailed:
+		return 65
+	case errorCount > 0:
+		return 1
 	}
+	return 0
+}
+
+// fmtCommand implements `glox fmt [--check] <file|dir>...`: rewrite each
+// .lox file (directories are walked recursively) in canonical form. With
+// --check nothing is written; the files that are not already formatted are
+// listed instead. Returns the process exit code: 0 if every file was (or, with
+// --check, already is) formatted, 1 if --check found unformatted files, 65 if
+// any file failed to parse.
+func fmtCommand(args []string) int {
+
+	check := false
+	var paths []string
+	for _, arg := range args {
+		if arg == "--check" {
+			check = true
+		} else {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Println("Usage: glox fmt [--check] <file.lox|directory>...")
+		return 1
+	}
+	files, err := collectLoxFiles(paths)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	unformatted, parseFailed := false, false
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Could not open file %s : %s\n", path, err)
+			parseFailed = true
+			continue
+		}
+		formatted, diags := loxfmt.Source(path, string(source))
+		if compiler.HasErrors(diags) {
+			for _, d := range diags {
+				fmt.Println(d)
+			}
+			parseFailed = true
+			continue
+		}
+		if formatted == string(source) {
+			continue
+		}
+		if check {
+			fmt.Println(path)
+			unformatted = true
+			continue
+		}
+		if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Printf("Could not write file %s : %s\n", path, err)
+			parseFailed = true
+		}
+	}
+
+	switch {
+	case parseFailed:
+		return 65
+	case unformatted:
+		return 1
+	}
+	return 0
+}
+
+// lspCommand implements `glox lsp`: a Language Server Protocol server for
+// editors, talking to its client over stdin and stdout. Imports are resolved
+// as a script run from the edited file would resolve them, so LOX_PATH
+// applies. Returns the process exit code: 0 if the client shut the server
+// down before telling it to exit, 1 otherwise.
+func lspCommand(args []string) int {
+
+	if len(args) != 0 {
+		fmt.Println("Usage: glox lsp")
+		return 1
+	}
+	env := lsp.Environment{
+		Signatures: vm.NewVM("lsp", true).BuiltInSignatures(),
+		FindModule: vm.FindModuleFile,
+	}
+	clean, err := lsp.NewServer(env, os.Stdout).Serve(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glox lsp:", err)
+	}
+	if !clean {
+		return 1
+	}
+	return 0
+}
+
+// validDiagnosticsFormat reports whether format is a --diagnostics= value.
+func validDiagnosticsFormat(format string) bool {
+
+	return format == "text" || format == "json"
+}
+
+// printDiagnosticsJSON prints compiler diagnostics one JSON object per line,
+// for editors and CI (--diagnostics=json).
+func printDiagnosticsJSON(diags []compiler.Diagnostic) {
+
+	for _, d := range diags {
+		fmt.Println(d.JSON())
+	}
+}
+
+// collectLoxFiles expands the command-line paths into a sorted list of .lox
+// files, walking directories and skipping bytecode caches.
+func collectLoxFiles(paths []string) ([]string, error) {
+
+	var files []string
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == "__loxcache__" {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".lox") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
 }
 
 func usage() {
 	fmt.Println(`Usage: glox [options] filename
+       glox check [--diagnostics=text|json] <file.lox|directory>...
+       glox lint [--diagnostics=text|json] [-W<flag>...] <file.lox|directory>...
+       glox fmt [--check] <file.lox|directory>...
+       glox lsp
 
 Options:
   --debug, -d           Enable debug mode (trace execution, print code)
@@ -293,9 +700,23 @@ Options:
   --repl                Start interactive REPL
   --force-compile, -f   Force module recompilation
   --print-tokens, -p    Print tokens and exit
-  --instrument, -i      Enable instruction counting and timing
-  --no-peephole, -n     Skip the peephole optimiser
+  --instrument, -i      Enable instruction counting, timing and opcode-pair counts
+  --no-peephole, -n     Skip constant folding and the peephole optimiser
   --cpuprofile <file>   Write a CPU profile to <file>
-  --memprofile <file>   Write a heap profile to <file> after execution`)
+  --memprofile <file>   Write a heap profile to <file> after execution
+  --timeout <duration>  Raise TimeoutError in the script after <duration> (e.g. 5s)
+  --budget <n>          Raise BudgetExceeded after about <n> instructions
+  --sandbox             Run untrusted code: only safe built-in modules, and files
+                        only under the working directory (PermissionError otherwise)
+  --max-memory <bytes>  Raise MemoryError once the script holds about <bytes> of data
+  --watch               Reload imported modules when their files change
+  --diagnostics=json    Print compile errors as JSON, one object per line
+  -Wall, -W<name>       Report compiler warnings (all, or the named one)
+  -Wno-<name>           Do not report the named warning
+  -Werror, -Werror=<name>
+                        Treat warnings (all, or the named one) as errors
+
+Warnings: unused-variable, shadowing, implicit-declaration, unreachable-code,
+          truthiness`)
 	os.Exit(1)
 }
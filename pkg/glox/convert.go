@@ -0,0 +1,513 @@
+package glox
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"glox/src/core"
+	"glox/src/vm"
+)
+
+var (
+	valueType = reflect.TypeFor[core.Value]()
+	errorType = reflect.TypeFor[error]()
+)
+
+// toValue converts a Go value to Lox; see the package comment.
+func toValue(x any) (core.Value, error) {
+	if v, ok := x.(core.Value); ok {
+		return v, nil
+	}
+	return reflectToValue(reflect.ValueOf(x))
+}
+
+// visit identifies a Go pointer, map or slice being converted. A slice is
+// told apart from a shorter one sharing its array by its length.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func reflectToValue(rv reflect.Value) (core.Value, error) {
+	return reflectToValueOn(rv, map[visit]bool{})
+}
+
+// reflectToValueOn is reflectToValue with the pointers, maps and slices
+// being converted, which rv mustn't lead back to: one that contains itself
+// has no Lox form.
+func reflectToValueOn(rv reflect.Value, path map[visit]bool) (core.Value, error) {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if !rv.IsNil() {
+			key := visit{ptr: rv.Pointer(), typ: rv.Type()}
+			if rv.Kind() == reflect.Slice {
+				key.len = rv.Len()
+			}
+			if path[key] {
+				return core.NIL_VALUE, fmt.Errorf("cannot convert %s that contains itself", rv.Type())
+			}
+			path[key] = true
+			defer delete(path, key)
+		}
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return core.NIL_VALUE, nil
+	case reflect.Bool:
+		return core.MakeBooleanValue(rv.Bool(), false), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return core.MakeIntValue(int(rv.Int()), false), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return core.NIL_VALUE, fmt.Errorf("cannot convert %s %d to a Lox int: out of range", rv.Type(), rv.Uint())
+		}
+		return core.MakeIntValue(int(rv.Uint()), false), nil
+	case reflect.Float32, reflect.Float64:
+		return core.MakeFloatValue(rv.Float(), false), nil
+	case reflect.String:
+		return core.MakeStringObjectValue(rv.String(), false), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]core.Value, rv.Len())
+		for i := range items {
+			v, err := reflectToValueOn(rv.Index(i), path)
+			if err != nil {
+				return core.NIL_VALUE, fmt.Errorf("[%d]: %w", i, err)
+			}
+			items[i] = v
+		}
+		return core.MakeObjectValue(core.MakeListObject(items, false), false), nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		dict := core.MakeEmptyDictObject()
+		for iter := rv.MapRange(); iter.Next(); {
+			v, err := reflectToValueOn(iter.Value(), path)
+			if err != nil {
+				return core.NIL_VALUE, fmt.Errorf("[%q]: %w", iter.Key().String(), err)
+			}
+			dict.Set(iter.Key().String(), v)
+		}
+		return core.MakeObjectValue(dict, false), nil
+	case reflect.Struct:
+		if rv.Type() == valueType {
+			return rv.Interface().(core.Value), nil
+		}
+		dict := core.MakeEmptyDictObject()
+		for i := 0; i < rv.NumField(); i++ {
+			name, ok := fieldName(rv.Type().Field(i))
+			if !ok {
+				continue
+			}
+			v, err := reflectToValueOn(rv.Field(i), path)
+			if err != nil {
+				return core.NIL_VALUE, fmt.Errorf(".%s: %w", name, err)
+			}
+			dict.Set(name, v)
+		}
+		return core.MakeObjectValue(dict, false), nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return core.NIL_VALUE, nil
+		}
+		return reflectToValueOn(rv.Elem(), path)
+	case reflect.Func:
+		return wrapFunc(rv.Type().String(), rv)
+	}
+	return core.NIL_VALUE, fmt.Errorf("cannot convert %s to a Lox value", rv.Type())
+}
+
+// fromValue converts a Lox value to the Go type t. A Lox function converts
+// to a Go func calling it on machine.
+func fromValue(v core.Value, t reflect.Type, machine *vm.VM) (reflect.Value, error) {
+	return fromValueOn(v, t, machine, map[core.Object]bool{})
+}
+
+// fromValueOn is fromValue with the lists, dicts and instances whose items
+// are being converted, which v mustn't lead back to.
+func fromValueOn(v core.Value, t reflect.Type, machine *vm.VM, path map[core.Object]bool) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	if t == valueType {
+		out.Set(reflect.ValueOf(v))
+		return out, nil
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		x := toGo(v)
+		if x == nil {
+			return out, nil
+		}
+		if xv := reflect.ValueOf(x); xv.Type().AssignableTo(t) {
+			out.Set(xv)
+			return out, nil
+		}
+	case reflect.Bool:
+		if v.IsBool() {
+			out.SetBool(v.Data() != 0)
+			return out, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.IsInt() {
+			if out.OverflowInt(int64(v.AsInt())) {
+				return out, fmt.Errorf("%d overflows %s", v.AsInt(), t)
+			}
+			out.SetInt(int64(v.AsInt()))
+			return out, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.IsInt() {
+			if v.AsInt() < 0 || out.OverflowUint(uint64(v.AsInt())) {
+				return out, fmt.Errorf("%d overflows %s", v.AsInt(), t)
+			}
+			out.SetUint(uint64(v.AsInt()))
+			return out, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if v.IsNumber() {
+			out.SetFloat(v.AsFloat())
+			return out, nil
+		}
+	case reflect.String:
+		if v.IsStringObject() {
+			out.SetString(v.AsString().Get())
+			return out, nil
+		}
+	case reflect.Slice, reflect.Array:
+		if v.IsListObject() {
+			if path[v.Obj()] {
+				return out, fmt.Errorf("cannot convert %s that contains itself to %s", typeName(v), t)
+			}
+			path[v.Obj()] = true
+			defer delete(path, v.Obj())
+			items := v.AsList().Get()
+			if t.Kind() == reflect.Slice {
+				out.Set(reflect.MakeSlice(t, len(items), len(items)))
+			} else if len(items) != t.Len() {
+				return out, fmt.Errorf("expected %d items, got %d", t.Len(), len(items))
+			}
+			for i, item := range items {
+				e, err := fromValueOn(item, t.Elem(), machine, path)
+				if err != nil {
+					return out, fmt.Errorf("[%d]: %w", i, err)
+				}
+				out.Index(i).Set(e)
+			}
+			return out, nil
+		}
+	case reflect.Map:
+		if v.IsObj() && v.ObjType() == core.OBJECT_DICT && t.Key().Kind() == reflect.String {
+			if path[v.Obj()] {
+				return out, fmt.Errorf("cannot convert %s that contains itself to %s", typeName(v), t)
+			}
+			path[v.Obj()] = true
+			defer delete(path, v.Obj())
+			out.Set(reflect.MakeMap(t))
+			for id, item := range v.AsDict().Items {
+				key := core.NameFromID(id)
+				e, err := fromValueOn(item, t.Elem(), machine, path)
+				if err != nil {
+					return out, fmt.Errorf("[%q]: %w", key, err)
+				}
+				out.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), e)
+			}
+			return out, nil
+		}
+	case reflect.Struct:
+		var field func(name string) (core.Value, bool)
+		switch {
+		case v.IsObj() && v.ObjType() == core.OBJECT_DICT:
+			dict := v.AsDict()
+			field = func(name string) (core.Value, bool) {
+				item, err := dict.Get(name)
+				return item, err == nil
+			}
+		case v.IsInstanceObject():
+			inst := v.AsInstance()
+			field = func(name string) (core.Value, bool) {
+				return inst.GetField(core.InternName(name))
+			}
+		default:
+			return out, mismatch(v, t)
+		}
+		if path[v.Obj()] {
+			return out, fmt.Errorf("cannot convert %s that contains itself to %s", typeName(v), t)
+		}
+		path[v.Obj()] = true
+		defer delete(path, v.Obj())
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			item, ok := field(name)
+			if !ok {
+				continue
+			}
+			e, err := fromValueOn(item, t.Field(i).Type, machine, path)
+			if err != nil {
+				return out, fmt.Errorf(".%s: %w", name, err)
+			}
+			out.Field(i).Set(e)
+		}
+		return out, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return out, nil
+		}
+		e, err := fromValueOn(v, t.Elem(), machine, path)
+		if err != nil {
+			return out, err
+		}
+		out.Set(reflect.New(t.Elem()))
+		out.Elem().Set(e)
+		return out, nil
+	case reflect.Func:
+		if v.IsClosureObject() && machine != nil && returnsValueAndError(t) {
+			return loxFunc(v, t, machine), nil
+		}
+	}
+	return out, mismatch(v, t)
+}
+
+func mismatch(v core.Value, t reflect.Type) error {
+	return fmt.Errorf("expected %s, got %s", t, typeName(v))
+}
+
+// toGo converts a Lox value to its natural Go form; see the package comment.
+// A list or dict that contains itself has none, and stays a core.Value.
+func toGo(v core.Value) any {
+	if x, ok := toGoOn(v, map[core.Object]bool{}); ok {
+		return x
+	}
+	return v
+}
+
+// toGoOn is toGo with the lists and dicts being converted, reporting false
+// if v leads back to one of them.
+func toGoOn(v core.Value, path map[core.Object]bool) (any, bool) {
+	switch {
+	case v.IsNil():
+		return nil, true
+	case v.IsBool():
+		return v.Data() != 0, true
+	case v.IsInt():
+		return v.AsInt(), true
+	case v.IsFloat():
+		return v.AsFloat(), true
+	case v.IsStringObject():
+		return v.AsString().Get(), true
+	case v.IsListObject(), v.IsObj() && v.ObjType() == core.OBJECT_DICT:
+		if path[v.Obj()] {
+			return nil, false
+		}
+		path[v.Obj()] = true
+		defer delete(path, v.Obj())
+		if v.IsListObject() {
+			items := v.AsList().Get()
+			list := make([]any, len(items))
+			for i, item := range items {
+				x, ok := toGoOn(item, path)
+				if !ok {
+					return nil, false
+				}
+				list[i] = x
+			}
+			return list, true
+		}
+		dict := map[string]any{}
+		for id, item := range v.AsDict().Items {
+			x, ok := toGoOn(item, path)
+			if !ok {
+				return nil, false
+			}
+			dict[core.NameFromID(id)] = x
+		}
+		return dict, true
+	}
+	return v, true
+}
+
+// fieldName gives the key a struct field has in a dict, and false for a
+// field that has none.
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	switch tag := f.Tag.Get("lox"); tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// typeName names v's Lox type for error messages.
+func typeName(v core.Value) string {
+	switch {
+	case v.IsNil():
+		return "nil"
+	case v.IsBool():
+		return "bool"
+	case v.IsInt():
+		return "int"
+	case v.IsFloat():
+		return "float"
+	case v.IsStringObject():
+		return "string"
+	case v.IsListObject():
+		if v.AsList().Tuple {
+			return "tuple"
+		}
+		return "list"
+	case v.IsInstanceObject():
+		return v.AsInstance().Class.Name.Get() + " instance"
+	case v.IsObj():
+		switch v.ObjType() {
+		case core.OBJECT_DICT:
+			return "dict"
+		case core.OBJECT_CLOSURE, core.OBJECT_NATIVE:
+			return "function"
+		case core.OBJECT_CLASS:
+			return "class"
+		case core.OBJECT_MODULE:
+			return "module"
+		}
+	}
+	return "object"
+}
+
+// returnsValueAndError reports whether the func type t returns at most a
+// value and an error, as a function crossing between Go and Lox must.
+func returnsValueAndError(t reflect.Type) bool {
+	switch t.NumOut() {
+	case 0, 1:
+		return true
+	case 2:
+		return t.Out(1) == errorType
+	}
+	return false
+}
+
+// wrapFunc makes the Go function fn a Lox built-in, called name in errors.
+func wrapFunc(name string, fn reflect.Value) (core.Value, error) {
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return core.NIL_VALUE, fmt.Errorf("glox: %s: %s is not a function", name, fn.Kind())
+	}
+	t := fn.Type()
+	if !returnsValueAndError(t) {
+		return core.NIL_VALUE, fmt.Errorf("glox: %s: a function must return at most a value and an error, not %s", name, t)
+	}
+	nin := t.NumIn()
+	builtIn := func(argCount int, argsStackptr int, ctx core.VMContext) core.Value {
+		if t.IsVariadic() && argCount < nin-1 {
+			ctx.RunTimeError("%s expects at least %d arguments but got %d.", name, nin-1, argCount)
+			return core.NIL_VALUE
+		}
+		if !t.IsVariadic() && argCount != nin {
+			ctx.RunTimeError("%s expects %d arguments but got %d.", name, nin, argCount)
+			return core.NIL_VALUE
+		}
+		machine, _ := ctx.(*vm.VM)
+		args := make([]reflect.Value, argCount)
+		for i := range args {
+			pt := t.In(min(i, nin-1))
+			if t.IsVariadic() && i >= nin-1 {
+				pt = pt.Elem()
+			}
+			arg, err := fromValue(ctx.Stack(argsStackptr+i), pt, machine)
+			if err != nil {
+				ctx.RunTimeError("%s argument %d: %v", name, i+1, err)
+				return core.NIL_VALUE
+			}
+			args[i] = arg
+		}
+		results, err := callFunc(fn, args)
+		if err == nil && len(results) > 0 && t.Out(len(results)-1) == errorType {
+			if e := results[len(results)-1]; !e.IsNil() {
+				err = e.Interface().(error)
+			}
+			results = results[:len(results)-1]
+		}
+		if err != nil {
+			ctx.RunTimeError("%s: %v", name, err)
+			return core.NIL_VALUE
+		}
+		if len(results) == 0 {
+			return core.NIL_VALUE
+		}
+		result, err := reflectToValue(results[0])
+		if err != nil {
+			ctx.RunTimeError("%s result: %v", name, err)
+			return core.NIL_VALUE
+		}
+		return result
+	}
+	return core.MakeObjectValue(core.MakeBuiltInObject(builtIn), false), nil
+}
+
+// callFunc calls fn, turning a panic into an error.
+func callFunc(fn reflect.Value, args []reflect.Value) (results []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*Error); ok {
+				err = e // from a loxFunc without an error result
+			} else {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}
+	}()
+	return fn.Call(args), nil
+}
+
+// loxFunc makes the Lox function fn a Go func of type t that calls it on
+// machine. An exception escaping fn is returned as an *Error if t has an
+// error result, and otherwise panics with it, which a registered function
+// the func was passed to raises in the script; called from anywhere else,
+// the panic is the caller's to recover, as Register documents.
+func loxFunc(fn core.Value, t reflect.Type, machine *vm.VM) reflect.Value {
+	hasError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, t.NumOut())
+		for i := range results {
+			results[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if !hasError {
+				panic(err)
+			}
+			results[len(results)-1] = reflect.ValueOf(&err).Elem()
+			return results
+		}
+		if t.IsVariadic() {
+			rest := args[len(args)-1]
+			args = args[:len(args)-1]
+			for i := 0; i < rest.Len(); i++ {
+				args = append(args, rest.Index(i))
+			}
+		}
+		values := make([]core.Value, len(args))
+		for i, arg := range args {
+			v, err := reflectToValue(arg)
+			if err != nil {
+				return fail(fmt.Errorf("argument %d: %w", i+1, err))
+			}
+			values[i] = v
+		}
+		result, err := machine.CallClosure(fn, values)
+		if err != nil {
+			return fail(callError(machine))
+		}
+		if t.NumOut() > 0 && t.Out(0) != errorType {
+			out, err := fromValue(result, t.Out(0), machine)
+			if err != nil {
+				return fail(fmt.Errorf("result: %w", err))
+			}
+			results[0] = out
+		}
+		return results
+	})
+}
@@ -0,0 +1,74 @@
+package glox
+
+import (
+	"strings"
+
+	"glox/src/compiler"
+	"glox/src/core"
+	"glox/src/vm"
+)
+
+// Error is a Lox runtime error returned to Go: an exception that escaped a
+// Run or Call, or a call that couldn't start (a wrong argument count, say),
+// which has no Class. One that stopped a run for its budget or context
+// wraps ErrBudgetExceeded or the context's error.
+type Error struct {
+	Class     string   // the exception's class, e.g. "RunTimeError"
+	Message   string   // the exception's msg
+	Traceback []string // innermost frame first, each as its location then its source line
+
+	interrupted error
+}
+
+func (e *Error) Error() string {
+	if e.Class == "" {
+		return e.Message
+	}
+	return e.Class + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.interrupted
+}
+
+// callError describes the error that just ended a run or call on machine,
+// and clears it there: for a call made from inside a registered function,
+// whether it goes on to be raised in the script is up to that function.
+func callError(machine *vm.VM) *Error {
+	e := &Error{
+		Message:     machine.ErrorMsg,
+		Traceback:   append([]string(nil), machine.StackTrace()...),
+		interrupted: machine.Interrupted(),
+	}
+	if exc := machine.Uncaught(); exc != nil {
+		e.Class = exc.Class.Name.Get()
+		if msg, ok := exc.GetField(core.MSG); ok {
+			if msg.IsStringObject() {
+				e.Message = msg.AsString().Get()
+			} else {
+				e.Message = msg.String()
+			}
+		}
+	}
+	machine.ErrorMsg = ""
+	return e
+}
+
+// Diagnostic is a compiler error or warning.
+type Diagnostic = compiler.Diagnostic
+
+// CompileError is returned by Run for source that doesn't compile.
+type CompileError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *CompileError) Error() string {
+	if len(e.Diagnostics) == 0 {
+		return "compile error"
+	}
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,318 @@
+// Package glox embeds the glox interpreter in a Go program. It runs Lox
+// source, exposes Go functions and modules to scripts, calls Lox functions
+// and reads and writes globals, all in terms of ordinary Go values:
+//
+//	in := glox.New()
+//	in.Register("greet", func(name string) string { return "hello " + name })
+//	if err := in.Run(`func shout(s) { return greet(s) & "!"; }`); err != nil {
+//		log.Fatal(err)
+//	}
+//	s, err := in.Call("shout", "lox") // "hello lox!"
+//
+// Values cross between Go and Lox as follows:
+//
+//	Go                              Lox
+//	nil, nil pointer or interface   nil
+//	bool                            bool
+//	int, int8…int64, uint…uint64    int
+//	float32, float64                float
+//	string                          string
+//	[]T, [N]T                       list
+//	map[string]T                    dict
+//	struct                          dict of its exported fields (from an instance too)
+//	*T                              as T
+//	func                            built-in function (from a Lox function)
+//	core.Value                      itself
+//
+// A struct field is keyed by its name, or by its `lox:"name"` tag; `lox:"-"`
+// leaves it out. Values returned to Go as any come back as nil, bool, int,
+// float64, string, []any or map[string]any, and anything else (instances,
+// functions, vectors, a list or dict that contains itself, ...) as the
+// core.Value itself, which can be passed back in unchanged. A Go pointer,
+// map or slice that contains itself can't be passed in at all, nor can an
+// unsigned integer above math.MaxInt64.
+//
+// An Interpreter is not safe for concurrent use. Registered Go functions are
+// shared with the threads a script spawns, so those may be called
+// concurrently.
+package glox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"glox/src/compiler"
+	"glox/src/core"
+	"glox/src/vm"
+)
+
+// Interpreter is one embedded glox VM.
+type Interpreter struct {
+	vm          *vm.VM
+	diagnostics []compiler.Diagnostic // from the current Run
+}
+
+// Option configures an Interpreter in New.
+type Option func(*Interpreter)
+
+// WithScript names the script the interpreter runs: imports are resolved
+// relative to its directory and tracebacks show it. The default is
+// "<embedded>", which resolves imports from the working directory.
+func WithScript(path string) Option {
+	return func(in *Interpreter) { in.vm.SetScript(path) }
+}
+
+// WithArgs sets what sys.args() returns.
+func WithArgs(args ...string) Option {
+	return func(in *Interpreter) { in.vm.SetArgs(args) }
+}
+
+// WithStdout sends the interpreter's standard output -- print, and
+// sys.stdout -- to w instead of os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) { in.vm.SetStdout(w) }
+}
+
+// WithStderr sends what scripts write to sys.stderr to w instead of
+// os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) { in.vm.SetStderr(w) }
+}
+
+// WithStdin makes r what scripts read from sys.stdin instead of os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) { in.vm.SetStdin(r) }
+}
+
+// WithBudget stops each Run or Call after about n instructions with a
+// BudgetExceeded exception in the script, returned as an *Error that
+// errors.Is ErrBudgetExceeded. See vm.VM.SetBudget for how they're counted.
+func WithBudget(n int) Option {
+	return func(in *Interpreter) { in.vm.SetBudget(n) }
+}
+
+// WithMemoryLimit raises MemoryError in scripts that would hold more than
+// about n bytes of strings, lists, dicts and float arrays. See
+// vm.VM.SetMemoryLimit.
+func WithMemoryLimit(n int) Option {
+	return func(in *Interpreter) { in.vm.SetMemoryLimit(n) }
+}
+
+// ErrBudgetExceeded is what an *Error from a run stopped by WithBudget wraps.
+var ErrBudgetExceeded = vm.ErrBudgetExceeded
+
+// Sandbox is what WithSandbox confines scripts to: the built-in modules they
+// may use, the files they may reach and the memory they may allocate.
+type Sandbox = vm.Sandbox
+
+// WithSandbox runs untrusted scripts confined to sb. What it refuses them
+// is raised as a PermissionError or MemoryError. Modules the host Registers
+// are allowed. For example, to give scripts only the files under dir:
+//
+//	root, err := core.OpenRootFileSystem(dir)
+//	...
+//	in := glox.New(glox.WithSandbox(glox.Sandbox{FS: root, MaxMemory: 64 << 20}))
+func WithSandbox(sb Sandbox) Option {
+	return func(in *Interpreter) { in.vm.SetSandbox(sb) }
+}
+
+// New creates an interpreter with the standard built-ins defined.
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{vm: vm.NewVM("<embedded>", true)}
+	in.vm.ReportDiagnostics = func(diags []compiler.Diagnostic) {
+		in.diagnostics = append(in.diagnostics, diags...)
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	return in
+}
+
+// VM returns the underlying VM, for what this package doesn't cover.
+func (in *Interpreter) VM() *vm.VM {
+	return in.vm
+}
+
+// Run compiles and runs source as the interpreter's script. Each Run is a
+// fresh script: Call, Global and SetGlobal then see the globals it defined,
+// and those of earlier runs are gone. It returns a *CompileError if source
+// doesn't compile, and an *Error if an exception escapes it.
+func (in *Interpreter) Run(source string) error {
+	in.diagnostics = nil
+	switch res, _ := in.vm.Interpret(source, "__main__"); res {
+	case vm.INTERPRET_COMPILE_ERROR:
+		return &CompileError{Diagnostics: in.diagnostics}
+	case vm.INTERPRET_RUNTIME_ERROR, vm.INTERPRET_INTERRUPTED:
+		return callError(in.vm)
+	}
+	return nil
+}
+
+// RunContext is Run, stopped when ctx is cancelled or its deadline passes:
+// the script is raised a TimeoutError at its next loop iteration or call,
+// and unless it handles that and finishes, RunContext returns an *Error
+// that errors.Is ctx.Err().
+func (in *Interpreter) RunContext(ctx context.Context, source string) error {
+	in.vm.SetContext(ctx)
+	defer in.vm.SetContext(nil)
+	return in.Run(source)
+}
+
+// RunFile reads the script at path and runs it as Run does, with path as
+// the script's name.
+func (in *Interpreter) RunFile(path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	in.vm.SetScript(path)
+	return in.Run(string(source))
+}
+
+// Call calls the Lox function bound to the global name with args converted
+// to Lox, and returns its result converted to Go. An exception escaping the
+// call is returned as an *Error.
+func (in *Interpreter) Call(name string, args ...any) (any, error) {
+	fn, ok := in.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("glox: %s is not defined", name)
+	}
+	if !fn.IsClosureObject() {
+		return nil, fmt.Errorf("glox: %s is a %s, not a function", name, typeName(fn))
+	}
+	values := make([]core.Value, len(args))
+	for i, arg := range args {
+		v, err := toValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("glox: argument %d to %s: %w", i+1, name, err)
+		}
+		values[i] = v
+	}
+	result, err := in.vm.CallClosure(fn, values)
+	if err != nil {
+		return nil, callError(in.vm)
+	}
+	return toGo(result), nil
+}
+
+// CallContext is Call, stopped when ctx is done as RunContext is.
+func (in *Interpreter) CallContext(ctx context.Context, name string, args ...any) (any, error) {
+	in.vm.SetContext(ctx)
+	defer in.vm.SetContext(nil)
+	return in.Call(name, args...)
+}
+
+// Global returns the value of the global name converted to Go: a global of
+// the last script run, or else a host global or built-in.
+func (in *Interpreter) Global(name string) (any, bool) {
+	v, ok := in.lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return toGo(v), true
+}
+
+// SetGlobal assigns value to the global name of the last script run if it
+// declared one, and otherwise defines name as a host global that every
+// later script sees.
+func (in *Interpreter) SetGlobal(name string, value any) error {
+	v, err := toValue(value)
+	if err != nil {
+		return fmt.Errorf("glox: global %s: %w", name, err)
+	}
+	if env := in.vm.GetGlobals(); env != nil {
+		if slot := env.SlotForName(name); slot >= 0 {
+			env.SetGlobal(slot, v)
+			return nil
+		}
+	}
+	in.vm.BuiltIns[core.InternName(name)] = v
+	return nil
+}
+
+// Register makes the Go function fn callable from Lox as the global name.
+// Its arguments are converted from Lox and its result to Lox as the package
+// comment describes, and it may return nothing, a value, an error, or a
+// value and an error; a non-nil error, a panic, or an argument that doesn't
+// convert raises a RunTimeError in the script. Register before the Run of
+// the scripts that use it.
+//
+// A func parameter receives a Lox function as a Go func that calls it. An
+// exception the Lox function raises is returned as an *Error if the func
+// type ends with an error result. If it doesn't, the func panics with the
+// *Error instead. While fn runs, that panic is recovered and raised in the
+// script. A host that keeps the func and calls it after fn has returned
+// must recover the panic itself, or use a func type with an error result.
+func (in *Interpreter) Register(name string, fn any) error {
+	v, err := wrapFunc(name, reflect.ValueOf(fn))
+	if err != nil {
+		return err
+	}
+	in.vm.BuiltIns[core.InternName(name)] = v
+	return nil
+}
+
+// RegisterModule defines a built-in module that scripts `import name` to
+// use, with members converted as by SetGlobal (so a func member is
+// registered as by Register). Registering an existing module name, even a
+// standard one such as "sys", adds to it.
+func (in *Interpreter) RegisterModule(name string, members map[string]any) error {
+	id := core.InternName(name)
+	module, ok := in.vm.BuiltInModules[id]
+	if !ok {
+		module = core.MakeModuleObject(name, core.NewEnvironment(name))
+	}
+	for member, value := range members {
+		var v core.Value
+		var err error
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Func {
+			v, err = wrapFunc(name+"."+member, rv)
+		} else {
+			v, err = toValue(value)
+		}
+		if err != nil {
+			return fmt.Errorf("glox: %s.%s: %w", name, member, err)
+		}
+		module.Environment.SetVar(core.InternName(member), v)
+	}
+	in.vm.BuiltInModules[id] = module
+	return nil
+}
+
+// Snapshot is the state of an interpreter's script and modules, taken by
+// Interpreter.Snapshot. See vm.VM.Snapshot for what it holds.
+type Snapshot = vm.Snapshot
+
+// Snapshot captures the globals of the last script run and of the modules it
+// loaded, and what they reach, so expensive setup can be run once and
+// Restored from as often as needed.
+func (in *Interpreter) Snapshot() (*Snapshot, error) {
+	return in.vm.Snapshot()
+}
+
+// Restore puts back the globals s captured, making the script it was taken
+// of the one Call and Global see.
+func (in *Interpreter) Restore(s *Snapshot) error {
+	return in.vm.Restore(s)
+}
+
+// ReadSnapshot reads a snapshot saved with its WriteTo. The interpreter
+// must have run the same script, loading the same modules, first.
+func (in *Interpreter) ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	return in.vm.ReadSnapshot(r)
+}
+
+// lookup finds the global name: in the last script run, or else among the
+// host globals and built-ins.
+func (in *Interpreter) lookup(name string) (core.Value, bool) {
+	if env := in.vm.GetGlobals(); env != nil {
+		if slot := env.SlotForName(name); slot >= 0 && env.Defined[slot] {
+			return env.Globals[slot], true
+		}
+	}
+	v, ok := in.vm.BuiltIns[core.InternName(name)]
+	return v, ok
+}
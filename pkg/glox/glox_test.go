@@ -0,0 +1,653 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"glox/src/core"
+)
+
+type point struct {
+	X, Y  int
+	Label string `lox:"label"`
+	note  string
+}
+
+func TestRegisterAndCall(t *testing.T) {
+	in := New()
+	if err := in.Register("scale", func(p point, k float64) point {
+		return point{X: int(float64(p.X) * k), Y: int(float64(p.Y) * k), Label: p.Label + "'"}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Register("sum", func(xs ...int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err := in.Run(`
+func moved(p) {
+    var q = scale(p, 2.0);
+    return [q["X"], q["Y"], q["label"], sum(q["X"], q["Y"], 1)];
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := in.Call("moved", point{X: 1, Y: 2, Label: "a", note: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{2, 4, "a'", 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moved returned %#v, want %#v", got, want)
+	}
+}
+
+func TestModule(t *testing.T) {
+	in := New()
+	err := in.RegisterModule("host", map[string]any{
+		"version": "1.2",
+		"lookup": func(table map[string][]int, key string) ([]int, error) {
+			if v, ok := table[key]; ok {
+				return v, nil
+			}
+			return nil, fmt.Errorf("no key %s", key)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Run(`
+import host;
+var found = host.lookup({"a": [1, 2]}, "a");
+var version = host.version;
+var missing = "";
+try {
+    host.lookup({}, "b");
+} except RunTimeError as e {
+    missing = e.msg;
+}
+`); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]any{
+		"found":   []any{1, 2},
+		"version": "1.2",
+		"missing": "host.lookup: no key b",
+	} {
+		if got, ok := in.Global(name); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	in := New()
+	if err := in.SetGlobal("limit", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Run(`var count = limit + 1; func get() { return count; }`); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetGlobal("count", map[string]bool{"set": true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := in.Call("get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"set": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("get() = %#v, want %#v", got, want)
+	}
+	if _, ok := in.Global("nope"); ok {
+		t.Error("Global found an undefined name")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	in := New()
+	in.Register("boom", func() int { panic("kaboom") })
+	in.Register("want_int", func(n int) int { return n })
+	err := in.Run(`
+class ValueError < Exception {}
+func inner() { raise ValueError("bad value"); }
+func outer() { inner(); }
+func host_boom() { return boom(); }
+func host_type() { return want_int("x"); }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = in.Call("outer")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("outer returned %v, want an *Error", err)
+	}
+	if e.Class != "ValueError" || e.Message != "bad value" || e.Error() != "ValueError: bad value" {
+		t.Errorf("outer raised %q (class %q, message %q)", e.Error(), e.Class, e.Message)
+	}
+	if len(e.Traceback) < 4 || !strings.Contains(e.Traceback[0], "in inner") || !strings.Contains(e.Traceback[2], "in outer") {
+		t.Errorf("outer traceback %q", e.Traceback)
+	}
+
+	for name, want := range map[string]string{
+		"host_boom": "RunTimeError: boom: panic: kaboom",
+		"host_type": "RunTimeError: want_int argument 1: expected int, got string",
+	} {
+		if _, err := in.Call(name); err == nil || err.Error() != want {
+			t.Errorf("%s returned %v, want %s", name, err, want)
+		}
+	}
+
+	// The interpreter is still usable after the errors above.
+	if _, err := in.Call("outer", 1); err == nil || err.Error() != "Expected 0 arguments but got 1." {
+		t.Errorf("outer(1) returned %v", err)
+	}
+	if err := in.Run(`var ok = true;`); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := in.Global("ok"); got != true {
+		t.Errorf("ok = %v after errors", got)
+	}
+
+	var ce *CompileError
+	if err := in.Run(`var = ;`); !errors.As(err, &ce) || len(ce.Diagnostics) == 0 {
+		t.Errorf("bad source returned %v, want a *CompileError", err)
+	}
+	if err := in.Register("bad", func() (int, int) { return 0, 0 }); err == nil {
+		t.Error("Register accepted a function returning two values")
+	}
+
+	// A uint too big for a Lox int is refused rather than wrapped.
+	want := "glox: global big: cannot convert uint64 18446744073709551615 to a Lox int: out of range"
+	if err := in.SetGlobal("big", uint64(math.MaxUint64)); err == nil || err.Error() != want {
+		t.Errorf("SetGlobal(big) returned %v, want %s", err, want)
+	}
+	if err := in.SetGlobal("big", uint64(math.MaxInt64)); err != nil {
+		t.Errorf("SetGlobal(MaxInt64) returned %v", err)
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+type tree []tree
+
+func TestCycles(t *testing.T) {
+	in := New()
+	in.Register("depth", func(x tree) int { return len(x) })
+	err := in.Run(`
+func self_list() { var a = []; a.append(a); return a; }
+func self_dict() { var d = {}; d["me"] = [d]; return d; }
+func shared() { var s = [1]; return [s, s]; }
+func host_depth() { return depth(self_list()); }
+func id(x) { return x; }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A list or dict that contains itself comes back as the core.Value;
+	// one merely reached twice is converted each time.
+	for _, name := range []string{"self_list", "self_dict"} {
+		got, err := in.Call(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got.(core.Value); !ok {
+			t.Errorf("%s returned %#v, want a core.Value", name, got)
+		}
+	}
+	got, err := in.Call("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{[]any{1}, []any{1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shared returned %#v, want %#v", got, want)
+	}
+	want := "RunTimeError: depth argument 1: [0]: cannot convert list that contains itself to glox.tree"
+	if _, err := in.Call("host_depth"); err == nil || err.Error() != want {
+		t.Errorf("host_depth returned %v, want %s", err, want)
+	}
+
+	// Go values that contain themselves can't be passed in.
+	n := &node{Name: "a"}
+	n.Next = n
+	m := map[string]any{}
+	m["me"] = []any{m}
+	s := []any{nil}
+	s[0] = s
+	for _, x := range []any{n, m, s} {
+		if _, err := in.Call("id", x); err == nil || !strings.Contains(err.Error(), "that contains itself") {
+			t.Errorf("id(%T) returned %v, want a cycle error", x, err)
+		}
+	}
+	if err := in.SetGlobal("loop", n); err == nil {
+		t.Error("SetGlobal accepted a pointer that contains itself")
+	}
+	twice := []int{1}
+	got, err = in.Call("id", [][]int{twice, twice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{[]any{1}, []any{1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("id returned %#v, want %#v", got, want)
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	in := New()
+	in.Register("apply", func(f func(int) int, xs []int) []int {
+		out := make([]int, len(xs))
+		for i, x := range xs {
+			out[i] = f(x)
+		}
+		return out
+	})
+	in.Register("each", func(name string, xs []int) ([]any, error) {
+		var out []any
+		for _, x := range xs {
+			v, err := in.Call(name, x)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	})
+	if err := in.Run(`
+func double(x) { return x * 2; }
+var doubled = each("double", [1, 2, 3]);
+`); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := in.Global("doubled"); !reflect.DeepEqual(got, []any{2, 4, 6}) {
+		t.Errorf("doubled = %#v", got)
+	}
+	if err := in.SetGlobal("inc", func(x int) int { return x + 1 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Run(`
+var incremented = apply(func(x) { return inc(x); }, [1, 2]);
+var failed = "";
+try {
+    apply(func(x) { return 1 / "x"; }, [1]);
+} except RunTimeError as e {
+    failed = e.msg;
+}
+`); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := in.Global("incremented"); !reflect.DeepEqual(got, []any{2, 3}) {
+		t.Errorf("incremented = %#v", got)
+	}
+	if got, _ := in.Global("failed"); !strings.HasPrefix(got.(string), "apply: RunTimeError: ") {
+		t.Errorf("failed = %q", got)
+	}
+
+	// A func kept and called later, outside the registered function, returns
+	// the exception if it has an error result, and otherwise panics with it.
+	var kept func(int) int
+	var keptErr func(int) (int, error)
+	in.Register("keep", func(f func(int) int, g func(int) (int, error)) {
+		kept, keptErr = f, g
+	})
+	if err := in.Run(`
+func fail(x) { return x / "x"; }
+keep(fail, fail);
+`); err != nil {
+		t.Fatal(err)
+	}
+	var e *Error
+	if _, err := keptErr(1); !errors.As(err, &e) || e.Class != "RunTimeError" {
+		t.Errorf("keptErr(1) returned %v, want a RunTimeError", err)
+	}
+	func() {
+		defer func() {
+			if r, ok := recover().(*Error); !ok || r.Class != "RunTimeError" {
+				t.Errorf("kept(1) panicked with %v, want a RunTimeError", r)
+			}
+		}()
+		kept(1)
+		t.Error("kept(1) returned")
+	}()
+}
+
+func TestStreams(t *testing.T) {
+	var out, errs strings.Builder
+	in := New(WithStdout(&out), WithStderr(&errs), WithStdin(strings.NewReader("first\nsecond\n")))
+	err := in.Run(`
+import sys;
+import os;
+print "to stdout";
+os.write(sys.stderr, "to stderr\n");
+var line = os.readln(sys.stdin);
+var saved = sys.stdout;
+sys.stdout = os.buffer();
+print "captured";
+var captured = os.getvalue(sys.stdout);
+sys.stdout = saved;
+print line;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "to stdout\nfirst\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := errs.String(), "to stderr\n"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+	if got, _ := in.Global("captured"); got != "captured\n" {
+		t.Errorf("captured = %q", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := New(WithBudget(10000))
+	err := in.Run(`
+var caught = false;
+func spin() { while (true) {} }
+try {
+    spin();
+} except BudgetExceeded as e {
+    caught = str(e) == "Instruction budget of 10000 exceeded.";
+}
+spin();
+`)
+	// Caught, the handler can call functions, but the exception is raised
+	// again soon after.
+	var e *Error
+	if !errors.As(err, &e) || e.Class != "BudgetExceeded" || !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("budgeted run returned %v", err)
+	}
+	if got, _ := in.Global("caught"); got != true {
+		t.Error("BudgetExceeded was not catchable")
+	}
+	// Each run gets the whole budget.
+	if _, err := in.Call("spin"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("spin() returned %v", err)
+	}
+	if err := in.Run(`var total = 0; for (var i = 0; i < 100; i = i + 1) { total = total + i; }`); err != nil {
+		t.Errorf("run within budget returned %v", err)
+	}
+
+	in = New()
+	if err := in.Run(`
+import thread;
+func spin() { var n = 0; while (true) { n = n + 1; } }
+func spin_thread() { return thread.spawn(spin).wait(); }
+`); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"spin", "spin_thread"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := in.CallContext(ctx, name)
+		cancel()
+		if name == "spin" && (!errors.As(err, &e) || e.Class != "TimeoutError" || !errors.Is(err, context.DeadlineExceeded)) {
+			t.Errorf("%s returned %v", name, err)
+		}
+		if name == "spin_thread" && err == nil {
+			t.Errorf("%s was not stopped", name)
+		}
+	}
+	// Without the context, the script runs unlimited again.
+	if err := in.Run(`var i = 0; while (i < 100000) { i = i + 1; }`); err != nil {
+		t.Errorf("unlimited run returned %v", err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	dir := t.TempDir()
+	box := filepath.Join(dir, "box")
+	if err := os.Mkdir(box, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(box, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	root, err := core.OpenRootFileSystem(box)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := New(WithSandbox(Sandbox{FS: root, MaxMemory: 1 << 20}))
+
+	var e *Error
+	for _, src := range []string{
+		`import thread;`,
+		`from process import spawn;`,
+		`import os; os.read_all("../secret.txt");`,
+		`import os; os.read_all("link.txt");`,
+		`import os; os.chdir("..");`,
+	} {
+		if err := in.Run(src); !errors.As(err, &e) || e.Class != "PermissionError" {
+			t.Errorf("%s returned %v", src, err)
+		}
+	}
+
+	// Files inside the root are available, with "/" standing for it.
+	if err := in.Run(`
+import os;
+var f = os.open("/notes.txt", "w");
+os.write(f, "kept");
+os.close(f);
+var back = os.read_all("notes.txt");
+var names = os.listdir("/");
+`); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := in.Global("back"); got != "kept" {
+		t.Errorf("read back %q", got)
+	}
+	if data, err := os.ReadFile(filepath.Join(box, "notes.txt")); err != nil || string(data) != "kept" {
+		t.Errorf("notes.txt = %q, %v", data, err)
+	}
+
+	// A denied module's functions can't be called even when handed in.
+	other := New()
+	if err := other.Run(`import thread; var spawn = thread.spawn;`); err != nil {
+		t.Fatal(err)
+	}
+	spawn, _ := other.Global("spawn")
+	if err := in.SetGlobal("spawn", spawn); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Run(`spawn(func() {});`); !errors.As(err, &e) || e.Class != "PermissionError" {
+		t.Errorf("calling thread.spawn returned %v", err)
+	}
+
+	for _, src := range []string{
+		`var s = "x"; while (true) { s = s & s; }`,
+		`var l = []; while (true) { append(l, 1); }`,
+		`var l = []; while (true) { l.append(1); }`,
+		`var l = [1]; while (true) { l = l & l; }`,
+		`var s = "x" * 2000000;`,
+	} {
+		if err := in.Run(src); !errors.As(err, &e) || e.Class != "MemoryError" {
+			t.Errorf("%s returned %v", src, err)
+		}
+	}
+	// The cap is per run.
+	if err := in.Run(`var l = []; for (var i = 0; i < 1000; i = i + 1) { append(l, [i]); }`); err != nil {
+		t.Errorf("run within the cap returned %v", err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	in := New(WithMemoryLimit(1 << 20))
+	var e *Error
+	if err := in.Run(`var l = []; while (true) { append(l, [1, 2, 3]); }`); !errors.As(err, &e) || e.Class != "MemoryError" {
+		t.Fatalf("unbounded list returned %v", err)
+	}
+	// Threads are held to a limit of their own.
+	if err := in.Run(`
+import thread;
+func grow() { var s = "x"; while (true) { s = s & s; } }
+func grow_thread() { return thread.spawn(grow).wait(); }
+`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Call("grow"); !errors.As(err, &e) || e.Class != "MemoryError" {
+		t.Errorf("grow() returned %v", err)
+	}
+	if _, err := in.Call("grow_thread"); err == nil {
+		t.Error("thread grew without limit")
+	}
+	// A Go function's result counts once the script holds it.
+	if err := in.Register("blob", func(n int) string { return strings.Repeat("b", n) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Run(`import sys; var b = blob(100000); var used = sys.memory_usage();`); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := in.Global("used"); used.(int) < 100000 {
+		t.Errorf("memory_usage() = %v with a 100000 byte string held", used)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	module := "var hits = 0;\nfunc hit() { hits = hits + 1; return hits; }\nfunc count() { return hits; }\n"
+	if err := os.WriteFile(filepath.Join(dir, "snapmod.lox"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source := `
+import sys;
+append(sys.path, "` + dir + `");
+import snapmod;
+class Counter {
+    static made = 0;
+    init(n) { this.n = n; Counter.made = Counter.made + 1; }
+    bump() { this.n = this.n + 1; return this.n; }
+}
+func counter() {
+    var c = 0;
+    func inc() { c = c + 1; return c; }
+    func get() { return c; }
+    return [inc, get];
+}
+var pair = counter();
+var shared = [1, 2];
+var a = {"x": shared, "y": shared};
+var cyc = [];
+append(cyc, cyc);
+var obj = Counter(10);
+var bump = obj.bump;
+func mutate() {
+    pair[0]();
+    append(a["x"], 3);
+    append(cyc[0], 0);
+    bump();
+    Counter(0);
+    snapmod.hit();
+}
+func state() { return [pair[1](), len(a["y"]), len(cyc), obj.n, Counter.made, snapmod.count()]; }
+`
+	state := func(in *Interpreter) any {
+		t.Helper()
+		got, err := in.Call("state")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	in := New()
+	if err := in.Run(source); err != nil {
+		t.Fatal(err)
+	}
+	s, err := in.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial, mutated := []any{0, 2, 1, 10, 1, 0}, []any{1, 3, 2, 11, 2, 1}
+	for range 3 {
+		if _, err := in.Call("mutate"); err != nil {
+			t.Fatal(err)
+		}
+		if err := in.Restore(s); err != nil {
+			t.Fatal(err)
+		}
+		if got := state(in); !reflect.DeepEqual(got, initial) {
+			t.Fatalf("restored state is %v, want %v", got, initial)
+		}
+	}
+	// Sharing survives a restore: mutating one alias shows through the others.
+	if _, err := in.Call("mutate"); err != nil {
+		t.Fatal(err)
+	}
+	if got := state(in); !reflect.DeepEqual(got, mutated) {
+		t.Fatalf("state after mutate is %v, want %v", got, mutated)
+	}
+	// A snapshot of another script restores that script.
+	if err := in.Run(`var other = 1;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := state(in); !reflect.DeepEqual(got, initial) {
+		t.Fatalf("state after restoring over another script is %v, want %v", got, initial)
+	}
+	if err := New().Restore(s); err == nil {
+		t.Error("restored a snapshot into another interpreter")
+	}
+
+	// On disk, into a fresh interpreter that has run the same script.
+	if _, err := in.Call("mutate"); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := in.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if _, err := saved.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fresh := New()
+	if err := fresh.Run(source); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := fresh.ReadSnapshot(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Restore(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := state(fresh); !reflect.DeepEqual(got, mutated) {
+		t.Fatalf("state read from disk is %v, want %v", got, mutated)
+	}
+	if _, err := fresh.Call("mutate"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := state(fresh), []any{2, 4, 3, 12, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("state read from disk, then mutated, is %v, want %v", got, want)
+	}
+	// A changed script can't read it.
+	changed := New()
+	if err := changed.Run(`var pair = 1;`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := changed.ReadSnapshot(strings.NewReader(buf.String())); err == nil {
+		t.Error("read a snapshot of a different script")
+	}
+}
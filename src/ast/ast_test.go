@@ -0,0 +1,125 @@
+package ast
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"glox/src/compiler"
+	"glox/src/core"
+)
+
+// The code generator must emit exactly what the single-pass compiler does,
+// so these compile every script in the corpus both ways and compare the
+// functions produced, down to line tables and local variable ranges.
+
+func dumpFunction(sb *strings.Builder, fn *core.FunctionObject) {
+	c := fn.Chunk
+	fmt.Fprintf(sb, "fn %q arity=%d min=%d variadic=%v upvalues=%d params=%q returns=%q\n",
+		fn.Name.Get(), fn.Arity, fn.MinArity, fn.IsVariadic, fn.UpvalueCount, fn.ParamTypes, fn.ReturnType)
+	fmt.Fprintf(sb, "code %v\nlines %v\nlocals %v\nglobals %d %q\n", c.Code, c.Lines, c.LocalVars, c.GlobalCount, c.GlobalNames)
+	for i, k := range c.Constants {
+		if k.IsObj() {
+			if f, ok := k.Obj().(*core.FunctionObject); ok {
+				fmt.Fprintf(sb, "const %d:\n", i)
+				dumpFunction(sb, f)
+				continue
+			}
+		}
+		fmt.Fprintf(sb, "const %d: %d %s\n", i, k.Type(), k.String())
+	}
+}
+
+func dump(fn *core.FunctionObject) string {
+	if fn == nil {
+		return "<error>"
+	}
+	var sb strings.Builder
+	dumpFunction(&sb, fn)
+	return sb.String()
+}
+
+func corpus(t *testing.T) []string {
+	var files []string
+	for _, root := range []string{"../../tests", "../../lox_examples"} {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, ".lox") {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	if len(files) == 0 {
+		t.Skip("no .lox corpus found")
+	}
+	return files
+}
+
+func TestGeneratedBytecodeMatchesCompiler(t *testing.T) {
+	core.DebugSuppress = true
+	defer func() { core.DebugSuppress = false }()
+
+	for _, path := range corpus(t) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := compiler.Compile(path, string(src), "__main__")
+		got, diags := Compile(path, string(src), "__main__")
+		if (want == nil) != (got == nil) {
+			t.Errorf("%s: compiler ok=%v, ast ok=%v: %v", path, want != nil, got != nil, diags)
+			continue
+		}
+		if w, g := dump(want), dump(got); w != g {
+			t.Errorf("%s: bytecode differs\n%s", path, firstDifference(w, g))
+		}
+	}
+}
+
+// firstDifference shows the first line at which two dumps disagree.
+func firstDifference(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wl) && i < len(gl); i++ {
+		if wl[i] != gl[i] {
+			return fmt.Sprintf("line %d\nwant: %s\n got: %s", i+1, wl[i], gl[i])
+		}
+	}
+	return fmt.Sprintf("lengths differ: %d vs %d lines", len(wl), len(gl))
+}
+
+func TestParseKeepsStructure(t *testing.T) {
+	s, diags := Parse("t.lox", "func f(a, b = 2) {\n  return a + b;\n}\nprint f(1);\n")
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(s.Stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(s.Stmts))
+	}
+	f, ok := s.Stmts[0].(*FuncStmt)
+	if !ok || f.Func.Name.Lexeme() != "f" || len(f.Func.Params) != 2 || f.Func.Params[1].Default == nil {
+		t.Fatalf("unexpected function: %#v", s.Stmts[0])
+	}
+	if _, ok := s.Stmts[1].(*PrintStmt); !ok {
+		t.Fatalf("expected a print statement, got %T", s.Stmts[1])
+	}
+}
+
+func TestResolveBindsUpvalues(t *testing.T) {
+	s, _ := Parse("t.lox", "func outer() {\n  var x = 1;\n  func inner() { return x; }\n}\n")
+	if diags := Resolve(s); len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	outer := s.Stmts[0].(*FuncStmt).Func
+	inner := outer.Body.Stmts[1].(*FuncStmt).Func
+	ret := inner.Body.Stmts[0].(*ReturnStmt)
+	v := ret.Value.(*Variable)
+	if v.Binding.Kind != Upvalue || len(inner.Captures) != 1 || !inner.Captures[0].Local {
+		t.Fatalf("expected x captured as an upvalue, got %+v", v.Binding)
+	}
+	if !outer.Body.Stmts[0].(*VarStmt).Binding.Decl.Captured {
+		t.Fatal("expected x marked captured")
+	}
+}
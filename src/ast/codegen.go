@@ -0,0 +1,1434 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"glox/src/compiler"
+	"glox/src/core"
+	debug "glox/src/debug"
+)
+
+// genLocal is a local occupying a stack slot while generating code. decl is
+// nil for the placeholders that reserve slots while a finally block is
+// replayed.
+type genLocal struct {
+	decl  *Decl
+	depth int
+}
+
+// genLoop is the innermost loop, for break and continue.
+type genLoop struct {
+	previous   *genLoop
+	start      int
+	scopeDepth int
+	foreach    bool
+	breaks     []int
+	continues  []int
+}
+
+// genTry is an enclosing try statement. A return, break or continue that
+// leaves it is routed through its finally block, if it turns out to have
+// one, by a pending jump that is resolved once the statement is complete;
+// see compiler.TryFinally.
+type genTry struct {
+	previous          *genTry
+	scopeDepthAtEntry int
+	stmt              *TryStmt
+	pending           []*genSite
+}
+
+// genSite is a jump waiting for the finally blocks it crosses.
+type genSite struct {
+	jumpOffset           int
+	remaining            []*genTry
+	localCountAtCrossing int
+	retvalSlot           int
+	finalize             func(g *generator)
+}
+
+// genFunc is the function whose code is being generated.
+type genFunc struct {
+	enclosing *genFunc
+	function  *core.FunctionObject
+	kind      FuncKind
+	locals    []genLocal
+	depth     int
+	loop      *genLoop
+	tries     *genTry
+}
+
+// generator turns a resolved Script into bytecode. Each instruction is
+// attributed to the line of the token the compiler would have just consumed
+// when it emitted it, so line tables match too.
+type generator struct {
+	script      string
+	environment *core.Environment
+	fn          *genFunc
+	prev        Token
+	globals     map[string]int
+	globalCount int
+	consts      map[int]core.Value // global slot → value of a const with a constant initialiser
+	hadError    bool
+	diagnostics []Diagnostic
+}
+
+// Compile parses, resolves and generates code for source, the contents of
+// the file script, like compiler.Compile. It returns nil and the errors if
+// any stage fails.
+func Compile(script, source, module string) (*core.FunctionObject, []Diagnostic) {
+
+	s, diags := Parse(script, source)
+	if compiler.HasErrors(diags) {
+		return nil, diags
+	}
+	if diags = append(diags, Resolve(s)...); compiler.HasErrors(diags) {
+		return nil, diags
+	}
+	function, gdiags := Generate(s, module)
+	diags = append(diags, gdiags...)
+	if compiler.HasErrors(diags) {
+		return nil, diags
+	}
+	return function, diags
+}
+
+// Generate emits the bytecode for a resolved Script, returning the script's
+// function. Only limits of the bytecode format, such as the number of
+// constants in a chunk, can make it fail.
+func Generate(s *Script, module string) (*core.FunctionObject, []Diagnostic) {
+
+	g := &generator{
+		script:      s.Name,
+		environment: core.NewEnvironment(module),
+		globals:     map[string]int{},
+		consts:      map[int]core.Value{},
+	}
+	g.beginFunction(FuncScript)
+	g.stmts(s.Stmts)
+	g.at(s.Last)
+	function := g.endFunction()
+	function.Chunk.GlobalCount = g.globalCount
+	function.Chunk.GlobalNames = make([]string, g.globalCount)
+	for name, slot := range g.globals {
+		function.Chunk.GlobalNames[slot] = name
+	}
+	if g.hadError {
+		return nil, g.diagnostics
+	}
+	return function, g.diagnostics
+}
+
+//-----------------------------------------------------------------------------
+// Emitting.
+
+// at records tok as the token just consumed, whose line the next
+// instructions are attributed to.
+func (g *generator) at(tok Token) {
+
+	g.prev = tok
+}
+
+func (g *generator) chunk() *core.Chunk {
+
+	return g.fn.function.Chunk
+}
+
+func (g *generator) emit(bytes ...uint8) {
+
+	for _, b := range bytes {
+		g.chunk().WriteOpCode(b, g.prev.Line)
+	}
+}
+
+func (g *generator) error(msg string) {
+
+	g.hadError = true
+	g.diagnostics = report(g.diagnostics, Diagnostic{
+		Severity: compiler.SeverityError,
+		Code:     compiler.CodeSyntax,
+		Span:     tokenSpan(g.script, g.prev),
+		Message:  msg,
+	})
+}
+
+func (g *generator) makeConstant(v core.Value) uint8 {
+
+	idx := g.chunk().AddConstant(v)
+	if idx > 254 {
+		g.error("Too many constants in one chunk")
+		return 0
+	}
+	return idx
+}
+
+func (g *generator) identConstant(tok Token) uint8 {
+
+	return g.makeConstant(core.MakeStringObjectValue(tok.Lexeme(), false))
+}
+
+func (g *generator) emitJump(op uint8) int {
+
+	g.emit(op, 0xff, 0xff)
+	return len(g.chunk().Code) - 2
+}
+
+func (g *generator) patchJump(offset int) {
+
+	jump := len(g.chunk().Code) - offset - 2
+	g.chunk().Code[offset] = uint8((jump >> 8) & 0xff)
+	g.chunk().Code[offset+1] = uint8(jump & 0xff)
+}
+
+func (g *generator) emitLoop(op uint8, start int) {
+
+	g.emit(op)
+	offset := len(g.chunk().Code) - start + 2
+	if offset >= int(^uint16(0)) {
+		g.error("Loop body too large")
+	}
+	g.emit(uint8((offset>>8)&0xff), uint8(offset&0xff))
+}
+
+// globalSlot returns the slot of the global name, allocating the next one
+// the first time a name is seen, in the same order as the compiler.
+func (g *generator) globalSlot(name string) int {
+
+	if idx, ok := g.globals[name]; ok {
+		return idx
+	}
+	idx := g.globalCount
+	g.globals[name] = idx
+	g.globalCount++
+	return idx
+}
+
+//-----------------------------------------------------------------------------
+// Functions and scopes.
+
+func (g *generator) beginFunction(kind FuncKind) {
+
+	fn := &genFunc{
+		enclosing: g.fn,
+		function:  core.MakeFunctionObject(g.script, g.environment),
+		kind:      kind,
+		locals:    []genLocal{{}},
+	}
+	fn.function.Chunk.LocalVars = append(fn.function.Chunk.LocalVars, core.LocalVarInfo{
+		Name:  "",
+		EndIp: -1,
+	})
+	g.fn = fn
+}
+
+// endFunction emits the implicit return at the end of a function body,
+// optimises the chunk and returns to the enclosing function.
+func (g *generator) endFunction() *core.FunctionObject {
+
+	g.emitReturn()
+	if !core.DebugSkipPeephole {
+		compiler.FoldConstants(g.chunk())
+		compiler.PeepholeOptimise(g.chunk())
+	}
+	function := g.fn.function
+	if core.DebugPrintCode && !core.DebugSuppress && !g.hadError {
+		name := function.Name.Get()
+		if name == "" {
+			name = g.script
+		}
+		debug.Disassemble(g.chunk(), name)
+	}
+	g.fn = g.fn.enclosing
+	return function
+}
+
+// emitReturn returns nil, or the receiver from an initializer.
+func (g *generator) emitReturn() {
+
+	if g.fn.kind == FuncInitializer {
+		g.emit(core.OP_GET_LOCAL, 0)
+	} else {
+		g.emit(core.OP_NIL)
+	}
+	g.emit(core.OP_RETURN)
+}
+
+func (g *generator) beginScope() {
+
+	g.fn.depth++
+}
+
+// endScope pops the locals of the innermost scope, closing over those
+// captured by a closure.
+func (g *generator) endScope() {
+
+	fn := g.fn
+	fn.depth--
+	lvs := g.chunk().LocalVars
+	for len(fn.locals) > 0 && fn.locals[len(fn.locals)-1].depth > fn.depth {
+		last := len(fn.locals) - 1
+		if d := fn.locals[last].decl; d != nil && d.Captured {
+			g.emit(core.OP_CLOSE_UPVALUE)
+		} else {
+			g.emit(core.OP_POP)
+		}
+		for i := len(lvs) - 1; i >= 0; i-- {
+			if lvs[i].Slot == last && lvs[i].EndIp == -1 {
+				lvs[i].EndIp = len(g.chunk().Code)
+				break
+			}
+		}
+		fn.locals = fn.locals[:last]
+	}
+}
+
+// addLocal gives d the next stack slot, initialised.
+func (g *generator) addLocal(d *Decl) int {
+
+	fn := g.fn
+	if len(fn.locals) == 256 {
+		g.error("Too many variables in function")
+		return 0
+	}
+	fn.locals = append(fn.locals, genLocal{decl: d, depth: fn.depth})
+	slot := len(fn.locals) - 1
+	g.chunk().LocalVars = append(g.chunk().LocalVars, core.LocalVarInfo{
+		Name:    d.Name,
+		StartIp: len(g.chunk().Code),
+		EndIp:   -1,
+		Slot:    slot,
+	})
+	return slot
+}
+
+// slotOf returns the stack slot of the local d in the current function, or
+// -1 if it is not in scope.
+func (g *generator) slotOf(fn *genFunc, d *Decl) int {
+
+	for i := len(fn.locals) - 1; i >= 0; i-- {
+		if fn.locals[i].decl == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// variableOps returns the get and set instructions and operand for a name
+// bound by b. A finally block replayed for a break runs with the locals of
+// the loop body out of scope; the compiler then looks the name up afresh,
+// and so does this.
+func (g *generator) variableOps(name string, b Binding) (get, set uint8, arg int) {
+
+	switch b.Kind {
+	case Upvalue:
+		return core.OP_GET_UPVALUE, core.OP_SET_UPVALUE, b.Index
+	case Local:
+		if slot := g.slotOf(g.fn, b.Decl); slot >= 0 {
+			return core.OP_GET_LOCAL, core.OP_SET_LOCAL, slot
+		}
+		for i := len(g.fn.locals) - 1; i >= 0; i-- {
+			if d := g.fn.locals[i].decl; d != nil && d.Name == name {
+				return core.OP_GET_LOCAL, core.OP_SET_LOCAL, i
+			}
+		}
+	}
+	return core.OP_GET_GLOBAL, core.OP_SET_GLOBAL, g.globalSlot(name)
+}
+
+// getVariable emits a read of the variable name bound by b.
+func (g *generator) getVariable(name string, b Binding) {
+
+	get, _, arg := g.variableOps(name, b)
+	if value, ok := g.consts[arg]; ok && get == core.OP_GET_GLOBAL && g.fn.enclosing == nil && !core.DebugSkipPeephole {
+		// a const read in top-level code, as compiler.constGlobal allows
+		g.emit(core.OP_CONSTANT, g.makeConstant(value))
+		return
+	}
+	g.emit(get, uint8(arg))
+}
+
+// declare allocates the variable a declaration binds: a stack slot for a
+// local, a global slot otherwise.
+func (g *generator) declare(name Token, b Binding) int {
+
+	if b.Kind == Local {
+		return g.addLocal(b.Decl)
+	}
+	return g.globalSlot(name.Lexeme())
+}
+
+// define finishes a declaration. A local is already in its slot; a global
+// is stored from the stack.
+func (g *generator) define(b Binding, slot int, isConst bool) {
+
+	if b.Kind == Local {
+		return
+	}
+	delete(g.consts, slot)
+	if isConst {
+		g.emit(core.OP_DEFINE_GLOBAL_CONST, uint8(slot))
+	} else {
+		g.emit(core.OP_DEFINE_GLOBAL, uint8(slot))
+	}
+}
+
+// function emits a function's code into a chunk of its own, and the closure
+// that creates it at run time into the enclosing chunk.
+func (g *generator) function(f *Function) {
+
+	g.beginFunction(f.Kind)
+	fo := g.fn.function
+	switch {
+	case present(f.Name):
+		fo.Name = core.MakeStringObject(f.Name.Lexeme())
+	default:
+		fo.Name = core.MakeStringObject("<lambda>")
+	}
+	g.fn.locals[0].decl = f.This
+	g.beginScope()
+
+	minArity := 0
+	if f.Kind == FuncDecoratedMethod {
+		fo.Arity, fo.MinArity = 1, 1
+		g.addLocal(f.Receiver)
+		fo.ParamTypes = append(fo.ParamTypes, "")
+		minArity = 1
+	}
+	for _, prm := range f.Params {
+		fo.Arity++
+		slot := g.addLocal(prm.Decl)
+		fo.ParamTypes = append(fo.ParamTypes, annotationString(prm.Type))
+		switch {
+		case present(prm.Star):
+			fo.IsVariadic = true
+		case prm.Default != nil:
+			// Run the default only when the argument was left out.
+			g.at(prm.Equal)
+			g.emit(core.OP_JUMP_IF_DEFINED, uint8(slot), 0xff, 0xff)
+			off := len(g.chunk().Code) - 2
+			g.expr(prm.Default)
+			g.emit(core.OP_SET_LOCAL, uint8(slot), core.OP_POP)
+			g.patchJump(off)
+		case !present(prm.Equal) && !hasDefaultBefore(f.Params, prm):
+			minArity++
+		}
+	}
+	if len(f.Params) > 0 {
+		fo.MinArity = minArity
+	}
+	if f.Return != nil {
+		fo.ReturnType = annotationString(f.Return)
+	}
+	if present(f.Async) {
+		g.at(f.Body.LBrace)
+		g.emit(core.OP_ASYNC)
+	}
+
+	g.stmts(f.Body.Stmts)
+	g.at(f.Body.End())
+	function := g.endFunction()
+	function.UpvalueCount = len(f.Captures)
+
+	g.emit(core.OP_CLOSURE, g.makeConstant(core.MakeObjectValue(function, false)))
+	for _, c := range f.Captures {
+		if c.Local {
+			slot := g.slotOf(g.fn, c.Decl)
+			if slot < 0 {
+				slot = 0
+			}
+			g.emit(1, uint8(slot))
+		} else {
+			g.emit(0, uint8(c.Index))
+		}
+	}
+}
+
+// hasDefaultBefore reports whether a parameter before prm has a default.
+func hasDefaultBefore(params []*Param, prm *Param) bool {
+
+	for _, p := range params {
+		if p == prm {
+			return false
+		}
+		if p.Default != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// annotationString is how a function object records a type annotation.
+func annotationString(t *TypeAnnotation) string {
+
+	if t == nil || t.Type == nil {
+		return ""
+	}
+	return t.Type.String()
+}
+
+// decorators evaluates decorator expressions, leaving their values on the
+// stack to be called by applyDecorators.
+func (g *generator) decorators(decorators []*Decorator) {
+
+	for _, d := range decorators {
+		g.expr(d.X)
+	}
+}
+
+// applyDecorators calls each decorator, innermost first, with the value
+// above it.
+func (g *generator) applyDecorators(decorators []*Decorator) {
+
+	for range decorators {
+		g.emit(core.OP_CALL, 1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Statements.
+
+func (g *generator) stmts(list []Stmt) {
+
+	for _, s := range list {
+		g.stmt(s)
+	}
+}
+
+func (g *generator) stmt(s Stmt) {
+
+	switch s := s.(type) {
+	case *ExprStmt:
+		if a, ok := s.X.(*Assign); ok && a.Declares {
+			v := a.Target.(*Variable)
+			slot := g.declare(v.Name, v.Binding)
+			g.expr(a.Value)
+			g.at(s.End())
+			g.define(v.Binding, slot, false)
+			return
+		}
+		g.expr(s.X)
+		g.at(s.End())
+		g.emit(core.OP_POP)
+	case *UnpackStmt:
+		g.unpack(s)
+	case *VarStmt:
+		g.varStmt(s)
+	case *PrintStmt:
+		g.expr(s.X)
+		g.at(s.End())
+		g.emit(core.OP_STR, core.OP_PRINT)
+	case *RaiseStmt:
+		g.expr(s.Value)
+		g.at(s.End())
+		g.emit(core.OP_RAISE)
+	case *BreakpointStmt:
+		g.at(s.End())
+		g.emit(core.OP_BREAKPOINT)
+	case *Block:
+		g.beginScope()
+		g.stmts(s.Stmts)
+		g.at(s.End())
+		g.endScope()
+	case *IfStmt:
+		g.ifStmt(s)
+	case *WhileStmt:
+		g.whileStmt(s)
+	case *ForStmt:
+		g.forStmt(s)
+	case *ForeachStmt:
+		g.foreachStmt(s)
+	case *BreakStmt:
+		g.at(s.End())
+		g.breakStmt()
+	case *ContinueStmt:
+		g.at(s.End())
+		g.continueStmt()
+	case *ReturnStmt:
+		g.returnStmt(s)
+	case *ImportStmt:
+		g.importStmt(s)
+	case *FromImportStmt:
+		g.fromImportStmt(s)
+	case *TryStmt:
+		g.tryStmt(s)
+	case *FuncStmt:
+		slot := g.declare(s.Func.Name, s.Binding)
+		g.decorators(s.Decorators)
+		g.function(s.Func)
+		g.applyDecorators(s.Decorators)
+		g.define(s.Binding, slot, false)
+	case *ClassStmt:
+		g.classStmt(s)
+	case *ExportStmt:
+		g.stmt(s.Decl)
+		var name Token
+		switch d := s.Decl.(type) {
+		case *FuncStmt:
+			name = d.Func.Name
+		case *ClassStmt:
+			name = d.Name
+		case *VarStmt:
+			name = d.Name
+		}
+		g.at(s.End())
+		g.emit(core.OP_EXPORT, g.identConstant(name))
+	}
+}
+
+func (g *generator) varStmt(s *VarStmt) {
+
+	slot := g.declare(s.Name, s.Binding)
+	start := len(g.chunk().Code)
+	if s.Value != nil {
+		g.expr(s.Value)
+	} else {
+		if s.Type != nil {
+			g.at(s.Type.Last)
+		} else {
+			g.at(s.Name)
+		}
+		g.emit(core.OP_NIL)
+	}
+	g.at(s.End())
+	value, folds := compiler.ConstantValue(g.chunk(), start)
+	g.define(s.Binding, slot, s.Const)
+	if s.Const && s.Binding.Kind != Local && folds && !g.hadError {
+		g.consts[slot] = value
+	}
+}
+
+func (g *generator) unpack(s *UnpackStmt) {
+
+	g.expr(s.Value)
+	g.at(s.Value.End())
+	g.emit(core.OP_UNPACK, uint8(len(s.Names)))
+	if g.fn.depth > 0 {
+		for i, b := range s.Bindings {
+			if s.Declares[i] {
+				g.addLocal(b.Decl)
+			}
+		}
+		return
+	}
+	for i := len(s.Names) - 1; i >= 0; i-- {
+		if s.Declares[i] {
+			slot := g.globalSlot(s.Names[i].Lexeme())
+			delete(g.consts, slot)
+			g.emit(core.OP_DEFINE_GLOBAL, uint8(slot))
+		}
+	}
+}
+
+func (g *generator) ifStmt(s *IfStmt) {
+
+	g.expr(s.Cond)
+	g.at(s.RParen)
+	thenJump := g.emitJump(core.OP_JUMP_IF_FALSE)
+	g.emit(core.OP_POP)
+	g.stmt(s.Then)
+	g.at(s.Then.End())
+	elseJump := g.emitJump(core.OP_JUMP)
+	g.patchJump(thenJump)
+	g.emit(core.OP_POP)
+	if s.Else != nil {
+		g.stmt(s.Else)
+	}
+	g.patchJump(elseJump)
+}
+
+func (g *generator) pushLoop(foreach bool) *genLoop {
+
+	g.fn.loop = &genLoop{previous: g.fn.loop, foreach: foreach}
+	return g.fn.loop
+}
+
+func (g *generator) patchBreaks(loop *genLoop) {
+
+	for _, jump := range loop.breaks {
+		g.patchJump(jump)
+	}
+}
+
+func (g *generator) whileStmt(s *WhileStmt) {
+
+	loop := g.pushLoop(false)
+	loop.scopeDepth = g.fn.depth
+	loop.start = len(g.chunk().Code)
+	g.expr(s.Cond)
+	g.at(s.RParen)
+	exitJump := g.emitJump(core.OP_JUMP_IF_FALSE)
+	g.emit(core.OP_POP)
+	g.stmt(s.Body)
+	g.at(s.Body.End())
+	g.emitLoop(core.OP_LOOP, loop.start)
+	g.patchJump(exitJump)
+	g.emit(core.OP_POP)
+	g.patchBreaks(loop)
+	g.fn.loop = loop.previous
+}
+
+func (g *generator) forStmt(s *ForStmt) {
+
+	loop := g.pushLoop(false)
+	g.beginScope()
+	loop.scopeDepth = g.fn.depth
+	if s.Init != nil {
+		g.stmt(s.Init)
+	}
+	loop.start = len(g.chunk().Code)
+	exitJump := -1
+	if s.Cond != nil {
+		g.expr(s.Cond)
+		g.at(s.CondSemi)
+		exitJump = g.emitJump(core.OP_JUMP_IF_FALSE)
+		g.emit(core.OP_POP)
+	}
+	if s.Incr != nil {
+		// The increment runs after the body, which is jumped to first.
+		g.at(s.CondSemi)
+		bodyJump := g.emitJump(core.OP_JUMP)
+		incrStart := len(g.chunk().Code)
+		g.expr(s.Incr)
+		g.at(s.Incr.End())
+		g.emit(core.OP_POP)
+		g.at(s.RParen)
+		g.emitLoop(core.OP_LOOP, loop.start)
+		loop.start = incrStart
+		g.patchJump(bodyJump)
+	}
+	g.stmt(s.Body)
+	g.at(s.Body.End())
+	g.emitLoop(core.OP_LOOP, loop.start)
+	if exitJump != -1 {
+		g.patchJump(exitJump)
+		g.emit(core.OP_POP)
+	}
+	g.patchBreaks(loop)
+	g.endScope()
+	g.fn.loop = loop.previous
+}
+
+func (g *generator) foreachStmt(s *ForeachStmt) {
+
+	loop := g.pushLoop(true)
+	g.beginScope()
+	loop.scopeDepth = g.fn.depth
+	slot := g.declare(s.Var.Name, s.Var.Binding)
+	if s.Var.Value != nil {
+		g.expr(s.Var.Value)
+	} else {
+		g.at(s.Var.End())
+		g.emit(core.OP_NIL)
+	}
+	g.expr(s.Iterable)
+	iterSlot := g.addLocal(s.Iter)
+	g.at(s.RParen)
+	g.emit(core.OP_FOREACH, uint8(slot), uint8(iterSlot), 0xff, 0xff)
+	jumpToEnd := len(g.chunk().Code) - 3
+
+	loop.start = len(g.chunk().Code)
+	g.stmt(s.Body)
+	for _, jump := range loop.continues {
+		g.patchJump(jump)
+	}
+	g.at(s.Body.End())
+	g.emitLoop(core.OP_NEXT, loop.start)
+	g.emit(uint8(iterSlot), core.OP_END_FOREACH)
+	jump := len(g.chunk().Code) - jumpToEnd - 2
+	g.chunk().Code[jumpToEnd+1] = uint8((jump >> 8) & 0xff)
+	g.chunk().Code[jumpToEnd+2] = uint8(jump & 0xff)
+	g.patchBreaks(loop)
+	g.endScope()
+	g.fn.loop = loop.previous
+}
+
+// popLoopLocals pops the locals declared inside the innermost loop, for a
+// break or continue.
+func (g *generator) popLoopLocals() {
+
+	for _, l := range g.fn.locals {
+		if l.depth > g.fn.loop.scopeDepth {
+			g.emit(core.OP_POP)
+		}
+	}
+}
+
+func (g *generator) breakStmt() {
+
+	loop := g.fn.loop
+	g.popLoopLocals()
+	g.emitCrossingJump(loop.scopeDepth, func(g *generator) {
+		loop.breaks = append(loop.breaks, g.emitJump(core.OP_JUMP))
+	})
+}
+
+func (g *generator) continueStmt() {
+
+	loop := g.fn.loop
+	g.popLoopLocals()
+	if loop.foreach {
+		g.emitCrossingJump(loop.scopeDepth, func(g *generator) {
+			loop.continues = append(loop.continues, g.emitJump(core.OP_JUMP))
+		})
+	} else {
+		g.emitCrossingJump(loop.scopeDepth, func(g *generator) {
+			g.emitLoop(core.OP_LOOP, loop.start)
+		})
+	}
+}
+
+// emitCrossingJump leaves every try statement between here and a loop at
+// boundary depth, then jumps with finalize, through the finally blocks of
+// the try statements it leaves.
+func (g *generator) emitCrossingJump(boundary int, finalize func(g *generator)) {
+
+	var crossed []*genTry
+	for t := g.fn.tries; t != nil && t.scopeDepthAtEntry >= boundary; t = t.previous {
+		g.emit(core.OP_END_TRY, 0, 0)
+		crossed = append(crossed, t)
+	}
+	if len(crossed) == 0 {
+		finalize(g)
+		return
+	}
+	n := len(g.fn.locals)
+	for n > 0 && g.fn.locals[n-1].depth > boundary {
+		n--
+	}
+	crossed[0].pending = append(crossed[0].pending, &genSite{
+		jumpOffset:           g.emitJump(core.OP_JUMP),
+		remaining:            crossed[1:],
+		localCountAtCrossing: n,
+		retvalSlot:           -1,
+		finalize:             finalize,
+	})
+}
+
+func (g *generator) returnStmt(s *ReturnStmt) {
+
+	if s.Value != nil {
+		g.expr(s.Value)
+		g.at(s.End())
+	} else {
+		g.at(s.End())
+		if g.fn.kind == FuncInitializer {
+			g.emit(core.OP_GET_LOCAL, 0)
+		} else {
+			g.emit(core.OP_NIL)
+		}
+	}
+	var chain []*genTry
+	for t := g.fn.tries; t != nil; t = t.previous {
+		chain = append(chain, t)
+	}
+	if len(chain) == 0 {
+		g.emit(core.OP_RETURN)
+		return
+	}
+	// Keep the value in a local of its own while the finally blocks run.
+	retvalSlot := g.addLocal(s.Retval)
+	chain[0].pending = append(chain[0].pending, &genSite{
+		jumpOffset:           g.emitJump(core.OP_JUMP),
+		remaining:            chain[1:],
+		localCountAtCrossing: len(g.fn.locals),
+		retvalSlot:           retvalSlot,
+		finalize: func(g *generator) {
+			g.emit(core.OP_RETURN)
+		},
+	})
+}
+
+// moduleName is the dotted name of a module as the VM resolves it.
+func moduleName(dots, path []Token) string {
+
+	var sb strings.Builder
+	for range dots {
+		sb.WriteString(".")
+	}
+	for i, t := range path {
+		if i > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(t.Lexeme())
+	}
+	return sb.String()
+}
+
+func (g *generator) importStmt(s *ImportStmt) {
+
+	for _, m := range s.Modules {
+		name := moduleName(nil, m.Path)
+		nameConstant := g.makeConstant(core.MakeStringObjectValue(name, false))
+		g.at(m.Path[len(m.Path)-1])
+		g.emit(core.OP_IMPORT, nameConstant)
+		alias, _, _ := strings.Cut(name, ".")
+		if present(m.Alias) {
+			g.at(m.Alias)
+			g.emit(g.identConstant(m.Alias))
+			alias = m.Alias.Lexeme()
+		} else {
+			g.emit(nameConstant)
+		}
+		// The bound name gets a global slot of its own, as in the compiler.
+		delete(g.consts, g.globalSlot(alias))
+	}
+}
+
+func (g *generator) fromImportStmt(s *FromImportStmt) {
+
+	nameConstant := g.makeConstant(core.MakeStringObjectValue(moduleName(s.Dots, s.Path), false))
+	switch {
+	case len(s.Path) > 0:
+		g.at(s.Path[len(s.Path)-1])
+	case len(s.Dots) > 0:
+		g.at(s.Dots[len(s.Dots)-1])
+	}
+	g.emit(core.OP_IMPORT_FROM, nameConstant)
+	if present(s.Star) {
+		g.at(s.Star)
+		clear(g.consts) // any global may be replaced
+		g.emit(0)       // all names
+		return
+	}
+	g.at(s.Names[len(s.Names)-1])
+	g.emit(uint8(len(s.Names)))
+	for _, name := range s.Names {
+		g.emit(g.identConstant(name))
+		delete(g.consts, g.globalSlot(name.Lexeme()))
+	}
+}
+
+// tryStmt emits a try statement. A finally block is emitted twice, as the
+// handler that runs it and re-raises an exception escaping the statement
+// and on the normal way out, and once more for each return, break or
+// continue that leaves through it.
+func (g *generator) tryStmt(s *TryStmt) {
+
+	g.at(s.Body.LBrace)
+	g.emit(core.OP_TRY, 0xff, 0xff)
+	tryOp := len(g.chunk().Code) - 2
+	t := &genTry{previous: g.fn.tries, scopeDepthAtEntry: g.fn.depth, stmt: s}
+	g.fn.tries = t
+
+	g.stmt(s.Body)
+	g.at(s.Body.End())
+	exitJumps := []int{g.emitJump(core.OP_END_TRY)}
+
+	patched := false
+	for _, c := range s.Excepts {
+		typeConstant := g.identConstant(c.Type)
+		if !patched {
+			g.patchTry(tryOp)
+			patched = true
+		}
+		g.beginScope()
+		g.addLocal(c.Decl)
+		g.at(c.Body.LBrace)
+		g.emit(core.OP_EXCEPT, typeConstant)
+		g.stmts(c.Body.Stmts)
+		g.at(c.Body.End())
+		g.endScope()
+		exitJumps = append(exitJumps, g.emitJump(core.OP_JUMP))
+		g.emit(core.OP_END_EXCEPT)
+	}
+
+	if s.Finally == nil {
+		for _, j := range exitJumps {
+			g.patchJump(j)
+		}
+		g.fn.tries = t.previous
+		g.trampolinesAfterNormalPath(t)
+		return
+	}
+
+	if !patched {
+		g.patchTry(tryOp)
+	}
+	// The handler for an exception escaping the statement comes first, right
+	// after the last except clause, where the VM looks for it.
+	g.at(s.Finally.LBrace)
+	g.emit(core.OP_FINALLY)
+	g.beginScope()
+	excSlot := g.addLocal(s.Exc)
+	g.fn.tries = t.previous
+	g.stmts(s.Finally.Stmts)
+	g.at(s.Finally.End())
+	g.emit(core.OP_GET_LOCAL, uint8(excSlot), core.OP_RAISE)
+	g.endScope()
+
+	for _, j := range exitJumps {
+		g.patchJump(j)
+	}
+	g.finallyBlock(s)
+	g.fn.tries = t.previous
+	g.trampolinesAfterNormalPath(t)
+}
+
+func (g *generator) patchTry(offset int) {
+
+	address := len(g.chunk().Code)
+	g.chunk().Code[offset] = uint8((address >> 8) & 0xff)
+	g.chunk().Code[offset+1] = uint8(address & 0xff)
+}
+
+// finallyBlock emits the finally block of s in a scope of its own.
+func (g *generator) finallyBlock(s *TryStmt) {
+
+	g.at(s.Finally.LBrace)
+	g.beginScope()
+	g.stmts(s.Finally.Stmts)
+	g.at(s.Finally.End())
+	g.endScope()
+}
+
+// trampolinesAfterNormalPath emits the pending jumps out of t behind a jump
+// that takes the normal way out of the statement past them.
+func (g *generator) trampolinesAfterNormalPath(t *genTry) {
+
+	if len(t.pending) == 0 {
+		return
+	}
+	g.at(t.stmt.End())
+	skip := g.emitJump(core.OP_JUMP)
+	g.pendingTrampolines(t)
+	g.patchJump(skip)
+}
+
+// pendingTrampolines lands each jump waiting on t, runs t's finally block
+// if it has one, and carries on to the next try statement the jump leaves
+// or to its destination.
+func (g *generator) pendingTrampolines(t *genTry) {
+
+	for _, site := range t.pending {
+		g.patchJump(site.jumpOffset)
+		if t.stmt.Finally != nil {
+			fn := g.fn
+			savedLocals := append([]genLocal(nil), fn.locals...)
+			savedDepth := fn.depth
+			// Reserve the slots still live on the stack, so the replay's
+			// own locals cannot overwrite them.
+			for len(fn.locals) < site.localCountAtCrossing {
+				fn.locals = append(fn.locals, genLocal{depth: fn.depth})
+			}
+			fn.locals = fn.locals[:site.localCountAtCrossing]
+			savedTries := fn.tries
+			fn.tries = t.previous
+
+			g.finallyBlock(t.stmt)
+
+			fn.tries = savedTries
+			fn.locals = savedLocals
+			fn.depth = savedDepth
+			if site.retvalSlot >= 0 {
+				g.emit(core.OP_GET_LOCAL, uint8(site.retvalSlot))
+			}
+		}
+		g.at(t.stmt.End())
+		if len(site.remaining) > 0 {
+			next := site.remaining[0]
+			next.pending = append(next.pending, &genSite{
+				jumpOffset:           g.emitJump(core.OP_JUMP),
+				remaining:            site.remaining[1:],
+				localCountAtCrossing: site.localCountAtCrossing,
+				retvalSlot:           site.retvalSlot,
+				finalize:             site.finalize,
+			})
+		} else {
+			site.finalize(g)
+		}
+	}
+}
+
+func (g *generator) classStmt(s *ClassStmt) {
+
+	nameConstant := g.identConstant(s.Name)
+	classSlot := g.globalSlot(s.Name.Lexeme())
+	if s.Binding.Kind == Local {
+		g.addLocal(s.Binding.Decl)
+	}
+	g.at(s.Name)
+	g.emit(core.OP_CLASS, nameConstant)
+	g.define(s.Binding, classSlot, false)
+
+	name := s.Name.Lexeme()
+	if s.Super != nil {
+		g.at(s.Super.Name)
+		g.getVariable(s.Super.Name.Lexeme(), s.Super.Binding)
+		g.beginScope()
+		g.addLocal(s.SuperDecl)
+		g.getVariable(name, s.Binding)
+		g.emit(core.OP_INHERIT)
+	}
+	g.getVariable(name, s.Binding)
+
+	for _, m := range s.Members {
+		switch m := m.(type) {
+		case *Method:
+			methodConstant := g.identConstant(m.Func.Name)
+			if m.Func.Kind == FuncDecoratedMethod {
+				g.decoratedMethod(s, m, methodConstant)
+				continue
+			}
+			g.decorators(m.Decorators)
+			g.function(m.Func)
+			g.applyDecorators(m.Decorators)
+			if present(m.Static) {
+				g.emit(core.OP_STATIC_METHOD, methodConstant)
+			} else {
+				g.emit(core.OP_METHOD, methodConstant)
+			}
+		case *ClassVar:
+			varConstant := g.identConstant(m.Name)
+			if m.Value != nil {
+				g.expr(m.Value)
+			} else {
+				if m.Type != nil {
+					g.at(m.Type.Last)
+				} else {
+					g.at(m.Name)
+				}
+				g.emit(core.OP_NIL)
+			}
+			g.at(m.End())
+			g.emit(core.OP_CLASS_VAR, varConstant)
+		}
+	}
+	g.at(s.End())
+	g.emit(core.OP_POP)
+	if s.Super != nil {
+		g.endScope()
+	}
+
+	if len(s.Decorators) > 0 {
+		g.decorators(s.Decorators)
+		g.at(s.End())
+		g.getVariable(name, s.Binding)
+		g.applyDecorators(s.Decorators)
+		_, set, arg := g.variableOps(name, s.Binding)
+		g.emit(set, uint8(arg), core.OP_POP)
+	}
+}
+
+// decoratedMethod emits an instance method under decorators: what they
+// make of the function taking this as its first argument goes in a local,
+// with the class off the stack meanwhile, and the method is a stub calling
+// it with its receiver, m(*args) { return decorated(this, *args); }.
+func (g *generator) decoratedMethod(s *ClassStmt, m *Method, methodConstant uint8) {
+
+	name := s.Name.Lexeme()
+	g.at(m.Func.Name)
+	g.emit(core.OP_POP)
+	g.beginScope()
+	g.decorators(m.Decorators)
+	g.function(m.Func)
+	g.applyDecorators(m.Decorators)
+	decorated := g.addLocal(m.Decorated)
+	g.getVariable(name, s.Binding)
+
+	g.beginFunction(FuncMethod)
+	fo := g.fn.function
+	fo.Name = core.MakeStringObject(m.Func.Name.Lexeme())
+	g.beginScope()
+	g.addLocal(&Decl{Name: "args"})
+	fo.Arity, fo.IsVariadic = 1, true
+	fo.ParamTypes = append(fo.ParamTypes, "")
+	g.emit(core.OP_GET_UPVALUE, 0, core.OP_GET_LOCAL, 0, core.OP_GET_LOCAL, 1, core.OP_CALL_SPREAD, 2, core.OP_RETURN)
+	stub := g.endFunction()
+	stub.UpvalueCount = 1
+	g.emit(core.OP_CLOSURE, g.makeConstant(core.MakeObjectValue(stub, false)), 1, uint8(decorated))
+
+	g.emit(core.OP_METHOD, methodConstant, core.OP_POP)
+	g.endScope()
+	g.getVariable(name, s.Binding)
+}
+
+//-----------------------------------------------------------------------------
+// Expressions.
+
+func (g *generator) expr(x Expr) {
+
+	switch x := x.(type) {
+	case *Literal:
+		g.at(x.Token)
+		g.literal(x.Token)
+	case *Variable:
+		g.at(x.Name)
+		g.getVariable(x.Name.Lexeme(), x.Binding)
+	case *Assign:
+		g.assign(x)
+	case *This:
+		g.at(x.Keyword)
+		g.getVariable("this", x.Binding)
+	case *Super:
+		g.super(x)
+	case *Unary:
+		g.expr(x.X)
+		g.at(x.X.End())
+		if x.Op.Tokentype == compiler.TOKEN_MINUS {
+			g.emit(core.OP_NEGATE)
+		} else {
+			g.emit(core.OP_NOT)
+		}
+	case *Binary:
+		g.expr(x.X)
+		g.expr(x.Y)
+		g.at(x.Y.End())
+		g.binaryOp(x.Op.Tokentype)
+	case *Logical:
+		g.expr(x.X)
+		g.at(x.Op)
+		if x.Op.Tokentype == compiler.TOKEN_AND {
+			endJump := g.emitJump(core.OP_JUMP_IF_FALSE)
+			g.emit(core.OP_POP)
+			g.expr(x.Y)
+			g.patchJump(endJump)
+			return
+		}
+		elseJump := g.emitJump(core.OP_JUMP_IF_FALSE)
+		endJump := g.emitJump(core.OP_JUMP)
+		g.patchJump(elseJump)
+		g.emit(core.OP_POP)
+		g.expr(x.Y)
+		g.patchJump(endJump)
+	case *Conditional:
+		g.expr(x.Cond)
+		g.at(x.Question)
+		elseJump := g.emitJump(core.OP_JUMP_IF_FALSE)
+		g.emit(core.OP_POP)
+		g.expr(x.Then)
+		g.at(x.Then.End())
+		endJump := g.emitJump(core.OP_JUMP)
+		g.patchJump(elseJump)
+		g.emit(core.OP_POP)
+		g.expr(x.Else)
+		g.patchJump(endJump)
+	case *Grouping:
+		g.expr(x.X)
+	case *Tuple:
+		g.exprs(x.Elems)
+		g.at(x.RParen)
+		g.emit(core.OP_CREATE_TUPLE, uint8(len(x.Elems)))
+	case *Call:
+		g.expr(x.Callee)
+		g.exprs(x.Args.Args)
+		g.at(x.Args.RParen)
+		g.emit(x.Args.callOp(core.OP_CALL, core.OP_CALL_SPREAD), uint8(len(x.Args.Args)))
+	case *Property:
+		g.expr(x.Object)
+		name := g.identConstant(x.Name)
+		g.at(x.Name)
+		g.emit(core.OP_GET_PROPERTY, name)
+	case *Invoke:
+		g.expr(x.Object)
+		name := g.identConstant(x.Name)
+		g.exprs(x.Args.Args)
+		g.at(x.Args.RParen)
+		g.emit(x.Args.callOp(core.OP_INVOKE, core.OP_INVOKE_SPREAD), name, uint8(len(x.Args.Args)))
+	case *Index:
+		g.expr(x.Object)
+		g.identConstant(x.LBracket)
+		g.expr(x.Index)
+		g.at(x.RBracket)
+		g.emit(core.OP_INDEX)
+	case *Slice:
+		g.expr(x.Object)
+		g.identConstant(x.LBracket)
+		g.sliceBounds(x, nil)
+		g.at(x.RBracket)
+		g.emit(core.OP_SLICE)
+	case *List:
+		g.exprs(x.Elems)
+		g.at(x.RBracket)
+		g.emit(core.OP_CREATE_LIST, uint8(len(x.Elems)))
+	case *Dict:
+		for _, e := range x.Entries {
+			g.expr(e.Key)
+			g.expr(e.Value)
+		}
+		g.at(x.RBrace)
+		g.emit(core.OP_CREATE_DICT, uint8(len(x.Entries)))
+	case *Lambda:
+		g.function(x.Func)
+	case *Await:
+		g.expr(x.X)
+		g.at(x.X.End())
+		g.emit(core.OP_AWAIT)
+	case *Str:
+		g.expr(x.X)
+		g.at(x.RParen)
+		g.emit(core.OP_STR)
+	}
+}
+
+func (g *generator) exprs(list []Expr) {
+
+	for _, x := range list {
+		g.expr(x)
+	}
+}
+
+func (g *generator) literal(tok Token) {
+
+	switch tok.Tokentype {
+	case compiler.TOKEN_NIL:
+		g.emit(core.OP_NIL)
+	case compiler.TOKEN_FALSE:
+		g.emit(core.OP_FALSE)
+	case compiler.TOKEN_TRUE:
+		g.emit(core.OP_TRUE)
+	case compiler.TOKEN_INT:
+		v, _ := strconv.ParseInt(tok.Lexeme(), 10, 32)
+		g.emit(core.OP_CONSTANT, g.makeConstant(core.MakeIntValue(int(v), false)))
+	case compiler.TOKEN_FLOAT:
+		v, _ := strconv.ParseFloat(tok.Lexeme(), 64)
+		g.emit(core.OP_CONSTANT, g.makeConstant(core.MakeFloatValue(v, false)))
+	case compiler.TOKEN_STRING:
+		s := tok.Lexeme()
+		g.emit(core.OP_CONSTANT, g.makeConstant(core.MakeStringObjectValue(s[1:len(s)-1], false)))
+	}
+}
+
+func (g *generator) binaryOp(op TokenType) {
+
+	switch op {
+	case compiler.TOKEN_PLUS:
+		g.emit(core.OP_ADD_NUMERIC)
+	case compiler.TOKEN_PLUS_PLUS:
+		g.emit(core.OP_ADD_VECTOR)
+	case compiler.TOKEN_AMPERSAND:
+		g.emit(core.OP_CONCAT)
+	case compiler.TOKEN_MINUS:
+		g.emit(core.OP_SUBTRACT)
+	case compiler.TOKEN_STAR:
+		g.emit(core.OP_MULTIPLY)
+	case compiler.TOKEN_SLASH:
+		g.emit(core.OP_DIVIDE)
+	case compiler.TOKEN_PERCENT:
+		g.emit(core.OP_MODULUS)
+	case compiler.TOKEN_BANG_EQUAL:
+		g.emit(core.OP_EQUAL, core.OP_NOT)
+	case compiler.TOKEN_EQUAL_EQUAL:
+		g.emit(core.OP_EQUAL)
+	case compiler.TOKEN_LESS:
+		g.emit(core.OP_LESS)
+	case compiler.TOKEN_LESS_EQUAL:
+		g.emit(core.OP_GREATER, core.OP_NOT)
+	case compiler.TOKEN_GREATER:
+		g.emit(core.OP_GREATER)
+	case compiler.TOKEN_GREATER_EQUAL:
+		g.emit(core.OP_LESS, core.OP_NOT)
+	case compiler.TOKEN_IN:
+		g.emit(core.OP_IN)
+	}
+}
+
+// compoundOp is the arithmetic instruction of a compound assignment.
+func compoundOp(op TokenType) uint8 {
+
+	switch op {
+	case compiler.TOKEN_MINUS_EQUAL:
+		return core.OP_SUBTRACT
+	case compiler.TOKEN_STAR_EQUAL:
+		return core.OP_MULTIPLY
+	case compiler.TOKEN_SLASH_EQUAL:
+		return core.OP_DIVIDE
+	case compiler.TOKEN_PERCENT_EQUAL:
+		return core.OP_MODULUS
+	}
+	return core.OP_ADD_NUMERIC
+}
+
+// sliceBounds pushes the bounds of a slice, nil for a missing one. For an
+// assignment to `x[:]` the missing upper bound is attributed to the '='.
+func (g *generator) sliceBounds(x *Slice, assign *Assign) {
+
+	if x.Low != nil {
+		g.expr(x.Low)
+	} else {
+		g.at(x.Colon)
+		g.emit(core.OP_NIL)
+	}
+	if x.High != nil {
+		g.expr(x.High)
+		return
+	}
+	if assign != nil && x.Low == nil {
+		g.at(assign.Op)
+	} else {
+		g.at(x.RBracket)
+	}
+	g.emit(core.OP_NIL)
+}
+
+func (g *generator) assign(a *Assign) {
+
+	compound := a.Op.Tokentype != compiler.TOKEN_EQUAL
+	switch t := a.Target.(type) {
+	case *Variable:
+		name := t.Name.Lexeme()
+		get, set, arg := g.variableOps(name, t.Binding)
+		if compound {
+			g.at(a.Op)
+			g.emit(get, uint8(arg))
+		}
+		g.expr(a.Value)
+		g.at(a.Value.End())
+		if compound {
+			g.emit(compoundOp(a.Op.Tokentype))
+		}
+		g.emit(set, uint8(arg))
+	case *Property:
+		g.expr(t.Object)
+		name := g.identConstant(t.Name)
+		if compound {
+			g.at(a.Op)
+			g.emit(core.OP_DUP, core.OP_GET_PROPERTY, name)
+		}
+		g.expr(a.Value)
+		g.at(a.Value.End())
+		if compound {
+			g.emit(compoundOp(a.Op.Tokentype))
+		}
+		g.emit(core.OP_SET_PROPERTY, name)
+	case *Index:
+		g.expr(t.Object)
+		g.identConstant(t.LBracket)
+		g.expr(t.Index)
+		g.expr(a.Value)
+		g.at(a.Value.End())
+		g.emit(core.OP_INDEX_ASSIGN)
+	case *Slice:
+		g.expr(t.Object)
+		g.identConstant(t.LBracket)
+		g.sliceBounds(t, a)
+		g.expr(a.Value)
+		g.at(a.Value.End())
+		g.emit(core.OP_SLICE_ASSIGN)
+	}
+}
+
+// callOp returns op for a call with these arguments, or spreadOp when the
+// last of them is spread.
+func (a *ArgList) callOp(op, spreadOp uint8) uint8 {
+
+	if a.Spread() {
+		return spreadOp
+	}
+	return op
+}
+
+func (g *generator) super(x *Super) {
+
+	name := g.identConstant(x.Method)
+	g.at(x.Method)
+	g.getVariable("this", x.This)
+	if x.Args != nil {
+		g.exprs(x.Args.Args)
+		g.at(x.Args.RParen)
+		g.getVariable("supe", x.Super)
+		g.emit(x.Args.callOp(core.OP_SUPER_INVOKE, core.OP_SUPER_INVOKE_SPREAD), name, uint8(len(x.Args.Args)))
+		return
+	}
+	g.getVariable("supe", x.Super)
+	g.emit(core.OP_GET_SUPER, name)
+}
@@ -0,0 +1,890 @@
+// Package ast is a syntax tree for Lox source. Parse builds a Script from
+// source, Resolve binds every name in it to a local, upvalue or global, and
+// Generate turns the resolved tree into the same bytecode the single-pass
+// compiler in package compiler emits. Compile runs all three.
+//
+// Every node keeps the tokens it was parsed from, so tools such as a
+// formatter or a language server can map nodes back to the source.
+package ast
+
+import (
+	"glox/src/compiler"
+)
+
+// Token is a scanner token; nodes refer to source positions through them.
+type Token = compiler.Token
+
+// Node is implemented by every node of the tree. Pos is the node's first
+// token and End its last.
+type Node interface {
+	Pos() Token
+	End() Token
+}
+
+// Expr is an expression node.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is a statement or declaration node.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Member is a member of a class body: a *Method, *Field or *ClassVar.
+type Member interface {
+	Node
+	memberNode()
+}
+
+// present reports whether an optional token was actually parsed.
+func present(t Token) bool {
+
+	return t.Source != nil
+}
+
+// orElse returns t if it was parsed, otherwise the end of n.
+func orElse(t Token, n Node) Token {
+
+	if present(t) {
+		return t
+	}
+	return n.End()
+}
+
+//-----------------------------------------------------------------------------
+// Bindings.
+
+// Decl is a local variable: a declared name, a parameter, or one of the
+// hidden locals the code generator allocates (the receiver in slot 0, a
+// subclass's `super`, a foreach iterator, a finally block's pending
+// exception and a return value held across finally blocks). Hidden locals
+// have no Token.
+type Decl struct {
+	Name     string
+	Token    Token // the declaring identifier
+	Const    bool  // declared with `const`
+	Captured bool  // referenced from an inner function, so closed over when its scope ends
+}
+
+// BindingKind says where a name lives at run time.
+type BindingKind int
+
+const (
+	Unresolved BindingKind = iota
+	Global                 // a global of the module; Generate lays out the slots
+	Local                  // Decl is the local, a variable of the current function
+	Upvalue                // Index is the current function's upvalue
+)
+
+// Binding is what the resolver found a name to refer to.
+type Binding struct {
+	Kind  BindingKind
+	Index int
+	Decl  *Decl
+}
+
+// Capture is one upvalue of a function: either a local of the enclosing
+// function (Local set, Decl the local) or one of the enclosing function's
+// own upvalues (Index).
+type Capture struct {
+	Local bool
+	Decl  *Decl
+	Index int
+}
+
+//-----------------------------------------------------------------------------
+// Expressions.
+
+// Literal is an int, float, string, nil, true or false literal.
+type Literal struct {
+	Token Token
+}
+
+// Variable is a reference to a named variable.
+type Variable struct {
+	Name    Token
+	Binding Binding
+}
+
+// Assign assigns Value to Target, a *Variable, *Property, *Index or *Slice.
+// Op is '=' or, for variables and properties, a compound operator such as
+// '+='. Declares is set by the resolver when an assignment statement to an
+// undefined name declares it.
+type Assign struct {
+	Target   Expr
+	Op       Token
+	Value    Expr
+	Declares bool
+}
+
+// This is the `this` keyword.
+type This struct {
+	Keyword Token
+	Binding Binding
+}
+
+// Super is `super.method`, or `super.method(args)` when Args is not nil.
+// This and Super are the bindings of the receiver and the superclass.
+type Super struct {
+	Keyword Token
+	Method  Token
+	Args    *ArgList
+	This    Binding
+	Super   Binding
+}
+
+// ArgList is a parenthesised argument list. Star is set when the last
+// argument is spread: f(a, *rest).
+type ArgList struct {
+	LParen Token
+	Args   []Expr
+	Star   Token
+	RParen Token
+}
+
+// Spread reports whether the last argument is spread.
+func (a *ArgList) Spread() bool { return present(a.Star) }
+
+// Unary is `-x` or `!x`.
+type Unary struct {
+	Op Token
+	X  Expr
+}
+
+// Binary is an arithmetic, comparison, equality or `in` expression.
+type Binary struct {
+	X  Expr
+	Op Token
+	Y  Expr
+}
+
+// Logical is `x and y` or `x or y`, which only evaluate Y when needed.
+type Logical struct {
+	X  Expr
+	Op Token
+	Y  Expr
+}
+
+// Conditional is `cond ? then : else`.
+type Conditional struct {
+	Cond     Expr
+	Question Token
+	Then     Expr
+	Colon    Token
+	Else     Expr
+}
+
+// Grouping is a parenthesised expression.
+type Grouping struct {
+	LParen Token
+	X      Expr
+	RParen Token
+}
+
+// Tuple is a tuple literal, `(a, b, ...)`.
+type Tuple struct {
+	LParen Token
+	Elems  []Expr
+	RParen Token
+}
+
+// Call is a call of any callable value.
+type Call struct {
+	Callee Expr
+	Args   *ArgList
+}
+
+// Property is `object.name`.
+type Property struct {
+	Object Expr
+	Name   Token
+}
+
+// Invoke is a method call, `object.name(args)`, which the VM performs
+// without creating a bound method.
+type Invoke struct {
+	Object Expr
+	Name   Token
+	Args   *ArgList
+}
+
+// Index is `object[index]`.
+type Index struct {
+	Object   Expr
+	LBracket Token
+	Index    Expr
+	RBracket Token
+}
+
+// Slice is `object[low:high]`; either bound may be nil.
+type Slice struct {
+	Object   Expr
+	LBracket Token
+	Low      Expr
+	Colon    Token
+	High     Expr
+	RBracket Token
+}
+
+// List is a list literal.
+type List struct {
+	LBracket Token
+	Elems    []Expr
+	RBracket Token
+}
+
+// DictEntry is one `key: value` pair of a Dict.
+type DictEntry struct {
+	Key   Expr
+	Colon Token
+	Value Expr
+}
+
+// Dict is a dictionary literal.
+type Dict struct {
+	LBrace  Token
+	Entries []*DictEntry
+	RBrace  Token
+}
+
+// Lambda is an anonymous function expression.
+type Lambda struct {
+	Func *Function
+}
+
+// Await is `await x`, in an async function.
+type Await struct {
+	Keyword Token
+	X       Expr
+}
+
+// Str is `str(x)`.
+type Str struct {
+	Keyword Token
+	LParen  Token
+	X       Expr
+	RParen  Token
+}
+
+// BadExpr stands in for an expression that failed to parse.
+type BadExpr struct {
+	Token Token
+}
+
+func (e *Literal) Pos() Token     { return e.Token }
+func (e *Literal) End() Token     { return e.Token }
+func (e *Variable) Pos() Token    { return e.Name }
+func (e *Variable) End() Token    { return e.Name }
+func (e *Assign) Pos() Token      { return e.Target.Pos() }
+func (e *Assign) End() Token      { return e.Value.End() }
+func (e *This) Pos() Token        { return e.Keyword }
+func (e *This) End() Token        { return e.Keyword }
+func (e *Super) Pos() Token       { return e.Keyword }
+func (e *Unary) Pos() Token       { return e.Op }
+func (e *Unary) End() Token       { return e.X.End() }
+func (e *Binary) Pos() Token      { return e.X.Pos() }
+func (e *Binary) End() Token      { return e.Y.End() }
+func (e *Logical) Pos() Token     { return e.X.Pos() }
+func (e *Logical) End() Token     { return e.Y.End() }
+func (e *Conditional) Pos() Token { return e.Cond.Pos() }
+func (e *Conditional) End() Token { return e.Else.End() }
+func (e *Grouping) Pos() Token    { return e.LParen }
+func (e *Grouping) End() Token    { return e.RParen }
+func (e *Tuple) Pos() Token       { return e.LParen }
+func (e *Tuple) End() Token       { return e.RParen }
+func (e *Call) Pos() Token        { return e.Callee.Pos() }
+func (e *Call) End() Token        { return e.Args.RParen }
+func (e *Property) Pos() Token    { return e.Object.Pos() }
+func (e *Property) End() Token    { return e.Name }
+func (e *Invoke) Pos() Token      { return e.Object.Pos() }
+func (e *Invoke) End() Token      { return e.Args.RParen }
+func (e *Index) Pos() Token       { return e.Object.Pos() }
+func (e *Index) End() Token       { return e.RBracket }
+func (e *Slice) Pos() Token       { return e.Object.Pos() }
+func (e *Slice) End() Token       { return e.RBracket }
+func (e *List) Pos() Token        { return e.LBracket }
+func (e *List) End() Token        { return e.RBracket }
+func (e *Dict) Pos() Token        { return e.LBrace }
+func (e *Dict) End() Token        { return e.RBrace }
+func (e *Lambda) Pos() Token      { return e.Func.Pos() }
+func (e *Lambda) End() Token      { return e.Func.End() }
+func (e *Await) Pos() Token       { return e.Keyword }
+func (e *Await) End() Token       { return e.X.End() }
+func (e *Str) Pos() Token         { return e.Keyword }
+func (e *Str) End() Token         { return e.RParen }
+func (e *BadExpr) Pos() Token     { return e.Token }
+func (e *BadExpr) End() Token     { return e.Token }
+
+func (e *Super) End() Token {
+
+	if e.Args != nil {
+		return e.Args.RParen
+	}
+	return e.Method
+}
+
+func (*Literal) exprNode()     {}
+func (*Variable) exprNode()    {}
+func (*Assign) exprNode()      {}
+func (*This) exprNode()        {}
+func (*Super) exprNode()       {}
+func (*Unary) exprNode()       {}
+func (*Binary) exprNode()      {}
+func (*Logical) exprNode()     {}
+func (*Conditional) exprNode() {}
+func (*Grouping) exprNode()    {}
+func (*Tuple) exprNode()       {}
+func (*Call) exprNode()        {}
+func (*Property) exprNode()    {}
+func (*Invoke) exprNode()      {}
+func (*Index) exprNode()       {}
+func (*Slice) exprNode()       {}
+func (*List) exprNode()        {}
+func (*Dict) exprNode()        {}
+func (*Lambda) exprNode()      {}
+func (*Await) exprNode()       {}
+func (*Str) exprNode()         {}
+func (*BadExpr) exprNode()     {}
+
+//-----------------------------------------------------------------------------
+// Functions and classes.
+
+// FuncKind says what sort of function a Function is, which decides what
+// slot 0 holds and what an empty return returns.
+type FuncKind int
+
+const (
+	FuncFunction FuncKind = iota
+	FuncScript
+	FuncMethod
+	FuncInitializer
+	FuncDecoratedMethod // an instance method under decorators, taking this as its first argument
+)
+
+// TypeAnnotation is a `: type` or `-> type` annotation. Lead is the ':' or
+// '->' and Last the final token of the type.
+type TypeAnnotation struct {
+	Lead Token
+	Type *compiler.TypeExpr
+	Last Token
+}
+
+func (t *TypeAnnotation) Pos() Token { return t.Lead }
+func (t *TypeAnnotation) End() Token { return t.Last }
+
+// Param is one function parameter. Star is set for a *rest parameter.
+type Param struct {
+	Star    Token
+	Name    Token
+	Type    *TypeAnnotation
+	Equal   Token
+	Default Expr
+	Decl    *Decl
+}
+
+// Function is the part shared by function declarations, methods and
+// lambdas. Keyword is the 'func' of a declaration or lambda; a lambda has
+// no Name. Async is the 'async' before an async function. This and Captures are filled in by the resolver: the local in
+// slot 0 and the function's upvalues, in index order. Receiver is the first
+// parameter of a FuncDecoratedMethod, this.
+type Function struct {
+	Kind     FuncKind
+	Async    Token
+	Keyword  Token
+	Name     Token
+	LParen   Token
+	Params   []*Param
+	RParen   Token
+	Return   *TypeAnnotation
+	Body     *Block
+	This     *Decl
+	Receiver *Decl
+	Captures []Capture
+}
+
+func (f *Function) Pos() Token {
+
+	switch {
+	case present(f.Async):
+		return f.Async
+	case present(f.Keyword):
+		return f.Keyword
+	case present(f.Name):
+		return f.Name
+	}
+	return f.LParen
+}
+
+func (f *Function) End() Token { return f.Body.End() }
+
+// Decorator is one `@expr` line before a declaration.
+type Decorator struct {
+	At Token
+	X  Expr
+}
+
+// Method is a method in a class body. Static is set for a static method.
+// Decorated is the local the resolver gives what the decorators of an
+// instance method return, which the method calls with its receiver.
+type Method struct {
+	Decorators []*Decorator
+	Static     Token
+	Func       *Function
+	Decorated  *Decl
+}
+
+// Field is an instance field annotation, `name: type`, in a class body.
+// It only informs the type checker.
+type Field struct {
+	Name Token
+	Type *TypeAnnotation
+	Term Token
+}
+
+// ClassVar is a static class variable, `static name [: type] [= value]`.
+type ClassVar struct {
+	Static Token
+	Name   Token
+	Type   *TypeAnnotation
+	Equal  Token
+	Value  Expr
+	Term   Token
+}
+
+func (m *Method) Pos() Token {
+
+	switch {
+	case len(m.Decorators) > 0:
+		return m.Decorators[0].At
+	case present(m.Static):
+		return m.Static
+	}
+	return m.Func.Pos()
+}
+
+func (m *Method) End() Token   { return m.Func.End() }
+func (f *Field) Pos() Token    { return f.Name }
+func (f *Field) End() Token    { return orElse(f.Term, f.Type) }
+func (v *ClassVar) Pos() Token { return v.Static }
+
+func (v *ClassVar) End() Token {
+
+	switch {
+	case present(v.Term):
+		return v.Term
+	case v.Value != nil:
+		return v.Value.End()
+	case v.Type != nil:
+		return v.Type.End()
+	}
+	return v.Name
+}
+
+func (*Method) memberNode()   {}
+func (*Field) memberNode()    {}
+func (*ClassVar) memberNode() {}
+
+//-----------------------------------------------------------------------------
+// Statements.
+//
+// A Term field is the ';' or end of line that ended a statement. It is
+// absent when the statement ended at a '}' or the end of the file, which
+// terminate a statement without belonging to it.
+
+// ExprStmt is an expression evaluated for its effect.
+type ExprStmt struct {
+	X    Expr
+	Term Token
+}
+
+// UnpackStmt is `a, b, c = value`. The resolver sets Declares for each
+// name that was not defined, and so is declared by the statement, and
+// Bindings for every name.
+type UnpackStmt struct {
+	Names    []Token
+	Equal    Token
+	Value    Expr
+	Term     Token
+	Declares []bool
+	Bindings []Binding
+}
+
+// VarStmt is a `var` or `const` declaration. Keyword is absent for the
+// loop variable of a foreach written without `var`.
+type VarStmt struct {
+	Keyword Token
+	Const   bool
+	Name    Token
+	Type    *TypeAnnotation
+	Equal   Token
+	Value   Expr
+	Term    Token
+	Binding Binding
+}
+
+// PrintStmt is `print x`.
+type PrintStmt struct {
+	Keyword Token
+	X       Expr
+	Term    Token
+}
+
+// Block is a braced list of statements. EOL is the end of line after the
+// closing brace, which a block in statement position consumes.
+type Block struct {
+	LBrace Token
+	Stmts  []Stmt
+	RBrace Token
+	EOL    Token
+}
+
+// IfStmt is `if (cond) then [else else]`.
+type IfStmt struct {
+	Keyword Token
+	LParen  Token
+	Cond    Expr
+	RParen  Token
+	Then    Stmt
+	ElseTok Token
+	Else    Stmt
+}
+
+// WhileStmt is `while (cond) body`.
+type WhileStmt struct {
+	Keyword Token
+	LParen  Token
+	Cond    Expr
+	RParen  Token
+	Body    Stmt
+}
+
+// ForStmt is `for (init; cond; incr) body`; Init, Cond and Incr may each be
+// nil. InitSemi is the ';' of an empty initialiser (a non-empty one ends
+// with its own terminator) and CondSemi the ';' after the condition.
+type ForStmt struct {
+	Keyword  Token
+	LParen   Token
+	Init     Stmt
+	InitSemi Token
+	Cond     Expr
+	CondSemi Token
+	Incr     Expr
+	RParen   Token
+	Body     Stmt
+}
+
+// ForeachStmt is `foreach (var x in iterable) body`. Iter is the hidden
+// local holding the iterator.
+type ForeachStmt struct {
+	Keyword  Token
+	LParen   Token
+	Var      *VarStmt
+	In       Token
+	Iterable Expr
+	RParen   Token
+	Body     Stmt
+	Iter     *Decl
+}
+
+// BreakStmt is `break`.
+type BreakStmt struct {
+	Keyword Token
+	Term    Token
+}
+
+// ContinueStmt is `continue`.
+type ContinueStmt struct {
+	Keyword Token
+	Term    Token
+}
+
+// BreakpointStmt is `breakpoint`, which stops in the debugger.
+type BreakpointStmt struct {
+	Keyword Token
+	Term    Token
+}
+
+// ReturnStmt is `return [value]`. Retval is the hidden local a return
+// inside a try statement keeps its value in while finally blocks run.
+type ReturnStmt struct {
+	Keyword Token
+	Value   Expr
+	Term    Token
+	Retval  *Decl
+}
+
+// RaiseStmt is `raise value`.
+type RaiseStmt struct {
+	Keyword Token
+	Value   Expr
+	Term    Token
+}
+
+// ImportSpec is one module of an import statement, `a.b.c [as alias]`.
+type ImportSpec struct {
+	Path  []Token
+	As    Token
+	Alias Token
+}
+
+// ImportStmt is `import a, b.c as d`.
+type ImportStmt struct {
+	Keyword Token
+	Modules []*ImportSpec
+	Term    Token
+}
+
+// FromImportStmt is `from module import names` or `from module import *`.
+// Dots are the leading dots of a relative module name.
+type FromImportStmt struct {
+	Keyword Token
+	Dots    []Token
+	Path    []Token
+	Import  Token
+	Star    Token
+	Names   []Token
+	Term    Token
+}
+
+// ExceptClause is `except Type as name { ... }`.
+type ExceptClause struct {
+	Keyword Token
+	Type    Token
+	As      Token
+	Name    Token
+	Body    *Block
+	Decl    *Decl
+}
+
+// TryStmt is a try statement with except clauses, a finally block, or
+// both. Exc is the hidden local holding an exception while the finally
+// block runs on the way to re-raising it.
+type TryStmt struct {
+	Keyword    Token
+	Body       *Block
+	Excepts    []*ExceptClause
+	FinallyTok Token
+	Finally    *Block
+	Exc        *Decl
+}
+
+// FuncStmt is a function declaration.
+type FuncStmt struct {
+	Decorators []*Decorator
+	Func       *Function
+	Binding    Binding
+}
+
+// ClassStmt is a class declaration. SuperDecl is the hidden local holding
+// the superclass for methods to reach through `super`.
+type ClassStmt struct {
+	Decorators []*Decorator
+	Keyword    Token
+	Name       Token
+	Less       Token
+	Super      *Variable
+	LBrace     Token
+	Members    []Member
+	RBrace     Token
+	EOL        Token
+	Binding    Binding
+	SuperDecl  *Decl
+}
+
+// ExportStmt is `export` before a top-level *FuncStmt, *ClassStmt or
+// *VarStmt.
+type ExportStmt struct {
+	Keyword Token
+	Decl    Stmt
+}
+
+// BadStmt stands in for a statement that failed to parse.
+type BadStmt struct {
+	From, To Token
+}
+
+func (s *ExprStmt) Pos() Token       { return s.X.Pos() }
+func (s *ExprStmt) End() Token       { return orElse(s.Term, s.X) }
+func (s *UnpackStmt) Pos() Token     { return s.Names[0] }
+func (s *UnpackStmt) End() Token     { return orElse(s.Term, s.Value) }
+func (s *PrintStmt) Pos() Token      { return s.Keyword }
+func (s *PrintStmt) End() Token      { return orElse(s.Term, s.X) }
+func (s *Block) Pos() Token          { return s.LBrace }
+func (s *IfStmt) Pos() Token         { return s.Keyword }
+func (s *WhileStmt) Pos() Token      { return s.Keyword }
+func (s *WhileStmt) End() Token      { return s.Body.End() }
+func (s *ForStmt) Pos() Token        { return s.Keyword }
+func (s *ForStmt) End() Token        { return s.Body.End() }
+func (s *ForeachStmt) Pos() Token    { return s.Keyword }
+func (s *ForeachStmt) End() Token    { return s.Body.End() }
+func (s *BreakStmt) Pos() Token      { return s.Keyword }
+func (s *ContinueStmt) Pos() Token   { return s.Keyword }
+func (s *BreakpointStmt) Pos() Token { return s.Keyword }
+func (s *ReturnStmt) Pos() Token     { return s.Keyword }
+func (s *RaiseStmt) Pos() Token      { return s.Keyword }
+func (s *RaiseStmt) End() Token      { return orElse(s.Term, s.Value) }
+func (s *ImportStmt) Pos() Token     { return s.Keyword }
+func (s *FromImportStmt) Pos() Token { return s.Keyword }
+func (s *TryStmt) Pos() Token        { return s.Keyword }
+func (s *ExportStmt) Pos() Token     { return s.Keyword }
+func (s *ExportStmt) End() Token     { return s.Decl.End() }
+func (s *BadStmt) Pos() Token        { return s.From }
+func (s *BadStmt) End() Token        { return s.To }
+
+func (s *VarStmt) Pos() Token {
+
+	if present(s.Keyword) {
+		return s.Keyword
+	}
+	return s.Name
+}
+
+// End is the statement's last token; for a variable without an
+// initialiser, the name or its annotation.
+func (s *VarStmt) End() Token {
+
+	switch {
+	case present(s.Term):
+		return s.Term
+	case s.Value != nil:
+		return s.Value.End()
+	case s.Type != nil:
+		return s.Type.End()
+	}
+	return s.Name
+}
+
+func (s *Block) End() Token {
+
+	if present(s.EOL) {
+		return s.EOL
+	}
+	return s.RBrace
+}
+
+func (s *IfStmt) End() Token {
+
+	if s.Else != nil {
+		return s.Else.End()
+	}
+	return s.Then.End()
+}
+
+func (s *BreakStmt) End() Token      { return orElse(s.Term, keyword{s.Keyword}) }
+func (s *ContinueStmt) End() Token   { return orElse(s.Term, keyword{s.Keyword}) }
+func (s *BreakpointStmt) End() Token { return orElse(s.Term, keyword{s.Keyword}) }
+
+func (s *ReturnStmt) End() Token {
+
+	switch {
+	case present(s.Term):
+		return s.Term
+	case s.Value != nil:
+		return s.Value.End()
+	}
+	return s.Keyword
+}
+
+func (s *ImportStmt) End() Token {
+
+	if present(s.Term) {
+		return s.Term
+	}
+	last := s.Modules[len(s.Modules)-1]
+	if present(last.Alias) {
+		return last.Alias
+	}
+	return last.Path[len(last.Path)-1]
+}
+
+func (s *FromImportStmt) End() Token {
+
+	switch {
+	case present(s.Term):
+		return s.Term
+	case present(s.Star):
+		return s.Star
+	case len(s.Names) > 0:
+		return s.Names[len(s.Names)-1]
+	}
+	return s.Import
+}
+
+func (s *TryStmt) End() Token {
+
+	switch {
+	case s.Finally != nil:
+		return s.Finally.End()
+	case len(s.Excepts) > 0:
+		return s.Excepts[len(s.Excepts)-1].Body.End()
+	}
+	return s.Body.End()
+}
+
+func (s *FuncStmt) Pos() Token {
+
+	if len(s.Decorators) > 0 {
+		return s.Decorators[0].At
+	}
+	return s.Func.Pos()
+}
+
+func (s *FuncStmt) End() Token { return s.Func.End() }
+
+func (s *ClassStmt) Pos() Token {
+
+	if len(s.Decorators) > 0 {
+		return s.Decorators[0].At
+	}
+	return s.Keyword
+}
+
+func (s *ClassStmt) End() Token {
+
+	if present(s.EOL) {
+		return s.EOL
+	}
+	return s.RBrace
+}
+
+// keyword adapts a lone token to a Node for orElse.
+type keyword struct{ tok Token }
+
+func (k keyword) Pos() Token { return k.tok }
+func (k keyword) End() Token { return k.tok }
+
+func (*ExprStmt) stmtNode()       {}
+func (*UnpackStmt) stmtNode()     {}
+func (*VarStmt) stmtNode()        {}
+func (*PrintStmt) stmtNode()      {}
+func (*Block) stmtNode()          {}
+func (*IfStmt) stmtNode()         {}
+func (*WhileStmt) stmtNode()      {}
+func (*ForStmt) stmtNode()        {}
+func (*ForeachStmt) stmtNode()    {}
+func (*BreakStmt) stmtNode()      {}
+func (*ContinueStmt) stmtNode()   {}
+func (*BreakpointStmt) stmtNode() {}
+func (*ReturnStmt) stmtNode()     {}
+func (*RaiseStmt) stmtNode()      {}
+func (*ImportStmt) stmtNode()     {}
+func (*FromImportStmt) stmtNode() {}
+func (*TryStmt) stmtNode()        {}
+func (*FuncStmt) stmtNode()       {}
+func (*ClassStmt) stmtNode()      {}
+func (*ExportStmt) stmtNode()     {}
+func (*BadStmt) stmtNode()        {}
+
+//-----------------------------------------------------------------------------
+
+// Script is a parsed source file. Last is the final token before the end of
+// the file. The resolver fills in This, the local in the script's slot 0.
+type Script struct {
+	Name  string
+	Stmts []Stmt
+	Last  Token
+	This  *Decl
+}
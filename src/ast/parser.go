@@ -0,0 +1,1210 @@
+package ast
+
+import (
+	"glox/src/compiler"
+)
+
+type (
+	TokenType  = compiler.TokenType
+	Diagnostic = compiler.Diagnostic
+)
+
+// precedence mirrors compiler.Precedence, from loosest to tightest binding.
+type precedence int
+
+const (
+	precNone        precedence = iota
+	precAssignment             // =
+	precConditional            // ?:
+	precOr                     // or
+	precAnd                    // and
+	precEquality               // == != in
+	precComparison             // < > <= >=
+	precTerm                   // + - ++ &
+	precFactor                 // * / %
+	precUnary                  // ! -
+	precCall                   // . () []
+)
+
+// maxDepth caps expression and statement nesting, as in package compiler,
+// so that hostile input cannot overflow the Go stack.
+const maxDepth = 1000
+
+type prefixFn func(p *parser, canAssign bool) Expr
+type infixFn func(p *parser, left Expr, canAssign bool) Expr
+
+type rule struct {
+	prefix prefixFn
+	infix  infixFn
+	prec   precedence
+}
+
+var rules map[TokenType]rule
+
+func init() {
+
+	rules = map[TokenType]rule{
+		compiler.TOKEN_LEFT_PAREN:    {grouping, call, precCall},
+		compiler.TOKEN_LEFT_BRACE:    {dictLiteral, nil, precNone},
+		compiler.TOKEN_LEFT_BRACKET:  {listLiteral, subscript, precCall},
+		compiler.TOKEN_DOT:           {nil, dot, precCall},
+		compiler.TOKEN_MINUS:         {unary, binary, precTerm},
+		compiler.TOKEN_PLUS:          {nil, binary, precTerm},
+		compiler.TOKEN_PLUS_PLUS:     {nil, binary, precTerm},
+		compiler.TOKEN_AMPERSAND:     {nil, binary, precTerm},
+		compiler.TOKEN_SLASH:         {nil, binary, precFactor},
+		compiler.TOKEN_STAR:          {nil, binary, precFactor},
+		compiler.TOKEN_PERCENT:       {nil, binary, precFactor},
+		compiler.TOKEN_QUESTION:      {nil, conditional, precConditional},
+		compiler.TOKEN_BANG:          {unary, nil, precNone},
+		compiler.TOKEN_BANG_EQUAL:    {nil, binary, precEquality},
+		compiler.TOKEN_EQUAL:         {nil, nil, precAssignment},
+		compiler.TOKEN_EQUAL_EQUAL:   {nil, binary, precEquality},
+		compiler.TOKEN_IN:            {nil, binary, precEquality},
+		compiler.TOKEN_GREATER:       {nil, binary, precComparison},
+		compiler.TOKEN_GREATER_EQUAL: {nil, binary, precComparison},
+		compiler.TOKEN_LESS:          {nil, binary, precComparison},
+		compiler.TOKEN_LESS_EQUAL:    {nil, binary, precComparison},
+		compiler.TOKEN_IDENTIFIER:    {variable, nil, precNone},
+		compiler.TOKEN_STRING:        {literal, nil, precNone},
+		compiler.TOKEN_FLOAT:         {literal, nil, precNone},
+		compiler.TOKEN_INT:           {literal, nil, precNone},
+		compiler.TOKEN_AND:           {nil, logical, precAnd},
+		compiler.TOKEN_OR:            {nil, logical, precOr},
+		compiler.TOKEN_FALSE:         {literal, nil, precNone},
+		compiler.TOKEN_NIL:           {literal, nil, precNone},
+		compiler.TOKEN_TRUE:          {literal, nil, precNone},
+		compiler.TOKEN_FUNC:          {lambda, nil, precNone},
+		compiler.TOKEN_SUPER:         {super, nil, precNone},
+		compiler.TOKEN_THIS:          {this, nil, precNone},
+		compiler.TOKEN_STR:           {str, nil, precNone},
+		compiler.TOKEN_ASYNC:         {asyncLambda, nil, precNone},
+		compiler.TOKEN_AWAIT:         {await, nil, precNone},
+	}
+}
+
+// parser builds a Script from the token stream. It accepts exactly the
+// grammar package compiler does, consuming the same tokens and reporting the
+// same syntax errors, but knows nothing of scopes: errors that depend on
+// what a name refers to are the resolver's.
+type parser struct {
+	scn                 *compiler.Scanner
+	script              string
+	current, previous   Token
+	hadError, panicMode bool
+	exprDepth           int
+	stmtDepth           int
+	diagnostics         []Diagnostic
+}
+
+// Parse parses source, the contents of the file script, into a Script. On a
+// syntax error it carries on from the next statement, so the Script is
+// still complete, with a *BadExpr or *BadStmt standing in where nothing
+// sensible could be parsed, and every error is returned.
+func Parse(script, source string) (*Script, []Diagnostic) {
+
+	p := &parser{
+		scn:    compiler.NewScanner(source),
+		script: script,
+	}
+	s := &Script{Name: script}
+	p.advance()
+	for !p.match(compiler.TOKEN_EOF) {
+		s.Stmts = append(s.Stmts, p.declaration())
+	}
+	s.Last = p.previous
+	return s, p.diagnostics
+}
+
+//-----------------------------------------------------------------------------
+// Token stream.
+
+func (p *parser) advance() {
+
+	p.previous = p.current
+	for {
+		p.current = p.scn.NextToken()
+		if p.current.Tokentype != compiler.TOKEN_ERROR {
+			break
+		}
+		p.errorAtCurrent(p.current.Lexeme())
+	}
+}
+
+// check reports whether the current token has type tt; as in the compiler a
+// ';' also matches an end of line.
+func (p *parser) check(tt TokenType) bool {
+
+	return p.current.Tokentype == tt || (tt == compiler.TOKEN_SEMICOLON && p.current.Tokentype == compiler.TOKEN_EOL)
+}
+
+func (p *parser) checkNext(tt TokenType) bool {
+
+	return p.scn.Tokens.At(p.scn.TokenIdx).Tokentype == tt
+}
+
+func (p *parser) match(tt TokenType) bool {
+
+	if !p.check(tt) {
+		return false
+	}
+	if tt != compiler.TOKEN_EOF {
+		p.advance()
+	}
+	return true
+}
+
+func (p *parser) consume(tt TokenType, msg string) {
+
+	if p.check(tt) {
+		p.advance()
+		return
+	}
+	p.errorAtCurrent(msg)
+}
+
+// checkStatementEnd reports whether the current token ends a statement.
+func (p *parser) checkStatementEnd() bool {
+
+	switch p.current.Tokentype {
+	case compiler.TOKEN_SEMICOLON, compiler.TOKEN_EOL, compiler.TOKEN_RIGHT_BRACE, compiler.TOKEN_EOF:
+		return true
+	}
+	return false
+}
+
+// consumeStatementEnd requires a statement terminator and returns it if it
+// was a ';' or end of line. A '}' or the end of the file also ends a
+// statement but is left for the enclosing block, so nothing is returned.
+func (p *parser) consumeStatementEnd(msg string) Token {
+
+	switch p.current.Tokentype {
+	case compiler.TOKEN_SEMICOLON, compiler.TOKEN_EOL:
+		p.advance()
+		return p.previous
+	case compiler.TOKEN_RIGHT_BRACE, compiler.TOKEN_EOF:
+	default:
+		p.errorAtCurrent(msg)
+	}
+	return Token{}
+}
+
+// matched returns the token just consumed if ok, otherwise the zero token,
+// for optional tokens recorded in a node.
+func (p *parser) matched(ok bool) Token {
+
+	if ok {
+		return p.previous
+	}
+	return Token{}
+}
+
+//-----------------------------------------------------------------------------
+// Errors.
+
+func (p *parser) errorAtCurrent(msg string) {
+
+	p.errorAt(p.current, msg)
+}
+
+func (p *parser) error(msg string) {
+
+	p.errorAt(p.previous, msg)
+}
+
+func (p *parser) errorAt(tok Token, msg string) {
+
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.hadError = true
+	d := Diagnostic{
+		Severity: compiler.SeverityError,
+		Code:     compiler.CodeSyntax,
+		Span:     tokenSpan(p.script, tok),
+		Message:  msg,
+	}
+	switch tok.Tokentype {
+	case compiler.TOKEN_EOF:
+	case compiler.TOKEN_ERROR:
+		d.Near = p.scn.Source[tok.Offset : tok.Offset+tok.Width]
+	default:
+		d.Near = tok.Lexeme()
+	}
+	p.diagnostics = report(p.diagnostics, d)
+}
+
+// tokenSpan returns the span of tok in the file script.
+func tokenSpan(script string, tok Token) compiler.Span {
+
+	return compiler.Span{
+		File:   script,
+		Line:   tok.Line,
+		Column: tok.Column,
+		Offset: tok.Offset,
+		Length: tok.Width,
+	}
+}
+
+// report appends d to diags unless the same message is already reported at
+// the same place.
+func report(diags []Diagnostic, d Diagnostic) []Diagnostic {
+
+	for _, prev := range diags {
+		if prev.Span == d.Span && prev.Message == d.Message {
+			return diags
+		}
+	}
+	return append(diags, d)
+}
+
+// synchronize skips to the start of the next statement after an error.
+func (p *parser) synchronize() {
+
+	if p.current.Tokentype == compiler.TOKEN_EOF {
+		return
+	}
+	p.panicMode = false
+	for p.current.Tokentype != compiler.TOKEN_EOF {
+		if p.previous.Tokentype == compiler.TOKEN_SEMICOLON || p.previous.Tokentype == compiler.TOKEN_EOL {
+			return
+		}
+		switch p.current.Tokentype {
+		case compiler.TOKEN_CLASS, compiler.TOKEN_FUNC, compiler.TOKEN_ASYNC, compiler.TOKEN_VAR, compiler.TOKEN_CONST, compiler.TOKEN_EXPORT,
+			compiler.TOKEN_FOR, compiler.TOKEN_FOREACH, compiler.TOKEN_IF, compiler.TOKEN_WHILE, compiler.TOKEN_TRY,
+			compiler.TOKEN_PRINT, compiler.TOKEN_RETURN, compiler.TOKEN_RAISE, compiler.TOKEN_IMPORT, compiler.TOKEN_FROM:
+			return
+		}
+		p.advance()
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Declarations.
+
+func (p *parser) declaration() Stmt {
+
+	var s Stmt
+	switch {
+	case p.match(compiler.TOKEN_AT):
+		s = p.decoratedDeclaration()
+	case p.match(compiler.TOKEN_EXPORT):
+		s = p.exportDeclaration(nil)
+	case p.match(compiler.TOKEN_CLASS):
+		s = p.classDeclaration(nil)
+	case p.match(compiler.TOKEN_FUNC):
+		s = p.funcDeclaration(nil, Token{})
+	case p.match(compiler.TOKEN_ASYNC):
+		s = p.asyncFuncDeclaration(nil)
+	case p.match(compiler.TOKEN_VAR):
+		s = p.varDeclaration(p.previous, false, false)
+	case p.match(compiler.TOKEN_CONST):
+		s = p.varDeclaration(p.previous, true, false)
+	default:
+		s = p.statement()
+	}
+	if p.panicMode {
+		p.synchronize()
+	}
+	return s
+}
+
+// decoratedDeclaration parses `@expr` lines (the first '@' consumed) and the
+// declaration they decorate.
+func (p *parser) decoratedDeclaration() Stmt {
+
+	from := p.previous
+	decorators := p.decorators()
+	switch {
+	case p.match(compiler.TOKEN_EXPORT):
+		return p.exportDeclaration(decorators)
+	case p.match(compiler.TOKEN_CLASS):
+		return p.classDeclaration(decorators)
+	case p.match(compiler.TOKEN_FUNC):
+		return p.funcDeclaration(decorators, Token{})
+	case p.match(compiler.TOKEN_ASYNC):
+		return p.asyncFuncDeclaration(decorators)
+	}
+	p.errorAtCurrent("Expect function or class declaration after decorator.")
+	return &BadStmt{From: from, To: p.previous}
+}
+
+// decorators parses a run of `@expr` lines, the first '@' consumed. Each
+// expression must end its line.
+func (p *parser) decorators() []*Decorator {
+
+	var decorators []*Decorator
+	for {
+		d := &Decorator{At: p.previous}
+		d.X = p.expression()
+		if !p.check(compiler.TOKEN_SEMICOLON) && !p.check(compiler.TOKEN_EOF) {
+			p.errorAtCurrent("Expect newline after decorator.")
+			p.skipLine()
+		}
+		decorators = append(decorators, d)
+		for p.match(compiler.TOKEN_SEMICOLON) {
+		}
+		if !p.match(compiler.TOKEN_AT) {
+			return decorators
+		}
+	}
+}
+
+// skipLine skips to the end of the line, passing over bracketed text.
+func (p *parser) skipLine() {
+
+	depth := 0
+	for !p.check(compiler.TOKEN_EOF) {
+		tt := p.current.Tokentype
+		if depth == 0 && (tt == compiler.TOKEN_EOL || tt == compiler.TOKEN_SEMICOLON) {
+			return
+		}
+		switch tt {
+		case compiler.TOKEN_LEFT_PAREN, compiler.TOKEN_LEFT_BRACKET, compiler.TOKEN_LEFT_BRACE:
+			depth++
+		case compiler.TOKEN_RIGHT_PAREN, compiler.TOKEN_RIGHT_BRACKET, compiler.TOKEN_RIGHT_BRACE:
+			depth--
+		}
+		p.advance()
+	}
+}
+
+// exportDeclaration parses the declaration after 'export'. Decorated
+// declarations put 'export' after the decorators.
+func (p *parser) exportDeclaration(decorators []*Decorator) Stmt {
+
+	s := &ExportStmt{Keyword: p.previous}
+	switch {
+	case p.match(compiler.TOKEN_CLASS):
+		s.Decl = p.classDeclaration(decorators)
+	case p.match(compiler.TOKEN_FUNC):
+		s.Decl = p.funcDeclaration(decorators, Token{})
+	case p.match(compiler.TOKEN_ASYNC):
+		s.Decl = p.asyncFuncDeclaration(decorators)
+	case decorators == nil && p.match(compiler.TOKEN_VAR):
+		s.Decl = p.varDeclaration(p.previous, false, false)
+	case decorators == nil && p.match(compiler.TOKEN_CONST):
+		s.Decl = p.varDeclaration(p.previous, true, false)
+	default:
+		p.errorAtCurrent("Expect declaration after 'export'.")
+		return &BadStmt{From: s.Keyword, To: p.previous}
+	}
+	return s
+}
+
+// funcDeclaration parses a function declaration after its 'func'. async is
+// the 'async' before that, if there was one.
+func (p *parser) funcDeclaration(decorators []*Decorator, async Token) Stmt {
+
+	keyword := p.previous
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect function name.")
+	name := p.previous
+	return &FuncStmt{
+		Decorators: decorators,
+		Func:       p.function(FuncFunction, async, keyword, name, false),
+	}
+}
+
+// asyncFuncDeclaration parses an async function declaration after its
+// 'async'.
+func (p *parser) asyncFuncDeclaration(decorators []*Decorator) Stmt {
+
+	async := p.previous
+	p.consume(compiler.TOKEN_FUNC, "Expect 'func' after 'async'.")
+	return p.funcDeclaration(decorators, async)
+}
+
+// varDeclaration parses a `var` or `const` declaration after the keyword,
+// or the loop variable of a foreach, which has no terminator.
+func (p *parser) varDeclaration(keyword Token, isConst, inForeach bool) *VarStmt {
+
+	s := &VarStmt{Keyword: keyword, Const: isConst}
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect variable name")
+	s.Name = p.previous
+	s.Type = p.optionalTypeAnnotation()
+	if p.match(compiler.TOKEN_EQUAL) {
+		s.Equal = p.previous
+		s.Value = p.expression()
+	} else if isConst {
+		p.error("Constants must be initialised.")
+	}
+	if !inForeach {
+		s.Term = p.consumeStatementEnd("Expect ';' after variable declaration")
+	}
+	return s
+}
+
+// function parses a parameter list and body. keyword is the 'func' of a
+// declaration or lambda and name the declared name; a method has only a
+// name and a lambda only a keyword. async is the 'async' of an async one. A lambda's body leaves the end of line
+// after its '}' to the enclosing statement.
+func (p *parser) function(kind FuncKind, async, keyword, name Token, isExpr bool) *Function {
+
+	f := &Function{Kind: kind, Async: async, Keyword: keyword, Name: name}
+	p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after function name.")
+	f.LParen = p.previous
+	if !p.check(compiler.TOKEN_RIGHT_PAREN) {
+		sawDefault := false
+		sawRest := false
+		for {
+			if len(f.Params)+1 > 255 {
+				p.errorAtCurrent("Can't have more than 255 parameters")
+			}
+			prm := &Param{}
+			f.Params = append(f.Params, prm)
+			if p.match(compiler.TOKEN_STAR) {
+				prm.Star = p.previous
+				p.consume(compiler.TOKEN_IDENTIFIER, "Expect parameter name after '*'.")
+				prm.Name = p.previous
+				prm.Type = p.optionalTypeAnnotation()
+				sawRest = true
+				break
+			}
+			p.consume(compiler.TOKEN_IDENTIFIER, "Expect parameter name.")
+			prm.Name = p.previous
+			prm.Type = p.optionalTypeAnnotation()
+			if p.match(compiler.TOKEN_EQUAL) {
+				sawDefault = true
+				prm.Equal = p.previous
+				prm.Default = p.expression()
+			} else if sawDefault {
+				p.error("Non-default parameter cannot follow a default parameter.")
+			}
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+		if sawRest && p.check(compiler.TOKEN_COMMA) {
+			p.error("'*rest' must be the last parameter.")
+		}
+	}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after function parameters.")
+	f.RParen = p.previous
+	if p.match(compiler.TOKEN_ARROW) {
+		f.Return = p.typeAnnotation()
+	}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_LEFT_BRACE, "Expect '{' before function body.")
+	if isExpr {
+		f.Body = p.blockBody(p.previous)
+	} else {
+		f.Body = p.block(p.previous)
+	}
+	return f
+}
+
+func (p *parser) classDeclaration(decorators []*Decorator) Stmt {
+
+	s := &ClassStmt{Decorators: decorators, Keyword: p.previous}
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect class name.")
+	s.Name = p.previous
+	if p.match(compiler.TOKEN_LESS) {
+		s.Less = p.previous
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect superclass name.")
+		s.Super = &Variable{Name: p.previous}
+		if s.Name.Lexeme() == s.Super.Name.Lexeme() {
+			p.error("A class cannot inherit from itself.")
+		}
+		if p.check(compiler.TOKEN_DOT) {
+			p.error("Super class cannot be in an imported module (for now).")
+		}
+	}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_LEFT_BRACE, "Expect '{' before class body.")
+	s.LBrace = p.previous
+	for !p.check(compiler.TOKEN_RIGHT_BRACE) && !p.check(compiler.TOKEN_EOF) {
+		s.Members = append(s.Members, p.member())
+	}
+	p.consume(compiler.TOKEN_RIGHT_BRACE, "Expect '}' after class body.")
+	s.RBrace = p.previous
+	s.EOL = p.matched(p.match(compiler.TOKEN_EOL))
+	return s
+}
+
+// member parses a method, static class variable or field annotation.
+func (p *parser) member() Member {
+
+	var decorators []*Decorator
+	if p.match(compiler.TOKEN_AT) {
+		decorators = p.decorators()
+	}
+	static := p.matched(p.match(compiler.TOKEN_STATIC))
+	async := p.matched(p.match(compiler.TOKEN_ASYNC))
+
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect method name.")
+	name := p.previous
+	if present(async) && !p.check(compiler.TOKEN_LEFT_PAREN) {
+		p.error("Only methods can be async.")
+	}
+	if decorators != nil && !p.check(compiler.TOKEN_LEFT_PAREN) {
+		p.error("Decorators can only be applied to methods.")
+	}
+	if !present(static) && p.check(compiler.TOKEN_COLON) {
+		f := &Field{Name: name, Type: p.optionalTypeAnnotation()}
+		f.Term = p.consumeStatementEnd("Expect ';' after field annotation")
+		return f
+	}
+	if present(static) && !p.check(compiler.TOKEN_LEFT_PAREN) {
+		v := &ClassVar{Static: static, Name: name, Type: p.optionalTypeAnnotation()}
+		if p.match(compiler.TOKEN_EQUAL) {
+			v.Equal = p.previous
+			v.Value = p.expression()
+		}
+		v.Term = p.consumeStatementEnd("Expect ';' after class variable declaration")
+		return v
+	}
+	kind := FuncMethod
+	if name.Lexeme() == "init" {
+		if present(static) {
+			p.error("Static initialisers are not allowed.")
+		}
+		if present(async) {
+			p.error("Initialisers can't be async.")
+		}
+		if decorators != nil {
+			p.error("Initialisers can't be decorated.")
+		}
+		kind = FuncInitializer
+	}
+	if decorators != nil && !present(static) && kind == FuncMethod {
+		kind = FuncDecoratedMethod
+	}
+	return &Method{
+		Decorators: decorators,
+		Static:     static,
+		Func:       p.function(kind, async, Token{}, name, false),
+	}
+}
+
+// optionalTypeAnnotation parses `: type` if present.
+func (p *parser) optionalTypeAnnotation() *TypeAnnotation {
+
+	if p.match(compiler.TOKEN_COLON) {
+		return p.typeAnnotation()
+	}
+	return nil
+}
+
+// typeAnnotation parses the type after a ':' or '->', which has just been
+// consumed.
+func (p *parser) typeAnnotation() *TypeAnnotation {
+
+	t := &TypeAnnotation{Lead: p.previous}
+	t.Type = p.typeExpr()
+	t.Last = p.previous
+	return t
+}
+
+// typeExpr parses `name ('.' name)* ('[' type (',' type)* ']')? '?'?` as
+// compiler.TypeExpr, applying the same aliases as the compiler.
+func (p *parser) typeExpr() *compiler.TypeExpr {
+
+	var name string
+	switch {
+	case p.match(compiler.TOKEN_IDENTIFIER), p.match(compiler.TOKEN_NIL), p.match(compiler.TOKEN_FUNC), p.match(compiler.TOKEN_STR):
+		name = p.previous.Lexeme()
+	default:
+		p.errorAtCurrent("Expect type name.")
+		return nil
+	}
+	for p.match(compiler.TOKEN_DOT) {
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect type name after '.'.")
+		name += "." + p.previous.Lexeme()
+	}
+	t := &compiler.TypeExpr{Name: compiler.CanonicalTypeName(name)}
+	if p.match(compiler.TOKEN_LEFT_BRACKET) {
+		for {
+			t.Args = append(t.Args, p.typeExpr())
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+		p.consume(compiler.TOKEN_RIGHT_BRACKET, "Expect ']' after type arguments.")
+	}
+	if p.match(compiler.TOKEN_QUESTION) {
+		t.Optional = true
+	}
+	return t
+}
+
+//-----------------------------------------------------------------------------
+// Statements.
+
+func (p *parser) statement() Stmt {
+
+	p.stmtDepth++
+	defer func() { p.stmtDepth-- }()
+	if p.stmtDepth > maxDepth {
+		p.error("Statement nested too deeply")
+		from := p.previous
+		p.current = p.scn.SkipToEnd()
+		return &BadStmt{From: from, To: from}
+	}
+
+	switch {
+	case p.match(compiler.TOKEN_PRINT):
+		s := &PrintStmt{Keyword: p.previous}
+		s.X = p.expression()
+		s.Term = p.consumeStatementEnd("Expect ';' after value.")
+		return s
+	case p.match(compiler.TOKEN_IMPORT):
+		return p.importStatement()
+	case p.match(compiler.TOKEN_FROM):
+		return p.fromImportStatement()
+	case p.match(compiler.TOKEN_BREAK):
+		s := &BreakStmt{Keyword: p.previous}
+		s.Term = p.consumeStatementEnd("Expect ';' after statement.")
+		return s
+	case p.match(compiler.TOKEN_BREAKPOINT):
+		s := &BreakpointStmt{Keyword: p.previous}
+		s.Term = p.consumeStatementEnd("Expect ';' after statement.")
+		return s
+	case p.match(compiler.TOKEN_CONTINUE):
+		s := &ContinueStmt{Keyword: p.previous}
+		s.Term = p.consumeStatementEnd("Expect ';' after statement.")
+		return s
+	case p.match(compiler.TOKEN_TRY):
+		return p.tryStatement()
+	case p.match(compiler.TOKEN_RAISE):
+		s := &RaiseStmt{Keyword: p.previous}
+		s.Value = p.expression()
+		s.Term = p.consumeStatementEnd("Expect ';' after throw expression.")
+		return s
+	case p.match(compiler.TOKEN_FOR):
+		return p.forStatement()
+	case p.match(compiler.TOKEN_FOREACH):
+		return p.foreachStatement()
+	case p.match(compiler.TOKEN_IF):
+		return p.ifStatement()
+	case p.match(compiler.TOKEN_RETURN):
+		s := &ReturnStmt{Keyword: p.previous}
+		if !p.checkStatementEnd() {
+			s.Value = p.expression()
+		}
+		s.Term = p.consumeStatementEnd("Expect ';' after return value.")
+		return s
+	case p.match(compiler.TOKEN_WHILE):
+		s := &WhileStmt{Keyword: p.previous}
+		p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after while.")
+		s.LParen = p.previous
+		s.Cond = p.expression()
+		p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after condition.")
+		s.RParen = p.previous
+		s.Body = p.statement()
+		return s
+	case p.match(compiler.TOKEN_LEFT_BRACE):
+		return p.block(p.previous)
+	}
+	return p.expressionStatement()
+}
+
+// block parses the statements of a block whose '{' was just consumed, the
+// closing '}' and an end of line after it.
+func (p *parser) block(lbrace Token) *Block {
+
+	b := p.blockBody(lbrace)
+	b.EOL = p.matched(p.match(compiler.TOKEN_EOL))
+	return b
+}
+
+// blockBody parses a block up to and including its '}'.
+func (p *parser) blockBody(lbrace Token) *Block {
+
+	b := &Block{LBrace: lbrace}
+	for !p.check(compiler.TOKEN_RIGHT_BRACE) && !p.check(compiler.TOKEN_EOF) {
+		b.Stmts = append(b.Stmts, p.declaration())
+	}
+	p.consume(compiler.TOKEN_RIGHT_BRACE, "Expect '}' after block.")
+	b.RBrace = p.previous
+	return b
+}
+
+func (p *parser) importStatement() Stmt {
+
+	s := &ImportStmt{Keyword: p.previous}
+	for {
+		spec := &ImportSpec{}
+		_, spec.Path = p.moduleName(false)
+		if p.match(compiler.TOKEN_AS) {
+			spec.As = p.previous
+			p.consume(compiler.TOKEN_IDENTIFIER, "Expect alias name.")
+			spec.Alias = p.previous
+		}
+		s.Modules = append(s.Modules, spec)
+		if !p.match(compiler.TOKEN_COMMA) {
+			break
+		}
+	}
+	s.Term = p.consumeStatementEnd("Expect ';' after import list.")
+	return s
+}
+
+func (p *parser) fromImportStatement() Stmt {
+
+	s := &FromImportStmt{Keyword: p.previous}
+	s.Dots, s.Path = p.moduleName(true)
+	p.consume(compiler.TOKEN_IMPORT, "Expect 'import' after module name.")
+	s.Import = p.previous
+	if p.match(compiler.TOKEN_STAR) {
+		s.Star = p.previous
+		s.Term = p.consumeStatementEnd("Expect ';' after import list.")
+		return s
+	}
+	for {
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect name.")
+		s.Names = append(s.Names, p.previous)
+		if !p.match(compiler.TOKEN_COMMA) {
+			break
+		}
+	}
+	s.Term = p.consumeStatementEnd("Expect ';' after import list.")
+	return s
+}
+
+// moduleName parses a dotted module name. With relative set it may start
+// with dots, or be only dots when 'import' follows.
+func (p *parser) moduleName(relative bool) (dots, path []Token) {
+
+	for relative && p.match(compiler.TOKEN_DOT) {
+		dots = append(dots, p.previous)
+	}
+	if len(dots) > 0 && p.check(compiler.TOKEN_IMPORT) {
+		return dots, nil
+	}
+	for {
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect module name.")
+		path = append(path, p.previous)
+		if !p.match(compiler.TOKEN_DOT) {
+			return dots, path
+		}
+	}
+}
+
+func (p *parser) tryStatement() Stmt {
+
+	s := &TryStmt{Keyword: p.previous}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_LEFT_BRACE, "Expect '{' brace after try")
+	s.Body = p.block(p.previous)
+	for p.match(compiler.TOKEN_EXCEPT) {
+		c := &ExceptClause{Keyword: p.previous}
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect Exception type.")
+		c.Type = p.previous
+		p.consume(compiler.TOKEN_AS, "Expect as")
+		c.As = p.previous
+		p.consume(compiler.TOKEN_IDENTIFIER, "Expect exception variable name.")
+		c.Name = p.previous
+		p.match(compiler.TOKEN_EOL)
+		p.consume(compiler.TOKEN_LEFT_BRACE, "Expect left brace.")
+		c.Body = p.block(p.previous)
+		s.Excepts = append(s.Excepts, c)
+	}
+	if !p.match(compiler.TOKEN_FINALLY) {
+		if len(s.Excepts) == 0 {
+			p.error("Expect except or finally.")
+		}
+		return s
+	}
+	s.FinallyTok = p.previous
+	p.consume(compiler.TOKEN_LEFT_BRACE, "Expect '{' after finally.")
+	s.Finally = p.block(p.previous)
+	return s
+}
+
+func (p *parser) ifStatement() Stmt {
+
+	s := &IfStmt{Keyword: p.previous}
+	p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after 'if'.")
+	s.LParen = p.previous
+	s.Cond = p.expression()
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect '(' after condition.")
+	s.RParen = p.previous
+	s.Then = p.statement()
+	if p.match(compiler.TOKEN_ELSE) {
+		s.ElseTok = p.previous
+		s.Else = p.statement()
+	}
+	return s
+}
+
+func (p *parser) forStatement() Stmt {
+
+	s := &ForStmt{Keyword: p.previous}
+	p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after for.")
+	s.LParen = p.previous
+	switch {
+	case p.match(compiler.TOKEN_SEMICOLON):
+		s.InitSemi = p.previous
+	case p.match(compiler.TOKEN_VAR):
+		s.Init = p.varDeclaration(p.previous, false, false)
+	default:
+		s.Init = p.expressionStatement()
+	}
+	if !p.match(compiler.TOKEN_SEMICOLON) {
+		s.Cond = p.expression()
+		p.consume(compiler.TOKEN_SEMICOLON, "Expect ';'.")
+	}
+	s.CondSemi = p.previous
+	if !p.match(compiler.TOKEN_RIGHT_PAREN) {
+		s.Incr = p.expression()
+		p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after for clauses.")
+	}
+	s.RParen = p.previous
+	p.match(compiler.TOKEN_EOL)
+	s.Body = p.statement()
+	return s
+}
+
+func (p *parser) foreachStatement() Stmt {
+
+	s := &ForeachStmt{Keyword: p.previous}
+	p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after for.")
+	s.LParen = p.previous
+	s.Var = p.varDeclaration(p.matched(p.match(compiler.TOKEN_VAR)), false, true)
+	p.consume(compiler.TOKEN_IN, "Expect in after foreach variable.")
+	s.In = p.previous
+	s.Iterable = p.expression()
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after iterable.")
+	s.RParen = p.previous
+	s.Body = p.statement()
+	return s
+}
+
+// expressionStatement parses an unpacking assignment or an expression used
+// as a statement. An assignment statement that declares its target is an
+// ordinary *Assign here; the resolver decides whether it declares.
+func (p *parser) expressionStatement() Stmt {
+
+	if p.check(compiler.TOKEN_IDENTIFIER) && p.checkNext(compiler.TOKEN_COMMA) {
+		if s := p.unpackStatement(); s != nil {
+			return s
+		}
+	}
+	s := &ExprStmt{X: p.expression()}
+	s.Term = p.consumeStatementEnd("Expect ';' after expression.")
+	return s
+}
+
+// unpackStatement parses `a, b = value`. It returns nil, having reported an
+// error, if the names are malformed; the caller then parses what is left as
+// an expression statement, as the compiler does.
+func (p *parser) unpackStatement() Stmt {
+
+	s := &UnpackStmt{}
+	for {
+		s.Names = append(s.Names, p.current)
+		p.advance()
+		if !p.match(compiler.TOKEN_COMMA) {
+			break
+		}
+		if !p.check(compiler.TOKEN_IDENTIFIER) {
+			p.errorAtCurrent("Expect variable name in unpacking assignment.")
+			return nil
+		}
+	}
+	p.consume(compiler.TOKEN_EQUAL, "Expect '=' after unpacking variables.")
+	s.Equal = p.previous
+	s.Value = p.expression()
+	s.Term = p.consumeStatementEnd("Expect ';' after unpacking assignment.")
+	return s
+}
+
+//-----------------------------------------------------------------------------
+// Expressions.
+
+func (p *parser) expression() Expr {
+
+	return p.parsePrecedence(precAssignment)
+}
+
+func (p *parser) parsePrecedence(prec precedence) Expr {
+
+	p.exprDepth++
+	defer func() { p.exprDepth-- }()
+	if p.exprDepth > maxDepth {
+		p.error("Expression nested too deeply")
+		p.current = p.scn.SkipToEnd()
+		return &BadExpr{Token: p.previous}
+	}
+
+	p.advance()
+	prefix := rules[p.previous.Tokentype].prefix
+	if prefix == nil {
+		p.error("Expect expression")
+		return &BadExpr{Token: p.previous}
+	}
+	canAssign := prec <= precAssignment
+	x := prefix(p, canAssign)
+	for prec <= rules[p.current.Tokentype].prec {
+		p.advance()
+		infix := rules[p.previous.Tokentype].infix
+		if infix == nil {
+			// Only '=' gets here: it follows something that cannot be
+			// assigned to, such as `a + b = c`.
+			p.error("Invalid assignment target.")
+			continue
+		}
+		x = infix(p, x, canAssign)
+	}
+	if canAssign && p.match(compiler.TOKEN_EQUAL) {
+		p.error("Invalid assignment target.")
+	}
+	return x
+}
+
+// isCompoundAssign reports whether tt is one of += -= *= /= %=.
+func isCompoundAssign(tt TokenType) bool {
+
+	switch tt {
+	case compiler.TOKEN_PLUS_EQUAL, compiler.TOKEN_MINUS_EQUAL, compiler.TOKEN_STAR_EQUAL,
+		compiler.TOKEN_SLASH_EQUAL, compiler.TOKEN_PERCENT_EQUAL:
+		return true
+	}
+	return false
+}
+
+// assignment parses the rest of an assignment to target if one follows:
+// '=' and, when compound is set, the compound operators.
+func (p *parser) assignment(target Expr, canAssign, compound bool) Expr {
+
+	if !canAssign {
+		return target
+	}
+	if compound && isCompoundAssign(p.current.Tokentype) {
+		p.advance()
+	} else if !p.match(compiler.TOKEN_EQUAL) {
+		return target
+	}
+	a := &Assign{Target: target, Op: p.previous}
+	a.Value = p.expression()
+	return a
+}
+
+func literal(p *parser, canAssign bool) Expr {
+
+	return &Literal{Token: p.previous}
+}
+
+func variable(p *parser, canAssign bool) Expr {
+
+	return p.assignment(&Variable{Name: p.previous}, canAssign, true)
+}
+
+func this(p *parser, canAssign bool) Expr {
+
+	return &This{Keyword: p.previous}
+}
+
+func super(p *parser, canAssign bool) Expr {
+
+	s := &Super{Keyword: p.previous}
+	p.consume(compiler.TOKEN_DOT, "Expect '.' after super.")
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect superclass method name.")
+	s.Method = p.previous
+	if p.match(compiler.TOKEN_LEFT_PAREN) {
+		s.Args = p.argumentList()
+	}
+	return s
+}
+
+func lambda(p *parser, canAssign bool) Expr {
+
+	return &Lambda{Func: p.function(FuncFunction, Token{}, p.previous, Token{}, true)}
+}
+
+func asyncLambda(p *parser, canAssign bool) Expr {
+
+	async := p.previous
+	p.consume(compiler.TOKEN_FUNC, "Expect 'func' after 'async'.")
+	return &Lambda{Func: p.function(FuncFunction, async, p.previous, Token{}, true)}
+}
+
+func await(p *parser, canAssign bool) Expr {
+
+	return &Await{Keyword: p.previous, X: p.parsePrecedence(precUnary)}
+}
+
+func str(p *parser, canAssign bool) Expr {
+
+	s := &Str{Keyword: p.previous}
+	p.consume(compiler.TOKEN_LEFT_PAREN, "Expect '(' after str.")
+	s.LParen = p.previous
+	s.X = p.expression()
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after expression.")
+	s.RParen = p.previous
+	return s
+}
+
+// grouping parses a parenthesised expression or a tuple.
+func grouping(p *parser, canAssign bool) Expr {
+
+	lparen := p.previous
+	x := p.expression()
+	if p.match(compiler.TOKEN_COMMA) {
+		t := &Tuple{LParen: lparen, Elems: []Expr{x}}
+		for {
+			t.Elems = append(t.Elems, p.expression())
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+		p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after tuple.")
+		t.RParen = p.previous
+		return t
+	}
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after expression.")
+	return &Grouping{LParen: lparen, X: x, RParen: p.previous}
+}
+
+func listLiteral(p *parser, canAssign bool) Expr {
+
+	l := &List{LBracket: p.previous}
+	if !p.check(compiler.TOKEN_RIGHT_BRACKET) {
+		for {
+			l.Elems = append(l.Elems, p.expression())
+			if len(l.Elems) == 255 {
+				p.error("Can't have more than 255 initialiser items. ")
+			}
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_RIGHT_BRACKET, "Expect ']' after list items.")
+	l.RBracket = p.previous
+	return l
+}
+
+func dictLiteral(p *parser, canAssign bool) Expr {
+
+	d := &Dict{LBrace: p.previous}
+	if !p.match(compiler.TOKEN_RIGHT_BRACE) {
+		for {
+			e := &DictEntry{Key: p.expression()}
+			p.consume(compiler.TOKEN_COLON, "Expect ':' after key.")
+			e.Colon = p.previous
+			e.Value = p.expression()
+			d.Entries = append(d.Entries, e)
+			if len(d.Entries) == 255 {
+				p.error("Can't have more than 255 initialiser keys. ")
+			}
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+		p.match(compiler.TOKEN_EOL)
+		p.consume(compiler.TOKEN_RIGHT_BRACE, "Expect '}' after dictionary items.")
+	}
+	d.RBrace = p.previous
+	return d
+}
+
+func unary(p *parser, canAssign bool) Expr {
+
+	op := p.previous
+	return &Unary{Op: op, X: p.parsePrecedence(precUnary)}
+}
+
+func binary(p *parser, left Expr, canAssign bool) Expr {
+
+	op := p.previous
+	return &Binary{X: left, Op: op, Y: p.parsePrecedence(rules[op.Tokentype].prec + 1)}
+}
+
+func logical(p *parser, left Expr, canAssign bool) Expr {
+
+	op := p.previous
+	return &Logical{X: left, Op: op, Y: p.parsePrecedence(rules[op.Tokentype].prec)}
+}
+
+func conditional(p *parser, left Expr, canAssign bool) Expr {
+
+	c := &Conditional{Cond: left, Question: p.previous}
+	c.Then = p.parsePrecedence(precConditional)
+	p.consume(compiler.TOKEN_COLON, "Expect ':' in conditional expression.")
+	c.Colon = p.previous
+	c.Else = p.parsePrecedence(precConditional)
+	return c
+}
+
+func call(p *parser, left Expr, canAssign bool) Expr {
+
+	return &Call{Callee: left, Args: p.argumentList()}
+}
+
+// argumentList parses call arguments after the '('.
+func (p *parser) argumentList() *ArgList {
+
+	a := &ArgList{LParen: p.previous}
+	if !p.check(compiler.TOKEN_RIGHT_PAREN) {
+		for {
+			if a.Spread() {
+				p.error("Spread argument must be last.")
+			}
+			if p.match(compiler.TOKEN_STAR) {
+				a.Star = p.previous
+			}
+			a.Args = append(a.Args, p.expression())
+			if len(a.Args) == 255 {
+				p.error("Can't have more than 255 arguments. ")
+			}
+			if !p.match(compiler.TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+	p.match(compiler.TOKEN_EOL)
+	p.consume(compiler.TOKEN_RIGHT_PAREN, "Expect ')' after arguments")
+	a.RParen = p.previous
+	return a
+}
+
+func dot(p *parser, left Expr, canAssign bool) Expr {
+
+	p.consume(compiler.TOKEN_IDENTIFIER, "Expect property name after '.'.")
+	name := p.previous
+	if canAssign && (isCompoundAssign(p.current.Tokentype) || p.check(compiler.TOKEN_EQUAL)) {
+		return p.assignment(&Property{Object: left, Name: name}, canAssign, true)
+	}
+	if p.match(compiler.TOKEN_LEFT_PAREN) {
+		return &Invoke{Object: left, Name: name, Args: p.argumentList()}
+	}
+	return &Property{Object: left, Name: name}
+}
+
+// subscript parses the index or slice after a '[': [i], [:], [:j], [i:] or
+// [i:j], and an assignment to it.
+func subscript(p *parser, left Expr, canAssign bool) Expr {
+
+	lbracket := p.previous
+	if p.check(compiler.TOKEN_RIGHT_BRACKET) {
+		p.error("Can't have empty slice.")
+		return &BadExpr{Token: lbracket}
+	}
+	var low Expr
+	if !p.match(compiler.TOKEN_COLON) {
+		low = p.expression()
+		if p.match(compiler.TOKEN_RIGHT_BRACKET) {
+			x := &Index{Object: left, LBracket: lbracket, Index: low, RBracket: p.previous}
+			return p.assignment(x, canAssign, false)
+		}
+		if !p.match(compiler.TOKEN_COLON) {
+			p.errorAtCurrent("Expect ']' after expression.")
+			return &Index{Object: left, LBracket: lbracket, Index: low, RBracket: p.previous}
+		}
+	}
+	s := &Slice{Object: left, LBracket: lbracket, Low: low, Colon: p.previous}
+	if !p.match(compiler.TOKEN_RIGHT_BRACKET) {
+		s.High = p.expression()
+		if low == nil {
+			p.consume(compiler.TOKEN_RIGHT_BRACKET, "Expect ']' after expression.")
+		} else {
+			p.consume(compiler.TOKEN_RIGHT_BRACKET, "Expect ']' after expression")
+		}
+	}
+	s.RBracket = p.previous
+	return p.assignment(s, canAssign, false)
+}
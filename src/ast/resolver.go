@@ -0,0 +1,640 @@
+package ast
+
+import (
+	"fmt"
+
+	"glox/src/compiler"
+)
+
+// scopeLocal is a local in scope while resolving. depth is -1 from its
+// declaration until its initialiser has been resolved.
+type scopeLocal struct {
+	decl  *Decl
+	depth int
+}
+
+// funcScope is the resolver's view of the function whose body it is in.
+type funcScope struct {
+	enclosing *funcScope
+	kind      FuncKind
+	locals    []scopeLocal
+	depth     int
+	loops     int // loops enclosing the current statement
+	tries     int // try statements whose body or except clauses enclose it
+	captures  []Capture
+	async     bool // in the body of an async function, which may await
+}
+
+// classScope tracks the class declaration being resolved, for `this` and
+// `super`.
+type classScope struct {
+	enclosing *classScope
+	hasSuper  bool
+}
+
+// resolver binds names to declarations. It walks the tree in the order the
+// compiler compiles it, so that locals, upvalues and captured variables come
+// out exactly as the compiler allocates them.
+type resolver struct {
+	script      string
+	fn          *funcScope
+	class       *classScope
+	declared    map[string]bool // globals declared so far, rather than only referenced
+	panicMode   bool
+	diagnostics []Diagnostic
+}
+
+// Resolve binds every name in s to a local, upvalue or global, records the
+// upvalues of each function and which locals they capture, and decides
+// which assignments declare a variable. It reports the errors that depend
+// on scope, such as reading a local in its own initialiser or `return`
+// outside a function.
+func Resolve(s *Script) []Diagnostic {
+
+	r := &resolver{
+		script:   s.Name,
+		declared: map[string]bool{},
+	}
+	s.This = &Decl{Name: "this"}
+	r.fn = &funcScope{kind: FuncScript, locals: []scopeLocal{{decl: s.This}}}
+	r.stmts(s.Stmts)
+	return r.diagnostics
+}
+
+//-----------------------------------------------------------------------------
+// Errors.
+
+// errorAt reports msg at tok. As in the compiler, a statement reports at
+// most one error.
+func (r *resolver) errorAt(tok Token, msg string, related ...compiler.Note) {
+
+	if r.panicMode {
+		return
+	}
+	r.panicMode = true
+	d := Diagnostic{
+		Severity: compiler.SeverityError,
+		Code:     compiler.CodeSyntax,
+		Span:     tokenSpan(r.script, tok),
+		Message:  msg,
+		Related:  related,
+	}
+	if tok.Tokentype != compiler.TOKEN_EOF && present(tok) {
+		d.Near = tok.Lexeme()
+	}
+	r.diagnostics = report(r.diagnostics, d)
+}
+
+//-----------------------------------------------------------------------------
+// Scopes.
+
+func (r *resolver) beginScope() {
+
+	r.fn.depth++
+}
+
+func (r *resolver) endScope() {
+
+	fs := r.fn
+	fs.depth--
+	for len(fs.locals) > 0 && fs.locals[len(fs.locals)-1].depth > fs.depth {
+		fs.locals = fs.locals[:len(fs.locals)-1]
+	}
+}
+
+// addLocal brings d into scope, uninitialised.
+func (r *resolver) addLocal(d *Decl, at Token) {
+
+	if len(r.fn.locals) == 256 {
+		r.errorAt(at, "Too many variables in function")
+		return
+	}
+	r.fn.locals = append(r.fn.locals, scopeLocal{decl: d, depth: -1})
+}
+
+// hidden adds one of the compiler's hidden locals and marks it initialised.
+func (r *resolver) hidden(name string, at Token) *Decl {
+
+	d := &Decl{Name: name}
+	r.addLocal(d, at)
+	r.markInitialised()
+	return d
+}
+
+// markInitialised makes the newest local readable.
+func (r *resolver) markInitialised() {
+
+	fs := r.fn
+	if fs.depth == 0 || len(fs.locals) == 0 {
+		return
+	}
+	fs.locals[len(fs.locals)-1].depth = fs.depth
+}
+
+// declare declares the variable name in the current scope. It returns the
+// new local, or nil at the top level of the script, where the variable is
+// a global.
+func (r *resolver) declare(name Token) *Decl {
+
+	fs := r.fn
+	if fs.depth == 0 {
+		return nil
+	}
+	for i := len(fs.locals) - 1; i >= 0; i-- {
+		l := fs.locals[i]
+		if l.depth != -1 && l.depth < fs.depth {
+			break
+		}
+		if l.decl.Name == name.Lexeme() {
+			note := compiler.Note{Message: "previous declaration of '" + l.decl.Name + "' is here"}
+			if present(l.decl.Token) {
+				note.Span = tokenSpan(r.script, l.decl.Token)
+			}
+			r.errorAt(name, "Already a variable with this name in this scope.", note)
+		}
+	}
+	d := &Decl{Name: name.Lexeme(), Token: name}
+	r.addLocal(d, name)
+	return d
+}
+
+// declareVariable declares name as a local or, at the top level, a global,
+// and returns its binding.
+func (r *resolver) declareVariable(name Token) Binding {
+
+	if d := r.declare(name); d != nil {
+		return Binding{Kind: Local, Decl: d}
+	}
+	r.declared[name.Lexeme()] = true
+	return Binding{Kind: Global}
+}
+
+// resolveLocal finds the innermost local of fs called name.
+func (r *resolver) resolveLocal(fs *funcScope, name Token) *Decl {
+
+	for i := len(fs.locals) - 1; i >= 0; i-- {
+		l := fs.locals[i]
+		if l.decl.Name == name.Lexeme() {
+			if l.depth == -1 {
+				r.errorAt(name, "Can't read local variable in its own initialiser.")
+			}
+			return l.decl
+		}
+	}
+	return nil
+}
+
+// resolveUpvalue finds name in the functions enclosing fs, capturing it in
+// each function in between, and returns its upvalue index in fs or -1.
+func (r *resolver) resolveUpvalue(fs *funcScope, name Token) int {
+
+	if fs.enclosing == nil {
+		return -1
+	}
+	if d := r.resolveLocal(fs.enclosing, name); d != nil {
+		d.Captured = true
+		return r.addCapture(fs, Capture{Local: true, Decl: d}, name)
+	}
+	if i := r.resolveUpvalue(fs.enclosing, name); i != -1 {
+		return r.addCapture(fs, Capture{Index: i}, name)
+	}
+	return -1
+}
+
+func (r *resolver) addCapture(fs *funcScope, c Capture, at Token) int {
+
+	for i, prev := range fs.captures {
+		if prev.Local == c.Local && prev.Decl == c.Decl && prev.Index == c.Index {
+			return i
+		}
+	}
+	if len(fs.captures) == 256 {
+		r.errorAt(at, "Too many closure variables in function.")
+		return 0
+	}
+	fs.captures = append(fs.captures, c)
+	return len(fs.captures) - 1
+}
+
+// resolve binds a reference to name.
+func (r *resolver) resolve(name Token) Binding {
+
+	if d := r.resolveLocal(r.fn, name); d != nil {
+		return Binding{Kind: Local, Decl: d}
+	}
+	if i := r.resolveUpvalue(r.fn, name); i != -1 {
+		return Binding{Kind: Upvalue, Index: i}
+	}
+	return Binding{Kind: Global}
+}
+
+// lookup reports whether name is already defined, for assignments that
+// declare what they assign to. Inside a function a local or upvalue
+// counts; a global only counts once it has been declared, so a function
+// may assign to a global the script declares later on.
+func (r *resolver) lookup(name Token) (Binding, bool) {
+
+	if r.fn.depth > 0 {
+		if d := r.resolveLocal(r.fn, name); d != nil {
+			return Binding{Kind: Local, Decl: d}, true
+		}
+		if i := r.resolveUpvalue(r.fn, name); i != -1 {
+			return Binding{Kind: Upvalue, Index: i}, true
+		}
+	}
+	return Binding{Kind: Global}, r.declared[name.Lexeme()]
+}
+
+//-----------------------------------------------------------------------------
+// Statements.
+
+// stmts resolves a list of statements. Each gets a fresh chance to report
+// an error.
+func (r *resolver) stmts(list []Stmt) {
+
+	for _, s := range list {
+		r.stmt(s)
+		r.panicMode = false
+	}
+}
+
+func (r *resolver) stmt(s Stmt) {
+
+	switch s := s.(type) {
+	case *ExprStmt:
+		if a, ok := s.X.(*Assign); ok && a.Op.Tokentype == compiler.TOKEN_EQUAL {
+			if v, ok := a.Target.(*Variable); ok {
+				if _, defined := r.lookup(v.Name); !defined {
+					a.Declares = true
+					v.Binding = r.declareVariable(v.Name)
+					r.expr(a.Value)
+					r.markInitialised()
+					return
+				}
+			}
+		}
+		r.expr(s.X)
+	case *UnpackStmt:
+		r.unpack(s)
+	case *VarStmt:
+		r.varStmt(s)
+	case *PrintStmt:
+		r.expr(s.X)
+	case *RaiseStmt:
+		r.expr(s.Value)
+	case *Block:
+		r.beginScope()
+		r.stmts(s.Stmts)
+		r.endScope()
+	case *IfStmt:
+		r.expr(s.Cond)
+		r.stmt(s.Then)
+		if s.Else != nil {
+			r.stmt(s.Else)
+		}
+	case *WhileStmt:
+		r.fn.loops++
+		r.expr(s.Cond)
+		r.stmt(s.Body)
+		r.fn.loops--
+	case *ForStmt:
+		r.fn.loops++
+		r.beginScope()
+		if s.Init != nil {
+			r.stmt(s.Init)
+		}
+		if s.Cond != nil {
+			r.expr(s.Cond)
+		}
+		if s.Incr != nil {
+			r.expr(s.Incr)
+		}
+		r.stmt(s.Body)
+		r.endScope()
+		r.fn.loops--
+	case *ForeachStmt:
+		r.fn.loops++
+		r.beginScope()
+		r.varStmt(s.Var)
+		r.expr(s.Iterable)
+		s.Iter = r.hidden("__it", s.RParen)
+		r.stmt(s.Body)
+		r.endScope()
+		r.fn.loops--
+	case *BreakStmt:
+		if r.fn.loops == 0 {
+			r.errorAt(s.Keyword, "Cannot use break outside loop.")
+		}
+	case *ContinueStmt:
+		if r.fn.loops == 0 {
+			r.errorAt(s.Keyword, "Cannot use continue outside loop.")
+		}
+	case *BreakpointStmt:
+	case *ReturnStmt:
+		r.returnStmt(s)
+	case *ImportStmt:
+		for _, m := range s.Modules {
+			if present(m.Alias) {
+				r.declared[m.Alias.Lexeme()] = true
+			} else {
+				r.declared[m.Path[0].Lexeme()] = true
+			}
+		}
+	case *FromImportStmt:
+		for _, name := range s.Names {
+			r.declared[name.Lexeme()] = true
+		}
+	case *TryStmt:
+		r.tryStmt(s)
+	case *FuncStmt:
+		s.Binding = r.declareVariable(s.Func.Name)
+		r.markInitialised()
+		r.decorators(s.Decorators)
+		r.function(s.Func)
+	case *ClassStmt:
+		r.classStmt(s)
+	case *ExportStmt:
+		if r.fn.kind != FuncScript || r.fn.depth > 0 {
+			r.errorAt(s.Keyword, "Can only export top-level declarations.")
+		}
+		r.stmt(s.Decl)
+	case *BadStmt:
+	default:
+		panic(fmt.Sprintf("ast: unexpected statement %T", s))
+	}
+}
+
+// varStmt resolves a declaration; the variable is in scope, but unreadable,
+// in its own initialiser.
+func (r *resolver) varStmt(s *VarStmt) {
+
+	s.Binding = r.declareVariable(s.Name)
+	if s.Binding.Decl != nil {
+		s.Binding.Decl.Const = s.Const
+	}
+	if s.Value != nil {
+		r.expr(s.Value)
+	}
+	r.markInitialised()
+}
+
+// unpack resolves `a, b = value`, which declares each name not already
+// defined.
+func (r *resolver) unpack(s *UnpackStmt) {
+
+	r.expr(s.Value)
+	s.Declares = make([]bool, len(s.Names))
+	s.Bindings = make([]Binding, len(s.Names))
+	if r.fn.depth > 0 {
+		for i, name := range s.Names {
+			if b, defined := r.lookup(name); defined {
+				s.Bindings[i] = b
+				continue
+			}
+			d := &Decl{Name: name.Lexeme(), Token: name}
+			r.addLocal(d, name)
+			r.markInitialised()
+			s.Declares[i] = true
+			s.Bindings[i] = Binding{Kind: Local, Decl: d}
+		}
+		return
+	}
+	for i := len(s.Names) - 1; i >= 0; i-- {
+		name := s.Names[i]
+		s.Bindings[i] = Binding{Kind: Global}
+		if !r.declared[name.Lexeme()] {
+			r.declared[name.Lexeme()] = true
+			s.Declares[i] = true
+		}
+	}
+}
+
+func (r *resolver) returnStmt(s *ReturnStmt) {
+
+	if r.fn.kind == FuncScript {
+		r.errorAt(s.Keyword, "Can't return from top-level code.")
+	}
+	if s.Value != nil {
+		if r.fn.kind == FuncInitializer {
+			r.errorAt(s.Keyword, "Can't return from an initializer.")
+		}
+		r.expr(s.Value)
+	}
+	if r.fn.tries > 0 {
+		s.Retval = r.hidden("__re", s.Keyword)
+	}
+}
+
+// tryStmt resolves a try statement. Its finally block is resolved once,
+// where the compiler first compiles it, as the handler that re-raises an
+// escaping exception; the generator replays it on every other path.
+func (r *resolver) tryStmt(s *TryStmt) {
+
+	r.fn.tries++
+	r.stmt(s.Body)
+	for _, c := range s.Excepts {
+		r.beginScope()
+		c.Decl = r.declare(c.Name)
+		r.markInitialised()
+		r.stmts(c.Body.Stmts)
+		r.endScope()
+	}
+	r.fn.tries--
+	if s.Finally == nil {
+		return
+	}
+	r.beginScope()
+	s.Exc = r.hidden("__ex", s.Finally.LBrace)
+	r.stmts(s.Finally.Stmts)
+	r.endScope()
+}
+
+func (r *resolver) decorators(decorators []*Decorator) {
+
+	for _, d := range decorators {
+		r.expr(d.X)
+	}
+}
+
+// function resolves a function, lambda or method in a scope of its own.
+func (r *resolver) function(f *Function) {
+
+	fs := &funcScope{enclosing: r.fn, kind: f.Kind}
+	f.This = &Decl{Name: "this"}
+	if f.Kind == FuncFunction || f.Kind == FuncDecoratedMethod {
+		f.This.Name = ""
+	}
+	fs.locals = []scopeLocal{{decl: f.This}}
+	r.fn = fs
+	r.beginScope()
+	if f.Kind == FuncDecoratedMethod {
+		f.Receiver = r.hidden("this", f.Name)
+	}
+	for _, prm := range f.Params {
+		prm.Decl = r.declare(prm.Name)
+		r.markInitialised()
+		if prm.Default != nil {
+			r.expr(prm.Default)
+		}
+	}
+	// The body shares the parameters' scope.
+	fs.async = present(f.Async)
+	r.stmts(f.Body.Stmts)
+	f.Captures = fs.captures
+	r.fn = fs.enclosing
+}
+
+func (r *resolver) classStmt(s *ClassStmt) {
+
+	name := s.Name.Lexeme()
+	r.declared[name] = true
+	s.Binding = r.declareVariable(s.Name)
+	r.markInitialised()
+
+	r.class = &classScope{enclosing: r.class}
+	if s.Super != nil {
+		s.Super.Binding = r.resolve(s.Super.Name)
+		r.beginScope()
+		s.SuperDecl = r.hidden("supe", s.Super.Name)
+		r.class.hasSuper = true
+	}
+	for _, m := range s.Members {
+		switch m := m.(type) {
+		case *Method:
+			if m.Func.Kind == FuncDecoratedMethod {
+				// What the decorators return is a local of a scope
+				// of its own, captured by the method calling it.
+				r.beginScope()
+				r.decorators(m.Decorators)
+				r.function(m.Func)
+				m.Decorated = r.hidden("@dec", m.Func.Name)
+				m.Decorated.Captured = true
+				r.endScope()
+				continue
+			}
+			r.decorators(m.Decorators)
+			r.function(m.Func)
+		case *ClassVar:
+			if m.Value != nil {
+				r.expr(m.Value)
+			}
+		}
+	}
+	if s.Super != nil {
+		r.endScope()
+	}
+	r.class = r.class.enclosing
+	r.decorators(s.Decorators)
+}
+
+//-----------------------------------------------------------------------------
+// Expressions.
+
+func (r *resolver) expr(x Expr) {
+
+	switch x := x.(type) {
+	case *Literal, *BadExpr:
+	case *Variable:
+		x.Binding = r.resolve(x.Name)
+	case *Assign:
+		r.assign(x)
+	case *This:
+		if r.class == nil {
+			r.errorAt(x.Keyword, "Can't use this outside of a class.")
+			return
+		}
+		x.Binding = r.resolve(x.Keyword)
+	case *Super:
+		switch {
+		case r.class == nil:
+			r.errorAt(x.Keyword, "Cannot use 'super' outside of a class.")
+		case !r.class.hasSuper:
+			r.errorAt(x.Keyword, "Cannot use 'super' in a class with no superclass.")
+		}
+		x.This = r.resolve(compiler.SyntheticToken("this"))
+		if x.Args != nil {
+			r.exprs(x.Args.Args)
+		}
+		x.Super = r.resolve(compiler.SyntheticToken("super"))
+	case *Unary:
+		r.expr(x.X)
+	case *Binary:
+		r.expr(x.X)
+		r.expr(x.Y)
+	case *Logical:
+		r.expr(x.X)
+		r.expr(x.Y)
+	case *Conditional:
+		r.expr(x.Cond)
+		r.expr(x.Then)
+		r.expr(x.Else)
+	case *Grouping:
+		r.expr(x.X)
+	case *Tuple:
+		r.exprs(x.Elems)
+	case *Call:
+		r.expr(x.Callee)
+		r.exprs(x.Args.Args)
+	case *Property:
+		r.expr(x.Object)
+	case *Invoke:
+		r.expr(x.Object)
+		r.exprs(x.Args.Args)
+	case *Index:
+		r.expr(x.Object)
+		r.expr(x.Index)
+	case *Slice:
+		r.expr(x.Object)
+		if x.Low != nil {
+			r.expr(x.Low)
+		}
+		if x.High != nil {
+			r.expr(x.High)
+		}
+	case *List:
+		r.exprs(x.Elems)
+	case *Dict:
+		for _, e := range x.Entries {
+			r.expr(e.Key)
+			r.expr(e.Value)
+		}
+	case *Lambda:
+		r.function(x.Func)
+	case *Await:
+		if !r.fn.async {
+			r.errorAt(x.Keyword, "Can't use 'await' outside an async function.")
+		}
+		r.expr(x.X)
+	case *Str:
+		r.expr(x.X)
+	default:
+		panic(fmt.Sprintf("ast: unexpected expression %T", x))
+	}
+}
+
+func (r *resolver) exprs(list []Expr) {
+
+	for _, x := range list {
+		r.expr(x)
+	}
+}
+
+// assign resolves an assignment, target first. Assigning to a local
+// declared const is an error.
+func (r *resolver) assign(a *Assign) {
+
+	if v, ok := a.Target.(*Variable); ok {
+		v.Binding = r.resolve(v.Name)
+		if d := v.Binding.Decl; v.Binding.Kind == Local && d.Const {
+			note := compiler.Note{
+				Span:    tokenSpan(r.script, d.Token),
+				Message: "'" + d.Name + "' is declared const here",
+			}
+			r.errorAt(v.Name, fmt.Sprintf("Cannot assign to const '%s'.", v.Name.Lexeme()), note)
+			return
+		}
+	} else {
+		r.expr(a.Target)
+	}
+	r.expr(a.Value)
+}
@@ -0,0 +1,173 @@
+package ast
+
+// Inspect traverses the tree rooted at n in source order. It calls f for n
+// and, if f returns true, for each of n's children in turn. The nodes
+// visited are expressions, statements, class members, functions and type
+// annotations; the parts of a node that are not nodes themselves, such as
+// parameters, decorators, dictionary entries and except clauses, are
+// walked through to the nodes they contain.
+func Inspect(n Node, f func(Node) bool) {
+
+	if n == nil || !f(n) {
+		return
+	}
+	walk := func(children ...Node) {
+		for _, c := range children {
+			if c != nil {
+				Inspect(c, f)
+			}
+		}
+	}
+	exprs := func(list []Expr) {
+		for _, x := range list {
+			Inspect(x, f)
+		}
+	}
+	decorators := func(list []*Decorator) {
+		for _, d := range list {
+			Inspect(d.X, f)
+		}
+	}
+
+	switch n := n.(type) {
+	case *Literal, *Variable, *This, *BadExpr, *TypeAnnotation, *Field:
+	case *Assign:
+		walk(n.Target, n.Value)
+	case *Super:
+		if n.Args != nil {
+			exprs(n.Args.Args)
+		}
+	case *Unary:
+		walk(n.X)
+	case *Binary:
+		walk(n.X, n.Y)
+	case *Logical:
+		walk(n.X, n.Y)
+	case *Conditional:
+		walk(n.Cond, n.Then, n.Else)
+	case *Grouping:
+		walk(n.X)
+	case *Tuple:
+		exprs(n.Elems)
+	case *Call:
+		walk(n.Callee)
+		exprs(n.Args.Args)
+	case *Property:
+		walk(n.Object)
+	case *Invoke:
+		walk(n.Object)
+		exprs(n.Args.Args)
+	case *Index:
+		walk(n.Object, n.Index)
+	case *Slice:
+		walk(n.Object)
+		if n.Low != nil {
+			walk(n.Low)
+		}
+		if n.High != nil {
+			walk(n.High)
+		}
+	case *List:
+		exprs(n.Elems)
+	case *Dict:
+		for _, e := range n.Entries {
+			walk(e.Key, e.Value)
+		}
+	case *Lambda:
+		walk(n.Func)
+	case *Await:
+		walk(n.X)
+	case *Str:
+		walk(n.X)
+
+	case *Function:
+		for _, prm := range n.Params {
+			if prm.Type != nil {
+				walk(prm.Type)
+			}
+			if prm.Default != nil {
+				walk(prm.Default)
+			}
+		}
+		if n.Return != nil {
+			walk(n.Return)
+		}
+		walk(n.Body)
+	case *Method:
+		decorators(n.Decorators)
+		walk(n.Func)
+	case *ClassVar:
+		if n.Type != nil {
+			walk(n.Type)
+		}
+		if n.Value != nil {
+			walk(n.Value)
+		}
+
+	case *ExprStmt:
+		walk(n.X)
+	case *UnpackStmt:
+		walk(n.Value)
+	case *VarStmt:
+		if n.Type != nil {
+			walk(n.Type)
+		}
+		if n.Value != nil {
+			walk(n.Value)
+		}
+	case *PrintStmt:
+		walk(n.X)
+	case *RaiseStmt:
+		walk(n.Value)
+	case *ReturnStmt:
+		if n.Value != nil {
+			walk(n.Value)
+		}
+	case *Block:
+		for _, s := range n.Stmts {
+			walk(s)
+		}
+	case *IfStmt:
+		walk(n.Cond, n.Then)
+		if n.Else != nil {
+			walk(n.Else)
+		}
+	case *WhileStmt:
+		walk(n.Cond, n.Body)
+	case *ForStmt:
+		if n.Init != nil {
+			walk(n.Init)
+		}
+		if n.Cond != nil {
+			walk(n.Cond)
+		}
+		if n.Incr != nil {
+			walk(n.Incr)
+		}
+		walk(n.Body)
+	case *ForeachStmt:
+		walk(n.Var, n.Iterable, n.Body)
+	case *TryStmt:
+		walk(n.Body)
+		for _, c := range n.Excepts {
+			walk(c.Body)
+		}
+		if n.Finally != nil {
+			walk(n.Finally)
+		}
+	case *FuncStmt:
+		decorators(n.Decorators)
+		walk(n.Func)
+	case *ClassStmt:
+		decorators(n.Decorators)
+		if n.Super != nil {
+			walk(n.Super)
+		}
+		for _, m := range n.Members {
+			walk(m)
+		}
+	case *ExportStmt:
+		walk(n.Decl)
+	case *BreakStmt, *ContinueStmt, *BreakpointStmt, *ImportStmt, *FromImportStmt, *BadStmt:
+	}
+}
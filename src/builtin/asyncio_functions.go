@@ -0,0 +1,289 @@
+package builtin
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+
+	"glox/src/core"
+)
+
+// The asyncio module: the event loop async functions' tasks run on, and
+// futures for what they can await besides each other. Work that would
+// block -- a channel receive, a file read -- runs on a goroutine, so other
+// tasks go on meanwhile; cancelling such a future abandons the work rather
+// than interrupting it.
+
+// AsyncioRunBuiltIn implements asyncio.run(aw): it runs the event loop
+// until aw is done and returns its result, or raises what it raised.
+func AsyncioRunBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("run() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	f, ok := awaitableArg(vm, vm.Stack(arg_stackptr), "run")
+	if !ok {
+		return core.NIL_VALUE
+	}
+	result, ok := vm.RunAsync(f)
+	if !ok {
+		return core.NIL_VALUE
+	}
+	return result
+}
+
+// AsyncioSleepBuiltIn implements asyncio.sleep(t): a future resolved with
+// nil once t seconds have passed. Awaiting it lets the other tasks run.
+func AsyncioSleepBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("sleep() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	seconds, ok := secondsArg(vm, vm.Stack(arg_stackptr), "sleep")
+	if !ok {
+		return core.NIL_VALUE
+	}
+	return futureValue(vm.SleepAsync(seconds), "future sleep")
+}
+
+// AsyncioGatherBuiltIn implements asyncio.gather(*aws): a future resolved
+// with the list of their results, in the order given, once all are done.
+// If one fails, it fails with that exception, and the rest run on.
+func AsyncioGatherBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	fs := make([]*core.Future, 0, argCount)
+	for i := range argCount {
+		f, ok := awaitableArg(vm, vm.Stack(arg_stackptr+i), "gather")
+		if !ok {
+			return core.NIL_VALUE
+		}
+		fs = append(fs, f)
+	}
+	return futureValue(vm.GatherAsync(fs), "future gather")
+}
+
+// AsyncioWaitForBuiltIn implements asyncio.wait_for(aw, timeout): a future
+// settled as aw is, unless timeout seconds pass first, when it fails with
+// TimeoutError and aw is cancelled.
+func AsyncioWaitForBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 2 {
+		vm.RunTimeError("wait_for() expects 2 arguments.")
+		return core.NIL_VALUE
+	}
+	f, ok := awaitableArg(vm, vm.Stack(arg_stackptr), "wait_for")
+	if !ok {
+		return core.NIL_VALUE
+	}
+	seconds, ok := secondsArg(vm, vm.Stack(arg_stackptr+1), "wait_for")
+	if !ok {
+		return core.NIL_VALUE
+	}
+	return futureValue(vm.WaitForAsync(f, seconds), "future wait_for")
+}
+
+// AsyncioRecvBuiltIn implements asyncio.recv(ch): a future resolved with
+// the next message from a Thread, a thread's ThreadChannel, a Channel or
+// a Process, received as their recv() would, without blocking the other
+// tasks.
+func AsyncioRecvBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("recv() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	var work func(cancel <-chan struct{}) (core.Value, error)
+	switch o := vm.Stack(arg_stackptr).Obj().(type) {
+	case *ThreadObject:
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			select {
+			case msg, ok := <-o.Handle.FromWorker:
+				if !ok {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: "thread finished, no more messages"}
+				}
+				if msg.Err != nil {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: msg.Err.Error()}
+				}
+				return msg.Val, nil
+			case <-cancel:
+				return core.NIL_VALUE, nil
+			}
+		}
+	case *ThreadChannelObject:
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			select {
+			case val, ok := <-o.Chans.In:
+				if !ok {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: "parent closed the channel"}
+				}
+				return val, nil
+			case <-o.Chans.Cancelled:
+				return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: "thread was cancelled"}
+			case <-cancel:
+				return core.NIL_VALUE, nil
+			}
+		}
+	case *ChannelObject:
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			select {
+			case val := <-o.Ch:
+				return val, nil
+			case <-o.done:
+				if val, ok := o.drain(); ok {
+					return val, nil
+				}
+				return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: "channel is closed"}
+			case <-cancel:
+				return core.NIL_VALUE, nil
+			}
+		}
+	case *ProcessObject:
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			select {
+			case result := <-o.recvCh:
+				if result.err != nil {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ProcessError", Msg: "recv failed: " + result.err.Error()}
+				}
+				return result.val, nil
+			case <-cancel:
+				return core.NIL_VALUE, nil
+			}
+		}
+	default:
+		vm.RunTimeError("recv() argument must be a thread, thread channel, channel or process.")
+		return core.NIL_VALUE
+	}
+	return futureValue(vm.GoAsync(work), "future recv")
+}
+
+// AsyncioWaitBuiltIn implements asyncio.wait(t): a future resolved with
+// what a Thread returned, or a Process's exit code, once it has finished.
+func AsyncioWaitBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("wait() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	var work func(cancel <-chan struct{}) (core.Value, error)
+	switch o := vm.Stack(arg_stackptr).Obj().(type) {
+	case *ThreadObject:
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			select {
+			case <-o.Handle.Done:
+				if o.Handle.Err != nil {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ThreadError", Msg: o.Handle.Err.Error()}
+				}
+				return o.Handle.Result, nil
+			case <-cancel:
+				return core.NIL_VALUE, nil
+			}
+		}
+	case *ProcessObject:
+		if o.Cmd == nil {
+			vm.RunTimeError("wait() can't wait for the parent process.")
+			return core.NIL_VALUE
+		}
+		work = func(cancel <-chan struct{}) (core.Value, error) {
+			if err := o.Cmd.Wait(); err != nil {
+				if _, isExit := err.(*exec.ExitError); !isExit {
+					return core.NIL_VALUE, &core.AsyncError{Class: "ProcessError", Msg: "wait failed: " + err.Error()}
+				}
+			}
+			return core.MakeIntValue(o.Cmd.ProcessState.ExitCode(), false), nil
+		}
+	default:
+		vm.RunTimeError("wait() argument must be a thread or process.")
+		return core.NIL_VALUE
+	}
+	return futureValue(vm.GoAsync(work), "future wait")
+}
+
+// AsyncioReadFileBuiltIn implements asyncio.read_file(path): a future
+// resolved with the whole of the file as a string.
+func AsyncioReadFileBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("read_file() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	path := vm.Stack(arg_stackptr)
+	if !path.IsStringObject() {
+		vm.RunTimeError("read_file() argument must be a string.")
+		return core.NIL_VALUE
+	}
+	name, fsys := path.AsString().Get(), vm.FileSystem()
+	return futureValue(vm.GoAsync(func(cancel <-chan struct{}) (core.Value, error) {
+		fp, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			return core.NIL_VALUE, asyncFileError(err)
+		}
+		defer fp.Close()
+		b, err := io.ReadAll(fp)
+		if err != nil {
+			return core.NIL_VALUE, asyncFileError(err)
+		}
+		return core.MakeStringObjectValue(string(b), false), nil
+	}), "future read_file")
+}
+
+// AsyncioWriteFileBuiltIn implements asyncio.write_file(path, text): a
+// future resolved with nil once text has replaced what the file held.
+func AsyncioWriteFileBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 2 {
+		vm.RunTimeError("write_file() expects 2 arguments.")
+		return core.NIL_VALUE
+	}
+	path, text := vm.Stack(arg_stackptr), vm.Stack(arg_stackptr+1)
+	if !path.IsStringObject() || !text.IsStringObject() {
+		vm.RunTimeError("write_file() arguments must be strings.")
+		return core.NIL_VALUE
+	}
+	name, s, fsys := path.AsString().Get(), text.AsString().Get(), vm.FileSystem()
+	return futureValue(vm.GoAsync(func(cancel <-chan struct{}) (core.Value, error) {
+		fp, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return core.NIL_VALUE, asyncFileError(err)
+		}
+		_, err = io.WriteString(fp, s)
+		if cerr := fp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return core.NIL_VALUE, asyncFileError(err)
+		}
+		return core.NIL_VALUE, nil
+	}), "future write_file")
+}
+
+// asyncFileError is a failed file operation's error as fileError would
+// raise it.
+func asyncFileError(err error) error {
+	class := "RunTimeError"
+	if errors.Is(err, fs.ErrPermission) {
+		class = "PermissionError"
+	}
+	return &core.AsyncError{Class: class, Msg: err.Error()}
+}
+
+func futureValue(f *core.Future, name string) core.Value {
+	return core.MakeObjectValue(MakeFutureObject(f, name), false)
+}
+
+// awaitableArg returns the future of a task or future passed to fname.
+func awaitableArg(vm core.VMContext, v core.Value, fname string) (*core.Future, bool) {
+	if v.IsObj() {
+		if aw, ok := v.Obj().(core.Awaitable); ok {
+			return aw.Awaitable(), true
+		}
+	}
+	vm.RunTimeError("%s() argument must be a task or future.", fname)
+	return nil, false
+}
+
+func secondsArg(vm core.VMContext, v core.Value, fname string) (float64, bool) {
+	switch {
+	case v.IsInt():
+		return float64(v.AsInt()), true
+	case v.IsFloat():
+		return v.AsFloat(), true
+	}
+	vm.RunTimeError("%s() time must be a number.", fname)
+	return 0, false
+}
@@ -17,21 +17,21 @@ func RegisterAllBatchInstancedMethods(o *BatchInstancedObject) {
 			axisVal := vm.Stack(arg_stackptr + 1)
 			angleVal := vm.Stack(arg_stackptr + 2)
 
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() first argument must be a vec3 (position)")
 				return core.NIL_VALUE
 			}
-			if axisVal.Type != core.VAL_VEC3 {
+			if axisVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() second argument must be a vec3 (rotation axis)")
 				return core.NIL_VALUE
 			}
-			if angleVal.Type != core.VAL_FLOAT {
+			if !angleVal.IsFloat() {
 				vm.RunTimeError("add() third argument must be a float (angle)")
 				return core.NIL_VALUE
 			}
 
-			pos := posVal.Obj.(*core.Vec3Object)
-			axis := axisVal.Obj.(*core.Vec3Object)
+			pos := posVal.Obj().(*core.Vec3Object)
+			axis := axisVal.Obj().(*core.Vec3Object)
 			angle := angleVal.AsFloat()
 
 			if !o.batch.AddInstance(pos.X, pos.Y, pos.Z, axis.X, axis.Y, axis.Z, angle) {
@@ -67,7 +67,7 @@ func RegisterAllBatchInstancedMethods(o *BatchInstancedObject) {
 				vm.RunTimeError("draw() expected a camera object, got %s", cameraVal.String())
 				return core.NIL_VALUE
 			}
-			co, ok := cameraVal.Obj.(*CameraObject)
+			co, ok := cameraVal.Obj().(*CameraObject)
 			if !ok {
 				vm.RunTimeError("draw() argument must be a camera")
 				return core.NIL_VALUE
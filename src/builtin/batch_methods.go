@@ -19,22 +19,22 @@ func RegisterAllBatchMethods(o *BatchObject) {
 			sizeVal := vm.Stack(arg_stackptr + 1)
 			colorVal := vm.Stack(arg_stackptr + 2)
 
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() first argument must be a vec3 (position)")
 				return core.NIL_VALUE
 			}
-			if sizeVal.Type != core.VAL_VEC3 {
+			if sizeVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() second argument must be a vec3 (size)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("add() third argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
-			pos := posVal.Obj.(*core.Vec3Object)
-			size := sizeVal.Obj.(*core.Vec3Object)
-			color := colorVal.Obj.(*core.Vec4Object)
+			pos := posVal.Obj().(*core.Vec3Object)
+			size := sizeVal.Obj().(*core.Vec3Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			index := o.Value.Add(pos, size, color)
 			return core.MakeIntValue(index, true)
@@ -59,27 +59,27 @@ func RegisterAllBatchMethods(o *BatchObject) {
 			p3Val := vm.Stack(arg_stackptr + 2)
 			colorVal := vm.Stack(arg_stackptr + 3)
 
-			if p1Val.Type != core.VAL_VEC3 {
+			if p1Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_triangle3() first argument must be a vec3 (point1)")
 				return core.NIL_VALUE
 			}
-			if p2Val.Type != core.VAL_VEC3 {
+			if p2Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_triangle3() second argument must be a vec3 (point2)")
 				return core.NIL_VALUE
 			}
-			if p3Val.Type != core.VAL_VEC3 {
+			if p3Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_triangle3() third argument must be a vec3 (point3)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("add_triangle3() fourth argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
-			p1 := p1Val.Obj.(*core.Vec3Object)
-			p2 := p2Val.Obj.(*core.Vec3Object)
-			p3 := p3Val.Obj.(*core.Vec3Object)
-			color := colorVal.Obj.(*core.Vec4Object)
+			p1 := p1Val.Obj().(*core.Vec3Object)
+			p2 := p2Val.Obj().(*core.Vec3Object)
+			p3 := p3Val.Obj().(*core.Vec3Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			index := o.Value.AddTriangle3(p1, p2, p3, color)
 			return core.MakeIntValue(index, true)
@@ -105,7 +105,7 @@ func RegisterAllBatchMethods(o *BatchObject) {
 			angleVal := vm.Stack(arg_stackptr + 3)
 			colorVal := vm.Stack(arg_stackptr + 4)
 
-			if centerVal.Type != core.VAL_VEC3 {
+			if centerVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_circle3() first argument must be a vec3 (center)")
 				return core.NIL_VALUE
 			}
@@ -113,7 +113,7 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("add_circle3() second argument must be a number (radius)")
 				return core.NIL_VALUE
 			}
-			if axisVal.Type != core.VAL_VEC3 {
+			if axisVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_circle3() third argument must be a vec3 (axis)")
 				return core.NIL_VALUE
 			}
@@ -121,14 +121,14 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("add_circle3() fourth argument must be a number (angle in degrees)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("add_circle3() fifth argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
-			center := centerVal.Obj.(*core.Vec3Object)
-			axis := axisVal.Obj.(*core.Vec3Object)
-			color := colorVal.Obj.(*core.Vec4Object)
+			center := centerVal.Obj().(*core.Vec3Object)
+			axis := axisVal.Obj().(*core.Vec3Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			index := o.Value.AddCircle3(center, radiusVal.AsFloat(), axis, angleVal.AsFloat(), color)
 			return core.MakeIntValue(index, true)
@@ -152,7 +152,7 @@ func RegisterAllBatchMethods(o *BatchObject) {
 			}
 
 			textureVal := vm.Stack(arg_stackptr)
-			to, ok := textureVal.Obj.(*TextureObject)
+			to, ok := textureVal.Obj().(*TextureObject)
 			if !ok {
 				vm.RunTimeError("set_circle_texture() argument must be a texture")
 				return core.NIL_VALUE
@@ -198,12 +198,12 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_circle3_full() radius must be a number")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_circle3_full() last argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
-			color := colorVal.Obj.(*core.Vec4Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 			err := o.Value.SetCircle3Full(indexVal.AsInt(),
 				xVal.AsFloat(), yVal.AsFloat(), zVal.AsFloat(),
 				radiusVal.AsFloat(), color)
@@ -235,12 +235,12 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_circle3_color() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_circle3_color() second argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
-			color := colorVal.Obj.(*core.Vec4Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 			if err := o.Value.SetCircle3Color(indexVal.AsInt(), color); err != nil {
 				vm.RunTimeError(err.Error())
 				return core.NIL_VALUE
@@ -319,13 +319,13 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_position() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_position() second argument must be a vec3 (position)")
 				return core.NIL_VALUE
 			}
 
 			index := indexVal.AsInt()
-			pos := posVal.Obj.(*core.Vec3Object)
+			pos := posVal.Obj().(*core.Vec3Object)
 
 			if err := o.Value.SetPosition(index, pos); err != nil {
 				vm.RunTimeError(err.Error())
@@ -350,13 +350,13 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_color() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_color() second argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
 			index := indexVal.AsInt()
-			color := colorVal.Obj.(*core.Vec4Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			if err := o.Value.SetColor(index, color); err != nil {
 				vm.RunTimeError(err.Error())
@@ -381,13 +381,13 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_size() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if sizeVal.Type != core.VAL_VEC3 {
+			if sizeVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_size() second argument must be a vec3 (size)")
 				return core.NIL_VALUE
 			}
 
 			index := indexVal.AsInt()
-			size := sizeVal.Obj.(*core.Vec3Object)
+			size := sizeVal.Obj().(*core.Vec3Object)
 
 			if err := o.Value.SetSize(index, size); err != nil {
 				vm.RunTimeError(err.Error())
@@ -493,11 +493,11 @@ func RegisterAllBatchMethods(o *BatchObject) {
 			maxDistVal := vm.Stack(arg_stackptr + 2)
 			fovVal := vm.Stack(arg_stackptr + 3)
 
-			if camPosVal.Type != core.VAL_VEC3 {
+			if camPosVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("draw_frustum_culled() first argument must be a vec3 (camera position)")
 				return core.NIL_VALUE
 			}
-			if camForwardVal.Type != core.VAL_VEC3 {
+			if camForwardVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("draw_frustum_culled() second argument must be a vec3 (camera forward direction)")
 				return core.NIL_VALUE
 			}
@@ -510,8 +510,8 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				return core.NIL_VALUE
 			}
 
-			camPos := camPosVal.Obj.(*core.Vec3Object)
-			camForward := camForwardVal.Obj.(*core.Vec3Object)
+			camPos := camPosVal.Obj().(*core.Vec3Object)
+			camForward := camForwardVal.Obj().(*core.Vec3Object)
 			maxDistance := float32(maxDistVal.AsFloat())
 			fovDegrees := float32(fovVal.AsFloat())
 
@@ -616,15 +616,15 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_triangle3() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if p1Val.Type != core.VAL_VEC3 {
+			if p1Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_triangle3() second argument must be a vec3 (point1)")
 				return core.NIL_VALUE
 			}
-			if p2Val.Type != core.VAL_VEC3 {
+			if p2Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_triangle3() third argument must be a vec3 (point2)")
 				return core.NIL_VALUE
 			}
-			if p3Val.Type != core.VAL_VEC3 {
+			if p3Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_triangle3() fourth argument must be a vec3 (point3)")
 				return core.NIL_VALUE
 			}
@@ -685,13 +685,13 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_triangle3_full() point3 coordinates must be numbers")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_triangle3_full() last argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
 			index := indexVal.AsInt()
-			color := colorVal.Obj.(*core.Vec4Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			err := o.Value.SetTriangle3Full(index,
 				x1Val.AsFloat(), y1Val.AsFloat(), z1Val.AsFloat(),
@@ -727,13 +727,13 @@ func RegisterAllBatchMethods(o *BatchObject) {
 				vm.RunTimeError("set_triangle3_color() first argument must be an integer (index)")
 				return core.NIL_VALUE
 			}
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_triangle3_color() second argument must be a vec4 (color)")
 				return core.NIL_VALUE
 			}
 
 			index := indexVal.AsInt()
-			color := colorVal.Obj.(*core.Vec4Object)
+			color := colorVal.Obj().(*core.Vec4Object)
 
 			if err := o.Value.SetTriangle3Color(index, color); err != nil {
 				vm.RunTimeError(err.Error())
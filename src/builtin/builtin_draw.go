@@ -56,7 +56,11 @@ func DrawPNGBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 				img.SetGray(x, y, color.Gray{Y: gray})
 			}
 		}
-		file, _ := os.Create(nameVal.AsString().Get())
+		file, err := vm.FileSystem().OpenFile(nameVal.AsString().Get(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			fileError(vm, "%v", err)
+			return core.NIL_VALUE
+		}
 		defer file.Close()
 		_ = png.Encode(file, img)
 	} else {
@@ -69,7 +73,11 @@ func DrawPNGBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 				img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: 255})
 			}
 		}
-		file, _ := os.Create(nameVal.AsString().Get())
+		file, err := vm.FileSystem().OpenFile(nameVal.AsString().Get(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			fileError(vm, "%v", err)
+			return core.NIL_VALUE
+		}
 		defer file.Close()
 		_ = png.Encode(file, img)
 	}
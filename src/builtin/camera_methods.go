@@ -14,11 +14,11 @@ func RegisterAllCameraMethods(c *CameraObject) {
 				return core.NIL_VALUE
 			}
 			posVal := vm.Stack(arg_stackptr)
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("Expected Vec3 for camera position")
 				return core.NIL_VALUE
 			}
-			posObj := posVal.Obj.(*core.Vec3Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
 			c.Camera.Position = rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)}
 			return core.NIL_VALUE
 		},
@@ -31,11 +31,11 @@ func RegisterAllCameraMethods(c *CameraObject) {
 				return core.NIL_VALUE
 			}
 			targetVal := vm.Stack(arg_stackptr)
-			if targetVal.Type != core.VAL_VEC3 {
+			if targetVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("Expected Vec3 for camera target")
 				return core.NIL_VALUE
 			}
-			targetObj := targetVal.Obj.(*core.Vec3Object)
+			targetObj := targetVal.Obj().(*core.Vec3Object)
 			c.Camera.Target = rl.Vector3{X: float32(targetObj.X), Y: float32(targetObj.Y), Z: float32(targetObj.Z)}
 			return core.NIL_VALUE
 		},
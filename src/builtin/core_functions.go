@@ -34,6 +34,30 @@ func ClockBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	return core.MakeFloatValue(float64(elapsed.Seconds()), false)
 }
 
+func MemoryUsageBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 0 {
+		vm.RunTimeError("Invalid argument count to memory_usage.")
+		return core.NIL_VALUE
+	}
+	return core.MakeIntValue(vm.MemoryUsage(), false)
+}
+
+func ReloadBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("sys.reload expects 1 argument")
+		return core.NIL_VALUE
+	}
+	arg := vm.Stack(arg_stackptr)
+	if !arg.IsObj() || arg.ObjType() != core.OBJECT_MODULE {
+		vm.RunTimeError("sys.reload argument must be a module")
+		return core.NIL_VALUE
+	}
+	if !vm.ReloadModule(arg.AsModule()) {
+		return core.NIL_VALUE
+	}
+	return arg
+}
+
 func TodayBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	return core.MakeStringObjectValue(time.Now().Format("2006-01-02"), false)
 }
@@ -49,13 +73,13 @@ func FloatBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 	arg := vm.Stack(arg_stackptr)
 
-	switch arg.Type {
+	switch arg.Type() {
 	case core.VAL_FLOAT:
 		return arg
 	case core.VAL_INT:
 		return core.MakeFloatValue(float64(arg.AsInt()), false)
 	case core.VAL_OBJ:
-		if arg.Obj.GetType() == core.OBJECT_STRING {
+		if arg.Obj().GetType() == core.OBJECT_STRING {
 			f, ok := arg.AsString().ParseFloat()
 			if !ok {
 				vm.RunTimeError("Could not parse string into float.")
@@ -75,13 +99,13 @@ func IntBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	}
 	arg := vm.Stack(arg_stackptr)
 
-	switch arg.Type {
+	switch arg.Type() {
 	case core.VAL_INT:
 		return arg
 	case core.VAL_FLOAT:
 		return core.MakeIntValue(int(arg.AsFloat()), false)
 	case core.VAL_OBJ:
-		if arg.Obj.GetType() == core.OBJECT_STRING {
+		if arg.Obj().GetType() == core.OBJECT_STRING {
 			i, ok := arg.AsString().ParseInt()
 			if !ok {
 				vm.RunTimeError("Could not parse string into int.")
@@ -104,11 +128,11 @@ func LenBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 		return core.NIL_VALUE
 	}
 	val := vm.Stack(arg_stackptr)
-	if val.Type != core.VAL_OBJ {
+	if !val.IsObj() {
 		vm.RunTimeError("Invalid argument type to len.")
 		return core.NIL_VALUE
 	}
-	switch val.Obj.GetType() {
+	switch val.Obj().GetType() {
 	case core.OBJECT_STRING:
 		s := val.AsString().Get()
 		return core.MakeIntValue(len(s), false)
@@ -126,18 +150,21 @@ func AppendBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 		return core.NIL_VALUE
 	}
 	val := vm.Stack(arg_stackptr)
-	if val.Type != core.VAL_OBJ {
+	if !val.IsObj() {
 		vm.RunTimeError("Argument 1 to append must be list.")
 		return core.NIL_VALUE
 	}
 	val2 := vm.Stack(arg_stackptr + 1)
-	switch val.Obj.GetType() {
+	switch val.Obj().GetType() {
 	case core.OBJECT_LIST:
 		l := val.AsList()
 		if l.Tuple {
 			vm.RunTimeError("Tuples are immutable")
 			return core.NIL_VALUE
 		}
+		if !vm.Charge(core.ValueSize) {
+			return core.NIL_VALUE
+		}
 		l.Append(val2)
 		return core.MakeObjectValue(l, false)
 	}
@@ -154,13 +181,17 @@ func ReplaceBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	from := vm.Stack(arg_stackptr + 1)
 	to := vm.Stack(arg_stackptr + 2)
 
-	if target.Type != core.VAL_OBJ || target.Obj.GetType() != core.OBJECT_STRING {
+	if !target.IsObj() || target.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to replace.")
 		return core.NIL_VALUE
 	}
 
 	s := target.AsString()
-	return s.Replace(from, to)
+	rv := s.Replace(from, to)
+	if rv.IsStringObject() && !vm.Charge(core.StringSize+len(rv.AsString().Get())) {
+		return core.NIL_VALUE
+	}
+	return rv
 }
 
 func FormatBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
@@ -170,7 +201,7 @@ func FormatBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	templateVal := vm.Stack(arg_stackptr)
-	if templateVal.Type != core.VAL_OBJ || templateVal.Obj.GetType() != core.OBJECT_STRING {
+	if !templateVal.IsObj() || templateVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("format template must be a string")
 		return core.NIL_VALUE
 	}
@@ -185,6 +216,9 @@ func FormatBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	result := fmt.Sprintf(template, goArgs...)
+	if !vm.Charge(core.StringSize + len(result)) {
+		return core.NIL_VALUE
+	}
 	return core.MakeStringObjectValue(result, true)
 }
 
@@ -241,27 +275,27 @@ func RangeBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 
 // Helper function to convert Lox value to Go interface for fmt.Sprintf
 func valueToGoInterface(val core.Value) interface{} {
-	switch val.Type {
+	switch val.Type() {
 	case core.VAL_INT:
 		return val.AsInt()
 	case core.VAL_FLOAT:
 		return val.AsFloat()
 	case core.VAL_BOOL:
-		return val.Data != 0
+		return val.Data() != 0
 	case core.VAL_NIL:
 		return nil
 	case core.VAL_OBJ:
-		if val.Obj.GetType() == core.OBJECT_STRING {
+		if val.Obj().GetType() == core.OBJECT_STRING {
 			return val.AsString().Get()
 		}
-		return fmt.Sprintf("%v", val.Obj)
+		return fmt.Sprintf("%v", val.Obj())
 	}
 	return fmt.Sprintf("%v", val)
 }
 
 func typeName(val core.Value) string {
 	var val_type string
-	switch val.Type {
+	switch val.Type() {
 	case core.VAL_INT:
 		val_type = "int"
 	case core.VAL_FLOAT:
@@ -269,7 +303,7 @@ func typeName(val core.Value) string {
 	case core.VAL_BOOL:
 		val_type = "boolean"
 	case core.VAL_OBJ:
-		switch val.Obj.GetType() {
+		switch val.Obj().GetType() {
 		case core.OBJECT_STRING:
 			val_type = "string"
 		case core.OBJECT_FUNCTION:
@@ -358,11 +392,12 @@ func DumpFrameBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Va
 	if funcName == "" {
 		funcName = "<script>"
 	}
-	fmt.Println("=====================================================")
-	fmt.Printf("Frame: %s (ip=%d)\n", funcName, ip)
-	fmt.Printf("Stack: \n%s\n", vm.ShowStack())
-	fmt.Printf("Globals: %s\n", debug.ShowGlobals(vm.GetGlobals()))
-	fmt.Println("=====================================================")
+	out := vm.StdFile(core.STDOUT)
+	out.WriteString("=====================================================\n")
+	out.WriteString(fmt.Sprintf("Frame: %s (ip=%d)\n", funcName, ip))
+	out.WriteString(fmt.Sprintf("Stack: \n%s\n", vm.ShowStack()))
+	out.WriteString(fmt.Sprintf("Globals: %s\n", debug.ShowGlobals(vm.GetGlobals())))
+	out.WriteString("=====================================================\n")
 
 	// Optionally print upvalues, source line, etc.
 	return core.NIL_VALUE
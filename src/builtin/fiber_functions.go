@@ -0,0 +1,107 @@
+package builtin
+
+import "glox/src/core"
+
+// FiberSpawnBuiltIn implements fiber.spawn(): it schedules a call of fn,
+// with the extra arguments, as a fiber on this VM, to start at the next
+// fiber.tick(). Unlike thread.spawn() nothing is copied -- a fiber shares
+// everything with the script, as it never runs at the same time as it.
+func FiberSpawnBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount < 1 {
+		vm.RunTimeError("spawn() requires at least 1 argument (a function).")
+		return core.NIL_VALUE
+	}
+
+	callee := vm.Stack(arg_stackptr)
+	args := make([]core.Value, 0, argCount-1)
+	for i := 1; i < argCount; i++ {
+		args = append(args, vm.Stack(arg_stackptr+i))
+	}
+
+	f, err := vm.SpawnFiber(callee, args)
+	if err != nil {
+		vm.RunTimeErrorNamed("FiberError", "%v", err)
+		return core.NIL_VALUE
+	}
+
+	fiberObj := newFiberObject(f)
+	RegisterAllFiberMethods(fiberObj)
+	return core.MakeObjectValue(fiberObj, true)
+}
+
+// FiberYieldBuiltIn implements fiber.yield(): the running fiber gives way
+// until the next tick.
+func FiberYieldBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 0 {
+		vm.RunTimeError("yield() expects no arguments.")
+		return core.NIL_VALUE
+	}
+	vm.SuspendFiber(0, argCount)
+	return core.NIL_VALUE
+}
+
+// FiberSleepBuiltIn implements fiber.sleep(t): the running fiber gives way
+// until the first tick at which t more seconds have passed on the
+// scheduler's clock. Only the fiber waits; the script and the other fibers
+// go on.
+func FiberSleepBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("sleep() expects 1 argument.")
+		return core.NIL_VALUE
+	}
+	tVal := vm.Stack(arg_stackptr)
+	if !tVal.IsNumber() {
+		vm.RunTimeError("sleep() argument must be a number.")
+		return core.NIL_VALUE
+	}
+	var seconds float64
+	if tVal.IsInt() {
+		seconds = float64(tVal.AsInt())
+	} else {
+		seconds = tVal.AsFloat()
+	}
+	vm.SuspendFiber(seconds, argCount)
+	return core.NIL_VALUE
+}
+
+// FiberTickBuiltIn implements fiber.tick(dt): it advances the scheduler's
+// clock by dt seconds and runs each fiber that is due until it yields,
+// sleeps or finishes, returning how many fibers are left. Called once per
+// frame from a game loop, with the frame time, it drives the fibers along
+// with it.
+func FiberTickBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount > 1 {
+		vm.RunTimeError("tick() expects at most 1 argument.")
+		return core.NIL_VALUE
+	}
+	dt := 0.0
+	if argCount == 1 {
+		dtVal := vm.Stack(arg_stackptr)
+		if !dtVal.IsNumber() {
+			vm.RunTimeError("tick() argument must be a number.")
+			return core.NIL_VALUE
+		}
+		if dtVal.IsInt() {
+			dt = float64(dtVal.AsInt())
+		} else {
+			dt = dtVal.AsFloat()
+		}
+	}
+	n, ok := vm.TickFibers(dt)
+	if !ok {
+		return core.NIL_VALUE
+	}
+	return core.MakeIntValue(n, false)
+}
+
+// FiberRunBuiltIn implements fiber.run(): it ticks the scheduler in real
+// time until every fiber has finished, for scripts without a frame loop of
+// their own.
+func FiberRunBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 0 {
+		vm.RunTimeError("run() expects no arguments.")
+		return core.NIL_VALUE
+	}
+	vm.RunFibers()
+	return core.NIL_VALUE
+}
@@ -0,0 +1,53 @@
+package builtin
+
+import "glox/src/core"
+
+// RegisterAllFiberMethods wires up the Fiber object's Lox-visible methods
+// (done/result/cancel).
+func RegisterAllFiberMethods(o *FiberObject) {
+
+	o.RegisterMethod("done", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("done() expects no arguments")
+				return core.NIL_VALUE
+			}
+			return core.MakeBooleanValue(o.Fiber.Done || o.Fiber.Cancelled, false)
+		},
+	})
+
+	o.RegisterMethod("result", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("result() expects no arguments")
+				return core.NIL_VALUE
+			}
+			switch {
+			case o.Fiber.Cancelled:
+				vm.RunTimeErrorNamed("FiberError", "fiber was cancelled")
+			case !o.Fiber.Done:
+				vm.RunTimeErrorNamed("FiberError", "fiber hasn't finished")
+			case o.Fiber.Err != nil:
+				vm.RunTimeErrorNamed("FiberError", "%v", o.Fiber.Err)
+			default:
+				return o.Fiber.Result
+			}
+			return core.NIL_VALUE
+		},
+	})
+
+	// cancel stops a fiber that hasn't finished: it won't be run again. A
+	// fiber cancelling itself runs on until it next yields or sleeps.
+	o.RegisterMethod("cancel", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("cancel() expects no arguments")
+				return core.NIL_VALUE
+			}
+			if !o.Fiber.Done {
+				o.Fiber.Cancelled = true
+			}
+			return core.NIL_VALUE
+		},
+	})
+}
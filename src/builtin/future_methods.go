@@ -0,0 +1,65 @@
+package builtin
+
+import "glox/src/core"
+
+// RegisterAllFutureMethods wires up the Task/Future object's Lox-visible
+// methods (done/result/cancelled/cancel).
+func RegisterAllFutureMethods(o *FutureObject) {
+
+	o.RegisterMethod("done", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("done() expects no arguments")
+				return core.NIL_VALUE
+			}
+			return core.MakeBooleanValue(o.Future.Done, false)
+		},
+	})
+
+	// result returns what the task returned, or raises what it raised.
+	o.RegisterMethod("result", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("result() expects no arguments")
+				return core.NIL_VALUE
+			}
+			switch {
+			case !o.Future.Done:
+				vm.RunTimeError("%s hasn't finished", o.Name)
+			case o.Future.Exception != nil:
+				vm.RunTimeErrorInstance(o.Future.Exception)
+			default:
+				return o.Future.Result
+			}
+			return core.NIL_VALUE
+		},
+	})
+
+	o.RegisterMethod("cancelled", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("cancelled() expects no arguments")
+				return core.NIL_VALUE
+			}
+			return core.MakeBooleanValue(o.Future.Cancelled, false)
+		},
+	})
+
+	// cancel has CancelledError raised in a task, where it awaits; a
+	// future is cancelled at once. It returns false if it was already done.
+	o.RegisterMethod("cancel", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("cancel() expects no arguments")
+				return core.NIL_VALUE
+			}
+			if o.Future.Done {
+				return core.MakeBooleanValue(false, false)
+			}
+			if o.Future.Cancel != nil {
+				o.Future.Cancel()
+			}
+			return core.MakeBooleanValue(true, false)
+		},
+	})
+}
@@ -14,7 +14,7 @@ func SinBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	}
 	vnum := vm.Stack(arg_stackptr)
 
-	if vnum.Type != core.VAL_FLOAT {
+	if !vnum.IsFloat() {
 		vm.RunTimeError("Invalid argument type to sin.")
 		return core.NIL_VALUE
 	}
@@ -29,7 +29,7 @@ func CosBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	}
 	vnum := vm.Stack(arg_stackptr)
 
-	if vnum.Type != core.VAL_FLOAT {
+	if !vnum.IsFloat() {
 		vm.RunTimeError("Invalid argument type to cos.")
 		return core.NIL_VALUE
 	}
@@ -44,7 +44,7 @@ func TanBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	}
 	vnum := vm.Stack(arg_stackptr)
 
-	if vnum.Type != core.VAL_FLOAT {
+	if !vnum.IsFloat() {
 		vm.RunTimeError("Invalid argument type to tan.")
 		return core.NIL_VALUE
 	}
@@ -59,7 +59,7 @@ func SqrtBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	}
 	vnum := vm.Stack(arg_stackptr)
 
-	if vnum.Type != core.VAL_FLOAT {
+	if !vnum.IsFloat() {
 		vm.RunTimeError("Invalid argument type to sqrt.")
 		return core.NIL_VALUE
 	}
@@ -75,7 +75,7 @@ func PowBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	vbase := vm.Stack(arg_stackptr)
 	vexp := vm.Stack(arg_stackptr + 1)
 
-	if vbase.Type != core.VAL_FLOAT || vexp.Type != core.VAL_FLOAT {
+	if !vbase.IsFloat() || !vexp.IsFloat() {
 		vm.RunTimeError("Invalid argument type to pow.")
 		return core.NIL_VALUE
 	}
@@ -91,7 +91,7 @@ func Atan2BuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	vnum1 := vm.Stack(arg_stackptr)
 	vnum2 := vm.Stack(arg_stackptr + 1)
 
-	if vnum1.Type != core.VAL_FLOAT || vnum2.Type != core.VAL_FLOAT {
+	if !vnum1.IsFloat() || !vnum2.IsFloat() {
 		vm.RunTimeError("Invalid argument type to atan2.")
 		return core.NIL_VALUE
 	}
@@ -159,12 +159,12 @@ func (o *BatchObject) IsBuiltIn() bool {
 
 // Utility functions
 func IsBatchObject(v core.Value) bool {
-	_, ok := v.Obj.(*BatchObject)
+	_, ok := v.Obj().(*BatchObject)
 	return ok
 }
 
 func AsBatch(v core.Value) *BatchObject {
-	return v.Obj.(*BatchObject)
+	return v.Obj().(*BatchObject)
 }
 
 // Core batch operations (internal methods)
@@ -60,7 +60,7 @@ func BatchInstancedBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) co
 		vm.RunTimeError("BatchInstancedBuiltIn: expected texture2D, got %s", textureVal.String())
 		return core.NIL_VALUE
 	}
-	to, ok := textureVal.Obj.(*TextureObject)
+	to, ok := textureVal.Obj().(*TextureObject)
 	if !ok {
 		vm.RunTimeError("BatchInstancedBuiltIn: expected texture2D, got %s", textureVal.String())
 		return core.NIL_VALUE
@@ -129,12 +129,12 @@ func (o *BatchInstancedObject) IsBuiltIn() bool {
 
 // Utility functions
 func IsBatchInstancedObject(v core.Value) bool {
-	_, ok := v.Obj.(*BatchInstancedObject)
+	_, ok := v.Obj().(*BatchInstancedObject)
 	return ok
 }
 
 func AsBatchInstanced(v core.Value) *BatchInstancedObject {
-	return v.Obj.(*BatchInstancedObject)
+	return v.Obj().(*BatchInstancedObject)
 }
 
 func InitShader() *rl.Shader {
@@ -16,14 +16,14 @@ func CameraBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	targetVal := vm.Stack(arg_stackptr + 1)
 	upVal := vm.Stack(arg_stackptr + 2)
 
-	if posVal.Type != core.VAL_VEC3 || targetVal.Type != core.VAL_VEC3 || upVal.Type != core.VAL_VEC3 {
+	if posVal.Type() != core.VAL_VEC3 || targetVal.Type() != core.VAL_VEC3 || upVal.Type() != core.VAL_VEC3 {
 		vm.RunTimeError("camera arguments must be vec3")
 		return core.NIL_VALUE
 	}
 
-	posObj := posVal.Obj.(*core.Vec3Object)
-	targetObj := targetVal.Obj.(*core.Vec3Object)
-	upObj := upVal.Obj.(*core.Vec3Object)
+	posObj := posVal.Obj().(*core.Vec3Object)
+	targetObj := targetVal.Obj().(*core.Vec3Object)
+	upObj := upVal.Obj().(*core.Vec3Object)
 
 	camera := rl.Camera3D{
 		Position:   rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)},
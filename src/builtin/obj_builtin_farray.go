@@ -3,6 +3,7 @@ package builtin
 import (
 	"fmt"
 	"glox/src/core"
+	"math"
 )
 
 func FloatArrayBuiltin(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
@@ -19,13 +20,22 @@ func FloatArrayBuiltin(argCount int, arg_stackptr int, vm core.VMContext) core.V
 	}
 	width := widthval.AsInt()
 	height := heightval.AsInt()
+	if width > 0 && height > 0 {
+		size := math.MaxInt
+		if height <= size/8/width {
+			size = 8 * width * height
+		}
+		if !vm.Charge(size) {
+			return core.NIL_VALUE
+		}
+	}
 	floatArrObj := MakeFloatArrayObject(width, height)
 	RegisterAllFloatArrayMethods(floatArrObj)
 	return core.MakeObjectValue(floatArrObj, false)
 }
 
 func IsFloatArrayObject(v core.Value) bool {
-	_, ok := v.Obj.(*FloatArrayObject)
+	_, ok := v.Obj().(*FloatArrayObject)
 	return ok
 }
 
@@ -68,13 +78,18 @@ func MakeFloatArrayObject(w int, h int) *FloatArrayObject {
 	}
 }
 
+// HeapSize is the size of o's floats, for the memory limit.
+func (o *FloatArrayObject) HeapSize() int {
+	return 8 * len(o.Value.Data)
+}
+
 func (o *FloatArrayObject) GetMethod(stringId int) *core.BuiltInObject {
 	return o.Methods[stringId]
 }
 
 func AsFloatArray(v core.Value) *FloatArrayObject {
 
-	return v.Obj.(*FloatArrayObject)
+	return v.Obj().(*FloatArrayObject)
 }
 
 func (o *FloatArrayObject) String() string {
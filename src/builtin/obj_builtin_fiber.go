@@ -0,0 +1,42 @@
+package builtin
+
+import "glox/src/core"
+
+// FiberObject is the handle returned by fiber.spawn(), exposing
+// done/result/cancel. The fiber itself belongs to the VM's scheduler.
+type FiberObject struct {
+	core.BuiltInObject
+	Fiber   *core.Fiber
+	Methods map[int]*core.BuiltInObject
+}
+
+func newFiberObject(f *core.Fiber) *FiberObject {
+	return &FiberObject{Fiber: f}
+}
+
+func (o *FiberObject) String() string {
+	return "<fiber>"
+}
+
+func (o *FiberObject) GetType() core.ObjectType {
+	return core.OBJECT_NATIVE
+}
+
+func (o *FiberObject) GetNativeType() core.NativeType {
+	return core.NATIVE_FIBER
+}
+
+func (o *FiberObject) GetMethod(stringId int) *core.BuiltInObject {
+	return o.Methods[stringId]
+}
+
+func (o *FiberObject) RegisterMethod(name string, method *core.BuiltInObject) {
+	if o.Methods == nil {
+		o.Methods = make(map[int]*core.BuiltInObject)
+	}
+	o.Methods[core.InternName(name)] = method
+}
+
+func (o *FiberObject) IsBuiltIn() bool {
+	return true
+}
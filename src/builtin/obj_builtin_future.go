@@ -0,0 +1,51 @@
+package builtin
+
+import "glox/src/core"
+
+// FutureObject is a task, as calling an async function returns, or a
+// future, as asyncio.sleep() and co return: something await accepts,
+// exposing done/result/cancelled/cancel. The event loop settles it.
+type FutureObject struct {
+	core.BuiltInObject
+	Future  *core.Future
+	Name    string // what it prints as
+	Methods map[int]*core.BuiltInObject
+}
+
+// MakeFutureObject makes the object standing for f, with its methods.
+func MakeFutureObject(f *core.Future, name string) *FutureObject {
+	o := &FutureObject{Future: f, Name: name}
+	RegisterAllFutureMethods(o)
+	return o
+}
+
+func (o *FutureObject) String() string {
+	return "<" + o.Name + ">"
+}
+
+func (o *FutureObject) GetType() core.ObjectType {
+	return core.OBJECT_NATIVE
+}
+
+func (o *FutureObject) GetNativeType() core.NativeType {
+	return core.NATIVE_FUTURE
+}
+
+func (o *FutureObject) GetMethod(stringId int) *core.BuiltInObject {
+	return o.Methods[stringId]
+}
+
+func (o *FutureObject) RegisterMethod(name string, method *core.BuiltInObject) {
+	if o.Methods == nil {
+		o.Methods = make(map[int]*core.BuiltInObject)
+	}
+	o.Methods[core.InternName(name)] = method
+}
+
+func (o *FutureObject) IsBuiltIn() bool {
+	return true
+}
+
+func (o *FutureObject) Awaitable() *core.Future {
+	return o.Future
+}
@@ -19,11 +19,11 @@ func PhysicsWorldBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core
 	cellSizeVal := vm.Stack(arg_stackptr + 2)
 	gravityVal := vm.Stack(arg_stackptr + 3)
 
-	if minVal.Type != core.VAL_VEC3 {
+	if minVal.Type() != core.VAL_VEC3 {
 		vm.RunTimeError("physics_world() first argument must be a vec3 (bounds min)")
 		return core.NIL_VALUE
 	}
-	if maxVal.Type != core.VAL_VEC3 {
+	if maxVal.Type() != core.VAL_VEC3 {
 		vm.RunTimeError("physics_world() second argument must be a vec3 (bounds max)")
 		return core.NIL_VALUE
 	}
@@ -31,14 +31,14 @@ func PhysicsWorldBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core
 		vm.RunTimeError("physics_world() third argument must be a number (cell_size)")
 		return core.NIL_VALUE
 	}
-	if gravityVal.Type != core.VAL_VEC3 {
+	if gravityVal.Type() != core.VAL_VEC3 {
 		vm.RunTimeError("physics_world() fourth argument must be a vec3 (gravity)")
 		return core.NIL_VALUE
 	}
 
-	min := minVal.Obj.(*core.Vec3Object)
-	max := maxVal.Obj.(*core.Vec3Object)
-	gravity := gravityVal.Obj.(*core.Vec3Object)
+	min := minVal.Obj().(*core.Vec3Object)
+	max := maxVal.Obj().(*core.Vec3Object)
+	gravity := gravityVal.Obj().(*core.Vec3Object)
 
 	worldObj := MakePhysicsWorldObject(
 		PVec3{min.X, min.Y, min.Z},
@@ -16,7 +16,7 @@ func RenderTextureBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) cor
 	widthVal := vm.Stack(arg_stackptr)
 	heightVal := vm.Stack(arg_stackptr + 1)
 
-	if widthVal.Type != core.VAL_INT || heightVal.Type != core.VAL_INT {
+	if !widthVal.IsInt() || !heightVal.IsInt() {
 		vm.RunTimeError("render_texture arguments must be integers")
 		return core.NIL_VALUE
 	}
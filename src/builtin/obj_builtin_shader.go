@@ -153,13 +153,13 @@ func RegisterAllShaderMethods(o *ShaderObject) {
 			locVal := vm.Stack(arg_stackptr)
 			vec2Val := vm.Stack(arg_stackptr + 1)
 
-			if !locVal.IsInt() || vec2Val.Type != core.VAL_VEC2 {
+			if !locVal.IsInt() || vec2Val.Type() != core.VAL_VEC2 {
 				vm.RunTimeError("set_value_vec2 expects int location and vec2 value")
 				return core.NIL_VALUE
 			}
 
 			location := int32(locVal.AsInt())
-			vec2Obj := vec2Val.Obj.(*core.Vec2Object)
+			vec2Obj := vec2Val.Obj().(*core.Vec2Object)
 			values := []float32{float32(vec2Obj.X), float32(vec2Obj.Y)}
 
 			rl.SetShaderValue(o.Value, location, values, rl.ShaderUniformVec2)
@@ -177,13 +177,13 @@ func RegisterAllShaderMethods(o *ShaderObject) {
 			locVal := vm.Stack(arg_stackptr)
 			vec3Val := vm.Stack(arg_stackptr + 1)
 
-			if !locVal.IsInt() || vec3Val.Type != core.VAL_VEC3 {
+			if !locVal.IsInt() || vec3Val.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("set_value_vec3 expects int location and vec3 value")
 				return core.NIL_VALUE
 			}
 
 			location := int32(locVal.AsInt())
-			vec3Obj := vec3Val.Obj.(*core.Vec3Object)
+			vec3Obj := vec3Val.Obj().(*core.Vec3Object)
 			values := []float32{float32(vec3Obj.X), float32(vec3Obj.Y), float32(vec3Obj.Z)}
 
 			rl.SetShaderValue(o.Value, location, values, rl.ShaderUniformVec3)
@@ -201,13 +201,13 @@ func RegisterAllShaderMethods(o *ShaderObject) {
 			locVal := vm.Stack(arg_stackptr)
 			vec4Val := vm.Stack(arg_stackptr + 1)
 
-			if !locVal.IsInt() || vec4Val.Type != core.VAL_VEC4 {
+			if !locVal.IsInt() || vec4Val.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("set_value_vec4 expects int location and vec4 value")
 				return core.NIL_VALUE
 			}
 
 			location := int32(locVal.AsInt())
-			vec4Obj := vec4Val.Obj.(*core.Vec4Object)
+			vec4Obj := vec4Val.Obj().(*core.Vec4Object)
 			values := []float32{float32(vec4Obj.X), float32(vec4Obj.Y), float32(vec4Obj.Z), float32(vec4Obj.W)}
 
 			rl.SetShaderValue(o.Value, location, values, rl.ShaderUniformVec4)
@@ -24,7 +24,7 @@ func TextureBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	endFrameVal := vm.Stack(arg_stackptr + 3)
 
 	var to *ImageObject
-	to, ok := imgVal.Obj.(*ImageObject)
+	to, ok := imgVal.Obj().(*ImageObject)
 	if !ok {
 		vm.RunTimeError("texture argument must be an image object")
 		return core.NIL_VALUE
@@ -1,6 +1,10 @@
 package builtin
 
-import "glox/src/core"
+import (
+	"sync/atomic"
+
+	"glox/src/core"
+)
 
 // ThreadObject is the parent-side handle returned by thread.spawn() --
 // the "I spawned this thread" view, exposing send/recv/wait/cancel.
@@ -91,3 +95,94 @@ func (o *ThreadChannelObject) RegisterMethod(name string, method *core.BuiltInOb
 func (o *ThreadChannelObject) IsBuiltIn() bool {
 	return true
 }
+
+// ChannelObject is a standalone channel made by thread.Channel(capacity),
+// not tied to any one spawn: any number of threads it is handed to -- it
+// is shared, not copied, by thread.spawn() -- can send and receive on it,
+// exposing send/recv/try_recv/close.
+type ChannelObject struct {
+	core.BuiltInObject
+	Ch      chan core.Value
+	Methods map[int]*core.BuiltInObject
+
+	// closed is set by close(), so a send can be refused up front, and
+	// done is closed with it. Ch itself never is: a sender already blocked
+	// when the channel closes wakes on done instead, and a receiver that
+	// sees done takes what is still buffered in Ch first.
+	closed atomic.Bool
+	done   chan struct{}
+}
+
+func newChannelObject(capacity int) *ChannelObject {
+	return &ChannelObject{Ch: make(chan core.Value, capacity), done: make(chan struct{})}
+}
+
+func (o *ChannelObject) String() string {
+	return "<channel>"
+}
+
+func (o *ChannelObject) GetType() core.ObjectType {
+	return core.OBJECT_NATIVE
+}
+
+func (o *ChannelObject) GetNativeType() core.NativeType {
+	return core.NATIVE_CHANNEL
+}
+
+func (o *ChannelObject) GetMethod(stringId int) *core.BuiltInObject {
+	return o.Methods[stringId]
+}
+
+func (o *ChannelObject) RegisterMethod(name string, method *core.BuiltInObject) {
+	if o.Methods == nil {
+		o.Methods = make(map[int]*core.BuiltInObject)
+	}
+	o.Methods[core.InternName(name)] = method
+}
+
+func (o *ChannelObject) IsBuiltIn() bool {
+	return true
+}
+
+// sendValue sends val, blocking while the channel is full, and reports
+// false if the channel is or becomes closed.
+func (o *ChannelObject) sendValue(val core.Value) bool {
+	if o.closed.Load() {
+		return false
+	}
+	select {
+	case o.Ch <- val:
+		return true
+	case <-o.done:
+		return false
+	}
+}
+
+// recvValue receives a value, blocking while the channel is empty, and
+// reports false once it is closed and nothing sent before is left.
+func (o *ChannelObject) recvValue() (core.Value, bool) {
+	select {
+	case val := <-o.Ch:
+		return val, true
+	case <-o.done:
+		return o.drain()
+	}
+}
+
+// drain takes a value still buffered in the channel without blocking,
+// reporting false if there is none.
+func (o *ChannelObject) drain() (core.Value, bool) {
+	select {
+	case val := <-o.Ch:
+		return val, true
+	default:
+		return core.NIL_VALUE, false
+	}
+}
+
+// close closes the channel, if it isn't already.
+func (o *ChannelObject) close() {
+	if o.closed.CompareAndSwap(false, true) {
+		close(o.done)
+	}
+}
@@ -1,9 +1,12 @@
 package builtin
 
 import (
+	"errors"
 	"fmt"
 	"glox/src/core"
 	"glox/src/util"
+	"io"
+	"io/fs"
 	"os"
 	"strings"
 )
@@ -18,17 +21,17 @@ func OpenBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	path := vm.Stack(arg_stackptr)
 	mode := vm.Stack(arg_stackptr + 1)
 
-	if path.Type != core.VAL_OBJ || path.Obj.GetType() != core.OBJECT_STRING ||
-		mode.Type != core.VAL_OBJ || mode.Obj.GetType() != core.OBJECT_STRING {
+	if !path.IsObj() || path.Obj().GetType() != core.OBJECT_STRING ||
+		!mode.IsObj() || mode.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to open.")
 		return core.NIL_VALUE
 	}
 
 	s_path := path.AsString().Get()
 	s_mode := mode.AsString().Get()
-	fp, err := openFile(s_path, s_mode)
+	fp, err := openFile(vm.FileSystem(), s_path, s_mode)
 	if err != nil {
-		vm.RunTimeError("%v", err)
+		fileError(vm, "%v", err)
 		return core.NIL_VALUE
 	}
 	file := core.MakeObjectValue(core.MakeFileObject(fp), true)
@@ -42,12 +45,12 @@ func CloseBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 	fov := vm.Stack(arg_stackptr)
 
-	if fov.Type != core.VAL_OBJ || fov.Obj.GetType() != core.OBJECT_FILE {
+	if !fov.IsObj() || fov.Obj().GetType() != core.OBJECT_FILE {
 		vm.RunTimeError("Invalid argument type to close.")
 		return core.NIL_VALUE
 	}
 
-	fo := fov.Obj.(*core.FileObject)
+	fo := vm.ResolveFile(fov.Obj().(*core.FileObject))
 	fo.Close()
 	return core.MakeBooleanValue(true, false)
 }
@@ -59,19 +62,19 @@ func ReadlnBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 	fov := vm.Stack(arg_stackptr)
 
-	if fov.Type != core.VAL_OBJ || fov.Obj.GetType() != core.OBJECT_FILE {
+	if !fov.IsObj() || fov.Obj().GetType() != core.OBJECT_FILE {
 		vm.RunTimeError("Invalid argument type to readln.")
 		return core.NIL_VALUE
 	}
 
-	fo := fov.Obj.(*core.FileObject)
+	fo := vm.ResolveFile(fov.Obj().(*core.FileObject))
 	if fo.Closed {
 		vm.RunTimeError("readln attempted on closed file.")
 		return core.NIL_VALUE
 	}
 
 	rv := fo.ReadLine()
-	if rv.Type == core.VAL_NIL {
+	if rv.IsNil() {
 		vm.RunTimeErrorNamed("EOFError", "End of file reached")
 		return core.MakeBooleanValue(true, false)
 	}
@@ -86,16 +89,16 @@ func WriteBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	fov := vm.Stack(arg_stackptr)
 	str := vm.Stack(arg_stackptr + 1)
 
-	if fov.Type != core.VAL_OBJ || fov.Obj.GetType() != core.OBJECT_FILE {
+	if !fov.IsObj() || fov.Obj().GetType() != core.OBJECT_FILE {
 		vm.RunTimeError("Invalid argument type to writeln.")
 		return core.NIL_VALUE
 	}
-	if str.Type != core.VAL_OBJ || str.Obj.GetType() != core.OBJECT_STRING {
+	if !str.IsObj() || str.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to writeln.")
 		return core.NIL_VALUE
 	}
 
-	fo := fov.Obj.(*core.FileObject)
+	fo := vm.ResolveFile(fov.Obj().(*core.FileObject))
 	if fo.Closed {
 		vm.RunTimeError("writeln attempted on closed file.")
 		return core.NIL_VALUE
@@ -105,6 +108,37 @@ func WriteBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	return core.MakeBooleanValue(true, false)
 }
 
+// BufferBuiltIn makes an in-memory file: what is written to it can be read
+// back with readln, or all at once with getvalue. Assigned to sys.stdout,
+// it captures what the script prints.
+func BufferBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 0 {
+		vm.RunTimeError("Invalid argument count to buffer.")
+		return core.NIL_VALUE
+	}
+	return core.MakeObjectValue(core.MakeBufferFileObject(), true)
+}
+
+// GetvalueBuiltIn returns everything written to a buffer and not yet read.
+func GetvalueBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 {
+		vm.RunTimeError("Invalid argument count to getvalue.")
+		return core.NIL_VALUE
+	}
+	fov := vm.Stack(arg_stackptr)
+
+	if !fov.IsObj() || fov.Obj().GetType() != core.OBJECT_FILE {
+		vm.RunTimeError("Invalid argument type to getvalue.")
+		return core.NIL_VALUE
+	}
+	contents, ok := vm.ResolveFile(fov.Obj().(*core.FileObject)).Contents()
+	if !ok {
+		vm.RunTimeError("getvalue expects a buffer from os.buffer().")
+		return core.NIL_VALUE
+	}
+	return core.MakeStringObjectValue(contents, false)
+}
+
 // ReadAllBuiltIn reads an entire file at path and returns its contents as a
 // single string. Reports errors via vm.RunTimeError (like every other
 // builtin here) rather than raising an exception directly from within the
@@ -116,16 +150,25 @@ func ReadAllBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	}
 	path := vm.Stack(arg_stackptr)
 
-	if path.Type != core.VAL_OBJ || path.Obj.GetType() != core.OBJECT_STRING {
+	if !path.IsObj() || path.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to read_all.")
 		return core.NIL_VALUE
 	}
 
-	data, err := os.ReadFile(path.AsString().Get())
+	fp, err := vm.FileSystem().OpenFile(path.AsString().Get(), os.O_RDONLY, 0)
+	if err != nil {
+		fileError(vm, "%v", err)
+		return core.NIL_VALUE
+	}
+	defer fp.Close()
+	data, err := io.ReadAll(fp)
 	if err != nil {
 		vm.RunTimeError("%v", err)
 		return core.NIL_VALUE
 	}
+	if !vm.Charge(core.StringSize + len(data)) {
+		return core.NIL_VALUE
+	}
 	return core.MakeStringObjectValue(string(data), false)
 }
 
@@ -178,15 +221,15 @@ func ListdirBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to listdir, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	entries, err := os.ReadDir(path)
+	entries, err := vm.FileSystem().ReadDir(path)
 	if err != nil {
-		vm.RunTimeError("Failed to read directory '%s': %v", path, err)
+		fileError(vm, "Failed to read directory '%s': %v", path, err)
 		return core.NIL_VALUE
 	}
 	// Create a list of filenames
@@ -207,13 +250,13 @@ func IsdirBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to isdir, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	info, err := os.Stat(path)
+	info, err := vm.FileSystem().Stat(path)
 	if err != nil {
 		return core.MakeBooleanValue(false, false)
 	}
@@ -228,13 +271,13 @@ func IsfileBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to isfile, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	info, err := os.Stat(path)
+	info, err := vm.FileSystem().Stat(path)
 	if err != nil {
 		return core.MakeBooleanValue(false, false)
 	}
@@ -249,13 +292,13 @@ func ExistsBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to exists, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	_, err := os.Stat(path)
+	_, err := vm.FileSystem().Stat(path)
 	return core.MakeBooleanValue(err == nil, false)
 }
 
@@ -266,15 +309,15 @@ func MkdirBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to mkdir, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	err := os.MkdirAll(path, 0755)
+	err := vm.FileSystem().MkdirAll(path, 0755)
 	if err != nil {
-		vm.RunTimeError("Failed to create directory '%s': %v", path, err)
+		fileError(vm, "Failed to create directory '%s': %v", path, err)
 		return core.NIL_VALUE
 	}
 
@@ -288,15 +331,15 @@ func RmdirBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to rmdir, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	err := os.Remove(path)
+	err := vm.FileSystem().Remove(path)
 	if err != nil {
-		vm.RunTimeError("Failed to remove directory '%s': %v", path, err)
+		fileError(vm, "Failed to remove directory '%s': %v", path, err)
 		return core.NIL_VALUE
 	}
 
@@ -310,15 +353,15 @@ func RemoveBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to remove, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	err := os.Remove(path)
+	err := vm.FileSystem().Remove(path)
 	if err != nil {
-		vm.RunTimeError("Failed to remove file '%s': %v", path, err)
+		fileError(vm, "Failed to remove file '%s': %v", path, err)
 		return core.NIL_VALUE
 	}
 
@@ -331,7 +374,7 @@ func GetcwdBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 		return core.NIL_VALUE
 	}
 
-	cwd, err := os.Getwd()
+	cwd, err := vm.FileSystem().Getwd()
 	if err != nil {
 		vm.RunTimeError("Failed to get current directory: %v", err)
 		return core.NIL_VALUE
@@ -347,15 +390,15 @@ func ChdirBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to chdir, expected string.")
 		return core.NIL_VALUE
 	}
 
 	path := pathVal.AsString().Get()
-	err := os.Chdir(path)
+	err := vm.FileSystem().Chdir(path)
 	if err != nil {
-		vm.RunTimeError("Failed to change directory to '%s': %v", path, err)
+		fileError(vm, "Failed to change directory to '%s': %v", path, err)
 		return core.NIL_VALUE
 	}
 
@@ -373,7 +416,7 @@ func JoinBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 	var paths []string
 	for i := 0; i < argCount; i++ {
 		pathVal := vm.Stack(arg_stackptr + i)
-		if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+		if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 			vm.RunTimeError("Invalid argument type to join, expected string.")
 			return core.NIL_VALUE
 		}
@@ -399,7 +442,7 @@ func DirnameBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to dirname, expected string.")
 		return core.NIL_VALUE
 	}
@@ -431,7 +474,7 @@ func BasenameBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Val
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to basename, expected string.")
 		return core.NIL_VALUE
 	}
@@ -460,7 +503,7 @@ func SpliTextBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Val
 	}
 
 	pathVal := vm.Stack(arg_stackptr)
-	if pathVal.Type != core.VAL_OBJ || pathVal.Obj.GetType() != core.OBJECT_STRING {
+	if !pathVal.IsObj() || pathVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to splitext, expected string.")
 		return core.NIL_VALUE
 	}
@@ -496,15 +539,26 @@ func SpliTextBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Val
 }
 
 // Helper function for file operations
-func openFile(path string, mode string) (*os.File, error) {
+func openFile(fsys core.FileSystem, path string, mode string) (*os.File, error) {
 	switch mode {
 	case "r":
-		return os.Open(path) // Read-only
+		return fsys.OpenFile(path, os.O_RDONLY, 0) // Read-only
 	case "w":
-		return os.Create(path) // Write (truncate if exists)
+		return fsys.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666) // Write (truncate if exists)
 	case "a":
-		return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) // Append
+		return fsys.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) // Append
 	default:
 		return nil, fmt.Errorf("invalid mode: %s", mode)
 	}
 }
+
+// fileError reports a failed file operation: as a PermissionError if err
+// is one -- the sandbox refusing, or the host -- and otherwise as a
+// RunTimeError.
+func fileError(vm core.VMContext, format string, args ...interface{}) {
+	if err, ok := args[len(args)-1].(error); ok && errors.Is(err, fs.ErrPermission) {
+		vm.RunTimeErrorNamed("PermissionError", format, args...)
+		return
+	}
+	vm.RunTimeError(format, args...)
+}
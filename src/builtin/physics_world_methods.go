@@ -39,11 +39,11 @@ func RegisterAllPhysicsWorldMethods(o *PhysicsWorldObject) {
 			radiusVal := vm.Stack(arg_stackptr + 2)
 			matVal := vm.Stack(arg_stackptr + 3)
 
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() first argument must be a vec3 (position)")
 				return core.NIL_VALUE
 			}
-			if velVal.Type != core.VAL_VEC3 {
+			if velVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add() second argument must be a vec3 (velocity)")
 				return core.NIL_VALUE
 			}
@@ -56,8 +56,8 @@ func RegisterAllPhysicsWorldMethods(o *PhysicsWorldObject) {
 				return core.NIL_VALUE
 			}
 
-			pos := posVal.Obj.(*core.Vec3Object)
-			vel := velVal.Obj.(*core.Vec3Object)
+			pos := posVal.Obj().(*core.Vec3Object)
+			vel := velVal.Obj().(*core.Vec3Object)
 
 			id, err := o.Value.Add(
 				PVec3{pos.X, pos.Y, pos.Z},
@@ -87,15 +87,15 @@ func RegisterAllPhysicsWorldMethods(o *PhysicsWorldObject) {
 			angleVal := vm.Stack(arg_stackptr + 3)
 			matVal := vm.Stack(arg_stackptr + 4)
 
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_static_box() first argument must be a vec3 (position)")
 				return core.NIL_VALUE
 			}
-			if extentVal.Type != core.VAL_VEC3 {
+			if extentVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_static_box() second argument must be a vec3 (half_extents)")
 				return core.NIL_VALUE
 			}
-			if axisVal.Type != core.VAL_VEC3 {
+			if axisVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_static_box() third argument must be a vec3 (axis)")
 				return core.NIL_VALUE
 			}
@@ -108,9 +108,9 @@ func RegisterAllPhysicsWorldMethods(o *PhysicsWorldObject) {
 				return core.NIL_VALUE
 			}
 
-			pos := posVal.Obj.(*core.Vec3Object)
-			extent := extentVal.Obj.(*core.Vec3Object)
-			axis := axisVal.Obj.(*core.Vec3Object)
+			pos := posVal.Obj().(*core.Vec3Object)
+			extent := extentVal.Obj().(*core.Vec3Object)
+			axis := axisVal.Obj().(*core.Vec3Object)
 
 			id, err := o.Value.AddStaticBox(
 				PVec3{pos.X, pos.Y, pos.Z},
@@ -218,12 +218,12 @@ func RegisterAllPhysicsWorldMethods(o *PhysicsWorldObject) {
 				vm.RunTimeError("add_impulse() first argument must be an integer (id)")
 				return core.NIL_VALUE
 			}
-			if impulseVal.Type != core.VAL_VEC3 {
+			if impulseVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("add_impulse() second argument must be a vec3 (impulse)")
 				return core.NIL_VALUE
 			}
 
-			impulse := impulseVal.Obj.(*core.Vec3Object)
+			impulse := impulseVal.Obj().(*core.Vec3Object)
 			if err := o.Value.AddImpulse(idVal.AsInt(), PVec3{impulse.X, impulse.Y, impulse.Z}); err != nil {
 				vm.RunTimeError(err.Error())
 			}
@@ -41,7 +41,7 @@ func LoadsBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	dataVal := vm.Stack(arg_stackptr)
-	if dataVal.Type != core.VAL_OBJ || dataVal.Obj.GetType() != core.OBJECT_STRING {
+	if !dataVal.IsObj() || dataVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("Invalid argument type to loads, expected string.")
 		return core.NIL_VALUE
 	}
@@ -80,7 +80,7 @@ func SpawnBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	}
 
 	scriptVal := vm.Stack(arg_stackptr)
-	if scriptVal.Type != core.VAL_OBJ || scriptVal.Obj.GetType() != core.OBJECT_STRING {
+	if !scriptVal.IsObj() || scriptVal.Obj().GetType() != core.OBJECT_STRING {
 		vm.RunTimeError("spawn() first argument must be a string (script path).")
 		return core.NIL_VALUE
 	}
@@ -89,7 +89,7 @@ func SpawnBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value
 	var extraArgs []string
 	for i := 1; i < argCount; i++ {
 		argVal := vm.Stack(arg_stackptr + i)
-		if argVal.Type != core.VAL_OBJ || argVal.Obj.GetType() != core.OBJECT_STRING {
+		if !argVal.IsObj() || argVal.Obj().GetType() != core.OBJECT_STRING {
 			vm.RunTimeError("spawn() extra arguments must be strings.")
 			return core.NIL_VALUE
 		}
@@ -164,7 +164,7 @@ func WaitAnyBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 	}
 
 	listVal := vm.Stack(arg_stackptr)
-	if listVal.Type != core.VAL_OBJ || listVal.Obj.GetType() != core.OBJECT_LIST {
+	if !listVal.IsObj() || listVal.Obj().GetType() != core.OBJECT_LIST {
 		vm.RunTimeError("wait_any() argument must be a list of processes.")
 		return core.NIL_VALUE
 	}
@@ -176,7 +176,7 @@ func WaitAnyBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Valu
 
 	procs := make([]*ProcessObject, len(list.Items))
 	for i, item := range list.Items {
-		procObj, ok := item.Obj.(*ProcessObject)
+		procObj, ok := item.Obj().(*ProcessObject)
 		if !ok {
 			vm.RunTimeError("wait_any() list must contain only process objects.")
 			return core.NIL_VALUE
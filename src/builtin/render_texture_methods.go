@@ -46,10 +46,10 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 	o.RegisterMethod("clear", &core.BuiltInObject{
 		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 			v4val := vm.Stack(arg_stackptr)
-			if v4val.Type != core.VAL_VEC4 {
+			if v4val.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vector4")
 			}
-			v4 := v4val.Obj.(*core.Vec4Object)
+			v4 := v4val.Obj().(*core.Vec4Object)
 			rval := v4.X
 			gval := v4.Y
 			bval := v4.Z
@@ -74,11 +74,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			y2Val := vm.Stack(arg_stackptr + 3)
 			colVal := vm.Stack(arg_stackptr + 4)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for line color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -109,12 +109,12 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			thickVal := vm.Stack(arg_stackptr + 4)
 			colVal := vm.Stack(arg_stackptr + 5)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for line color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -141,11 +141,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			wval := vm.Stack(arg_stackptr + 2)
 			hval := vm.Stack(arg_stackptr + 3)
 			colVal := vm.Stack(arg_stackptr + 4)
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for rectangle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -176,11 +176,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			x3val := vm.Stack(arg_stackptr + 4)
 			y3val := vm.Stack(arg_stackptr + 5)
 			colVal := vm.Stack(arg_stackptr + 6)
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for rectangle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -211,11 +211,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			radVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for circle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -242,11 +242,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			yVal := vm.Stack(arg_stackptr + 1)
 			colVal := vm.Stack(arg_stackptr + 2)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for pixel color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -274,11 +274,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			radVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for circle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -306,11 +306,11 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			xVal := vm.Stack(arg_stackptr + 1)
 			yVal := vm.Stack(arg_stackptr + 2)
 
-			if texVal.Type != core.VAL_OBJ {
+			if !texVal.IsObj() {
 				vm.RunTimeError("Expected texture in parameter 1 for draw")
 				return core.NIL_VALUE
 			}
-			to, ok := texVal.Obj.(*TextureObject)
+			to, ok := texVal.Obj().(*TextureObject)
 			if !ok {
 				vm.RunTimeError("Expected texture in parameter 1 for draw")
 				return core.NIL_VALUE
@@ -347,16 +347,16 @@ func RegisterAllRenderTextureMethods(o *RenderTextureObject) {
 			rotval := vm.Stack(arg_stackptr + 11)
 			colVal := vm.Stack(arg_stackptr + 12)
 
-			to, ok := textureVal.Obj.(*TextureObject)
+			to, ok := textureVal.Obj().(*TextureObject)
 			if !ok {
 				vm.RunTimeError("Expected TextureObject for draw_texture_pro")
 				return core.NIL_VALUE
 			}
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			srcX := float32(srcXVal.AsFloat())
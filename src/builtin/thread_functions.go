@@ -2,6 +2,7 @@ package builtin
 
 import (
 	"reflect"
+	"time"
 
 	"glox/src/core"
 )
@@ -81,7 +82,7 @@ func ThreadWaitAnyBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) cor
 	}
 
 	listVal := vm.Stack(arg_stackptr)
-	if listVal.Type != core.VAL_OBJ || listVal.Obj.GetType() != core.OBJECT_LIST {
+	if !listVal.IsObj() || listVal.Obj().GetType() != core.OBJECT_LIST {
 		vm.RunTimeError("wait_any() argument must be a list of threads.")
 		return core.NIL_VALUE
 	}
@@ -93,7 +94,7 @@ func ThreadWaitAnyBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) cor
 
 	threads := make([]*ThreadObject, len(list.Items))
 	for i, item := range list.Items {
-		threadObj, ok := item.Obj.(*ThreadObject)
+		threadObj, ok := item.Obj().(*ThreadObject)
 		if !ok {
 			vm.RunTimeError("wait_any() list must contain only thread objects.")
 			return core.NIL_VALUE
@@ -135,3 +136,218 @@ func ThreadWaitAnyBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) cor
 
 	return core.NIL_VALUE
 }
+
+// ChannelBuiltIn implements thread.Channel(capacity): a standalone channel
+// holding up to capacity values unreceived (0, the default, makes every
+// send wait for a receiver). Unlike the channels thread.spawn() sets up it
+// belongs to no one spawn, so it can be handed to several threads, which
+// share it.
+func ChannelBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount > 1 {
+		vm.RunTimeError("Channel() expects at most 1 argument (a capacity).")
+		return core.NIL_VALUE
+	}
+	capacity := 0
+	if argCount == 1 {
+		capVal := vm.Stack(arg_stackptr)
+		if !capVal.IsInt() || capVal.AsInt() < 0 {
+			vm.RunTimeError("Channel() capacity must be a non-negative integer.")
+			return core.NIL_VALUE
+		}
+		capacity = capVal.AsInt()
+	}
+	ch := newChannelObject(capacity)
+	RegisterAllChannelMethods(ch)
+	return core.MakeObjectValue(ch, true)
+}
+
+// selectArm is what one reflect.SelectCase built by ThreadSelectBuiltIn
+// stands for. A script's case can need more than one: a send to a Thread
+// also watches for the thread finishing, and anything on a ThreadChannel
+// for the thread being cancelled, and anything on a Channel for it being
+// closed, as their own send()/recv() do.
+type selectArm struct {
+	index int // the case's place in the list given
+	kind  selectArmKind
+}
+
+type selectArmKind int
+
+const (
+	armRecvMessage selectArmKind = iota // a Thread's FromWorker
+	armRecvValue                        // a ThreadChannel's In, or a Channel
+	armSend
+	armFinished  // the Thread a send goes to has finished
+	armCancelled // the thread a ThreadChannel belongs to was cancelled
+	armSendClosed // the Channel a send goes to was closed
+	armRecvClosed // a Channel received from was closed
+	armTimeout
+)
+
+// ThreadSelectBuiltIn implements thread.select(cases, timeout): it blocks
+// until one of cases can go ahead, does it, and returns (index, value) --
+// the case's place in the list and what was received, or nil for a send.
+// A Thread, ThreadChannel or Channel on its own is a receive from it; a
+// [target, value] pair sends value to it. When several are ready one is
+// picked at random, as Go's select does: it is reflect.Select over
+// however many cases there are.
+//
+// A receive from a Thread that has finished, or from a Channel that is
+// closed and empty, is dropped from consideration, as wait_any drops a
+// finished thread; once no cases are left, select returns nil. With a
+// timeout, it also returns nil if no case has gone ahead after timeout
+// seconds -- at once, for 0. Sending to a finished Thread or a closed
+// Channel, or anything on a cancelled thread's ThreadChannel, raises
+// ThreadError, as their own send()/recv() would.
+func ThreadSelectBuiltIn(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+	if argCount != 1 && argCount != 2 {
+		vm.RunTimeError("select() expects 1 or 2 arguments (a list of cases and a timeout).")
+		return core.NIL_VALUE
+	}
+	listVal := vm.Stack(arg_stackptr)
+	if !listVal.IsObj() || listVal.Obj().GetType() != core.OBJECT_LIST {
+		vm.RunTimeError("select() argument must be a list of cases.")
+		return core.NIL_VALUE
+	}
+	timeout := -1.0 // none
+	if argCount == 2 {
+		t := vm.Stack(arg_stackptr + 1)
+		switch {
+		case t.IsNil():
+		case t.IsInt():
+			timeout = max(float64(t.AsInt()), 0)
+		case t.IsFloat():
+			timeout = max(t.AsFloat(), 0)
+		default:
+			vm.RunTimeError("select() timeout must be a number.")
+			return core.NIL_VALUE
+		}
+	}
+
+	var cases []reflect.SelectCase
+	var arms []selectArm
+	add := func(index int, kind selectArmKind, dir reflect.SelectDir, ch any, send any) {
+		c := reflect.SelectCase{Dir: dir, Chan: reflect.ValueOf(ch)}
+		if dir == reflect.SelectSend {
+			c.Send = reflect.ValueOf(send)
+		}
+		cases = append(cases, c)
+		arms = append(arms, selectArm{index: index, kind: kind})
+	}
+	for i, item := range listVal.AsList().Items {
+		target, isSend, val := item, false, core.NIL_VALUE
+		if item.IsObj() && item.Obj().GetType() == core.OBJECT_LIST {
+			pair := item.AsList().Items
+			if len(pair) != 2 {
+				vm.RunTimeError("select() send case %d must be a [channel, value] pair.", i)
+				return core.NIL_VALUE
+			}
+			target, isSend, val = pair[0], true, pair[1]
+		}
+		switch o := target.Obj().(type) {
+		case *ThreadObject:
+			if isSend {
+				select {
+				case <-o.Handle.Done:
+					vm.RunTimeErrorNamed("ThreadError", "select() case %d: thread has already finished", i)
+					return core.NIL_VALUE
+				default:
+				}
+				add(i, armSend, reflect.SelectSend, o.Handle.ToWorker, val)
+				add(i, armFinished, reflect.SelectRecv, o.Handle.Done, nil)
+			} else if !o.recvDone {
+				add(i, armRecvMessage, reflect.SelectRecv, o.Handle.FromWorker, nil)
+			}
+		case *ThreadChannelObject:
+			if isSend {
+				add(i, armSend, reflect.SelectSend, o.Chans.Out, core.ThreadMessage{Val: val})
+			} else {
+				add(i, armRecvValue, reflect.SelectRecv, o.Chans.In, nil)
+			}
+			add(i, armCancelled, reflect.SelectRecv, o.Chans.Cancelled, nil)
+		case *ChannelObject:
+			if isSend {
+				if o.closed.Load() {
+					vm.RunTimeErrorNamed("ThreadError", "select() case %d: send on a closed channel", i)
+					return core.NIL_VALUE
+				}
+				add(i, armSend, reflect.SelectSend, o.Ch, val)
+				add(i, armSendClosed, reflect.SelectRecv, o.done, nil)
+			} else {
+				add(i, armRecvValue, reflect.SelectRecv, o.Ch, nil)
+				add(i, armRecvClosed, reflect.SelectRecv, o.done, nil)
+			}
+		default:
+			vm.RunTimeError("select() case %d must be a thread, thread channel or channel, or a [channel, value] pair.", i)
+			return core.NIL_VALUE
+		}
+	}
+	if timeout == 0 {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+		arms = append(arms, selectArm{index: -1, kind: armTimeout})
+	} else if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout * float64(time.Second)))
+		defer timer.Stop()
+		add(-1, armTimeout, reflect.SelectRecv, timer.C, nil)
+	}
+
+	for {
+		live := 0
+		for i, arm := range arms {
+			if arm.kind != armTimeout && cases[i].Chan.IsValid() {
+				live++
+			}
+		}
+		if live == 0 {
+			return core.NIL_VALUE
+		}
+		chosen, recv, ok := reflect.Select(cases)
+		arm := arms[chosen]
+		switch arm.kind {
+		case armTimeout:
+			return core.NIL_VALUE
+		case armFinished:
+			vm.RunTimeErrorNamed("ThreadError", "select() case %d: thread has already finished", arm.index)
+			return core.NIL_VALUE
+		case armCancelled:
+			vm.RunTimeErrorNamed("ThreadError", "select() case %d: thread was cancelled", arm.index)
+			return core.NIL_VALUE
+		case armSendClosed:
+			vm.RunTimeErrorNamed("ThreadError", "select() case %d: send on a closed channel", arm.index)
+			return core.NIL_VALUE
+		case armRecvClosed:
+			// a value sent before it closed is still received
+			if val, drained := listVal.AsList().Items[arm.index].Obj().(*ChannelObject).drain(); drained {
+				return selectResult(arm.index, val)
+			}
+		case armSend:
+			return selectResult(arm.index, core.NIL_VALUE)
+		}
+		if !ok {
+			// finished or closed: drop it, and its other arms, and go again
+			if t, isThread := listVal.AsList().Items[arm.index].Obj().(*ThreadObject); isThread {
+				t.recvDone = true
+			}
+			for i := range arms {
+				if arms[i].index == arm.index {
+					cases[i].Chan = reflect.Value{}
+				}
+			}
+			continue
+		}
+		if arm.kind == armRecvMessage {
+			msg := recv.Interface().(core.ThreadMessage)
+			if msg.Err != nil {
+				vm.RunTimeErrorNamed("ThreadError", "select() case %d: %v", arm.index, msg.Err)
+				return core.NIL_VALUE
+			}
+			return selectResult(arm.index, msg.Val)
+		}
+		return selectResult(arm.index, recv.Interface().(core.Value))
+	}
+}
+
+func selectResult(index int, val core.Value) core.Value {
+	tuple := core.MakeListObject([]core.Value{core.MakeIntValue(index, false), val}, true)
+	return core.MakeObjectValue(tuple, false)
+}
@@ -163,3 +163,70 @@ func RegisterAllThreadChannelMethods(o *ThreadChannelObject) {
 		},
 	})
 }
+
+// RegisterAllChannelMethods wires up a standalone Channel object's
+// Lox-visible methods (send/recv/try_recv/close).
+func RegisterAllChannelMethods(o *ChannelObject) {
+
+	o.RegisterMethod("send", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 1 {
+				vm.RunTimeError("send() expects 1 argument")
+				return core.NIL_VALUE
+			}
+			if !o.sendValue(vm.Stack(arg_stackptr)) {
+				vm.RunTimeErrorNamed("ThreadError", "send on a closed channel")
+			}
+			return core.NIL_VALUE
+		},
+	})
+
+	o.RegisterMethod("recv", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("recv() expects no arguments")
+				return core.NIL_VALUE
+			}
+			val, ok := o.recvValue()
+			if !ok {
+				vm.RunTimeErrorNamed("ThreadError", "channel is closed")
+				return core.NIL_VALUE
+			}
+			return val
+		},
+	})
+
+	o.RegisterMethod("try_recv", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("try_recv() expects no arguments")
+				return core.NIL_VALUE
+			}
+			val, ok := o.drain()
+			if ok {
+				tuple := core.MakeListObject([]core.Value{core.MakeBooleanValue(true, false), val}, true)
+				return core.MakeObjectValue(tuple, false)
+			}
+			if o.closed.Load() {
+				vm.RunTimeErrorNamed("ThreadError", "channel is closed")
+				return core.NIL_VALUE
+			}
+			tuple := core.MakeListObject([]core.Value{core.MakeBooleanValue(false, false), core.NIL_VALUE}, true)
+			return core.MakeObjectValue(tuple, false)
+		},
+	})
+
+	// close stops further sends. Values already sent can still be
+	// received; after them, recv() raises ThreadError. Closing a closed
+	// channel does nothing.
+	o.RegisterMethod("close", &core.BuiltInObject{
+		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
+			if argCount != 0 {
+				vm.RunTimeError("close() expects no arguments")
+				return core.NIL_VALUE
+			}
+			o.close()
+			return core.NIL_VALUE
+		},
+	})
+}
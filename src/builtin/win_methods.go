@@ -77,11 +77,11 @@ func RegisterAllWindowMethods(o *WindowObject) {
 	o.RegisterMethod("clear", &core.BuiltInObject{
 		Function: func(argCount int, arg_stackptr int, vm core.VMContext) core.Value {
 			v4val := vm.Stack(arg_stackptr)
-			if v4val.Type != core.VAL_VEC4 {
+			if v4val.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for clear color")
 				return core.NIL_VALUE
 			}
-			v4obj := v4val.Obj.(*core.Vec4Object)
+			v4obj := v4val.Obj().(*core.Vec4Object)
 			r := v4obj.X
 			g := v4obj.Y
 			b := v4obj.Z
@@ -103,12 +103,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			y2Val := vm.Stack(arg_stackptr + 3)
 			colVal := vm.Stack(arg_stackptr + 4)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for line color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -138,12 +138,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			thickVal := vm.Stack(arg_stackptr + 4)
 			colVal := vm.Stack(arg_stackptr + 5)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for line color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -178,12 +178,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			y3Val := vm.Stack(arg_stackptr + 5)
 			colVal := vm.Stack(arg_stackptr + 6)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for triangle color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -212,11 +212,11 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			wval := vm.Stack(arg_stackptr + 2)
 			hval := vm.Stack(arg_stackptr + 3)
 			colVal := vm.Stack(arg_stackptr + 4)
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for rectangle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := int32(v4obj.X)
 			g := int32(v4obj.Y)
 			b := int32(v4obj.Z)
@@ -243,12 +243,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			radVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for circle color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -273,12 +273,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			yVal := vm.Stack(arg_stackptr + 1)
 			colVal := vm.Stack(arg_stackptr + 2)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for pixel color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -304,12 +304,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			radVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for circle color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -336,12 +336,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			sizeVal := vm.Stack(arg_stackptr + 3)
 			colVal := vm.Stack(arg_stackptr + 4)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for text color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -419,18 +419,18 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			yVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
 			y := float32(yVal.AsFloat())
 
-			to := textureVal.Obj.(*TextureObject)
+			to := textureVal.Obj().(*TextureObject)
 			rect := to.Data.GetFrameRect()
 			rl.DrawTextureRec(to.Data.Texture, rect, rl.Vector2{X: x, Y: y}, tint)
 			to.Data.Animate()
@@ -452,18 +452,18 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			colVal := vm.Stack(arg_stackptr + 3)
 			flipVal := vm.Stack(arg_stackptr + 4)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
 			y := float32(yVal.AsFloat())
-			flip := flipVal.Type == core.VAL_BOOL && flipVal.Data == 1
+			flip := flipVal.IsBool() && flipVal.Data() == 1
 
-			to := textureVal.Obj.(*TextureObject)
+			to := textureVal.Obj().(*TextureObject)
 			rect := to.Data.GetFrameRect()
 			if flip {
 				rect.Width = -rect.Width
@@ -490,19 +490,19 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			flipVal := vm.Stack(arg_stackptr + 4)
 			scaleVal := vm.Stack(arg_stackptr + 5)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
 			y := float32(yVal.AsFloat())
-			flip := flipVal.Type == core.VAL_BOOL && flipVal.Data == 1
+			flip := flipVal.IsBool() && flipVal.Data() == 1
 			scale := float32(scaleVal.AsFloat())
 
-			to := textureVal.Obj.(*TextureObject)
+			to := textureVal.Obj().(*TextureObject)
 			rect := to.Data.GetFrameRect()
 			if flip {
 				rect.Width = -rect.Width
@@ -530,23 +530,23 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			yVal := vm.Stack(arg_stackptr + 2)
 			colVal := vm.Stack(arg_stackptr + 3)
 
-			if renderTextureVal.Type != core.VAL_OBJ {
+			if !renderTextureVal.IsObj() {
 				vm.RunTimeError("Expected RenderTexture object")
 				return core.NIL_VALUE
 			}
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for render texture color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
 			y := float32(yVal.AsFloat())
 
-			to := renderTextureVal.Obj.(*RenderTextureObject)
+			to := renderTextureVal.Obj().(*RenderTextureObject)
 			target := to.Data.RenderTexture.Texture
 			rl.DrawTextureRec(target, rl.Rectangle{X: 0, Y: 0, Width: float32(target.Width), Height: float32(-target.Height)}, rl.Vector2{X: x, Y: y}, tint)
 
@@ -567,17 +567,17 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			scaleVal := vm.Stack(arg_stackptr + 4)
 			colVal := vm.Stack(arg_stackptr + 5)
 
-			if renderTextureVal.Type != core.VAL_OBJ {
+			if !renderTextureVal.IsObj() {
 				vm.RunTimeError("Expected RenderTexture object")
 				return core.NIL_VALUE
 			}
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for render texture color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
@@ -585,7 +585,7 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			rot := float32(rotVal.AsFloat())
 			scale := float32(scaleVal.AsFloat())
 
-			to := renderTextureVal.Obj.(*RenderTextureObject)
+			to := renderTextureVal.Obj().(*RenderTextureObject)
 			target := to.Data.RenderTexture.Texture
 
 			rl.DrawTextureEx(target, rl.Vector2{X: x, Y: y}, rot, scale, tint)
@@ -609,12 +609,12 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			srcHVal := vm.Stack(arg_stackptr + 6)
 			colVal := vm.Stack(arg_stackptr + 7)
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
 
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			x := float32(xVal.AsFloat())
@@ -624,7 +624,7 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			srcW := float32(srcWVal.AsFloat())
 			srcH := float32(srcHVal.AsFloat())
 
-			to := textureVal.Obj.(*TextureObject)
+			to := textureVal.Obj().(*TextureObject)
 			rect := rl.Rectangle{
 				X:      srcX,
 				Y:      srcY,
@@ -662,9 +662,9 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			var rto *RenderTextureObject
 			var texture rl.Texture2D
 
-			to, ok := textureVal.Obj.(*TextureObject)
+			to, ok := textureVal.Obj().(*TextureObject)
 			if !ok {
-				rto, ok = textureVal.Obj.(*RenderTextureObject)
+				rto, ok = textureVal.Obj().(*RenderTextureObject)
 				if !ok {
 					vm.RunTimeError("Expected TextureObject for draw_texture_pro")
 					return core.NIL_VALUE
@@ -675,11 +675,11 @@ func RegisterAllWindowMethods(o *WindowObject) {
 				texture = to.Data.Texture
 			}
 
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for texture color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			tint := rl.NewColor(uint8(v4obj.X), uint8(v4obj.Y), uint8(v4obj.Z), uint8(v4obj.W))
 
 			srcX := float32(srcXVal.AsFloat())
@@ -750,13 +750,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 				return core.NIL_VALUE
 			}
 			cameraVal := vm.Stack(arg_stackptr)
-			if cameraVal.Type != core.VAL_OBJ {
+			if !cameraVal.IsObj() {
 				vm.RunTimeError("Expected camera object")
 				return core.NIL_VALUE
 			}
 
 			// Type assertion to check if it's a CameraObject
-			cameraObj, ok := cameraVal.Obj.(*CameraObject)
+			cameraObj, ok := cameraVal.Obj().(*CameraObject)
 			if !ok {
 				vm.RunTimeError("Expected camera object")
 				return core.NIL_VALUE
@@ -782,13 +782,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 				return core.NIL_VALUE
 			}
 			renderTextureVal := vm.Stack(arg_stackptr)
-			if renderTextureVal.Type != core.VAL_OBJ {
+			if !renderTextureVal.IsObj() {
 				vm.RunTimeError("Expected render texture object")
 				return core.NIL_VALUE
 			}
 
 			// Type assertion to check if it's a RenderTextureObject
-			renderTextureObj, ok := renderTextureVal.Obj.(*RenderTextureObject)
+			renderTextureObj, ok := renderTextureVal.Obj().(*RenderTextureObject)
 			if !ok {
 				vm.RunTimeError("Expected render texture object")
 				return core.NIL_VALUE
@@ -819,13 +819,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			}
 
 			shaderVal := vm.Stack(arg_stackptr)
-			if shaderVal.Type != core.VAL_OBJ {
+			if !shaderVal.IsObj() {
 				vm.RunTimeError("begin_shader_mode expects shader object")
 				return core.NIL_VALUE
 			}
 
 			// Type assertion to check if it's a ShaderObject
-			shaderObj, ok := shaderVal.Obj.(*ShaderObject)
+			shaderObj, ok := shaderVal.Obj().(*ShaderObject)
 			if !ok {
 				vm.RunTimeError("Expected shader object")
 				return core.NIL_VALUE
@@ -855,14 +855,14 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			sizeVal := vm.Stack(arg_stackptr + 1)
 			colorVal := vm.Stack(arg_stackptr + 2)
 
-			if posVal.Type != core.VAL_VEC3 || sizeVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if posVal.Type() != core.VAL_VEC3 || sizeVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("cube arguments must be vec3, vec3, vec4")
 				return core.NIL_VALUE
 			}
 
-			posObj := posVal.Obj.(*core.Vec3Object)
-			sizeObj := sizeVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			position := rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)}
 			color := rl.NewColor(uint8(colorObj.X), uint8(colorObj.Y), uint8(colorObj.Z), uint8(colorObj.W))
@@ -883,14 +883,14 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			sizeVal := vm.Stack(arg_stackptr + 1)
 			colorVal := vm.Stack(arg_stackptr + 2)
 
-			if posVal.Type != core.VAL_VEC3 || sizeVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if posVal.Type() != core.VAL_VEC3 || sizeVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("cube_wires arguments must be vec3, vec3, vec4")
 				return core.NIL_VALUE
 			}
 
-			posObj := posVal.Obj.(*core.Vec3Object)
-			sizeObj := sizeVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			position := rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)}
 			color := rl.NewColor(uint8(colorObj.X), uint8(colorObj.Y), uint8(colorObj.Z), uint8(colorObj.W))
@@ -913,7 +913,7 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			angleVal := vm.Stack(arg_stackptr + 3)
 			colorVal := vm.Stack(arg_stackptr + 4)
 
-			if posVal.Type != core.VAL_VEC3 || sizeVal.Type != core.VAL_VEC3 || axisVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if posVal.Type() != core.VAL_VEC3 || sizeVal.Type() != core.VAL_VEC3 || axisVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("cube_rotated arguments must be vec3, vec3, vec3, number, vec4")
 				return core.NIL_VALUE
 			}
@@ -922,10 +922,10 @@ func RegisterAllWindowMethods(o *WindowObject) {
 				return core.NIL_VALUE
 			}
 
-			posObj := posVal.Obj.(*core.Vec3Object)
-			sizeObj := sizeVal.Obj.(*core.Vec3Object)
-			axisObj := axisVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec3Object)
+			axisObj := axisVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			mesh, material := o.Value.CubeModel()
 
@@ -955,7 +955,7 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			angleVal := vm.Stack(arg_stackptr + 3)
 			colorVal := vm.Stack(arg_stackptr + 4)
 
-			if posVal.Type != core.VAL_VEC3 || sizeVal.Type != core.VAL_VEC3 || axisVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if posVal.Type() != core.VAL_VEC3 || sizeVal.Type() != core.VAL_VEC3 || axisVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("cube_wires_rotated arguments must be vec3, vec3, vec3, number, vec4")
 				return core.NIL_VALUE
 			}
@@ -964,10 +964,10 @@ func RegisterAllWindowMethods(o *WindowObject) {
 				return core.NIL_VALUE
 			}
 
-			posObj := posVal.Obj.(*core.Vec3Object)
-			sizeObj := sizeVal.Obj.(*core.Vec3Object)
-			axisObj := axisVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec3Object)
+			axisObj := axisVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			// Same transform composition as cube_rotated, but rather than
 			// drawing the shared solid-cube mesh, transform a unit cube's 8
@@ -1020,13 +1020,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			radiusVal := vm.Stack(arg_stackptr + 1)
 			colorVal := vm.Stack(arg_stackptr + 2)
 
-			if centerVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if centerVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("sphere arguments must be vec3, number, vec4")
 				return core.NIL_VALUE
 			}
 
-			centerObj := centerVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			centerObj := centerVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			center := rl.Vector3{X: float32(centerObj.X), Y: float32(centerObj.Y), Z: float32(centerObj.Z)}
 			radius := float32(radiusVal.AsFloat())
@@ -1050,13 +1050,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			heightVal := vm.Stack(arg_stackptr + 3)
 			colorVal := vm.Stack(arg_stackptr + 4)
 
-			if posVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if posVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("cylinder position and color must be vec3 and vec4")
 				return core.NIL_VALUE
 			}
 
-			posObj := posVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			position := rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)}
 			radiusTop := float32(radiusTopVal.AsFloat())
@@ -1098,14 +1098,14 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			sizeVal := vm.Stack(arg_stackptr + 1)
 			colorVal := vm.Stack(arg_stackptr + 2)
 
-			if centerVal.Type != core.VAL_VEC3 || sizeVal.Type != core.VAL_VEC2 || colorVal.Type != core.VAL_VEC4 {
+			if centerVal.Type() != core.VAL_VEC3 || sizeVal.Type() != core.VAL_VEC2 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("plane arguments must be vec3, vec2, vec4")
 				return core.NIL_VALUE
 			}
 
-			centerObj := centerVal.Obj.(*core.Vec3Object)
-			sizeObj := sizeVal.Obj.(*core.Vec2Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			centerObj := centerVal.Obj().(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec2Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			center := rl.Vector3{X: float32(centerObj.X), Y: float32(centerObj.Y), Z: float32(centerObj.Z)}
 			size := rl.Vector2{X: float32(sizeObj.X), Y: float32(sizeObj.Y)}
@@ -1128,13 +1128,13 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			radiusZVal := vm.Stack(arg_stackptr + 2)
 			colorVal := vm.Stack(arg_stackptr + 3)
 
-			if centerVal.Type != core.VAL_VEC3 || colorVal.Type != core.VAL_VEC4 {
+			if centerVal.Type() != core.VAL_VEC3 || colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("ellipse arguments must be vec3, number, number, vec4")
 				return core.NIL_VALUE
 			}
 
-			centerObj := centerVal.Obj.(*core.Vec3Object)
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			centerObj := centerVal.Obj().(*core.Vec3Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			center := rl.Vector3{X: float32(centerObj.X), Y: float32(centerObj.Y), Z: float32(centerObj.Z)}
 			radiusX := float32(radiusXVal.AsFloat())
@@ -1164,11 +1164,11 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			y3Val := vm.Stack(arg_stackptr + 7)
 			z3Val := vm.Stack(arg_stackptr + 8)
 			colVal := vm.Stack(arg_stackptr + 9)
-			if colVal.Type != core.VAL_VEC4 {
+			if colVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Expected Vec4 for triangle color")
 				return core.NIL_VALUE
 			}
-			v4obj := colVal.Obj.(*core.Vec4Object)
+			v4obj := colVal.Obj().(*core.Vec4Object)
 			r := uint8(v4obj.X)
 			g := uint8(v4obj.Y)
 			b := uint8(v4obj.Z)
@@ -1203,15 +1203,15 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			colorVal := vm.Stack(arg_stackptr + 3)
 
 			// Extract texture object (can be either TextureObject or RenderTextureObject)
-			if textureVal.Type != core.VAL_OBJ {
+			if !textureVal.IsObj() {
 				vm.RunTimeError("textured_cube first argument must be a texture or render_texture object")
 				return core.NIL_VALUE
 			}
 
 			var rayTexture rl.Texture2D
-			if textureObj, ok := textureVal.Obj.(*TextureObject); ok {
+			if textureObj, ok := textureVal.Obj().(*TextureObject); ok {
 				rayTexture = textureObj.Data.Texture
-			} else if renderTextureObj, ok := textureVal.Obj.(*RenderTextureObject); ok {
+			} else if renderTextureObj, ok := textureVal.Obj().(*RenderTextureObject); ok {
 				rayTexture = renderTextureObj.Data.RenderTexture.Texture
 			} else {
 				vm.RunTimeError("textured_cube first argument must be a texture or render_texture object")
@@ -1219,25 +1219,25 @@ func RegisterAllWindowMethods(o *WindowObject) {
 			}
 
 			// Extract position vector
-			if posVal.Type != core.VAL_VEC3 {
+			if posVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("textured_cube second argument must be a vec3")
 				return core.NIL_VALUE
 			}
-			posObj := posVal.Obj.(*core.Vec3Object)
+			posObj := posVal.Obj().(*core.Vec3Object)
 
 			// Extract size vector
-			if sizeVal.Type != core.VAL_VEC3 {
+			if sizeVal.Type() != core.VAL_VEC3 {
 				vm.RunTimeError("textured_cube third argument must be a vec3")
 				return core.NIL_VALUE
 			}
-			sizeObj := sizeVal.Obj.(*core.Vec3Object)
+			sizeObj := sizeVal.Obj().(*core.Vec3Object)
 
 			// Extract base color
-			if colorVal.Type != core.VAL_VEC4 {
+			if colorVal.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("textured_cube fourth argument must be a vec4")
 				return core.NIL_VALUE
 			}
-			colorObj := colorVal.Obj.(*core.Vec4Object)
+			colorObj := colorVal.Obj().(*core.Vec4Object)
 
 			// Create position and size vectors
 			position := rl.Vector3{X: float32(posObj.X), Y: float32(posObj.Y), Z: float32(posObj.Z)}
@@ -3,6 +3,7 @@ package compiler
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"glox/src/core"
 	debug "glox/src/debug"
@@ -38,7 +39,9 @@ type Local struct {
 	lexeme     string
 	depth      int
 	isCaptured bool
-	isConst    bool // declared with `const`; assignment is a compile-time error
+	isConst    bool      // declared with `const`; assignment is a compile-time error
+	used       bool      // read somewhere in its scope; see warnUnused
+	typ        *TypeExpr // declared type annotation, only tracked by the checker
 }
 
 type Loop struct {
@@ -111,11 +114,14 @@ const (
 	TYPE_SCRIPT
 	TYPE_METHOD
 	TYPE_INITIALIZER
+	TYPE_DECORATED_METHOD // an instance method under decorators: a function taking this as its first argument
 )
 
 type ClassCompiler struct {
 	enclosing     *ClassCompiler
 	hasSuperClass bool
+	name          string
+	nameToken     Token
 }
 
 type Compiler struct {
@@ -130,6 +136,9 @@ type Compiler struct {
 	upvalues    [256]*Upvalue
 	scriptName  string
 	environment *core.Environment
+	returnType  *TypeExpr // `-> type` annotation of the function being compiled, if any
+	inParams    bool      // compiling the parameter list, whose names may shadow outer locals freely
+	async       bool      // an async function, whose body may await
 }
 
 type Name struct {
@@ -156,7 +165,7 @@ func NewCompiler(type_ FunctionType, scriptName string, parent *Compiler, enviro
 		depth:      0,
 		isCaptured: false,
 	}
-	if type_ != TYPE_FUNCTION {
+	if type_ != TYPE_FUNCTION && type_ != TYPE_DECORATED_METHOD {
 		rv.locals[0].name = SyntheticToken("this")
 	} else {
 		rv.locals[0].name = Token{}
@@ -183,8 +192,11 @@ type Parser struct {
 	globals             map[string]int  // name → compiler-assigned slot index
 	globalsDeclared     map[string]bool // name → true if defined via var/const/implicit declaration (not just referenced)
 	globalCount         int
-	exprDepth           int // current parsePrecedence() recursion depth; guards against runaway nesting blowing the Go stack
-	stmtDepth           int // current statement() recursion depth; guards against runaway nested blocks/if/while blowing the Go stack
+	constGlobals        map[int]core.Value // slot → value of a const global with a constant initialiser; see constDeclaration
+	exprDepth           int                // current parsePrecedence() recursion depth; guards against runaway nesting blowing the Go stack
+	stmtDepth           int                // current statement() recursion depth; guards against runaway nested blocks/if/while blowing the Go stack
+	tc                  *typeChecker       // static type checker, attached only by Check()
+	diagnostics         []Diagnostic       // errors (and warnings) found so far, in source order
 }
 
 // maxExprDepth caps expression-nesting recursion (parens, unary chains, list/dict
@@ -212,6 +224,7 @@ func NewParser() *Parser {
 		panicMode:       false,
 		globals:         map[string]int{},
 		globalsDeclared: map[string]bool{},
+		constGlobals:    map[int]core.Value{},
 	}
 	p.setRules()
 	return p
@@ -222,9 +235,10 @@ func NewParser() *Parser {
 // 1. Creates a new parser and scanner for the source
 // 2. Sets up a new compiler with TYPE_SCRIPT for top-level execution
 // 3. Parses all declarations until EOF is reached
-// 4. Returns the compiled function object containing bytecode, or nil if compilation failed
+// 4. Returns the compiled function object containing bytecode, or nil if compilation failed,
+// together with every diagnostic reported along the way
 // Debug tracing can be enabled to monitor compilation progress.
-func Compile(script string, source string, module string) *core.FunctionObject {
+func Compile(script string, source string, module string) (*core.FunctionObject, []Diagnostic) {
 
 	if core.DebugTraceExecution && !core.DebugSuppress {
 		fmt.Printf("Compiling %s\n", script)
@@ -244,9 +258,9 @@ func Compile(script string, source string, module string) *core.FunctionObject {
 		fmt.Println("Compile done.")
 	}
 	if parser.hadError {
-		return nil
+		return nil, parser.diagnostics
 	}
-	return function
+	return function, parser.diagnostics
 }
 
 // ReplState carries the compile-time and run-time global state that must persist
@@ -275,7 +289,7 @@ func NewReplState(module string) *ReplState {
 // globals keep stable slot numbers across lines and stay declared. The slot-table
 // changes are committed back into st only when compilation succeeds, so a line
 // with a parse error cannot leave st desynchronised from the environment.
-func CompileRepl(script, source, module string, st *ReplState) *core.FunctionObject {
+func CompileRepl(script, source, module string, st *ReplState) (*core.FunctionObject, []Diagnostic) {
 
 	if core.DebugTraceExecution && !core.DebugSuppress {
 		fmt.Printf("Compiling %s\n", script)
@@ -303,13 +317,13 @@ func CompileRepl(script, source, module string, st *ReplState) *core.FunctionObj
 		fmt.Println("Compile done.")
 	}
 	if parser.hadError {
-		return nil
+		return nil, parser.diagnostics
 	}
 	// Commit the (possibly grown) slot table back into the session state.
 	st.Globals = parser.globals
 	st.GlobalsDeclared = parser.globalsDeclared
 	st.GlobalCount = parser.globalCount
-	return function
+	return function, parser.diagnostics
 }
 
 // setRules initializes the parsing rules table that maps token types to their
@@ -377,6 +391,11 @@ func (p *Parser) setRules() {
 		TOKEN_ERROR:         {prefix: nil, infix: nil, prec: PREC_NONE},
 		TOKEN_EOF:           {prefix: nil, infix: nil, prec: PREC_NONE},
 		TOKEN_STR:           {prefix: str_, infix: nil, prec: PREC_NONE},
+		TOKEN_ARROW:         {prefix: nil, infix: nil, prec: PREC_NONE},
+		TOKEN_AT:            {prefix: nil, infix: nil, prec: PREC_NONE},
+		TOKEN_EXPORT:        {prefix: nil, infix: nil, prec: PREC_NONE},
+		TOKEN_ASYNC:         {prefix: asyncLambda, infix: nil, prec: PREC_NONE},
+		TOKEN_AWAIT:         {prefix: await, infix: nil, prec: PREC_NONE},
 	}
 }
 
@@ -465,10 +484,17 @@ func (p *Parser) getRule(tok TokenType) ParseRule {
 // If an error occurs during parsing, it enters panic mode and synchronizes to recover.
 func (p *Parser) declaration() {
 
-	if p.match(TOKEN_CLASS) {
-		p.classDeclaration()
+	if p.match(TOKEN_AT) {
+		p.decoratedDeclaration()
+	} else if p.match(TOKEN_EXPORT) {
+		p.exportDeclaration(nil)
+	} else if p.match(TOKEN_CLASS) {
+		p.classDeclaration(nil)
 	} else if p.match(TOKEN_FUNC) {
-		p.funcDeclaration()
+		p.funcDeclaration(nil, false)
+	} else if p.match(TOKEN_ASYNC) {
+		p.consume(TOKEN_FUNC, "Expect 'func' after 'async'.")
+		p.funcDeclaration(nil, true)
 	} else if p.match(TOKEN_VAR) {
 		p.varDeclaration(false)
 	} else if p.match(TOKEN_CONST) {
@@ -575,6 +601,7 @@ func (p *Parser) tryExceptStatement() {
 		p.consume(TOKEN_AS, "Expect as")
 		ev := p.parseVariable("Expect exception variable name.")
 		p.defineVariable(ev)
+		p.markUsed() // the syntax requires a name, so an unused one is not worth a warning
 		_ = p.match(TOKEN_EOL)
 		p.consume(TOKEN_LEFT_BRACE, "Expect left brace.")
 		p.emitByte(core.OP_EXCEPT)
@@ -679,6 +706,10 @@ func (p *Parser) compilePendingTrampolines(tryCtx *TryFinally) {
 			c := p.currentCompiler
 			savedCount := c.localCount
 			savedDepth := c.scopeDepth
+			// A break's localCountAtCrossing can be below savedCount, so
+			// locals the replay declares would overwrite entries still in
+			// scope after the try: restore the table, not just the count.
+			savedLocals := c.locals
 
 			// Reserve slots up to localCountAtCrossing so this replay's own
 			// locals can't alias whatever's still live higher on the real
@@ -700,6 +731,7 @@ func (p *Parser) compilePendingTrampolines(tryCtx *TryFinally) {
 			p.endScope()
 
 			c.tries = savedTries
+			c.locals = savedLocals
 			c.localCount = savedCount
 			c.scopeDepth = savedDepth
 
@@ -787,9 +819,8 @@ func (p *Parser) raiseStatement() {
 func (p *Parser) importStatement() {
 	c := 0
 	for {
-		p.consume(TOKEN_IDENTIFIER, "Expect module name.")
-		moduleTok := p.previous
-		nameConstant := p.identifierConstant(moduleTok)
+		moduleName := p.moduleName(false)
+		nameConstant := p.MakeConstant(core.MakeStringObjectValue(moduleName, false))
 		c = c + 1
 		p.emitBytes(core.OP_IMPORT, nameConstant)
 		var aliasName string
@@ -799,16 +830,24 @@ func (p *Parser) importStatement() {
 			p.emitByte(aliasConstant)
 			aliasName = p.previous.Lexeme()
 		} else {
-			// no alias, use module name as alias
+			// no alias, use module name as alias. For a dotted name the VM
+			// binds the top-level package, so that is the name declared here.
 			p.emitByte(nameConstant)
-			aliasName = moduleTok.Lexeme()
+			aliasName, _, _ = strings.Cut(moduleName, ".")
+		}
+		if p.tc != nil {
+			bound := moduleName
+			if !strings.HasPrefix(moduleName, aliasName+".") {
+				bound = aliasName
+			}
+			p.tc.globals[aliasName] = &TypeExpr{Name: "module", Module: bound}
 		}
 		// Allocate a persistent global slot for the bound name so OP_IMPORT
 		// writes the module into the fast globals array (via SlotForName), not
 		// only into the environment's Vars map. Without this the binding is
 		// invisible to a later reference that resolves to a fresh global slot —
 		// which is exactly what breaks a two-line "import x" then "x.f()" in the REPL.
-		p.globalSlot(aliasName)
+		p.forgetConstGlobal(p.globalSlot(aliasName))
 		p.markGlobalDeclared(aliasName)
 		if !p.match(TOKEN_COMMA) {
 			break
@@ -824,12 +863,13 @@ func (p *Parser) importStatement() {
 
 func (p *Parser) importFromStatement() {
 
-	p.consume(TOKEN_IDENTIFIER, "Expect module name.")
-	nameConstant := p.identifierConstant(p.previous)
+	moduleName := p.moduleName(true)
+	nameConstant := p.MakeConstant(core.MakeStringObjectValue(moduleName, false))
 	p.emitBytes(core.OP_IMPORT_FROM, nameConstant)
 	p.consume(TOKEN_IMPORT, "Expect 'import' after module name.")
 	if p.match(TOKEN_STAR) {
-		p.emitByte(0) // 0 means import all names
+		clear(p.constGlobals) // any global may be replaced
+		p.emitByte(0)         // 0 means import all names
 		p.consumeStatementEnd("Expect ';' after import list.")
 		return
 	}
@@ -850,12 +890,38 @@ func (p *Parser) importFromStatement() {
 		p.emitByte(constant) // emit the constant for each name
 		// Allocate a persistent global slot so the imported name is bound in the
 		// fast globals array and survives to later REPL lines (see importStatement).
-		p.globalSlot(name.Lexeme())
+		p.forgetConstGlobal(p.globalSlot(name.Lexeme()))
 		p.markGlobalDeclared(name.Lexeme())
+		if p.tc != nil {
+			p.tc.globals[name.Lexeme()] = p.tc.builtins[moduleName+"."+name.Lexeme()]
+		}
 	}
 	p.consumeStatementEnd("Expect ';' after import list.")
 }
 
+// moduleName parses a dotted module name, `a.b.c`. With relative set it may
+// also start with one or more dots, `.util` or `..core.io`, or be dots alone
+// (`from . import x`); the VM resolves those against the importing module's
+// package.
+func (p *Parser) moduleName(relative bool) string {
+
+	var sb strings.Builder
+	for relative && p.match(TOKEN_DOT) {
+		sb.WriteString(".")
+	}
+	if sb.Len() > 0 && p.check(TOKEN_IMPORT) {
+		return sb.String()
+	}
+	for {
+		p.consume(TOKEN_IDENTIFIER, "Expect module name.")
+		sb.WriteString(p.previous.Lexeme())
+		if !p.match(TOKEN_DOT) {
+			return sb.String()
+		}
+		sb.WriteString(".")
+	}
+}
+
 // expression parses and compiles expressions starting with assignment precedence.
 // This is the main entry point for parsing any expression in the language.
 // Uses Pratt parsing to handle operator precedence correctly.
@@ -881,7 +947,16 @@ func (p *Parser) block() {
 // swallow the terminator of the enclosing statement (e.g. `var f = func(){...}`).
 func (p *Parser) blockBody() {
 
+	terminated, warned := false, false
 	for !p.check(TOKEN_RIGHT_BRACE) && !p.check(TOKEN_EOF) {
+		if terminated && !warned {
+			p.warn(p.current, WarnUnreachableCode, "Unreachable code.")
+			warned = true
+		}
+		switch p.current.Tokentype {
+		case TOKEN_RETURN, TOKEN_RAISE, TOKEN_BREAK, TOKEN_CONTINUE:
+			terminated = true
+		}
 		p.declaration()
 	}
 	p.consume(TOKEN_RIGHT_BRACE, "Expect '}' after block.")
@@ -890,15 +965,148 @@ func (p *Parser) blockBody() {
 // funcDeclaration parses and compiles function declarations.
 // Creates a global variable for the function name and compiles the function body.
 // The function is marked as initialized before compilation to allow recursive calls.
-func (p *Parser) funcDeclaration() {
+// Any decorators are evaluated after the name is declared and applied to the
+// closure before it is bound, so recursive calls go through the decorated value.
+// isAsync is set for `async func`, the 'async' already consumed with the 'func'.
+func (p *Parser) funcDeclaration(decorators []parserSnapshot, isAsync bool) {
 
 	global := p.parseVariable("Expect function name.")
 	name := p.previous.Lexeme()
 	p.markInitialised()
-	p.function(TYPE_FUNCTION, name, false)
+	decoratorTypes := p.emitDecorators(decorators)
+	p.function(TYPE_FUNCTION, name, false, isAsync)
+	p.applyDecorators(decoratorTypes)
+	p.bindType(name, p.exprType())
 	p.defineVariable(global)
 }
 
+// decoratedDeclaration parses one or more `@expr` lines and the function or
+// class declaration they decorate.
+func (p *Parser) decoratedDeclaration() {
+
+	decorators := p.decorators()
+	if p.match(TOKEN_EXPORT) {
+		p.exportDeclaration(decorators)
+	} else if p.match(TOKEN_CLASS) {
+		p.classDeclaration(decorators)
+	} else if p.match(TOKEN_FUNC) {
+		p.funcDeclaration(decorators, false)
+	} else if p.match(TOKEN_ASYNC) {
+		p.consume(TOKEN_FUNC, "Expect 'func' after 'async'.")
+		p.funcDeclaration(decorators, true)
+	} else {
+		p.errorAtCurrent("Expect function or class declaration after decorator.")
+	}
+}
+
+// exportDeclaration compiles `export` followed by a top-level function,
+// class, variable or constant declaration (the 'export' already consumed),
+// then emits OP_EXPORT so the module records the name as part of its public
+// interface. Once a module exports anything, `from m import *` takes only
+// exported names and importing any other name explicitly is an error. A
+// decorated declaration puts `export` after its decorators.
+func (p *Parser) exportDeclaration(decorators []parserSnapshot) {
+
+	if p.currentCompiler.type_ != TYPE_SCRIPT || p.currentCompiler.scopeDepth > 0 {
+		p.error("Can only export top-level declarations.")
+	}
+	var name Token
+	switch {
+	case p.match(TOKEN_CLASS):
+		name = p.current
+		p.classDeclaration(decorators)
+	case p.match(TOKEN_FUNC):
+		name = p.current
+		p.funcDeclaration(decorators, false)
+	case p.match(TOKEN_ASYNC):
+		p.consume(TOKEN_FUNC, "Expect 'func' after 'async'.")
+		name = p.current
+		p.funcDeclaration(decorators, true)
+	case decorators == nil && p.match(TOKEN_VAR):
+		name = p.current
+		p.varDeclaration(false)
+	case decorators == nil && p.match(TOKEN_CONST):
+		name = p.current
+		p.constDeclaration()
+	default:
+		p.errorAtCurrent("Expect declaration after 'export'.")
+		return
+	}
+	p.emitBytes(core.OP_EXPORT, p.identifierConstant(name))
+}
+
+// decorators records the position of each decorator expression in a run of
+// `@expr` lines (the first '@' already consumed) and skips over them. The
+// expressions are compiled later by emitDecorators, once the declaration's
+// name has been declared, so that a local's stack slot lines up with the
+// decorated value.
+func (p *Parser) decorators() []parserSnapshot {
+
+	var decorators []parserSnapshot
+	for {
+		decorators = append(decorators, p.snapshotPos())
+		depth := 0
+		for !p.check(TOKEN_EOF) {
+			tt := p.current.Tokentype
+			if depth == 0 && (tt == TOKEN_EOL || tt == TOKEN_SEMICOLON) {
+				break
+			}
+			switch tt {
+			case TOKEN_LEFT_PAREN, TOKEN_LEFT_BRACKET, TOKEN_LEFT_BRACE:
+				depth++
+			case TOKEN_RIGHT_PAREN, TOKEN_RIGHT_BRACKET, TOKEN_RIGHT_BRACE:
+				depth--
+			}
+			p.advance()
+		}
+		for p.match(TOKEN_SEMICOLON) {
+		}
+		if !p.match(TOKEN_AT) {
+			return decorators
+		}
+	}
+}
+
+// emitDecorators compiles the decorator expressions in source order, leaving
+// their values on the stack beneath the value about to be defined, and
+// returns their static types for applyDecorators.
+func (p *Parser) emitDecorators(decorators []parserSnapshot) []*TypeExpr {
+
+	if len(decorators) == 0 {
+		return nil
+	}
+	resume := p.snapshotPos()
+	types := make([]*TypeExpr, len(decorators))
+	for i, d := range decorators {
+		p.restorePos(d)
+		p.expression()
+		types[i] = p.exprType()
+		if !p.check(TOKEN_SEMICOLON) && !p.check(TOKEN_EOF) {
+			p.errorAtCurrent("Expect newline after decorator.")
+		}
+	}
+	p.restorePos(resume)
+	return types
+}
+
+// applyDecorators calls each decorator left on the stack by emitDecorators
+// with the value above it, innermost (last written) first, so
+// `@a @b func f` leaves a(b(f)).
+func (p *Parser) applyDecorators(decoratorTypes []*TypeExpr) {
+
+	if len(decoratorTypes) == 0 {
+		return
+	}
+	t := p.exprType()
+	for i := len(decoratorTypes) - 1; i >= 0; i-- {
+		p.emitBytes(core.OP_CALL, 1)
+		if p.tc != nil {
+			t = p.checkCall(decoratorTypes[i], []*TypeExpr{t})
+		}
+	}
+	p.setType(t)
+}
+
 // function compiles a function definition with the specified type (function, method, initializer).
 // Creates a new compiler context for the function scope, parses parameters and body,
 // then generates a closure with proper upvalue handling for captured variables.
@@ -907,18 +1115,34 @@ func (p *Parser) funcDeclaration() {
 // Creates a new compiler context for the function scope, parses parameters,
 // compiles the function body, and generates a closure object with upvalue bindings.
 // Handles parameter limits, nested scopes, and proper closure variable capture.
-func (p *Parser) function(type_ FunctionType, name string, isExpr bool) {
+// An async function's body starts with OP_ASYNC, after the defaults of its
+// parameters are filled in, so a call returns a task running the rest.
+func (p *Parser) function(type_ FunctionType, name string, isExpr bool, isAsync bool) {
 
 	compiler := NewCompiler(type_, p.currentCompiler.scriptName, p.currentCompiler, p.currentCompiler.environment)
 	p.currentCompiler = compiler
 
 	compiler.function.Name = core.MakeStringObject(name)
+	sig := &Signature{Name: name}
+	if p.currentClass != nil && (type_ == TYPE_METHOD || type_ == TYPE_INITIALIZER) {
+		compiler.locals[0].typ = namedType(p.currentClass.name)
+	}
 
 	p.beginScope()
+	compiler.inParams = true
+	if type_ == TYPE_DECORATED_METHOD {
+		// The receiver is passed as the first argument.
+		p.addLocal(SyntheticToken("this"))
+		p.markInitialised()
+		compiler.locals[1].typ = namedType(p.currentClass.name)
+		compiler.function.Arity, compiler.function.MinArity = 1, 1
+		compiler.function.ParamTypes = append(compiler.function.ParamTypes, "")
+		sig.Params = append(sig.Params, Param{Name: "this", Type: compiler.locals[1].typ})
+	}
 
 	p.consume(TOKEN_LEFT_PAREN, "Expect '(' after function name.")
 	if !p.check(TOKEN_RIGHT_PAREN) {
-		minArity := 0
+		minArity := compiler.function.MinArity
 		sawDefault := false
 		sawRest := false
 		for {
@@ -930,7 +1154,9 @@ func (p *Parser) function(type_ FunctionType, name string, isExpr bool) {
 				// Variadic *rest parameter: collects surplus positional args into a list.
 				constant := p.parseVariable("Expect parameter name after '*'.")
 				p.defineVariable(constant)
+				p.parameterAnnotation(sig)
 				p.currentCompiler.function.IsVariadic = true
+				sig.Variadic = true
 				sawRest = true
 				// *rest must be the last parameter.
 				break
@@ -938,16 +1164,19 @@ func (p *Parser) function(type_ FunctionType, name string, isExpr bool) {
 			constant := p.parseVariable("Expect parameter name.")
 			p.defineVariable(constant)
 			slot := uint8(p.currentCompiler.localCount - 1)
+			paramType := p.parameterAnnotation(sig)
 			if p.match(TOKEN_EQUAL) {
 				// Default parameter: emit a prologue guard that runs the default
 				// expression only when the slot is still UNDEFINED (arg omitted).
 				sawDefault = true
+				sig.Params[len(sig.Params)-1].HasDefault = true
 				p.emitByte(core.OP_JUMP_IF_DEFINED)
 				p.emitByte(slot)
 				p.emitByte(0xff)
 				p.emitByte(0xff)
 				off := len(p.currentChunk().Code) - 2
 				p.expression()
+				p.checkAssignable(p.exprType(), paramType, "parameter "+sig.Params[len(sig.Params)-1].Name)
 				p.emitBytes(core.OP_SET_LOCAL, slot)
 				p.emitByte(core.OP_POP)
 				p.patchJump(off)
@@ -968,8 +1197,28 @@ func (p *Parser) function(type_ FunctionType, name string, isExpr bool) {
 	}
 	p.match(TOKEN_EOL)
 	p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after function parameters.")
+	if p.match(TOKEN_ARROW) {
+		compiler.returnType = p.parseTypeAnnotation()
+		compiler.function.ReturnType = annotationString(compiler.returnType)
+		sig.Return = compiler.returnType
+	}
+	if type_ == TYPE_INITIALIZER && p.currentClass != nil {
+		sig.Return = namedType(p.currentClass.name)
+	}
 	p.match(TOKEN_EOL) // allow EOL after parameters
 	p.consume(TOKEN_LEFT_BRACE, "Expect '{' before function body.")
+	// Parameters are part of the function's interface, so an unused one is
+	// not reported.
+	compiler.inParams = false
+	for i := 1; i < compiler.localCount; i++ {
+		compiler.locals[i].used = true
+	}
+	if isAsync {
+		// a call returns the task, not what the body returns
+		sig.Return = nil
+		compiler.async = true
+		p.emitByte(core.OP_ASYNC)
+	}
 	if isExpr {
 		// Lambda: don't consume the trailing EOL after '}' — it belongs to the
 		// enclosing statement (e.g. `var f = func(){...}`).
@@ -990,13 +1239,30 @@ func (p *Parser) function(type_ FunctionType, name string, isExpr bool) {
 		}
 		p.emitByte(uv.index)
 	}
+	p.setType(funcType(sig))
+}
+
+// parameterAnnotation parses the optional `: type` after the parameter just
+// declared, records it on the function object and in sig, and gives the
+// parameter's local its declared type for the checker.
+func (p *Parser) parameterAnnotation(sig *Signature) *TypeExpr {
+
+	name := p.previous.Lexeme()
+	t := p.optionalTypeAnnotation()
+	fn := p.currentCompiler.function
+	fn.ParamTypes = append(fn.ParamTypes, annotationString(t))
+	sig.Params = append(sig.Params, Param{Name: name, Type: t})
+	p.bindType(name, t)
+	return t
 }
 
 // classDeclaration parses and compiles class declarations with optional inheritance.
 // Creates a class object, handles superclass inheritance, sets up class scope,
 // compiles methods (including static methods), and manages the "super" keyword for inherited classes.
 // Class names cannot inherit from themselves and superclasses cannot be from imported modules.
-func (p *Parser) classDeclaration() {
+// Methods are attached to the class by name, so decorators are applied once the body is
+// complete and the result rebound to the class name.
+func (p *Parser) classDeclaration(decorators []parserSnapshot) {
 
 	p.consume(TOKEN_IDENTIFIER, "Expect class name.")
 	className := p.previous
@@ -1011,8 +1277,11 @@ func (p *Parser) classDeclaration() {
 	cc := &ClassCompiler{
 		enclosing:     p.currentClass,
 		hasSuperClass: false,
+		name:          className.Lexeme(),
+		nameToken:     className,
 	}
 	p.currentClass = cc
+	p.bindType(className.Lexeme(), &TypeExpr{Name: "class", Class: className.Lexeme()})
 
 	if p.match(TOKEN_LESS) {
 		p.consume(TOKEN_IDENTIFIER, "Expect superclass name.")
@@ -1023,6 +1292,9 @@ func (p *Parser) classDeclaration() {
 		if p.check(TOKEN_DOT) {
 			p.error("Super class cannot be in an imported module (for now).")
 		}
+		if p.tc != nil {
+			p.tc.class(className.Lexeme()).super = p.previous.Lexeme()
+		}
 		p.beginScope()
 		p.addLocal(SyntheticToken("super"))
 		p.defineVariable(0)
@@ -1044,6 +1316,16 @@ func (p *Parser) classDeclaration() {
 		p.endScope()
 	}
 	p.currentClass = p.currentClass.enclosing
+
+	if len(decorators) > 0 {
+		decoratorTypes := p.emitDecorators(decorators)
+		p.namedVariable(className, false)
+		p.applyDecorators(decoratorTypes)
+		arg, _, setOp := p.resolveVariable(className)
+		p.emitBytes(setOp, uint8(arg))
+		p.emitByte(core.OP_POP)
+		p.bindType(className.Lexeme(), p.exprType())
+	}
 }
 
 // method parses and compiles class methods including static methods and initializers.
@@ -1052,18 +1334,42 @@ func (p *Parser) classDeclaration() {
 // Regular methods are bound to class instances and have access to "this".
 func (p *Parser) method() {
 
+	var decorators []parserSnapshot
+	if p.match(TOKEN_AT) {
+		decorators = p.decorators()
+	}
 	static := false
 	if p.match(TOKEN_STATIC) {
 		static = true
 	}
+	isAsync := p.match(TOKEN_ASYNC)
 
 	p.consume(TOKEN_IDENTIFIER, "Expect method name.")
-	constant := p.identifierConstant(p.previous)
 	name := p.previous.Lexeme()
+	if isAsync && !p.check(TOKEN_LEFT_PAREN) {
+		p.error("Only methods can be async.")
+	}
+
+	if decorators != nil && !p.check(TOKEN_LEFT_PAREN) {
+		p.error("Decorators can only be applied to methods.")
+	}
+	if !static && p.check(TOKEN_COLON) {
+		// Field annotation `name: type`. Instance fields are still created by
+		// assignment; the annotation only informs the checker.
+		t := p.optionalTypeAnnotation()
+		p.consumeStatementEnd("Expect ';' after field annotation")
+		if p.tc != nil {
+			p.tc.class(p.currentClass.name).fields[name] = t
+		}
+		return
+	}
+	constant := p.identifierConstant(p.previous)
 
 	if static && !p.check(TOKEN_LEFT_PAREN) {
+		t := p.optionalTypeAnnotation()
 		if p.match(TOKEN_EQUAL) {
 			p.expression()
+			p.checkAssignable(p.exprType(), t, "class variable "+name)
 		} else {
 			p.emitByte(core.OP_NIL)
 		}
@@ -1078,9 +1384,24 @@ func (p *Parser) method() {
 		if static {
 			p.error("Static initialisers are not allowed.")
 		}
+		if isAsync {
+			p.error("Initialisers can't be async.")
+		}
+		if decorators != nil {
+			p.error("Initialisers can't be decorated.")
+		}
 		_type = TYPE_INITIALIZER
 	}
-	p.function(_type, name, false)
+	if decorators != nil && !static && _type == TYPE_METHOD {
+		p.decoratedMethod(decorators, name, constant, isAsync)
+		return
+	}
+	decoratorTypes := p.emitDecorators(decorators)
+	p.function(_type, name, false, isAsync)
+	p.applyDecorators(decoratorTypes)
+	if p.tc != nil && p.exprType() != nil && p.exprType().Sig != nil {
+		p.tc.class(p.currentClass.name).methods[name] = p.exprType().Sig
+	}
 	if static {
 		p.emitBytes(core.OP_STATIC_METHOD, constant)
 		return
@@ -1088,6 +1409,52 @@ func (p *Parser) method() {
 	p.emitBytes(core.OP_METHOD, constant)
 }
 
+// decoratedMethod compiles an instance method under decorators. As in
+// Python, the decorators are given a function taking the receiver as its
+// first argument, this, and the method is a stub calling what they return
+// with it: m(*args) { return decorated(this, *args); }. What they return is
+// kept in a local of a scope of its own, for the stub to capture; the class
+// is taken off the stack meanwhile, so the local gets the slot it is given.
+func (p *Parser) decoratedMethod(decorators []parserSnapshot, name string, constant uint8, isAsync bool) {
+
+	className := p.currentClass.nameToken
+	p.emitByte(core.OP_POP)
+	p.beginScope()
+	decoratorTypes := p.emitDecorators(decorators)
+	p.function(TYPE_DECORATED_METHOD, name, false, isAsync)
+	p.applyDecorators(decoratorTypes)
+	p.addLocal(SyntheticToken("@dec"))
+	p.markInitialised()
+	decorated := p.currentCompiler.localCount - 1
+	p.currentCompiler.locals[decorated].used = true
+	p.currentCompiler.locals[decorated].isCaptured = true
+
+	p.namedVariable(className, false)
+	compiler := NewCompiler(TYPE_METHOD, p.currentCompiler.scriptName, p.currentCompiler, p.currentCompiler.environment)
+	p.currentCompiler = compiler
+	compiler.function.Name = core.MakeStringObject(name)
+	p.beginScope()
+	p.addLocal(SyntheticToken("args"))
+	p.markInitialised()
+	compiler.locals[1].used = true
+	compiler.function.Arity, compiler.function.IsVariadic = 1, true
+	compiler.function.ParamTypes = append(compiler.function.ParamTypes, "")
+	upvalue := p.addUpvalue(compiler, uint8(decorated), true)
+	p.emitBytes(core.OP_GET_UPVALUE, uint8(upvalue))
+	p.emitBytes(core.OP_GET_LOCAL, 0)
+	p.emitBytes(core.OP_GET_LOCAL, 1)
+	p.emitBytes(core.OP_CALL_SPREAD, 2)
+	p.emitByte(core.OP_RETURN)
+	stub := p.endCompiler()
+	p.emitBytes(core.OP_CLOSURE, p.MakeConstant(core.MakeObjectValue(stub, false)))
+	p.emitBytes(1, uint8(decorated))
+
+	p.emitBytes(core.OP_METHOD, constant)
+	p.emitByte(core.OP_POP)
+	p.endScope()
+	p.namedVariable(className, false)
+}
+
 // varDeclaration parses and compiles variable declarations with optional initialization.
 // Variables without explicit initialization are set to nil.
 // The in_foreach parameter indicates if this is being used in a foreach loop
@@ -1095,9 +1462,12 @@ func (p *Parser) method() {
 func (p *Parser) varDeclaration(in_foreach bool) {
 
 	variable := p.parseVariable("Expect variable name")
+	name := p.previous.Lexeme()
+	declared := p.optionalTypeAnnotation()
 
 	if p.match(TOKEN_EQUAL) {
 		p.expression()
+		p.checkAssignable(p.exprType(), declared, "variable "+name)
 	} else {
 		p.emitByte(core.OP_NIL) // empty local slot
 	}
@@ -1106,6 +1476,7 @@ func (p *Parser) varDeclaration(in_foreach bool) {
 	}
 
 	p.defineVariable(variable)
+	p.bindType(name, declared)
 }
 
 // constDeclaration parses and compiles constant declarations.
@@ -1114,15 +1485,30 @@ func (p *Parser) varDeclaration(in_foreach bool) {
 func (p *Parser) constDeclaration() {
 
 	v := p.parseVariable("Expect variable name")
+	name := p.previous.Lexeme()
+	declared := p.optionalTypeAnnotation()
+	start := len(p.currentChunk().Code)
 
 	if p.match(TOKEN_EQUAL) {
 		p.expression()
+		p.checkAssignable(p.exprType(), declared, "constant "+name)
+		if declared == nil {
+			// a constant can never be reassigned, so its initialiser's type is its type
+			declared = p.exprType()
+		}
 	} else {
 		p.error("Constants must be initialised.")
 	}
 	p.consumeStatementEnd("Expect ';' after variable declaration")
 
+	if p.currentCompiler.scopeDepth == 0 {
+		p.forgetConstGlobal(int(v))
+		if value, ok := ConstantValue(p.currentChunk(), start); ok && !p.hadError {
+			p.constGlobals[int(v)] = value
+		}
+	}
 	p.defineConstVariable(v)
+	p.bindType(name, declared)
 }
 
 // isVariableDefined checks if a variable is already defined in the current scope or as a global.
@@ -1155,6 +1541,7 @@ func (p *Parser) handleImplicitDeclaration() bool {
 		name := p.current
 		l := name.Lexeme()
 		if !p.isVariableDefined(name, l) {
+			p.warn(name, WarnImplicitDeclaration, fmt.Sprintf("Assignment declares '%s'; use 'var %s' to declare it explicitly.", l, l))
 			if p.currentCompiler.scopeDepth > 0 {
 				p.varDeclaration(false)
 			} else {
@@ -1217,6 +1604,7 @@ func (p *Parser) handleUnpackingAssignment() bool {
 					//core.LogFmtLn(core.DEBUG, "Implicitly declaring global variable %s\n", name.Str)
 					arg := p.globalSlot(name.Str)
 					p.markGlobalDeclared(name.Str)
+					p.forgetConstGlobal(arg)
 					// OP_DEFINE_GLOBAL pops the value, so no separate OP_POP needed.
 					p.emitBytes(core.OP_DEFINE_GLOBAL, uint8(arg))
 				}
@@ -1253,7 +1641,7 @@ func (p *Parser) expressionStatement() {
 func (p *Parser) ifStatement() {
 
 	p.consume(TOKEN_LEFT_PAREN, "Expect '(' after 'if'.")
-	p.expression()
+	p.condition()
 	p.consume(TOKEN_RIGHT_PAREN, "Expect '(' after condition.")
 
 	thenJump := p.emitJump(core.OP_JUMP_IF_FALSE)
@@ -1284,12 +1672,14 @@ func (p *Parser) returnStatement() {
 			p.emitBytes(core.OP_GET_LOCAL, 0)
 		} else {
 			p.emitByte(core.OP_NIL)
+			p.checkReturn(namedType("nil"))
 		}
 	} else {
 		if p.currentCompiler.type_ == TYPE_INITIALIZER {
 			p.error("Can't return from an initializer.")
 		}
 		p.expression()
+		p.checkReturn(p.exprType())
 		p.consumeStatementEnd("Expect ';' after return value.")
 	}
 
@@ -1343,7 +1733,7 @@ func (p *Parser) whileStatement() {
 
 	p.currentCompiler.loop.start = len(p.currentChunk().Code)
 	p.consume(TOKEN_LEFT_PAREN, "Expect '(' after while.")
-	p.expression()
+	p.condition()
 	p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after condition.")
 
 	exitJump := p.emitJump(core.OP_JUMP_IF_FALSE)
@@ -1384,7 +1774,7 @@ func (p *Parser) forStatement() {
 	// exit condition
 	exitJump := -1
 	if !p.match(TOKEN_SEMICOLON) {
-		p.expression()
+		p.condition()
 		p.consume(TOKEN_SEMICOLON, "Expect ';'.")
 		exitJump = p.emitJump(core.OP_JUMP_IF_FALSE)
 		p.emitByte(core.OP_POP)
@@ -1539,6 +1929,7 @@ func (p *Parser) foreachStatement() {
 	p.consume(TOKEN_LEFT_PAREN, "Expect '(' after for.")
 	p.match(TOKEN_VAR)
 	p.varDeclaration(true)
+	p.markUsed() // a loop that only counts iterations need not read its variable
 	slot := p.currentCompiler.localCount - 1
 	p.consume(TOKEN_IN, "Expect in after foreach variable.")
 
@@ -1606,21 +1997,11 @@ func (p *Parser) synchronize() {
 			return
 		}
 		switch p.current.Tokentype {
-		case TOKEN_CLASS:
-			return
-		case TOKEN_FUNC:
-			return
-		case TOKEN_FOR:
-			return
-		case TOKEN_VAR:
-			return
-		case TOKEN_IF:
+		case TOKEN_CLASS, TOKEN_FUNC, TOKEN_ASYNC, TOKEN_VAR, TOKEN_CONST, TOKEN_EXPORT:
 			return
-		case TOKEN_WHILE:
+		case TOKEN_FOR, TOKEN_FOREACH, TOKEN_IF, TOKEN_WHILE, TOKEN_TRY:
 			return
-		case TOKEN_PRINT:
-			return
-		case TOKEN_RETURN:
+		case TOKEN_PRINT, TOKEN_RETURN, TOKEN_RAISE, TOKEN_IMPORT, TOKEN_FROM:
 			return
 		}
 		p.advance()
@@ -1747,14 +2128,16 @@ func (p *Parser) currentChunk() *core.Chunk {
 }
 
 // endCompiler finalizes compilation of the current function and returns to the enclosing compiler.
-// Emits a return instruction, and runs peep-hole optimizations on the current chunk.
+// Emits a return instruction, and runs constant folding and peep-hole optimizations on the current chunk.
 // optionally disassembles the generated bytecode for debugging,
 // and restores the previous compiler context. Returns the completed function object.
 func (p *Parser) endCompiler() *core.FunctionObject {
 
+	p.warnUnused(1)
 	p.emitReturn()
 
 	if !core.DebugSkipPeephole {
+		FoldConstants(p.currentChunk())
 		p.peepHoleOptimise()
 	}
 
@@ -1802,6 +2185,12 @@ func (p *Parser) endScope() {
 	c := p.currentCompiler
 	c.scopeDepth--
 
+	first := c.localCount
+	for first > 0 && c.locals[first-1].depth > c.scopeDepth {
+		first--
+	}
+	p.warnUnused(first)
+
 	// drop local vars on stack
 	for c.localCount > 0 && c.locals[c.localCount-1].depth > c.scopeDepth {
 		if c.locals[c.localCount-1].isCaptured {
@@ -1844,14 +2233,18 @@ func (p *Parser) parsePrecedence(prec Precedence) {
 	}
 
 	canAssign := prec <= PREC_ASSIGNMENT
+	p.beginRule()
 	prefixRule(p, canAssign)
+	p.endRule()
 	for prec <= p.getRule(p.current.Tokentype).prec {
 
 		p.advance()
 		infixRule := p.getRule(p.previous.Tokentype).infix
 		if infixRule != nil {
 
+			p.beginRule()
 			infixRule(p, canAssign)
+			p.endRule()
 		}
 
 	}
@@ -2025,19 +2418,31 @@ func (p *Parser) defineVariable(global uint8) {
 		return
 	}
 	// global is a compiler-assigned slot index (not a constant table index)
+	p.forgetConstGlobal(int(global))
 	p.emitBytes(core.OP_DEFINE_GLOBAL, global)
 }
 
 // argumentList parses function call arguments and returns the argument count.
 // Handles comma-separated expression list within parentheses.
 // Enforces the 255 argument limit and validates proper parentheses syntax.
-// Returns the number of arguments parsed for the function call bytecode.
-func (p *Parser) argumentList() uint8 {
+// Returns the number of arguments parsed for the function call bytecode, and
+// whether the last one is a spread (`*args`), whose list or tuple the VM
+// expands into the arguments it holds.
+func (p *Parser) argumentList() (uint8, bool) {
 
 	var argCount uint8 = 0
+	var argTypes []*TypeExpr
+	spread := false
 	if !p.check(TOKEN_RIGHT_PAREN) {
 		for {
+			if spread {
+				p.error("Spread argument must be last.")
+			}
+			spread = p.match(TOKEN_STAR)
 			p.expression()
+			if !spread {
+				argTypes = append(argTypes, p.exprType())
+			}
 			argCount += 1
 			if argCount == 255 {
 				p.error("Can't have more than 255 arguments. ")
@@ -2049,7 +2454,11 @@ func (p *Parser) argumentList() uint8 {
 	}
 	p.match(TOKEN_EOL) // allow EOL after arguments
 	p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after arguments")
-	return argCount
+	if p.tc != nil {
+		p.tc.lastArgs = argTypes
+		p.tc.lastSpread = spread
+	}
+	return argCount, spread
 }
 
 // parseList parses list literal syntax and returns the element count.
@@ -2137,9 +2546,13 @@ func (p *Parser) declareVariable() {
 			break
 		}
 		if p.identifiersEqual(name, local.name) {
-			p.error("Already a variable with this name in this scope.")
+			p.errorAt(name, "Already a variable with this name in this scope.",
+				Note{Span: p.tokenSpan(local.name), Message: "previous declaration of '" + local.lexeme + "' is here"})
 		}
 	}
+	if !p.currentCompiler.inParams {
+		p.warnShadowing(name)
+	}
 	p.addLocal(name)
 }
 
@@ -2205,18 +2618,66 @@ func (p *Parser) namedVariable(name Token, canAssign bool) {
 	// Reject `const` local reassignment up front, so it covers both plain (`x = v`)
 	// and compound (`x += v`) assignment.
 	if canAssign && p.isConstLocal(setOp, arg) && p.assignmentFollows() {
-		p.error(fmt.Sprintf("Cannot assign to const '%s'.", name.Lexeme()))
+		decl := p.currentCompiler.locals[arg].name
+		p.errorAt(name, fmt.Sprintf("Cannot assign to const '%s'.", name.Lexeme()),
+			Note{Span: p.tokenSpan(decl), Message: "'" + decl.Lexeme() + "' is declared const here"})
 		return
 	}
 
 	if p.handleCompoundAssignment(canAssign, getOp, setOp, arg) {
+		p.markLocalRead(getOp, arg)
 		return
 	}
+	declared := p.lookupType(name.Lexeme())
 	if canAssign && p.match(TOKEN_EQUAL) {
 		p.expression()
+		p.checkAssignable(p.exprType(), declared, "variable "+name.Lexeme())
 		p.emitBytes(setOp, uint8(arg))
+	} else if value, ok := p.constGlobal(getOp, arg); ok {
+		p.emitConstant(value)
+		p.setType(declared)
 	} else {
 		p.emitBytes(getOp, uint8(arg))
+		p.markLocalRead(getOp, arg)
+		p.setType(declared)
+	}
+}
+
+// constGlobal returns the value of the const global a read refers to, when
+// it was declared with a constant initialiser and the read is in the
+// script's top-level code. There the read runs after the declaration and
+// before any later redeclaration of the name, which a function body, called
+// who knows when, cannot promise.
+func (p *Parser) constGlobal(getOp uint8, slot int) (core.Value, bool) {
+
+	if getOp != core.OP_GET_GLOBAL || p.currentCompiler.enclosing != nil || core.DebugSkipPeephole {
+		return core.NIL_VALUE, false
+	}
+	value, ok := p.constGlobals[slot]
+	return value, ok
+}
+
+// forgetConstGlobal stops reads of a global being replaced by its value,
+// once the name is declared again or bound by an import.
+func (p *Parser) forgetConstGlobal(slot int) {
+
+	delete(p.constGlobals, slot)
+}
+
+// markLocalRead records that the local in slot arg has been read, when getOp
+// says the variable is a local of the current function.
+func (p *Parser) markLocalRead(getOp uint8, arg int) {
+
+	if getOp == core.OP_GET_LOCAL {
+		p.currentCompiler.locals[arg].used = true
+	}
+}
+
+// markUsed exempts the local just declared from the unused-variable warning.
+func (p *Parser) markUsed() {
+
+	if c := p.currentCompiler; c.scopeDepth > 0 {
+		c.locals[c.localCount-1].used = true
 	}
 }
 
@@ -2466,28 +2927,45 @@ func (p *Parser) error(msg string) {
 	p.errorAt(p.previous, msg)
 }
 
-// errorAt reports a compilation error at a specific token location.
-// Formats and prints error messages with file name, line number, and context.
-// Activates panic mode to prevent cascading errors during error recovery.
-// Includes special handling for EOF and ERROR tokens for better diagnostics.
-func (p *Parser) errorAt(tok Token, msg string) {
+// errorAt records a compilation error at a specific token location.
+// While panicMode is set further errors are suppressed until synchronize()
+// finds the start of the next statement, so one mistake yields one
+// diagnostic.
+func (p *Parser) errorAt(tok Token, msg string, related ...Note) {
 
 	if p.panicMode {
 		return
 	}
 	p.panicMode = true
-	fmt.Printf("In %s: ", p.currentCompiler.scriptName)
-	fmt.Printf("[line %d] Error ", tok.Line)
+	p.hadError = true
+	d := Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeSyntax,
+		Span:     p.tokenSpan(tok),
+		Message:  msg,
+		Related:  related,
+	}
 	switch tok.Tokentype {
 	case TOKEN_EOF:
-		fmt.Printf(" at end")
 	case TOKEN_ERROR:
-		fmt.Printf(" at %s ", tok.Lexeme())
+		// the lexeme is the scanner's message; point at the source instead
+		d.Near = p.scn.Source[tok.Offset : tok.Offset+tok.Width]
 	default:
-		fmt.Printf(" at %s ", tok.Lexeme())
+		d.Near = tok.Lexeme()
 	}
-	fmt.Printf(" : %s\n", msg)
-	p.hadError = true
+	p.report(d)
+}
+
+// report records a diagnostic, unless one with the same place and message
+// is already recorded (source replayed for a finally block, say).
+func (p *Parser) report(d Diagnostic) {
+
+	for _, prev := range p.diagnostics {
+		if prev.Span == d.Span && prev.Message == d.Message {
+			return
+		}
+	}
+	p.diagnostics = append(p.diagnostics, d)
 }
 
 //=============================================================================
@@ -2500,8 +2978,11 @@ func (p *Parser) errorAt(tok Token, msg string) {
 func binary(p *Parser, canAssign bool) {
 
 	opType := p.previous.Tokentype
+	opLexeme := p.previous.Lexeme()
+	left := p.exprType()
 	rule := p.getRule(opType)
 	p.parsePrecedence(Precedence(rule.prec + 1))
+	p.setType(p.binaryType(opType, opLexeme, left, p.exprType()))
 
 	switch opType {
 	case TOKEN_PLUS:
@@ -2541,7 +3022,27 @@ func binary(p *Parser, canAssign bool) {
 // emits OP_CLOSURE, leaving the closure value on the stack.
 func lambda(p *Parser, canAssign bool) {
 
-	p.function(TYPE_FUNCTION, "<lambda>", true)
+	p.function(TYPE_FUNCTION, "<lambda>", true, false)
+}
+
+// asyncLambda parses an async anonymous function expression, `async func
+// (params) { body }`, the 'async' already consumed.
+func asyncLambda(p *Parser, canAssign bool) {
+
+	p.consume(TOKEN_FUNC, "Expect 'func' after 'async'.")
+	p.function(TYPE_FUNCTION, "<lambda>", true, true)
+}
+
+// await compiles `await x`: x, then OP_AWAIT, which suspends the running
+// task until x is done and leaves what it produced in its place.
+func await(p *Parser, canAssign bool) {
+
+	if !p.currentCompiler.async {
+		p.error("Can't use 'await' outside an async function.")
+	}
+	p.parsePrecedence(PREC_UNARY)
+	p.emitByte(core.OP_AWAIT)
+	p.setType(nil)
 }
 
 // grouping handles parenthesized expressions and tuple literals.
@@ -2563,8 +3064,10 @@ func grouping(p *Parser, canAssign bool) {
 		p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after tuple.")
 		p.emitByte(core.OP_CREATE_TUPLE)
 		p.emitByte(uint8(arity))
+		p.setType(namedType("tuple"))
 	} else {
 		p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after expression.")
+		p.setType(p.exprType())
 	}
 }
 
@@ -2575,6 +3078,7 @@ func float(p *Parser, canAssign bool) {
 
 	val, _ := strconv.ParseFloat(p.previous.Lexeme(), 64)
 	p.emitConstant(core.MakeFloatValue(val, false))
+	p.setType(namedType("float"))
 
 }
 
@@ -2585,6 +3089,7 @@ func int_(p *Parser, canAssign bool) {
 
 	val, _ := strconv.ParseInt(p.previous.Lexeme(), 10, 32)
 	p.emitConstant(core.MakeIntValue(int(val), false))
+	p.setType(namedType("int"))
 
 }
 
@@ -2598,6 +3103,7 @@ func loxstring(p *Parser, canAssign bool) {
 
 	v := core.MakeStringObjectValue(str, false)
 	p.emitConstant(v)
+	p.setType(namedType("string"))
 
 }
 
@@ -2620,8 +3126,12 @@ func unary(p *Parser, canAssign bool) {
 	switch opType {
 	case TOKEN_MINUS:
 		p.emitByte(core.OP_NEGATE)
+		if operand := p.exprType(); operand.isNumeric() || (operand != nil && strings.HasPrefix(operand.Name, "vec")) {
+			p.setType(operand)
+		}
 	case TOKEN_BANG:
 		p.emitByte(core.OP_NOT)
+		p.setType(namedType("bool"))
 	}
 }
 
@@ -2633,10 +3143,13 @@ func literal(p *Parser, canAssign bool) {
 	switch p.previous.Tokentype {
 	case TOKEN_NIL:
 		p.emitByte(core.OP_NIL)
+		p.setType(namedType("nil"))
 	case TOKEN_FALSE:
 		p.emitByte(core.OP_FALSE)
+		p.setType(namedType("bool"))
 	case TOKEN_TRUE:
 		p.emitByte(core.OP_TRUE)
+		p.setType(namedType("bool"))
 	}
 }
 
@@ -2676,23 +3189,34 @@ func conditional(p *Parser, canAssign bool) {
 	elseJump := p.emitJump(core.OP_JUMP_IF_FALSE)
 	p.emitByte(core.OP_POP) // true path: discard condition
 	p.parsePrecedence(PREC_CONDITIONAL)
+	thenType := p.exprType()
 	endJump := p.emitJump(core.OP_JUMP)
 
 	p.patchJump(elseJump)
 	p.emitByte(core.OP_POP) // false path: discard condition
 	p.consume(TOKEN_COLON, "Expect ':' in conditional expression.")
 	p.parsePrecedence(PREC_CONDITIONAL)
+	p.setType(sameType(thenType, p.exprType()))
 
 	p.patchJump(endJump)
 }
 
 // call handles function call expressions.
-// Parses the argument list and emits OP_CALL with the argument count.
+// Parses the argument list and emits OP_CALL with the argument count, or
+// OP_CALL_SPREAD when the last argument is spread.
 // Part of the infix parsing rules for parentheses in call position.
 func call(p *Parser, canAssign bool) {
 
-	argCount := p.argumentList()
-	p.emitBytes(core.OP_CALL, argCount)
+	callee := p.exprType()
+	argCount, spread := p.argumentList()
+	if spread {
+		p.emitBytes(core.OP_CALL_SPREAD, argCount)
+	} else {
+		p.emitBytes(core.OP_CALL, argCount)
+	}
+	if p.tc != nil {
+		p.setType(p.checkCall(callee, p.tc.lastArgs))
+	}
 }
 
 // dot handles property access and method calls on objects.
@@ -2703,23 +3227,35 @@ func call(p *Parser, canAssign bool) {
 
 func dot(p *Parser, canAssign bool) {
 
+	object := p.exprType()
 	p.consume(TOKEN_IDENTIFIER, "Expect property name after '.'.")
+	propName := p.previous.Lexeme()
 	name := p.identifierConstant(p.previous)
 
 	if p.handlePropertyCompoundAssignment(canAssign, name) {
 		return
 	}
 
+	member := p.memberType(object, propName)
 	if canAssign && p.match(TOKEN_EQUAL) {
 		p.expression()
+		p.checkAssignable(p.exprType(), member, "field "+propName)
 		p.emitBytes(core.OP_SET_PROPERTY, name)
 	} else if p.match(TOKEN_LEFT_PAREN) {
-		argCount := p.argumentList()
-		p.emitBytes(core.OP_INVOKE, name)
+		argCount, spread := p.argumentList()
+		if spread {
+			p.emitBytes(core.OP_INVOKE_SPREAD, name)
+		} else {
+			p.emitBytes(core.OP_INVOKE, name)
+		}
 		p.emitByte(argCount)
+		if p.tc != nil {
+			p.setType(p.checkCall(member, p.tc.lastArgs))
+		}
 	} else {
 
 		p.emitBytes(core.OP_GET_PROPERTY, name)
+		p.setType(member)
 	}
 }
 
@@ -2767,76 +3303,11 @@ func (p *Parser) handlePropertyCompoundAssignment(canAssign bool, name uint8) bo
 	return false
 }
 
+// peepHoleOptimise rewrites common instruction sequences in the chunk just
+// compiled into faster equivalents; see PeepholeOptimise.
 func (p *Parser) peepHoleOptimise() {
-	chunk := p.currentChunk()
-	code := chunk.Code
-
-	// Need at least 8 bytes for the pattern: GET_LOCAL(2) + GET_LOCAL(2) + ADD_NUMERIC(1) + SET_LOCAL(2) + POP(1)
-	if len(code) < 8 {
-		return
-	}
-
-	i := 0
-
-	for i <= len(code)-8 {
-		// Look for pattern: GET_LOCAL X, GET_LOCAL Y, ADD_NUMERIC, SET LOCAL X, POP
-		if code[i] == core.OP_GET_LOCAL &&
-			code[i+2] == core.OP_GET_LOCAL &&
-			code[i+4] == core.OP_ADD_NUMERIC &&
-			code[i+5] == core.OP_SET_LOCAL &&
-			code[i+7] == core.OP_POP {
-			// Extract slot indices
-			slotX := code[i+1]
-			slotY := code[i+3]
-			slotSet := code[i+6]
-
-			// Verify it's increment pattern: x = x + y
-			if slotX == slotSet {
-				// Replace entire sequence with increment instruction
-				code[i] = core.OP_ADD_NN // x += y
-				code[i+1] = slotX        // destination slot
-				code[i+2] = slotY        // increment slot
-				code[i+3] = core.OP_NOOP
-				code[i+4] = core.OP_NOOP
-				code[i+5] = core.OP_NOOP
-				code[i+6] = core.OP_NOOP
-				code[i+7] = core.OP_NOOP
-
-				i += 8
-				continue
-			}
-		}
-		// Pattern: GET_LOCAL X, CONSTANT Y, ADD_NUMERIC, SET_LOCAL X, POP
-		if code[i] == core.OP_GET_LOCAL &&
-			code[i+2] == core.OP_CONSTANT &&
-			code[i+4] == core.OP_ADD_NUMERIC &&
-			code[i+5] == core.OP_SET_LOCAL &&
-			code[i+7] == core.OP_POP {
-
-			slotVar := code[i+1]    // variable slot
-			constIndex := code[i+3] // constant index
-			slotSet := code[i+6]    // set destination
-
-			// Verify it's increment pattern: x = x + constant
-			if slotVar == slotSet {
-				// Replace with increment-by-constant instruction
-				code[i] = core.OP_INCR_CONST_N // x += constant
-				code[i+1] = slotVar            // variable slot
-				code[i+2] = constIndex         // constant index
-				code[i+3] = core.OP_NOOP
-				code[i+4] = core.OP_NOOP
-				code[i+5] = core.OP_NOOP
-				code[i+6] = core.OP_NOOP
-				code[i+7] = core.OP_NOOP
-
-				i += 8
-				continue
-			}
-		}
-		i++
-
-	}
 
+	PeepholeOptimise(p.currentChunk())
 }
 
 // this handles 'this' keyword references in instance methods.
@@ -2867,9 +3338,13 @@ func super(p *Parser, canAssign bool) {
 	name := p.identifierConstant(p.previous)
 	p.namedVariable(SyntheticToken("this"), false)
 	if p.match(TOKEN_LEFT_PAREN) {
-		argCount := p.argumentList()
+		argCount, spread := p.argumentList()
 		p.namedVariable(SyntheticToken("super"), false)
-		p.emitBytes(core.OP_SUPER_INVOKE, name)
+		if spread {
+			p.emitBytes(core.OP_SUPER_INVOKE_SPREAD, name)
+		} else {
+			p.emitBytes(core.OP_SUPER_INVOKE, name)
+		}
 		p.emitByte(argCount)
 	} else {
 		p.namedVariable(SyntheticToken("super"), false)
@@ -2884,6 +3359,7 @@ func listLiteral(p *Parser, canAssign bool) {
 
 	listCount := p.parseList()
 	p.emitBytes(core.OP_CREATE_LIST, listCount)
+	p.setType(namedType("list"))
 }
 
 // dictLiteral handles dictionary literal expressions {key1: value1, key2: value2, ...}.
@@ -2893,6 +3369,7 @@ func dictLiteral(p *Parser, canAssign bool) {
 
 	dictCount := p.parseDict()
 	p.emitBytes(core.OP_CREATE_DICT, dictCount)
+	p.setType(namedType("dict"))
 }
 
 // slice handles indexing and slicing operations: var[expr], var[:], var[start:end], etc.
@@ -2911,11 +3388,13 @@ func slice(p *Parser, canAssign bool) {
 	}
 
 	_ = p.identifierConstant(p.previous)
+	container := p.exprType()
 
 	// handle the slice variants : [exp], [:], [:exp], [exp:], [exp:exp]
 	if p.match(TOKEN_COLON) {
 		//[:],[:exp]
 		p.slice1(canAssign)
+		p.setType(container)
 
 	} else {
 		// [exp],[exp:],[exp:exp]
@@ -2924,12 +3403,13 @@ func slice(p *Parser, canAssign bool) {
 		if p.match(TOKEN_RIGHT_BRACKET) {
 			//[exp]
 			p.index(canAssign)
+			p.setType(elementType(container))
 
 		} else {
 			// [exp:],[exp:exp]
 			if p.match(TOKEN_COLON) {
 				p.slice2(canAssign)
-
+				p.setType(container)
 			}
 		}
 	}
@@ -2943,4 +3423,5 @@ func str_(p *Parser, canAssign bool) {
 	p.expression()
 	p.consume(TOKEN_RIGHT_PAREN, "Expect ')' after expression.")
 	p.emitByte(core.OP_STR)
+	p.setType(namedType("string"))
 }
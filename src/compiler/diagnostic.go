@@ -0,0 +1,133 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Severity says how serious a Diagnostic is. Only errors stop a compile.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// MarshalText makes a Severity appear by name in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+
+	return []byte(s.String()), nil
+}
+
+// Diagnostic codes. A code names the kind of problem, independent of the
+// wording of the message, so tools can filter on it. Warnings use their own
+// names (WarnUnusedVariable and so on) as codes.
+const (
+	CodeSyntax = "syntax" // the source could not be parsed or compiled
+	CodeType   = "type"   // the static checker (glox check) found a type mismatch
+)
+
+// Span locates a diagnostic in a source file. Line and Column are 1-based,
+// Column counting characters; Offset and Length are in bytes.
+type Span struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+func (s Span) String() string {
+
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
+
+// Note is additional information attached to a Diagnostic, pointing at a
+// related location such as an earlier declaration.
+type Note struct {
+	Span    Span   `json:"span"`
+	Message string `json:"message"`
+}
+
+// Diagnostic is a single problem found while compiling or checking a file.
+// Compile, CompileRepl and Check return them rather than printing, so the
+// caller decides how to present them: String() gives the one-line text form
+// the command line has always printed, JSON() a machine-readable one.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Span     Span     `json:"span"`
+	Near     string   `json:"near,omitempty"` // text of the offending token, "" at end of file
+	Message  string   `json:"message"`
+	Related  []Note   `json:"related,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+
+	kind := "Error"
+	switch {
+	case d.Code == CodeType:
+		kind = "Type error"
+	case d.Severity == SeverityWarning:
+		kind = "Warning"
+	}
+	rv := fmt.Sprintf("In %s: [line %d:%d] %s", d.Span.File, d.Span.Line, d.Span.Column, kind)
+	switch {
+	case d.Code == CodeType:
+	case d.Near == "":
+		rv += " at end"
+	default:
+		rv += fmt.Sprintf(" at '%s'", d.Near)
+	}
+	rv += " : " + d.Message
+	if d.Code != CodeSyntax && d.Code != CodeType {
+		rv += " [" + d.Code + "]" // the warning's name, for -W flags and glox:ignore
+	}
+	for _, n := range d.Related {
+		rv += fmt.Sprintf("\n    [line %d:%d] note : %s", n.Span.Line, n.Span.Column, n.Message)
+	}
+	return rv
+}
+
+// JSON encodes the diagnostic as a single line of JSON.
+func (d Diagnostic) JSON() string {
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Sprintf(`{"severity":"error","message":%q}`, err.Error())
+	}
+	return string(b)
+}
+
+// HasErrors reports whether any of diags is an error.
+func HasErrors(diags []Diagnostic) bool {
+
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenSpan returns the span of tok in the file being compiled.
+func (p *Parser) tokenSpan(tok Token) Span {
+
+	return Span{
+		File:   p.currentCompiler.scriptName,
+		Line:   tok.Line,
+		Column: tok.Column,
+		Offset: tok.Offset,
+		Length: tok.Width,
+	}
+}
@@ -0,0 +1,41 @@
+package compiler
+
+import "testing"
+
+// The diagnostics API is for Go callers (editors, CI tooling), so these check
+// it directly rather than through the printed output.
+
+func TestCompileReturnsDiagnosticsWithSpans(t *testing.T) {
+	src := "var x = 1;\nprint x +;\nvar = 2;\n"
+	fn, diags := Compile("test.lox", src, "__main__")
+	if fn != nil {
+		t.Fatal("expected compile to fail")
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d: %v", len(diags), diags)
+	}
+	d := diags[0]
+	if d.Severity != SeverityError || d.Code != CodeSyntax || d.Message != "Expect expression" {
+		t.Fatalf("unexpected first diagnostic: %+v", d)
+	}
+	if d.Span.Line != 2 || d.Span.Column != 10 || d.Span.Offset != 20 || d.Span.Length != 1 || d.Near != ";" {
+		t.Fatalf("unexpected span: %+v near %q", d.Span, d.Near)
+	}
+	if diags[1].Span.Line != 3 || diags[1].Span.Column != 5 {
+		t.Fatalf("unexpected second span: %+v", diags[1].Span)
+	}
+}
+
+func TestCompileSucceedsWithoutDiagnostics(t *testing.T) {
+	fn, diags := Compile("test.lox", "print 1;\n", "__main__")
+	if fn == nil || len(diags) != 0 || HasErrors(diags) {
+		t.Fatalf("expected a clean compile, got %v", diags)
+	}
+}
+
+func TestColumnsCountCharacters(t *testing.T) {
+	_, diags := Compile("test.lox", "print \"héllo\" +;\n", "__main__")
+	if len(diags) != 1 || diags[0].Span.Column != 16 {
+		t.Fatalf("expected one error at column 16, got %v", diags)
+	}
+}
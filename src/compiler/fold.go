@@ -0,0 +1,405 @@
+package compiler
+
+import (
+	"math"
+
+	"glox/src/core"
+)
+
+// FoldConstants evaluates, at compile time, the parts of a chunk that only
+// combine constants: arithmetic, string concatenation, comparisons and
+// negation. A conditional jump on a constant becomes an unconditional jump
+// or disappears, and code no path can reach -- a branch that is never
+// taken, statements after a return -- is removed. Jump offsets, the line
+// of every byte and the LocalVars ranges are kept consistent with the new
+// code. An operation that would fail at run time, such as a division by
+// zero, is left for the VM to report. Like PeepholeOptimise, which runs
+// after it, it is exported so package ast emits the same bytecode.
+func FoldConstants(chunk *core.Chunk) {
+
+	code, ok := decode(chunk)
+	if !ok {
+		return
+	}
+	changed := false
+	for {
+		f := &folder{chunk: chunk, code: code}
+		if !f.fold() && !f.removeUnreachable() {
+			break
+		}
+		code = compact(f.code)
+		changed = true
+	}
+	if changed {
+		encode(chunk, code)
+	}
+}
+
+// ConstantValue reports the value the code emitted into chunk from start
+// to its end always leaves on the stack, when that code is an expression
+// FoldConstants would reduce to a constant. The compilers use it to spot a
+// const global with a constant initialiser.
+func ConstantValue(chunk *core.Chunk, start int) (core.Value, bool) {
+
+	sub := &core.Chunk{Code: chunk.Code[start:], Constants: chunk.Constants, Lines: chunk.Lines[start:]}
+	code, ok := decode(sub)
+	if !ok {
+		return core.NIL_VALUE, false
+	}
+	var stack []core.Value
+	for _, in := range code {
+		switch {
+		case loadsConstant(in):
+			v, ok := constantOf(chunk, in)
+			if !ok {
+				return core.NIL_VALUE, false
+			}
+			stack = append(stack, v)
+		case unaryOp(in.op) && len(stack) >= 1:
+			v, ok := foldUnary(in.op, stack[len(stack)-1])
+			if !ok {
+				return core.NIL_VALUE, false
+			}
+			stack[len(stack)-1] = v
+		case binaryOp(in.op) && len(stack) >= 2:
+			v, ok := foldBinary(in.op, stack[len(stack)-2], stack[len(stack)-1])
+			if !ok {
+				return core.NIL_VALUE, false
+			}
+			stack = append(stack[:len(stack)-2], v)
+		default:
+			return core.NIL_VALUE, false
+		}
+	}
+	if len(stack) != 1 {
+		return core.NIL_VALUE, false
+	}
+	return stack[0], true
+}
+
+// folder makes one pass of rewrites over a function's instructions.
+type folder struct {
+	chunk    *core.Chunk
+	code     []instruction
+	targeted []bool // whether some jump goes to the instruction
+}
+
+// fold rewrites each run of instructions that computes a constant, and
+// each jump that depends on one. A run never extends over a jump target
+// after its first instruction, since code arriving there has its own
+// stack.
+func (f *folder) fold() bool {
+
+	f.targeted = make([]bool, len(f.code)+1)
+	for _, in := range f.code {
+		if in.target >= 0 {
+			f.targeted[in.target] = true
+		}
+	}
+	changed := false
+	for i := 0; i < len(f.code); i++ {
+		if n := f.rewrite(i); n > 0 {
+			changed = true
+			i += n - 1
+		}
+	}
+	return changed
+}
+
+// rewrite tries each rule on the instructions starting at i and returns
+// how many it consumed, or 0.
+func (f *folder) rewrite(i int) int {
+
+	if f.code[i].op == core.OP_JUMP && f.code[i].target == i+1 {
+		// a jump to the next instruction, left by removing what it skipped
+		f.code[i].dead = true
+		return 1
+	}
+	if !loadsConstant(f.code[i]) {
+		return 0
+	}
+	a, ok := constantOf(f.chunk, f.code[i])
+	if !ok {
+		return 0
+	}
+	next, ok := f.following(i, 1)
+	if !ok {
+		return 0
+	}
+	switch {
+	case unaryOp(next.op):
+		// constant, NEGATE or NOT
+		if v, ok := foldUnary(next.op, a); ok {
+			return f.replace(i, 2, v)
+		}
+	case next.op == core.OP_POP:
+		// a constant that is pushed and dropped
+		f.code[i].dead = true
+		f.code[i+1].dead = true
+		return 2
+	case next.op == core.OP_JUMP_IF_FALSE:
+		// OP_JUMP_IF_FALSE leaves the condition for the OP_POP on each
+		// side to drop, so a jump that is always taken keeps it.
+		if isFalsey(a) {
+			f.code[i+1].op = core.OP_JUMP
+		} else {
+			f.code[i+1].dead = true
+		}
+		return 2
+	case next.op == core.OP_JUMP && next.target < len(f.code) && f.code[next.target].op == core.OP_POP:
+		// a constant carried over a jump only to be dropped
+		f.code[i].dead = true
+		f.code[i+1].target = next.target + 1
+		return 2
+	case loadsConstant(next):
+		op, ok := f.following(i, 2)
+		if !ok || !binaryOp(op.op) {
+			return 0
+		}
+		b, ok := constantOf(f.chunk, next)
+		if !ok {
+			return 0
+		}
+		if v, ok := foldBinary(op.op, a, b); ok {
+			return f.replace(i, 3, v)
+		}
+	}
+	return 0
+}
+
+// following returns the instruction n after i, provided no jump lands on
+// it or anything between.
+func (f *folder) following(i, n int) (instruction, bool) {
+
+	for j := i + 1; j <= i+n; j++ {
+		if j >= len(f.code) || f.targeted[j] {
+			return instruction{}, false
+		}
+	}
+	return f.code[i+n], true
+}
+
+// replace puts an instruction loading v in place of the n instructions at
+// i, attributed to the line of the first.
+func (f *folder) replace(i, n int, v core.Value) int {
+
+	in, ok := f.load(f.code[i].lines[0], v)
+	if !ok {
+		return 0
+	}
+	in.offset = f.code[i].offset
+	f.code[i] = in
+	for j := i + 1; j < i+n; j++ {
+		f.code[j].dead = true
+	}
+	return n
+}
+
+// load returns an instruction that pushes v.
+func (f *folder) load(line int, v core.Value) (instruction, bool) {
+
+	switch v.Type() {
+	case core.VAL_NIL:
+		return newInstruction(line, core.OP_NIL), true
+	case core.VAL_BOOL:
+		if v.Data() != 0 {
+			return newInstruction(line, core.OP_TRUE), true
+		}
+		return newInstruction(line, core.OP_FALSE), true
+	}
+	if ok, idx := f.chunk.InConstants(v); ok {
+		return newInstruction(line, core.OP_CONSTANT, idx), true
+	}
+	if len(f.chunk.Constants) > 254 {
+		return instruction{}, false
+	}
+	return newInstruction(line, core.OP_CONSTANT, f.chunk.AddConstant(v)), true
+}
+
+// removeUnreachable marks dead every instruction no path from the start of
+// the function reaches, and reports whether there were any. The except and
+// finally clauses of a try statement are entered by the VM when an
+// exception is raised, and OP_END_EXCEPT marks where the next one starts,
+// so those are always kept.
+func (f *folder) removeUnreachable() bool {
+
+	reached := make([]bool, len(f.code))
+	var work []int
+	visit := func(i int) {
+		if i < len(f.code) && !reached[i] {
+			reached[i] = true
+			work = append(work, i)
+		}
+	}
+	visit(0)
+	for i, in := range f.code {
+		switch in.op {
+		case core.OP_EXCEPT, core.OP_END_EXCEPT, core.OP_FINALLY:
+			visit(i)
+		}
+	}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		in := f.code[i]
+		if in.target >= 0 {
+			visit(in.target)
+		}
+		switch in.op {
+		case core.OP_RETURN, core.OP_RAISE, core.OP_JUMP, core.OP_LOOP, core.OP_END_TRY:
+		default:
+			visit(i + 1)
+		}
+	}
+	changed := false
+	for i := range f.code {
+		if !reached[i] && !f.code[i].dead {
+			f.code[i].dead = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// loadsConstant reports whether in pushes a value known at compile time.
+func loadsConstant(in instruction) bool {
+
+	switch in.op {
+	case core.OP_CONSTANT, core.OP_NIL, core.OP_TRUE, core.OP_FALSE, core.OP_ONE:
+		return true
+	}
+	return false
+}
+
+// constantOf returns the value in pushes. Only numbers, booleans, nil and
+// strings are folded.
+func constantOf(chunk *core.Chunk, in instruction) (core.Value, bool) {
+
+	switch in.op {
+	case core.OP_NIL:
+		return core.NIL_VALUE, true
+	case core.OP_TRUE:
+		return core.MakeBooleanValue(true, false), true
+	case core.OP_FALSE:
+		return core.MakeBooleanValue(false, false), true
+	case core.OP_ONE:
+		return core.MakeIntValue(1, false), true
+	}
+	v := chunk.Constants[in.operands[0]]
+	switch v.Type() {
+	case core.VAL_INT, core.VAL_FLOAT, core.VAL_BOOL, core.VAL_NIL:
+		return v, true
+	}
+	return v, v.IsStringObject()
+}
+
+func unaryOp(op uint8) bool {
+
+	return op == core.OP_NEGATE || op == core.OP_NOT
+}
+
+func binaryOp(op uint8) bool {
+
+	switch op {
+	case core.OP_ADD_NUMERIC, core.OP_SUBTRACT, core.OP_MULTIPLY, core.OP_DIVIDE, core.OP_MODULUS,
+		core.OP_CONCAT, core.OP_EQUAL, core.OP_GREATER, core.OP_LESS:
+		return true
+	}
+	return false
+}
+
+// isFalsey is the VM's truth test: only true and non-zero floats are true.
+func isFalsey(v core.Value) bool {
+
+	switch v.Type() {
+	case core.VAL_FLOAT:
+		return math.Float64frombits(v.Data()) == 0
+	case core.VAL_BOOL:
+		return v.Data() == 0
+	}
+	return true
+}
+
+// foldUnary computes a unary operation as the VM would, or reports false
+// where the VM would raise an error.
+func foldUnary(op uint8, v core.Value) (core.Value, bool) {
+
+	if op == core.OP_NOT {
+		return core.MakeBooleanValue(isFalsey(v), false), true
+	}
+	switch v.Type() {
+	case core.VAL_INT:
+		return core.MakeIntValue(-int(v.Data()), false), true
+	case core.VAL_FLOAT:
+		return core.MakeFloatValue(-math.Float64frombits(v.Data()), false), true
+	}
+	return v, false
+}
+
+// foldBinary computes a op b as the VM would, or reports false where the
+// VM would raise an error.
+func foldBinary(op uint8, a, b core.Value) (core.Value, bool) {
+
+	switch op {
+	case core.OP_EQUAL:
+		return core.MakeBooleanValue(core.ValuesEqual(a, b, false), false), true
+	case core.OP_GREATER, core.OP_LESS:
+		var greater, less bool
+		switch {
+		case a.IsNumber() && b.IsNumber():
+			greater, less = a.AsFloat() > b.AsFloat(), a.AsFloat() < b.AsFloat()
+		case a.IsStringObject() && b.IsStringObject():
+			greater, less = a.AsString().Get() > b.AsString().Get(), a.AsString().Get() < b.AsString().Get()
+		default:
+			return a, false
+		}
+		if op == core.OP_GREATER {
+			return core.MakeBooleanValue(greater, false), true
+		}
+		return core.MakeBooleanValue(less, false), true
+	case core.OP_CONCAT:
+		if a.IsStringObject() && b.IsStringObject() {
+			return core.MakeStringObjectValue(a.AsString().Get()+b.AsString().Get(), false), true
+		}
+		return a, false
+	case core.OP_MODULUS:
+		if a.IsInt() && b.IsInt() && int(b.Data()) != 0 {
+			return core.MakeIntValue(int(a.Data())%int(b.Data()), false), true
+		}
+		return a, false
+	}
+
+	if a.IsInt() && b.IsInt() {
+		x, y := int(a.Data()), int(b.Data())
+		switch op {
+		case core.OP_ADD_NUMERIC:
+			return core.MakeIntValue(x+y, false), true
+		case core.OP_SUBTRACT:
+			return core.MakeIntValue(x-y, false), true
+		case core.OP_MULTIPLY:
+			return core.MakeIntValue(x*y, false), true
+		case core.OP_DIVIDE:
+			if y != 0 {
+				return core.MakeIntValue(x/y, false), true
+			}
+		}
+		return a, false
+	}
+	if !a.IsNumber() || !b.IsNumber() {
+		return a, false
+	}
+	x, y := a.AsFloat(), b.AsFloat()
+	switch op {
+	case core.OP_ADD_NUMERIC:
+		return core.MakeFloatValue(x+y, false), true
+	case core.OP_SUBTRACT:
+		return core.MakeFloatValue(x-y, false), true
+	case core.OP_MULTIPLY:
+		return core.MakeFloatValue(x*y, false), true
+	case core.OP_DIVIDE:
+		if y != 0 {
+			return core.MakeFloatValue(x/y, false), true
+		}
+	}
+	return a, false
+}
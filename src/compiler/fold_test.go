@@ -0,0 +1,149 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"glox/src/core"
+)
+
+// compileChunk compiles src and returns the script's chunk.
+func compileChunk(t *testing.T, src string) *core.Chunk {
+
+	t.Helper()
+	fn, diags := Compile("fold.lox", src, "__main__")
+	if fn == nil {
+		t.Fatalf("compile failed: %v", diags)
+	}
+	return fn.Chunk
+}
+
+// opcodes lists the instructions of chunk, checking it decodes cleanly
+// and has a line for every byte.
+func opcodes(t *testing.T, chunk *core.Chunk) []uint8 {
+
+	t.Helper()
+	if len(chunk.Lines) != len(chunk.Code) {
+		t.Fatalf("%d lines for %d bytes", len(chunk.Lines), len(chunk.Code))
+	}
+	code, ok := decode(chunk)
+	if !ok {
+		t.Fatalf("chunk does not decode: %v", chunk.Code)
+	}
+	var ops []uint8
+	for _, in := range code {
+		ops = append(ops, in.op)
+	}
+	return ops
+}
+
+// function returns the chunk of the first function chunk creates.
+func function(t *testing.T, chunk *core.Chunk) *core.Chunk {
+
+	t.Helper()
+	for _, v := range chunk.Constants {
+		if v.IsObj() && v.ObjType() == core.OBJECT_FUNCTION {
+			return core.GetFunctionObjectValue(v).Chunk
+		}
+	}
+	t.Fatal("no function")
+	return nil
+}
+
+func TestFoldConstantExpressions(t *testing.T) {
+
+	for _, tc := range []struct {
+		src  string
+		want core.Value
+	}{
+		{"print 1 + 2 * 3 - -4\n", core.MakeIntValue(11, false)},
+		{"print 7.0 / 2\n", core.MakeFloatValue(3.5, false)},
+		{"print \"a\" & \"b\"\n", core.MakeStringObjectValue("ab", false)},
+		{"print 2 >= 3\n", core.MakeBooleanValue(false, false)},
+		{"print !nil\n", core.MakeBooleanValue(true, false)},
+	} {
+		chunk := compileChunk(t, tc.src)
+		code, _ := decode(chunk)
+		if got := opcodes(t, chunk); len(got) != 5 || got[1] != core.OP_STR {
+			t.Errorf("%q: not folded: %v", tc.src, got)
+			continue
+		}
+		if v, ok := constantOf(chunk, code[0]); !ok || !core.ValuesEqual(v, tc.want, true) {
+			t.Errorf("%q: folded to %v, want %v", tc.src, v, tc.want)
+		}
+	}
+}
+
+func TestFoldLeavesRuntimeErrors(t *testing.T) {
+
+	for _, src := range []string{"print 1 / 0\n", "print 5 % 0\n", "print -\"s\"\n", "print 1 & \"s\"\n", "print 1 < \"s\"\n"} {
+		if got := opcodes(t, compileChunk(t, src)); len(got) == 5 {
+			t.Errorf("%q: folded an operation that fails: %v", src, got)
+		}
+	}
+}
+
+func TestFoldRemovesDeadCode(t *testing.T) {
+
+	want := []uint8{core.OP_CONSTANT, core.OP_STR, core.OP_PRINT, core.OP_NIL, core.OP_RETURN}
+	for _, src := range []string{
+		"if (false) {\n  print 1\n}\nprint 2\n",
+		"if (true) {\n  print 2\n} else {\n  print 1\n}\n",
+		"while (false) {\n  print 1\n}\nprint 2\n",
+		"if (1 > 2 and true) {\n  print 1\n}\nprint 2\n",
+	} {
+		if got := opcodes(t, compileChunk(t, src)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", src, got, want)
+		}
+	}
+
+	f := function(t, compileChunk(t, "func f(x) {\n  return x\n  print x\n}\n"))
+	if got := opcodes(t, f); !reflect.DeepEqual(got, []uint8{core.OP_GET_LOCAL, core.OP_RETURN}) {
+		t.Errorf("code after return kept: %v", got)
+	}
+}
+
+func TestFoldKeepsLinesAndJumps(t *testing.T) {
+
+	chunk := compileChunk(t, "var n = 0\nwhile (n < 3) {\n  if (false) {\n    print n\n  }\n  n = n + 1\n}\nprint n\n")
+	code, ok := decode(chunk)
+	if !ok {
+		t.Fatal("chunk does not decode")
+	}
+	for _, in := range code {
+		switch in.op {
+		case core.OP_JUMP_IF_FALSE:
+			if code[in.target].op != core.OP_POP {
+				t.Errorf("loop exit lands on %d", code[in.target].op)
+			}
+		case core.OP_LOOP:
+			if code[in.target].op != core.OP_GET_GLOBAL {
+				t.Errorf("loop start lands on %d", code[in.target].op)
+			}
+		case core.OP_SET_GLOBAL:
+			if in.lines[0] != 6 {
+				t.Errorf("n = n + 1 on line %d", in.lines[0])
+			}
+		case core.OP_PRINT:
+			if in.lines[0] != 8 {
+				t.Errorf("print n on line %d", in.lines[0])
+			}
+		}
+	}
+}
+
+func TestConstGlobalReads(t *testing.T) {
+
+	chunk := compileChunk(t, "const K = 2 * 3\nprint K\nfunc f() {\n  return K\n}\n")
+	if got := opcodes(t, chunk); got[2] != core.OP_CONSTANT {
+		t.Errorf("top-level read of K not replaced: %v", got)
+	}
+	if got := opcodes(t, function(t, chunk)); got[0] != core.OP_GET_GLOBAL {
+		t.Errorf("read of K in a function replaced: %v", got)
+	}
+
+	chunk = compileChunk(t, "const K = 1\nvar K = 2\nprint K\n")
+	if got := opcodes(t, chunk); got[4] != core.OP_GET_GLOBAL {
+		t.Errorf("read of redeclared K replaced: %v", got)
+	}
+}
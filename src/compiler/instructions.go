@@ -0,0 +1,230 @@
+package compiler
+
+import (
+	"sort"
+
+	"glox/src/core"
+)
+
+// instruction is one decoded bytecode instruction. The optimiser works on a
+// function's code as a list of these so it can delete and replace
+// instructions without tracking byte offsets: a jump refers to the
+// instruction it goes to by index, and encode recomputes every offset.
+type instruction struct {
+	op       uint8
+	operands []uint8 // every byte after the opcode, a jump's offset included
+	lines    []int   // the line of each byte, the opcode's first
+	target   int     // index of the instruction a jump goes to, or -1
+	offset   int     // where the instruction was decoded from
+	dead     bool    // deleted, and dropped by the next compact
+}
+
+// newInstruction makes an instruction that does not jump, attributed to line.
+func newInstruction(line int, op uint8, operands ...uint8) instruction {
+
+	lines := make([]int, len(operands)+1)
+	for i := range lines {
+		lines[i] = line
+	}
+	return instruction{op: op, operands: operands, lines: lines, target: -1}
+}
+
+// instructionLength returns the length in bytes of the instruction at
+// offset, or false for an opcode it does not know.
+func instructionLength(chunk *core.Chunk, offset int) (int, bool) {
+
+	switch op := chunk.Code[offset]; op {
+	case core.OP_RETURN, core.OP_NOOP, core.OP_NEGATE, core.OP_ADD_NUMERIC, core.OP_CONCAT,
+		core.OP_ADD_VECTOR, core.OP_SUBTRACT, core.OP_MULTIPLY, core.OP_DIVIDE, core.OP_MODULUS,
+		core.OP_NIL, core.OP_TRUE, core.OP_FALSE, core.OP_NOT, core.OP_EQUAL, core.OP_GREATER,
+		core.OP_LESS, core.OP_PRINT, core.OP_STR, core.OP_POP, core.OP_INDEX, core.OP_INDEX_ASSIGN,
+		core.OP_SLICE, core.OP_SLICE_ASSIGN, core.OP_CLOSE_UPVALUE, core.OP_INHERIT,
+		core.OP_END_EXCEPT, core.OP_FINALLY, core.OP_RAISE, core.OP_END_FOREACH, core.OP_IN,
+		core.OP_BREAKPOINT, core.OP_ONE, core.OP_DUP, core.OP_ASYNC, core.OP_AWAIT:
+		return 1, true
+	case core.OP_CONSTANT, core.OP_INC_LOCAL, core.OP_DEFINE_GLOBAL, core.OP_DEFINE_GLOBAL_CONST,
+		core.OP_GET_GLOBAL, core.OP_SET_GLOBAL, core.OP_GET_LOCAL, core.OP_SET_LOCAL, core.OP_CALL,
+		core.OP_CREATE_LIST, core.OP_CREATE_TUPLE, core.OP_CREATE_DICT, core.OP_GET_UPVALUE,
+		core.OP_SET_UPVALUE, core.OP_CLASS, core.OP_GET_PROPERTY, core.OP_SET_PROPERTY,
+		core.OP_METHOD, core.OP_STATIC_METHOD, core.OP_CLASS_VAR, core.OP_GET_SUPER,
+		core.OP_EXCEPT, core.OP_UNPACK, core.OP_EXPORT, core.OP_CALL_SPREAD:
+		return 2, true
+	case core.OP_JUMP_IF_FALSE, core.OP_JUMP, core.OP_LOOP, core.OP_TRY, core.OP_END_TRY,
+		core.OP_INVOKE, core.OP_SUPER_INVOKE, core.OP_IMPORT, core.OP_ADD_NN, core.OP_ADD_II,
+		core.OP_ADD_FF, core.OP_INCR_CONST_N, core.OP_INCR_CONST_I, core.OP_INCR_CONST_F,
+		core.OP_INVOKE_SPREAD, core.OP_SUPER_INVOKE_SPREAD:
+		return 3, true
+	case core.OP_JUMP_IF_DEFINED, core.OP_NEXT:
+		return 4, true
+	case core.OP_FOREACH:
+		return 5, true
+	case core.OP_CLOSURE:
+		if offset+1 >= len(chunk.Code) {
+			return 0, false
+		}
+		idx := int(chunk.Code[offset+1])
+		if idx >= len(chunk.Constants) || !chunk.Constants[idx].IsObj() || chunk.Constants[idx].ObjType() != core.OBJECT_FUNCTION {
+			return 0, false
+		}
+		return 2 + 2*core.GetFunctionObjectValue(chunk.Constants[idx]).UpvalueCount, true
+	case core.OP_IMPORT_FROM:
+		if offset+2 >= len(chunk.Code) {
+			return 0, false
+		}
+		return 3 + int(chunk.Code[offset+2]), true
+	}
+	return 0, false
+}
+
+// jumpOperand returns where among its operands a jump keeps its 16-bit
+// offset, or -1 for an instruction that does not jump.
+func jumpOperand(op uint8) int {
+
+	switch op {
+	case core.OP_JUMP, core.OP_JUMP_IF_FALSE, core.OP_LOOP, core.OP_TRY, core.OP_END_TRY, core.OP_NEXT:
+		return 0
+	case core.OP_JUMP_IF_DEFINED:
+		return 1
+	case core.OP_FOREACH:
+		return 2
+	}
+	return -1
+}
+
+// jumpTarget returns the byte offset a jump at pos with the given operand
+// goes to, as the VM computes it. OP_TRY holds an absolute address; the
+// others are relative, backwards for OP_LOOP and OP_NEXT.
+func jumpTarget(op uint8, pos, operand int) int {
+
+	switch op {
+	case core.OP_TRY:
+		return operand
+	case core.OP_LOOP, core.OP_NEXT:
+		return pos + 3 - operand
+	case core.OP_JUMP_IF_DEFINED:
+		return pos + 4 + operand
+	}
+	return pos + 3 + operand
+}
+
+// jumpOperandFor is the inverse of jumpTarget.
+func jumpOperandFor(op uint8, pos, target int) int {
+
+	switch op {
+	case core.OP_TRY:
+		return target
+	case core.OP_LOOP, core.OP_NEXT:
+		return pos + 3 - target
+	case core.OP_JUMP_IF_DEFINED:
+		return target - pos - 4
+	}
+	return target - pos - 3
+}
+
+// decode splits a chunk's code into instructions. It fails, leaving the
+// caller to keep the code as it is, on an opcode it does not know or a
+// jump that lands inside an instruction.
+func decode(chunk *core.Chunk) ([]instruction, bool) {
+
+	var code []instruction
+	index := make(map[int]int) // byte offset → instruction
+	for offset := 0; offset < len(chunk.Code); {
+		n, ok := instructionLength(chunk, offset)
+		if !ok || offset+n > len(chunk.Code) || offset+n > len(chunk.Lines) {
+			return nil, false
+		}
+		index[offset] = len(code)
+		code = append(code, instruction{
+			op:       chunk.Code[offset],
+			operands: append([]uint8(nil), chunk.Code[offset+1:offset+n]...),
+			lines:    append([]int(nil), chunk.Lines[offset:offset+n]...),
+			target:   -1,
+			offset:   offset,
+		})
+		offset += n
+	}
+	index[len(chunk.Code)] = len(code)
+	for i := range code {
+		in := &code[i]
+		at := jumpOperand(in.op)
+		if at < 0 {
+			continue
+		}
+		operand := int(in.operands[at])<<8 | int(in.operands[at+1])
+		target, ok := index[jumpTarget(in.op, in.offset, operand)]
+		if !ok {
+			return nil, false
+		}
+		in.target = target
+	}
+	return code, true
+}
+
+// encode writes instructions back into chunk, dropping dead ones. Jump
+// offsets are recomputed, each byte keeps its line, and the ranges in
+// LocalVars move with the instructions they cover. It reports false,
+// leaving chunk alone, if a jump no longer fits in 16 bits.
+func encode(chunk *core.Chunk, code []instruction) bool {
+
+	code = compact(code)
+	pos := make([]int, len(code)+1)
+	for i, in := range code {
+		pos[i+1] = pos[i] + 1 + len(in.operands)
+	}
+	bytes := make([]uint8, 0, pos[len(code)])
+	lines := make([]int, 0, pos[len(code)])
+	for i, in := range code {
+		bytes = append(bytes, in.op)
+		bytes = append(bytes, in.operands...)
+		lines = append(lines, in.lines...)
+		if at := jumpOperand(in.op); at >= 0 {
+			operand := jumpOperandFor(in.op, pos[i], pos[in.target])
+			if operand < 0 || operand > 0xffff {
+				return false
+			}
+			bytes[pos[i]+1+at] = uint8(operand >> 8)
+			bytes[pos[i]+2+at] = uint8(operand)
+		}
+	}
+
+	// An old offset maps to where the first instruction at or after it now
+	// starts.
+	moved := func(old int) int {
+		return pos[sort.Search(len(code), func(i int) bool { return code[i].offset >= old })]
+	}
+	for i, lv := range chunk.LocalVars {
+		chunk.LocalVars[i].StartIp = moved(lv.StartIp)
+		if lv.EndIp >= 0 {
+			chunk.LocalVars[i].EndIp = moved(lv.EndIp)
+		}
+	}
+	chunk.Code = bytes
+	chunk.Lines = lines
+	return true
+}
+
+// compact drops dead instructions, pointing a jump at a dead instruction
+// to the first live one after it.
+func compact(code []instruction) []instruction {
+
+	index := make([]int, len(code)+1)
+	n := 0
+	for i, in := range code {
+		index[i] = n
+		if !in.dead {
+			n++
+		}
+	}
+	index[len(code)] = n
+	live := make([]instruction, 0, n)
+	for _, in := range code {
+		if in.dead {
+			continue
+		}
+		if in.target >= 0 {
+			in.target = index[in.target]
+		}
+		live = append(live, in)
+	}
+	return live
+}
@@ -0,0 +1,118 @@
+package compiler
+
+import "glox/src/core"
+
+// peepholeRule rewrites a run of instructions into a shorter equivalent,
+// usually a single superinstruction the VM executes in one dispatch. A
+// rule is matched against decoded code, so it never starts inside another
+// instruction's operands, and it does not match across a jump target. Its
+// replacement may be no longer than the run it replaces.
+//
+// Every operand byte in a rule is named. A name that appears twice in
+// match must bind the same byte each time -- that is how `x = x + y`
+// insists the local it reads and the local it writes are one -- and the
+// operands of replace are looked up by name.
+type peepholeRule struct {
+	match   []step
+	replace []step
+}
+
+// step is one instruction of a peephole rule: an opcode and a name for
+// each of its operand bytes.
+type step struct {
+	op       uint8
+	operands []string
+}
+
+func ins(op uint8, operands ...string) step {
+
+	return step{op: op, operands: operands}
+}
+
+// peepholeRules are tried in order at each instruction; the first that
+// matches wins. To find candidates for new rules, run a program with
+// --instrument in a debug build and look at the most frequent opcode pairs.
+var peepholeRules = []peepholeRule{
+	// x = x + y on locals
+	{
+		match:   []step{ins(core.OP_GET_LOCAL, "x"), ins(core.OP_GET_LOCAL, "y"), ins(core.OP_ADD_NUMERIC), ins(core.OP_SET_LOCAL, "x"), ins(core.OP_POP)},
+		replace: []step{ins(core.OP_ADD_NN, "x", "y")},
+	},
+	// x = x + constant on a local
+	{
+		match:   []step{ins(core.OP_GET_LOCAL, "x"), ins(core.OP_CONSTANT, "k"), ins(core.OP_ADD_NUMERIC), ins(core.OP_SET_LOCAL, "x"), ins(core.OP_POP)},
+		replace: []step{ins(core.OP_INCR_CONST_N, "x", "k")},
+	},
+}
+
+// PeepholeOptimise rewrites the instruction sequences in peepholeRules
+// into their replacements. The code is compacted afterwards, so jump
+// offsets, lines and LocalVars ranges move with the instructions instead
+// of the gaps being padded with OP_NOOP. Code generators other than the
+// parser (see package ast) run it so they emit the same bytecode.
+func PeepholeOptimise(chunk *core.Chunk) {
+
+	code, ok := decode(chunk)
+	if !ok {
+		return
+	}
+	targeted := make([]bool, len(code)+1)
+	for _, in := range code {
+		if in.target >= 0 {
+			targeted[in.target] = true
+		}
+	}
+	changed := false
+	for i := 0; i < len(code); i++ {
+		for _, rule := range peepholeRules {
+			if n := rule.apply(code, targeted, i); n > 0 {
+				i += n - 1
+				changed = true
+				break
+			}
+		}
+	}
+	if changed {
+		encode(chunk, code)
+	}
+}
+
+// apply rewrites code at i if the rule matches there, returning how many
+// instructions it consumed, or 0 if it does not match.
+func (r peepholeRule) apply(code []instruction, targeted []bool, i int) int {
+
+	n := len(r.match)
+	if i+n > len(code) {
+		return 0
+	}
+	bound := make(map[string]uint8)
+	for j, s := range r.match {
+		in := code[i+j]
+		if in.op != s.op || len(in.operands) != len(s.operands) || (j > 0 && targeted[i+j]) {
+			return 0
+		}
+		for k, name := range s.operands {
+			if b, ok := bound[name]; ok && b != in.operands[k] {
+				return 0
+			}
+			bound[name] = in.operands[k]
+		}
+	}
+
+	line := code[i].lines[0]
+	for j := range r.match {
+		if j >= len(r.replace) {
+			code[i+j].dead = true
+			continue
+		}
+		s := r.replace[j]
+		operands := make([]uint8, len(s.operands))
+		for k, name := range s.operands {
+			operands[k] = bound[name]
+		}
+		offset := code[i+j].offset
+		code[i+j] = newInstruction(line, s.op, operands...)
+		code[i+j].offset = offset
+	}
+	return n
+}
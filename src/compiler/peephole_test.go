@@ -0,0 +1,76 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"glox/src/core"
+)
+
+func TestPeepholeFusesWithoutPadding(t *testing.T) {
+
+	f := function(t, compileChunk(t, "func f(x, y) {\n  x = x + y\n  x = x + 2\n  x = y + x\n  return x\n}\n"))
+	want := []uint8{
+		core.OP_ADD_NN,
+		core.OP_INCR_CONST_N,
+		core.OP_GET_LOCAL, core.OP_GET_LOCAL, core.OP_ADD_NUMERIC, core.OP_SET_LOCAL, core.OP_POP,
+		core.OP_GET_LOCAL, core.OP_RETURN,
+	}
+	if got := opcodes(t, f); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	code, _ := decode(f)
+	if !reflect.DeepEqual(code[0].operands, []uint8{1, 2}) || code[0].lines[0] != 2 {
+		t.Errorf("x = x + y became %v on line %d", code[0].operands, code[0].lines[0])
+	}
+	if code[1].lines[0] != 3 {
+		t.Errorf("x = x + 2 on line %d", code[1].lines[0])
+	}
+}
+
+func TestPeepholeKeepsLoops(t *testing.T) {
+
+	f := function(t, compileChunk(t, "func f() {\n  var i = 0\n  while (i < 10) {\n    i = i + 1\n  }\n  return i\n}\n"))
+	code, ok := decode(f)
+	if !ok {
+		t.Fatal("chunk does not decode")
+	}
+	fused := false
+	for _, in := range code {
+		switch in.op {
+		case core.OP_INCR_CONST_N:
+			fused = true
+		case core.OP_LOOP:
+			if code[in.target].op != core.OP_GET_LOCAL {
+				t.Errorf("loop start lands on %d", code[in.target].op)
+			}
+		case core.OP_JUMP_IF_FALSE:
+			if code[in.target].op != core.OP_POP {
+				t.Errorf("loop exit lands on %d", code[in.target].op)
+			}
+		}
+	}
+	if !fused {
+		t.Error("i = i + 1 not fused")
+	}
+}
+
+func TestPeepholeSkipsJumpTargets(t *testing.T) {
+
+	// x = x + y, with a loop back to its second instruction
+	chunk := core.MakeChunk("peephole.lox", []uint8{
+		core.OP_GET_LOCAL, 0,
+		core.OP_GET_LOCAL, 1,
+		core.OP_ADD_NUMERIC,
+		core.OP_SET_LOCAL, 0,
+		core.OP_POP,
+		core.OP_LOOP, 0, 9,
+		core.OP_NIL,
+		core.OP_RETURN,
+	}, nil, make([]int, 13))
+	want := append([]uint8(nil), chunk.Code...)
+	PeepholeOptimise(chunk)
+	if !reflect.DeepEqual(chunk.Code, want) {
+		t.Errorf("fused across a jump target: %v", chunk.Code)
+	}
+}
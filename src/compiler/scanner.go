@@ -2,7 +2,9 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 type TokenType int
@@ -81,6 +83,11 @@ const (
 	TOKEN_FROM
 	TOKEN_PLUS_PLUS // ++
 	TOKEN_AMPERSAND // &
+	TOKEN_ARROW     // -> (return type annotation)
+	TOKEN_AT        // @ (decorator)
+	TOKEN_EXPORT
+	TOKEN_ASYNC
+	TOKEN_AWAIT
 )
 
 var keywords = map[string]TokenType{
@@ -116,6 +123,20 @@ var keywords = map[string]TokenType{
 	"breakpoint": TOKEN_BREAKPOINT,
 	"static":     TOKEN_STATIC,
 	"from":       TOKEN_FROM,
+	"export":     TOKEN_EXPORT,
+	"async":      TOKEN_ASYNC,
+	"await":      TOKEN_AWAIT,
+}
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+
+	var rv []string
+	for k := range keywords {
+		rv = append(rv, k)
+	}
+	sort.Strings(rv)
+	return rv
 }
 
 var repr = map[TokenType]string{
@@ -188,6 +209,11 @@ var repr = map[TokenType]string{
 	TOKEN_FROM:          "TOKEN_FROM",
 	TOKEN_PLUS_PLUS:     "TOKEN_PLUS_PLUS",
 	TOKEN_AMPERSAND:     "TOKEN_AMPERSAND",
+	TOKEN_ARROW:         "TOKEN_ARROW",
+	TOKEN_AT:            "TOKEN_AT",
+	TOKEN_EXPORT:        "TOKEN_EXPORT",
+	TOKEN_ASYNC:         "TOKEN_ASYNC",
+	TOKEN_AWAIT:         "TOKEN_AWAIT",
 }
 
 type Scanner struct {
@@ -195,13 +221,20 @@ type Scanner struct {
 	Start, Current, Line int
 	Tokens               TokenList
 	TokenIdx             int
-	pending              []Token // queued tokens from string interpolation desugaring
+	pending              []Token          // queued tokens from string interpolation desugaring
+	ignores              map[int][]string // line → warnings silenced there by `// glox:ignore`, "*" for all
 }
 
 type Token struct {
 	Tokentype           TokenType
 	Source              *string
 	Start, Length, Line int
+	// Offset and Width give the byte span of the token's text in the file,
+	// and Column (1-based, in characters) where that span starts on Line.
+	// They match Start/Length except for tokens synthesised by the scanner
+	// (string interpolation, error tokens), whose Source is their own
+	// string: those cover the source text they were made from.
+	Offset, Width, Column int
 }
 
 type TokenList struct {
@@ -259,6 +292,7 @@ func NewScanner(source string) *Scanner {
 	}
 	for {
 		t := s.ScanToken()
+		s.locate(&t)
 		s.Tokens.Add(t)
 		if t.Tokentype == TOKEN_EOF {
 			break
@@ -266,6 +300,17 @@ func NewScanner(source string) *Scanner {
 	}
 	return s
 }
+
+// locate fills in the token's position in the file from the span the
+// scanner just consumed. Tokens queued by string interpolation are returned
+// while that span still covers the whole literal.
+func (s *Scanner) locate(t *Token) {
+
+	t.Offset, t.Width = s.Start, s.Current-s.Start
+	lineStart := strings.LastIndexByte(s.Source[:s.Start], '\n') + 1
+	t.Column = utf8.RuneCountInString(s.Source[lineStart:s.Start]) + 1
+}
+
 func (s *Scanner) NextToken() Token {
 
 	// The final entry in Tokens is always TOKEN_EOF (see NewScanner). Once
@@ -347,6 +392,9 @@ func (s *Scanner) ScanToken() Token {
 			if s.Match("=") {
 				return s.MakeToken(TOKEN_MINUS_EQUAL)
 			}
+			if s.Match(">") {
+				return s.MakeToken(TOKEN_ARROW)
+			}
 			return s.MakeToken(TOKEN_MINUS)
 		case "+":
 			if s.Match("=") {
@@ -358,6 +406,8 @@ func (s *Scanner) ScanToken() Token {
 			return s.MakeToken(TOKEN_PLUS)
 		case "&":
 			return s.MakeToken(TOKEN_AMPERSAND)
+		case "@":
+			return s.MakeToken(TOKEN_AT)
 		case "%":
 			if s.Match("=") {
 				return s.MakeToken(TOKEN_PERCENT_EQUAL)
@@ -469,9 +519,11 @@ func (s *Scanner) SkipWhiteSpace() {
 			s.Advance()
 		case "/":
 			if s.PeekNext() == "/" {
+				start := s.Current
 				for s.Peek() != "\n" && !s.IsAtEnd() {
 					s.Advance()
 				}
+				s.ignoreDirective(start)
 			} else {
 				return
 			}
@@ -482,6 +534,45 @@ func (s *Scanner) SkipWhiteSpace() {
 
 }
 
+// ignoreDirective records a `// glox:ignore [warning, ...]` comment that
+// ends at the current position. A comment after code silences warnings on
+// its own line; a comment on a line by itself silences the next line.
+func (s *Scanner) ignoreDirective(start int) {
+
+	text := strings.TrimSpace(s.Source[start+2 : s.Current])
+	rest, ok := strings.CutPrefix(text, "glox:ignore")
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return
+	}
+	line := s.Line
+	lineStart := strings.LastIndexByte(s.Source[:start], '\n') + 1
+	if strings.TrimSpace(s.Source[lineStart:start]) == "" {
+		line++
+	}
+	if s.ignores == nil {
+		s.ignores = map[int][]string{}
+	}
+	names := strings.FieldsFunc(rest, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(names) == 0 {
+		names = []string{"*"}
+	}
+	s.ignores[line] = append(s.ignores[line], names...)
+}
+
+// ignored reports whether a `// glox:ignore` comment silences the named
+// warning on line.
+func (s *Scanner) ignored(line int, warning string) bool {
+
+	for _, n := range s.ignores[line] {
+		if n == "*" || n == warning {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Scanner) SkipEOL() bool {
 
 	if s.Tokens.Size() < 2 {
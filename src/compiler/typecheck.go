@@ -0,0 +1,492 @@
+package compiler
+
+import (
+	"fmt"
+	"glox/src/core"
+	"sort"
+	"strings"
+)
+
+// The static checker piggybacks on the single-pass compiler: Check() runs an
+// ordinary compile with a typeChecker attached to the Parser, and the Pratt
+// functions report the static type of each expression they compile via
+// setType(). Nothing here influences code generation -- a Parser without a
+// typeChecker (every normal Compile) skips all of it.
+//
+// The checker is deliberately conservative. Anything it cannot type is
+// "unknown" (a nil *TypeExpr) and is compatible with everything, so only
+// annotated code, literals and builtins with declared signatures can produce
+// errors. Unannotated `var`s stay unknown even when initialised, since the
+// compiler has no flow analysis to follow later reassignments.
+
+// classInfo is what the checker knows about a class declared in the file.
+type classInfo struct {
+	super   string
+	fields  map[string]*TypeExpr
+	methods map[string]*Signature
+}
+
+type typeChecker struct {
+	builtins   map[string]*TypeExpr // "len", "sys.clock", ... -> function type
+	globals    map[string]*TypeExpr // declared types of script globals
+	classes    map[string]*classInfo
+	expr       *TypeExpr   // static type of the expression just compiled
+	exprDepth  int         // parsePrecedence depth that produced expr, -1 if none
+	lastArgs   []*TypeExpr // argument types collected by the last argumentList()
+	lastSpread bool        // whether that list ended in a spread, left out of lastArgs
+}
+
+// Check compiles source with static type checking enabled and returns the
+// diagnostics found, syntax and type errors alike (the latter with code
+// CodeType), sorted by position. builtins maps native builtin names ("len",
+// "sys.clock") to signatures in annotation syntax, as produced by
+// vm.BuiltInSignatures. ok is false if the file failed to compile.
+func Check(script string, source string, builtins map[string]string) (diags []Diagnostic, ok bool) {
+
+	parser := newCheckingParser(builtins)
+	parser.scn = NewScanner(source)
+	parser.compileScript(script)
+
+	diags = parser.diagnostics
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Span.Offset < diags[j].Span.Offset })
+	return diags, !parser.hadError
+}
+
+// newCheckingParser returns a Parser with a typeChecker attached that knows
+// the given builtin signatures.
+func newCheckingParser(builtins map[string]string) *Parser {
+
+	parser := NewParser()
+	parser.tc = &typeChecker{
+		builtins:  map[string]*TypeExpr{},
+		globals:   map[string]*TypeExpr{},
+		classes:   map[string]*classInfo{},
+		exprDepth: -1,
+	}
+	for name, src := range builtins {
+		if src == "" {
+			continue
+		}
+		sig, err := ParseSignature(name, src)
+		if err != nil {
+			core.LogFmtLn(core.WARN, "%s", err)
+			continue
+		}
+		parser.tc.builtins[name] = funcType(sig)
+	}
+	return parser
+}
+
+// compileScript compiles the whole of the scanned source as a top-level
+// script, for analysis only: the code is discarded.
+func (p *Parser) compileScript(script string) {
+
+	environment := core.NewEnvironment("__main__")
+	p.currentCompiler = NewCompiler(TYPE_SCRIPT, script, nil, environment)
+	p.advance()
+	for !p.match(TOKEN_EOF) {
+		p.declaration()
+	}
+	p.endCompiler()
+}
+
+//-----------------------------------------------------------------------------
+// Parser hooks. All of these are no-ops when no checker is attached.
+
+// setType records t as the static type of the expression being compiled at
+// the current parsePrecedence depth.
+func (p *Parser) setType(t *TypeExpr) {
+
+	if p.tc == nil {
+		return
+	}
+	p.tc.expr = t
+	p.tc.exprDepth = p.exprDepth
+}
+
+// exprType returns the static type of the expression compiled last.
+func (p *Parser) exprType() *TypeExpr {
+
+	if p.tc == nil {
+		return nil
+	}
+	return p.tc.expr
+}
+
+// beginRule and endRule bracket each prefix/infix rule in parsePrecedence. A
+// rule that does not call setType leaves a stale type from a subexpression
+// behind, so endRule discards any type not produced at the rule's own depth.
+// beginRule keeps expr itself intact because infix rules read their left
+// operand's type from it.
+func (p *Parser) beginRule() {
+
+	if p.tc != nil {
+		p.tc.exprDepth = -1
+	}
+}
+
+func (p *Parser) endRule() {
+
+	if p.tc != nil && p.tc.exprDepth != p.exprDepth {
+		p.tc.expr = nil
+		p.tc.exprDepth = p.exprDepth
+	}
+}
+
+func (p *Parser) typeError(format string, args ...any) {
+
+	if p.tc == nil {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeType,
+		Span:     p.tokenSpan(p.previous),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkAssignable reports an error if a value of type src cannot be stored
+// somewhere declared as dst. what describes the destination for the message.
+func (p *Parser) checkAssignable(src, dst *TypeExpr, what string) {
+
+	if p.tc == nil || p.tc.assignable(src, dst) {
+		return
+	}
+	p.typeError("cannot assign %s to %s of type %s", src, what, dst)
+}
+
+// bindType records the declared type of the variable just declared by
+// parseVariable: the newest local when in a scope, otherwise the global name.
+func (p *Parser) bindType(name string, t *TypeExpr) {
+
+	if p.tc == nil {
+		return
+	}
+	c := p.currentCompiler
+	if c.scopeDepth > 0 {
+		c.locals[c.localCount-1].typ = t
+		return
+	}
+	p.tc.globals[name] = t
+}
+
+// lookupType finds the declared type of a variable reference, following the
+// same local -> enclosing function -> global -> builtin order as the compiler,
+// but without resolveLocal's side effects.
+func (p *Parser) lookupType(name string) *TypeExpr {
+
+	if p.tc == nil {
+		return nil
+	}
+	for c := p.currentCompiler; c != nil; c = c.enclosing {
+		for i := c.localCount - 1; i >= 0; i-- {
+			if c.locals[i].name.Length > 0 && c.locals[i].name.Lexeme() == name {
+				return c.locals[i].typ
+			}
+		}
+	}
+	if t, ok := p.tc.globals[name]; ok {
+		return t
+	}
+	return p.tc.builtins[name]
+}
+
+// checkReturn validates a returned value against the enclosing function's
+// declared return type.
+func (p *Parser) checkReturn(t *TypeExpr) {
+
+	if p.tc == nil {
+		return
+	}
+	rt := p.currentCompiler.returnType
+	if !p.tc.assignable(t, rt) {
+		p.typeError("cannot return %s from %s, declared to return %s",
+			t, p.currentCompiler.function.Name.Get(), rt)
+	}
+}
+
+// checkCall validates a call of a value of static type callee with arguments
+// of the given types and returns the static type of the call's result.
+func (p *Parser) checkCall(callee *TypeExpr, args []*TypeExpr) *TypeExpr {
+
+	if p.tc == nil || callee.isUnknown() {
+		return nil
+	}
+	switch callee.Name {
+	case "func":
+		if callee.Sig == nil {
+			return nil
+		}
+		p.checkArgs(callee.Sig.Name, callee.Sig, args)
+		return callee.Sig.Return
+	case "class":
+		instance := namedType(callee.Class)
+		init, known := p.tc.findMethod(callee.Class, "init")
+		if init != nil {
+			p.checkArgs(callee.Class, init, args)
+		} else if known && len(args) > 0 {
+			p.typeError("%s() expects 0 arguments, got %d", callee.Class, len(args))
+		}
+		return instance
+	case "int", "float", "number", "string", "bool", "nil", "list", "dict", "tuple", "vec2", "vec3", "vec4":
+		if !callee.Optional {
+			p.typeError("value of type %s is not callable", callee)
+		}
+	}
+	return nil
+}
+
+// checkArgs validates argument count and types against sig; name is the
+// callee as the user wrote it (the class name for constructor calls).
+func (p *Parser) checkArgs(name string, sig *Signature, args []*TypeExpr) {
+
+	minArgs, maxArgs := sig.minArgs(), sig.maxArgs()
+	switch {
+	case !p.tc.lastSpread && minArgs == maxArgs && len(args) != minArgs:
+		p.typeError("%s expects %d argument%s, got %d", name, minArgs, plural(minArgs), len(args))
+		return
+	case !p.tc.lastSpread && len(args) < minArgs:
+		p.typeError("%s expects at least %d argument%s, got %d", name, minArgs, plural(minArgs), len(args))
+		return
+	case maxArgs >= 0 && len(args) > maxArgs:
+		p.typeError("%s expects at most %d argument%s, got %d", name, maxArgs, plural(maxArgs), len(args))
+		return
+	}
+	for i, a := range args {
+		pi := i
+		if pi >= len(sig.Params) {
+			pi = len(sig.Params) - 1 // surplus args all go to *rest
+		}
+		want := sig.Params[pi].Type
+		if !p.tc.assignable(a, want) {
+			p.typeError("argument %d to %s: expected %s, got %s", i+1, name, want, a)
+		}
+	}
+}
+
+func plural(n int) string {
+
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// memberType returns the static type of obj.name for module members, instance
+// fields and methods. Unknown members are unknown, not errors: instances can
+// grow fields at run time.
+func (p *Parser) memberType(obj *TypeExpr, name string) *TypeExpr {
+
+	if p.tc == nil || obj.isUnknown() {
+		return nil
+	}
+	if obj.Name == "module" {
+		return p.tc.builtins[obj.Module+"."+name]
+	}
+	if t := p.tc.findField(obj.Name, name); t != nil {
+		return t
+	}
+	if sig, _ := p.tc.findMethod(obj.Name, name); sig != nil {
+		return funcType(sig)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// typeChecker helpers
+
+func (tc *typeChecker) class(name string) *classInfo {
+
+	ci, ok := tc.classes[name]
+	if !ok {
+		ci = &classInfo{fields: map[string]*TypeExpr{}, methods: map[string]*Signature{}}
+		tc.classes[name] = ci
+	}
+	return ci
+}
+
+// findMethod looks a method up through the superclass chain. known reports
+// whether every class on the chain was declared in this file, i.e. whether a
+// miss is definitive.
+func (tc *typeChecker) findMethod(class, name string) (sig *Signature, known bool) {
+
+	for seen := 0; class != "" && seen < 64; seen++ {
+		ci, ok := tc.classes[baseName(class)]
+		if !ok {
+			return nil, false
+		}
+		if sig := ci.methods[name]; sig != nil {
+			return sig, true
+		}
+		class = ci.super
+	}
+	return nil, true
+}
+
+func (tc *typeChecker) findField(class, name string) *TypeExpr {
+
+	for seen := 0; class != "" && seen < 64; seen++ {
+		ci, ok := tc.classes[baseName(class)]
+		if !ok {
+			return nil
+		}
+		if t := ci.fields[name]; t != nil {
+			return t
+		}
+		class = ci.super
+	}
+	return nil
+}
+
+// baseName strips a module qualifier: `gfx.window` and `window` name the same
+// type, as do `shapes.Circle` and `Circle`.
+func baseName(name string) string {
+
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// assignable reports whether a value of static type src may be used where dst
+// is declared. Unknown on either side always passes. int and float are
+// distinct (the VM and many builtins, e.g. _sin, reject an int where a float
+// is required); `number` accepts both.
+func (tc *typeChecker) assignable(src, dst *TypeExpr) bool {
+
+	if src.isUnknown() || dst.isUnknown() {
+		return true
+	}
+	if src.Name == "nil" {
+		return dst.Optional || dst.Name == "nil"
+	}
+	switch dst.Name {
+	case "number":
+		return src.isNumeric() || src.Name == "number"
+	case "func":
+		return src.Name == "func" || src.Name == "class"
+	}
+	if src.Name == "number" && (dst.Name == "int" || dst.Name == "float") {
+		return true
+	}
+	if baseName(src.Name) == baseName(dst.Name) {
+		for i := range src.Args {
+			if i < len(dst.Args) && !tc.assignable(src.Args[i], dst.Args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	// subclass instances are assignable to their superclasses
+	for seen, class := 0, src.Name; seen < 64; seen++ {
+		ci, ok := tc.classes[baseName(class)]
+		if !ok || ci.super == "" {
+			return false
+		}
+		if baseName(ci.super) == baseName(dst.Name) {
+			return true
+		}
+		class = ci.super
+	}
+	return false
+}
+
+// nonArithmetic lists types the arithmetic operators reject at run time.
+var nonArithmetic = map[string]bool{
+	"string": true, "bool": true, "nil": true, "list": true, "dict": true, "tuple": true, "func": true, "class": true, "module": true,
+}
+
+// binaryType computes the result type of `l op r` and reports operands the VM
+// is certain to reject.
+func (p *Parser) binaryType(op TokenType, opLexeme string, l, r *TypeExpr) *TypeExpr {
+
+	if p.tc == nil {
+		return nil
+	}
+	switch op {
+	case TOKEN_EQUAL_EQUAL, TOKEN_BANG_EQUAL, TOKEN_LESS, TOKEN_LESS_EQUAL,
+		TOKEN_GREATER, TOKEN_GREATER_EQUAL, TOKEN_IN:
+		return namedType("bool")
+	case TOKEN_AMPERSAND:
+		return namedType("string")
+	case TOKEN_PLUS_PLUS:
+		if !l.isUnknown() && strings.HasPrefix(l.Name, "vec") {
+			return l
+		}
+		return nil
+	}
+
+	for _, t := range []*TypeExpr{l, r} {
+		if t.isUnknown() || t.Optional {
+			continue
+		}
+		bad := nonArithmetic[t.Name]
+		if op == TOKEN_PLUS && strings.HasPrefix(t.Name, "vec") {
+			bad = true // vectors add with ++
+		}
+		if op == TOKEN_STAR && t.Name == "string" {
+			bad = false // string repetition
+		}
+		if bad {
+			hint := ""
+			if op == TOKEN_PLUS && t.Name == "string" {
+				hint = " (use & to join strings)"
+			} else if op == TOKEN_PLUS && strings.HasPrefix(t.Name, "vec") {
+				hint = " (use ++ to add vectors)"
+			}
+			p.typeError("operator '%s' cannot be applied to %s and %s%s", opLexeme, l, r, hint)
+			return nil
+		}
+	}
+	if l.isNumeric() && r.isNumeric() {
+		if l.Name == "int" && r.Name == "int" {
+			return namedType("int")
+		}
+		if l.Name == "float" || r.Name == "float" {
+			return namedType("float")
+		}
+		return namedType("number")
+	}
+	if op == TOKEN_STAR && !l.isUnknown() && l.Name == "string" {
+		return l
+	}
+	return nil
+}
+
+// sameType returns t1 if both branches have the same known type, else unknown.
+func sameType(t1, t2 *TypeExpr) *TypeExpr {
+
+	if t1.isUnknown() || t2.isUnknown() || t1.String() != t2.String() {
+		return nil
+	}
+	return t1
+}
+
+// elementType is the type of container[i]: T for list[T], V for dict[K, V]
+// and string for strings.
+func elementType(container *TypeExpr) *TypeExpr {
+
+	if container.isUnknown() {
+		return nil
+	}
+	switch container.Name {
+	case "list":
+		return container.arg(0)
+	case "dict":
+		return container.arg(1)
+	case "string":
+		return container
+	}
+	return nil
+}
+
+// annotationString renders an annotation for FunctionObject.ParamTypes and
+// ReturnType, with "" meaning "not annotated".
+func annotationString(t *TypeExpr) string {
+
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
@@ -0,0 +1,249 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeExpr is a parsed type annotation, e.g. `int`, `list[float]`, `gfx.window`
+// or `string?`. Annotations are optional and never change the bytecode the
+// compiler emits; they are recorded on FunctionObjects and used by the static
+// checker behind `glox check` (see typecheck.go).
+//
+// A nil *TypeExpr means "unknown" and is compatible with everything, so code
+// without annotations never produces type errors.
+type TypeExpr struct {
+	Name     string      // canonical base name: int, float, list, MyClass, gfx.window ...
+	Args     []*TypeExpr // generic arguments, e.g. [float] for list[float]
+	Optional bool        // trailing '?': nil is also accepted
+	Sig      *Signature  // for function values: the callable's signature, if known
+	Class    string      // for class values (Name == "class"): the class name
+	Module   string      // for module values (Name == "module"): the module name
+}
+
+// Param is one parameter of a Signature.
+type Param struct {
+	Name       string
+	Type       *TypeExpr
+	HasDefault bool
+}
+
+// Signature describes a callable: its parameters, whether the last parameter
+// is a *rest collector, and the declared return type (nil if not annotated).
+type Signature struct {
+	Name     string
+	Params   []Param
+	Variadic bool
+	Return   *TypeExpr
+}
+
+// typeAliases maps alternative spellings accepted in annotations onto the
+// canonical names used by the checker. The canonical names follow the runtime
+// type() builtin where one exists.
+var typeAliases = map[string]string{
+	"boolean":  "bool",
+	"function": "func",
+	"closure":  "func",
+	"str":      "string",
+}
+
+// CanonicalTypeName maps a type name as written in an annotation onto the
+// name the checker uses for it.
+func CanonicalTypeName(name string) string {
+
+	if alias, ok := typeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+func namedType(name string) *TypeExpr {
+	return &TypeExpr{Name: name}
+}
+
+func funcType(sig *Signature) *TypeExpr {
+	return &TypeExpr{Name: "func", Sig: sig}
+}
+
+func (t *TypeExpr) String() string {
+
+	if t == nil {
+		return "any"
+	}
+	var sb strings.Builder
+	switch {
+	case t.Name == "class" && t.Class != "":
+		sb.WriteString("class " + t.Class)
+	case t.Name == "module" && t.Module != "":
+		sb.WriteString("module " + t.Module)
+	default:
+		sb.WriteString(t.Name)
+	}
+	if len(t.Args) > 0 {
+		args := make([]string, len(t.Args))
+		for i, a := range t.Args {
+			args[i] = a.String()
+		}
+		sb.WriteString("[" + strings.Join(args, ", ") + "]")
+	}
+	if t.Optional {
+		sb.WriteString("?")
+	}
+	return sb.String()
+}
+
+// isUnknown reports whether t carries no usable static information.
+func (t *TypeExpr) isUnknown() bool {
+
+	return t == nil || t.Name == "any"
+}
+
+func (t *TypeExpr) isNumeric() bool {
+
+	return t != nil && !t.Optional && (t.Name == "int" || t.Name == "float" || t.Name == "number")
+}
+
+// arg returns generic argument i, or nil (unknown) when absent.
+func (t *TypeExpr) arg(i int) *TypeExpr {
+
+	if t == nil || i >= len(t.Args) {
+		return nil
+	}
+	return t.Args[i]
+}
+
+func (s *Signature) String() string {
+
+	var parts []string
+	for i, prm := range s.Params {
+		p := prm.Name
+		if s.Variadic && i == len(s.Params)-1 {
+			p = "*" + p
+		}
+		if prm.Type != nil {
+			p += ": " + prm.Type.String()
+		}
+		if prm.HasDefault {
+			p += " = ..."
+		}
+		parts = append(parts, p)
+	}
+	rv := fmt.Sprintf("%s(%s)", s.Name, strings.Join(parts, ", "))
+	if s.Return != nil {
+		rv += " -> " + s.Return.String()
+	}
+	return rv
+}
+
+// minArgs is the number of arguments a caller must supply.
+func (s *Signature) minArgs() int {
+
+	n := 0
+	for i, prm := range s.Params {
+		if prm.HasDefault || (s.Variadic && i == len(s.Params)-1) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// maxArgs is the most arguments a caller may supply, or -1 if unbounded.
+func (s *Signature) maxArgs() int {
+
+	if s.Variadic {
+		return -1
+	}
+	return len(s.Params)
+}
+
+// parseTypeAnnotation parses a type following a ':' or '->'. The grammar is
+//
+//	type := name ('.' name)* ('[' type (',' type)* ']')? '?'?
+//
+// where name is an identifier or one of the keywords nil, func, str. Only the
+// token stream is consumed; nothing is emitted.
+func (p *Parser) parseTypeAnnotation() *TypeExpr {
+
+	var name string
+	switch {
+	case p.match(TOKEN_IDENTIFIER), p.match(TOKEN_NIL), p.match(TOKEN_FUNC), p.match(TOKEN_STR):
+		name = p.previous.Lexeme()
+	default:
+		p.errorAtCurrent("Expect type name.")
+		return nil
+	}
+	for p.match(TOKEN_DOT) {
+		p.consume(TOKEN_IDENTIFIER, "Expect type name after '.'.")
+		name += "." + p.previous.Lexeme()
+	}
+	t := &TypeExpr{Name: CanonicalTypeName(name)}
+	if p.match(TOKEN_LEFT_BRACKET) {
+		for {
+			t.Args = append(t.Args, p.parseTypeAnnotation())
+			if !p.match(TOKEN_COMMA) {
+				break
+			}
+		}
+		p.consume(TOKEN_RIGHT_BRACKET, "Expect ']' after type arguments.")
+	}
+	if p.match(TOKEN_QUESTION) {
+		t.Optional = true
+	}
+	return t
+}
+
+// optionalTypeAnnotation parses `: type` if present, returning nil otherwise.
+func (p *Parser) optionalTypeAnnotation() *TypeExpr {
+
+	if p.match(TOKEN_COLON) {
+		return p.parseTypeAnnotation()
+	}
+	return nil
+}
+
+// ParseSignature parses a callable signature written in annotation syntax,
+// e.g. `(x: float, y: float = 0.0, *rest: any) -> vec2`. Default values are
+// skipped rather than compiled; only their presence matters. This is how
+// native builtins describe themselves to the checker (see
+// vm.BuiltInSignatures).
+func ParseSignature(name, src string) (*Signature, error) {
+
+	p := NewParser()
+	p.scn = NewScanner(src)
+	p.currentCompiler = NewCompiler(TYPE_SCRIPT, name, nil, nil)
+	p.advance()
+
+	sig := &Signature{Name: name}
+	p.consume(TOKEN_LEFT_PAREN, "")
+	if !p.check(TOKEN_RIGHT_PAREN) {
+		for {
+			rest := p.match(TOKEN_STAR)
+			p.consume(TOKEN_IDENTIFIER, "")
+			prm := Param{Name: p.previous.Lexeme()}
+			prm.Type = p.optionalTypeAnnotation()
+			if p.match(TOKEN_EQUAL) {
+				prm.HasDefault = true
+				for !p.check(TOKEN_COMMA) && !p.check(TOKEN_RIGHT_PAREN) && !p.check(TOKEN_EOF) {
+					p.advance()
+				}
+			}
+			sig.Params = append(sig.Params, prm)
+			if rest {
+				sig.Variadic = true
+				break
+			}
+			if !p.match(TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(TOKEN_RIGHT_PAREN, "")
+	if p.match(TOKEN_ARROW) {
+		sig.Return = p.parseTypeAnnotation()
+	}
+	if p.hadError || !(p.check(TOKEN_EOL) || p.check(TOKEN_EOF)) {
+		return nil, fmt.Errorf("malformed signature for %s: %q", name, src)
+	}
+	return sig, nil
+}
@@ -0,0 +1,250 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Warnings are Diagnostics with SeverityWarning whose Code names the check
+// that produced them. The compiler always reports them; a WarningConfig
+// decides which ones the user sees and which are promoted to errors.
+const (
+	WarnUnusedVariable      = "unused-variable"      // a local is declared but never read
+	WarnShadowing           = "shadowing"            // a local hides one from an enclosing scope or function
+	WarnImplicitDeclaration = "implicit-declaration" // `x = v` declares x because nothing called x exists
+	WarnUnreachableCode     = "unreachable-code"     // a statement follows return/raise/break/continue in the same block
+	WarnTruthiness          = "truthiness"           // a condition that can never be true (ints, strings, objects are falsey)
+)
+
+// WarningLevel says what happens to one kind of warning.
+type WarningLevel int
+
+const (
+	WarningOff WarningLevel = iota
+	WarningOn
+	WarningError
+)
+
+// warningDefaults lists every warning and whether it is on by default.
+// Implicit declaration is a documented language feature, so it is opt-in.
+var warningDefaults = []struct {
+	name  string
+	level WarningLevel
+}{
+	{WarnUnusedVariable, WarningOn},
+	{WarnShadowing, WarningOn},
+	{WarnImplicitDeclaration, WarningOff},
+	{WarnUnreachableCode, WarningOn},
+	{WarnTruthiness, WarningOn},
+}
+
+// WarningNames returns the names of all warnings, in documentation order.
+func WarningNames() []string {
+
+	names := make([]string, len(warningDefaults))
+	for i, w := range warningDefaults {
+		names[i] = w.name
+	}
+	return names
+}
+
+// WarningConfig maps each warning name to its level. A nil WarningConfig
+// disables every warning, which is what a plain `glox script.lox` run uses.
+type WarningConfig map[string]WarningLevel
+
+// DefaultWarnings returns the configuration `glox lint` starts from: every
+// warning except implicit-declaration.
+func DefaultWarnings() WarningConfig {
+
+	c := WarningConfig{}
+	for _, w := range warningDefaults {
+		c[w.name] = w.level
+	}
+	return c
+}
+
+// Set applies one -W command-line flag, in the style of C compilers:
+//
+//	-Wall               enable every warning
+//	-Werror             make every warning enabled so far an error
+//	-W<name>            enable a warning
+//	-Wno-<name>         disable a warning
+//	-Werror=<name>      enable a warning as an error
+//
+// It returns an error for a malformed flag or an unknown warning name.
+func (c WarningConfig) Set(flag string) error {
+
+	spec, ok := strings.CutPrefix(flag, "-W")
+	if !ok || spec == "" {
+		return fmt.Errorf("not a warning flag: %s", flag)
+	}
+	switch {
+	case spec == "all":
+		for _, name := range WarningNames() {
+			if c[name] == WarningOff {
+				c[name] = WarningOn
+			}
+		}
+		return nil
+	case spec == "error":
+		for name, level := range c {
+			if level == WarningOn {
+				c[name] = WarningError
+			}
+		}
+		return nil
+	}
+	level := WarningOn
+	name := spec
+	if n, ok := strings.CutPrefix(spec, "no-"); ok {
+		level, name = WarningOff, n
+	} else if n, ok := strings.CutPrefix(spec, "error="); ok {
+		level, name = WarningError, n
+	}
+	if !isWarningName(name) {
+		return fmt.Errorf("unknown warning '%s' (known: %s)", name, strings.Join(WarningNames(), ", "))
+	}
+	c[name] = level
+	return nil
+}
+
+// Apply filters diags through the configuration: disabled warnings are
+// dropped and warnings configured as errors become errors. Errors pass
+// through unchanged. The result is sorted by position, since some warnings
+// (unused variables) are only known once their scope has closed.
+func (c WarningConfig) Apply(diags []Diagnostic) []Diagnostic {
+
+	var out []Diagnostic
+	for _, d := range diags {
+		if d.Severity == SeverityWarning {
+			switch c[d.Code] {
+			case WarningOff:
+				continue
+			case WarningError:
+				d.Severity = SeverityError
+			}
+		}
+		out = append(out, d)
+	}
+	if c != nil {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Span.Offset < out[j].Span.Offset })
+	}
+	return out
+}
+
+func isWarningName(name string) bool {
+
+	for _, w := range warningDefaults {
+		if w.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint compiles source with the static checker attached, so warnings that
+// need type information (truthiness) are found too, and returns every
+// warning along with any syntax errors. Type errors are left to Check. ok
+// is false if the file failed to compile.
+func Lint(script string, source string, builtins map[string]string) (diags []Diagnostic, ok bool) {
+
+	parser := newCheckingParser(builtins)
+	parser.scn = NewScanner(source)
+	parser.compileScript(script)
+
+	for _, d := range parser.diagnostics {
+		if d.Code != CodeType {
+			diags = append(diags, d)
+		}
+	}
+	return diags, !parser.hadError
+}
+
+//-----------------------------------------------------------------------------
+// Parser hooks.
+
+// warn reports a warning of the given kind at tok, unless a
+// `// glox:ignore` comment covers that line.
+func (p *Parser) warn(tok Token, name string, msg string, related ...Note) {
+
+	if p.scn.ignored(tok.Line, name) {
+		return
+	}
+	p.report(Diagnostic{
+		Severity: SeverityWarning,
+		Code:     name,
+		Span:     p.tokenSpan(tok),
+		Near:     tok.Lexeme(),
+		Message:  msg,
+		Related:  related,
+	})
+}
+
+// warnUnused reports the locals from index first upwards that were never
+// read. Names starting with '_' are exempt, as are the compiler's own
+// synthetic locals (line 0) and the receiver slot.
+func (p *Parser) warnUnused(first int) {
+
+	c := p.currentCompiler
+	for i := first; i < c.localCount; i++ {
+		l := c.locals[i]
+		if l.used || l.isCaptured || l.name.Line == 0 || l.lexeme == "" || strings.HasPrefix(l.lexeme, "_") {
+			continue
+		}
+		p.warn(l.name, WarnUnusedVariable, fmt.Sprintf("Local variable '%s' is never used.", l.lexeme))
+	}
+}
+
+// warnShadowing reports a new local that hides a local of the same name
+// declared in an enclosing block or an enclosing function.
+func (p *Parser) warnShadowing(name Token) {
+
+	lexeme := name.Lexeme()
+	if name.Line == 0 || strings.HasPrefix(lexeme, "_") {
+		return
+	}
+	for c := p.currentCompiler; c != nil; c = c.enclosing {
+		for i := c.localCount - 1; i >= 1; i-- {
+			local := c.locals[i]
+			if c == p.currentCompiler && (local.depth == -1 || local.depth >= c.scopeDepth) {
+				continue // same scope: declareVariable reports the redeclaration
+			}
+			if local.name.Line != 0 && p.identifiersEqual(name, local.name) {
+				p.warn(name, WarnShadowing, fmt.Sprintf("Local variable '%s' shadows an outer local.", lexeme),
+					Note{Span: p.tokenSpan(local.name), Message: "'" + lexeme + "' is declared in an enclosing scope here"})
+				return
+			}
+		}
+	}
+}
+
+// condition compiles the condition of an if, while or for statement and
+// warns if it can never be true. Only floats and bools are truthy, so a
+// bare int, string or object condition is always false. Literals are
+// caught by every compile; other expressions need the checker's types.
+func (p *Parser) condition() {
+
+	start := p.current
+	p.expression()
+	t := p.exprType()
+	if p.previous.Offset == start.Offset {
+		switch start.Tokentype {
+		case TOKEN_INT:
+			t = namedType("int")
+		case TOKEN_STRING:
+			t = namedType("string")
+		}
+	}
+	if t != nil && !truthyTypes[t.Name] {
+		p.warn(start, WarnTruthiness, fmt.Sprintf("Condition is always false: %s values are falsey; compare explicitly.", t))
+	}
+}
+
+// truthyTypes are the static types whose values can be true in a condition.
+var truthyTypes = map[string]bool{
+	"any":    true,
+	"float":  true,
+	"bool":   true,
+	"number": true,
+}
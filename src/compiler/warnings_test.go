@@ -0,0 +1,36 @@
+package compiler
+
+import "testing"
+
+func TestWarningConfigFlags(t *testing.T) {
+	c := DefaultWarnings()
+	if c[WarnImplicitDeclaration] != WarningOff || c[WarnUnusedVariable] != WarningOn {
+		t.Fatalf("unexpected defaults: %v", c)
+	}
+	for _, flag := range []string{"-Wall", "-Wno-shadowing", "-Werror=truthiness"} {
+		if err := c.Set(flag); err != nil {
+			t.Fatalf("%s: %v", flag, err)
+		}
+	}
+	if c[WarnImplicitDeclaration] != WarningOn || c[WarnShadowing] != WarningOff || c[WarnTruthiness] != WarningError {
+		t.Fatalf("flags not applied: %v", c)
+	}
+	if err := c.Set("-Wno-such-warning"); err == nil {
+		t.Fatal("expected an error for an unknown warning")
+	}
+}
+
+func TestWarningsFilteredAndIgnored(t *testing.T) {
+	src := "fun f() {\n    var a = 1;\n    var b = 2; // glox:ignore unused-variable\n    return;\n    print 1;\n}\n"
+	fn, diags := Compile("test.lox", src, "__main__")
+	if fn == nil || HasErrors(diags) {
+		t.Fatalf("expected a clean compile, got %v", diags)
+	}
+	if len(WarningConfig(nil).Apply(diags)) != 0 {
+		t.Fatal("a nil config should drop every warning")
+	}
+	got := DefaultWarnings().Apply(diags)
+	if len(got) != 2 || got[0].Code != WarnUnusedVariable || got[0].Span.Line != 2 || got[1].Code != WarnUnreachableCode {
+		t.Fatalf("unexpected warnings: %v", got)
+	}
+}
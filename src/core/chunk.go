@@ -82,7 +82,13 @@ const (
 	OP_INCR_CONST_N
 	OP_INCR_CONST_I
 	OP_INCR_CONST_F
-	OP_JUMP_IF_DEFINED // operands: 1-byte local slot, 2-byte forward offset; skips the default-fill prologue when the slot is already defined
+	OP_JUMP_IF_DEFINED     // operands: 1-byte local slot, 2-byte forward offset; skips the default-fill prologue when the slot is already defined
+	OP_EXPORT              // operand: 1-byte constant index of the exported global's name
+	OP_ASYNC               // starts an async function's body: sets its frame aside as a task and returns the task
+	OP_AWAIT               // suspends the running task until the awaitable on the stack is done, leaving its result
+	OP_CALL_SPREAD         // as OP_CALL, but the last argument is a list or tuple spread into the arguments
+	OP_INVOKE_SPREAD       // as OP_INVOKE, with the last argument spread
+	OP_SUPER_INVOKE_SPREAD // as OP_SUPER_INVOKE, with the last argument spread
 )
 
 func NewChunk(filename string) *Chunk {
@@ -136,7 +142,7 @@ func (c *Chunk) AddConstant(v Value) uint8 {
 func (c *Chunk) InConstants(v Value) (bool, uint8) {
 
 	if v.IsObj() {
-		t := v.Obj.GetType()
+		t := v.Obj().GetType()
 		if t == OBJECT_BOUNDMETHOD || t == OBJECT_CLOSURE || t == OBJECT_FUNCTION {
 			return false, 0
 		}
@@ -30,18 +30,18 @@ package core
 // them is only copied once and both copies end up pointing at the same
 // new object, mirroring the original aliasing.
 func CopyValueForSpawn(v Value, memo map[Object]Object) Value {
-	switch v.Type {
+	switch v.Type() {
 	case VAL_OBJ:
 		return copyObjectValueForSpawn(v, memo)
 	case VAL_VEC2:
 		vec := v.AsVec2()
-		return MakeVec2Value(vec.X, vec.Y, v.Immut)
+		return MakeVec2Value(vec.X, vec.Y, v.Immutable())
 	case VAL_VEC3:
 		vec := v.AsVec3()
-		return MakeVec3Value(vec.X, vec.Y, vec.Z, v.Immut)
+		return MakeVec3Value(vec.X, vec.Y, vec.Z, v.Immutable())
 	case VAL_VEC4:
 		vec := v.AsVec4()
-		return MakeVec4Value(vec.X, vec.Y, vec.Z, vec.W, v.Immut)
+		return MakeVec4Value(vec.X, vec.Y, vec.Z, vec.W, v.Immutable())
 	default:
 		// nil/bool/int/float: already value types, no aliasing possible.
 		return v
@@ -49,7 +49,7 @@ func CopyValueForSpawn(v Value, memo map[Object]Object) Value {
 }
 
 func copyObjectValueForSpawn(v Value, memo map[Object]Object) Value {
-	switch v.Obj.GetType() {
+	switch v.Obj().GetType() {
 	case OBJECT_STRING:
 		// Interned and immutable -- safe to share as-is, no copy needed.
 		return v
@@ -88,8 +88,8 @@ func copyObjectValueForSpawn(v Value, memo map[Object]Object) Value {
 		// the same live *ClassObject.
 		newInst := MakeInstanceObject(inst.Class)
 		memo[inst] = newInst
-		for k, val := range inst.Fields {
-			newInst.Fields[k] = CopyValueForSpawn(val, memo)
+		for slot, k := range inst.FieldNames() {
+			newInst.SetField(k, CopyValueForSpawn(inst.Slots[slot], memo))
 		}
 		return MakeObjectValue(newInst, false)
 
@@ -113,7 +113,10 @@ func copyObjectValueForSpawn(v Value, memo map[Object]Object) Value {
 		return MakeObjectValue(newBM, false)
 
 	case OBJECT_CLASS:
-		// Shared by pointer -- deliberate, see package doc comment.
+		// Shared by pointer -- deliberate, see package doc comment. Noted
+		// in memo all the same, so a snapshot can find the classes whose
+		// statics it must capture (see snapshot.go).
+		memo[v.AsClass()] = v.AsClass()
 		return v
 
 	default:
@@ -158,9 +161,17 @@ func CopyClosureForSpawn(closure *ClosureObject, memo map[Object]Object) *Closur
 // &Closed once closed) -- see obj_upval.go. The copy is born already
 // closed: there's no live stack in the new VM for it to reference, since
 // it's a one-time snapshot, not a continuing binding, and it's never
-// linked into any VM's openUpValues list.
+// linked into any VM's openUpValues list. It is memoised like any object,
+// so closures that captured the same variable still share one after.
 func copyUpvalueForSpawn(uv *UpvalueObject, memo map[Object]Object) *UpvalueObject {
+	if uv == nil {
+		return nil
+	}
+	if copy, ok := memo[uv]; ok {
+		return copy.(*UpvalueObject)
+	}
 	newUv := &UpvalueObject{}
+	memo[uv] = newUv
 	newUv.Closed = CopyValueForSpawn(*uv.Location, memo)
 	newUv.Location = &newUv.Closed
 	return newUv
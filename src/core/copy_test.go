@@ -58,7 +58,7 @@ func TestCopyValueForSpawn_InstanceSharesClassClonesFields(t *testing.T) {
 	class := MakeClassObject("Point")
 	inst := MakeInstanceObject(class)
 	fx := InternName("x")
-	inst.Fields[fx] = MakeIntValue(1, false)
+	inst.SetField(fx, MakeIntValue(1, false))
 
 	copyVal := CopyValueForSpawn(MakeObjectValue(inst, false), map[Object]Object{})
 	copyInst := copyVal.AsInstance()
@@ -69,9 +69,9 @@ func TestCopyValueForSpawn_InstanceSharesClassClonesFields(t *testing.T) {
 	if copyInst.Class != class {
 		t.Fatal("expected the class to be shared by pointer, not cloned")
 	}
-	inst.Fields[fx] = MakeIntValue(99, false)
-	if copyInst.Fields[fx].AsInt() != 1 {
-		t.Fatalf("mutating original's fields leaked into copy: got %v", copyInst.Fields[fx])
+	inst.SetField(fx, MakeIntValue(99, false))
+	if x, _ := copyInst.GetField(fx); x.AsInt() != 1 {
+		t.Fatalf("mutating original's fields leaked into copy: got %v", x)
 	}
 }
 
@@ -84,7 +84,7 @@ func TestCopyValueForSpawn_ClassAndStringAreShared(t *testing.T) {
 
 	str := MakeStringObjectValue("hello", false)
 	copyStr := CopyValueForSpawn(str, map[Object]Object{})
-	if copyStr.Obj != str.Obj {
+	if copyStr.Obj() != str.Obj() {
 		t.Fatal("expected string Obj to be shared (interned, immutable)")
 	}
 }
@@ -93,7 +93,7 @@ func TestCopyValueForSpawn_VecIsClonedNotAliased(t *testing.T) {
 	original := MakeVec2Value(1, 2, false)
 	copyVal := CopyValueForSpawn(original, map[Object]Object{})
 
-	if copyVal.Obj == original.Obj {
+	if copyVal.Obj() == original.Obj() {
 		t.Fatal("expected a distinct *Vec2Object, got the same pointer")
 	}
 	original.AsVec2().X = 99
@@ -11,6 +11,8 @@ type Environment struct {
 	Globals     []Value       // slot-indexed, for fast OP_GET_GLOBAL
 	Defined     []bool        // slot-indexed defined flags
 	GlobalNames []string      // slot → name, shared by every function in the compilation unit (for error messages)
+	Exports     map[int]bool  // InternedIds of names declared with `export`; nil if there are none
+	Chunk       *Chunk        // the top-level chunk these are the globals of, the REPL's latest line; see snapshot.go
 
 	// varsMu guards Vars only. A built-in module's Environment is shared
 	// by reference across the parent VM and every thread-module worker
@@ -89,6 +91,24 @@ func (env *Environment) SetVar(stringId int, value Value) {
 	env.Vars[stringId] = value
 }
 
+// DeleteVar removes an entry from the InternedId-keyed map, e.g. a submodule
+// whose import failed.
+func (env *Environment) DeleteVar(stringId int) {
+	env.varsMu.Lock()
+	defer env.varsMu.Unlock()
+	delete(env.Vars, stringId)
+}
+
+// Export records a name declared with `export` (OP_EXPORT).
+func (env *Environment) Export(stringId int) {
+	env.varsMu.Lock()
+	defer env.varsMu.Unlock()
+	if env.Exports == nil {
+		env.Exports = map[int]bool{}
+	}
+	env.Exports[stringId] = true
+}
+
 // GetVar reads from the InternedId-keyed map (used for module property access).
 func (env *Environment) GetVar(stringId int) (Value, bool) {
 	if env == nil {
@@ -0,0 +1,15 @@
+package core
+
+// Fiber is the script's view of a fiber spawned with VMContext.SpawnFiber:
+// a function running on the VM that spawned it, taking turns with the
+// others each time it calls fiber.yield() or fiber.sleep(). The VM's
+// scheduler sets Done, and Result or Err, when the function returns or
+// raises; cancel() sets Cancelled, after which it isn't run again. A fiber
+// never runs at the same time as the code inspecting it, so none of this
+// needs a lock.
+type Fiber struct {
+	Done      bool
+	Result    Value
+	Err       error
+	Cancelled bool
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystem is what the os module's file and directory operations go
+// through, so a sandbox can confine them (see VMContext.FileSystem). Names
+// are slash-separated paths as scripts write them.
+type FileSystem interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	Getwd() (string, error)
+	Chdir(name string) error
+}
+
+// HostFileSystem is the process's own file system, relative to its
+// working directory.
+type HostFileSystem struct{}
+
+func (HostFileSystem) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (HostFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (HostFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+func (HostFileSystem) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+
+func (HostFileSystem) Remove(name string) error { return os.Remove(name) }
+
+func (HostFileSystem) Getwd() (string, error) { return os.Getwd() }
+
+func (HostFileSystem) Chdir(name string) error { return os.Chdir(name) }
+
+// RootFileSystem confines files to the directory it was opened on, which
+// scripts see as "/": absolute names are taken relative to it, and a name
+// that leads out of it, by ".." or by a symlink, fails. The working
+// directory is always "/" and can't be changed.
+type RootFileSystem struct {
+	root *os.Root
+}
+
+// OpenRootFileSystem makes a RootFileSystem for the directory dir.
+func OpenRootFileSystem(dir string) (*RootFileSystem, error) {
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &RootFileSystem{root: root}, nil
+}
+
+// local turns a script's name for a file into one relative to the root,
+// failing with fs.ErrPermission for one outside it.
+func (r *RootFileSystem) local(op, name string) (string, error) {
+
+	local := filepath.Clean(filepath.FromSlash(strings.TrimLeft(name, `/\`)))
+	if !filepath.IsLocal(local) && local != "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return local, nil
+}
+
+// denied turns os.Root's error for a name that escapes it through a
+// symlink into one with fs.ErrPermission, as local's are.
+func denied(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) && pe.Err.Error() == "path escapes from parent" {
+		return &fs.PathError{Op: pe.Op, Path: pe.Path, Err: fs.ErrPermission}
+	}
+	return err
+}
+
+func (r *RootFileSystem) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	local, err := r.local("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.root.OpenFile(local, flag, perm)
+	return f, denied(err)
+}
+
+func (r *RootFileSystem) Stat(name string) (fs.FileInfo, error) {
+	local, err := r.local("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.root.Stat(local)
+	return info, denied(err)
+}
+
+func (r *RootFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	local, err := r.local("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := r.root.Open(local)
+	if err != nil {
+		return nil, denied(err)
+	}
+	defer dir.Close()
+	return dir.ReadDir(-1)
+}
+
+func (r *RootFileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	local, err := r.local("mkdir", name)
+	if err != nil {
+		return err
+	}
+	path := ""
+	for _, part := range strings.Split(local, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		if err := r.root.Mkdir(path, perm); err != nil && !os.IsExist(err) {
+			return denied(err)
+		}
+	}
+	return nil
+}
+
+func (r *RootFileSystem) Remove(name string) error {
+	local, err := r.local("remove", name)
+	if err != nil {
+		return err
+	}
+	if local == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	return denied(r.root.Remove(local))
+}
+
+func (r *RootFileSystem) Getwd() (string, error) { return "/", nil }
+
+func (r *RootFileSystem) Chdir(name string) error {
+	return &fs.PathError{Op: "chdir", Path: name, Err: fs.ErrPermission}
+}
+
+// NoFileSystem refuses every operation with fs.ErrPermission: a sandbox
+// with no files.
+type NoFileSystem struct{}
+
+func (NoFileSystem) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func (NoFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrPermission}
+}
+
+func (NoFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (NoFileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (NoFileSystem) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+func (NoFileSystem) Getwd() (string, error) { return "/", nil }
+
+func (NoFileSystem) Chdir(name string) error {
+	return &fs.PathError{Op: "chdir", Path: name, Err: fs.ErrPermission}
+}
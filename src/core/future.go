@@ -0,0 +1,73 @@
+package core
+
+// Future is a result the VM's event loop will have later: that of a task
+// (a call of an async function), a timer, or work done on a goroutine. An
+// await suspends the task awaiting it until it is done. Done is set, with
+// Result or Exception, when it is resolved or rejected; Cancelled when it
+// ended by being cancelled. Everything that resolves or inspects a future
+// runs on the event loop's goroutine, so none of this needs a lock.
+type Future struct {
+	Done      bool
+	Result    Value
+	Exception *InstanceObject // what it failed with, if it did
+	Cancelled bool
+	// Cancel asks whatever will resolve the future to give up, as
+	// Task.cancel() does: a timer or goroutine's future is rejected with
+	// CancelledError at once, a task's once CancelledError has been raised
+	// in it and not caught. It does nothing to a future that is done.
+	Cancel func()
+
+	callbacks []func()
+}
+
+// Resolve makes f done with result v, unless it already is.
+func (f *Future) Resolve(v Value) {
+	if f.Done {
+		return
+	}
+	f.Done, f.Result = true, v
+	f.fire()
+}
+
+// Reject makes f done with the exception exc, unless it already is.
+func (f *Future) Reject(exc *InstanceObject) {
+	if f.Done {
+		return
+	}
+	f.Done, f.Exception = true, exc
+	f.fire()
+}
+
+// OnDone calls fn once f is done: now, if it already is.
+func (f *Future) OnDone(fn func()) {
+	if f.Done {
+		fn()
+		return
+	}
+	f.callbacks = append(f.callbacks, fn)
+}
+
+func (f *Future) fire() {
+	callbacks := f.callbacks
+	f.callbacks = nil
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// Awaitable is implemented by the objects await accepts.
+type Awaitable interface {
+	Awaitable() *Future
+}
+
+// AsyncError is an error the work behind a VMContext.GoAsync future can
+// return to have the future rejected with an exception of class Class,
+// rather than RunTimeError.
+type AsyncError struct {
+	Class string
+	Msg   string
+}
+
+func (e *AsyncError) Error() string {
+	return e.Msg
+}
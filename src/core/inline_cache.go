@@ -0,0 +1,174 @@
+package core
+
+import "sync/atomic"
+
+// InlineCacheSize is how many classes one instruction's inline cache
+// remembers before the site is treated as megamorphic.
+const InlineCacheSize = 4
+
+// InlineCache is the memory of one OP_INVOKE, OP_GET_PROPERTY,
+// OP_SET_PROPERTY, OP_GET_SUPER or OP_SUPER_INVOKE instruction: for each
+// receiver it has seen, what the instruction's name resolved to. A site
+// that has only seen one kind of receiver (monomorphic) checks a single
+// entry; it takes up to InlineCacheSize (polymorphic), after which further
+// ones are left to the full lookup.
+//
+// Instances are remembered by shape. The entry for a shape gives the slot
+// of the field the name refers to or, when the instance has no such field,
+// the method found on its class; at an OP_SET_PROPERTY that adds the field,
+// it also gives the shape the instance moves to. Classes are remembered by
+// identity: the entry is the method found on the class or, when the
+// receiver is the class object itself (static is true), the static method
+// or the class up the Super chain whose class variable the name refers to.
+// Every entry is stamped with the class epoch, so one that was recorded
+// before a class changed is never used.
+//
+// Compiled code is shared by the VMs of the thread module, so entries are
+// immutable once made and published atomically: a VM never sees one half
+// written by another.
+type InlineCache struct {
+	entries [InlineCacheSize]atomic.Pointer[inlineCacheEntry]
+}
+
+type inlineCacheEntry struct {
+	class  *ClassObject // a class entry's class, or nil
+	shape  *Shape       // an instance entry's shape, or nil
+	static bool
+	epoch  uint64
+	slot   int    // an instance entry's field slot, or -1 for a method
+	next   *Shape // the shape after adding the field, at an OP_SET_PROPERTY
+	value  Value
+}
+
+// classEpoch counts the changes to class shape: methods, static methods
+// or class variables defined, and superclasses inherited from. Assigning a
+// new value to an existing class variable is not a change, since the
+// caches hold the class owning it, not its value.
+var classEpoch atomic.Uint64
+
+// ClassesChanged invalidates every inline cache. The VM calls it whenever
+// the methods or class variables of any class change.
+func ClassesChanged() {
+
+	classEpoch.Add(1)
+}
+
+// Get returns what the cache recorded for receivers of class.
+func (c *InlineCache) Get(class *ClassObject, static bool) (Value, bool) {
+
+	epoch := classEpoch.Load()
+	for i := range c.entries {
+		e := c.entries[i].Load()
+		if e == nil {
+			break
+		}
+		if e.class == class && e.shape == nil && e.static == static && e.epoch == epoch {
+			return e.value, true
+		}
+	}
+	return NIL_VALUE, false
+}
+
+// Put records what the name resolved to for receivers of class.
+func (c *InlineCache) Put(class *ClassObject, static bool, value Value) {
+
+	c.put(&inlineCacheEntry{class: class, static: static, slot: -1, value: value})
+}
+
+// GetShape returns what the cache recorded for instances of shape: the
+// slot of their field, or -1 and the method of their class.
+func (c *InlineCache) GetShape(shape *Shape) (int, Value, bool) {
+
+	if e := c.find(shape); e != nil && e.next == nil {
+		return e.slot, e.value, true
+	}
+	return -1, NIL_VALUE, false
+}
+
+// PutField records that instances of shape have the field in slot.
+func (c *InlineCache) PutField(shape *Shape, slot int) {
+
+	c.put(&inlineCacheEntry{shape: shape, slot: slot})
+}
+
+// PutMethod records that instances of shape have no field of the name and
+// that method is the one found on their class.
+func (c *InlineCache) PutMethod(shape *Shape, method Value) {
+
+	c.put(&inlineCacheEntry{shape: shape, slot: -1, value: method})
+}
+
+// GetStore returns, for an OP_SET_PROPERTY on an instance of shape, the
+// slot to store in and, if the field is new, the instance's next shape.
+func (c *InlineCache) GetStore(shape *Shape) (int, *Shape, bool) {
+
+	if e := c.find(shape); e != nil && e.slot >= 0 {
+		return e.slot, e.next, true
+	}
+	return -1, nil, false
+}
+
+// PutStore records an OP_SET_PROPERTY on an instance of shape: the slot it
+// stored in, and the shape the instance moved to if it added the field.
+func (c *InlineCache) PutStore(shape *Shape, slot int, next *Shape) {
+
+	if next == nil || !next.IsDictionary() {
+		c.put(&inlineCacheEntry{shape: shape, slot: slot, next: next})
+	}
+}
+
+// find returns the current entry for shape.
+func (c *InlineCache) find(shape *Shape) *inlineCacheEntry {
+
+	epoch := classEpoch.Load()
+	for i := range c.entries {
+		e := c.entries[i].Load()
+		if e == nil {
+			break
+		}
+		if e.shape == shape && e.epoch == epoch {
+			return e
+		}
+	}
+	return nil
+}
+
+// put stores entry in the first slot that is unused, out of date or for
+// the same receiver. A cache full of current entries for other receivers
+// is left alone, as are dictionary shapes, which change in place.
+func (c *InlineCache) put(entry *inlineCacheEntry) {
+
+	if entry.shape != nil && entry.shape.IsDictionary() {
+		return
+	}
+	epoch := classEpoch.Load()
+	entry.epoch = epoch
+	for i := range c.entries {
+		e := c.entries[i].Load()
+		if e == nil || e.epoch != epoch || (e.class == entry.class && e.shape == entry.shape && e.static == entry.static) {
+			c.entries[i].Store(entry)
+			return
+		}
+	}
+}
+
+// InlineCache returns the cache of the instruction at ip, creating it, and
+// the table of the chunk's caches, the first time either is needed.
+func (c *Chunk) InlineCache(ip int) *InlineCache {
+
+	caches := c.caches.Load()
+	if caches == nil {
+		table := make([]atomic.Pointer[InlineCache], len(c.Code))
+		if !c.caches.CompareAndSwap(nil, &table) {
+			caches = c.caches.Load()
+		} else {
+			caches = &table
+		}
+	}
+	cache := (*caches)[ip].Load()
+	if cache == nil {
+		(*caches)[ip].CompareAndSwap(nil, &InlineCache{})
+		cache = (*caches)[ip].Load()
+	}
+	return cache
+}
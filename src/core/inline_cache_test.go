@@ -0,0 +1,58 @@
+package core
+
+import "testing"
+
+func TestInlineCachePolymorphic(t *testing.T) {
+	var cache InlineCache
+	classes := make([]*ClassObject, InlineCacheSize+1)
+	for i := range classes {
+		classes[i] = MakeClassObject("C")
+		cache.Put(classes[i], false, MakeIntValue(i, false))
+	}
+
+	for i, class := range classes[:InlineCacheSize] {
+		if v, ok := cache.Get(class, false); !ok || v.AsInt() != i {
+			t.Errorf("class %d: got %v, %v", i, v, ok)
+		}
+		if _, ok := cache.Get(class, true); ok {
+			t.Errorf("class %d: instance entry used for the class object", i)
+		}
+	}
+	if _, ok := cache.Get(classes[InlineCacheSize], false); ok {
+		t.Error("a full cache took another class")
+	}
+
+	cache.Put(classes[0], false, MakeIntValue(10, false))
+	if v, _ := cache.Get(classes[0], false); v.AsInt() != 10 {
+		t.Errorf("entry not replaced: got %v", v)
+	}
+}
+
+func TestInlineCacheInvalidatedByClassChange(t *testing.T) {
+	var cache InlineCache
+	a, b := MakeClassObject("A"), MakeClassObject("B")
+	cache.Put(a, false, MakeIntValue(1, false))
+
+	ClassesChanged()
+	if _, ok := cache.Get(a, false); ok {
+		t.Fatal("entry survived a class change")
+	}
+
+	// Out of date entries make room for new ones.
+	cache.Put(b, false, MakeIntValue(2, false))
+	if v, ok := cache.Get(b, false); !ok || v.AsInt() != 2 {
+		t.Errorf("got %v, %v", v, ok)
+	}
+}
+
+func TestChunkInlineCache(t *testing.T) {
+	chunk := NewChunk("test")
+	chunk.Code = make([]uint8, 8)
+
+	if chunk.InlineCache(3) != chunk.InlineCache(3) {
+		t.Error("an instruction's cache is not kept")
+	}
+	if chunk.InlineCache(3) == chunk.InlineCache(5) {
+		t.Error("two instructions share a cache")
+	}
+}
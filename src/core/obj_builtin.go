@@ -2,6 +2,7 @@ package core
 
 type BuiltInObject struct {
 	Function BuiltInFn
+	Module   string // the built-in module it belongs to, "" for a global or method
 }
 
 func MakeBuiltInObject(function BuiltInFn) *BuiltInObject {
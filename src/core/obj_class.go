@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sync"
 )
 
 type ClassObject struct {
@@ -10,6 +11,13 @@ type ClassObject struct {
 	StaticMethods map[int]Value
 	Statics       map[int]Value
 	Super         *ClassObject
+	Shape         *Shape // the root shape of the class's instances
+
+	// staticsMu guards Statics, like Environment.varsMu guards Vars: a
+	// class is shared by pointer with the threads it reaches (see copy.go),
+	// and the memory meter walks the class variables of one while its own
+	// VM may be setting them.
+	staticsMu sync.RWMutex
 }
 
 func MakeClassObject(name string) *ClassObject {
@@ -19,12 +27,13 @@ func MakeClassObject(name string) *ClassObject {
 		Methods:       map[int]Value{},
 		StaticMethods: map[int]Value{},
 		Statics:       map[int]Value{},
+		Shape:         NewRootShape(),
 	}
 }
 
-func (ClassObject) IsObject() {}
+func (*ClassObject) IsObject() {}
 
-func (ClassObject) GetType() ObjectType {
+func (*ClassObject) GetType() ObjectType {
 
 	return OBJECT_CLASS
 }
@@ -34,6 +43,44 @@ func (f *ClassObject) String() string {
 	return fmt.Sprintf("<class %s>", f.Name.Get())
 }
 
+// GetStatic returns the class variable id of this class alone, not walking
+// Super.
+func (f *ClassObject) GetStatic(id int) (Value, bool) {
+	f.staticsMu.RLock()
+	defer f.staticsMu.RUnlock()
+	value, ok := f.Statics[id]
+	return value, ok
+}
+
+// SetStatic sets the class variable id, reporting whether it is new.
+func (f *ClassObject) SetStatic(id int, value Value) bool {
+	f.staticsMu.Lock()
+	defer f.staticsMu.Unlock()
+	_, ok := f.Statics[id]
+	f.Statics[id] = value
+	return !ok
+}
+
+// StaticsSnapshot returns a copy of Statics, safe to range over without
+// racing a concurrent SetStatic.
+func (f *ClassObject) StaticsSnapshot() map[int]Value {
+	f.staticsMu.RLock()
+	defer f.staticsMu.RUnlock()
+	snapshot := make(map[int]Value, len(f.Statics))
+	for k, v := range f.Statics {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// SetStatics replaces Statics wholesale, as a snapshot restore or a reload
+// does.
+func (f *ClassObject) SetStatics(statics map[int]Value) {
+	f.staticsMu.Lock()
+	defer f.staticsMu.Unlock()
+	f.Statics = statics
+}
+
 func (f *ClassObject) IsSubclassOf(other *ClassObject) bool {
 	for c := f; c != nil; c = c.Super {
 		if c == other {
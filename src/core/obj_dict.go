@@ -79,6 +79,9 @@ func init() {
 					return NIL_VALUE
 				}
 				d := vm.Stack(arg_stackptr - 1).AsDict()
+				if !vm.Charge(ListSize + (ValueSize+StringSize)*len(d.Items)) {
+					return NIL_VALUE
+				}
 				return d.Keys()
 			},
 		},
@@ -2,16 +2,37 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
 	"strings"
 )
 
+// StdStream identifies one of sys.stdin, sys.stdout and sys.stderr.
+type StdStream int
+
+const (
+	NOT_STD StdStream = iota
+	STDIN
+	STDOUT
+	STDERR
+)
+
+// A FileObject reads and writes a file opened by os.open, a Go stream, or
+// an in-memory buffer. The standard ones the sys module starts with have
+// none of these: Std says which stream they stand for, and each VM
+// resolves them to its own (see VMContext.ResolveFile), so a script's
+// print goes wherever the VM running it was told to send output.
 type FileObject struct {
 	File   *os.File
 	Closed bool
 	Eof    bool
 	Reader *bufio.Reader
 	Writer *bufio.Writer
+	Std    StdStream
+
+	stream io.Writer     // written through unbuffered, in place of Writer
+	buffer *bytes.Buffer // for a buffer, what Writer flushes to
 }
 
 func MakeFileObject(file *os.File) *FileObject {
@@ -23,6 +44,48 @@ func MakeFileObject(file *os.File) *FileObject {
 	}
 }
 
+// MakeStreamFileObject wraps Go streams, either of which may be nil.
+// Writes go straight through, so goroutines sharing w interleave whole
+// writes as they would on an *os.File, and closing it leaves the streams
+// open.
+func MakeStreamFileObject(r io.Reader, w io.Writer) *FileObject {
+
+	f := &FileObject{stream: w}
+	if r != nil {
+		f.Reader = bufio.NewReader(r)
+	}
+	return f
+}
+
+// MakeBufferFileObject makes an in-memory file for os.buffer(): what is
+// written to it can be read back with readln, or all at once with Contents.
+func MakeBufferFileObject() *FileObject {
+
+	buf := &bytes.Buffer{}
+	return &FileObject{
+		Reader: bufio.NewReader(buf),
+		Writer: bufio.NewWriter(buf),
+		buffer: buf,
+	}
+}
+
+// MakeStdFileObject makes the placeholder for the standard stream std.
+func MakeStdFileObject(std StdStream) *FileObject {
+
+	return &FileObject{Std: std}
+}
+
+// Contents returns everything written to a buffer and not yet read, and
+// false if f is not a buffer.
+func (f *FileObject) Contents() (string, bool) {
+
+	if f.buffer == nil {
+		return "", false
+	}
+	f.Writer.Flush()
+	return f.buffer.String(), true
+}
+
 func (FileObject) IsObject() {}
 
 func (FileObject) GetType() ObjectType {
@@ -32,24 +95,46 @@ func (FileObject) GetType() ObjectType {
 
 func (f *FileObject) String() string {
 
+	switch f.Std {
+	case STDIN:
+		return "<stdin>"
+	case STDOUT:
+		return "<stdout>"
+	case STDERR:
+		return "<stderr>"
+	}
 	return "<file>"
 }
 
 func (f *FileObject) Close() {
-	f.Writer.Flush()
-	f.File.Close()
+	if f.Writer != nil {
+		f.Writer.Flush()
+	}
+	if f.File != nil {
+		f.File.Close()
+	}
 	f.Closed = true
 }
 
 func (f *FileObject) ReadLine() Value {
 
-	if f.Eof {
+	if f.Eof || f.Reader == nil {
 		return NIL_VALUE
 	}
+	if f.buffer != nil {
+		f.Writer.Flush()
+	}
 
 	line, err := f.Reader.ReadString('\n')
 	line = strings.TrimRight(line, "\r\n")
 	if err != nil {
+		if err.Error() == "EOF" && f.buffer != nil {
+			// Not the end for good: a buffer read dry can be written again.
+			if len(line) == 0 {
+				return NIL_VALUE
+			}
+			return MakeStringObjectValue(line, false)
+		}
 		if err.Error() == "EOF" {
 			f.Eof = true
 			if len(line) > 0 {
@@ -64,10 +149,21 @@ func (f *FileObject) Write(str Value) {
 
 	s := str.AsString().Get()
 	s = strings.ReplaceAll(s, `\n`, "\n")
-	f.Writer.WriteString(s)
+	f.WriteString(s)
 
 }
 
+// WriteString writes s as it is, without Write's escape handling.
+func (f *FileObject) WriteString(s string) {
+
+	switch {
+	case f.Writer != nil:
+		f.Writer.WriteString(s)
+	case f.stream != nil:
+		io.WriteString(f.stream, s)
+	}
+}
+
 // -------------------------------------------------------------------------------------------
 func (t FileObject) IsBuiltIn() bool {
 	return true
@@ -12,6 +12,8 @@ type FunctionObject struct {
 	Name         StringObject
 	UpvalueCount int
 	Environment  *Environment
+	ParamTypes   []string // type annotation per parameter, "" if none (not persisted in .lxc)
+	ReturnType   string   // `-> type` annotation, "" if none
 }
 
 func MakeFunctionObject(filename string, environment *Environment) *FunctionObject {
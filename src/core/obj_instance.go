@@ -4,19 +4,50 @@ import (
 	"fmt"
 )
 
+// InstanceObject keeps its fields in Slots, in the order Shape gives
+// them; see Shape.
 type InstanceObject struct {
-	Class  *ClassObject
-	Fields map[int]Value
+	Class *ClassObject
+	Shape *Shape
+	Slots []Value
 }
 
 func MakeInstanceObject(class *ClassObject) *InstanceObject {
 
 	return &InstanceObject{
-		Class:  class,
-		Fields: map[int]Value{},
+		Class: class,
+		Shape: class.Shape,
 	}
 }
 
+// GetField returns the value of the field named name.
+func (o *InstanceObject) GetField(name int) (Value, bool) {
+
+	if slot := o.Shape.Slot(name); slot >= 0 {
+		return o.Slots[slot], true
+	}
+	return Value{}, false
+}
+
+// SetField sets the field named name, adding it if the instance does not
+// have it.
+func (o *InstanceObject) SetField(name int, v Value) {
+
+	if slot := o.Shape.Slot(name); slot >= 0 {
+		o.Slots[slot] = v
+		return
+	}
+	o.Shape = o.Shape.With(name)
+	o.Slots = append(o.Slots, v)
+}
+
+// FieldNames returns the interned names of the instance's fields in the
+// order they were added. The slice must not be modified.
+func (o *InstanceObject) FieldNames() []int {
+
+	return o.Shape.Names()
+}
+
 func (InstanceObject) IsObject() {}
 
 func (InstanceObject) GetType() ObjectType {
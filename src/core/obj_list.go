@@ -44,6 +44,9 @@ func init() {
 				}
 				o := vm.Stack(arg_stackptr - 1).AsList()
 				val := vm.Peek(0)
+				if !vm.Charge(ValueSize) {
+					return NIL_VALUE
+				}
 				o.Append(val)
 				return NIL_VALUE
 			},
@@ -56,7 +59,7 @@ func init() {
 				}
 				o := vm.Stack(arg_stackptr - 1).AsList()
 				val := vm.Peek(0)
-				idx := int(val.Data)
+				idx := int(val.Data())
 				o.Remove(idx)
 				return NIL_VALUE
 			},
@@ -266,7 +269,7 @@ func (o *ListObject) AssignToSlice(from_ix, to_ix int, val Value) error {
 		return errors.New("invalid slice indices")
 	}
 
-	if val.Type == VAL_OBJ {
+	if val.IsObj() {
 
 		if val.IsListObject() {
 			lv := val.AsList()
@@ -48,7 +48,11 @@ func init() {
 				s := vm.Stack(arg_stackptr - 1).AsString()
 				fromVal := vm.Peek(1)
 				toVal := vm.Peek(0)
-				return s.Replace(fromVal, toVal)
+				rv := s.Replace(fromVal, toVal)
+				if rv.IsStringObject() && !vm.Charge(StringSize+len(rv.AsString().Get())) {
+					return NIL_VALUE
+				}
+				return rv
 			},
 		},
 		JOIN: {
@@ -65,6 +69,9 @@ func init() {
 					vm.RunTimeError("%v", err)
 					return NIL_VALUE
 				}
+				if !vm.Charge(StringSize + len(v.AsString().Get())) {
+					return NIL_VALUE
+				}
 				return v
 			},
 		},
@@ -1,6 +1,9 @@
 package core
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 type ObjectType uint8
 type NativeType int
@@ -42,6 +45,9 @@ const (
 	NATIVE_THREAD
 	NATIVE_THREAD_CHANNEL
 	NATIVE_MUTEX
+	NATIVE_FIBER
+	NATIVE_FUTURE
+	NATIVE_CHANNEL
 )
 
 type Object interface {
@@ -63,6 +69,29 @@ type Iterator interface {
 type HasMethods interface {
 	GetMethod(int) *BuiltInObject
 }
+
+// MethodNames returns the sorted names of the native methods every string,
+// list or dict has, or nil for any other type. Tools that offer completions
+// use it, since the method tables themselves are keyed by interned id.
+func MethodNames(t ObjectType) []string {
+
+	var table map[int]*BuiltInObject
+	switch t {
+	case OBJECT_STRING:
+		table = stringMethods
+	case OBJECT_LIST:
+		table = listMethods
+	case OBJECT_DICT:
+		table = dictMethods
+	}
+	var names []string
+	for id := range table {
+		names = append(names, NameFromID(id))
+	}
+	sort.Strings(names)
+	return names
+}
+
 type HasConstants interface {
 	GetConstant(int) Value
 }
@@ -86,6 +115,27 @@ type VMContext interface {
 	GetGlobals() *Environment
 	FileName() string
 	ResolveClass(name string) (*ClassObject, bool)
+	// ResolveFile maps the placeholder sys.stdin, sys.stdout or sys.stderr
+	// starts out as to this VM's own stream, and returns other files as
+	// they are. StdFile returns the file sys.stdout etc. currently name,
+	// resolved.
+	ResolveFile(f *FileObject) *FileObject
+	StdFile(std StdStream) *FileObject
+	// FileSystem is what the os module opens, lists and removes files
+	// through: the host's, or a sandbox's.
+	FileSystem() FileSystem
+	// Charge records an allocation of about bytes against the VM's memory
+	// limit, if it has one. Over the limit, it raises MemoryError instead
+	// and returns false, and the allocation should not be made.
+	Charge(bytes int) bool
+	// MemoryUsage returns about how many bytes of strings, lists, dicts and
+	// float arrays the script can still reach.
+	MemoryUsage() int
+	// ReloadModule runs module's source again and swaps the functions and
+	// classes it defines into place, as sys.reload does. If it can't, it
+	// raises ImportError, or the exception the module raised, and returns
+	// false.
+	ReloadModule(module *ModuleObject) bool
 
 	// SpawnThread runs closure (with args) on a new goroutine-backed VM
 	// instance, deep-copying closure/args first (see CopyValueForSpawn) so
@@ -99,6 +149,45 @@ type VMContext interface {
 	// new VM, no copy, no goroutine) and returns its result -- used by
 	// thread.spawn's worker body and by sync.Mutex.locked().
 	CallClosure(closure Value, args []Value) (Value, error)
+
+	// SpawnFiber schedules callee(args...) to start as a fiber at the next
+	// TickFibers.
+	SpawnFiber(callee Value, args []Value) (*Fiber, error)
+	// SuspendFiber suspends the running fiber until its scheduler's clock
+	// has advanced by seconds, or until the next tick if seconds is 0. It
+	// unwinds the fiber's frames, so it must be the last thing the
+	// built-in calling it -- with argCount arguments -- does. Outside a
+	// fiber it raises FiberError and returns false.
+	SuspendFiber(seconds float64, argCount int) bool
+	// TickFibers advances the scheduler's clock by dt seconds and runs each
+	// fiber that is due until it suspends or ends. It returns how many
+	// fibers are left, or raises the exception a fiber ended with and
+	// returns false.
+	TickFibers(dt float64) (int, bool)
+	// RunFibers ticks the scheduler in real time until no fibers are left,
+	// sleeping while they all are.
+	RunFibers() bool
+
+	// RunTimeErrorInstance is like RunTimeError but raises exc itself.
+	RunTimeErrorInstance(exc *InstanceObject)
+	// RunAsync runs the event loop until f is done, and returns its result.
+	// If f fails, or the loop can't go on, it raises the exception and
+	// returns false.
+	RunAsync(f *Future) (Value, bool)
+	// SleepAsync returns a future the event loop resolves with nil once
+	// seconds have passed.
+	SleepAsync(seconds float64) *Future
+	// GoAsync runs work on a goroutine and returns a future resolved with
+	// what it returns, or rejected with the error it returns (see
+	// AsyncError), once the event loop sees it has finished. cancel is
+	// closed if the future is cancelled first; work should then give up.
+	GoAsync(work func(cancel <-chan struct{}) (Value, error)) *Future
+	// GatherAsync returns a future resolved with the list of the results of
+	// fs once all are done, or rejected as the first of them to fail is.
+	GatherAsync(fs []*Future) *Future
+	// WaitForAsync returns a future settled as f is, or rejected with
+	// TimeoutError if seconds pass first, which cancels f.
+	WaitForAsync(f *Future, seconds float64) *Future
 }
 
 type BuiltInFn func(argCount int, args_stackptr int, vm VMContext) Value
@@ -46,13 +46,13 @@ func EncodeValue(v Value) ([]byte, error) {
 }
 
 func encodeValue(buf *bytes.Buffer, v Value, visiting map[Object]bool) error {
-	switch v.Type {
+	switch v.Type() {
 	case VAL_NIL:
 		buf.WriteByte(pickleTagNil)
 		return nil
 	case VAL_BOOL:
 		buf.WriteByte(pickleTagBool)
-		if v.Data != 0 {
+		if v.Data() != 0 {
 			buf.WriteByte(1)
 		} else {
 			buf.WriteByte(0)
@@ -90,12 +90,12 @@ func encodeValue(buf *bytes.Buffer, v Value, visiting map[Object]bool) error {
 	case VAL_OBJ:
 		return encodeObjectValue(buf, v, visiting)
 	default:
-		return fmt.Errorf("cannot pickle value of type %d", v.Type)
+		return fmt.Errorf("cannot pickle value of type %d", v.Type())
 	}
 }
 
 func encodeObjectValue(buf *bytes.Buffer, v Value, visiting map[Object]bool) error {
-	switch v.Obj.GetType() {
+	switch v.Obj().GetType() {
 	case OBJECT_STRING:
 		buf.WriteByte(pickleTagString)
 		s := v.AsString().Get()
@@ -154,8 +154,9 @@ func encodeObjectValue(buf *bytes.Buffer, v Value, visiting map[Object]bool) err
 		className := inst.Class.Name.Get()
 		bin.Write(buf, bin.LittleEndian, uint32(len(className)))
 		buf.WriteString(className)
-		bin.Write(buf, bin.LittleEndian, uint32(len(inst.Fields)))
-		for k, val := range inst.Fields {
+		bin.Write(buf, bin.LittleEndian, uint32(len(inst.Slots)))
+		for slot, k := range inst.FieldNames() {
+			val := inst.Slots[slot]
 			name := NameFromID(k)
 			bin.Write(buf, bin.LittleEndian, uint32(len(name)))
 			buf.WriteString(name)
@@ -165,7 +166,7 @@ func encodeObjectValue(buf *bytes.Buffer, v Value, visiting map[Object]bool) err
 		}
 		return nil
 	default:
-		return fmt.Errorf("cannot pickle value of type %s", objectTypeName(v.Obj.GetType()))
+		return fmt.Errorf("cannot pickle value of type %s", objectTypeName(v.Obj().GetType()))
 	}
 }
 
@@ -403,7 +404,8 @@ func decodeValue(r *pickleReader, resolve ClassResolver) (Value, error) {
 		if err != nil {
 			return NIL_VALUE, err
 		}
-		fields := make(map[int]Value, count)
+		names := make([]int, 0, count)
+		values := make([]Value, 0, count)
 		for i := uint32(0); i < count; i++ {
 			name, err := r.readString()
 			if err != nil {
@@ -413,7 +415,8 @@ func decodeValue(r *pickleReader, resolve ClassResolver) (Value, error) {
 			if err != nil {
 				return NIL_VALUE, err
 			}
-			fields[InternName(name)] = val
+			names = append(names, InternName(name))
+			values = append(values, val)
 		}
 		// Fields must be fully consumed above before any of these error
 		// returns, so the reader cursor lands correctly for whatever comes
@@ -426,7 +429,9 @@ func decodeValue(r *pickleReader, resolve ClassResolver) (Value, error) {
 			return NIL_VALUE, fmt.Errorf("cannot unpickle instance of unknown class %q", className)
 		}
 		inst := MakeInstanceObject(class)
-		inst.Fields = fields
+		for i, name := range names {
+			inst.SetField(name, values[i])
+		}
 		return MakeObjectValue(inst, false), nil
 	default:
 		return NIL_VALUE, fmt.Errorf("unknown pickle tag %d", tag)
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MaxShapeFields is how many fields an instance can have while sharing a
+// shape with others. Adding one more puts the instance in dictionary mode.
+const MaxShapeFields = 32
+
+// A Shape is the layout of an instance's fields: which field is in which
+// slot of InstanceObject.Slots. Instances of a class start with the class's
+// root shape, and adding a field moves an instance to the shape that
+// follows its current one for that name, so instances given the same fields
+// in the same order share one shape and an inline cache keyed on a shape
+// can remember a field's slot.
+//
+// The shapes of a class form a tree. A shared shape never changes once
+// made, except to gain transitions; those are copied on write and published
+// atomically, since the VMs of the thread module share classes and so
+// shapes. An instance given more than MaxShapeFields fields instead gets a
+// dictionary shape of its own, which later fields are added to in place,
+// so objects used as open-ended maps do not grow the tree without bound.
+type Shape struct {
+	names      []int       // slot → interned field name
+	index      map[int]int // name → slot, for shapes too big to scan
+	dictionary bool        // private to one instance and grown in place
+
+	transitions atomic.Pointer[map[int]*Shape] // name added → next shape
+	mu          sync.Mutex                     // serialises adding transitions
+}
+
+// shapeScanLimit is the size up to which Slot scans names rather than
+// using index.
+const shapeScanLimit = 8
+
+// NewRootShape makes the empty shape a class's instances start with.
+func NewRootShape() *Shape {
+
+	return &Shape{}
+}
+
+// Len returns the number of fields in the shape.
+func (s *Shape) Len() int {
+
+	return len(s.names)
+}
+
+// Names returns the interned names of the shape's fields in slot order.
+// The slice must not be modified.
+func (s *Shape) Names() []int {
+
+	return s.names
+}
+
+// IsDictionary reports whether the shape belongs to a single instance in
+// dictionary mode. Inline caches do not remember such shapes, since they
+// change in place.
+func (s *Shape) IsDictionary() bool {
+
+	return s.dictionary
+}
+
+// Slot returns the slot of the field named name, or -1.
+func (s *Shape) Slot(name int) int {
+
+	if s.index != nil {
+		if slot, ok := s.index[name]; ok {
+			return slot
+		}
+		return -1
+	}
+	for slot, n := range s.names {
+		if n == name {
+			return slot
+		}
+	}
+	return -1
+}
+
+// With returns the shape an instance of shape s has once it gains the
+// field name, which goes in slot s.Len(). A dictionary shape is extended
+// and returned itself.
+func (s *Shape) With(name int) *Shape {
+
+	if s.dictionary {
+		s.add(name)
+		return s
+	}
+	if next, ok := s.transition(name); ok {
+		return next
+	}
+	if len(s.names) >= MaxShapeFields {
+		dict := &Shape{names: append([]int(nil), s.names...), dictionary: true}
+		dict.buildIndex()
+		dict.add(name)
+		return dict
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next, ok := s.transition(name); ok {
+		return next
+	}
+	next := &Shape{names: append(append(make([]int, 0, len(s.names)+1), s.names...), name)}
+	next.buildIndex()
+	transitions := make(map[int]*Shape)
+	if old := s.transitions.Load(); old != nil {
+		for k, v := range *old {
+			transitions[k] = v
+		}
+	}
+	transitions[name] = next
+	s.transitions.Store(&transitions)
+	return next
+}
+
+func (s *Shape) transition(name int) (*Shape, bool) {
+
+	transitions := s.transitions.Load()
+	if transitions == nil {
+		return nil, false
+	}
+	next, ok := (*transitions)[name]
+	return next, ok
+}
+
+func (s *Shape) add(name int) {
+
+	s.names = append(s.names, name)
+	if s.index != nil {
+		s.index[name] = len(s.names) - 1
+	} else if len(s.names) > shapeScanLimit {
+		s.buildIndex()
+	}
+}
+
+func (s *Shape) buildIndex() {
+
+	if len(s.names) <= shapeScanLimit {
+		return
+	}
+	s.index = make(map[int]int, len(s.names))
+	for slot, name := range s.names {
+		s.index[name] = slot
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShapesAreShared(t *testing.T) {
+	class := MakeClassObject("Point")
+	x, y := InternName("x"), InternName("y")
+
+	a, b, c := MakeInstanceObject(class), MakeInstanceObject(class), MakeInstanceObject(class)
+	a.SetField(x, MakeIntValue(1, false))
+	a.SetField(y, MakeIntValue(2, false))
+	b.SetField(x, MakeIntValue(3, false))
+	b.SetField(y, MakeIntValue(4, false))
+	c.SetField(y, MakeIntValue(5, false))
+	c.SetField(x, MakeIntValue(6, false))
+
+	if a.Shape != b.Shape {
+		t.Error("instances given the same fields in the same order have different shapes")
+	}
+	if a.Shape == c.Shape {
+		t.Error("instances given fields in a different order share a shape")
+	}
+	if a.Shape.Slot(y) != 1 || c.Shape.Slot(y) != 0 {
+		t.Errorf("y in slots %d and %d", a.Shape.Slot(y), c.Shape.Slot(y))
+	}
+	if v, ok := b.GetField(y); !ok || v.AsInt() != 4 {
+		t.Errorf("b.y = %v, %v", v, ok)
+	}
+	if _, ok := b.GetField(InternName("z")); ok {
+		t.Error("found a field that was never set")
+	}
+
+	b.SetField(x, MakeIntValue(7, false))
+	if v, _ := b.GetField(x); v.AsInt() != 7 || b.Shape != a.Shape {
+		t.Errorf("assigning an existing field: b.x = %v, shape changed %v", v, b.Shape != a.Shape)
+	}
+}
+
+func TestDictionaryMode(t *testing.T) {
+	class := MakeClassObject("Bag")
+	inst := MakeInstanceObject(class)
+	names := make([]int, MaxShapeFields+10)
+	for i := range names {
+		names[i] = InternName(fmt.Sprintf("f%d", i))
+		inst.SetField(names[i], MakeIntValue(i, false))
+		if dict := inst.Shape.IsDictionary(); dict != (i >= MaxShapeFields) {
+			t.Fatalf("after %d fields, dictionary mode is %v", i+1, dict)
+		}
+	}
+	for i, name := range names {
+		if v, ok := inst.GetField(name); !ok || v.AsInt() != i {
+			t.Errorf("f%d = %v, %v", i, v, ok)
+		}
+	}
+	for i, name := range inst.FieldNames() {
+		if name != names[i] {
+			t.Fatalf("field %d is %s", i, NameFromID(name))
+		}
+	}
+
+	// Another instance with the same fields gets its own dictionary shape.
+	other := MakeInstanceObject(class)
+	for _, name := range names {
+		other.SetField(name, NIL_VALUE)
+	}
+	if other.Shape == inst.Shape {
+		t.Error("two instances share a dictionary shape")
+	}
+}
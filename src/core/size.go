@@ -0,0 +1,141 @@
+package core
+
+// size.go measures how much of the heap a VM's values hold, for the memory
+// limit (see VMContext.Charge). It is a walk in the manner of copy.go's,
+// with a seen set where copy.go has its memo, so shared and cyclic
+// structures are counted once. Sizes are approximate: they are what the
+// VM charges when it allocates, not what Go's allocator spends.
+//
+// Only what is charged is counted -- strings, lists, tuples, dicts and
+// Sized objects such as float arrays -- but the walk goes through
+// instances, closures, bound methods, modules and classes to reach them. A
+// class's variables are read under its lock, as a thread it is shared with
+// (see copy.go) may be setting them; its methods are fixed once it is
+// defined.
+
+// Approximate sizes allocations are charged at, besides ValueSize for each
+// slot.
+const (
+	ListSize      = 40 // a list or tuple before its items
+	DictSize      = 48 // a dict before its entries
+	DictEntrySize = 40 // a key and its value, with the map's overhead
+	StringSize    = 32 // a string before its bytes
+)
+
+// Sized is implemented by objects defined outside this package that hold
+// memory worth counting, such as float arrays.
+type Sized interface {
+	HeapSize() int
+}
+
+// HeapMeter adds up the size of the values it is shown, and of what they
+// reach, counting each object once.
+type HeapMeter struct {
+	Bytes   int
+	seen    map[Object]bool
+	strings map[*string]bool
+	envs    map[*Environment]bool
+	classes map[*ClassObject]bool
+}
+
+func NewHeapMeter() *HeapMeter {
+	return &HeapMeter{seen: map[Object]bool{}, strings: map[*string]bool{}, envs: map[*Environment]bool{}, classes: map[*ClassObject]bool{}}
+}
+
+// Value counts v and what it reaches.
+func (m *HeapMeter) Value(v Value) {
+
+	if v.Type() != VAL_OBJ {
+		return
+	}
+	if v.ObjType() == OBJECT_STRING {
+		s := v.AsString()
+		if !m.strings[s.Chars] {
+			m.strings[s.Chars] = true
+			m.Bytes += StringSize + len(*s.Chars)
+		}
+		return
+	}
+	obj := v.Obj()
+	if closure, ok := obj.(*ClosureObject); ok {
+		m.Closure(closure)
+		return
+	}
+	if m.seen[obj] {
+		return
+	}
+	m.seen[obj] = true
+
+	switch o := obj.(type) {
+	case *ListObject:
+		m.Bytes += ListSize + ValueSize*len(o.Items)
+		for _, item := range o.Items {
+			m.Value(item)
+		}
+	case *DictObject:
+		m.Bytes += DictSize + DictEntrySize*len(o.Items)
+		for _, item := range o.Items {
+			m.Value(item)
+		}
+	case *InstanceObject:
+		m.Class(o.Class)
+		for _, slot := range o.Slots {
+			m.Value(slot)
+		}
+	case *ClassObject:
+		m.Class(o)
+	case *BoundMethodObject:
+		m.Value(o.Receiver)
+		m.Closure(o.Method)
+	case *ModuleObject:
+		m.Environment(o.Environment)
+	case Sized:
+		m.Bytes += o.HeapSize()
+	}
+}
+
+// Class counts what class, and the classes it inherits from, hold in their
+// class variables and reach through their methods.
+func (m *HeapMeter) Class(class *ClassObject) {
+
+	for ; class != nil; class = class.Super {
+		if m.classes[class] {
+			return
+		}
+		m.classes[class] = true
+		for _, v := range class.StaticsSnapshot() {
+			m.Value(v)
+		}
+		for _, methods := range []map[int]Value{class.Methods, class.StaticMethods} {
+			for _, method := range methods {
+				m.Value(method)
+			}
+		}
+	}
+}
+
+// Closure counts what closure's upvalues hold.
+func (m *HeapMeter) Closure(closure *ClosureObject) {
+
+	if closure == nil || m.seen[closure] {
+		return
+	}
+	m.seen[closure] = true
+	for _, uv := range closure.Upvalues {
+		if uv != nil {
+			m.Value(*uv.Location)
+		}
+	}
+}
+
+// Environment counts the values of env's globals.
+func (m *HeapMeter) Environment(env *Environment) {
+
+	if env == nil || m.envs[env] {
+		return
+	}
+	m.envs[env] = true
+	for _, v := range env.Globals {
+		m.Value(v)
+	}
+}
@@ -0,0 +1,619 @@
+package core
+
+import (
+	"bytes"
+	bin "encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// snapshot.go implements images: copies of the globals of a set of
+// environments -- a script's and its modules' -- and of the heap reachable
+// from them, which the VM's Snapshot and Restore are built on.
+//
+// In memory, an image is made with copy.go's walk: one memo is shared by
+// every environment, so a structure reachable from several globals is
+// copied once, and cycles come out as cycles. Compiled code, classes,
+// modules and built-ins are shared by pointer, as copy.go shares them, but
+// the statics of the classes reached are copied too. Restoring copies the
+// image again, so it can be restored any number of times, and writes into
+// the environments and classes in place: the functions compiled against
+// them go on seeing their globals.
+//
+// On disk, an image extends pickle.go's format. Plain values use pickle's
+// tags. Objects that may be shared or cyclic are numbered in the order they
+// are written, and written again as a back reference to that number. What
+// the image doesn't hold -- compiled functions, classes, modules and
+// built-ins -- is written as a name a Linker gives it, and found again by
+// that name when the image is read, so the script and modules must have
+// been loaded before then.
+
+// Tags only images use, after pickle's own.
+const (
+	pickleTagBackRef     byte = iota + pickleTagInstance + 1 // an object written before, by number
+	pickleTagLinked                                          // something a Linker names
+	pickleTagObject                                          // an instance, its class named by a Linker
+	pickleTagClosure                                         // a closure, its function named by a Linker
+	pickleTagUpvalue                                         // a variable captured by closures
+	pickleTagBoundMethod                                     // a method bound to its receiver
+)
+
+var imageMagic = []byte("glox-image\x01")
+
+// Linker names what an image refers to rather than holds, and finds it
+// again when the image is read.
+type Linker interface {
+	// LinkName returns the name of a function, class, module or built-in.
+	LinkName(o Object) (string, bool)
+	// LinkObject returns what LinkName called name.
+	LinkObject(name string) (Object, bool)
+	// LinkEnvironment returns the environment of the script or module
+	// called name.
+	LinkEnvironment(name string) (*Environment, bool)
+}
+
+// Image is a copy of the globals of some environments and of what they
+// reach.
+type Image struct {
+	envs    []envImage
+	statics map[*ClassObject]map[int]Value
+}
+
+type envImage struct {
+	env     *Environment
+	globals []Value
+	defined []bool
+	vars    map[int]Value
+}
+
+// CaptureImage copies the globals of envs, and what they reach.
+func CaptureImage(envs []*Environment) *Image {
+
+	img := &Image{}
+	memo := map[Object]Object{}
+	for _, env := range envs {
+		globals := make([]Value, len(env.Globals))
+		for slot, v := range env.Globals {
+			globals[slot] = CopyValueForSpawn(v, memo)
+		}
+		vars := env.VarsSnapshot()
+		for id, v := range vars {
+			vars[id] = CopyValueForSpawn(v, memo)
+		}
+		img.envs = append(img.envs, envImage{env: env, globals: globals, defined: slices.Clone(env.Defined), vars: vars})
+	}
+	img.statics = copyStatics(memo)
+	return img
+}
+
+// copyStatics copies the statics of each class a copy has reached (see
+// copy.go), and of the classes those reach in turn.
+func copyStatics(memo map[Object]Object) map[*ClassObject]map[int]Value {
+
+	statics := map[*ClassObject]map[int]Value{}
+	for {
+		var found []*ClassObject
+		for o := range memo {
+			var class *ClassObject
+			switch o := o.(type) {
+			case *ClassObject:
+				class = o
+			case *InstanceObject:
+				class = o.Class
+			}
+			for ; class != nil; class = class.Super {
+				if _, ok := statics[class]; !ok && !slices.Contains(found, class) {
+					found = append(found, class)
+				}
+			}
+		}
+		if len(found) == 0 {
+			return statics
+		}
+		for _, class := range found {
+			current := class.StaticsSnapshot()
+			copied := make(map[int]Value, len(current))
+			for id, v := range current {
+				copied[id] = CopyValueForSpawn(v, memo)
+			}
+			statics[class] = copied
+		}
+	}
+}
+
+// Restore puts the globals and class statics the image holds back in place,
+// as copies of its own, so it can be restored again.
+func (img *Image) Restore() {
+
+	memo := map[Object]Object{}
+	for _, e := range img.envs {
+		globals := make([]Value, max(len(e.globals), len(e.env.Globals)))
+		defined := make([]bool, len(globals))
+		for slot, v := range e.globals {
+			globals[slot] = CopyValueForSpawn(v, memo)
+		}
+		copy(defined, e.defined)
+		vars := make(map[int]Value, len(e.vars))
+		for id, v := range e.vars {
+			vars[id] = CopyValueForSpawn(v, memo)
+		}
+		e.env.Globals, e.env.Defined = globals, defined
+		e.env.varsMu.Lock()
+		e.env.Vars = vars
+		e.env.varsMu.Unlock()
+	}
+	for class, statics := range img.statics {
+		copied := make(map[int]Value, len(statics))
+		for id, v := range statics {
+			copied[id] = CopyValueForSpawn(v, memo)
+		}
+		class.SetStatics(copied)
+	}
+	ClassesChanged()
+}
+
+//------------------------------------------------------------------------------------------
+
+// Encode serialises the image, naming what it doesn't hold with link. It
+// returns an error for a value it can't write, such as a file or an
+// instance of a class link can't name.
+func (img *Image) Encode(link Linker) ([]byte, error) {
+
+	w := &imageWriter{link: link, ids: map[Object]uint32{}}
+	w.buf.Write(imageMagic)
+	w.uint32(len(img.envs))
+	for _, e := range img.envs {
+		w.string(e.env.Name)
+		var slots []int
+		for slot := range e.globals {
+			if slot < len(e.defined) && e.defined[slot] && slot < len(e.env.GlobalNames) {
+				slots = append(slots, slot)
+			}
+		}
+		w.uint32(len(slots))
+		for _, slot := range slots {
+			w.string(e.env.GlobalNames[slot])
+			if err := w.value(e.globals[slot]); err != nil {
+				return nil, fmt.Errorf("global '%s' of %s: %w", e.env.GlobalNames[slot], e.env.Name, err)
+			}
+		}
+		if err := w.named(e.vars); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.env.Name, err)
+		}
+	}
+	classes := map[string]*ClassObject{}
+	for class, statics := range img.statics {
+		if len(statics) == 0 {
+			continue
+		}
+		name, ok := link.LinkName(class)
+		if !ok {
+			return nil, fmt.Errorf("class %s is not a global", class.Name.Get())
+		}
+		classes[name] = class
+	}
+	w.uint32(len(classes))
+	for _, name := range slices.Sorted(maps.Keys(classes)) {
+		w.string(name)
+		if err := w.named(img.statics[classes[name]]); err != nil {
+			return nil, fmt.Errorf("class %s: %w", classes[name].Name.Get(), err)
+		}
+	}
+	return w.buf.Bytes(), nil
+}
+
+type imageWriter struct {
+	buf  bytes.Buffer
+	link Linker
+	ids  map[Object]uint32 // the objects written so far, by number
+}
+
+func (w *imageWriter) uint32(n int) {
+	bin.Write(&w.buf, bin.LittleEndian, uint32(n))
+}
+
+func (w *imageWriter) string(s string) {
+	w.uint32(len(s))
+	w.buf.WriteString(s)
+}
+
+// remember numbers obj, reporting false, having written a back reference,
+// if it already has a number.
+func (w *imageWriter) remember(obj Object) bool {
+	if id, ok := w.ids[obj]; ok {
+		w.buf.WriteByte(pickleTagBackRef)
+		w.uint32(int(id))
+		return false
+	}
+	w.ids[obj] = uint32(len(w.ids))
+	return true
+}
+
+// named writes values keyed by interned name, in name order.
+func (w *imageWriter) named(values map[int]Value) error {
+	names := make([]string, 0, len(values))
+	for id := range values {
+		names = append(names, NameFromID(id))
+	}
+	slices.Sort(names)
+	w.uint32(len(names))
+	for _, name := range names {
+		w.string(name)
+		if err := w.value(values[InternName(name)]); err != nil {
+			return fmt.Errorf("'%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (w *imageWriter) value(v Value) error {
+
+	if v.Type() != VAL_OBJ || v.ObjType() == OBJECT_STRING {
+		return encodeValue(&w.buf, v, nil)
+	}
+	obj := v.Obj()
+	if name, ok := w.link.LinkName(obj); ok {
+		w.buf.WriteByte(pickleTagLinked)
+		w.string(name)
+		return nil
+	}
+	switch o := obj.(type) {
+	case *ListObject:
+		if !w.remember(o) {
+			return nil
+		}
+		w.buf.WriteByte(pickleTagList)
+		tupleFlag := byte(0)
+		if o.Tuple {
+			tupleFlag = 1
+		}
+		w.buf.WriteByte(tupleFlag)
+		w.uint32(len(o.Items))
+		for _, item := range o.Items {
+			if err := w.value(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *DictObject:
+		if !w.remember(o) {
+			return nil
+		}
+		w.buf.WriteByte(pickleTagDict)
+		return w.named(o.Items)
+	case *InstanceObject:
+		className, ok := w.link.LinkName(o.Class)
+		if !ok {
+			return fmt.Errorf("cannot snapshot an instance of %s, which is not a global class", o.Class.Name.Get())
+		}
+		if !w.remember(o) {
+			return nil
+		}
+		w.buf.WriteByte(pickleTagObject)
+		w.string(className)
+		names := o.FieldNames()
+		w.uint32(len(names))
+		for slot, k := range names {
+			w.string(NameFromID(k))
+			if err := w.value(o.Slots[slot]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ClosureObject:
+		fnName, ok := w.link.LinkName(o.Function)
+		if !ok {
+			return fmt.Errorf("cannot snapshot function %s, which is not part of a loaded script or module", o.Function.Name.Get())
+		}
+		if !w.remember(o) {
+			return nil
+		}
+		w.buf.WriteByte(pickleTagClosure)
+		w.string(fnName)
+		w.uint32(len(o.Upvalues))
+		for _, uv := range o.Upvalues {
+			if err := w.upvalue(uv); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *BoundMethodObject:
+		if !w.remember(o) {
+			return nil
+		}
+		w.buf.WriteByte(pickleTagBoundMethod)
+		if err := w.value(o.Receiver); err != nil {
+			return err
+		}
+		return w.value(MakeObjectValue(o.Method, false))
+	default:
+		return fmt.Errorf("cannot snapshot value of type %s", objectTypeName(obj.GetType()))
+	}
+}
+
+func (w *imageWriter) upvalue(uv *UpvalueObject) error {
+	if uv == nil {
+		w.buf.WriteByte(pickleTagNil)
+		return nil
+	}
+	if !w.remember(uv) {
+		return nil
+	}
+	w.buf.WriteByte(pickleTagUpvalue)
+	return w.value(*uv.Location)
+}
+
+//------------------------------------------------------------------------------------------
+
+// DecodeImage reads an image written by Encode, finding the environments,
+// functions and classes it names with link. It returns an error rather than
+// panicking on malformed data, or on a name link doesn't know -- a script
+// or module changed since, or not loaded.
+func DecodeImage(data []byte, link Linker) (*Image, error) {
+
+	if !bytes.HasPrefix(data, imageMagic) {
+		return nil, errors.New("not a glox image")
+	}
+	r := &imageReader{pickleReader: &pickleReader{data: data, pos: len(imageMagic)}, link: link}
+	img := &Image{statics: map[*ClassObject]map[int]Value{}}
+	envCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	for range envCount {
+		name, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		env, ok := link.LinkEnvironment(name)
+		if !ok {
+			return nil, fmt.Errorf("the image needs %s, which is not loaded", name)
+		}
+		e := envImage{env: env, globals: make([]Value, len(env.Globals)), defined: make([]bool, len(env.Globals))}
+		count, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		for range count {
+			global, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			slot := env.SlotForName(global)
+			if slot < 0 || slot >= len(e.globals) {
+				return nil, fmt.Errorf("%s has no global '%s'", name, global)
+			}
+			e.globals[slot], e.defined[slot] = v, true
+		}
+		if e.vars, err = r.named(); err != nil {
+			return nil, err
+		}
+		img.envs = append(img.envs, e)
+	}
+	classCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	for range classCount {
+		name, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		class, ok := link.LinkObject(name)
+		if _, isClass := class.(*ClassObject); !ok || !isClass {
+			return nil, fmt.Errorf("unknown class %s", name)
+		}
+		if img.statics[class.(*ClassObject)], err = r.named(); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+type imageReader struct {
+	*pickleReader
+	link    Linker
+	objects []Object // the objects read so far, by number
+}
+
+func (r *imageReader) named() (map[int]Value, error) {
+	count, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[int]Value, min(int(count), len(r.data)-r.pos))
+	for range count {
+		name, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		if values[InternName(name)], err = r.value(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (r *imageReader) backRef() (Object, error) {
+	id, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(id) >= len(r.objects) {
+		return nil, fmt.Errorf("bad back reference %d", id)
+	}
+	return r.objects[id], nil
+}
+
+func (r *imageReader) value() (Value, error) {
+
+	if r.pos >= len(r.data) {
+		return NIL_VALUE, errTruncated
+	}
+	switch tag := r.data[r.pos]; tag {
+	case pickleTagBackRef:
+		r.pos++
+		obj, err := r.backRef()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		if _, ok := obj.(*UpvalueObject); ok {
+			return NIL_VALUE, errors.New("back reference to a captured variable where a value belongs")
+		}
+		return MakeObjectValue(obj, false), nil
+	case pickleTagLinked:
+		r.pos++
+		name, err := r.readString()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		obj, ok := r.link.LinkObject(name)
+		if !ok {
+			return NIL_VALUE, fmt.Errorf("unknown %s", name)
+		}
+		return MakeObjectValue(obj, false), nil
+	case pickleTagList:
+		r.pos++
+		tupleFlag, err := r.readByte()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		count, err := r.readUint32()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		list := MakeListObject(make([]Value, 0, min(int(count), len(r.data)-r.pos)), tupleFlag != 0)
+		r.objects = append(r.objects, list)
+		for range count {
+			item, err := r.value()
+			if err != nil {
+				return NIL_VALUE, err
+			}
+			list.Items = append(list.Items, item)
+		}
+		return MakeObjectValue(list, false), nil
+	case pickleTagDict:
+		r.pos++
+		dict := MakeEmptyDictObject()
+		r.objects = append(r.objects, dict)
+		items, err := r.named()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		dict.Items = items
+		return MakeObjectValue(dict, false), nil
+	case pickleTagObject:
+		r.pos++
+		className, err := r.readString()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		class, ok := r.link.LinkObject(className)
+		if _, isClass := class.(*ClassObject); !ok || !isClass {
+			return NIL_VALUE, fmt.Errorf("unknown class %s", className)
+		}
+		inst := MakeInstanceObject(class.(*ClassObject))
+		r.objects = append(r.objects, inst)
+		count, err := r.readUint32()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		for range count {
+			name, err := r.readString()
+			if err != nil {
+				return NIL_VALUE, err
+			}
+			v, err := r.value()
+			if err != nil {
+				return NIL_VALUE, err
+			}
+			inst.SetField(InternName(name), v)
+		}
+		return MakeObjectValue(inst, false), nil
+	case pickleTagClosure:
+		r.pos++
+		fnName, err := r.readString()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		fn, ok := r.link.LinkObject(fnName)
+		if _, isFn := fn.(*FunctionObject); !ok || !isFn {
+			return NIL_VALUE, fmt.Errorf("unknown %s", fnName)
+		}
+		count, err := r.readUint32()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		function := fn.(*FunctionObject)
+		if int(count) != function.UpvalueCount {
+			return NIL_VALUE, fmt.Errorf("%s captures %d variables, not %d", fnName, function.UpvalueCount, count)
+		}
+		closure := MakeClosureObject(function)
+		r.objects = append(r.objects, closure)
+		for i := range closure.Upvalues {
+			if closure.Upvalues[i], err = r.upvalue(); err != nil {
+				return NIL_VALUE, err
+			}
+		}
+		return MakeObjectValue(closure, false), nil
+	case pickleTagBoundMethod:
+		r.pos++
+		bm := &BoundMethodObject{}
+		r.objects = append(r.objects, bm)
+		receiver, err := r.value()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		method, err := r.value()
+		if err != nil {
+			return NIL_VALUE, err
+		}
+		if !method.IsObj() || method.ObjType() != OBJECT_CLOSURE {
+			return NIL_VALUE, errors.New("bound method without a method")
+		}
+		bm.Receiver, bm.Method = receiver, method.AsClosure()
+		return MakeObjectValue(bm, false), nil
+	case pickleTagInstance:
+		return NIL_VALUE, errors.New("unexpected pickled instance in an image")
+	default:
+		return decodeValue(r.pickleReader, nil)
+	}
+}
+
+func (r *imageReader) upvalue() (*UpvalueObject, error) {
+
+	tag, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case pickleTagNil:
+		return nil, nil
+	case pickleTagBackRef:
+		obj, err := r.backRef()
+		if err != nil {
+			return nil, err
+		}
+		uv, ok := obj.(*UpvalueObject)
+		if !ok {
+			return nil, errors.New("back reference to a value where a captured variable belongs")
+		}
+		return uv, nil
+	case pickleTagUpvalue:
+		uv := &UpvalueObject{}
+		uv.Location = &uv.Closed
+		r.objects = append(r.objects, uv)
+		if uv.Closed, err = r.value(); err != nil {
+			return nil, err
+		}
+		return uv, nil
+	default:
+		return nil, fmt.Errorf("unexpected tag %d for a captured variable", tag)
+	}
+}
@@ -1,5 +1,7 @@
 package core
 
+import "sync/atomic"
+
 type Chunk struct {
 	Code        []uint8
 	Constants   []Value
@@ -8,6 +10,8 @@ type Chunk struct {
 	LocalVars   []LocalVarInfo // for debugging purposes
 	GlobalCount int            // number of global slots needed by the top-level script
 	GlobalNames []string       // slot → name, for error messages and built-in pre-population
+
+	caches atomic.Pointer[[]atomic.Pointer[InlineCache]] // by instruction offset, made on first use
 }
 
 type CallFrame struct {
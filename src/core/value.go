@@ -6,14 +6,15 @@ import (
 	"fmt"
 	"glox/src/util"
 	"math"
+	"unsafe"
 )
 
-var NIL_VALUE = Value{Type: VAL_NIL}
+var NIL_VALUE = Value{}
 
 // UNDEFINED_VALUE is a VM-internal sentinel placed in an optional parameter's
 // local slot when the caller omits it. The function prologue replaces it by
 // running the default expression, so it never reaches user code.
-var UNDEFINED_VALUE = Value{Type: VAL_UNDEFINED}
+var UNDEFINED_VALUE = scalarValue(VAL_UNDEFINED, 0, false)
 
 type ValueType uint8
 
@@ -29,46 +30,195 @@ const (
 	VAL_UNDEFINED // internal sentinel: an omitted optional-parameter slot before its default runs
 )
 
+// A Value is two words: a pointer the garbage collector follows and a word
+// it does not. How they are used depends on what the value holds.
+//
+//   - nil: both are zero, so the zero Value is nil.
+//   - bool, int, float and the undefined sentinel: ptr points at the cell of
+//     scalarTags for the value's type and mutability, and bits holds the
+//     payload (0/1, the int, or the float's bits).
+//   - strings: ptr is the StringObject's Chars, and bits holds a header
+//     (see below) with the intern id in its low 32 bits.
+//   - other objects and vectors: ptr is the data word of the Object
+//     interface, and bits holds a header with the address of the
+//     interface's itab in its low 48 bits, so Obj can put the interface
+//     back together without an allocation. Itabs are never freed or moved.
+//
+// The header keeps the object type in bits 48-55, the immutable flag in bit
+// 59 and the value type in bits 60-63, where nil's zero bits read as VAL_NIL.
+//
+// At 16 bytes with a single pointer, a Value is half the size it was when it
+// held its fields directly, which halves the value stack and the slots,
+// lists and maps holding values. It doesn't spare the collector: ptr is
+// scanned in every Value, scalars included -- a scalar's points into
+// scalarTags, outside the heap, so it is discarded rather than followed,
+// but not skipped -- and storing any Value takes a write barrier while the
+// collector runs.
+//
+// Nothing outside this file depends on the layout: use the accessors (Type,
+// Obj, ObjType, Data, InternedId, Immutable) and the Make*Value constructors.
 type Value struct {
-	Obj        Object     // 16 bytes (largest alignment first)
-	Data       uint64     // 8 bytes — holds int (cast), float64 bits, or bool (0/1)
-	InternedId int32      // 4 bytes — string intern ID cache; int32 is sufficient (max ~2B unique strings)
-	Type       ValueType  // 1 byte
-	ObjType    ObjectType // 1 byte — concrete object subtype, cached at construction so the VM can
-	// discriminate without an interface GetType() call. Valid ONLY when this value
-	// carries an object (Type is VAL_OBJ / VAL_VEC2 / VAL_VEC3 / VAL_VEC4); its zero
-	// value coincides with OBJECT_STRING, so never read it without first confirming
-	// the value is object-typed. Every run-loop read site already gates on that.
-	Immut bool    // 1 byte
-	_     [1]byte // 1 byte padding (keeps struct size a multiple of 8 → 32 bytes)
-}
-
-func boolToUint64(b bool) uint64 {
-	if b {
-		return 1
+	ptr  unsafe.Pointer
+	bits uint64
+}
+
+// ValueSize is the size of a Value, which memory limits charge each slot of
+// a list or dict at.
+const ValueSize = int(unsafe.Sizeof(Value{}))
+
+// scalarTags has a cell for each scalar type, mutable and immutable, for
+// Values to point at: the offset of the cell a Value points at gives its
+// type and mutability.
+var scalarTags [2 * (VAL_UNDEFINED + 1)]byte
+
+const (
+	itabMask       = 1<<48 - 1
+	objTypeShift   = 48
+	immutBit       = 1 << 59
+	valTypeShift   = 60
+	internedIdMask = 1<<32 - 1
+)
+
+// iface is the layout of a non-empty interface value.
+type iface struct {
+	tab  uintptr // the itab, which is not in the heap
+	data unsafe.Pointer
+}
+
+// scalarValue makes a value of scalar type t. The scalar Make*Value
+// functions and Is* tests spell out the same arithmetic rather than calling
+// scalarValue or is, which keeps them cheap enough for Go to inline into the
+// VM's run loop: a function that big only takes the cheapest callees.
+func scalarValue(t ValueType, data uint64, immut bool) Value {
+
+	return Value{ptr: unsafe.Add(unsafe.Pointer(&scalarTags[2*t]), *(*uint8)(unsafe.Pointer(&immut))), bits: data}
+}
+
+// scalarCell returns the index of the scalarTags cell v points at, or a
+// number past the end of scalarTags if v holds nil or an object.
+func (v Value) scalarCell() uintptr {
+
+	return uintptr(v.ptr) - uintptr(unsafe.Pointer(&scalarTags))
+}
+
+func (v Value) isScalar() bool {
+
+	return v.scalarCell() < uintptr(len(scalarTags))
+}
+
+func (v Value) is(t ValueType) bool {
+
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags[2*t])) < 2
+}
+
+// Type returns what kind of value v holds.
+func (v Value) Type() ValueType {
+
+	if cell := v.scalarCell(); cell < uintptr(len(scalarTags)) {
+		return ValueType(cell / 2)
+	}
+	return ValueType(v.bits >> valTypeShift)
+}
+
+// Data returns the payload of a bool, int or float: 0/1, the int, or the
+// float's bits. It is 0 for anything else.
+func (v Value) Data() uint64 {
+
+	if v.isScalar() {
+		return v.bits
 	}
 	return 0
 }
 
+// ObjType returns the type of the object v holds. Like the Type of an
+// object, it is only meaningful once v is known to hold one: its zero value
+// is OBJECT_STRING.
+func (v Value) ObjType() ObjectType {
+
+	return ObjectType(v.bits >> objTypeShift)
+}
+
+// InternedId returns the intern id of the string v holds, or 0 if v does
+// not hold a string.
+func (v Value) InternedId() int32 {
+
+	if v.isObject() && v.ObjType() == OBJECT_STRING {
+		return int32(v.bits & internedIdMask)
+	}
+	return 0
+}
+
+// Immutable reports whether v is marked immutable.
+func (v Value) Immutable() bool {
+
+	if cell := v.scalarCell(); cell < uintptr(len(scalarTags)) {
+		return cell&1 != 0
+	}
+	return v.ptr != nil && v.bits&immutBit != 0
+}
+
+func (v Value) isObject() bool {
+
+	return v.ptr != nil && !v.isScalar()
+}
+
+// Obj returns the object v holds, or nil if it does not hold one.
+func (v Value) Obj() Object {
+
+	if !v.isObject() {
+		return nil
+	}
+	if v.ObjType() == OBJECT_STRING {
+		return v.stringObject()
+	}
+	var obj Object
+	i := (*iface)(unsafe.Pointer(&obj))
+	i.tab = uintptr(v.bits & itabMask)
+	i.data = v.ptr
+	return obj
+}
+
+func (v Value) stringObject() StringObject {
+
+	return StringObject{Chars: (*string)(v.ptr), InternedId: int(v.bits & internedIdMask)}
+}
+
+func objectValue(t ValueType, obj Object, immut bool) Value {
+
+	objType := obj.GetType()
+	header := uint64(objType)<<objTypeShift | uint64(t)<<valTypeShift
+	if immut {
+		header |= immutBit
+	}
+	if s, ok := obj.(StringObject); ok {
+		return Value{ptr: unsafe.Pointer(s.Chars), bits: header | uint64(s.InternedId)&internedIdMask}
+	}
+	i := (*iface)(unsafe.Pointer(&obj))
+	if i.tab&^itabMask != 0 {
+		panic("core: itab address does not fit in a Value")
+	}
+	return Value{ptr: i.data, bits: header | uint64(i.tab)}
+}
+
 func Immutable(v Value) Value {
 
-	switch v.Type {
+	switch v.Type() {
 	case VAL_INT:
-		return MakeIntValue(int(v.Data), true)
+		return MakeIntValue(int(v.Data()), true)
 	case VAL_FLOAT:
-		return MakeFloatValue(math.Float64frombits(v.Data), true)
+		return MakeFloatValue(math.Float64frombits(v.Data()), true)
 	case VAL_BOOL:
-		return MakeBooleanValue(v.Data != 0, true)
+		return MakeBooleanValue(v.Data() != 0, true)
 	case VAL_OBJ:
-		return MakeObjectValue(v.Obj, true)
+		return MakeObjectValue(v.Obj(), true)
 	case VAL_VEC2:
-		vec2 := v.Obj.(*Vec2Object)
+		vec2 := v.Obj().(*Vec2Object)
 		return MakeVec2Value(vec2.X, vec2.Y, true)
 	case VAL_VEC3:
-		vec3 := v.Obj.(*Vec3Object)
+		vec3 := v.Obj().(*Vec3Object)
 		return MakeVec3Value(vec3.X, vec3.Y, vec3.Z, true)
 	case VAL_VEC4:
-		vec4 := v.Obj.(*Vec4Object)
+		vec4 := v.Obj().(*Vec4Object)
 		return MakeVec4Value(vec4.X, vec4.Y, vec4.Z, vec4.W, true)
 
 	}
@@ -76,23 +226,23 @@ func Immutable(v Value) Value {
 }
 
 func Mutable(v Value) Value {
-	switch v.Type {
+	switch v.Type() {
 	case VAL_INT:
-		return MakeIntValue(int(v.Data), false)
+		return MakeIntValue(int(v.Data()), false)
 	case VAL_FLOAT:
-		return MakeFloatValue(math.Float64frombits(v.Data), false)
+		return MakeFloatValue(math.Float64frombits(v.Data()), false)
 	case VAL_BOOL:
-		return MakeBooleanValue(v.Data != 0, false)
+		return MakeBooleanValue(v.Data() != 0, false)
 	case VAL_OBJ:
-		return MakeObjectValue(v.Obj, false)
+		return MakeObjectValue(v.Obj(), false)
 	case VAL_VEC2:
-		vec2 := v.Obj.(*Vec2Object)
+		vec2 := v.Obj().(*Vec2Object)
 		return MakeVec2Value(vec2.X, vec2.Y, false)
 	case VAL_VEC3:
-		vec3 := v.Obj.(*Vec3Object)
+		vec3 := v.Obj().(*Vec3Object)
 		return MakeVec3Value(vec3.X, vec3.Y, vec3.Z, false)
 	case VAL_VEC4:
-		vec4 := v.Obj.(*Vec4Object)
+		vec4 := v.Obj().(*Vec4Object)
 		return MakeVec4Value(vec4.X, vec4.Y, vec4.Z, vec4.W, false)
 	}
 	return NIL_VALUE
@@ -100,46 +250,46 @@ func Mutable(v Value) Value {
 
 func ValuesEqual(a, b Value, typesMustMatch bool) bool {
 
-	if a.InternedId != 0 && b.InternedId != 0 {
-		return a.InternedId == b.InternedId
+	if a.IsStringObject() && b.IsStringObject() {
+		return a.InternedId() == b.InternedId()
 	}
 
-	switch a.Type {
+	switch a.Type() {
 	case VAL_BOOL:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_BOOL:
-			return a.Data == b.Data
+			return a.Data() == b.Data()
 		default:
 			return false
 		}
 
 	case VAL_INT:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_INT:
-			return a.Data == b.Data
+			return a.Data() == b.Data()
 		case VAL_FLOAT:
 			if typesMustMatch {
 				return false
 			}
-			return float64(int(a.Data)) == math.Float64frombits(b.Data)
+			return float64(int(a.Data())) == math.Float64frombits(b.Data())
 		default:
 			return false
 		}
 	case VAL_FLOAT:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_INT:
 			if typesMustMatch {
 				return false
 			}
-			return math.Float64frombits(a.Data) == float64(int(b.Data))
+			return math.Float64frombits(a.Data()) == float64(int(b.Data()))
 		case VAL_FLOAT:
-			return a.Data == b.Data
+			return a.Data() == b.Data()
 		default:
 			return false
 		}
 
 	case VAL_NIL:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_NIL:
 			return true
 		default:
@@ -147,40 +297,40 @@ func ValuesEqual(a, b Value, typesMustMatch bool) bool {
 		}
 	case VAL_OBJ:
 
-		switch b.Type {
+		switch b.Type() {
 		case VAL_OBJ:
-			if a.ObjType != b.ObjType {
+			if a.ObjType() != b.ObjType() {
 				return false
 			}
-			return a.Obj.String() == b.Obj.String()
+			return a.Obj().String() == b.Obj().String()
 		default:
 			return false
 		}
 	case VAL_VEC2:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_VEC2:
-			av := a.Obj.(*Vec2Object)
-			bv := b.Obj.(*Vec2Object)
+			av := a.Obj().(*Vec2Object)
+			bv := b.Obj().(*Vec2Object)
 			return av.X == bv.X && av.Y == bv.Y
 		default:
 			return false
 
 		}
 	case VAL_VEC3:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_VEC3:
-			av := a.Obj.(*Vec3Object)
-			bv := b.Obj.(*Vec3Object)
+			av := a.Obj().(*Vec3Object)
+			bv := b.Obj().(*Vec3Object)
 			return av.X == bv.X && av.Y == bv.Y && av.Z == bv.Z
 		default:
 			return false
 
 		}
 	case VAL_VEC4:
-		switch b.Type {
+		switch b.Type() {
 		case VAL_VEC4:
-			av := a.Obj.(*Vec4Object)
-			bv := b.Obj.(*Vec4Object)
+			av := a.Obj().(*Vec4Object)
+			bv := b.Obj().(*Vec4Object)
 			return av.X == bv.X && av.Y == bv.Y && av.Z == bv.Z && av.W == bv.W
 		default:
 			return false
@@ -190,40 +340,51 @@ func ValuesEqual(a, b Value, typesMustMatch bool) bool {
 	return false
 }
 
-func (v Value) IsInt() bool    { return v.Type == VAL_INT }
-func (v Value) IsFloat() bool  { return v.Type == VAL_FLOAT }
-func (v Value) IsNumber() bool { return v.Type == VAL_INT || v.Type == VAL_FLOAT }
-func (v Value) IsBool() bool   { return v.Type == VAL_BOOL }
+func (v Value) IsInt() bool {
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags[2*VAL_INT])) < 2
+}
+func (v Value) IsFloat() bool {
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags[2*VAL_FLOAT])) < 2
+}
+func (v Value) IsNumber() bool {
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags[2*VAL_INT])) < 4 // VAL_FLOAT follows VAL_INT
+}
+func (v Value) IsBool() bool {
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags[2*VAL_BOOL])) < 2
+}
+func (v Value) IsNil() bool {
+	return v.ptr == nil
+}
 
 // func (v Value) isNil() bool    { return v.Type == VAL_NIL }
-func (v Value) IsObj() bool { return v.Type == VAL_OBJ }
+func (v Value) IsObj() bool {
+	return uintptr(v.ptr)-uintptr(unsafe.Pointer(&scalarTags)) >= uintptr(len(scalarTags)) && v.bits>>valTypeShift == uint64(VAL_OBJ)
+}
 
 func (v Value) AsFloat() float64 {
-	switch v.Type {
-	case VAL_INT:
-		return float64(int(v.Data))
-	case VAL_FLOAT:
-		return math.Float64frombits(v.Data)
-	default:
-		return 0.0
+	if v.is(VAL_FLOAT) {
+		return math.Float64frombits(v.bits)
 	}
+	if v.is(VAL_INT) {
+		return float64(int(v.bits))
+	}
+	return 0.0
 }
 
 func (v Value) AsInt() int {
-	switch v.Type {
-	case VAL_INT:
-		return int(v.Data)
-	case VAL_FLOAT:
-		return int(math.Float64frombits(v.Data))
-	default:
-		return 0
+	if v.is(VAL_INT) {
+		return int(v.bits)
+	}
+	if v.is(VAL_FLOAT) {
+		return int(math.Float64frombits(v.bits))
 	}
+	return 0
 }
 
 func IsString(v Value) bool {
-	switch v.Type {
+	switch v.Type() {
 	case VAL_OBJ:
-		return v.ObjType == OBJECT_STRING
+		return v.ObjType() == OBJECT_STRING
 	}
 	return false
 }
@@ -251,49 +412,48 @@ func GetInstanceObjectValue(v Value) *InstanceObject {
 
 // ================================================================================================
 func MakeIntValue(i int, immut bool) Value {
-	return Value{Type: VAL_INT, Data: uint64(i), Immut: immut}
+	return Value{ptr: unsafe.Add(unsafe.Pointer(&scalarTags[2*VAL_INT]), *(*uint8)(unsafe.Pointer(&immut))), bits: uint64(i)}
 }
 
 func MakeFloatValue(f float64, immut bool) Value {
-	return Value{Type: VAL_FLOAT, Data: math.Float64bits(f), Immut: immut}
+	return Value{ptr: unsafe.Add(unsafe.Pointer(&scalarTags[2*VAL_FLOAT]), *(*uint8)(unsafe.Pointer(&immut))), bits: math.Float64bits(f)}
 }
 
 func MakeBooleanValue(b bool, immut bool) Value {
-	return Value{Type: VAL_BOOL, Data: boolToUint64(b), Immut: immut}
+	return Value{ptr: unsafe.Add(unsafe.Pointer(&scalarTags[2*VAL_BOOL]), *(*uint8)(unsafe.Pointer(&immut))), bits: uint64(*(*uint8)(unsafe.Pointer(&b)))}
 }
 
 func MakeStringObjectValue(s string, immut bool) Value {
-	so := MakeStringObject(s)
-	return Value{Type: VAL_OBJ, ObjType: OBJECT_STRING, Obj: so, Immut: immut, InternedId: int32(so.InternedId)}
+	return objectValue(VAL_OBJ, MakeStringObject(s), immut)
 }
 
 func MakeObjectValue(obj Object, immut bool) Value {
-	return Value{Type: VAL_OBJ, ObjType: obj.GetType(), Obj: obj, Immut: immut}
+	return objectValue(VAL_OBJ, obj, immut)
 }
 
 func (v Value) String() string {
-	switch v.Type {
+	switch v.Type() {
 	case VAL_INT:
-		return fmt.Sprintf("%d", int(v.Data))
+		return fmt.Sprintf("%d", int(v.Data()))
 	case VAL_FLOAT:
-		return fmt.Sprintf("%g", math.Float64frombits(v.Data))
+		return fmt.Sprintf("%g", math.Float64frombits(v.Data()))
 	case VAL_BOOL:
-		if v.Data != 0 {
+		if v.Data() != 0 {
 			return "true"
 		}
 		return "false"
 	case VAL_NIL:
 		return "nil"
 	case VAL_OBJ:
-		return v.Obj.String()
+		return v.Obj().String()
 	case VAL_VEC2:
-		vec2 := v.Obj.(*Vec2Object)
+		vec2 := v.Obj().(*Vec2Object)
 		return fmt.Sprintf("vec2(%g, %g)", vec2.X, vec2.Y)
 	case VAL_VEC3:
-		vec3 := v.Obj.(*Vec3Object)
+		vec3 := v.Obj().(*Vec3Object)
 		return fmt.Sprintf("vec3(%g, %g, %g)", vec3.X, vec3.Y, vec3.Z)
 	case VAL_VEC4:
-		vec4 := v.Obj.(*Vec4Object)
+		vec4 := v.Obj().(*Vec4Object)
 		return fmt.Sprintf("vec4(%g, %g, %g, %g)", vec4.X, vec4.Y, vec4.Z, vec4.W)
 	case VAL_UNDEFINED:
 		return "<undefined>"
@@ -302,79 +462,102 @@ func (v Value) String() string {
 	}
 }
 
-func (v Value) Immutable() bool {
-	return v.Immut
-}
-
 //================================================================================================
 
 func (v Value) IsStringObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_STRING
+	return v.IsObj() && v.ObjType() == OBJECT_STRING
 }
 
 func (v Value) AsString() StringObject {
 
-	return v.Obj.(StringObject)
+	if v.isObject() && v.ObjType() == OBJECT_STRING {
+		return v.stringObject()
+	}
+	return v.Obj().(StringObject)
 }
 
 func (v Value) AsList() *ListObject {
 
-	return v.Obj.(*ListObject)
+	if !v.isObject() || v.ObjType() != OBJECT_LIST {
+		panic("core: value does not hold a ListObject")
+	}
+	return (*ListObject)(v.ptr)
 }
 
 func (v Value) AsDict() *DictObject {
 
-	return v.Obj.(*DictObject)
+	if !v.isObject() || v.ObjType() != OBJECT_DICT {
+		panic("core: value does not hold a DictObject")
+	}
+	return (*DictObject)(v.ptr)
 }
 
 func (v Value) AsFunction() *FunctionObject {
 
-	return v.Obj.(*FunctionObject)
+	if !v.isObject() || v.ObjType() != OBJECT_FUNCTION {
+		panic("core: value does not hold a FunctionObject")
+	}
+	return (*FunctionObject)(v.ptr)
 }
 
 func (v Value) AsBuiltIn() *BuiltInObject {
 
-	return v.Obj.(*BuiltInObject)
+	return v.Obj().(*BuiltInObject)
 }
 
 func (v Value) AsClosure() *ClosureObject {
 
-	return v.Obj.(*ClosureObject)
+	if !v.isObject() || v.ObjType() != OBJECT_CLOSURE {
+		panic("core: value does not hold a ClosureObject")
+	}
+	return (*ClosureObject)(v.ptr)
 }
 
 func (v Value) AsClass() *ClassObject {
 
-	return v.Obj.(*ClassObject)
+	if !v.isObject() || v.ObjType() != OBJECT_CLASS {
+		panic("core: value does not hold a ClassObject")
+	}
+	return (*ClassObject)(v.ptr)
 }
 
 func (v Value) AsInstance() *InstanceObject {
 
-	return v.Obj.(*InstanceObject)
+	if !v.isObject() || v.ObjType() != OBJECT_INSTANCE {
+		panic("core: value does not hold a InstanceObject")
+	}
+	return (*InstanceObject)(v.ptr)
 }
 
 func (v Value) AsModule() *ModuleObject {
 
-	return v.Obj.(*ModuleObject)
+	if !v.isObject() || v.ObjType() != OBJECT_MODULE {
+		panic("core: value does not hold a ModuleObject")
+	}
+	return (*ModuleObject)(v.ptr)
 }
 
 func (v Value) AsBoundMethod() *BoundMethodObject {
 
-	return v.Obj.(*BoundMethodObject)
+	if !v.isObject() || v.ObjType() != OBJECT_BOUNDMETHOD {
+		panic("core: value does not hold a BoundMethodObject")
+	}
+	return (*BoundMethodObject)(v.ptr)
 }
 
 func (v Value) AsIterator() Iterator {
 
-	return v.Obj.(Iterator)
+	return v.Obj().(Iterator)
 }
 
 func (v Value) AsListIterator() *ListIteratorObject {
-	return v.Obj.(*ListIteratorObject)
+	return v.Obj().(*ListIteratorObject)
 }
 
 func (v Value) IsListObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_LIST
+	return v.IsObj() && v.ObjType() == OBJECT_LIST
 }
 
 // func (v Value) isDictObject() bool {
@@ -390,40 +573,40 @@ func (v Value) IsListObject() bool {
 */
 func (v Value) IsBuiltInObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_NATIVE
+	return v.IsObj() && v.ObjType() == OBJECT_NATIVE
 }
 
 func (v Value) IsClosureObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_CLOSURE
+	return v.IsObj() && v.ObjType() == OBJECT_CLOSURE
 }
 
 func (v Value) IsClassObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_CLASS
+	return v.IsObj() && v.ObjType() == OBJECT_CLASS
 }
 
 func (v Value) IsInstanceObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_INSTANCE
+	return v.IsObj() && v.ObjType() == OBJECT_INSTANCE
 }
 
 func (v Value) IsBoundMethodObject() bool {
 
-	return v.IsObj() && v.ObjType == OBJECT_BOUNDMETHOD
+	return v.IsObj() && v.ObjType() == OBJECT_BOUNDMETHOD
 }
 
 func (v *Value) Serialise(buffer *bytes.Buffer) {
 
-	switch v.Type {
+	switch v.Type() {
 	case VAL_FLOAT:
 		buffer.Write([]byte{0x01})
-		bin.Write(buffer, bin.LittleEndian, v.Data)
+		bin.Write(buffer, bin.LittleEndian, v.Data())
 	case VAL_INT:
 		buffer.Write([]byte{0x02})
-		bin.Write(buffer, bin.LittleEndian, uint32(int(v.Data)))
+		bin.Write(buffer, bin.LittleEndian, uint32(int(v.Data())))
 	case VAL_OBJ:
-		switch v.Obj.GetType() {
+		switch v.Obj().GetType() {
 		case OBJECT_STRING:
 			buffer.Write([]byte{0x03})
 			s := v.AsString().Get()
@@ -449,7 +632,7 @@ func (v *Value) Serialise(buffer *bytes.Buffer) {
 	case VAL_BOOL:
 		buffer.Write([]byte{0x05})
 		b := byte(0)
-		if v.Data != 0 {
+		if v.Data() != 0 {
 			b = byte(1)
 		}
 		buffer.Write([]byte{b})
@@ -463,30 +646,39 @@ func (v *Value) Serialise(buffer *bytes.Buffer) {
 // built in vectors
 
 func MakeVec2Value(x, y float64, immut bool) Value {
-	return Value{Type: VAL_VEC2, ObjType: OBJECT_VEC2, Obj: MakeVec2Object(x, y), Immut: immut}
+	return objectValue(VAL_VEC2, MakeVec2Object(x, y), immut)
 }
 func MakeVec3Value(x, y, z float64, immut bool) Value {
-	return Value{Type: VAL_VEC3, ObjType: OBJECT_VEC3, Obj: MakeVec3Object(x, y, z), Immut: immut}
+	return objectValue(VAL_VEC3, MakeVec3Object(x, y, z), immut)
 }
 func MakeVec4Value(x, y, z, w float64, immut bool) Value {
-	return Value{Type: VAL_VEC4, ObjType: OBJECT_VEC4, Obj: MakeVec4Object(x, y, z, w), Immut: immut}
+	return objectValue(VAL_VEC4, MakeVec4Object(x, y, z, w), immut)
 }
 
 func (v Value) AsVec2() *Vec2Object {
-	return v.Obj.(*Vec2Object)
+	if !v.isObject() || v.ObjType() != OBJECT_VEC2 {
+		panic("core: value does not hold a Vec2Object")
+	}
+	return (*Vec2Object)(v.ptr)
 }
 func (v Value) AsVec3() *Vec3Object {
-	return v.Obj.(*Vec3Object)
+	if !v.isObject() || v.ObjType() != OBJECT_VEC3 {
+		panic("core: value does not hold a Vec3Object")
+	}
+	return (*Vec3Object)(v.ptr)
 }
 func (v Value) AsVec4() *Vec4Object {
-	return v.Obj.(*Vec4Object)
+	if !v.isObject() || v.ObjType() != OBJECT_VEC4 {
+		panic("core: value does not hold a Vec4Object")
+	}
+	return (*Vec4Object)(v.ptr)
 }
 func (v Value) IsVec2() bool {
-	return v.Type == VAL_VEC2
+	return v.Type() == VAL_VEC2
 }
 func (v Value) IsVec3() bool {
-	return v.Type == VAL_VEC3
+	return v.Type() == VAL_VEC3
 }
 func (v Value) IsVec4() bool {
-	return v.Type == VAL_VEC4
+	return v.Type() == VAL_VEC4
 }
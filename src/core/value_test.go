@@ -0,0 +1,84 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"unsafe"
+)
+
+func TestValueSize(t *testing.T) {
+	if size := unsafe.Sizeof(Value{}); size != 16 {
+		t.Errorf("Value is %d bytes", size)
+	}
+}
+
+func TestScalarValues(t *testing.T) {
+	var zero Value
+	if zero.Type() != VAL_NIL || !zero.IsNil() || zero.Immutable() || zero.Obj() != nil {
+		t.Errorf("the zero Value is not a mutable nil: %v", zero.Type())
+	}
+	if UNDEFINED_VALUE.Type() != VAL_UNDEFINED {
+		t.Errorf("UNDEFINED_VALUE has type %d", UNDEFINED_VALUE.Type())
+	}
+
+	for _, immut := range []bool{false, true} {
+		cases := []struct {
+			v    Value
+			typ  ValueType
+			data uint64
+		}{
+			{MakeIntValue(-7, immut), VAL_INT, uint64(0xfffffffffffffff9)},
+			{MakeIntValue(math.MaxInt64, immut), VAL_INT, math.MaxInt64},
+			{MakeFloatValue(-2.5, immut), VAL_FLOAT, math.Float64bits(-2.5)},
+			{MakeFloatValue(math.NaN(), immut), VAL_FLOAT, math.Float64bits(math.NaN())},
+			{MakeBooleanValue(true, immut), VAL_BOOL, 1},
+			{MakeBooleanValue(false, immut), VAL_BOOL, 0},
+		}
+		for _, c := range cases {
+			if c.v.Type() != c.typ || c.v.Data() != c.data || c.v.Immutable() != immut {
+				t.Errorf("%v: type %d, data %x, immutable %v", c.v, c.v.Type(), c.v.Data(), c.v.Immutable())
+			}
+			if c.v.IsObj() || c.v.Obj() != nil || c.v.InternedId() != 0 {
+				t.Errorf("%v looks like an object", c.v)
+			}
+		}
+	}
+	if v := MakeIntValue(3, false); !v.IsInt() || !v.IsNumber() || v.IsFloat() || v.AsFloat() != 3 {
+		t.Errorf("int predicates wrong for %v", v)
+	}
+	if v := MakeFloatValue(3.75, true); !v.IsFloat() || !v.IsNumber() || v.IsInt() || v.AsInt() != 3 {
+		t.Errorf("float predicates wrong for %v", v)
+	}
+}
+
+func TestObjectValues(t *testing.T) {
+	list := MakeListObject([]Value{MakeIntValue(1, false)}, false)
+	for _, immut := range []bool{false, true} {
+		v := MakeObjectValue(list, immut)
+		if v.Type() != VAL_OBJ || v.ObjType() != OBJECT_LIST || v.Immutable() != immut || v.Data() != 0 {
+			t.Errorf("list value: type %d, object type %d, immutable %v", v.Type(), v.ObjType(), v.Immutable())
+		}
+		if v.AsList() != list || v.Obj().(*ListObject) != list {
+			t.Error("list value does not give back the list")
+		}
+		if Mutable(v).Immutable() || !Immutable(v).Immutable() || Immutable(v).AsList() != list {
+			t.Error("changing mutability lost the list")
+		}
+	}
+
+	s := MakeStringObjectValue("shape", true)
+	if !s.IsStringObject() || s.AsString().Get() != "shape" || s.Obj().(StringObject).Get() != "shape" || !s.Immutable() {
+		t.Errorf("string value %v", s)
+	}
+	if int(s.InternedId()) != InternName("shape") {
+		t.Errorf("string value has intern id %d", s.InternedId())
+	}
+	if !ValuesEqual(s, MakeObjectValue(MakeStringObject("shape"), false), true) {
+		t.Error("equal strings made two ways compare unequal")
+	}
+
+	vec := MakeVec3Value(1, 2, 3, false)
+	if vec.Type() != VAL_VEC3 || vec.ObjType() != OBJECT_VEC3 || vec.AsVec3().Z != 3 || vec.IsObj() {
+		t.Errorf("vec3 value %v", vec)
+	}
+}
@@ -204,6 +204,18 @@ func DisassembleInstruction(c *core.Chunk, name string, function string, depth i
 		return byteInstruction(c, "OP_UNPACK", offset)
 	case core.OP_IMPORT_FROM:
 		return importFromInstruction(c, "OP_IMPORT_FROM", offset)
+	case core.OP_EXPORT:
+		return constantInstruction(c, "OP_EXPORT", offset)
+	case core.OP_ASYNC:
+		return simpleInstruction("OP_ASYNC", offset)
+	case core.OP_AWAIT:
+		return simpleInstruction("OP_AWAIT", offset)
+	case core.OP_CALL_SPREAD:
+		return byteInstruction(c, "OP_CALL_SPREAD", offset)
+	case core.OP_INVOKE_SPREAD:
+		return invokeInstruction(c, "OP_INVOKE_SPREAD", offset)
+	case core.OP_SUPER_INVOKE_SPREAD:
+		return invokeInstruction(c, "OP_SUPER_INVOKE_SPREAD", offset)
 	case core.OP_ADD_NN:
 		return twoByteInstruction(c, "OP_ADD_NN", offset)
 	case core.OP_ADD_II:
@@ -271,7 +283,7 @@ func twoByteInstruction(c *core.Chunk, name string, offset int) int {
 	byte2 := uint32(c.Code[offset+2])
 
 	core.LogFmt(core.TRACE, "%-16s %04d %04d \n", name, byte1, byte2)
-	return offset + 4
+	return offset + 3
 }
 
 func jumpInstruction(c *core.Chunk, name string, sign int, offset int) int {
@@ -78,5 +78,10 @@ func InstrumentHook(vmContext interface{}, event core.DebugEvent, data any) {
 	switch event {
 	case core.DebugEventOpcode:
 		InstructionCount += 1
+		if op, ok := data.(uint8); ok {
+			recordOpcode(op)
+		}
+	case core.DebugEventCall, core.DebugEventReturn:
+		lastOpcode = -1
 	}
 }
@@ -0,0 +1,163 @@
+package debug
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"glox/src/core"
+)
+
+// OpcodePairs counts, in an instrumented run, how often each opcode was
+// executed directly after another in the same frame. Pairs that dominate
+// are the candidates for new superinstructions in the compiler's peephole
+// rules.
+var OpcodePairs [256][256]int
+
+// lastOpcode is the opcode InstrumentHook saw before the current one, or
+// -1 after a call or return, where the next opcode is in another function.
+var lastOpcode = -1
+
+// recordOpcode counts the pair op completes.
+func recordOpcode(op uint8) {
+
+	if lastOpcode >= 0 {
+		OpcodePairs[lastOpcode][op]++
+	}
+	lastOpcode = int(op)
+}
+
+// OpcodeName returns the name of an opcode as the disassembler shows it.
+func OpcodeName(op uint8) string {
+
+	if int(op) < len(opcodeNames) && opcodeNames[op] != "" {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP_%d", op)
+}
+
+// ReportOpcodePairs writes the n most frequent opcode pairs to w, with
+// each one's share of all the pairs counted, and clears the counts.
+func ReportOpcodePairs(w io.Writer, n int) {
+
+	type pair struct {
+		first, second uint8
+		count         int
+	}
+	var pairs []pair
+	total := 0
+	for a := range OpcodePairs {
+		for b, count := range OpcodePairs[a] {
+			if count > 0 {
+				pairs = append(pairs, pair{uint8(a), uint8(b), count})
+				total += count
+			}
+		}
+	}
+	OpcodePairs = [256][256]int{}
+	lastOpcode = -1
+	if total == 0 {
+		return
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].count != pairs[j].count {
+			return pairs[i].count > pairs[j].count
+		}
+		if pairs[i].first != pairs[j].first {
+			return pairs[i].first < pairs[j].first
+		}
+		return pairs[i].second < pairs[j].second
+	})
+	if len(pairs) > n {
+		pairs = pairs[:n]
+	}
+	fmt.Fprintln(w, "Most frequent opcode pairs (superinstruction candidates):")
+	for _, p := range pairs {
+		fmt.Fprintf(w, "  %10d %5.1f%%  %s -> %s\n", p.count, 100*float64(p.count)/float64(total), OpcodeName(p.first), OpcodeName(p.second))
+	}
+}
+
+var opcodeNames = [...]string{
+	core.OP_RETURN:              "OP_RETURN",
+	core.OP_NOOP:                "OP_NOOP",
+	core.OP_CONSTANT:            "OP_CONSTANT",
+	core.OP_NEGATE:              "OP_NEGATE",
+	core.OP_ADD_NUMERIC:         "OP_ADD_NUMERIC",
+	core.OP_CONCAT:              "OP_CONCAT",
+	core.OP_ADD_VECTOR:          "OP_ADD_VECTOR",
+	core.OP_SUBTRACT:            "OP_SUBTRACT",
+	core.OP_MULTIPLY:            "OP_MULTIPLY",
+	core.OP_DIVIDE:              "OP_DIVIDE",
+	core.OP_NIL:                 "OP_NIL",
+	core.OP_TRUE:                "OP_TRUE",
+	core.OP_FALSE:               "OP_FALSE",
+	core.OP_NOT:                 "OP_NOT",
+	core.OP_EQUAL:               "OP_EQUAL",
+	core.OP_GREATER:             "OP_GREATER",
+	core.OP_LESS:                "OP_LESS",
+	core.OP_PRINT:               "OP_PRINT",
+	core.OP_STR:                 "OP_STR",
+	core.OP_POP:                 "OP_POP",
+	core.OP_DEFINE_GLOBAL:       "OP_DEFINE_GLOBAL",
+	core.OP_DEFINE_GLOBAL_CONST: "OP_DEFINE_GLOBAL_CONST",
+	core.OP_GET_GLOBAL:          "OP_GET_GLOBAL",
+	core.OP_SET_GLOBAL:          "OP_SET_GLOBAL",
+	core.OP_GET_LOCAL:           "OP_GET_LOCAL",
+	core.OP_SET_LOCAL:           "OP_SET_LOCAL",
+	core.OP_JUMP_IF_FALSE:       "OP_JUMP_IF_FALSE",
+	core.OP_JUMP:                "OP_JUMP",
+	core.OP_LOOP:                "OP_LOOP",
+	core.OP_CALL:                "OP_CALL",
+	core.OP_MODULUS:             "OP_MODULUS",
+	core.OP_CREATE_LIST:         "OP_CREATE_LIST",
+	core.OP_CREATE_DICT:         "OP_CREATE_DICT",
+	core.OP_INDEX:               "OP_INDEX",
+	core.OP_INDEX_ASSIGN:        "OP_INDEX_ASSIGN",
+	core.OP_SLICE:               "OP_SLICE",
+	core.OP_SLICE_ASSIGN:        "OP_SLICE_ASSIGN",
+	core.OP_CLOSURE:             "OP_CLOSURE",
+	core.OP_GET_UPVALUE:         "OP_GET_UPVALUE",
+	core.OP_SET_UPVALUE:         "OP_SET_UPVALUE",
+	core.OP_CLOSE_UPVALUE:       "OP_CLOSE_UPVALUE",
+	core.OP_CLASS:               "OP_CLASS",
+	core.OP_SET_PROPERTY:        "OP_SET_PROPERTY",
+	core.OP_GET_PROPERTY:        "OP_GET_PROPERTY",
+	core.OP_METHOD:              "OP_METHOD",
+	core.OP_STATIC_METHOD:       "OP_STATIC_METHOD",
+	core.OP_CLASS_VAR:           "OP_CLASS_VAR",
+	core.OP_INVOKE:              "OP_INVOKE",
+	core.OP_INHERIT:             "OP_INHERIT",
+	core.OP_GET_SUPER:           "OP_GET_SUPER",
+	core.OP_SUPER_INVOKE:        "OP_SUPER_INVOKE",
+	core.OP_IMPORT:              "OP_IMPORT",
+	core.OP_TRY:                 "OP_TRY",
+	core.OP_END_TRY:             "OP_END_TRY",
+	core.OP_EXCEPT:              "OP_EXCEPT",
+	core.OP_END_EXCEPT:          "OP_END_EXCEPT",
+	core.OP_FINALLY:             "OP_FINALLY",
+	core.OP_RAISE:               "OP_RAISE",
+	core.OP_FOREACH:             "OP_FOREACH",
+	core.OP_NEXT:                "OP_NEXT",
+	core.OP_END_FOREACH:         "OP_END_FOREACH",
+	core.OP_CREATE_TUPLE:        "OP_CREATE_TUPLE",
+	core.OP_IN:                  "OP_IN",
+	core.OP_BREAKPOINT:          "OP_BREAKPOINT",
+	core.OP_UNPACK:              "OP_UNPACK",
+	core.OP_IMPORT_FROM:         "OP_IMPORT_FROM",
+	core.OP_ONE:                 "OP_ONE",
+	core.OP_DUP:                 "OP_DUP",
+	core.OP_INC_LOCAL:           "OP_INC_LOCAL",
+	core.OP_ADD_NN:              "OP_ADD_NN",
+	core.OP_ADD_II:              "OP_ADD_II",
+	core.OP_ADD_FF:              "OP_ADD_FF",
+	core.OP_INCR_CONST_N:        "OP_INCR_CONST_N",
+	core.OP_INCR_CONST_I:        "OP_INCR_CONST_I",
+	core.OP_INCR_CONST_F:        "OP_INCR_CONST_F",
+	core.OP_JUMP_IF_DEFINED:     "OP_JUMP_IF_DEFINED",
+	core.OP_EXPORT:              "OP_EXPORT",
+	core.OP_ASYNC:               "OP_ASYNC",
+	core.OP_AWAIT:               "OP_AWAIT",
+	core.OP_CALL_SPREAD:         "OP_CALL_SPREAD",
+	core.OP_INVOKE_SPREAD:       "OP_INVOKE_SPREAD",
+	core.OP_SUPER_INVOKE_SPREAD: "OP_SUPER_INVOKE_SPREAD",
+}
@@ -78,7 +78,7 @@ func DumpEnvironment(env *core.Environment, seen map[uintptr]bool, indent int) {
 
 func dumpValue(val core.Value, seen map[uintptr]bool, indent int) {
 	if val.IsObj() {
-		dumpObject(val.Obj, seen, indent)
+		dumpObject(val.Obj(), seen, indent)
 	} else {
 		core.LogFmtLn(core.TRACE, "%s%v\n", indentPad(indent), val)
 	}
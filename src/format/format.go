@@ -0,0 +1,788 @@
+// Package format prints Lox source in one canonical layout, for `glox fmt`.
+//
+// The layout is the parser's view of the file: one statement per line with
+// no ';' terminators, four-space indentation, '{' on the line that opens a
+// block and every block spread over lines of its own. Argument, parameter,
+// list and dictionary lists that would run past MaxWidth, or that have
+// comments inside, are broken one item per line. Comments are not part of
+// the syntax tree; they are found in the gaps between tokens and written
+// back where they were, either after the code on a line or on lines of
+// their own. Formatting formatted source changes nothing.
+package format
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"glox/src/ast"
+	"glox/src/compiler"
+)
+
+// MaxWidth is the line length lists are broken to stay within.
+const MaxWidth = 100
+
+const indentWidth = 4
+
+// comment is a `//` comment, from its first slash to the end of its line.
+type comment struct {
+	start, end int
+	text       string
+}
+
+// printer writes the canonical form of a parsed file.
+type printer struct {
+	src      string
+	comments []comment
+	tokens   []int // offsets of the tokens written, in order
+	next     int   // first comment not yet written
+	lastEnd  int  // source offset just past the last thing written
+	flat     bool // measuring: never break lists, skip comments
+
+	buf         strings.Builder
+	col         int
+	indent      int
+	extra       int // continuation indent for the line after a comment inside an expression
+	atLineStart bool
+}
+
+// Source returns source in canonical form. name is the file name used in
+// diagnostics; a file that does not parse is returned unchanged with the
+// errors.
+func Source(name, source string) (string, []compiler.Diagnostic) {
+
+	script, diags := ast.Parse(name, source)
+	if compiler.HasErrors(diags) {
+		return source, diags
+	}
+	scn := compiler.NewScanner(source)
+	p := &printer{src: scn.Source, comments: findComments(scn), tokens: tokenOffsets(scn), atLineStart: true}
+	p.stmts(script.Stmts)
+	p.closing(len(scn.Source), len(script.Stmts) == 0)
+	out := strings.TrimRight(p.buf.String(), "\n")
+	if out == "" {
+		return "", diags
+	}
+	return out + "\n", diags
+}
+
+// findComments collects the comments in the gaps between tokens. Tokens
+// made from an interpolated string all cover the whole literal.
+func findComments(scn *compiler.Scanner) []comment {
+
+	var comments []comment
+	end := 0
+	for _, t := range scn.Tokens.Tokens {
+		if t.Offset > end {
+			gap := scn.Source[end:t.Offset]
+			for i := strings.Index(gap, "//"); i >= 0; i = strings.Index(gap, "//") {
+				n := strings.IndexByte(gap[i:], '\n')
+				if n < 0 {
+					n = len(gap) - i
+				}
+				comments = append(comments, comment{
+					start: end + i,
+					end:   end + i + n,
+					text:  strings.TrimRight(gap[i:i+n], " \t"),
+				})
+				end += i + n
+				gap = gap[i+n:]
+			}
+		}
+		end = max(end, t.Offset+t.Width)
+	}
+	return comments
+}
+
+// tokenOffsets lists where the tokens the printer writes start: all but
+// terminators.
+func tokenOffsets(scn *compiler.Scanner) []int {
+
+	var offsets []int
+	for _, t := range scn.Tokens.Tokens {
+		switch t.Tokentype {
+		case compiler.TOKEN_SEMICOLON, compiler.TOKEN_EOL, compiler.TOKEN_EOF:
+		default:
+			offsets = append(offsets, t.Offset)
+		}
+	}
+	return offsets
+}
+
+//-----------------------------------------------------------------------------
+// Output.
+
+// write appends text, indenting it first if it starts a line.
+func (p *printer) write(text string) {
+
+	if text == "" {
+		return
+	}
+	if p.atLineStart {
+		n := (p.indent + p.extra) * indentWidth
+		p.buf.WriteString(strings.Repeat(" ", n))
+		p.col = n
+		p.atLineStart = false
+		p.extra = 0
+	}
+	p.buf.WriteString(text)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(text[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(text)
+	}
+}
+
+// newline ends the line, after any comment that follows what was last
+// written on the same line of the source. A comment after a comma trails
+// the item before it.
+func (p *printer) newline() {
+
+	following := len(p.src)
+	i := sort.SearchInts(p.tokens, p.lastEnd)
+	for i < len(p.tokens) && p.src[p.tokens[i]] == ',' {
+		i++
+	}
+	if i < len(p.tokens) {
+		following = p.tokens[i]
+	}
+	for !p.flat && p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if c.start < p.lastEnd || c.start > following || strings.Contains(p.src[p.lastEnd:c.start], "\n") {
+			break
+		}
+		p.trailing(c)
+	}
+	p.buf.WriteString("\n")
+	p.col = 0
+	p.atLineStart = true
+}
+
+// blankLine separates what follows from what went before by an empty line
+// if the source did.
+func (p *printer) blankLine(offset int) {
+
+	if p.flat || offset < p.lastEnd || strings.Count(p.src[p.lastEnd:offset], "\n") < 2 {
+		return
+	}
+	if s := p.buf.String(); strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, "\n\n") {
+		p.buf.WriteString("\n")
+	}
+}
+
+// flush writes the comments before offset. One that shares its line with
+// code inside an expression ends that line, and the expression continues
+// indented on the next.
+func (p *printer) flush(offset int) {
+
+	for !p.flat && p.next < len(p.comments) && p.comments[p.next].start < offset {
+		c := p.comments[p.next]
+		if p.atLineStart {
+			p.write(c.text)
+			p.lastEnd = c.end
+			p.next++
+			p.newline()
+		} else {
+			p.trailing(c)
+			p.newline()
+			p.extra = 1
+		}
+	}
+}
+
+// trailing writes the comment c after the code on the line, one space from
+// it.
+func (p *printer) trailing(c comment) {
+
+	if !strings.HasSuffix(p.buf.String(), " ") {
+		p.write(" ")
+	}
+	p.write(c.text)
+	p.lastEnd = c.end
+	p.next++
+}
+
+// token writes text in place of the source token t.
+func (p *printer) token(t ast.Token, text string) {
+
+	p.flush(t.Offset)
+	p.write(text)
+	p.lastEnd = max(p.lastEnd, t.Offset+t.Width)
+}
+
+// word writes a token as it appears in the source.
+func (p *printer) word(t ast.Token) {
+
+	p.token(t, p.src[t.Offset:t.Offset+t.Width])
+}
+
+// verbatim writes the source text from the start of one token to the end of
+// another.
+func (p *printer) verbatim(from, to ast.Token) {
+
+	p.flush(from.Offset)
+	p.write(p.src[from.Offset : to.Offset+to.Width])
+	p.lastEnd = max(p.lastEnd, to.Offset+to.Width)
+}
+
+// hasComment reports whether a comment starts between two offsets.
+func (p *printer) hasComment(from, to int) bool {
+
+	for _, c := range p.comments[p.next:] {
+		if c.start >= to {
+			return false
+		}
+		if c.start >= from {
+			return true
+		}
+	}
+	return false
+}
+
+// width is how far the first line of what print writes would reach if it
+// started at the current column, with every list on one line.
+func (p *printer) width(print func(q *printer)) int {
+
+	q := &printer{src: p.src, flat: true, indent: p.indent}
+	print(q)
+	first, _, _ := strings.Cut(q.buf.String(), "\n")
+	col := p.col
+	if p.atLineStart {
+		col = (p.indent + p.extra) * indentWidth
+	}
+	return col + utf8.RuneCountInString(first)
+}
+
+// list writes n items between an opening and a closing bracket, separated
+// by commas. If breakable, a list that does not fit on the line or holds a
+// comment is written one item per line; the scanner ignores a line break
+// after '(', '[', '{' and ',' and the parser one before the closing bracket.
+func (p *printer) list(open ast.Token, n int, item func(q *printer, i int), close ast.Token, breakable bool) {
+
+	print := func(q *printer, broken bool) {
+		q.word(open)
+		if broken {
+			q.indent++
+		}
+		for i := 0; i < n; i++ {
+			if broken {
+				q.newline()
+			}
+			item(q, i)
+			if i < n-1 {
+				q.write(",")
+				if !broken {
+					q.write(" ")
+				}
+			}
+		}
+		if broken {
+			q.indent--
+			q.newline()
+		}
+		q.word(close)
+	}
+	broken := false
+	if breakable && n > 0 && !p.flat {
+		broken = p.hasComment(open.Offset, close.Offset) ||
+			p.width(func(q *printer) { print(q, false) }) > MaxWidth
+	}
+	print(p, broken)
+}
+
+//-----------------------------------------------------------------------------
+// Statements.
+
+// stmts writes a list of statements, each on its own line, keeping single
+// blank lines and comments from the source between them.
+func (p *printer) stmts(list []ast.Stmt) {
+
+	for i, s := range list {
+		p.leading(s.Pos().Offset, i == 0)
+		p.stmt(s)
+		p.newline()
+	}
+}
+
+// leading writes the comments on lines of their own before offset, and the
+// blank lines around them, except before the first thing in a block.
+func (p *printer) leading(offset int, first bool) {
+
+	for p.next < len(p.comments) && p.comments[p.next].start < offset {
+		c := p.comments[p.next]
+		if !first {
+			p.blankLine(c.start)
+		}
+		first = false
+		p.flush(c.end)
+	}
+	if !first {
+		p.blankLine(offset)
+	}
+}
+
+// closing writes the comments left before the end of a block at offset;
+// empty is set if the block holds nothing else.
+func (p *printer) closing(offset int, empty bool) {
+
+	for p.next < len(p.comments) && p.comments[p.next].start < offset {
+		c := p.comments[p.next]
+		if !empty {
+			p.blankLine(c.start)
+		}
+		empty = false
+		p.flush(c.end)
+	}
+}
+
+func (p *printer) stmt(s ast.Stmt) {
+
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		p.expr(s.X)
+	case *ast.UnpackStmt:
+		for i, name := range s.Names {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.word(name)
+		}
+		p.token(s.Equal, " = ")
+		p.expr(s.Value)
+	case *ast.VarStmt:
+		p.varStmt(s)
+	case *ast.PrintStmt:
+		// `print(x)` reads as a call; keep it that way.
+		switch s.X.(type) {
+		case *ast.Grouping, *ast.Tuple:
+			p.word(s.Keyword)
+		default:
+			p.token(s.Keyword, "print ")
+		}
+		p.expr(s.X)
+	case *ast.Block:
+		p.block(s)
+	case *ast.IfStmt:
+		p.token(s.Keyword, "if ")
+		p.paren(s.LParen, s.Cond, s.RParen)
+		p.body(s.Then)
+		if s.Else != nil {
+			if _, ok := s.Then.(*ast.Block); ok {
+				p.write(" ")
+			} else {
+				p.newline()
+			}
+			p.token(s.ElseTok, "else")
+			p.body(s.Else)
+		}
+	case *ast.WhileStmt:
+		p.token(s.Keyword, "while ")
+		p.paren(s.LParen, s.Cond, s.RParen)
+		p.body(s.Body)
+	case *ast.ForStmt:
+		p.forStmt(s)
+	case *ast.ForeachStmt:
+		p.token(s.Keyword, "foreach ")
+		p.word(s.LParen)
+		p.varStmt(s.Var)
+		p.token(s.In, " in ")
+		p.expr(s.Iterable)
+		p.word(s.RParen)
+		p.body(s.Body)
+	case *ast.BreakStmt:
+		p.word(s.Keyword)
+	case *ast.ContinueStmt:
+		p.word(s.Keyword)
+	case *ast.BreakpointStmt:
+		p.word(s.Keyword)
+	case *ast.ReturnStmt:
+		p.word(s.Keyword)
+		if s.Value != nil {
+			p.write(" ")
+			p.expr(s.Value)
+		}
+	case *ast.RaiseStmt:
+		p.token(s.Keyword, "raise ")
+		p.expr(s.Value)
+	case *ast.ImportStmt:
+		p.token(s.Keyword, "import ")
+		for i, m := range s.Modules {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.path(m.Path)
+			if m.Alias.Source != nil {
+				p.token(m.As, " as ")
+				p.word(m.Alias)
+			}
+		}
+	case *ast.FromImportStmt:
+		p.token(s.Keyword, "from ")
+		for _, dot := range s.Dots {
+			p.word(dot)
+		}
+		p.path(s.Path)
+		p.token(s.Import, " import ")
+		if s.Star.Source != nil {
+			p.word(s.Star)
+		}
+		for i, name := range s.Names {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.word(name)
+		}
+	case *ast.TryStmt:
+		p.token(s.Keyword, "try ")
+		p.block(s.Body)
+		for _, c := range s.Excepts {
+			p.token(c.Keyword, " except ")
+			p.word(c.Type)
+			p.token(c.As, " as ")
+			p.word(c.Name)
+			p.write(" ")
+			p.block(c.Body)
+		}
+		if s.Finally != nil {
+			p.token(s.FinallyTok, " finally ")
+			p.block(s.Finally)
+		}
+	case *ast.FuncStmt:
+		p.decorators(s.Decorators)
+		p.function(s.Func)
+	case *ast.ClassStmt:
+		p.decorators(s.Decorators)
+		p.class(s)
+	case *ast.ExportStmt:
+		switch d := s.Decl.(type) {
+		case *ast.FuncStmt:
+			p.decorators(d.Decorators)
+			p.token(s.Keyword, "export ")
+			p.function(d.Func)
+		case *ast.ClassStmt:
+			p.decorators(d.Decorators)
+			p.token(s.Keyword, "export ")
+			p.class(d)
+		default:
+			p.token(s.Keyword, "export ")
+			p.stmt(d)
+		}
+	}
+}
+
+// body writes the statement controlled by an if, else or loop header on
+// the header's line.
+func (p *printer) body(s ast.Stmt) {
+
+	p.write(" ")
+	p.stmt(s)
+}
+
+// paren writes a parenthesised condition.
+func (p *printer) paren(lparen ast.Token, x ast.Expr, rparen ast.Token) {
+
+	p.word(lparen)
+	p.expr(x)
+	p.word(rparen)
+}
+
+// path writes a dotted module name.
+func (p *printer) path(path []ast.Token) {
+
+	for i, t := range path {
+		if i > 0 {
+			p.write(".")
+		}
+		p.word(t)
+	}
+}
+
+func (p *printer) varStmt(s *ast.VarStmt) {
+
+	if s.Keyword.Source != nil {
+		p.word(s.Keyword)
+		p.write(" ")
+	}
+	p.word(s.Name)
+	p.annotation(s.Type)
+	if s.Value != nil {
+		p.token(s.Equal, " = ")
+		p.expr(s.Value)
+	}
+}
+
+func (p *printer) forStmt(s *ast.ForStmt) {
+
+	p.token(s.Keyword, "for ")
+	p.word(s.LParen)
+	switch init := s.Init.(type) {
+	case *ast.VarStmt:
+		p.varStmt(init)
+	case *ast.ExprStmt:
+		p.expr(init.X)
+	}
+	p.write(";")
+	if s.Cond != nil {
+		p.write(" ")
+		p.expr(s.Cond)
+	}
+	p.write(";")
+	if s.Incr != nil {
+		p.write(" ")
+		p.expr(s.Incr)
+	}
+	p.word(s.RParen)
+	p.body(s.Body)
+}
+
+// block writes a braced block over lines of its own, or `{}` if it holds
+// nothing.
+func (p *printer) block(b *ast.Block) {
+
+	p.word(b.LBrace)
+	if len(b.Stmts) == 0 && !p.hasComment(b.LBrace.Offset, b.RBrace.Offset) {
+		p.word(b.RBrace)
+		return
+	}
+	p.indent++
+	p.newline()
+	p.stmts(b.Stmts)
+	p.closing(b.RBrace.Offset, len(b.Stmts) == 0)
+	p.indent--
+	p.word(b.RBrace)
+}
+
+// decorators writes each decorator on a line of its own.
+func (p *printer) decorators(decorators []*ast.Decorator) {
+
+	for _, d := range decorators {
+		p.word(d.At)
+		p.expr(d.X)
+		p.newline()
+	}
+}
+
+// function writes a function declaration, method or lambda.
+func (p *printer) function(f *ast.Function) {
+
+	if f.Async.Source != nil {
+		p.token(f.Async, "async ")
+	}
+	if f.Keyword.Source != nil {
+		p.token(f.Keyword, "func")
+		if f.Name.Source != nil {
+			p.write(" ")
+		}
+	}
+	if f.Name.Source != nil {
+		p.word(f.Name)
+	}
+	p.list(f.LParen, len(f.Params), func(q *printer, i int) { q.param(f.Params[i]) }, f.RParen, true)
+	if f.Return != nil {
+		p.token(f.Return.Lead, " -> ")
+		p.typeText(f.Return)
+	}
+	p.write(" ")
+	p.block(f.Body)
+}
+
+func (p *printer) param(prm *ast.Param) {
+
+	if prm.Star.Source != nil {
+		p.word(prm.Star)
+	}
+	p.word(prm.Name)
+	p.annotation(prm.Type)
+	if prm.Default != nil {
+		p.token(prm.Equal, " = ")
+		p.expr(prm.Default)
+	}
+}
+
+// annotation writes an optional `: type`.
+func (p *printer) annotation(t *ast.TypeAnnotation) {
+
+	if t == nil {
+		return
+	}
+	p.token(t.Lead, ": ")
+	p.typeText(t)
+}
+
+// typeText writes the type of an annotation as written, without spaces
+// except after commas.
+func (p *printer) typeText(t *ast.TypeAnnotation) {
+
+	text := p.src[t.Lead.Offset+t.Lead.Width : t.Last.Offset+t.Last.Width]
+	text = strings.Join(strings.Fields(text), "")
+	p.flush(t.Lead.Offset + t.Lead.Width)
+	p.write(strings.ReplaceAll(text, ",", ", "))
+	p.lastEnd = t.Last.Offset + t.Last.Width
+}
+
+func (p *printer) class(s *ast.ClassStmt) {
+
+	p.token(s.Keyword, "class ")
+	p.word(s.Name)
+	if s.Super != nil {
+		p.token(s.Less, " < ")
+		p.word(s.Super.Name)
+	}
+	p.write(" ")
+	p.word(s.LBrace)
+	if len(s.Members) == 0 && !p.hasComment(s.LBrace.Offset, s.RBrace.Offset) {
+		p.word(s.RBrace)
+		return
+	}
+	p.indent++
+	p.newline()
+	for i, m := range s.Members {
+		p.leading(m.Pos().Offset, i == 0)
+		p.member(m)
+		p.newline()
+	}
+	p.closing(s.RBrace.Offset, len(s.Members) == 0)
+	p.indent--
+	p.word(s.RBrace)
+}
+
+func (p *printer) member(m ast.Member) {
+
+	switch m := m.(type) {
+	case *ast.Method:
+		p.decorators(m.Decorators)
+		if m.Static.Source != nil {
+			p.token(m.Static, "static ")
+		}
+		p.function(m.Func)
+	case *ast.Field:
+		p.word(m.Name)
+		p.annotation(m.Type)
+	case *ast.ClassVar:
+		p.token(m.Static, "static ")
+		p.word(m.Name)
+		p.annotation(m.Type)
+		if m.Value != nil {
+			p.token(m.Equal, " = ")
+			p.expr(m.Value)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Expressions.
+
+// synthetic reports whether the scanner made t from an interpolated string
+// (or one with `$$` escapes) rather than reading it from the source: such
+// tokens cover the whole literal.
+func synthetic(t ast.Token) bool {
+
+	return t.Width != t.Length
+}
+
+func (p *printer) expr(x ast.Expr) {
+
+	// An interpolated string is parsed as the expression it stands for;
+	// write the literal instead.
+	if from, to := x.Pos(), x.End(); synthetic(from) && synthetic(to) && from.Offset == to.Offset {
+		p.verbatim(from, to)
+		return
+	}
+
+	switch x := x.(type) {
+	case *ast.Literal:
+		p.word(x.Token)
+	case *ast.Variable:
+		p.word(x.Name)
+	case *ast.Assign:
+		p.expr(x.Target)
+		p.token(x.Op, " "+x.Op.Lexeme()+" ")
+		p.expr(x.Value)
+	case *ast.This:
+		p.word(x.Keyword)
+	case *ast.Super:
+		p.word(x.Keyword)
+		p.write(".")
+		p.word(x.Method)
+		if x.Args != nil {
+			p.args(x.Args)
+		}
+	case *ast.Unary:
+		p.word(x.Op)
+		p.expr(x.X)
+	case *ast.Binary:
+		p.expr(x.X)
+		p.token(x.Op, " "+x.Op.Lexeme()+" ")
+		p.expr(x.Y)
+	case *ast.Logical:
+		p.expr(x.X)
+		p.token(x.Op, " "+x.Op.Lexeme()+" ")
+		p.expr(x.Y)
+	case *ast.Conditional:
+		p.expr(x.Cond)
+		p.token(x.Question, " ? ")
+		p.expr(x.Then)
+		p.token(x.Colon, " : ")
+		p.expr(x.Else)
+	case *ast.Grouping:
+		p.paren(x.LParen, x.X, x.RParen)
+	case *ast.Tuple:
+		p.list(x.LParen, len(x.Elems), func(q *printer, i int) { q.expr(x.Elems[i]) }, x.RParen, false)
+	case *ast.Call:
+		p.expr(x.Callee)
+		p.args(x.Args)
+	case *ast.Property:
+		p.expr(x.Object)
+		p.write(".")
+		p.word(x.Name)
+	case *ast.Invoke:
+		p.expr(x.Object)
+		p.write(".")
+		p.word(x.Name)
+		p.args(x.Args)
+	case *ast.Index:
+		p.expr(x.Object)
+		p.word(x.LBracket)
+		p.expr(x.Index)
+		p.word(x.RBracket)
+	case *ast.Slice:
+		p.expr(x.Object)
+		p.word(x.LBracket)
+		if x.Low != nil {
+			p.expr(x.Low)
+		}
+		p.word(x.Colon)
+		if x.High != nil {
+			p.expr(x.High)
+		}
+		p.word(x.RBracket)
+	case *ast.List:
+		p.list(x.LBracket, len(x.Elems), func(q *printer, i int) { q.expr(x.Elems[i]) }, x.RBracket, true)
+	case *ast.Dict:
+		p.list(x.LBrace, len(x.Entries), func(q *printer, i int) {
+			e := x.Entries[i]
+			q.expr(e.Key)
+			q.token(e.Colon, ": ")
+			q.expr(e.Value)
+		}, x.RBrace, true)
+	case *ast.Lambda:
+		p.function(x.Func)
+	case *ast.Await:
+		p.token(x.Keyword, "await ")
+		p.expr(x.X)
+	case *ast.Str:
+		p.word(x.Keyword)
+		p.paren(x.LParen, x.X, x.RParen)
+	}
+}
+
+// args writes a call's argument list.
+func (p *printer) args(a *ast.ArgList) {
+
+	p.list(a.LParen, len(a.Args), func(q *printer, i int) {
+		if i == len(a.Args)-1 && a.Spread() {
+			q.word(a.Star)
+		}
+		q.expr(a.Args[i])
+	}, a.RParen, true)
+}
@@ -0,0 +1,174 @@
+package format
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"glox/src/compiler"
+	"glox/src/core"
+)
+
+func TestFormatLayout(t *testing.T) {
+	src := `// header
+
+var x=1;var y = [1,2,
+  3]
+fun add(a,b) { return a+b; }   // adds
+if (x>0) { print "pos"; } else print "neg";
+class A < B { init(n) { this.n=n; }
+  static count = 0; }
+`
+	want := `// header
+
+var x = 1
+var y = [1, 2, 3]
+func add(a, b) {
+    return a + b
+} // adds
+if (x > 0) {
+    print "pos"
+} else print "neg"
+class A < B {
+    init(n) {
+        this.n = n
+    }
+    static count = 0
+}
+`
+	got, diags := Source("t.lox", src)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatWrapsLongArguments(t *testing.T) {
+	src := "print f(" + strings.Repeat("argument_name, ", 8) + "last)\n"
+	got, _ := Source("t.lox", src)
+	want := "print f(\n" + strings.Repeat("    argument_name,\n", 8) + "    last\n)\n"
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatTrailingComments(t *testing.T) {
+	src := `var x = 1 +  // inner
+  2
+fun f(a, // first
+  b) { return a; }
+`
+	want := `var x = 1 + // inner
+    2
+func f(
+    a, // first
+    b
+) {
+    return a
+}
+`
+	got, _ := Source("t.lox", src)
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatKeepsInterpolatedStrings(t *testing.T) {
+	src := "print \"a ${x+1} b\" & 'c $$'\n"
+	if got, _ := Source("t.lox", src); got != src {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// Formatting every script in the corpus must be idempotent, keep every
+// comment and compile to the same code.
+
+func corpus(t *testing.T) []string {
+	var files []string
+	for _, root := range []string{"../../tests", "../../lox_examples"} {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, ".lox") {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	if len(files) == 0 {
+		t.Skip("no .lox corpus found")
+	}
+	return files
+}
+
+// code dumps a function's bytecode and constants without line numbers.
+func code(sb *strings.Builder, fn *core.FunctionObject) {
+	fmt.Fprintf(sb, "fn %q %d %d %v %d %q %q %v %v\n", fn.Name.Get(), fn.Arity, fn.MinArity, fn.IsVariadic,
+		fn.UpvalueCount, fn.ParamTypes, fn.ReturnType, fn.Chunk.Code, fn.Chunk.GlobalNames)
+	for _, k := range fn.Chunk.Constants {
+		if f, ok := k.Obj().(*core.FunctionObject); ok && k.IsObj() {
+			code(sb, f)
+			continue
+		}
+		fmt.Fprintf(sb, "%d %s\n", k.Type(), k.String())
+	}
+}
+
+func compile(path, source string) string {
+	fn, _ := compiler.Compile(path, source, "__main__")
+	if fn == nil {
+		return "<error>"
+	}
+	var sb strings.Builder
+	code(&sb, fn)
+	return sb.String()
+}
+
+func commentTexts(source string) []string {
+	var texts []string
+	for _, c := range findComments(compiler.NewScanner(source)) {
+		texts = append(texts, c.text)
+	}
+	return texts
+}
+
+func TestFormatCorpus(t *testing.T) {
+	core.DebugSuppress = true
+	defer func() { core.DebugSuppress = false }()
+
+	for _, path := range corpus(t) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, diags := Source(path, string(src))
+		if compiler.HasErrors(diags) {
+			continue
+		}
+		if again, _ := Source(path, out); again != out {
+			t.Errorf("%s: formatting is not idempotent\n%s", path, firstDifference(out, again))
+			continue
+		}
+		if w, g := compile(path, string(src)), compile(path, out); w != g {
+			t.Errorf("%s: formatted code compiles differently\n%s", path, firstDifference(w, g))
+			continue
+		}
+		if w, g := strings.Join(commentTexts(string(src)), "\n"), strings.Join(commentTexts(out), "\n"); w != g {
+			t.Errorf("%s: comments differ\n%s", path, firstDifference(w, g))
+		}
+	}
+}
+
+// firstDifference shows the first line at which two texts disagree.
+func firstDifference(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wl) && i < len(gl); i++ {
+		if wl[i] != gl[i] {
+			return fmt.Sprintf("line %d\nwant: %s\n got: %s", i+1, wl[i], gl[i])
+		}
+	}
+	return fmt.Sprintf("lengths differ: %d vs %d lines", len(wl), len(gl))
+}
@@ -0,0 +1,691 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"glox/src/ast"
+	"glox/src/compiler"
+	"glox/src/core"
+)
+
+//-----------------------------------------------------------------------------
+// Hover.
+
+// hover describes the name at offset: a function's signature and arity, a
+// class's constructor, a variable's declaration or a module's file.
+func (s *Server) hover(doc *document, offset int) *Hover {
+
+	sym, tok := s.symbolAt(doc, offset)
+	if sym == nil {
+		return nil
+	}
+	r := doc.tokenRange(tok)
+	return &Hover{Contents: markupContent{Kind: "markdown", Value: s.describe(sym)}, Range: &r}
+}
+
+// describe renders a symbol as a Lox code block followed by a note.
+func (s *Server) describe(sym *symbol) string {
+
+	block := func(code, note string) string {
+		rv := "```lox\n" + code + "\n```"
+		if note != "" {
+			rv += "\n\n" + note
+		}
+		return rv
+	}
+
+	switch {
+	case sym.module != "" && sym.builtin:
+		return block("module "+sym.module, "Built-in module.")
+	case sym.module != "":
+		return block("module "+sym.module, sym.doc.path)
+	case sym.builtin:
+		sig := s.env.Signatures[sym.name]
+		if sig == "" {
+			return block(sym.name, "Built-in.")
+		}
+		note := "Built-in."
+		if parsed, err := compiler.ParseSignature(sym.name, sig); err == nil {
+			minArgs := 0
+			for i, prm := range parsed.Params {
+				if !prm.HasDefault && !(parsed.Variadic && i == len(parsed.Params)-1) {
+					minArgs++
+				}
+			}
+			maxArgs := len(parsed.Params)
+			if parsed.Variadic {
+				maxArgs--
+			}
+			note = "Built-in. Takes " + arity(minArgs, maxArgs, parsed.Variadic) + "."
+		}
+		return block("func "+sym.name+sig, note)
+	}
+
+	text := sym.doc.text
+	switch n := sym.node.(type) {
+	case *ast.Function:
+		code := signature(text, n)
+		if n.Kind == ast.FuncFunction {
+			code = "func " + code
+		}
+		return block(code, "Takes "+functionArity(n)+".")
+	case *ast.ClassStmt:
+		code := "class " + n.Name.Lexeme()
+		if n.Super != nil {
+			code += " < " + n.Super.Name.Lexeme()
+		}
+		for _, m := range n.Members {
+			if m, ok := m.(*ast.Method); ok && m.Func.Name.Lexeme() == "init" && m.Static.Source == nil {
+				return block(code+"\n"+signature(text, m.Func), "The constructor takes "+functionArity(m.Func)+".")
+			}
+		}
+		return block(code, "")
+	case *ast.VarStmt:
+		code := "var "
+		if n.Const {
+			code = "const "
+		}
+		code += n.Name.Lexeme() + annotation(text, n.Type)
+		if n.Value != nil {
+			if v := source(text, n.Value); len(v) <= 60 && !strings.Contains(v, "\n") {
+				code += " = " + v
+			}
+		}
+		return block(code, "")
+	case *ast.Param:
+		return block("(parameter) "+param(text, n), "")
+	case *ast.Field:
+		return block("(field) "+n.Name.Lexeme()+annotation(text, n.Type), "")
+	case *ast.ClassVar:
+		code := "static " + n.Name.Lexeme() + annotation(text, n.Type)
+		if n.Value != nil {
+			if v := source(text, n.Value); len(v) <= 60 && !strings.Contains(v, "\n") {
+				code += " = " + v
+			}
+		}
+		return block(code, "")
+	}
+	return block("var "+sym.name, "")
+}
+
+// signature renders a function's name, parameters and return type as
+// written, defaults included.
+func signature(text string, f *ast.Function) string {
+
+	var params []string
+	for _, prm := range f.Params {
+		params = append(params, param(text, prm))
+	}
+	rv := f.Name.Lexeme() + "(" + strings.Join(params, ", ") + ")"
+	if f.Name.Source == nil {
+		rv = "func" + rv[len(f.Name.Lexeme()):]
+	}
+	if f.Return != nil {
+		rv += " -> " + typeText(text, f.Return)
+	}
+	return rv
+}
+
+func param(text string, prm *ast.Param) string {
+
+	rv := prm.Name.Lexeme() + annotation(text, prm.Type)
+	if prm.Star.Source != nil {
+		rv = "*" + rv
+	}
+	if prm.Default != nil {
+		rv += " = " + source(text, prm.Default)
+	}
+	return rv
+}
+
+// functionArity describes how many arguments f takes.
+func functionArity(f *ast.Function) string {
+
+	minArgs, maxArgs, variadic := 0, 0, false
+	for _, prm := range f.Params {
+		switch {
+		case prm.Star.Source != nil:
+			variadic = true
+		case prm.Default == nil:
+			minArgs++
+			maxArgs++
+		default:
+			maxArgs++
+		}
+	}
+	return arity(minArgs, maxArgs, variadic)
+}
+
+// arity describes an argument count range, "1 to 3 arguments"; maxArgs
+// excludes a variadic tail.
+func arity(minArgs, maxArgs int, variadic bool) string {
+
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case variadic && minArgs == 0:
+		return "any number of arguments"
+	case variadic:
+		return "at least " + plural(minArgs)
+	case maxArgs == 0:
+		return "no arguments"
+	case minArgs == maxArgs:
+		return plural(minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+}
+
+func annotation(text string, t *ast.TypeAnnotation) string {
+
+	if t == nil {
+		return ""
+	}
+	return ": " + typeText(text, t)
+}
+
+// typeText is the source of an annotation's type, after its ':' or '->'.
+func typeText(text string, t *ast.TypeAnnotation) string {
+
+	from, to := t.Lead.Offset+t.Lead.Width, t.Last.Offset+t.Last.Width
+	if from > to || to > len(text) {
+		return ""
+	}
+	return strings.TrimSpace(text[from:to])
+}
+
+// source is the text a node was parsed from.
+func source(text string, n ast.Node) string {
+
+	from, end := n.Pos().Offset, n.End()
+	to := end.Offset + end.Width
+	if from > to || to > len(text) {
+		return ""
+	}
+	return strings.TrimSpace(text[from:to])
+}
+
+//-----------------------------------------------------------------------------
+// Go to definition.
+
+// definition returns where the name at offset is declared, which may be in
+// another file: imported names are followed into the module they came from.
+func (s *Server) definition(doc *document, offset int) *Location {
+
+	sym, _ := s.symbolAt(doc, offset)
+	if sym == nil || sym.doc == nil {
+		return nil
+	}
+	loc := &Location{URI: sym.doc.uri}
+	if sym.decl.Source != nil {
+		loc.Range = sym.doc.tokenRange(sym.decl)
+	}
+	return loc
+}
+
+//-----------------------------------------------------------------------------
+// Completion.
+
+// completion offers the names that may follow offset: after a '.', the
+// members of the module, class or native object before it, otherwise the
+// names in scope, builtins and keywords, or after `import`, module names.
+func (s *Server) completion(doc *document, offset int) []CompletionItem {
+
+	start := offset
+	for start > 0 && isIdentChar(doc.text[start-1]) {
+		start--
+	}
+	prefix := doc.text[start:offset]
+	lineStart := strings.LastIndexByte(doc.text[:start], '\n') + 1
+	line := strings.Fields(doc.text[lineStart:start])
+
+	var items []CompletionItem
+	switch {
+	case start > 0 && doc.text[start-1] == '.':
+		items = s.memberCompletions(doc, start-1)
+	case len(line) > 0 && line[0] == "import", len(line) == 1 && line[0] == "from":
+		items = s.moduleCompletions(doc)
+	case len(line) >= 3 && line[0] == "from" && line[2] == "import":
+		if mod := s.module(doc, line[1]); mod != nil {
+			items = s.moduleMembers(mod)
+		}
+	default:
+		items = s.scopeCompletions(doc, offset)
+	}
+
+	seen := map[string]bool{}
+	rv := []CompletionItem{}
+	for _, item := range items {
+		if strings.HasPrefix(item.Label, prefix) && !seen[item.Label] {
+			seen[item.Label] = true
+			rv = append(rv, item)
+		}
+	}
+	sort.SliceStable(rv, func(i, j int) bool { return rv[i].Label < rv[j].Label })
+	return rv
+}
+
+func isIdentChar(c byte) bool {
+
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// memberCompletions offers the members of whatever precedes the '.' at
+// dot. When that cannot be told, every native method and every member of
+// the document's classes is offered.
+func (s *Server) memberCompletions(doc *document, dot int) []CompletionItem {
+
+	before := doc.text[:dot]
+	switch {
+	case strings.HasSuffix(before, `"`), strings.HasSuffix(before, "'"):
+		return methodItems(core.OBJECT_STRING)
+	case strings.HasSuffix(before, "]"):
+		return methodItems(core.OBJECT_LIST)
+	case strings.HasSuffix(before, "}"):
+		return methodItems(core.OBJECT_DICT)
+	}
+
+	start := dot
+	for start > 0 && isIdentChar(doc.text[start-1]) {
+		start--
+	}
+	name := doc.text[start:dot]
+	if name != "" && (start == 0 || doc.text[start-1] != '.') {
+		if name == "this" {
+			if cls := enclosingClass(nodesAt(doc.script, dot)); cls != nil {
+				return s.classItems(&symbol{name: cls.Name.Lexeme(), doc: doc, node: cls}, 0)
+			}
+		}
+		sym := s.visible(doc, dot)[name]
+		if sym == nil {
+			sym = s.global(doc, name, 0)
+		}
+		if items, ok := s.symbolMembers(sym); ok {
+			return items
+		}
+	}
+
+	items := append(methodItems(core.OBJECT_STRING), methodItems(core.OBJECT_LIST)...)
+	items = append(items, methodItems(core.OBJECT_DICT)...)
+	for _, stmt := range doc.script.Stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if cls, ok := n.(*ast.ClassStmt); ok {
+				items = append(items, memberItems(cls)...)
+			}
+			return true
+		})
+	}
+	return items
+}
+
+// symbolMembers returns the members of a module, a class, or a variable
+// initialised with a literal or by constructing a class, and whether sym
+// was one of those.
+func (s *Server) symbolMembers(sym *symbol) ([]CompletionItem, bool) {
+
+	switch {
+	case sym == nil:
+		return nil, false
+	case sym.module != "":
+		return s.moduleMembers(sym), true
+	case sym.doc == nil:
+		return nil, false
+	}
+	switch n := sym.node.(type) {
+	case *ast.ClassStmt:
+		return s.classItems(sym, 0), true
+	case *ast.VarStmt:
+		switch v := n.Value.(type) {
+		case *ast.Literal:
+			if v.Token.Tokentype == compiler.TOKEN_STRING {
+				return methodItems(core.OBJECT_STRING), true
+			}
+		case *ast.Str:
+			return methodItems(core.OBJECT_STRING), true
+		case *ast.List:
+			return methodItems(core.OBJECT_LIST), true
+		case *ast.Dict:
+			return methodItems(core.OBJECT_DICT), true
+		case *ast.Call:
+			if callee, ok := v.Callee.(*ast.Variable); ok {
+				if cls := s.global(sym.doc, callee.Name.Lexeme(), 0); cls != nil {
+					if _, ok := cls.node.(*ast.ClassStmt); ok {
+						return s.classItems(cls, 0), true
+					}
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// moduleMembers lists what a module exports: the members of a built-in
+// module, or the top-level declarations of a Lox module, restricted to its
+// `export`ed names if it has any and otherwise to names without a leading
+// underscore.
+func (s *Server) moduleMembers(mod *symbol) []CompletionItem {
+
+	var items []CompletionItem
+	if mod.builtin {
+		for key, sig := range s.env.Signatures {
+			if name, ok := strings.CutPrefix(key, mod.module+"."); ok {
+				kind := completionFunction
+				if sig == "" {
+					kind = completionVariable
+				}
+				items = append(items, CompletionItem{Label: name, Kind: kind, Detail: sig})
+			}
+		}
+		return items
+	}
+
+	exported := false
+	for _, stmt := range mod.doc.script.Stmts {
+		if _, ok := stmt.(*ast.ExportStmt); ok {
+			exported = true
+		}
+	}
+	for _, stmt := range mod.doc.script.Stmts {
+		e, isExport := stmt.(*ast.ExportStmt)
+		if exported && !isExport {
+			continue
+		}
+		if isExport {
+			stmt = e.Decl
+		}
+		for _, item := range declarationItems(mod.doc.text, stmt) {
+			if exported || !strings.HasPrefix(item.Label, "_") {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// classItems lists the members of a class and its superclasses.
+func (s *Server) classItems(cls *symbol, depth int) []CompletionItem {
+
+	c, ok := cls.node.(*ast.ClassStmt)
+	if !ok || depth > maxImportDepth {
+		return nil
+	}
+	items := memberItems(c)
+	if c.Super != nil {
+		if sup := s.global(cls.doc, c.Super.Name.Lexeme(), 0); sup != nil {
+			items = append(items, s.classItems(sup, depth+1)...)
+		}
+	}
+	return items
+}
+
+func memberItems(cls *ast.ClassStmt) []CompletionItem {
+
+	var items []CompletionItem
+	for _, m := range cls.Members {
+		switch m := m.(type) {
+		case *ast.Method:
+			items = append(items, CompletionItem{Label: m.Func.Name.Lexeme(), Kind: completionMethod, Detail: cls.Name.Lexeme()})
+		case *ast.Field:
+			items = append(items, CompletionItem{Label: m.Name.Lexeme(), Kind: completionField, Detail: cls.Name.Lexeme()})
+		case *ast.ClassVar:
+			items = append(items, CompletionItem{Label: m.Name.Lexeme(), Kind: completionField, Detail: cls.Name.Lexeme()})
+		}
+	}
+	return items
+}
+
+func methodItems(t core.ObjectType) []CompletionItem {
+
+	detail := map[core.ObjectType]string{core.OBJECT_STRING: "string", core.OBJECT_LIST: "list", core.OBJECT_DICT: "dict"}[t]
+	var items []CompletionItem
+	for _, name := range core.MethodNames(t) {
+		items = append(items, CompletionItem{Label: name, Kind: completionMethod, Detail: detail})
+	}
+	return items
+}
+
+// declarationItems lists the names a statement declares.
+func declarationItems(text string, stmt ast.Stmt) []CompletionItem {
+
+	switch st := stmt.(type) {
+	case *ast.FuncStmt:
+		return []CompletionItem{{Label: st.Func.Name.Lexeme(), Kind: completionFunction, Detail: signature(text, st.Func)}}
+	case *ast.ClassStmt:
+		return []CompletionItem{{Label: st.Name.Lexeme(), Kind: completionClass}}
+	case *ast.VarStmt:
+		return []CompletionItem{{Label: st.Name.Lexeme(), Kind: completionVariable}}
+	case *ast.ExprStmt:
+		if a, ok := st.X.(*ast.Assign); ok && a.Declares {
+			if v, ok := a.Target.(*ast.Variable); ok {
+				return []CompletionItem{{Label: v.Name.Lexeme(), Kind: completionVariable}}
+			}
+		}
+	case *ast.UnpackStmt:
+		var items []CompletionItem
+		for i, name := range st.Names {
+			if i < len(st.Declares) && st.Declares[i] {
+				items = append(items, CompletionItem{Label: name.Lexeme(), Kind: completionVariable})
+			}
+		}
+		return items
+	}
+	return nil
+}
+
+// visible returns the locals in scope at offset, innermost last so that it
+// shadows, keyed by name. Only declarations made before offset count.
+func (s *Server) visible(doc *document, offset int) map[string]*symbol {
+
+	rv := map[string]*symbol{}
+	add := func(tok ast.Token, node any) {
+		if tok.Source != nil && tok.Offset < offset {
+			rv[tok.Lexeme()] = &symbol{name: tok.Lexeme(), doc: doc, decl: tok, node: node}
+		}
+	}
+	declare := func(stmt ast.Stmt) {
+		switch st := stmt.(type) {
+		case *ast.FuncStmt:
+			add(st.Func.Name, st.Func)
+		case *ast.ClassStmt:
+			add(st.Name, st)
+		case *ast.VarStmt:
+			add(st.Name, st)
+		case *ast.ExprStmt:
+			if a, ok := st.X.(*ast.Assign); ok && a.Declares {
+				if v, ok := a.Target.(*ast.Variable); ok {
+					add(v.Name, a)
+				}
+			}
+		case *ast.UnpackStmt:
+			for i, name := range st.Names {
+				if i < len(st.Declares) && st.Declares[i] {
+					add(name, st)
+				}
+			}
+		}
+	}
+
+	for _, n := range nodesAt(doc.script, offset) {
+		switch n := n.(type) {
+		case *ast.Function:
+			for _, prm := range n.Params {
+				add(prm.Name, prm)
+			}
+		case *ast.Block:
+			for _, stmt := range n.Stmts {
+				declare(stmt)
+			}
+		case *ast.ForStmt:
+			if n.Init != nil {
+				declare(n.Init)
+			}
+		case *ast.ForeachStmt:
+			declare(n.Var)
+		case *ast.TryStmt:
+			for _, c := range n.Excepts {
+				if spans(c.Body, offset) {
+					add(c.Name, c)
+				}
+			}
+		}
+	}
+	return rv
+}
+
+// scopeCompletions offers the globals of the document, the locals in scope
+// at offset, the native builtins and the keywords.
+func (s *Server) scopeCompletions(doc *document, offset int) []CompletionItem {
+
+	var items []CompletionItem
+	locals := s.visible(doc, offset)
+	for name, sym := range locals {
+		kind := completionVariable
+		switch sym.node.(type) {
+		case *ast.Function:
+			kind = completionFunction
+		case *ast.ClassStmt:
+			kind = completionClass
+		}
+		items = append(items, CompletionItem{Label: name, Kind: kind})
+	}
+	for _, stmt := range doc.script.Stmts {
+		if e, ok := stmt.(*ast.ExportStmt); ok {
+			stmt = e.Decl
+		}
+		items = append(items, declarationItems(doc.text, stmt)...)
+		switch st := stmt.(type) {
+		case *ast.ImportStmt:
+			for _, m := range st.Modules {
+				if m.Alias.Source != nil {
+					items = append(items, CompletionItem{Label: m.Alias.Lexeme(), Kind: completionModule})
+				} else {
+					items = append(items, CompletionItem{Label: m.Path[0].Lexeme(), Kind: completionModule})
+				}
+			}
+		case *ast.FromImportStmt:
+			for _, name := range st.Names {
+				items = append(items, CompletionItem{Label: name.Lexeme(), Kind: completionVariable})
+			}
+		}
+	}
+	for name, sig := range s.env.Signatures {
+		if !strings.Contains(name, ".") {
+			items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: sig})
+		}
+	}
+	for _, kw := range compiler.Keywords() {
+		items = append(items, CompletionItem{Label: kw, Kind: completionKeyword})
+	}
+	return items
+}
+
+// moduleCompletions offers the built-in modules and the modules and
+// packages next to the document.
+func (s *Server) moduleCompletions(doc *document) []CompletionItem {
+
+	var items []CompletionItem
+	for key := range s.env.Signatures {
+		if mod, _, ok := strings.Cut(key, "."); ok {
+			items = append(items, CompletionItem{Label: mod, Kind: completionModule, Detail: "built-in"})
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(doc.path))
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir() && name != "__loxcache__" && !strings.HasPrefix(name, "."):
+			items = append(items, CompletionItem{Label: name, Kind: completionModule})
+		case !e.IsDir() && strings.HasSuffix(name, ".lox") && name != filepath.Base(doc.path):
+			items = append(items, CompletionItem{Label: strings.TrimSuffix(name, ".lox"), Kind: completionModule})
+		}
+	}
+	return items
+}
+
+//-----------------------------------------------------------------------------
+// Document symbols.
+
+// documentSymbols outlines the classes and functions of a document, with
+// each class's members and the functions and classes declared inside each
+// function.
+func documentSymbols(doc *document) []DocumentSymbol {
+
+	return doc.symbols(doc.script.Stmts)
+}
+
+func (d *document) symbols(stmts []ast.Stmt) []DocumentSymbol {
+
+	rv := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		if e, ok := stmt.(*ast.ExportStmt); ok {
+			stmt = e.Decl
+		}
+		switch st := stmt.(type) {
+		case *ast.FuncStmt:
+			rv = append(rv, d.functionSymbol(st, st.Func, symbolFunction))
+		case *ast.ClassStmt:
+			sym := DocumentSymbol{
+				Name:           st.Name.Lexeme(),
+				Kind:           symbolClass,
+				Range:          d.nodeRange(st),
+				SelectionRange: d.tokenRange(st.Name),
+			}
+			if st.Super != nil {
+				sym.Detail = "< " + st.Super.Name.Lexeme()
+			}
+			for _, m := range st.Members {
+				switch m := m.(type) {
+				case *ast.Method:
+					sym.Children = append(sym.Children, d.functionSymbol(m, m.Func, symbolMethod))
+				case *ast.Field:
+					sym.Children = append(sym.Children, DocumentSymbol{Name: m.Name.Lexeme(), Kind: symbolField, Range: d.nodeRange(m), SelectionRange: d.tokenRange(m.Name)})
+				case *ast.ClassVar:
+					sym.Children = append(sym.Children, DocumentSymbol{Name: m.Name.Lexeme(), Kind: symbolField, Detail: "static", Range: d.nodeRange(m), SelectionRange: d.tokenRange(m.Name)})
+				}
+			}
+			rv = append(rv, sym)
+		default:
+			// functions and classes declared in nested blocks
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.Function:
+					return false
+				case *ast.FuncStmt, *ast.ClassStmt:
+					rv = append(rv, d.symbols([]ast.Stmt{n.(ast.Stmt)})...)
+					return false
+				case *ast.Block:
+					rv = append(rv, d.symbols(n.Stmts)...)
+					return false
+				}
+				return true
+			})
+		}
+	}
+	return rv
+}
+
+func (d *document) functionSymbol(decl ast.Node, f *ast.Function, kind int) DocumentSymbol {
+
+	sig := signature(d.text, f)
+	return DocumentSymbol{
+		Name:           f.Name.Lexeme(),
+		Detail:         sig[len(f.Name.Lexeme()):],
+		Kind:           kind,
+		Range:          d.nodeRange(decl),
+		SelectionRange: d.tokenRange(f.Name),
+		Children:       d.symbols(f.Body.Stmts),
+	}
+}
+
+func (d *document) nodeRange(n ast.Node) Range {
+
+	pos, end := n.Pos(), n.End()
+	return Range{Start: d.position(pos.Offset), End: d.position(end.Offset + end.Width)}
+}
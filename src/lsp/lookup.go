@@ -0,0 +1,504 @@
+package lsp
+
+import (
+	"os"
+	"strings"
+
+	"glox/src/ast"
+	"glox/src/compiler"
+)
+
+// Name lookup.
+//
+// The resolver has already bound every local and upvalue, so those lead
+// straight to their declaration. Globals are found by name among the
+// top-level declarations, and an imported name is followed into the module
+// it came from, resolved as the VM would resolve the import.
+
+// symbol is what a name refers to: a declaration in a Lox file, a module,
+// or a native builtin.
+type symbol struct {
+	name    string
+	doc     *document // the file declaring it; for a module, the module's file
+	decl    ast.Token // the declaring identifier, absent for a module or builtin
+	node    any       // the declaration: *ast.Function, *ast.ClassStmt, *ast.VarStmt, *ast.Param, ...
+	module  string    // the module name, for a module
+	builtin bool      // a native builtin ("len", "sys.clock") or built-in module
+}
+
+// maxImportDepth bounds how far a name is followed through modules that
+// import it from others, which may import each other in a cycle.
+const maxImportDepth = 8
+
+// load returns the document for a Lox file: the open one if the editor
+// has it, otherwise the file as it is on disk.
+func (s *Server) load(path string) *document {
+
+	for _, doc := range s.docs {
+		if doc.path == path {
+			return doc
+		}
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return newDocument(pathToURI(path), path, string(text))
+}
+
+// nodesAt returns the nodes of script whose source spans offset, from the
+// outermost statement to the innermost node.
+func nodesAt(script *ast.Script, offset int) []ast.Node {
+
+	var path []ast.Node
+	for _, stmt := range script.Stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if !spans(n, offset) {
+				return false
+			}
+			path = append(path, n)
+			return true
+		})
+	}
+	return path
+}
+
+// spans reports whether offset lies within n or just after its end.
+func spans(n ast.Node, offset int) bool {
+
+	pos, end := n.Pos(), n.End()
+	return pos.Source != nil && pos.Offset <= offset && offset <= end.Offset+end.Width
+}
+
+// at reports whether offset lies within the identifier tok or just after
+// it, where the cursor is left after typing it.
+func at(tok ast.Token, offset int) bool {
+
+	return tok.Source != nil && tok.Tokentype == compiler.TOKEN_IDENTIFIER &&
+		tok.Offset <= offset && offset <= tok.Offset+tok.Width
+}
+
+// symbolAt returns what the name at offset refers to, and the name's token.
+func (s *Server) symbolAt(doc *document, offset int) (*symbol, ast.Token) {
+
+	path := nodesAt(doc.script, offset)
+	for i := len(path) - 1; i >= 0; i-- {
+		if sym, tok, ok := s.nodeSymbol(doc, path[:i+1], offset); ok {
+			return sym, tok
+		}
+	}
+	return nil, ast.Token{}
+}
+
+// nodeSymbol looks for a name at offset among the tokens of the innermost
+// node of path. ok is set if one is there, even if what it refers to is
+// not known.
+func (s *Server) nodeSymbol(doc *document, path []ast.Node, offset int) (sym *symbol, tok ast.Token, ok bool) {
+
+	declared := func(tok ast.Token, node any) (*symbol, ast.Token, bool) {
+		return &symbol{name: tok.Lexeme(), doc: doc, decl: tok, node: node}, tok, true
+	}
+
+	switch n := path[len(path)-1].(type) {
+	case *ast.Variable:
+		if at(n.Name, offset) {
+			return s.bindingSymbol(doc, path, n.Name, n.Binding), n.Name, true
+		}
+	case *ast.Property:
+		if at(n.Name, offset) {
+			return s.memberSymbol(doc, path, n.Object, n.Name.Lexeme()), n.Name, true
+		}
+	case *ast.Invoke:
+		if at(n.Name, offset) {
+			return s.memberSymbol(doc, path, n.Object, n.Name.Lexeme()), n.Name, true
+		}
+	case *ast.Super:
+		if at(n.Method, offset) {
+			if cls := enclosingClass(path); cls != nil && cls.Super != nil {
+				if sup := s.global(doc, cls.Super.Name.Lexeme(), 0); sup != nil {
+					return s.classMember(sup, n.Method.Lexeme(), 0), n.Method, true
+				}
+			}
+			return nil, n.Method, true
+		}
+	case *ast.Function:
+		if at(n.Name, offset) {
+			return declared(n.Name, n)
+		}
+		for _, prm := range n.Params {
+			if at(prm.Name, offset) {
+				return declared(prm.Name, prm)
+			}
+		}
+	case *ast.ClassStmt:
+		if at(n.Name, offset) {
+			return declared(n.Name, n)
+		}
+	case *ast.ClassVar:
+		if at(n.Name, offset) {
+			return declared(n.Name, n)
+		}
+	case *ast.Field:
+		if at(n.Name, offset) {
+			return declared(n.Name, n)
+		}
+	case *ast.VarStmt:
+		if at(n.Name, offset) {
+			return declared(n.Name, n)
+		}
+	case *ast.UnpackStmt:
+		for i, name := range n.Names {
+			if at(name, offset) {
+				return s.bindingSymbol(doc, path, name, n.Bindings[i]), name, true
+			}
+		}
+	case *ast.ImportStmt:
+		for _, m := range n.Modules {
+			for i, part := range m.Path {
+				if at(part, offset) {
+					return s.module(doc, moduleName(nil, m.Path[:i+1])), part, true
+				}
+			}
+			if at(m.Alias, offset) {
+				return s.module(doc, moduleName(nil, m.Path)), m.Alias, true
+			}
+		}
+	case *ast.FromImportStmt:
+		for i, part := range n.Path {
+			if at(part, offset) {
+				return s.module(doc, moduleName(n.Dots, n.Path[:i+1])), part, true
+			}
+		}
+		for _, name := range n.Names {
+			if at(name, offset) {
+				return s.member(doc, moduleName(n.Dots, n.Path), name.Lexeme(), 0), name, true
+			}
+		}
+	case *ast.TryStmt:
+		for _, c := range n.Excepts {
+			if at(c.Type, offset) {
+				return s.global(doc, c.Type.Lexeme(), 0), c.Type, true
+			}
+			if at(c.Name, offset) {
+				return declared(c.Name, c)
+			}
+		}
+	}
+	return nil, ast.Token{}, false
+}
+
+// bindingSymbol returns the declaration a resolved name refers to.
+func (s *Server) bindingSymbol(doc *document, path []ast.Node, name ast.Token, b ast.Binding) *symbol {
+
+	switch b.Kind {
+	case ast.Local:
+		return localSymbol(doc, b.Decl)
+	case ast.Upvalue:
+		return localSymbol(doc, capturedDecl(path, b.Index))
+	}
+	return s.global(doc, name.Lexeme(), 0)
+}
+
+func localSymbol(doc *document, d *ast.Decl) *symbol {
+
+	if d == nil || d.Token.Source == nil {
+		return nil
+	}
+	return &symbol{name: d.Name, doc: doc, decl: d.Token, node: declaration(doc.script, d.Token.Offset)}
+}
+
+// capturedDecl follows upvalue index of the innermost function of path out
+// through the enclosing functions to the local it captures.
+func capturedDecl(path []ast.Node, index int) *ast.Decl {
+
+	var funcs []*ast.Function
+	for _, n := range path {
+		if f, ok := n.(*ast.Function); ok {
+			funcs = append(funcs, f)
+		}
+	}
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if index < 0 || index >= len(funcs[i].Captures) {
+			return nil
+		}
+		c := funcs[i].Captures[index]
+		if c.Local {
+			return c.Decl
+		}
+		index = c.Index
+	}
+	return nil
+}
+
+// declaration finds the node that declares the identifier at offset.
+func declaration(script *ast.Script, offset int) any {
+
+	var found any
+	for _, stmt := range script.Stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if found != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.Function:
+				if n.Name.Source != nil && n.Name.Offset == offset {
+					found = n
+				}
+				for _, prm := range n.Params {
+					if prm.Name.Offset == offset {
+						found = prm
+					}
+				}
+			case *ast.ClassStmt:
+				if n.Name.Offset == offset {
+					found = n
+				}
+			case *ast.VarStmt:
+				if n.Name.Offset == offset {
+					found = n
+				}
+			case *ast.TryStmt:
+				for _, c := range n.Excepts {
+					if c.Name.Source != nil && c.Name.Offset == offset {
+						found = c
+					}
+				}
+			}
+			return found == nil
+		})
+	}
+	return found
+}
+
+// global returns what the global name refers to in doc: a top-level
+// declaration, followed through imports, or else a native builtin.
+func (s *Server) global(doc *document, name string, depth int) *symbol {
+
+	if sym := s.topLevel(doc, name, depth); sym != nil {
+		return sym
+	}
+	if _, ok := s.env.Signatures[name]; ok {
+		return &symbol{name: name, builtin: true}
+	}
+	return nil
+}
+
+// topLevel finds the top-level declaration of name in doc. A name bound by
+// an import is followed to the module or the declaration it was imported
+// from.
+func (s *Server) topLevel(doc *document, name string, depth int) *symbol {
+
+	for _, stmt := range doc.script.Stmts {
+		if e, ok := stmt.(*ast.ExportStmt); ok {
+			stmt = e.Decl
+		}
+		switch st := stmt.(type) {
+		case *ast.FuncStmt:
+			if st.Func.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: st.Func.Name, node: st.Func}
+			}
+		case *ast.ClassStmt:
+			if st.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: st.Name, node: st}
+			}
+		case *ast.VarStmt:
+			if st.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: st.Name, node: st}
+			}
+		case *ast.ExprStmt:
+			if a, ok := st.X.(*ast.Assign); ok && a.Declares {
+				if v, ok := a.Target.(*ast.Variable); ok && v.Name.Lexeme() == name {
+					return &symbol{name: name, doc: doc, decl: v.Name, node: a}
+				}
+			}
+		case *ast.UnpackStmt:
+			for i, tok := range st.Names {
+				if i < len(st.Declares) && st.Declares[i] && tok.Lexeme() == name {
+					return &symbol{name: name, doc: doc, decl: tok, node: st}
+				}
+			}
+		case *ast.ImportStmt:
+			for _, m := range st.Modules {
+				switch {
+				case m.Alias.Source != nil && m.Alias.Lexeme() == name:
+					return s.module(doc, moduleName(nil, m.Path))
+				case m.Alias.Source == nil && m.Path[0].Lexeme() == name:
+					// `import a.b` binds the top-level package a
+					return s.module(doc, name)
+				}
+			}
+		case *ast.FromImportStmt:
+			for _, tok := range st.Names {
+				if tok.Lexeme() != name {
+					continue
+				}
+				if sym := s.member(doc, moduleName(st.Dots, st.Path), name, depth+1); sym != nil {
+					return sym
+				}
+				return &symbol{name: name, doc: doc, decl: tok}
+			}
+		}
+	}
+	return nil
+}
+
+// module returns the module an import of name from doc loads.
+func (s *Server) module(doc *document, name string) *symbol {
+
+	if s.isBuiltInModule(name) {
+		return &symbol{name: name, module: name, builtin: true}
+	}
+	if s.env.FindModule == nil {
+		return nil
+	}
+	file, ok := s.env.FindModule(doc.path, name)
+	if !ok {
+		return nil
+	}
+	mod := s.load(file)
+	if mod == nil {
+		return nil
+	}
+	return &symbol{name: name, doc: mod, module: name}
+}
+
+func (s *Server) isBuiltInModule(name string) bool {
+
+	for key := range s.env.Signatures {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// member returns the member name of the module imported as modName from
+// doc: a top-level declaration of the module's file, a member of a built-in
+// module, or a submodule of a package.
+func (s *Server) member(doc *document, modName, name string, depth int) *symbol {
+
+	if depth > maxImportDepth {
+		return nil
+	}
+	if s.isBuiltInModule(modName) {
+		if _, ok := s.env.Signatures[modName+"."+name]; ok {
+			return &symbol{name: modName + "." + name, builtin: true}
+		}
+		return nil
+	}
+	if mod := s.module(doc, modName); mod != nil {
+		if sym := s.topLevel(mod.doc, name, depth); sym != nil {
+			return sym
+		}
+	}
+	sub := modName + "." + name
+	if strings.TrimLeft(modName, ".") == "" {
+		sub = modName + name // from . import name
+	}
+	return s.module(doc, sub)
+}
+
+// memberSymbol returns what object.name refers to. A module's member is
+// found in the module; a member of `this` in the enclosing class and its
+// superclasses. For anything else the name is taken to be a method, if
+// exactly one class in the document has a member of that name.
+func (s *Server) memberSymbol(doc *document, path []ast.Node, object ast.Expr, name string) *symbol {
+
+	switch obj := object.(type) {
+	case *ast.Variable:
+		if obj.Binding.Kind == ast.Global {
+			if sym := s.global(doc, obj.Name.Lexeme(), 0); sym != nil && sym.module != "" {
+				return s.member(doc, sym.module, name, 0)
+			}
+		}
+	case *ast.This:
+		if cls := enclosingClass(path); cls != nil {
+			return s.classMember(&symbol{name: cls.Name.Lexeme(), doc: doc, decl: cls.Name, node: cls}, name, 0)
+		}
+	}
+	var found *symbol
+	for _, stmt := range doc.script.Stmts {
+		count := 0
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if cls, ok := n.(*ast.ClassStmt); ok {
+				if sym := ownMember(doc, cls, name); sym != nil {
+					found = sym
+					count++
+				}
+			}
+			return count < 2
+		})
+		if count > 1 {
+			return nil
+		}
+	}
+	return found
+}
+
+// classMember looks name up in the class cls and then its superclasses.
+func (s *Server) classMember(cls *symbol, name string, depth int) *symbol {
+
+	c, ok := cls.node.(*ast.ClassStmt)
+	if !ok || depth > maxImportDepth {
+		return nil
+	}
+	if sym := ownMember(cls.doc, c, name); sym != nil {
+		return sym
+	}
+	if c.Super == nil {
+		return nil
+	}
+	if sup := s.global(cls.doc, c.Super.Name.Lexeme(), 0); sup != nil {
+		return s.classMember(sup, name, depth+1)
+	}
+	return nil
+}
+
+// ownMember finds a method, field or class variable declared in cls itself.
+func ownMember(doc *document, cls *ast.ClassStmt, name string) *symbol {
+
+	for _, m := range cls.Members {
+		switch m := m.(type) {
+		case *ast.Method:
+			if m.Func.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: m.Func.Name, node: m.Func}
+			}
+		case *ast.Field:
+			if m.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: m.Name, node: m}
+			}
+		case *ast.ClassVar:
+			if m.Name.Lexeme() == name {
+				return &symbol{name: name, doc: doc, decl: m.Name, node: m}
+			}
+		}
+	}
+	return nil
+}
+
+// enclosingClass is the innermost class declaration on path.
+func enclosingClass(path []ast.Node) *ast.ClassStmt {
+
+	for i := len(path) - 1; i >= 0; i-- {
+		if cls, ok := path[i].(*ast.ClassStmt); ok {
+			return cls
+		}
+	}
+	return nil
+}
+
+// moduleName is the dotted name of an imported module.
+func moduleName(dots, path []ast.Token) string {
+
+	var sb strings.Builder
+	for range dots {
+		sb.WriteString(".")
+	}
+	for i, t := range path {
+		if i > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(t.Lexeme())
+	}
+	return sb.String()
+}
@@ -0,0 +1,340 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// session drives a server in-process, one message at a time.
+type session struct {
+	t   *testing.T
+	srv *Server
+	out *bytes.Buffer
+	dir string
+	ids int
+}
+
+var testSignatures = map[string]string{
+	"len":       "(value) -> int",
+	"range":     "(start: int, stop: int = 0, step: int = 1)",
+	"sys.clock": "() -> float",
+	"sys.path":  "",
+}
+
+// newSession starts a server whose imports resolve to the files of a
+// temporary directory holding files.
+func newSession(t *testing.T, files map[string]string) *session {
+
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	find := func(importer, name string) (string, bool) {
+		file := filepath.Join(filepath.Dir(importer), strings.TrimLeft(name, ".")+".lox")
+		_, err := os.Stat(file)
+		return file, err == nil
+	}
+	out := &bytes.Buffer{}
+	return &session{t: t, srv: NewServer(Environment{Signatures: testSignatures, FindModule: find}, out), out: out, dir: dir}
+}
+
+func (s *session) uri(name string) string {
+
+	return pathToURI(filepath.Join(s.dir, name))
+}
+
+// send handles one message and returns those the server wrote back.
+func (s *session) send(method string, params any, request bool) []*message {
+
+	s.t.Helper()
+	msg := &message{Method: method}
+	if request {
+		s.ids++
+		id := json.RawMessage(strings.TrimSpace(string(mustJSON(s.t, s.ids))))
+		msg.ID = &id
+	}
+	msg.Params = mustJSON(s.t, params)
+	if err := s.srv.handle(msg); err != nil {
+		s.t.Fatal(err)
+	}
+	return readAll(s.t, s.out)
+}
+
+// readAll reads every message written to out.
+func readAll(t *testing.T, out *bytes.Buffer) []*message {
+
+	t.Helper()
+	var rv []*message
+	r := bufio.NewReader(out)
+	for {
+		m, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return rv
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv = append(rv, m)
+	}
+}
+
+// request sends a request and decodes its result into result.
+func (s *session) request(method string, params any, result any) {
+
+	s.t.Helper()
+	replies := s.send(method, params, true)
+	if len(replies) != 1 || replies[0].Error != nil {
+		s.t.Fatalf("%s: unexpected replies %+v", method, replies)
+	}
+	if err := json.Unmarshal(mustJSON(s.t, replies[0].Result), result); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// open opens a document and returns the diagnostics published for it.
+func (s *session) open(name, text string) []Diagnostic {
+
+	s.t.Helper()
+	replies := s.send("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: s.uri(name), Text: text}}, false)
+	if len(replies) != 1 || replies[0].Method != "textDocument/publishDiagnostics" {
+		s.t.Fatalf("expected diagnostics, got %+v", replies)
+	}
+	var p publishDiagnosticsParams
+	if err := json.Unmarshal(replies[0].Params, &p); err != nil {
+		s.t.Fatal(err)
+	}
+	return p.Diagnostics
+}
+
+func (s *session) at(name string, line, character int) textDocumentPositionParams {
+
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: s.uri(name)}, Position: Position{Line: line, Character: character}}
+}
+
+func (s *session) hover(name string, line, character int) string {
+
+	s.t.Helper()
+	var h *Hover
+	s.request("textDocument/hover", s.at(name, line, character), &h)
+	if h == nil {
+		return ""
+	}
+	return h.Contents.Value
+}
+
+func (s *session) completions(name string, line, character int) []string {
+
+	s.t.Helper()
+	var items []CompletionItem
+	s.request("textDocument/completion", s.at(name, line, character), &items)
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestServeFramingAndShutdown(t *testing.T) {
+
+	var in bytes.Buffer
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"no/such/method"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		in.WriteString("Content-Length: " + strings.TrimSpace(string(mustJSON(t, len(body)))) + "\r\n\r\n" + body)
+	}
+	var out bytes.Buffer
+	clean, err := NewServer(Environment{}, &out).Serve(&in)
+	if err != nil || !clean {
+		t.Fatalf("Serve = %v, %v", clean, err)
+	}
+	replies := readAll(t, &out)
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(replies))
+	}
+	if caps := string(mustJSON(t, replies[0].Result)); !strings.Contains(caps, `"hoverProvider":true`) {
+		t.Errorf("initialize result lacks capabilities: %s", caps)
+	}
+	if replies[1].Error == nil || replies[1].Error.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", replies[1])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+
+	s := newSession(t, nil)
+	diags := s.open("a.lox", "func f() {\n  var unused = 1\n}\nprint (1 + ;\n")
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diags)
+	}
+	if d := diags[0]; d.Severity != severityWarning || d.Code != "unused-variable" || d.Range.Start != (Position{1, 6}) {
+		t.Errorf("unexpected warning %+v", d)
+	}
+	if d := diags[1]; d.Severity != severityError || d.Range.Start.Line != 3 {
+		t.Errorf("unexpected error %+v", d)
+	}
+}
+
+func TestHover(t *testing.T) {
+
+	s := newSession(t, nil)
+	s.open("a.lox", `import sys
+func area(w: float, h = 2, *rest) -> float {
+  return w * h
+}
+class Box < Base {
+  init(size) { this.size = size }
+}
+print area(1) + sys.clock() + len("x")
+var b = Box(3)
+`)
+	for _, tc := range []struct {
+		line, char int
+		want       []string
+	}{
+		{7, 7, []string{"func area(w: float, h = 2, *rest) -> float", "Takes at least 1 argument."}},
+		{1, 6, []string{"func area(", "Takes at least 1 argument."}},
+		{7, 21, []string{"func sys.clock() -> float", "Takes no arguments."}},
+		{7, 30, []string{"func len(value) -> int", "Takes 1 argument."}},
+		{8, 9, []string{"class Box < Base\ninit(size)", "The constructor takes 1 argument."}},
+		{0, 8, []string{"module sys", "Built-in module."}},
+		{2, 10, []string{"(parameter) w: float"}},
+	} {
+		got := s.hover("a.lox", tc.line, tc.char)
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("hover at %d:%d = %q, want %q", tc.line, tc.char, got, want)
+			}
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+
+	s := newSession(t, map[string]string{
+		"util.lox": "var x = 1\nfunc helper(a) {\n  return a\n}\n",
+	})
+	s.open("main.lox", `import util
+from util import helper
+func outer() {
+  var n = 1
+  func inner() { return n }
+}
+print util.helper(1) + helper(2)
+`)
+	for _, tc := range []struct {
+		line, char int
+		file       string
+		want       Position
+	}{
+		{6, 12, "util.lox", Position{1, 5}}, // util.helper
+		{6, 26, "util.lox", Position{1, 5}}, // helper, imported by name
+		{1, 19, "util.lox", Position{1, 5}}, // the imported name itself
+		{0, 8, "util.lox", Position{0, 0}},  // the module
+		{4, 24, "main.lox", Position{3, 6}}, // an upvalue
+	} {
+		var loc *Location
+		s.request("textDocument/definition", s.at("main.lox", tc.line, tc.char), &loc)
+		if loc == nil || loc.URI != s.uri(tc.file) || loc.Range.Start != tc.want {
+			t.Errorf("definition at %d:%d = %+v, want %s %v", tc.line, tc.char, loc, tc.file, tc.want)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+
+	s := newSession(t, map[string]string{
+		"shapes.lox": "export func circle(r) {}\nexport class Square {}\nfunc internal() {}\n",
+	})
+	s.open("main.lox", `import sys
+import shapes
+var name = "glox"
+class Point {
+  x: float
+  init(x) { this.x = x }
+  norm() { return this. }
+}
+var p = Point(1)
+sys.
+shapes.
+name.
+p.
+`)
+	for _, tc := range []struct {
+		line, char int
+		want, not  []string
+	}{
+		{9, 4, []string{"clock", "path"}, []string{"len"}},
+		{10, 7, []string{"Square", "circle"}, []string{"internal"}},
+		{11, 5, []string{"replace", "join"}, []string{"append"}},
+		{12, 2, []string{"init", "norm", "x"}, []string{"replace"}},
+		{6, 23, []string{"norm", "x"}, nil},
+		{8, 0, []string{"Point", "len", "name", "sys", "while"}, nil},
+	} {
+		got := strings.Join(s.completions("main.lox", tc.line, tc.char), " ")
+		for _, want := range tc.want {
+			if !strings.Contains(" "+got+" ", " "+want+" ") {
+				t.Errorf("completion at %d:%d = %s, want %s", tc.line, tc.char, got, want)
+			}
+		}
+		for _, not := range tc.not {
+			if strings.Contains(" "+got+" ", " "+not+" ") {
+				t.Errorf("completion at %d:%d = %s, did not want %s", tc.line, tc.char, got, not)
+			}
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+
+	s := newSession(t, nil)
+	s.open("a.lox", `class A {
+  static count = 0
+  get(i) { return i }
+}
+func f(a, b = 1) {
+  func g() {}
+}
+if (true) {
+  func h() {}
+}
+`)
+	var syms []DocumentSymbol
+	s.request("textDocument/documentSymbol", documentSymbolParams{TextDocument: textDocumentIdentifier{URI: s.uri("a.lox")}}, &syms)
+	var outline []string
+	var walk func(prefix string, list []DocumentSymbol)
+	walk = func(prefix string, list []DocumentSymbol) {
+		for _, sym := range list {
+			outline = append(outline, prefix+sym.Name+sym.Detail)
+			walk(prefix+"  ", sym.Children)
+		}
+	}
+	walk("", syms)
+	want := "A\n  countstatic\n  get(i)\nf(a, b = 1)\n  g()\nh()"
+	if got := strings.Join(outline, "\n"); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if syms[1].Range.Start != (Position{4, 0}) || syms[1].SelectionRange.Start != (Position{4, 5}) {
+		t.Errorf("unexpected ranges for f: %+v", syms[1])
+	}
+}
@@ -0,0 +1,309 @@
+// Package lsp is a Language Server Protocol server for Lox, run as
+// `glox lsp` over stdin and stdout. It reports the compiler's diagnostics
+// as a document is edited, and answers hover, go-to-definition, completion
+// and document symbol requests from the syntax tree built by package ast.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"glox/src/ast"
+	"glox/src/compiler"
+)
+
+// Environment is what the server knows of the runtime beyond the source
+// it is given. The caller fills it in from a VM with its builtins defined,
+// as `glox lint` does for the checker.
+type Environment struct {
+	// Signatures holds every native global and, keyed "module.name", every
+	// member of a built-in module, mapped to its signature in annotation
+	// syntax or "" if it has none (see vm.BuiltInSignatures).
+	Signatures map[string]string
+	// FindModule returns the source file an import of name from the
+	// script importer loads (see vm.FindModuleFile).
+	FindModule func(importer, name string) (string, bool)
+}
+
+// Server holds the open documents of one client session.
+type Server struct {
+	env      Environment
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+// document is an open file. text is normalised as the scanner normalises
+// source, so token offsets index it directly.
+type document struct {
+	uri    string
+	path   string
+	text   string
+	lines  []int // byte offset at which each line starts
+	script *ast.Script
+}
+
+// NewServer returns a server that writes its responses and notifications
+// to out.
+func NewServer(env Environment, out io.Writer) *Server {
+
+	return &Server{env: env, out: out, docs: map[string]*document{}}
+}
+
+// Serve reads requests from in until the client sends exit or closes the
+// stream, and reports whether the session ended with a shutdown request
+// first, as the protocol asks of a clean exit.
+func (s *Server) Serve(in io.Reader) (bool, error) {
+
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return s.shutdown, nil
+		}
+		if err != nil {
+			return s.shutdown, err
+		}
+		if msg.Method == "exit" {
+			return s.shutdown, nil
+		}
+		if err := s.handle(msg); err != nil {
+			return s.shutdown, err
+		}
+	}
+}
+
+// handle dispatches one message. Requests always get a response; unknown
+// notifications are ignored.
+func (s *Server) handle(msg *message) error {
+
+	var result any
+	var rerr *responseError
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]any{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]string{"name": "glox"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			return s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(msg.Params, &p) == nil && len(p.ContentChanges) > 0 {
+			return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			delete(s.docs, p.TextDocument.URI)
+			return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			rerr = &responseError{Code: codeInvalidParams, Message: err.Error()}
+			break
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil {
+			break // null result
+		}
+		offset := doc.offset(p.Position)
+		switch msg.Method {
+		case "textDocument/hover":
+			if h := s.hover(doc, offset); h != nil {
+				result = h
+			}
+		case "textDocument/definition":
+			if loc := s.definition(doc, offset); loc != nil {
+				result = loc
+			}
+		default:
+			result = s.completion(doc, offset)
+		}
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			rerr = &responseError{Code: codeInvalidParams, Message: err.Error()}
+			break
+		}
+		if doc := s.docs[p.TextDocument.URI]; doc != nil {
+			result = documentSymbols(doc)
+		}
+	default:
+		if msg.ID != nil {
+			rerr = &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	if msg.ID == nil {
+		return nil
+	}
+	resp := &message{ID: msg.ID, Error: rerr}
+	if rerr == nil {
+		resp.Result = result
+		if result == nil {
+			resp.Result = json.RawMessage("null")
+		}
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *Server) notify(method string, params any) error {
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: b})
+}
+
+//-----------------------------------------------------------------------------
+// Documents.
+
+// update replaces a document's text, parses it and publishes its
+// diagnostics.
+func (s *Server) update(uri, text string) error {
+
+	doc := newDocument(uri, uriToPath(uri), text)
+	s.docs[uri] = doc
+
+	diags, _ := compiler.Check(doc.path, doc.text, s.env.Signatures)
+	out := []Diagnostic{}
+	for _, d := range compiler.DefaultWarnings().Apply(diags) {
+		out = append(out, doc.diagnostic(d))
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: out})
+}
+
+// newDocument parses and resolves a file. A file with syntax errors still
+// has a tree, with bad nodes standing in for what failed to parse.
+func newDocument(uri, path, text string) *document {
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	d := &document{uri: uri, path: path, text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	d.script, _ = ast.Parse(path, text)
+	ast.Resolve(d.script)
+	return d
+}
+
+// diagnostic converts a compiler diagnostic. Notes become related
+// information in the same document.
+func (d *document) diagnostic(diag compiler.Diagnostic) Diagnostic {
+
+	severity := severityError
+	if diag.Severity == compiler.SeverityWarning {
+		severity = severityWarning
+	}
+	code := diag.Code
+	if code == compiler.CodeSyntax {
+		code = ""
+	}
+	rv := Diagnostic{
+		Range:    d.span(diag.Span.Offset, diag.Span.Length),
+		Severity: severity,
+		Code:     code,
+		Source:   "glox",
+		Message:  diag.Message,
+	}
+	for _, n := range diag.Related {
+		rv.RelatedInformation = append(rv.RelatedInformation, relatedInformation{
+			Location: Location{URI: d.uri, Range: d.span(n.Span.Offset, n.Span.Length)},
+			Message:  n.Message,
+		})
+	}
+	return rv
+}
+
+// position converts a byte offset in the document to a protocol position,
+// whose character counts UTF-16 code units.
+func (d *document) position(offset int) Position {
+
+	offset = min(max(offset, 0), len(d.text))
+	line := 0
+	for line+1 < len(d.lines) && d.lines[line+1] <= offset {
+		line++
+	}
+	return Position{Line: line, Character: utf16Len(d.text[d.lines[line]:offset])}
+}
+
+// offset converts a protocol position to a byte offset in the document.
+func (d *document) offset(p Position) int {
+
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	i, units := d.lines[p.Line], 0
+	for i < len(d.text) && d.text[i] != '\n' && units < p.Character {
+		r, size := utf8.DecodeRuneInString(d.text[i:])
+		units += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+	return i
+}
+
+func (d *document) span(offset, length int) Range {
+
+	return Range{Start: d.position(offset), End: d.position(offset + length)}
+}
+
+// tokenRange is the range of tok's text in the document.
+func (d *document) tokenRange(tok ast.Token) Range {
+
+	return d.span(tok.Offset, tok.Width)
+}
+
+func utf16Len(s string) int {
+
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// uriToPath turns a file: URI into a path, which is also the script name
+// diagnostics and imports are resolved against.
+func uriToPath(uri string) string {
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+// pathToURI is the inverse of uriToPath.
+func pathToURI(path string) string {
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
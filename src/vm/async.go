@@ -0,0 +1,481 @@
+package vm
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"glox/src/builtin"
+	"glox/src/core"
+)
+
+// Async functions and the event loop.
+//
+// Calling an async function runs no more of it than its parameters'
+// defaults: OP_ASYNC, at the start of its body, sets the call aside as a
+// coroutine (see coroutine.go) -- a task -- queues it on the event loop and
+// returns the task to the caller in place of a result. asyncio.run() runs
+// the loop. It resumes the tasks that are ready one at a time, each until
+// it returns, which resolves the task's future, or awaits a future that
+// isn't done, which sets it aside again until that is (OP_AWAIT). The loop
+// keeps the timers; blocking work -- a channel receive, a file read -- runs
+// on a goroutine that posts its result back, waking the loop if it is
+// waiting. Tasks only ever run on the goroutine running the loop, one at a
+// time, so like fibers they share the script's values without locks.
+
+// eventLoop runs the tasks of a VM and of the modules it imports.
+type eventLoop struct {
+	vm      *VM            // the VM it belongs to, whose built-in exception classes it raises
+	tasks   map[*task]bool // those not yet done
+	ready   []wakeup
+	timers  []*timer // by when they are due, then in the order they were set
+	seq     int
+	current *task // the task running, nil between them
+	running bool  // whether asyncio.run() is under way
+	pending int   // goroutines yet to post their results
+
+	mu     sync.Mutex
+	posted []func() // what goroutines have posted, to run on the loop
+	wake   chan struct{}
+
+	trampoline *core.ClosureObject
+}
+
+// wakeup is a task to resume, with the value its await returns or the
+// exception it raises.
+type wakeup struct {
+	t     *task
+	value core.Value
+	exc   *core.InstanceObject
+}
+
+type timer struct {
+	when time.Time
+	seq  int
+	fire func()
+}
+
+// task is a call of an async function, as the event loop runs it.
+type task struct {
+	coroutine
+	future     *core.Future
+	started    bool
+	awaiting   *core.Future // what it is suspended on, if anything
+	cancelling bool         // whether cancel() wants CancelledError raised in it at its next await
+}
+
+// eventLoop returns the event loop this VM's tasks run on: its own, or
+// that of the VM importing it, as for fibers.
+func (vm *VM) eventLoop() *eventLoop {
+
+	for vm.importer != nil {
+		vm = vm.importer
+	}
+	if vm.loop == nil {
+		vm.loop = &eventLoop{
+			vm:         vm,
+			tasks:      map[*task]bool{},
+			wake:       make(chan struct{}, 1),
+			trampoline: makeTrampoline("task", 0),
+		}
+	}
+	return vm.loop
+}
+
+// startTask sets aside the call whose async body is starting as a task,
+// ready to run, leaving its frame on top for OP_ASYNC to return from, and
+// returns the task object standing for it.
+func (vm *VM) startTask() core.Value {
+
+	l := vm.eventLoop()
+	frame := vm.frame()
+	t := &task{future: &core.Future{}}
+	vm.setAside(&t.coroutine, frame.Slots, vm.frameCount-1, vm.stackTop)
+	t.future.Cancel = func() { l.cancelTask(t) }
+	l.tasks[t] = true
+	l.ready = append(l.ready, wakeup{t: t})
+	return core.MakeObjectValue(builtin.MakeFutureObject(t.future, "task "+frame.Closure.Function.Name.Get()), false)
+}
+
+// cancelTask has CancelledError raised in t: at once, cancelling what it
+// awaits too, if it is suspended on something; otherwise at its next
+// await.
+func (l *eventLoop) cancelTask(t *task) {
+
+	if t.future.Done {
+		return
+	}
+	f := t.awaiting
+	if f == nil {
+		t.cancelling = true
+		return
+	}
+	t.awaiting = nil
+	l.ready = append(l.ready, wakeup{t: t, exc: l.vm.newException("CancelledError", "Task was cancelled.")})
+	cancelFuture(f)
+}
+
+// cancelFuture asks whatever will resolve f to give up.
+func cancelFuture(f *core.Future) {
+	if !f.Done && f.Cancel != nil {
+		f.Cancel()
+	}
+}
+
+// await is OP_AWAIT: if the future of v is done it pushes its result, or
+// raises its exception, and otherwise it sets the running task aside until
+// it is, leaving the trampoline under it on top to return.
+func (vm *VM) await(v core.Value) bool {
+
+	var aw core.Awaitable
+	ok := v.IsObj()
+	if ok {
+		aw, ok = v.Obj().(core.Awaitable)
+	}
+	if !ok {
+		vm.RunTimeError("Can only await a task or future, not %s.", v.String())
+		return false
+	}
+	l := vm.eventLoop()
+	t := l.current
+	if t == nil || t.vm != vm || vm.entered != t.entered {
+		vm.RunTimeError("Can't await outside a running task.")
+		return false
+	}
+	if t.cancelling {
+		t.cancelling = false
+		vm.RunTimeErrorInstance(vm.newException("CancelledError", "Task was cancelled."))
+		return false
+	}
+	f := aw.Awaitable()
+	if f == t.future {
+		vm.RunTimeError("A task can't await itself.")
+		return false
+	}
+	if f.Done {
+		if f.Exception != nil {
+			vm.RunTimeErrorInstance(f.Exception)
+			return false
+		}
+		vm.push(f.Result)
+		return true
+	}
+	base := vm.Frames[t.trampoline].Slots + 1
+	vm.setAside(&t.coroutine, base, t.trampoline+1, vm.stackTop)
+	vm.frameCount = t.trampoline + 1
+	vm.stackTop = base
+	vm.push(core.NIL_VALUE)
+	t.awaiting = f
+	f.OnDone(func() {
+		if t.awaiting != f {
+			return // cancelled, and woken already
+		}
+		t.awaiting = nil
+		l.ready = append(l.ready, wakeup{t: t, value: f.Result, exc: f.Exception})
+	})
+	return true
+}
+
+// resumeTask runs w's task until it awaits or ends, settling its future
+// if it ends. It reports false, having raised the exception, only if the
+// VM's limits stopped the task, which stops the loop too.
+func (vm *VM) resumeTask(l *eventLoop, w wakeup) bool {
+
+	t := w.t
+	if t.future.Done {
+		return true
+	}
+	push, exc := []core.Value{w.value}, w.exc
+	if !t.started {
+		t.started, push = true, nil
+	}
+	if t.cancelling && exc == nil {
+		t.cancelling = false
+		exc = vm.newException("CancelledError", "Task was cancelled.")
+	}
+	if exc != nil {
+		push = nil
+	}
+	prev := l.current
+	l.current = t
+	result, ok := vm.resume(&t.coroutine, l.trampoline, 2, push, exc)
+	l.current = prev
+	if ok && t.suspended {
+		return true
+	}
+	delete(l.tasks, t)
+	if ok {
+		t.future.Resolve(result)
+		return true
+	}
+	exc = vm.uncaught
+	if exc == nil {
+		exc = vm.newException("RunTimeError", vm.ErrorMsg)
+	}
+	vm.uncaught, vm.ErrorMsg = nil, ""
+	if lim := vm.limits; lim != nil && lim.tripped != "" {
+		vm.RunTimeErrorInstance(exc)
+		return false
+	}
+	t.future.Cancelled = vm.isCancelledError(exc)
+	t.future.Reject(exc)
+	return true
+}
+
+// RunAsync runs the event loop until f is done, and returns its result.
+func (vm *VM) RunAsync(f *core.Future) (core.Value, bool) {
+
+	l := vm.eventLoop()
+	if l.running {
+		vm.RunTimeError("asyncio.run() can't be called while the event loop is running.")
+		return core.NIL_VALUE, false
+	}
+	l.running = true
+	defer func() { l.running = false }()
+	for !f.Done {
+		ready := l.ready
+		l.ready = nil
+		for _, w := range ready {
+			if !vm.resumeTask(l, w) {
+				return core.NIL_VALUE, false
+			}
+		}
+		l.drain()
+		l.fireTimers(time.Now())
+		if f.Done || len(l.ready) > 0 {
+			continue
+		}
+		if len(l.timers) == 0 && l.pending == 0 {
+			vm.RunTimeError("Deadlock: every task is waiting, and nothing is left to wake one.")
+			return core.NIL_VALUE, false
+		}
+		if !vm.waitForLoop(l) {
+			return core.NIL_VALUE, false
+		}
+	}
+	if f.Exception != nil {
+		vm.RunTimeErrorInstance(f.Exception)
+		return core.NIL_VALUE, false
+	}
+	return f.Result, true
+}
+
+// waitForLoop sleeps until a goroutine posts or the next timer is due. It
+// reports false, having raised TimeoutError, if the VM's context is done
+// first.
+func (vm *VM) waitForLoop(l *eventLoop) bool {
+
+	var due <-chan time.Time
+	if len(l.timers) > 0 {
+		tm := time.NewTimer(time.Until(l.timers[0].when))
+		defer tm.Stop()
+		due = tm.C
+	}
+	var done <-chan struct{}
+	if vm.limits != nil {
+		done = vm.limits.done
+	}
+	select {
+	case <-l.wake:
+	case <-due:
+	case <-done:
+		vm.checkLimits(0)
+		return false
+	}
+	return true
+}
+
+// post has fn run on the loop, from a goroutine, waking the loop.
+func (l *eventLoop) post(fn func()) {
+
+	l.mu.Lock()
+	l.posted = append(l.posted, fn)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drain runs what goroutines have posted.
+func (l *eventLoop) drain() {
+
+	l.mu.Lock()
+	posted := l.posted
+	l.posted = nil
+	l.mu.Unlock()
+	for _, fn := range posted {
+		l.pending--
+		fn()
+	}
+}
+
+// addTimer has fire called once seconds have passed.
+func (l *eventLoop) addTimer(seconds float64, fire func()) *timer {
+
+	l.seq++
+	t := &timer{when: time.Now().Add(time.Duration(max(seconds, 0) * float64(time.Second))), seq: l.seq, fire: fire}
+	i, _ := slices.BinarySearchFunc(l.timers, t, func(a, b *timer) int {
+		if c := a.when.Compare(b.when); c != 0 {
+			return c
+		}
+		return a.seq - b.seq
+	})
+	l.timers = slices.Insert(l.timers, i, t)
+	return t
+}
+
+func (l *eventLoop) stopTimer(t *timer) {
+	l.timers = slices.DeleteFunc(l.timers, func(u *timer) bool { return u == t })
+}
+
+// fireTimers fires the timers due by now.
+func (l *eventLoop) fireTimers(now time.Time) {
+
+	for len(l.timers) > 0 && !l.timers[0].when.After(now) {
+		t := l.timers[0]
+		l.timers = l.timers[1:]
+		t.fire()
+	}
+}
+
+// cancelled rejects f with CancelledError, as cancelled.
+func (l *eventLoop) cancelled(f *core.Future) {
+	f.Cancelled = true
+	f.Reject(l.vm.newException("CancelledError", "Future was cancelled."))
+}
+
+// SleepAsync returns a future resolved with nil once seconds have passed.
+func (vm *VM) SleepAsync(seconds float64) *core.Future {
+
+	l := vm.eventLoop()
+	f := &core.Future{}
+	t := l.addTimer(seconds, func() { f.Resolve(core.NIL_VALUE) })
+	f.Cancel = func() {
+		l.stopTimer(t)
+		l.cancelled(f)
+	}
+	return f
+}
+
+// GoAsync runs work on a goroutine and returns a future resolved with what
+// it returns, or rejected with the error it returns.
+func (vm *VM) GoAsync(work func(cancel <-chan struct{}) (core.Value, error)) *core.Future {
+
+	l := vm.eventLoop()
+	f := &core.Future{}
+	cancel := make(chan struct{})
+	f.Cancel = func() {
+		close(cancel)
+		l.cancelled(f)
+	}
+	l.pending++
+	go func() {
+		v, err := work(cancel)
+		l.post(func() {
+			if err != nil {
+				f.Reject(l.vm.errorException(err))
+				return
+			}
+			f.Resolve(v)
+		})
+	}()
+	return f
+}
+
+// GatherAsync returns a future resolved with the list of the results of
+// fs, in order, once all are done, or rejected with the exception of the
+// first to fail. Cancelling it cancels them all.
+func (vm *VM) GatherAsync(fs []*core.Future) *core.Future {
+
+	f := &core.Future{}
+	results := make([]core.Value, len(fs))
+	left := len(fs)
+	f.Cancel = func() {
+		for _, g := range fs {
+			cancelFuture(g)
+		}
+	}
+	if left == 0 {
+		f.Resolve(core.MakeObjectValue(core.MakeListObject(results, false), false))
+	}
+	for i, g := range fs {
+		g.OnDone(func() {
+			if f.Done {
+				return
+			}
+			if g.Exception != nil {
+				f.Cancelled = g.Cancelled
+				f.Reject(g.Exception)
+				return
+			}
+			results[i] = g.Result
+			if left--; left == 0 {
+				f.Resolve(core.MakeObjectValue(core.MakeListObject(results, false), false))
+			}
+		})
+	}
+	return f
+}
+
+// WaitForAsync returns a future settled as g is, unless seconds pass
+// first, when it is rejected with TimeoutError and g is cancelled.
+func (vm *VM) WaitForAsync(g *core.Future, seconds float64) *core.Future {
+
+	l := vm.eventLoop()
+	f := &core.Future{}
+	t := l.addTimer(seconds, func() {
+		f.Reject(l.vm.newException("TimeoutError", fmt.Sprintf("Timed out after %v seconds.", seconds)))
+		cancelFuture(g)
+	})
+	f.Cancel = func() { cancelFuture(g) }
+	g.OnDone(func() {
+		l.stopTimer(t)
+		if f.Done {
+			return
+		}
+		if g.Exception != nil {
+			f.Cancelled = g.Cancelled
+			f.Reject(g.Exception)
+			return
+		}
+		f.Resolve(g.Result)
+	})
+	return f
+}
+
+// newException makes an instance of the built-in exception class name.
+func (vm *VM) newException(name string, msg string) *core.InstanceObject {
+
+	class := vm.BuiltIns[core.InternName(name)].Obj().(*core.ClassObject)
+	exc := core.MakeInstanceObject(class)
+	exc.SetField(core.MSG, core.MakeStringObjectValue(msg, false))
+	return exc
+}
+
+// errorException is the exception for an error GoAsync work returned.
+func (vm *VM) errorException(err error) *core.InstanceObject {
+
+	if e, ok := err.(*core.AsyncError); ok {
+		return vm.newException(e.Class, e.Msg)
+	}
+	return vm.newException("RunTimeError", err.Error())
+}
+
+func (vm *VM) isCancelledError(exc *core.InstanceObject) bool {
+	return exc.Class.IsSubclassOf(vm.BuiltIns[core.InternName("CancelledError")].AsClass())
+}
+
+// measure counts what the suspended tasks hold, for the memory limit.
+func (l *eventLoop) measure(m *core.HeapMeter) {
+
+	for t := range l.tasks {
+		for _, v := range t.stack {
+			m.Value(v)
+		}
+		for _, frame := range t.frames {
+			m.Closure(frame.Closure)
+		}
+	}
+}
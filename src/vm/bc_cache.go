@@ -12,9 +12,13 @@ import (
 	"strings"
 )
 
-// functions for caching and retrieval of compiled bytecode in .lxc files
+// functions for caching and retrieval of compiled bytecode in .lxc files.
+// A sandboxed VM neither writes nor reads them.
 
 func writeToLxc(vm *VM, serialised *bytes.Buffer) {
+	if vm.sandbox != nil {
+		return
+	}
 	dir := filepath.Dir(vm.script)
 
 	// Create the cache subdirectory
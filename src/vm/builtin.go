@@ -29,6 +29,8 @@ func DefineBuiltIns(vm *VM) {
 	makeBuiltInModule(vm, "process")
 	makeBuiltInModule(vm, "thread")
 	makeBuiltInModule(vm, "sync")
+	makeBuiltInModule(vm, "fiber")
+	makeBuiltInModule(vm, "asyncio")
 
 	core.Log(core.INFO, "Defining built-in functions")
 
@@ -37,6 +39,10 @@ func DefineBuiltIns(vm *VM) {
 	defineBuiltIn(vm, "sys", "sleep", builtin.SleepBuiltIn)
 	defineBuiltIn(vm, "sys", "today", builtin.TodayBuiltIn)
 	defineBuiltIn(vm, "sys", "now", builtin.NowBuiltIn)
+	defineBuiltIn(vm, "sys", "memory_usage", builtin.MemoryUsageBuiltIn)
+	defineBuiltIn(vm, "sys", "reload", builtin.ReloadBuiltIn)
+	makeSysPath(vm)
+	makeSysStreams(vm)
 	defineBuiltIn(vm, "", "type", builtin.TypeBuiltIn)
 	defineBuiltIn(vm, "", "len", builtin.LenBuiltIn)
 	defineBuiltIn(vm, "", "_sin", builtin.SinBuiltIn)
@@ -79,6 +85,8 @@ func DefineBuiltIns(vm *VM) {
 	defineBuiltIn(vm, "os", "readln", builtin.ReadlnBuiltIn)
 	defineBuiltIn(vm, "os", "write", builtin.WriteBuiltIn)
 	defineBuiltIn(vm, "os", "read_all", builtin.ReadAllBuiltIn)
+	defineBuiltIn(vm, "os", "buffer", builtin.BufferBuiltIn)
+	defineBuiltIn(vm, "os", "getvalue", builtin.GetvalueBuiltIn)
 	defineBuiltIn(vm, "os", "listdir", builtin.ListdirBuiltIn)
 	defineBuiltIn(vm, "os", "isdir", builtin.IsdirBuiltIn)
 	defineBuiltIn(vm, "os", "isfile", builtin.IsfileBuiltIn)
@@ -116,10 +124,29 @@ func DefineBuiltIns(vm *VM) {
 	defineBuiltIn(vm, "thread", "spawn", builtin.ThreadSpawnBuiltIn)
 	defineBuiltIn(vm, "thread", "channel", builtin.ThreadChannelBuiltIn)
 	defineBuiltIn(vm, "thread", "wait_any", builtin.ThreadWaitAnyBuiltIn)
+	defineBuiltIn(vm, "thread", "select", builtin.ThreadSelectBuiltIn)
+	defineBuiltIn(vm, "thread", "Channel", builtin.ChannelBuiltIn)
 
 	// sync module functions
 	defineBuiltIn(vm, "sync", "Mutex", builtin.MutexBuiltIn)
 
+	// fiber module functions
+	defineBuiltIn(vm, "fiber", "spawn", builtin.FiberSpawnBuiltIn)
+	defineBuiltIn(vm, "fiber", "yield", builtin.FiberYieldBuiltIn)
+	defineBuiltIn(vm, "fiber", "sleep", builtin.FiberSleepBuiltIn)
+	defineBuiltIn(vm, "fiber", "tick", builtin.FiberTickBuiltIn)
+	defineBuiltIn(vm, "fiber", "run", builtin.FiberRunBuiltIn)
+
+	// asyncio module functions
+	defineBuiltIn(vm, "asyncio", "run", builtin.AsyncioRunBuiltIn)
+	defineBuiltIn(vm, "asyncio", "sleep", builtin.AsyncioSleepBuiltIn)
+	defineBuiltIn(vm, "asyncio", "gather", builtin.AsyncioGatherBuiltIn)
+	defineBuiltIn(vm, "asyncio", "wait_for", builtin.AsyncioWaitForBuiltIn)
+	defineBuiltIn(vm, "asyncio", "recv", builtin.AsyncioRecvBuiltIn)
+	defineBuiltIn(vm, "asyncio", "wait", builtin.AsyncioWaitBuiltIn)
+	defineBuiltIn(vm, "asyncio", "read_file", builtin.AsyncioReadFileBuiltIn)
+	defineBuiltIn(vm, "asyncio", "write_file", builtin.AsyncioWriteFileBuiltIn)
+
 	// Color utility functions
 	defineBuiltIn(vm, "colour_utils", "fade", builtin.ColourUtilsFadeBuiltIn)
 	defineBuiltIn(vm, "colour_utils", "tint", builtin.ColourUtilsTintBuiltIn)
@@ -149,6 +176,7 @@ func addBuiltInModuleFunction(vm *VM, moduleName string, name string, fn core.Bu
 	// Add a function to a built-in module
 	module := vm.BuiltInModules[core.InternName(moduleName)]
 	fo := core.MakeBuiltInObject(fn)
+	fo.Module = moduleName
 	module.Environment.Vars[core.InternName(name)] = core.MakeObjectValue(fo, false)
 }
 
@@ -223,6 +251,33 @@ class ThreadError < Exception {
 		return this.msg;
 	}
 }
+class FiberError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "FiberError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
+class CancelledError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "CancelledError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
+class ImportError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "ImportError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
 class SyncError < Exception {
     init(msg) {
 	    this.msg = msg;
@@ -232,4 +287,40 @@ class SyncError < Exception {
 		return this.msg;
 	}
 }
+class TimeoutError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "TimeoutError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
+class BudgetExceeded < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "BudgetExceeded";
+	}
+	toString() {
+		return this.msg;
+	}
+}
+class PermissionError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "PermissionError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
+class MemoryError < Exception {
+    init(msg) {
+	    this.msg = msg;
+		this.name = "MemoryError";
+	}
+	toString() {
+		return this.msg;
+	}
+}
 `
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"glox/src/core"
+)
+
+// builtInSignatures describes the native builtins registered in DefineBuiltIns
+// for the static checker (`glox check`), keyed by name for globals and by
+// "module.name" for module members. Signatures use Lox annotation syntax and
+// mirror the argument checks the Go implementations make at run time: a
+// parameter without a type accepts anything, `= ...` marks an optional
+// argument and `*rest` a variadic tail. Builtins missing from this table are
+// simply not checked.
+var builtInSignatures = map[string]string{
+	"type":    "(value) -> string",
+	"len":     "(value) -> int",
+	"_sin":    "(x: float) -> float",
+	"_cos":    "(x: float) -> float",
+	"_tan":    "(x: float) -> float",
+	"_sqrt":   "(x: float) -> float",
+	"_pow":    "(x: float, y: float) -> float",
+	"_atan2":  "(y: float, x: float) -> float",
+	"append":  "(list: list, value) -> list",
+	"float":   "(value) -> float",
+	"int":     "(value) -> int",
+	"replace": "(s: string, old: string, new: string) -> string",
+	"format":  "(template: string, *args) -> string",
+	"range":   "(start: int, stop: int = 0, step: int = 1)",
+	"rand":    "() -> float",
+	"vec2":    "(x: number, y: number) -> vec2",
+	"vec3":    "(x: number, y: number, z: number) -> vec3",
+	"vec4":    "(x: number, y: number, z: number, w: number) -> vec4",
+
+	"sys.args":         "() -> list[string]",
+	"sys.clock":        "() -> float",
+	"sys.sleep":        "(seconds: number)",
+	"sys.today":        "() -> string",
+	"sys.now":          "() -> string",
+	"sys.memory_usage": "() -> int",
+	"sys.reload":       "(module: module) -> module",
+
+	"inspect.dump_frame": "()",
+	"inspect.get_frame":  "()",
+
+	"os.open":     "(path: string, mode: string) -> file",
+	"os.close":    "(f: file)",
+	"os.readln":   "(f: file)",
+	"os.write":    "(f: file, s: string)",
+	"os.read_all": "(path: string) -> string",
+	"os.buffer":   "() -> file",
+	"os.getvalue": "(f: file) -> string",
+	"os.listdir":  "(path: string) -> list[string]",
+	"os.isdir":    "(path: string) -> bool",
+	"os.isfile":   "(path: string) -> bool",
+	"os.exists":   "(path: string) -> bool",
+	"os.mkdir":    "(path: string)",
+	"os.rmdir":    "(path: string)",
+	"os.remove":   "(path: string)",
+	"os.getcwd":   "() -> string",
+	"os.chdir":    "(path: string)",
+	"os.join":     "(*parts: string) -> string",
+	"os.dirname":  "(path: string) -> string",
+	"os.basename": "(path: string) -> string",
+	"os.splitext": "(path: string)",
+
+	"re.search":    "(pattern: string, s: string)",
+	"re.match":     "(pattern: string, s: string)",
+	"re.fullmatch": "(pattern: string, s: string)",
+	"re.sub":       "(pattern: string, repl, s: string, count: int = 0)",
+	"re.subn":      "(pattern: string, repl, s: string, count: int = 0)",
+	"re.split":     "(pattern: string, s: string, maxsplit: int = 0) -> list[string]",
+	"re.findall":   "(pattern: string, s: string) -> list",
+	"re.compile":   "(pattern: string)",
+
+	"pickle.dumps": "(value) -> string",
+	"pickle.loads": "(data: string)",
+
+	"process.spawn":    "(script: string, *args: string)",
+	"process.parent":   "()",
+	"process.wait_any": "(processes: list)",
+
+	"thread.spawn":    "(fn: func, *args)",
+	"thread.channel":  "()",
+	"thread.wait_any": "(threads: list)",
+	"thread.select":   "(cases: list, timeout: number? = nil)",
+	"thread.Channel":  "(capacity: int = 0)",
+
+	"sync.Mutex": "()",
+
+	"fiber.spawn": "(fn: func, *args)",
+	"fiber.yield": "()",
+	"fiber.sleep": "(seconds: number)",
+	"fiber.tick":  "(dt: number = 0) -> int",
+	"fiber.run":   "()",
+
+	"asyncio.run":        "(aw)",
+	"asyncio.sleep":      "(seconds: number)",
+	"asyncio.gather":     "(*aws)",
+	"asyncio.wait_for":   "(aw, timeout: number)",
+	"asyncio.recv":       "(source)",
+	"asyncio.wait":       "(source)",
+	"asyncio.read_file":  "(path: string)",
+	"asyncio.write_file": "(path: string, text: string)",
+
+	"colour_utils.fade":       "(r: number, g: number, b: number, alpha: number)",
+	"colour_utils.tint":       "(r1: number, g1: number, b1: number, r2: number, g2: number, b2: number)",
+	"colour_utils.brightness": "(r: number, g: number, b: number, factor: number)",
+	"colour_utils.lerp":       "(r1: number, g1: number, b1: number, r2: number, g2: number, b2: number, amount: number)",
+	"colour_utils.hsv_to_rgb": "(h: number, s: number, v: number)",
+	"colour_utils.random":     "()",
+
+	"gfx.lox_mandel_array": "(a1, a2, a3, a4, a5, a6, a7)",
+	"gfx.lox_julia_array":  "(a1, a2, a3, a4, a5, a6, a7, a8, a9)",
+	"gfx.draw_png":         "(filename: string, data, colour_encoded: bool)",
+	"gfx.encode_rgba":      "(r: int, g: int, b: int) -> float",
+	"gfx.decode_rgba":      "(colour: float)",
+	"gfx.window":           "(width: int, height: int) -> window",
+	"gfx.image":            "(filename: string) -> image",
+	"gfx.texture":          "(image, frames, start_frame, end_frame) -> texture",
+	"gfx.render_texture":   "(width: int, height: int) -> render_texture",
+	"gfx.shader":           "(vertex: string = ..., fragment: string = ...) -> shader",
+	"gfx.camera":           "(position: vec3, target: vec3, up: vec3) -> camera",
+	"gfx.batch":            "(batch_type) -> batch",
+	"gfx.batch_instanced":  "(texture, a2, a3) -> batch_instanced",
+	"gfx.float_array":      "(width: int, height: int) -> float_array",
+
+	"physics.physics_world": "(min: vec3, max: vec3, cell_size, gravity) -> physics_world",
+}
+
+// BuiltInSignatures returns the checker signatures of every native builtin
+// this VM actually registered, keyed like builtInSignatures. A registered
+// builtin without a known signature maps to "".
+func (vm *VM) BuiltInSignatures() map[string]string {
+
+	rv := map[string]string{}
+	for id, v := range vm.BuiltIns {
+		if v.IsObj() && v.Obj().GetType() == core.OBJECT_NATIVE {
+			name := core.NameFromID(id)
+			rv[name] = builtInSignatures[name]
+		}
+	}
+	for modID, module := range vm.BuiltInModules {
+		prefix := core.NameFromID(modID) + "."
+		for id := range module.Environment.Vars {
+			name := prefix + core.NameFromID(id)
+			rv[name] = builtInSignatures[name]
+		}
+	}
+	return rv
+}
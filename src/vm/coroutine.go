@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"slices"
+
+	"glox/src/core"
+)
+
+// Coroutines: frames that can be set aside part way through and resumed
+// later, the machinery behind fibers (fiber.go) and async functions'
+// tasks (async.go).
+//
+// A coroutine runs on the stack of the VM resuming it, on top of whatever
+// frames are there. Below its own frames sits a trampoline: a frame whose
+// code calls a function and returns. When the coroutine suspends, its
+// frames and the stack they use are moved out into it, leaving the
+// trampoline to return, which ends the run; resuming copies them back on
+// top of a new trampoline, wherever the stack then is, and runs until that
+// returns in turn. Slots, handlers and open upvalues are kept relative to
+// the coroutine's first slot while it is suspended, and its open upvalues
+// point into its saved stack, so closures sharing its variables go on
+// seeing -- and setting -- them.
+//
+// A coroutine can only suspend from its own frames: not from inside a call
+// a built-in makes back into Lox (a sort key, say), as that has Go frames
+// on the way that can't be set aside.
+
+// coroutine is the state of a fiber or task that outlives one run of it.
+type coroutine struct {
+	vm      *VM // the VM it runs on, between resuming and suspending
+	entered int // vm.entered while it runs, to tell its own frames from calls a built-in makes
+
+	// set while it is suspended, relative to its first slot and frame
+	stack    []core.Value
+	frames   []core.CallFrame
+	upvalues *core.UpvalueObject
+
+	trampoline int  // the frame index of the trampoline under it while it runs
+	suspended  bool // whether it suspended, rather than ended, in the last run
+}
+
+// makeTrampoline returns a closure whose code calls a function with
+// argCount arguments, then returns.
+func makeTrampoline(name string, argCount int) *core.ClosureObject {
+
+	fn := core.MakeFunctionObject(name, core.NewEnvironment(name))
+	fn.Chunk = core.MakeChunk(name, []uint8{core.OP_CALL, uint8(argCount), core.OP_RETURN}, nil, []int{0, 0, 0})
+	fn.Name = core.MakeStringObject(name)
+	return core.MakeClosureObject(fn)
+}
+
+// setAside moves the frames from first up, and the stack from base to end,
+// out of the VM into c, detaching the open upvalues among them. It leaves
+// the VM's frameCount and stackTop for the caller to set.
+func (vm *VM) setAside(c *coroutine, base int, first int, end int) {
+
+	c.stack = slices.Clone(vm.stack[base:end])
+	c.frames = slices.Clone(vm.Frames[first:vm.frameCount])
+	for i := range c.frames {
+		relocateFrame(&c.frames[i], -base, -first)
+	}
+	var last *core.UpvalueObject
+	for vm.openUpValues != nil && vm.openUpValues.Slot >= base {
+		uv := vm.openUpValues
+		vm.openUpValues = uv.Next
+		uv.Slot -= base
+		uv.Location = &c.stack[uv.Slot]
+		if last == nil {
+			c.upvalues = uv
+		} else {
+			last.Next = uv
+		}
+		uv.Next, last = nil, uv
+	}
+	c.suspended = true
+}
+
+// relocateFrame moves frame by slots on the stack and by frames in depth.
+func relocateFrame(frame *core.CallFrame, slots int, frames int) {
+
+	frame.Slots += slots
+	frame.Depth += frames
+	for h := frame.Handlers; h != nil; h = h.Prev {
+		h.StackTop += slots
+	}
+}
+
+// resume pushes trampoline, to carry on at ip, with c's frames and stack on
+// top of it and then the values push, and runs until the trampoline
+// returns: until c suspends or ends. If raise is set, that is raised in c's
+// frames first. It returns what the trampoline returned, or false if c
+// ended with an exception, which vm.uncaught then holds.
+func (vm *VM) resume(c *coroutine, trampoline *core.ClosureObject, ip int, push []core.Value, raise *core.InstanceObject) (core.Value, bool) {
+
+	base, frameCount := vm.stackTop, vm.frameCount
+	vm.stackTrace = nil
+	vm.uncaught = nil
+	if frameCount+len(c.frames)+2 >= FRAMES_MAX || base+len(c.stack)+len(push)+1 >= STACK_MAX {
+		vm.RunTimeError("Stack overflow.")
+		return core.NIL_VALUE, false
+	}
+	vm.stack[base] = core.MakeObjectValue(trampoline, false)
+	vm.Frames[frameCount] = core.CallFrame{Closure: trampoline, Ip: ip, Slots: base, Depth: frameCount + 1}
+	vm.frameCount++
+	vm.stackTop++
+	copy(vm.stack[vm.stackTop:], c.stack)
+	vm.stackTop += len(c.stack)
+	for _, frame := range c.frames {
+		relocateFrame(&frame, base+1, frameCount+1)
+		vm.Frames[vm.frameCount] = frame
+		vm.frameCount++
+	}
+	if c.upvalues != nil {
+		uv := c.upvalues
+		for {
+			uv.Slot += base + 1
+			uv.Location = &vm.stack[uv.Slot]
+			if uv.Next == nil {
+				break
+			}
+			uv = uv.Next
+		}
+		uv.Next = vm.openUpValues
+		vm.openUpValues = c.upvalues
+	}
+	for _, v := range push {
+		vm.push(v)
+	}
+	c.stack, c.frames, c.upvalues = nil, nil, nil
+
+	vm.entered++
+	c.vm, c.entered, c.trampoline, c.suspended = vm, vm.entered, frameCount, false
+	res, result := INTERPRET_OK, core.NIL_VALUE
+	if raise != nil {
+		prevFloor := vm.exceptionFloor
+		vm.exceptionFloor = frameCount + 1
+		if !vm.raiseException(core.MakeObjectValue(raise, false)) {
+			res = INTERPRET_RUNTIME_ERROR
+		}
+		vm.exceptionFloor = prevFloor
+	}
+	if res == INTERPRET_OK {
+		res, result = vm.runFrom(RUN_CURRENT_FUNCTION, frameCount+1)
+	}
+	vm.entered--
+	c.vm = nil
+	if res != INTERPRET_OK {
+		vm.closeUpvalues(base)
+		vm.stackTop, vm.frameCount = base, frameCount
+		return core.NIL_VALUE, false
+	}
+	vm.stackTop = base
+	return result, true
+}
@@ -0,0 +1,235 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"glox/src/core"
+)
+
+// Fibers: lightweight coroutines sharing one VM.
+//
+// A fiber runs on the stack of the VM ticking its scheduler, on top of the
+// frames of whoever called fiber.tick(), as a coroutine (see coroutine.go)
+// whose trampoline calls the fiber's function. fiber.yield() and
+// fiber.sleep() set it aside until a later tick.
+
+// fiber is a core.Fiber as its scheduler runs it.
+type fiber struct {
+	*core.Fiber
+	coroutine
+	callee  core.Value   // what it calls when it starts
+	args    []core.Value // and with what
+	started bool
+	wake    float64 // the scheduler clock time it is next due at
+}
+
+// scheduler runs a VM's fibers, in the order they were spawned, each time
+// it is ticked.
+type scheduler struct {
+	fibers  []*fiber
+	clock   float64 // seconds, advanced by each tick's dt
+	current *fiber  // the fiber running, nil between them
+	ticking bool
+	// trampolines are the trampoline closures by the number of arguments
+	// they call with.
+	trampolines map[int]*core.ClosureObject
+}
+
+// scheduler returns the scheduler this VM's fibers run on: its own, or that
+// of the VM importing it, so a fiber spawned by a module body runs with
+// those of the script.
+func (vm *VM) scheduler() *scheduler {
+
+	for vm.importer != nil {
+		vm = vm.importer
+	}
+	if vm.fibers == nil {
+		vm.fibers = &scheduler{trampolines: map[int]*core.ClosureObject{}}
+	}
+	return vm.fibers
+}
+
+// trampoline returns the closure whose code calls a fiber's function with
+// argCount arguments, then returns.
+func (s *scheduler) trampoline(argCount int) *core.ClosureObject {
+
+	if t, ok := s.trampolines[argCount]; ok {
+		return t
+	}
+	t := makeTrampoline("fiber", argCount)
+	s.trampolines[argCount] = t
+	return t
+}
+
+// SpawnFiber schedules callee(args...) to start at the next tick.
+func (vm *VM) SpawnFiber(callee core.Value, args []core.Value) (*core.Fiber, error) {
+
+	if !callee.IsClosureObject() && !callee.IsBoundMethodObject() && !callee.IsBuiltInObject() && !callee.IsClassObject() {
+		return nil, errors.New("fiber.spawn() argument must be a function")
+	}
+	if len(args) > 255 {
+		return nil, errors.New("too many arguments for a fiber")
+	}
+	s := vm.scheduler()
+	f := &fiber{Fiber: &core.Fiber{}, callee: callee, args: args, wake: s.clock}
+	s.fibers = append(s.fibers, f)
+	return f.Fiber, nil
+}
+
+// SuspendFiber sets the running fiber aside until seconds have passed on the
+// scheduler's clock.
+func (vm *VM) SuspendFiber(seconds float64, argCount int) bool {
+
+	s := vm.scheduler()
+	f := s.current
+	if f == nil || f.vm != vm {
+		vm.RunTimeErrorNamed("FiberError", "Not inside a fiber.")
+		return false
+	}
+	if vm.entered != f.entered {
+		vm.RunTimeErrorNamed("FiberError", "A fiber can't suspend inside a call from a built-in function.")
+		return false
+	}
+	base := vm.Frames[f.trampoline].Slots + 1
+	end := vm.stackTop - argCount - 1 // the built-in's own slot, where the fiber resumes
+	vm.setAside(&f.coroutine, base, f.trampoline+1, end)
+	f.wake = s.clock + max(seconds, 0)
+	// Leave the trampoline on top, with the stack as the built-in's caller
+	// expects it, for it to return and end the run.
+	vm.frameCount = f.trampoline + 1
+	vm.stackTop = base + argCount + 1
+	return true
+}
+
+// resumeFiber runs f until it suspends or ends. It reports false, with
+// f.Err set, if f ends with an exception.
+func (vm *VM) resumeFiber(s *scheduler, f *fiber) bool {
+
+	trampoline, ip, push := s.trampoline(0), 2, []core.Value{core.NIL_VALUE} // past the call, returning what fiber.yield() or fiber.sleep() returns
+	if !f.started {
+		f.started = true
+		trampoline, ip, push = s.trampoline(len(f.args)), 0, append([]core.Value{f.callee}, f.args...)
+		f.callee, f.args = core.NIL_VALUE, nil
+	}
+	prev := s.current
+	s.current = f
+	result, ok := vm.resume(&f.coroutine, trampoline, ip, push, nil)
+	s.current = prev
+	if !ok {
+		f.Done, f.Err = true, fiberError(vm)
+		return false
+	}
+	if !f.suspended {
+		f.Done, f.Result = true, result
+	}
+	return true
+}
+
+// fiberError is the exception that ended a fiber's run on vm, as an error.
+func fiberError(vm *VM) error {
+
+	if vm.uncaught == nil {
+		return errors.New(vm.ErrorMsg)
+	}
+	return errors.New(exceptionText(vm.uncaught))
+}
+
+// exceptionText is exc as its class name and message.
+func exceptionText(exc *core.InstanceObject) string {
+
+	msg, _ := exc.GetField(core.MSG)
+	if msg.IsStringObject() {
+		return fmt.Sprintf("%s: %s", exc.Class.Name.Get(), msg.AsString().Get())
+	}
+	return fmt.Sprintf("%s: %s", exc.Class.Name.Get(), msg.String())
+}
+
+// TickFibers advances the clock by dt and runs the fibers that are due, in
+// the order they were spawned. Those spawned or woken during the tick wait
+// for the next. If one ends with an exception, that is raised again here,
+// in the script calling fiber.tick(), and the rest wait for the next tick.
+func (vm *VM) TickFibers(dt float64) (int, bool) {
+
+	s := vm.scheduler()
+	if s.ticking {
+		vm.RunTimeErrorNamed("FiberError", "fiber.tick() can't be called from inside a fiber.")
+		return 0, false
+	}
+	s.ticking = true
+	defer func() { s.ticking = false }()
+	s.clock += max(dt, 0)
+	due := []*fiber{}
+	for _, f := range s.fibers {
+		if f.wake <= s.clock {
+			due = append(due, f)
+		}
+	}
+	failed := false
+	for _, f := range due {
+		if f.Cancelled || f.Done {
+			continue
+		}
+		if !vm.resumeFiber(s, f) {
+			failed = true
+			break
+		}
+	}
+	s.fibers = slices.DeleteFunc(s.fibers, func(f *fiber) bool { return f.Done || f.Cancelled })
+	if failed {
+		// raise the fiber's exception itself, the run loop having left it
+		// uncaught at the trampoline
+		if exc := vm.uncaught; exc != nil {
+			vm.RunTimeErrorInstance(exc)
+			vm.uncaught = nil
+		}
+		return 0, false
+	}
+	return len(s.fibers), true
+}
+
+// RunFibers ticks the scheduler with the real time that has passed, until
+// no fibers are left, sleeping while none is due.
+func (vm *VM) RunFibers() bool {
+
+	s := vm.scheduler()
+	last := time.Now()
+	dt := 0.0
+	for {
+		n, ok := vm.TickFibers(dt)
+		if !ok {
+			return false
+		}
+		if n == 0 {
+			return true
+		}
+		next := s.fibers[0].wake
+		for _, f := range s.fibers {
+			next = min(next, f.wake)
+		}
+		if wait := next - s.clock; wait > 0 {
+			time.Sleep(time.Duration(wait * float64(time.Second)))
+		}
+		now := time.Now()
+		dt, last = now.Sub(last).Seconds(), now
+	}
+}
+
+// measure counts what the suspended fibers hold, for the memory limit.
+func (s *scheduler) measure(m *core.HeapMeter) {
+
+	for _, f := range s.fibers {
+		m.Value(f.callee)
+		for _, v := range f.args {
+			m.Value(v)
+		}
+		for _, v := range f.stack {
+			m.Value(v)
+		}
+		for _, frame := range f.frames {
+			m.Closure(frame.Closure)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"context"
+	"errors"
+)
+
+// limits is what SetBudget and SetContext impose on a VM's runs. The VM
+// holds nil when neither is set, so an unlimited run pays one nil check at
+// each backward jump and call, where a set one is checked.
+type limits struct {
+	budget    int // instructions per run, 0 for no limit
+	remaining int // what is left of budget in the current run
+	ctx       context.Context
+	done      <-chan struct{} // ctx.Done(), nil when there's no ctx
+	tripped   string          // the exception class the current run was stopped with, "" if none
+	grace     int             // what is left of handlerGrace once tripped
+}
+
+// handlerGrace is how many instructions a run may go on for once it has been
+// stopped, so that a handler catching the exception can call functions to
+// log or clean up. After that, every check raises the exception again.
+const handlerGrace = 10000
+
+// ErrBudgetExceeded is what a run stopped by its instruction budget is
+// interrupted with, as a context's Err is for one stopped by the context.
+var ErrBudgetExceeded = errors.New("instruction budget exceeded")
+
+// SetBudget limits each later run -- an Interpret, or a CallClosure from Go
+// -- to about n instructions, after which the script is raised a
+// BudgetExceeded exception. A loop is charged the length of its body each
+// time round and a call one instruction, so the count is approximate.
+// n <= 0 removes the limit. Threads the script spawns get budgets of their
+// own of the same size.
+func (vm *VM) SetBudget(n int) {
+	l := vm.ensureLimits()
+	l.budget = max(n, 0)
+	l.remaining = l.budget
+	vm.dropLimitsIfUnset()
+}
+
+// SetContext makes ctx being cancelled, or its deadline passing, raise a
+// TimeoutError in the running script, and in the threads it spawns. A nil
+// ctx removes it. Blocking calls such as sys.sleep and thread.wait are not
+// interrupted: the script is stopped at its next loop or call after them.
+func (vm *VM) SetContext(ctx context.Context) {
+	l := vm.ensureLimits()
+	l.ctx, l.done = ctx, nil
+	if ctx != nil {
+		l.done = ctx.Done()
+	}
+	vm.dropLimitsIfUnset()
+}
+
+// Interrupted returns why the last run or CallClosure was stopped --
+// ErrBudgetExceeded or its context's Err -- or nil if it wasn't. A script
+// that catches the exception and ends normally or with some other error
+// wasn't stopped.
+func (vm *VM) Interrupted() error {
+	l := vm.limits
+	if l == nil || l.tripped == "" || vm.uncaught == nil || vm.uncaught.Class.Name.Get() != l.tripped {
+		return nil
+	}
+	if l.tripped == "BudgetExceeded" {
+		return ErrBudgetExceeded
+	}
+	return l.ctx.Err()
+}
+
+func (vm *VM) ensureLimits() *limits {
+	if vm.limits == nil {
+		vm.limits = &limits{}
+	}
+	return vm.limits
+}
+
+func (vm *VM) dropLimitsIfUnset() {
+	if vm.limits.budget == 0 && vm.limits.ctx == nil {
+		vm.limits = nil
+	}
+}
+
+// inheritLimits gives a thread's VM the limits of the VM spawning it.
+func (vm *VM) inheritLimits(from *VM) {
+	if from.limits != nil {
+		vm.SetBudget(from.limits.budget)
+		vm.SetContext(from.limits.ctx)
+	}
+}
+
+// startRun refills the budget for a new top-level run.
+func (vm *VM) startRun() {
+	if l := vm.limits; l != nil {
+		l.remaining = l.budget
+		l.tripped = ""
+	}
+}
+
+// checkLimits charges cost instructions against the budget and checks the
+// context. When the run must stop it raises the exception for it and
+// returns false. Once tripped, the run gets handlerGrace more instructions,
+// once, and then every later check raises again, so a script can catch the
+// exception and clean up but not carry on looping.
+//
+//go:noinline
+func (vm *VM) checkLimits(cost int) bool {
+	l := vm.limits
+	if l.tripped != "" {
+		l.grace -= cost
+		if l.grace >= 0 {
+			return true
+		}
+		vm.raiseLimit()
+		return false
+	}
+	select {
+	case <-l.done:
+		l.tripped = "TimeoutError"
+	default:
+		if l.budget > 0 {
+			l.remaining -= cost
+			if l.remaining < 0 {
+				l.tripped = "BudgetExceeded"
+			}
+		}
+	}
+	if l.tripped == "" {
+		return true
+	}
+	l.grace = handlerGrace
+	vm.raiseLimit()
+	return false
+}
+
+// raiseLimit raises the exception the run was stopped with.
+func (vm *VM) raiseLimit() {
+	l := vm.limits
+	if l.tripped == "TimeoutError" {
+		vm.RunTimeErrorNamed("TimeoutError", "Execution interrupted: %v.", l.ctx.Err())
+		return
+	}
+	vm.RunTimeErrorNamed("BudgetExceeded", "Instruction budget of %d exceeded.", l.budget)
+}
@@ -0,0 +1,96 @@
+package vm
+
+import "glox/src/core"
+
+// memoryAccount is what SetMemoryLimit holds a VM's allocations to. A script
+// and the modules it imports share one; each thread it spawns gets its own,
+// as threads are handed copies of what they use (see core/copy.go).
+type memoryAccount struct {
+	limit int
+	used  int // bytes live at the last recount, plus those charged since
+}
+
+// SetMemoryLimit caps the memory scripts hold in strings, lists, dicts and
+// float arrays at about n bytes. An allocation that would go over it raises
+// MemoryError. Threads the script spawns are each held to a limit of their
+// own of the same size. n <= 0 removes the limit.
+func (vm *VM) SetMemoryLimit(n int) {
+	if n <= 0 {
+		vm.memory = nil
+		return
+	}
+	if vm.memory == nil {
+		vm.memory = &memoryAccount{}
+	}
+	vm.memory.limit = n
+}
+
+// MemoryUsage returns about how many bytes of strings, lists, dicts and
+// float arrays the script can still reach, as sys.memory_usage() does.
+func (vm *VM) MemoryUsage() int {
+	used := vm.measureHeap()
+	if vm.memory != nil {
+		vm.memory.used = used
+	}
+	return used
+}
+
+// shareMemory charges a module's VM to the account of the VM importing it.
+func (vm *VM) shareMemory(importer *VM) {
+	vm.memory, vm.importer = importer.memory, importer
+}
+
+// inheritMemoryLimit gives a thread's VM a limit of the same size as the VM
+// spawning it.
+func (vm *VM) inheritMemoryLimit(from *VM) {
+	if from.memory != nil {
+		vm.SetMemoryLimit(from.memory.limit)
+	}
+}
+
+// Charge records an allocation of about bytes against the memory limit, if
+// there is one. When that would go over it, what is still reachable is
+// counted afresh, so garbage stops counting; if it still goes over, Charge
+// raises MemoryError and returns false, and the allocation shouldn't be
+// made.
+func (vm *VM) Charge(bytes int) bool {
+	m := vm.memory
+	if m == nil {
+		return true
+	}
+	if bytes > m.limit-m.used {
+		m.used = vm.measureHeap()
+		if bytes > m.limit-m.used {
+			vm.RunTimeErrorNamed("MemoryError", "Memory limit of %d bytes exceeded.", m.limit)
+			return false
+		}
+	}
+	m.used += bytes
+	return true
+}
+
+// measureHeap counts what the script can reach from the stacks, frames and
+// globals of this VM and of those importing it.
+func (vm *VM) measureHeap() int {
+	m := core.NewHeapMeter()
+	for v := vm; v != nil; v = v.importer {
+		for _, val := range v.stack[:v.stackTop] {
+			m.Value(val)
+		}
+		for i := range v.frameCount {
+			closure := v.Frames[i].Closure
+			m.Closure(closure)
+			if closure != nil {
+				m.Environment(closure.Function.Environment)
+			}
+		}
+		m.Environment(v.globals)
+		if v.fibers != nil {
+			v.fibers.measure(m)
+		}
+		if v.loop != nil {
+			v.loop.measure(m)
+		}
+	}
+	return m.Bytes
+}
@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"strings"
+
+	"glox/src/core"
+)
+
+// Module visibility.
+//
+// A module declares its public interface by marking declarations with
+// `export`, by defining a global __all__ list of name strings, or both. Once
+// it declares one, `from m import *` imports exactly those names and
+// importing any other name explicitly is an ImportError. A module that
+// declares nothing exports every name not starting with an underscore.
+// Attribute access on the module object (m._helper) is not restricted.
+
+// moduleExports returns the names a module declares public, the union of
+// its `export` declarations and its __all__ list, and whether it declares
+// any at all.
+func moduleExports(module *core.ModuleObject) (map[int]bool, bool) {
+
+	env := module.Environment
+	exports := map[int]bool{}
+	declared := false
+	for id := range env.Exports {
+		exports[id] = true
+		declared = true
+	}
+	if all, ok := moduleAttr(module, core.InternName("__all__")); ok && all.IsObj() && all.ObjType() == core.OBJECT_LIST {
+		declared = true
+		for _, item := range all.AsList().Items {
+			if item.IsStringObject() {
+				exports[core.InternName(item.AsString().Get())] = true
+			}
+		}
+	}
+	return exports, declared
+}
+
+// isExported reports whether name may be imported from module by name.
+func isExported(module *core.ModuleObject, name string) bool {
+
+	if exports, ok := moduleExports(module); ok {
+		return exports[core.InternName(name)]
+	}
+	return !strings.HasPrefix(name, "_")
+}
@@ -0,0 +1,331 @@
+package vm
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"glox/src/core"
+)
+
+// Module resolution.
+//
+// A module name is a dotted path such as "engine.render.batch". Every
+// component but the last names a package: a directory whose optional
+// __init__.lox runs as the package's own module body. Top-level names are
+// looked up along the search path, exposed to scripts as the mutable list
+// sys.path; submodules are looked up only in their parent package's
+// directory. A name starting with '.' is relative to the importing module's
+// package, as in Python.
+
+// moduleSpec records where a loaded module came from.
+type moduleSpec struct {
+	file string // source file run as the module body, "" for a namespace package
+	dir  string // for a package, the directory holding its submodules; "" otherwise
+
+	modTime time.Time // file's modification time when it was last run, for SetWatch
+}
+
+// moduleSpecs is keyed by absolute module name and guarded by moduleCacheMu,
+// like globalModules. An entry is added before the module body runs, so
+// relative imports made while it is still initialising resolve correctly.
+var moduleSpecs = map[string]moduleSpec{}
+
+// modulesLoading holds the modules whose bodies are still running, guarded
+// by moduleCacheMu. Such a module is already in globalModules, so an import
+// cycle hands the importer the partially initialised module instead of
+// loading it again. The value describes the cycle once one is detected, e.g.
+// "a -> b -> a", and is "" until then.
+var modulesLoading = map[string]string{}
+
+// defaultSearchPath builds the initial sys.path: each LOX_PATH entry (a
+// list separated by ':', or ';' on Windows), then the directory of the main
+// script. An entry naming a glox checkout contributes its standard library
+// directory, src/modules, so the long-standing single-directory LOX_PATH
+// keeps working.
+func defaultSearchPath(script string) []string {
+
+	var path []string
+	for _, dir := range filepath.SplitList(os.Getenv("LOX_PATH")) {
+		if dir == "" {
+			continue
+		}
+		if isDir(dir + "/src/modules") {
+			dir = dir + "/src/modules"
+		}
+		path = append(path, dir)
+	}
+	return append(path, scriptDir(script))
+}
+
+// scriptDir returns the directory part of a script path, "." if it has none.
+func scriptDir(script string) string {
+
+	if idx := strings.LastIndexAny(script, "/\\"); idx >= 0 {
+		return script[:idx]
+	}
+	return "."
+}
+
+// makeSysPath stores the default search path in the sys module as sys.path.
+func makeSysPath(vm *VM) {
+
+	var items []core.Value
+	for _, dir := range defaultSearchPath(vm.script) {
+		items = append(items, core.MakeStringObjectValue(dir, false))
+	}
+	sys := vm.BuiltInModules[core.InternName("sys")]
+	sys.Environment.SetVar(core.InternName("path"), core.MakeObjectValue(core.MakeListObject(items, false), false))
+}
+
+// searchPath returns the directories top-level imports are resolved against:
+// the current contents of sys.path, ignoring any non-string entries a
+// script may have added. A VM without a sys module (built-ins not defined)
+// falls back to the default path. A sandboxed VM keeps to the path it was
+// given when sandboxed.
+func (vm *VM) searchPath() []string {
+
+	if vm.sandbox != nil {
+		return vm.sandbox.path
+	}
+	if sys, ok := vm.BuiltInModules[core.InternName("sys")]; ok {
+		if v, ok := sys.Environment.GetVar(core.InternName("path")); ok && v.IsObj() && v.ObjType() == core.OBJECT_LIST {
+			var dirs []string
+			for _, item := range v.AsList().Items {
+				if item.IsStringObject() {
+					dirs = append(dirs, item.AsString().Get())
+				}
+			}
+			return dirs
+		}
+	}
+	return defaultSearchPath(vm.script)
+}
+
+// findModule looks for the single name component in each of dirs in order.
+// Within a directory a regular package (name/__init__.lox) wins over a
+// module file (name.lox); a bare directory is a namespace package, used
+// only if nothing else matches anywhere. It returns the spec found, and
+// every location tried for the error message if nothing was.
+func findModule(dirs []string, name string) (moduleSpec, bool, []string) {
+
+	var tried []string
+	namespace := ""
+	for _, dir := range dirs {
+		pkgDir := dir + "/" + name
+		initFile := pkgDir + "/__init__.lox"
+		if isFile(initFile) {
+			return moduleSpec{file: initFile, dir: pkgDir}, true, nil
+		}
+		modFile := pkgDir + ".lox"
+		if isFile(modFile) {
+			return moduleSpec{file: modFile}, true, nil
+		}
+		if namespace == "" && isDir(pkgDir) {
+			namespace = pkgDir
+		}
+		tried = append(tried, initFile, modFile)
+	}
+	if namespace != "" {
+		return moduleSpec{dir: namespace}, true, nil
+	}
+	return moduleSpec{}, false, tried
+}
+
+// findModuleInSubdirs recursively searches root for "<module>.lox" files,
+// skipping bytecode cache directories, and returns the paths of all it
+// finds, in WalkDir's lexical order. This predates packages and is kept as
+// a last resort for bare top-level names only; more than one match makes
+// the import ambiguous rather than picking one.
+func findModuleInSubdirs(root string, module string) []string {
+	target := module + ".lox"
+	var found []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "__loxcache__" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == target {
+			found = append(found, strings.ReplaceAll(path, "\\", "/"))
+		}
+		return nil
+	})
+	return found
+}
+
+// FindModuleFile locates the source file an import of name from the script
+// importer would load, without running anything, for tools such as the
+// language server. Top-level names are searched along the default search
+// path for importer, falling back to its subdirectories as loadModule does
+// when just one of them holds the module; a relative name is taken relative
+// to importer's own directory, each extra leading dot going up one level. A
+// built-in module or a namespace package has no file, and reports false
+// like a module that is not found.
+func FindModuleFile(importer, name string) (string, bool) {
+
+	level := len(name) - len(strings.TrimLeft(name, "."))
+	parts := strings.Split(name[level:], ".")
+	dirs := defaultSearchPath(importer)
+	if level > 0 {
+		dir := scriptDir(importer)
+		for i := 1; i < level; i++ {
+			dir = filepath.Dir(dir)
+		}
+		if parts[0] == "" {
+			// `from . import x` names the package itself
+			initFile := dir + "/__init__.lox"
+			return initFile, isFile(initFile)
+		}
+		dirs = []string{dir}
+	}
+
+	var spec moduleSpec
+	for i, part := range parts {
+		found := false
+		spec, found, _ = findModule(dirs, part)
+		if !found && i == 0 && level == 0 && len(parts) == 1 {
+			if files := findModuleInSubdirs(scriptDir(importer), name); len(files) == 1 {
+				return files[0], true
+			}
+		}
+		if !found || (i < len(parts)-1 && spec.dir == "") {
+			return "", false
+		}
+		dirs = []string{spec.dir}
+	}
+	return spec.file, spec.file != ""
+}
+
+// absoluteModuleName resolves a relative module name (".util", "..core.io",
+// ".") against the package of the module currently executing. Absolute
+// names are returned unchanged.
+func (vm *VM) absoluteModuleName(name string) (string, error) {
+
+	if !strings.HasPrefix(name, ".") {
+		return name, nil
+	}
+	level := len(name) - len(strings.TrimLeft(name, "."))
+	rest := name[level:]
+
+	current := vm.frame().Closure.Function.Environment.Name
+	moduleCacheMu.Lock()
+	spec, ok := moduleSpecs[current]
+	moduleCacheMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("attempted relative import '%s' with no known parent package", name)
+	}
+	pkg := current
+	if spec.dir == "" {
+		// a plain module's package is its parent
+		pkg = ""
+		if idx := strings.LastIndex(current, "."); idx >= 0 {
+			pkg = current[:idx]
+		}
+	}
+	for i := 1; i < level && pkg != ""; i++ {
+		pkg = pkg[:max(strings.LastIndex(pkg, "."), 0)]
+	}
+	if pkg == "" {
+		return "", fmt.Errorf("attempted relative import '%s' beyond top-level package", name)
+	}
+	if rest == "" {
+		return pkg, nil
+	}
+	return pkg + "." + rest, nil
+}
+
+// isPackage reports whether the loaded module name is a package.
+func (vm *VM) isPackage(name string) bool {
+
+	moduleCacheMu.Lock()
+	defer moduleCacheMu.Unlock()
+	return moduleSpecs[name].dir != ""
+}
+
+// isLoading reports whether the module name's body is still running.
+func isLoading(name string) bool {
+
+	moduleCacheMu.Lock()
+	defer moduleCacheMu.Unlock()
+	_, loading := modulesLoading[name]
+	return loading
+}
+
+func isFile(path string) bool {
+
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func isDir(path string) bool {
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// importCycle describes the import cycle closed by this VM importing name,
+// or returns "" if name is not on its import chain (the module is being
+// loaded by another thread, say).
+func (vm *VM) importCycle(name string) string {
+
+	for i, n := range vm.importChain {
+		if n == name {
+			return strings.Join(append(vm.importChain[i:len(vm.importChain):len(vm.importChain)], name), " -> ")
+		}
+	}
+	return ""
+}
+
+// syncModuleVars copies a module's defined global slots into its Vars map,
+// which is what module property access and `from ... import` read.
+func syncModuleVars(env *core.Environment) {
+
+	for slot, gname := range env.GlobalNames {
+		if slot < len(env.Defined) && env.Defined[slot] {
+			env.SetVar(core.InternName(gname), env.Globals[slot])
+		}
+	}
+}
+
+// moduleAttr looks up a name on a module. Vars are only synced from the
+// global slots once the module body finishes, so for a module that is still
+// initialising the slots themselves are consulted as well.
+func moduleAttr(module *core.ModuleObject, id int) (core.Value, bool) {
+
+	env := module.Environment
+	if v, ok := env.GetVar(id); ok {
+		return v, true
+	}
+	if isLoading(module.Name) {
+		if slot := env.SlotForName(core.NameFromID(id)); slot >= 0 && slot < len(env.Defined) && env.Defined[slot] {
+			return env.Globals[slot], true
+		}
+	}
+	return core.Value{}, false
+}
+
+// partialModuleError raises an ImportError if module is still initialising,
+// which is why name could not be found on it, and reports whether it did.
+func (vm *VM) partialModuleError(module *core.ModuleObject, name string) bool {
+
+	moduleCacheMu.Lock()
+	cycle, loading := modulesLoading[module.Name]
+	moduleCacheMu.Unlock()
+	if !loading {
+		return false
+	}
+	if cycle != "" {
+		vm.RunTimeErrorNamed("ImportError", "cannot access '%s' from partially initialised module '%s' (circular import: %s)", name, module.Name, cycle)
+	} else {
+		vm.RunTimeErrorNamed("ImportError", "cannot access '%s' from partially initialised module '%s'", name, module.Name)
+	}
+	return true
+}
@@ -0,0 +1,321 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"glox/src/compiler"
+	"glox/src/core"
+)
+
+// Hot reloading of modules.
+//
+// Reloading a module compiles its source afresh -- never from the .lxc
+// cache, whose timestamps are too coarse to be trusted for a file saved a
+// moment ago -- and runs the body in a new environment, which then becomes
+// the module's. Values the body defines are new, as on a first import, but
+// a function or class defined by the same name before and after keeps its
+// identity: the old closure is given the new code and the old class the new
+// method tables, so references held elsewhere -- `from m import f`, bound
+// methods, instances -- see the new code. A function running at the time,
+// or suspended in a fiber or task, is the exception: it finishes with the
+// code it started with, and keeps it. If the new source doesn't compile, or
+// its body raises, the module is left as it was.
+
+// watchInterval is how often SetWatch checks module files for changes.
+const watchInterval = 250 * time.Millisecond
+
+// watcher is what SetWatch runs: a goroutine polling the files of the loaded
+// modules, which sets changed for the VM to act on at its next backward
+// jump.
+type watcher struct {
+	changed atomic.Bool
+	stop    chan struct{}
+}
+
+// SetWatch turns watching the files of loaded modules on or off. While it is
+// on, a module whose file changes is reloaded, as by sys.reload, the next
+// time the script goes round a loop. Compile errors and exceptions from the
+// new source are reported on stderr and leave the module as it was, so a
+// long-running loop survives a bad edit. Threads the script spawns don't
+// reload modules themselves, but see the reloaded functions and classes.
+func (vm *VM) SetWatch(on bool) {
+
+	if vm.watch != nil {
+		close(vm.watch.stop)
+		vm.watch = nil
+	}
+	if on {
+		vm.watch = &watcher{stop: make(chan struct{})}
+		go vm.watch.poll()
+	}
+}
+
+func (w *watcher) poll() {
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if len(changedModules()) > 0 {
+				w.changed.Store(true)
+			}
+		}
+	}
+}
+
+// changedModules returns the names of the loaded modules whose files have
+// changed since they were last run.
+func changedModules() []string {
+
+	moduleCacheMu.Lock()
+	specs := map[string]moduleSpec{}
+	for name, spec := range moduleSpecs {
+		if _, loading := modulesLoading[name]; !loading && spec.file != "" {
+			specs[name] = spec
+		}
+	}
+	moduleCacheMu.Unlock()
+	var changed []string
+	for name, spec := range specs {
+		if !fileModTime(spec.file).Equal(spec.modTime) {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+func fileModTime(path string) time.Time {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadChanged reloads the modules whose files have changed, reporting
+// what became of each on stderr.
+func (vm *VM) reloadChanged() {
+
+	vm.watch.changed.Store(false)
+	for _, name := range changedModules() {
+		moduleCacheMu.Lock()
+		module := globalModules[name]
+		moduleCacheMu.Unlock()
+		if module == nil {
+			continue
+		}
+		if err := vm.reloadModule(module); err != nil {
+			fmt.Fprintf(vm.stderr, "Reloading module %s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(vm.stderr, "Reloaded module %s.\n", name)
+		}
+	}
+}
+
+// ReloadModule implements sys.reload: it reloads module, raising
+// ImportError if it can't be, or the exception its body raised.
+func (vm *VM) ReloadModule(module *core.ModuleObject) bool {
+
+	err := vm.reloadModule(module)
+	if e, ok := err.(*moduleRunError); ok {
+		vm.reraiseModuleError(e.subvm)
+		return false
+	}
+	if err != nil {
+		vm.RunTimeErrorNamed("ImportError", "Cannot reload module '%s': %v.", module.Name, err)
+		return false
+	}
+	return true
+}
+
+// moduleRunError is a module body failing with an exception it didn't
+// handle, or a runtime error.
+type moduleRunError struct {
+	subvm *VM
+}
+
+func (e *moduleRunError) Error() string {
+
+	exc := e.subvm.uncaught
+	if exc == nil {
+		return e.subvm.ErrorMsg
+	}
+	msg, _ := exc.GetField(core.MSG)
+	if msg.IsStringObject() {
+		return exc.Class.Name.Get() + ": " + msg.AsString().Get()
+	}
+	return exc.Class.Name.Get() + ": " + msg.String()
+}
+
+// reloadModule runs module's source again and swaps the result in, as the
+// comment at the top of this file describes. Compile errors are reported as
+// an import's are.
+func (vm *VM) reloadModule(module *core.ModuleObject) error {
+
+	name := module.Name
+	moduleCacheMu.Lock()
+	spec, known := moduleSpecs[name]
+	_, loading := modulesLoading[name]
+	if known && globalModules[name] != module {
+		known = false
+	}
+	if known && !loading {
+		// record the time now, so a failed reload isn't retried until the
+		// file changes again
+		spec.modTime = fileModTime(spec.file)
+		moduleSpecs[name] = spec
+		modulesLoading[name] = ""
+	}
+	moduleCacheMu.Unlock()
+	if !known {
+		return fmt.Errorf("it is not a module loaded from a file")
+	}
+	if loading {
+		return fmt.Errorf("it is still loading")
+	}
+	defer func() {
+		moduleCacheMu.Lock()
+		delete(modulesLoading, name)
+		moduleCacheMu.Unlock()
+	}()
+	if spec.file == "" {
+		return nil
+	}
+	source, err := os.ReadFile(spec.file)
+	if err != nil {
+		return err
+	}
+	function, diags := compiler.Compile(spec.file, string(source), name)
+	if vm.reportDiagnostics(diags) || function == nil {
+		return fmt.Errorf("%s doesn't compile", spec.file)
+	}
+	subvm := vm.moduleVM(spec.file, name)
+	b := new(bytes.Buffer)
+	function.Chunk.Serialise(b)
+	writeToLxc(subvm, b)
+	chunk, env := function.Chunk, function.Environment
+	chunk.Filename = name
+	env.Name = name
+	if res := subvm.callLoadedChunk(name, env, chunk); res != INTERPRET_OK {
+		return &moduleRunError{subvm: subvm}
+	}
+	syncModuleVars(env)
+	vm.swapModule(module, env)
+	moduleCacheMu.Lock()
+	globalModuleSource[name] = string(source)
+	globalModuleSource[spec.file] = string(source)
+	moduleCacheMu.Unlock()
+	return nil
+}
+
+// swapModule makes env, from a new run of module's body, the module's
+// environment, keeping the identity of the functions and classes the old
+// one had by the same names. The submodules a package had are kept too.
+func (vm *VM) swapModule(module *core.ModuleObject, env *core.Environment) {
+
+	old := module.Environment.VarsSnapshot()
+	running := vm.runningClosures()
+	classes := map[*core.ClassObject]*core.ClassObject{} // new class -> the old one it replaces
+	for slot, gname := range env.GlobalNames {
+		if slot >= len(env.Defined) || !env.Defined[slot] {
+			continue
+		}
+		id := core.InternName(gname)
+		prev, ok := old[id]
+		v := env.Globals[slot]
+		if !ok || !prev.IsObj() || !v.IsObj() || prev.ObjType() != v.ObjType() {
+			continue
+		}
+		switch v.ObjType() {
+		case core.OBJECT_CLOSURE:
+			if !swapClosure(prev.AsClosure(), v.AsClosure(), running) {
+				continue
+			}
+		case core.OBJECT_CLASS:
+			classes[v.AsClass()] = prev.AsClass()
+		default:
+			continue
+		}
+		env.SetGlobal(slot, prev)
+		env.SetVar(id, prev)
+	}
+	for newClass, oldClass := range classes {
+		swapClass(oldClass, newClass, classes, running)
+	}
+	for id, v := range old {
+		if _, ok := env.GetVar(id); !ok && v.IsObj() && v.ObjType() == core.OBJECT_MODULE {
+			env.SetVar(id, v)
+		}
+	}
+	module.Environment = env
+	core.ClassesChanged()
+}
+
+// swapClosure gives old the code of new, unless old is running. It reports
+// whether it did.
+func swapClosure(old, new *core.ClosureObject, running map[*core.ClosureObject]bool) bool {
+
+	if old == new || running[old] {
+		return false
+	}
+	old.Function, old.Upvalues, old.UpvalueCount = new.Function, new.Upvalues, new.UpvalueCount
+	return true
+}
+
+// swapClass gives old the methods, static methods and class variables of
+// new, swapping the methods it had by the same names in place. classes maps
+// the new classes of the module to the old ones, for its superclass.
+func swapClass(old, new *core.ClassObject, classes map[*core.ClassObject]*core.ClassObject, running map[*core.ClosureObject]bool) {
+
+	for _, methods := range [][2]map[int]core.Value{{old.Methods, new.Methods}, {old.StaticMethods, new.StaticMethods}} {
+		for id, m := range methods[1] {
+			prev, ok := methods[0][id]
+			if ok && prev.IsClosureObject() && m.IsClosureObject() && swapClosure(prev.AsClosure(), m.AsClosure(), running) {
+				methods[1][id] = prev
+			}
+		}
+	}
+	old.Methods, old.StaticMethods = new.Methods, new.StaticMethods
+	old.SetStatics(new.StaticsSnapshot())
+	old.Super = new.Super
+	if super, ok := classes[new.Super]; ok {
+		old.Super = super
+	}
+}
+
+// runningClosures returns the closures with frames on the stacks of this VM
+// and of those importing it, or set aside by their suspended fibers and
+// tasks, which resume where they left off in the code they started with.
+func (vm *VM) runningClosures() map[*core.ClosureObject]bool {
+
+	running := map[*core.ClosureObject]bool{}
+	add := func(frames []core.CallFrame) {
+		for _, frame := range frames {
+			running[frame.Closure] = true
+		}
+	}
+	for v := vm; v != nil; v = v.importer {
+		add(v.Frames[:v.frameCount])
+		if v.fibers != nil {
+			for _, f := range v.fibers.fibers {
+				add(f.frames)
+			}
+		}
+		if v.loop != nil {
+			for t := range v.loop.tasks {
+				add(t.frames)
+			}
+		}
+	}
+	return running
+}
@@ -0,0 +1,93 @@
+package vm
+
+import "glox/src/core"
+
+// Sandbox is what SetSandbox confines a VM running untrusted scripts to.
+type Sandbox struct {
+	// Modules are the built-in modules scripts may import and call into.
+	// Nil means DefaultSandboxModules.
+	Modules []string
+	// FS is what the os module's file operations go through, such as a
+	// core.RootFileSystem confining them to one directory. Nil allows none.
+	FS core.FileSystem
+	// MaxMemory, if not 0, is passed to SetMemoryLimit.
+	MaxMemory int
+}
+
+// DefaultSandboxModules are the built-in modules a sandbox allows unless
+// told otherwise: all but process and thread, which would escape it, and
+// gfx, which opens windows and writes image files.
+var DefaultSandboxModules = []string{"sys", "inspect", "colour_utils", "os", "physics", "re", "pickle", "sync", "fiber", "asyncio"}
+
+// sandbox is a Sandbox as a VM applies it.
+type sandbox struct {
+	denied map[string]bool // the built-in modules it doesn't allow
+	fs     core.FileSystem
+	path   []string // the module search path, fixed by SetSandbox
+}
+
+// SetSandbox confines this VM, and the modules it imports and threads it
+// spawns, to sb. Importing a built-in module it doesn't allow, calling a
+// function of one reached some other way, or a file operation outside sb.FS
+// raises PermissionError; going over sb.MaxMemory raises MemoryError.
+// Modules the host registers after SetSandbox are allowed.
+//
+// Modules are still loaded from the host's files, since the standard
+// library and the script's own modules are outside sb.FS, so the search
+// path is fixed at what sys.path holds now: a script changing sys.path
+// doesn't change where its imports come from. Nor are modules run from, or
+// their bytecode written to, the .lxc cache, which the script could have
+// forged.
+func (vm *VM) SetSandbox(sb Sandbox) {
+
+	modules := sb.Modules
+	if modules == nil {
+		modules = DefaultSandboxModules
+	}
+	allowed := map[string]bool{}
+	for _, m := range modules {
+		allowed[m] = true
+	}
+	s := &sandbox{denied: map[string]bool{}, fs: sb.FS, path: vm.searchPath()}
+	for id := range vm.BuiltInModules {
+		if name := core.NameFromID(id); !allowed[name] {
+			s.denied[name] = true
+		}
+	}
+	if s.fs == nil {
+		s.fs = core.NoFileSystem{}
+	}
+	vm.sandbox = s
+	if sb.MaxMemory > 0 {
+		vm.SetMemoryLimit(sb.MaxMemory)
+	}
+}
+
+// Sandboxed reports whether SetSandbox has confined this VM.
+func (vm *VM) Sandboxed() bool {
+	return vm.sandbox != nil
+}
+
+// inheritSandbox gives a VM created to run on vm's behalf -- a thread or an
+// imported module -- vm's sandbox.
+func (vm *VM) inheritSandbox(from *VM) {
+	vm.sandbox = from.sandbox
+}
+
+// moduleDenied reports whether the sandbox keeps scripts from the built-in
+// module name, having raised PermissionError if it does.
+func (vm *VM) moduleDenied(name string) bool {
+	if vm.sandbox == nil || !vm.sandbox.denied[name] {
+		return false
+	}
+	vm.RunTimeErrorNamed("PermissionError", "Module '%s' is not available in the sandbox.", name)
+	return true
+}
+
+// FileSystem returns what the os module's file operations go through.
+func (vm *VM) FileSystem() core.FileSystem {
+	if vm.sandbox != nil {
+		return vm.sandbox.fs
+	}
+	return core.HostFileSystem{}
+}
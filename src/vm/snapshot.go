@@ -0,0 +1,209 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"glox/src/core"
+)
+
+// Snapshot is the state of a VM's script and of the modules loaded, taken by
+// VM.Snapshot: the values of their globals and what those reach, down to
+// lists, dicts, instances, closures and the statics of classes. Compiled
+// code, classes, modules and built-ins are referred to, not copied.
+type Snapshot struct {
+	vm     *VM
+	script *core.Environment
+	image  *core.Image
+}
+
+// Snapshot captures the globals of the script this VM last ran and of every
+// module loaded, and what they reach, so Restore can put them back. It
+// can't be taken while the VM is running, nor before it has run a script.
+// Modules are shared by the VMs of a process, so restoring a snapshot puts
+// theirs back for all of them; threads still running see the change part
+// way through.
+func (vm *VM) Snapshot() (*Snapshot, error) {
+
+	if vm.entered > 0 {
+		return nil, errors.New("cannot snapshot a running VM")
+	}
+	if vm.globals == nil {
+		return nil, errors.New("cannot snapshot a VM that hasn't run a script")
+	}
+	envs := append([]*core.Environment{vm.globals}, loadedModuleEnvironments()...)
+	return &Snapshot{vm: vm, script: vm.globals, image: core.CaptureImage(envs)}, nil
+}
+
+// Restore puts the globals captured by s back, and makes the script s was
+// taken of this VM's script again, for Call and GetGlobals. A snapshot can
+// be restored any number of times; what the script does after one restore
+// doesn't change what the next puts back. Modules loaded since s was taken
+// stay loaded, as they were.
+func (vm *VM) Restore(s *Snapshot) error {
+
+	if s.vm != vm {
+		return errors.New("cannot restore a snapshot of another VM")
+	}
+	if vm.entered > 0 {
+		return errors.New("cannot restore a running VM")
+	}
+	vm.globals = s.script
+	s.image.Restore()
+	return nil
+}
+
+// WriteTo writes s in an on-disk format extending pickle's, for ReadSnapshot.
+// Functions are written as their place in the compiled script or module,
+// and classes as the global they are bound to, so reading it back needs the
+// same script and modules. It fails on values that can't be written, such
+// as files, threads or instances of classes that aren't globals.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+
+	data, err := s.image.Encode(newSnapshotLinker(s.vm, s.script))
+	if err != nil {
+		return 0, fmt.Errorf("snapshot: %w", err)
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// ReadSnapshot reads a snapshot written by WriteTo, for Restore. This VM
+// must have run the script it was taken of, and loaded its modules, first:
+// functions and classes are found in those by the place and the name they
+// were written with, so one changed since fails to read.
+func (vm *VM) ReadSnapshot(r io.Reader) (*Snapshot, error) {
+
+	if vm.globals == nil {
+		return nil, errors.New("cannot read a snapshot into a VM that hasn't run a script")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := core.DecodeImage(data, newSnapshotLinker(vm, vm.globals))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return &Snapshot{vm: vm, script: vm.globals, image: img}, nil
+}
+
+// loadedModuleEnvironments returns the environments of the modules loaded,
+// by name, leaving out those whose bodies are still running.
+func loadedModuleEnvironments() []*core.Environment {
+
+	moduleCacheMu.Lock()
+	defer moduleCacheMu.Unlock()
+	var envs []*core.Environment
+	for _, name := range slices.Sorted(maps.Keys(globalModules)) {
+		if _, loading := modulesLoading[name]; loading {
+			continue
+		}
+		if env := globalModules[name].Environment; env != nil {
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
+//------------------------------------------------------------------------------------------
+
+// snapshotLinker names what a snapshot refers to rather than holds (see
+// core.Linker): built-ins and built-in modules by name, modules by theirs,
+// functions by the script or module compiled with them and their place in
+// its chunk's constants, and classes by the global bound to them.
+type snapshotLinker struct {
+	names   map[core.Object]string
+	objects map[string]core.Object
+	envs    map[string]*core.Environment
+}
+
+func newSnapshotLinker(vm *VM, script *core.Environment) *snapshotLinker {
+
+	l := &snapshotLinker{names: map[core.Object]string{}, objects: map[string]core.Object{}, envs: map[string]*core.Environment{}}
+	for _, id := range slices.Sorted(maps.Keys(vm.BuiltIns)) {
+		if v := vm.BuiltIns[id]; v.IsObj() {
+			l.add("builtin:"+core.NameFromID(id), v.Obj())
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(vm.BuiltInModules)) {
+		module := vm.BuiltInModules[id]
+		l.add("module:"+module.Name, module)
+		vars := module.Environment.VarsSnapshot()
+		for _, member := range slices.Sorted(maps.Keys(vars)) {
+			if v := vars[member]; v.IsObj() {
+				l.add("builtin:"+module.Name+"."+core.NameFromID(member), v.Obj())
+			}
+		}
+	}
+	envs := append([]*core.Environment{script}, loadedModuleEnvironments()...)
+	moduleCacheMu.Lock()
+	for _, name := range slices.Sorted(maps.Keys(globalModules)) {
+		l.add("module:"+name, globalModules[name])
+	}
+	moduleCacheMu.Unlock()
+	for _, env := range envs {
+		l.envs[env.Name] = env
+		l.addFunctions(env)
+	}
+	for _, env := range envs {
+		for slot, v := range env.Globals {
+			if slot < len(env.GlobalNames) && env.Defined[slot] && v.IsObj() && v.ObjType() == core.OBJECT_CLASS {
+				l.add("class:"+env.Name+"."+env.GlobalNames[slot], v.Obj())
+			}
+		}
+	}
+	return l
+}
+
+// add names o, unless it already has a name.
+func (l *snapshotLinker) add(name string, o core.Object) {
+	if _, ok := l.names[o]; ok {
+		return
+	}
+	if _, ok := l.objects[name]; ok {
+		return
+	}
+	l.names[o] = name
+	l.objects[name] = o
+}
+
+// addFunctions names the functions compiled with env's script or module,
+// numbering them in the order a walk of its chunk's constants finds them.
+func (l *snapshotLinker) addFunctions(env *core.Environment) {
+
+	if env.Chunk == nil {
+		return
+	}
+	n := 0
+	var walk func(chunk *core.Chunk)
+	walk = func(chunk *core.Chunk) {
+		for _, c := range chunk.Constants {
+			if c.IsObj() && c.ObjType() == core.OBJECT_FUNCTION {
+				fn := c.AsFunction()
+				l.add(fmt.Sprintf("func:%s:%d:%s", env.Name, n, fn.Name.Get()), fn)
+				n++
+				walk(fn.Chunk)
+			}
+		}
+	}
+	walk(env.Chunk)
+}
+
+func (l *snapshotLinker) LinkName(o core.Object) (string, bool) {
+	name, ok := l.names[o]
+	return name, ok
+}
+
+func (l *snapshotLinker) LinkObject(name string) (core.Object, bool) {
+	o, ok := l.objects[name]
+	return o, ok
+}
+
+func (l *snapshotLinker) LinkEnvironment(name string) (*core.Environment, bool) {
+	env, ok := l.envs[name]
+	return env, ok
+}
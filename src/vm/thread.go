@@ -31,8 +31,8 @@ func (vm *VM) SpawnThread(closureVal core.Value, args []core.Value) (*core.Threa
 		// correct fix is disallowing spawn() from the REPL entirely.
 		return nil, fmt.Errorf("thread.spawn() is not supported from the REPL")
 	}
-	closure, ok := closureVal.Obj.(*core.ClosureObject)
-	if closureVal.Type != core.VAL_OBJ || !ok {
+	closure, ok := closureVal.Obj().(*core.ClosureObject)
+	if !closureVal.IsObj() || !ok {
 		return nil, fmt.Errorf("thread.spawn() argument must be a function")
 	}
 
@@ -51,6 +51,10 @@ func (vm *VM) SpawnThread(closureVal core.Value, args []core.Value) (*core.Threa
 	worker := NewVM(vm.script, false)
 	worker.BuiltIns = vm.BuiltIns
 	worker.BuiltInModules = vm.BuiltInModules
+	worker.inheritStreams(vm)
+	worker.inheritLimits(vm)
+	worker.inheritSandbox(vm)
+	worker.inheritMemoryLimit(vm)
 	worker.SetArgs(vm.Args())
 	worker.threadChans = &core.ThreadChannels{
 		In:        toWorker,
@@ -148,21 +152,42 @@ func (vm *VM) ThreadChannels() (*core.ThreadChannels, bool) {
 // unconditionally calls refreshFrame() after any call returns (native or
 // closure), so a builtin invoking this mid-dispatch is safe by
 // construction.
+//
+// It leaves the stack and frames as it found them, even on an error: the
+// exception floor stops unwinding at the call's own frame, which would
+// otherwise stay pushed under the caller. It starts from a clean stack
+// trace and uncaught exception, so after an error those describe this call
+// (which pkg/glox relies on, calling in from Go between runs as well).
 func (vm *VM) CallClosure(closureVal core.Value, args []core.Value) (core.Value, error) {
-	closure, ok := closureVal.Obj.(*core.ClosureObject)
-	if closureVal.Type != core.VAL_OBJ || !ok {
+	closure, ok := closureVal.Obj().(*core.ClosureObject)
+	if !closureVal.IsObj() || !ok {
 		return core.NIL_VALUE, fmt.Errorf("expected a function, got %s", closureVal.String())
 	}
+	base, frameCount := vm.stackTop, vm.frameCount
+	if vm.entered == 0 {
+		vm.startRun() // called from Go rather than from a builtin the script called
+	}
+	vm.entered++
+	defer func() { vm.entered-- }()
+	vm.stackTrace = nil
+	vm.uncaught = nil
+	unwind := func() {
+		vm.closeUpvalues(base)
+		vm.stackTop, vm.frameCount = base, frameCount
+	}
 	vm.push(closureVal)
 	for _, a := range args {
 		vm.push(a)
 	}
 	if !vm.call(closure, len(args)) {
+		unwind()
 		return core.NIL_VALUE, fmt.Errorf("%s", vm.ErrorMsg)
 	}
 	res, retVal := vm.run(RUN_CURRENT_FUNCTION)
 	if res != INTERPRET_OK {
+		unwind()
 		return core.NIL_VALUE, fmt.Errorf("%s", vm.ErrorMsg)
 	}
+	vm.stackTop = base // run leaves the result in the closure's slot; it's returned instead
 	return retVal, nil
 }
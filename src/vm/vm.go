@@ -6,7 +6,7 @@ import (
 	"glox/src/compiler"
 	"glox/src/core"
 	"glox/src/debug"
-	"io/fs"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -22,6 +22,7 @@ const (
 	INTERPRET_OK InterpretResult = iota
 	INTERPRET_COMPILE_ERROR
 	INTERPRET_RUNTIME_ERROR
+	INTERPRET_INTERRUPTED // stopped by its instruction budget or context; see Interrupted
 )
 
 type VMRunMode int
@@ -52,8 +53,39 @@ type VM struct {
 	// conversion (at the End: label) should raise; empty means "RunTimeError".
 	// Set via RunTimeErrorNamed, cleared by RunTimeError and once consumed.
 	pendingExceptionClass string
+	// pendingException, when set along with ErrorMsg, is raised as it is
+	// instead, as when fiber.tick() passes on a fiber's exception (see
+	// RunTimeErrorInstance).
+	pendingException *core.InstanceObject
 	stackTrace            []string
 	ModuleImport   bool
+	importChain    []string // names of the modules being imported on the way to this VM, outermost first
+	uncaught       *core.InstanceObject // the exception that ended the last run, if one escaped
+	globals        *core.Environment    // the environment of the script Interpret last ran
+
+	// stdin, stdout and stderr are this VM's standard streams (os.Stdin etc.
+	// unless set with SetStdin and co), and stdFiles the files that the sys
+	// module's stream placeholders resolve to on it, indexed by core.StdStream.
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	stdFiles       [4]*core.FileObject
+
+	limits *limits // the budget and context runs are held to, nil for none; see limits.go
+	watch  *watcher // what SetWatch turned on, nil when module files aren't watched; see reload.go
+	entered int    // Interpret and CallClosure calls under way, so those from Go can be told from nested ones
+
+	sandbox  *sandbox       // what SetSandbox confines scripts to, nil for nothing; see sandbox.go
+	memory   *memoryAccount // what SetMemoryLimit holds allocations to, nil for no limit; see memory.go
+	fibers   *scheduler     // the fibers spawned on this VM, nil until one is; see fiber.go
+	loop     *eventLoop     // the event loop its tasks run on, nil until a task or future needs one; see async.go
+	importer *VM            // the VM importing this one as a module, nil for a script or thread
+
+	// ReportDiagnostics receives the diagnostics from compiling the script and
+	// each module it imports. If nil they are printed to stdout as text.
+	ReportDiagnostics func(diags []compiler.Diagnostic)
+	// Warnings selects which compiler warnings are reported and which are
+	// treated as errors (the -W flags). Nil reports none.
+	Warnings compiler.WarningConfig
 	BuiltIns       map[int]core.Value         // global built-in functions
 	BuiltInModules map[int]*core.ModuleObject // global built-in modules - need to be imported before use
 
@@ -123,6 +155,9 @@ func NewVM(script string, defineBuiltIns bool) *VM {
 		BuiltInModules: make(map[int]*core.ModuleObject),
 		exceptionFloor: 1,
 	}
+	vm.SetStdin(os.Stdin)
+	vm.SetStdout(os.Stdout)
+	vm.SetStderr(os.Stderr)
 	vm.resetStack()
 	if defineBuiltIns && !core.DebugCompileOnly {
 		DefineBuiltIns(vm)
@@ -138,11 +173,98 @@ func (vm *VM) SetRepl(b bool) {
 	vm.Repl = b
 }
 
+// SetScript sets the path of the script this VM runs, which imports are resolved
+// relative to and stack traces name.
+func (vm *VM) SetScript(script string) {
+	vm.script = script
+}
+
 // SetArgs sets the command-line arguments that will be available to the running Lox script.
 func (vm *VM) SetArgs(args []string) {
 	vm.args = args
 }
 
+// SetStdout sends this VM's standard output -- print, and os.write to
+// sys.stdout, while the script leaves sys.stdout alone -- to w. Threads
+// spawned afterwards share it.
+func (vm *VM) SetStdout(w io.Writer) {
+	vm.stdout = w
+	vm.stdFiles[core.STDOUT] = core.MakeStreamFileObject(nil, w)
+}
+
+// SetStderr sends this VM's error output -- stack traces, and os.write to
+// sys.stderr -- to w.
+func (vm *VM) SetStderr(w io.Writer) {
+	vm.stderr = w
+	vm.stdFiles[core.STDERR] = core.MakeStreamFileObject(nil, w)
+}
+
+// SetStdin makes r what os.readln(sys.stdin) reads.
+func (vm *VM) SetStdin(r io.Reader) {
+	vm.stdin = r
+	vm.stdFiles[core.STDIN] = core.MakeStreamFileObject(r, nil)
+}
+
+// Stdout returns the writer set by SetStdout, for host output that belongs
+// with the script's, such as compiler diagnostics and error messages.
+func (vm *VM) Stdout() io.Writer {
+	return vm.stdout
+}
+
+// Stderr returns the writer set by SetStderr.
+func (vm *VM) Stderr() io.Writer {
+	return vm.stderr
+}
+
+// inheritStreams gives a VM created to run on vm's behalf -- a thread or an
+// imported module -- vm's standard streams.
+func (vm *VM) inheritStreams(from *VM) {
+	vm.stdin, vm.stdout, vm.stderr = from.stdin, from.stdout, from.stderr
+	vm.stdFiles = from.stdFiles
+}
+
+var sysModuleName = core.InternName("sys")
+
+var stdStreamNames = [...]int{
+	core.STDIN:  core.InternName("stdin"),
+	core.STDOUT: core.InternName("stdout"),
+	core.STDERR: core.InternName("stderr"),
+}
+
+// makeSysStreams defines sys.stdin, sys.stdout and sys.stderr as the
+// placeholders for the standard streams. Assigning another file to one
+// redirects it: print writes to whatever sys.stdout names.
+func makeSysStreams(vm *VM) {
+
+	sys := vm.BuiltInModules[sysModuleName]
+	for std := core.STDIN; std <= core.STDERR; std++ {
+		sys.Environment.SetVar(stdStreamNames[std], core.MakeObjectValue(core.MakeStdFileObject(std), false))
+	}
+}
+
+// StdFile returns the file that sys.stdout, sys.stderr or sys.stdin names
+// at the moment -- the script may have redirected it -- resolved as by
+// ResolveFile.
+func (vm *VM) StdFile(std core.StdStream) *core.FileObject {
+	if sys, ok := vm.BuiltInModules[sysModuleName]; ok {
+		if v, ok := sys.Environment.GetVar(stdStreamNames[std]); ok && v.IsObj() {
+			if f, ok := v.Obj().(*core.FileObject); ok {
+				return vm.ResolveFile(f)
+			}
+		}
+	}
+	return vm.stdFiles[std]
+}
+
+// ResolveFile maps the sys module's placeholder for a standard stream to
+// this VM's file for it, and returns any other file as it is.
+func (vm *VM) ResolveFile(f *core.FileObject) *core.FileObject {
+	if f.Std != core.NOT_STD {
+		return vm.stdFiles[f.Std]
+	}
+	return f
+}
+
 //------------------------------------------------------------------------------------------
 
 // Interpret compiles and executes the given Lox source code, returning the result and any output.
@@ -155,6 +277,7 @@ func (vm *VM) initGlobals(fn *core.FunctionObject) {
 	// shared Environment so inner functions can resolve names for error messages
 	// (their own chunk.GlobalNames is empty).
 	env.GlobalNames = fn.Chunk.GlobalNames
+	env.Chunk = fn.Chunk
 	if vm.Repl {
 		// Preserve globals from earlier REPL lines; only extend the slices.
 		env.GrowGlobals(fn.Chunk.GlobalCount)
@@ -188,22 +311,25 @@ func (vm *VM) Interpret(source string, module string) (InterpretResult, string)
 	vm.source = source
 
 	var function *core.FunctionObject
+	var diags []compiler.Diagnostic
+	// Reset the stack/frames so a runtime error in an earlier call (a previous
+	// REPL line, or a script an embedding host ran before this one) can't
+	// wedge this one; REPL globals live on the persistent Environment, not
+	// the stack, so they survive. Clear the stack trace and uncaught exception
+	// too so a reported error doesn't carry stale frames from an earlier call
+	// (ErrorMsg is already reset at the top of run()).
+	vm.resetStack()
+	vm.stackTrace = nil
+	vm.uncaught = nil
 	if vm.Repl {
-		// Reset the stack/frames so a runtime error on a previous line can't
-		// wedge this one; globals live on the persistent Environment, not the
-		// stack, so they survive. Clear the stack trace too so a reported error
-		// doesn't carry stale frames from an earlier line (ErrorMsg is already
-		// reset at the top of run()).
-		vm.resetStack()
-		vm.stackTrace = nil
 		if vm.replState == nil {
 			vm.replState = compiler.NewReplState(module)
 		}
-		function = compiler.CompileRepl(vm.script, source, module, vm.replState)
+		function, diags = compiler.CompileRepl(vm.script, source, module, vm.replState)
 	} else {
-		function = compiler.Compile(vm.script, source, module)
+		function, diags = compiler.Compile(vm.script, source, module)
 	}
-	if function == nil {
+	if vm.reportDiagnostics(diags) || function == nil {
 		return INTERPRET_COMPILE_ERROR, ""
 	}
 	if core.DebugCompileOnly {
@@ -216,11 +342,18 @@ func (vm *VM) Interpret(source string, module string) (InterpretResult, string)
 		writeToLxc(vm, b)
 	}
 	vm.initGlobals(function)
+	vm.globals = function.Environment
 	closure := core.MakeClosureObject(function)
 	vm.stack[vm.stackTop] = core.MakeObjectValue(closure, false)
 	vm.stackTop++
+	vm.startRun()
+	vm.entered++
+	defer func() { vm.entered-- }()
 	vm.call(closure, 0)
 	res, val := vm.run(RUN_TO_COMPLETION)
+	if res == INTERPRET_RUNTIME_ERROR && vm.Interrupted() != nil {
+		res = INTERPRET_INTERRUPTED
+	}
 	core.LogFmtLn(core.INFO, "VM %s finished execution\n", vm.script)
 
 	return res, val.String()
@@ -228,6 +361,27 @@ func (vm *VM) Interpret(source string, module string) (InterpretResult, string)
 
 //------------------------------------------------------------------------------------------
 
+// reportDiagnostics filters compiler diagnostics through Warnings and hands
+// them to ReportDiagnostics, or prints them. It reports whether any of them
+// is an error, including a warning promoted by -Werror.
+func (vm *VM) reportDiagnostics(diags []compiler.Diagnostic) (failed bool) {
+
+	diags = vm.Warnings.Apply(diags)
+	if len(diags) == 0 {
+		return false
+	}
+	if vm.ReportDiagnostics != nil {
+		vm.ReportDiagnostics(diags)
+	} else {
+		for _, d := range diags {
+			fmt.Fprintln(vm.stdout, d)
+		}
+	}
+	return compiler.HasErrors(diags)
+}
+
+//------------------------------------------------------------------------------------------
+
 // Stack returns the value at the specified index in the VM's stack, or NIL_VALUE if index is invalid.
 // Used for debugging and inspection purposes.
 func (vm *VM) Stack(index int) core.Value {
@@ -272,6 +426,7 @@ func (vm *VM) RunTimeError(format string, args ...any) {
 
 	vm.ErrorMsg = fmt.Sprintf(format, args...)
 	vm.pendingExceptionClass = ""
+	vm.pendingException = nil
 }
 
 // RunTimeErrorNamed is like RunTimeError but raises a named exception class
@@ -285,6 +440,16 @@ func (vm *VM) RunTimeErrorNamed(name string, format string, args ...any) {
 
 	vm.ErrorMsg = fmt.Sprintf(format, args...)
 	vm.pendingExceptionClass = name
+	vm.pendingException = nil
+}
+
+// RunTimeErrorInstance is like RunTimeError but raises exc itself, as when
+// an await passes on the exception a task ended with.
+func (vm *VM) RunTimeErrorInstance(exc *core.InstanceObject) {
+
+	vm.ErrorMsg = exceptionText(exc)
+	vm.pendingExceptionClass = ""
+	vm.pendingException = exc
 }
 
 //------------------------------------------------------------------------------------------
@@ -382,9 +547,13 @@ func (vm *VM) Script() string {
 	return vm.script
 }
 
-// GetGlobals returns the global environment/scope of the currently executing function.
+// GetGlobals returns the global environment/scope of the currently executing function,
+// or, between runs, that of the script Interpret last ran (nil if there is none).
 // ------------------------------------------------------------------------------------------
 func (vm *VM) GetGlobals() *core.Environment {
+	if vm.frameCount == 0 {
+		return vm.globals
+	}
 	if vm.frame().Closure.Function.Environment == nil {
 		return nil
 	}
@@ -400,7 +569,7 @@ func (vm *VM) GetGlobals() *core.Environment {
 func (vm *VM) ResolveClass(name string) (*core.ClassObject, bool) {
 	id := core.InternName(name)
 	if v, ok := vm.BuiltIns[id]; ok {
-		if class, ok := v.Obj.(*core.ClassObject); ok {
+		if class, ok := v.Obj().(*core.ClassObject); ok {
 			return class, true
 		}
 	}
@@ -409,12 +578,12 @@ func (vm *VM) ResolveClass(name string) (*core.ClassObject, bool) {
 		return nil, false
 	}
 	if v, ok := env.GetVar(id); ok {
-		if class, ok := v.Obj.(*core.ClassObject); ok {
+		if class, ok := v.Obj().(*core.ClassObject); ok {
 			return class, true
 		}
 	}
 	if slot := vm.frame().Closure.Function.Chunk.SlotForName(name); slot >= 0 && env.Defined[slot] {
-		if class, ok := env.Globals[slot].Obj.(*core.ClassObject); ok {
+		if class, ok := env.Globals[slot].Obj().(*core.ClassObject); ok {
 			return class, true
 		}
 	}
@@ -471,8 +640,15 @@ func (vm *VM) pop() core.Value {
 // The mode parameter controls whether to run to completion or just the current function.
 // main interpreter loop
 func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
+	return vm.runFrom(mode, vm.frameCount)
+}
+
+// runFrom is run, with the frames from startFrame up counting as the current
+// function's: in RUN_CURRENT_FUNCTION mode it returns when frame
+// startFrame-1 returns, so a fiber resumed with its frames on top of it
+// (see fiber.go) runs until it ends or suspends.
+func (vm *VM) runFrom(mode VMRunMode, startFrame int) (InterpretResult, core.Value) {
 	vm.ErrorMsg = ""
-	startFrame := vm.frameCount
 
 	if mode == RUN_CURRENT_FUNCTION {
 		// An exception raised during this call and not caught within its
@@ -595,10 +771,15 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			goto End
 
 		case core.OP_PRINT:
-			// Pop value from stack and print it to stdout
+			// Pop value from stack and print it to sys.stdout
 			// compiler ensures stack top will be a string object via core.OP_STR
 			v := vm.pop()
-			fmt.Printf("%s\n", v.AsString().Get())
+			out := vm.StdFile(core.STDOUT)
+			if out.Closed {
+				vm.RunTimeError("Cannot print to a closed file.")
+				goto End
+			}
+			out.WriteString(v.AsString().Get() + "\n")
 
 		case core.OP_POP:
 			// Pop and discard the top value from the stack
@@ -613,6 +794,13 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			globals[slot] = core.Mutable(vm.pop())
 			defined[slot] = true
 
+		case core.OP_EXPORT:
+			// Mark a global as exported; operand is the constant index of its name.
+
+			idx := vm.currCode[frame.Ip]
+			frame.Ip++
+			function.Environment.Export(int(constants[idx].InternedId()))
+
 		case core.OP_DEFINE_GLOBAL_CONST:
 			// Define a new global constant; operand is the compiler-assigned slot index.
 
@@ -683,7 +871,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			slot := int(vm.currCode[frame.Ip])
 			offset := uint16(vm.currCode[frame.Ip+1])<<8 | uint16(vm.currCode[frame.Ip+2])
 			frame.Ip += 3
-			if vm.stack[frame.Slots+slot].Type != core.VAL_UNDEFINED {
+			if vm.stack[frame.Slots+slot].Type() != core.VAL_UNDEFINED {
 				frame.Ip += int(offset)
 			}
 
@@ -733,34 +921,45 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			}
 			refreshFrame()
 
+		case core.OP_CALL_SPREAD:
+			// As OP_CALL, once the list or tuple on stack top is spread into the arguments
+			argCount, ok := vm.spreadArgs(int(vm.currCode[frame.Ip]))
+			frame.Ip++
+			if !ok || !vm.callValue(vm.Peek(argCount), argCount) {
+				goto End
+			}
+			refreshFrame()
+
 		case core.OP_ADD_NUMERIC:
 			// Pop two values from stack, add them (handles int, float), push result
 
 			v2 := vm.pop()
 			v1 := vm.pop()
-			switch v2.Type {
-			case core.VAL_INT:
-				switch v1.Type {
-				case core.VAL_INT:
-					vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data)+int(v2.Data), false)
+			// Tagless switches on IsInt and IsFloat, which the compiler
+			// inlines here, where Type is too costly to be.
+			switch {
+			case v2.IsInt():
+				switch {
+				case v1.IsInt():
+					vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data())+int(v2.Data()), false)
 					vm.stackTop++
 					continue
-				case core.VAL_FLOAT:
-					vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)+float64(int(v2.Data)), false)
+				case v1.IsFloat():
+					vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())+float64(int(v2.Data())), false)
 					vm.stackTop++
 					continue
 				}
 				vm.RunTimeError("Addition type mismatch: %s + %s", v1.String(), v2.String())
 				goto End
 
-			case core.VAL_FLOAT:
-				switch v1.Type {
-				case core.VAL_INT:
-					vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data))+math.Float64frombits(v2.Data), false)
+			case v2.IsFloat():
+				switch {
+				case v1.IsInt():
+					vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data()))+math.Float64frombits(v2.Data()), false)
 					vm.stackTop++
 					continue
-				case core.VAL_FLOAT:
-					vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)+math.Float64frombits(v2.Data), false)
+				case v1.IsFloat():
+					vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())+math.Float64frombits(v2.Data()), false)
 					vm.stackTop++
 					continue
 				}
@@ -775,9 +974,9 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			// Pop two vector values from stack, add them (handles vec2, vec3, vec4), push result
 			v2 := vm.pop()
 			v1 := vm.pop()
-			switch v2.Type {
+			switch v2.Type() {
 			case core.VAL_VEC2:
-				if v1.Type != core.VAL_VEC2 {
+				if v1.Type() != core.VAL_VEC2 {
 					vm.RunTimeError("Addition type mismatch: %s + %s", v1.String(), v2.String())
 					goto End
 				}
@@ -793,7 +992,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				continue
 
 			case core.VAL_VEC3:
-				if v1.Type != core.VAL_VEC3 {
+				if v1.Type() != core.VAL_VEC3 {
 					vm.RunTimeError("Addition type mismatch: %s + %s", v1.String(), v2.String())
 					goto End
 				}
@@ -804,7 +1003,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				continue
 
 			case core.VAL_VEC4:
-				if v1.Type != core.VAL_VEC4 {
+				if v1.Type() != core.VAL_VEC4 {
 					vm.RunTimeError("Addition type mismatch: %s + %s", v1.String(), v2.String())
 					goto End
 				}
@@ -829,25 +1028,25 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			valB := vm.stack[base+int(slotInc)]
 
 			// Immediate specializations for common cases
-			if valA.Type == core.VAL_INT && valB.Type == core.VAL_INT {
+			if valA.IsInt() && valB.IsInt() {
 				// Patch and execute specialized version immediately
 				vm.patchInstruction(frame.Ip-3, core.OP_ADD_II)
-				vm.stack[base+int(slotDest)] = core.MakeIntValue(int(valA.Data)+int(valB.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeIntValue(int(valA.Data())+int(valB.Data()), false)
 				continue
 			}
-			if valA.Type == core.VAL_FLOAT && valB.Type == core.VAL_FLOAT {
+			if valA.IsFloat() && valB.IsFloat() {
 				// Patch and execute specialized version immediately
 				vm.patchInstruction(frame.Ip-3, core.OP_ADD_FF)
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valA.Data)+math.Float64frombits(valB.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valA.Data())+math.Float64frombits(valB.Data()), false)
 				continue
 			}
 
-			switch valB.Type {
+			switch valB.Type() {
 			case core.VAL_INT:
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valA.Data)+float64(int(valB.Data)), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valA.Data())+float64(int(valB.Data())), false)
 
 			case core.VAL_FLOAT:
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(float64(int(valA.Data))+math.Float64frombits(valB.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(float64(int(valA.Data()))+math.Float64frombits(valB.Data()), false)
 			}
 
 		case core.OP_ADD_II:
@@ -857,10 +1056,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			frame.Ip += 2
 
 			base := frame.Slots
-			vm.stack[base+int(slotDest)] = core.Value{
-				Type: core.VAL_INT,
-				Data: vm.stack[base+int(slotDest)].Data + vm.stack[base+int(slotInc)].Data,
-			}
+			vm.stack[base+int(slotDest)] = core.MakeIntValue(int(vm.stack[base+int(slotDest)].Data()+vm.stack[base+int(slotInc)].Data()), false)
 			continue
 
 		case core.OP_ADD_FF:
@@ -870,10 +1066,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			frame.Ip += 2
 
 			base := frame.Slots
-			vm.stack[base+int(slotDest)] = core.Value{
-				Type: core.VAL_FLOAT,
-				Data: math.Float64bits(math.Float64frombits(vm.stack[base+int(slotDest)].Data) + math.Float64frombits(vm.stack[base+int(slotInc)].Data)),
-			}
+			vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(vm.stack[base+int(slotDest)].Data())+math.Float64frombits(vm.stack[base+int(slotInc)].Data()), false)
 			continue
 
 		case core.OP_INCR_CONST_N:
@@ -886,27 +1079,27 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			valDest := vm.stack[base+int(slotDest)]
 			constVal := constants[slotIncIndex]
 
-			core.LogFmtLn(core.DEBUG, "incr_const_n: dest tpe %d, const type %d\n", valDest.Type, constVal.Type)
+			core.LogFmtLn(core.DEBUG, "incr_const_n: dest tpe %d, const type %d\n", valDest.Type(), constVal.Type())
 			// Immediate specializations for common cases
-			if valDest.Type == core.VAL_INT && constVal.Type == core.VAL_INT {
+			if valDest.IsInt() && constVal.IsInt() {
 				// Patch and execute specialized version immediately
 				vm.patchInstruction(frame.Ip-3, core.OP_INCR_CONST_I)
-				vm.stack[base+int(slotDest)] = core.MakeIntValue(int(valDest.Data)+int(constVal.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeIntValue(int(valDest.Data())+int(constVal.Data()), false)
 				continue
 			}
-			if valDest.Type == core.VAL_FLOAT && constVal.Type == core.VAL_FLOAT {
+			if valDest.IsFloat() && constVal.IsFloat() {
 				// Patch and execute specialized version immediately
 				vm.patchInstruction(frame.Ip-3, core.OP_INCR_CONST_F)
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valDest.Data)+math.Float64frombits(constVal.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valDest.Data())+math.Float64frombits(constVal.Data()), false)
 				continue
 			}
 
-			switch constVal.Type {
+			switch constVal.Type() {
 			case core.VAL_INT:
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valDest.Data)+float64(int(constVal.Data)), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(math.Float64frombits(valDest.Data())+float64(int(constVal.Data())), false)
 
 			case core.VAL_FLOAT:
-				vm.stack[base+int(slotDest)] = core.MakeFloatValue(float64(int(valDest.Data))+math.Float64frombits(constVal.Data), false)
+				vm.stack[base+int(slotDest)] = core.MakeFloatValue(float64(int(valDest.Data()))+math.Float64frombits(constVal.Data()), false)
 			}
 
 		case core.OP_INCR_CONST_I:
@@ -916,13 +1109,10 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			frame.Ip += 2
 
 			base := frame.Slots
-			constVal := constants[constIndex].Data
+			constVal := constants[constIndex].Data()
 
 			// Direct integer increment
-			vm.stack[base+int(slotVar)] = core.Value{
-				Type: core.VAL_INT,
-				Data: vm.stack[base+int(slotVar)].Data + constVal,
-			}
+			vm.stack[base+int(slotVar)] = core.MakeIntValue(int(vm.stack[base+int(slotVar)].Data()+constVal), false)
 			continue
 
 		case core.OP_INCR_CONST_F:
@@ -932,44 +1122,46 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			frame.Ip += 2
 
 			base := frame.Slots
-			constVal := math.Float64frombits(constants[constIndex].Data)
+			constVal := math.Float64frombits(constants[constIndex].Data())
 
 			// Direct float increment
-			vm.stack[base+int(slotVar)] = core.Value{
-				Type: core.VAL_FLOAT,
-				Data: math.Float64bits(math.Float64frombits(vm.stack[base+int(slotVar)].Data) + constVal),
-			}
+			vm.stack[base+int(slotVar)] = core.MakeFloatValue(math.Float64frombits(vm.stack[base+int(slotVar)].Data())+constVal, false)
 			continue
 
 		case core.OP_CONCAT:
 			v2 := vm.pop()
 			v1 := vm.pop()
-			switch v2.Type {
+			switch v2.Type() {
 
 			case core.VAL_OBJ:
-				ov2 := v2.Obj
-				switch v2.ObjType {
+				switch v2.ObjType() {
 
 				case core.OBJECT_STRING:
-					if v1.Type != core.VAL_OBJ {
+					if !v1.IsObj() {
 						vm.RunTimeError("Concatenation type mismatch: %s + %s", v1.String(), v2.String())
 						goto End
 					}
-					if v1.ObjType == core.OBJECT_STRING {
-						vm.stack[vm.stackTop] = core.MakeStringObjectValue(v1.AsString().Get()+v2.AsString().Get(), false)
+					if v1.ObjType() == core.OBJECT_STRING {
+						s1, s2 := v1.AsString().Get(), v2.AsString().Get()
+						if vm.memory != nil && !vm.Charge(core.StringSize+len(s1)+len(s2)) {
+							goto End
+						}
+						vm.stack[vm.stackTop] = core.MakeStringObjectValue(s1+s2, false)
 						vm.stackTop++
 						continue
 					}
 					vm.RunTimeError("Concatenation type mismatch: %s + %s", v1.String(), v2.String())
 					goto End
 				case core.OBJECT_LIST:
-					if v1.Type != core.VAL_OBJ {
+					if !v1.IsObj() {
 						vm.RunTimeError("Concatenation type mismatch: %s + %s", v1.String(), v2.String())
 						goto End
 					}
-					ov1 := v1.Obj
-					if v1.ObjType == core.OBJECT_LIST {
-						lo := ov1.(*core.ListObject).Add(ov2.(*core.ListObject))
+					if v1.ObjType() == core.OBJECT_LIST {
+						if vm.memory != nil && !vm.Charge(core.ListSize+core.ValueSize*(len(v1.AsList().Items)+len(v2.AsList().Items))) {
+							goto End
+						}
+						lo := v1.AsList().Add(v2.AsList())
 						vm.stack[vm.stackTop] = core.MakeObjectValue(lo, false)
 						vm.stackTop++
 						continue
@@ -1046,16 +1238,36 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 			offset := uint16(vm.currCode[frame.Ip])<<8 | uint16(vm.currCode[frame.Ip+1])
 			frame.Ip += 2
+			if vm.limits != nil && !vm.checkLimits(int(offset)) {
+				goto End
+			}
+			if vm.watch != nil && vm.watch.changed.Load() {
+				vm.reloadChanged()
+			}
 			frame.Ip -= int(offset)
 
 		case core.OP_INVOKE:
 			// Optimized method call: directly invoke method by name with argument count
+			cache := chunk.InlineCache(frame.Ip - 1)
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			method := constants[idx]
 			argCount := vm.currCode[frame.Ip]
 			frame.Ip++
-			if !vm.invoke(method, int(argCount)) {
+			if !vm.invoke(method, int(argCount), cache) {
+				goto End
+			}
+			refreshFrame()
+
+		case core.OP_INVOKE_SPREAD:
+			// As OP_INVOKE, once the list or tuple on stack top is spread into the arguments
+			cache := chunk.InlineCache(frame.Ip - 1)
+			idx := vm.currCode[frame.Ip]
+			frame.Ip++
+			method := constants[idx]
+			argCount, ok := vm.spreadArgs(int(vm.currCode[frame.Ip]))
+			frame.Ip++
+			if !ok || !vm.invoke(method, argCount, cache) {
 				goto End
 			}
 			refreshFrame()
@@ -1109,39 +1321,62 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			vm.stackTop++
 			refreshFrame()
 
+		case core.OP_ASYNC:
+			// Start of an async function's body: set the call aside as a task
+			// and return that from it, as OP_RETURN would (see async.go)
+
+			result := vm.startTask()
+			vm.frameCount--
+			vm.stackTop = frame.Slots
+			vm.stack[vm.stackTop] = result
+			vm.stackTop++
+			if mode == RUN_CURRENT_FUNCTION && vm.frameCount+1 == startFrame {
+				return INTERPRET_OK, result
+			}
+			refreshFrame()
+
+		case core.OP_AWAIT:
+			// Await the task or future on top of the stack: push its result,
+			// or set the running task aside until there is one
+
+			if !vm.await(vm.pop()) {
+				goto End
+			}
+			refreshFrame()
+
 		case core.OP_METHOD:
 			// Define method on a class using name from constants
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			name := constants[idx]
-			vm.defineMethod(int(name.InternedId), false)
+			vm.defineMethod(int(name.InternedId()), false)
 
 		case core.OP_STATIC_METHOD:
 			// Define static method on a class using name from constants
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			name := constants[idx]
-			vm.defineMethod(int(name.InternedId), true)
+			vm.defineMethod(int(name.InternedId()), true)
 
 		case core.OP_CLASS_VAR:
 			// Define a class variable on a class using name from constants
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			name := constants[idx]
-			vm.defineClassVar(int(name.InternedId))
+			vm.defineClassVar(int(name.InternedId()))
 
 		case core.OP_NEGATE:
 			// Pop numeric value from stack, negate it, push result (handles int and float)
 
 			v := vm.pop()
-			switch v.Type {
+			switch v.Type() {
 			case core.VAL_FLOAT:
-				f := math.Float64frombits(v.Data)
+				f := math.Float64frombits(v.Data())
 				vm.stack[vm.stackTop] = core.MakeFloatValue(-f, false)
 				vm.stackTop++
 				continue
 			case core.VAL_INT:
-				f := int(v.Data)
+				f := int(v.Data())
 				vm.stack[vm.stackTop] = core.MakeIntValue(-f, false)
 				vm.stackTop++
 				continue
@@ -1153,17 +1388,18 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			// Get property/field from object using name from constants (handles various object types)
 
 			v := vm.Peek(0)
-			if v.Type != core.VAL_OBJ && v.Type != core.VAL_VEC2 && v.Type != core.VAL_VEC3 && v.Type != core.VAL_VEC4 {
+			if !v.IsObj() && v.Type() != core.VAL_VEC2 && v.Type() != core.VAL_VEC3 && v.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Attempt to access property of non-object.")
 				goto End
 			}
 
+			site := frame.Ip - 1
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			nv := constants[idx]
-			stringId := int(nv.InternedId)
+			stringId := int(nv.InternedId())
 
-			switch v.ObjType {
+			switch v.ObjType() {
 			case core.OBJECT_VEC2:
 				// special case for Vec2, which has x and y properties
 				switch stringId {
@@ -1223,28 +1459,50 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				}
 
 			case core.OBJECT_INSTANCE:
+				// a field, found by the slot the cache remembers for the
+				// instance's shape, or else a method of its class, bound
 				ot := v.AsInstance()
-				if val, ok := ot.Fields[stringId]; ok {
-					vm.pop()
-					vm.stack[vm.stackTop] = val
-					vm.stackTop++
-				} else {
-					if !vm.bindMethod(ot.Class, stringId) {
+				cache := chunk.InlineCache(site)
+				slot, method, ok := cache.GetShape(ot.Shape)
+				if !ok {
+					if slot = ot.Shape.Slot(stringId); slot >= 0 {
+						cache.PutField(ot.Shape, slot)
+					} else if method, ok = ot.Class.Methods[stringId]; ok {
+						cache.PutMethod(ot.Shape, method)
+					} else {
+						vm.RunTimeError("Undefined property '%s'", core.NameFromID(stringId))
 						goto End
 					}
 				}
+				vm.pop()
+				if slot >= 0 {
+					vm.stack[vm.stackTop] = ot.Slots[slot]
+				} else {
+					vm.stack[vm.stackTop] = core.MakeObjectValue(core.MakeBoundMethodObject(v, method.AsClosure()), false)
+				}
+				vm.stackTop++
 
 			case core.OBJECT_CLASS:
-				// class variables: walk the superclass chain, first match wins
+				// class variables: walk the superclass chain, first match wins,
+				// remembering which class that was
 				class := v.AsClass()
+				cache := chunk.InlineCache(site)
 				found := false
-				for c := class; c != nil; c = c.Super {
-					if val, ok := c.Statics[stringId]; ok {
-						vm.pop()
-						vm.stack[vm.stackTop] = val
-						vm.stackTop++
-						found = true
-						break
+				if holder, ok := cache.Get(class, true); ok {
+					vm.pop()
+					vm.stack[vm.stackTop], _ = holder.AsClass().GetStatic(stringId)
+					vm.stackTop++
+					found = true
+				} else {
+					for c := class; c != nil; c = c.Super {
+						if val, ok := c.GetStatic(stringId); ok {
+							cache.Put(class, true, core.MakeObjectValue(c, false))
+							vm.pop()
+							vm.stack[vm.stackTop] = val
+							vm.stackTop++
+							found = true
+							break
+						}
 					}
 				}
 				if !found {
@@ -1255,7 +1513,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 			case core.OBJECT_NATIVE:
 				// built-in objects can have constants, so check for that
-				bobj, ok := v.Obj.(core.HasConstants)
+				bobj, ok := v.Obj().(core.HasConstants)
 				if ok {
 					val := bobj.GetConstant(stringId)
 					vm.pop() // pop the object
@@ -1271,13 +1529,15 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			case core.OBJECT_MODULE:
 				ot := v.AsModule()
 
-				if val, ok := ot.Environment.GetVar(int(nv.InternedId)); ok {
+				if val, ok := moduleAttr(ot, int(nv.InternedId())); ok {
 					vm.pop()
 					vm.stack[vm.stackTop] = val
 					vm.stackTop++
 				} else {
 					name := core.GetStringValue(nv)
-					vm.RunTimeError("Get property '%s' not found.", name)
+					if !vm.partialModuleError(ot, name) {
+						vm.RunTimeError("Get property '%s' not found.", name)
+					}
 					goto End
 				}
 
@@ -1293,14 +1553,15 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 			val := vm.Peek(0)
 			v := vm.Peek(1)
-			if v.Type != core.VAL_OBJ && v.Type != core.VAL_VEC2 && v.Type != core.VAL_VEC3 && v.Type != core.VAL_VEC4 {
+			if !v.IsObj() && v.Type() != core.VAL_VEC2 && v.Type() != core.VAL_VEC3 && v.Type() != core.VAL_VEC4 {
 				vm.RunTimeError("Set property : not found.")
 				goto End
 			}
+			site := frame.Ip - 1
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
-			stringId := int(constants[idx].InternedId)
-			switch v.ObjType {
+			stringId := int(constants[idx].InternedId())
+			switch v.ObjType() {
 			case core.OBJECT_VEC2:
 				// special case for Vec2, which has x and y properties
 				switch stringId {
@@ -1389,8 +1650,25 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				}
 
 			case core.OBJECT_INSTANCE:
+				// store in the field's slot, or add the field, moving the
+				// instance to the next shape
 				ot := v.AsInstance()
-				ot.Fields[stringId] = val
+				cache := chunk.InlineCache(site)
+				if slot, next, ok := cache.GetStore(ot.Shape); ok {
+					if next != nil {
+						ot.Shape = next
+						ot.Slots = append(ot.Slots, val)
+					} else {
+						ot.Slots[slot] = val
+					}
+				} else if slot := ot.Shape.Slot(stringId); slot >= 0 {
+					ot.Slots[slot] = val
+					cache.PutStore(ot.Shape, slot, nil)
+				} else {
+					shape := ot.Shape
+					ot.SetField(stringId, val)
+					cache.PutStore(shape, len(ot.Slots)-1, ot.Shape)
+				}
 				tmp := vm.pop()
 				vm.pop()
 				vm.stack[vm.stackTop] = tmp
@@ -1398,14 +1676,16 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			case core.OBJECT_CLASS:
 				// class variables: always set on the exact class named, never walk Super
 				class := v.AsClass()
-				class.Statics[stringId] = val
+				if class.SetStatic(stringId, val) {
+					core.ClassesChanged() // may shadow a superclass's variable
+				}
 				tmp := vm.pop()
 				vm.pop()
 				vm.stack[vm.stackTop] = tmp
 				vm.stackTop++
 			case core.OBJECT_MODULE:
 				ot := v.AsModule()
-				ot.Environment.SetVar(int(constants[idx].InternedId), val)
+				ot.Environment.SetVar(int(constants[idx].InternedId()), val)
 				tmp := vm.pop()
 				vm.pop()
 				vm.stack[vm.stackTop] = tmp
@@ -1473,13 +1753,14 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			// Set up class inheritance: subclass inherits methods from superclass
 			superclass := vm.Peek(1)
 			subclass := vm.Peek(0).AsClass()
-			if superclass.Type == core.VAL_OBJ {
+			if superclass.IsObj() {
 				if superclass.IsClassObject() {
 					sco := superclass.AsClass()
 					for k, v := range sco.Methods {
 						subclass.Methods[k] = v
 					}
 					subclass.Super = superclass.AsClass()
+					core.ClassesChanged()
 					vm.pop()
 					continue
 				}
@@ -1490,6 +1771,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 		case core.OP_GET_SUPER:
 			// Get method from superclass and bind it to current instance
+			cache := chunk.InlineCache(frame.Ip - 1)
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			name := constants[idx].AsString()
@@ -1497,23 +1779,38 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			v := vm.pop()
 			superclass := v.AsClass()
 
-			if !vm.bindMethod(superclass, stringId) {
+			if !vm.bindMethod(superclass, stringId, cache) {
 				return INTERPRET_RUNTIME_ERROR, core.NIL_VALUE
 			}
 
 		case core.OP_SUPER_INVOKE:
 			// Optimized super method call: invoke superclass method directly
+			cache := chunk.InlineCache(frame.Ip - 1)
 			idx := vm.currCode[frame.Ip]
 			frame.Ip++
 			method := constants[idx]
 			argCount := vm.currCode[frame.Ip]
 			frame.Ip++
 			superclass := vm.pop().AsClass()
-			if !vm.invokeFromClass(superclass, method, int(argCount), false) {
+			if !vm.invokeFromClass(superclass, method, int(argCount), false, cache) {
 				return INTERPRET_RUNTIME_ERROR, core.NIL_VALUE
 			}
 			refreshFrame()
 
+		case core.OP_SUPER_INVOKE_SPREAD:
+			// As OP_SUPER_INVOKE, the spread list or tuple lying under the superclass
+			cache := chunk.InlineCache(frame.Ip - 1)
+			idx := vm.currCode[frame.Ip]
+			frame.Ip++
+			method := constants[idx]
+			superclass := vm.pop().AsClass()
+			argCount, ok := vm.spreadArgs(int(vm.currCode[frame.Ip]))
+			frame.Ip++
+			if !ok || !vm.invokeFromClass(superclass, method, argCount, false, cache) {
+				goto End
+			}
+			refreshFrame()
+
 		case core.OP_IMPORT:
 			// Import module: load and register module by name with optional alias
 
@@ -1531,6 +1828,9 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			// check if module is in builtins
 			moduleObj, ok := vm.BuiltInModules[sID]
 			if ok {
+				if vm.moduleDenied(module) {
+					goto End
+				}
 				// copy built-in module to the current environment
 				moduleVal := core.MakeObjectValue(moduleObj, false)
 				frame.Closure.Function.Environment.SetVar(sID, moduleVal)
@@ -1544,6 +1844,9 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 			status := vm.importModule(module, alias)
 			if status != INTERPRET_OK {
+				if vm.ErrorMsg != "" {
+					goto End // ImportError, catchable like any other exception
+				}
 				core.LogFmtLn(core.ERROR, "Failed to import module '%s' as '%s'.\n", module, alias)
 				return status, core.NIL_VALUE
 			}
@@ -1565,22 +1868,29 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			length := int(lv)
 
 			// Built-in modules (sys, os, gfx, ...) are already registered in
-			// memory; register the module object into the current environment
-			// rather than trying to load <module>.lox from disk.
-			bID := core.InternName(module)
-			if moduleObj, ok := vm.BuiltInModules[bID]; ok {
-				frame.Closure.Function.Environment.SetVar(bID, core.MakeObjectValue(moduleObj, false))
-			} else {
-				status := vm.importModule(module, module)
+			// memory rather than loaded from <module>.lox on disk.
+			moduleObj, ok := vm.BuiltInModules[core.InternName(module)]
+			if ok && vm.moduleDenied(module) {
+				goto End
+			}
+			if !ok {
+				var status InterpretResult
+				moduleObj, status = vm.loadModule(module)
 				if status != INTERPRET_OK {
+					if vm.ErrorMsg != "" {
+						goto End // ImportError
+					}
 					vm.RunTimeError("Failed to import module '%s'.", module)
 					return status, core.NIL_VALUE
 				}
 			}
 
 			if length == 0 {
-				if !vm.importFunctionFromModule(module, "__all__") {
-					vm.RunTimeError("Failed to import '%s' from module '%s'.", "__all__", module)
+				if !vm.importFunctionFromModule(moduleObj, "*") {
+					if vm.pendingExceptionClass == "ImportError" {
+						goto End
+					}
+					vm.RunTimeError("Failed to import '%s' from module '%s'.", "*", module)
 					return INTERPRET_RUNTIME_ERROR, core.NIL_VALUE
 				}
 			} else {
@@ -1589,7 +1899,10 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 					frame.Ip++
 					fv := constants[idx]
 					name := fv.AsString().Get()
-					if !vm.importFunctionFromModule(module, name) {
+					if !vm.importFunctionFromModule(moduleObj, name) {
+						if vm.pendingExceptionClass == "ImportError" {
+							goto End
+						}
 						vm.RunTimeError("Failed to import function '%s' from module '%s'.", name, module)
 						return INTERPRET_RUNTIME_ERROR, core.NIL_VALUE
 					}
@@ -1601,10 +1914,10 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 
 			v := vm.Peek(0) // may be needed for class toString so don't pop now
 			s := v.String()
-			switch v.Type {
+			switch v.Type() {
 			case core.VAL_OBJ:
-				ov := v.Obj
-				switch v.ObjType {
+				ov := v.Obj()
+				switch v.ObjType() {
 				case core.OBJECT_STRING:
 					ot := ov.(core.StringObject)
 					s = ot.Get()
@@ -1628,17 +1941,23 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 		case core.OP_CREATE_LIST:
 			// Create list object from values on stack: pop item count, create list with those items
 			// item count is operand, expects items on stack,  list object will be stack top
-			vm.createList(frame)
+			if !vm.createList(frame) {
+				goto End
+			}
 
 		case core.OP_CREATE_TUPLE:
 			// Create tuple object from values on stack: pop item count, create immutable tuple
 			// item count is operand, expects items on stack,  list object will be stack top
-			vm.createTuple(frame)
+			if !vm.createTuple(frame) {
+				goto End
+			}
 
 		case core.OP_CREATE_DICT:
 			// Create dictionary object from key-value pairs on stack
 			// key/pair item count is operand, expects keys/values on stack,  dict object will be stack top
-			vm.createDict(frame)
+			if !vm.createDict(frame) {
+				goto End
+			}
 
 		case core.OP_INDEX:
 			// Index into list/string/dict: pop index and container, push element at index
@@ -1681,17 +2000,17 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			jumpToEnd := uint16(vm.currCode[frame.Ip])<<8 | uint16(vm.currCode[frame.Ip+1])
 			frame.Ip += 2
 			iterable := vm.stack[frame.Slots+int(iterableSlot)]
-			if iterable.Type != core.VAL_OBJ {
+			if !iterable.IsObj() {
 				vm.RunTimeError("Foreach requires an iterable object, got %s", iterable.String())
 				goto End
 			}
 			// native iterable object (list, string )
-			o, ok := iterable.Obj.(core.Iterable)
+			o, ok := iterable.Obj().(core.Iterable)
 			if ok {
 				iterval, _ := o.GetIterator()
 				vm.stack[frame.Slots+int(iterableSlot)] = iterval
 				val := iterval.AsIterator().Next()
-				if val.Type == core.VAL_NIL {
+				if val.IsNil() {
 					// empty iterable, jump to end
 					frame.Ip += int(jumpToEnd - 2)
 					continue
@@ -1712,7 +2031,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 						core.LogFmtLn(core.ERROR, "ASSERTION FAILED: Expected iterable at stack top before iter call. stackTop=%d", vm.stackTop)
 					}
 
-					if !vm.invoke(ITER_METHOD, 0) {
+					if !vm.invoke(ITER_METHOD, 0, nil) {
 						goto End
 					}
 					iok, result := vm.run(RUN_CURRENT_FUNCTION)
@@ -1753,7 +2072,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 						core.LogFmtLn(core.ERROR, "ASSERTION FAILED: Expected result at stack top before next call. stackTop=%d", vm.stackTop)
 					}
 
-					if !vm.invoke(NEXT_METHOD, 0) {
+					if !vm.invoke(NEXT_METHOD, 0, nil) {
 						goto End
 					}
 					iok, result = vm.run(RUN_CURRENT_FUNCTION)
@@ -1774,7 +2093,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 					if vm.stackTop != expectedStackTop2-1 {
 						core.LogFmtLn(core.ERROR, "ASSERTION FAILED: Stack top incorrect after next pop. Expected=%d, Actual=%d", expectedStackTop2-1, vm.stackTop)
 					}
-					if result.Type == core.VAL_NIL {
+					if result.IsNil() {
 						// we have no items, so jump to end of foreach loop
 						frame.Ip += int(jumpToEnd - 2)
 					} else {
@@ -1798,10 +2117,13 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 			iterSlot := frame.Slots + int(vm.currCode[frame.Ip])
 			frame.Ip++
 			iterVal := vm.stack[iterSlot]
-			if iterVal.ObjType != core.OBJECT_INSTANCE {
+			if iterVal.ObjType() != core.OBJECT_INSTANCE {
 				val := iterVal.AsIterator().Next()
-				if val.Type != core.VAL_NIL {
+				if !val.IsNil() {
 					vm.stack[iterSlot-1] = val
+					if vm.limits != nil && !vm.checkLimits(int(jumpToStart)) {
+						goto End
+					}
 					frame.Ip -= int(jumpToStart + 1)
 				}
 			} else {
@@ -1814,7 +2136,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 					core.LogFmtLn(core.ERROR, "ASSERTION FAILED: Expected iterVal at stack top before next call. stackTop=%d", vm.stackTop)
 				}
 
-				if !vm.invoke(NEXT_METHOD, 0) {
+				if !vm.invoke(NEXT_METHOD, 0, nil) {
 					goto End
 				}
 				ok, rv := vm.run(RUN_CURRENT_FUNCTION)
@@ -1836,8 +2158,11 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				}
 
 				refreshFrame()
-				if rv.Type != core.VAL_NIL {
+				if !rv.IsNil() {
 					vm.stack[iterSlot-1] = rv
+					if vm.limits != nil && !vm.checkLimits(int(jumpToStart)) {
+						goto End
+					}
 					frame.Ip -= int(jumpToStart + 1)
 				}
 				//vm.pop()
@@ -1859,7 +2184,7 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				vm.RunTimeError("'in' requires string or list as right operand.")
 				goto End
 			}
-			switch b.ObjType {
+			switch b.ObjType() {
 			case core.OBJECT_STRING:
 				if !a.IsStringObject() {
 					vm.RunTimeError("'in' requires string as left operand.")
@@ -1889,11 +2214,11 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 				goto End
 			}
 			top := vm.Peek(0)
-			if top.Type != core.VAL_OBJ {
+			if !top.IsObj() {
 				vm.RunTimeError("Unpack requires a list or tuple on stack top.")
 				goto End
 			}
-			if top.ObjType != core.OBJECT_LIST {
+			if top.ObjType() != core.OBJECT_LIST {
 				vm.RunTimeError("Unpack requires a list or tuple on stack top.")
 				goto End
 			}
@@ -1919,6 +2244,14 @@ func (vm *VM) run(mode VMRunMode) (InterpretResult, core.Value) {
 	End:
 
 		if vm.ErrorMsg != "" {
+			if exc := vm.pendingException; exc != nil {
+				vm.pendingException = nil
+				if !vm.raiseException(core.MakeObjectValue(exc, false)) {
+					return INTERPRET_RUNTIME_ERROR, core.NIL_VALUE
+				}
+				refreshFrame()
+				continue
+			}
 			name := "RunTimeError"
 			if vm.pendingExceptionClass != "" {
 				name = vm.pendingExceptionClass
@@ -1944,7 +2277,7 @@ func (vm *VM) callValue(callee core.Value, argCount int) bool {
 
 	//core.LogFmtLn(core.DEBUG, "Calling value %s with %d args", callee.String(), argCount)
 
-	if callee.Type == core.VAL_OBJ {
+	if callee.IsObj() {
 		if callee.IsClosureObject() {
 			//core.LogFmtLn(core.DEBUG, "Calling closure %s with %d args", callee.Obj.String(), argCount)
 			return vm.call(core.GetClosureObjectValue(callee), argCount)
@@ -1952,6 +2285,9 @@ func (vm *VM) callValue(callee core.Value, argCount int) bool {
 		} else if callee.IsBuiltInObject() {
 			//core.LogFmtLn(core.DEBUG, "Calling built-in function %s with %d args", callee.Obj.String(), argCount)
 			nf := callee.AsBuiltIn()
+			if nf.Module != "" && vm.moduleDenied(nf.Module) {
+				return false
+			}
 			res := nf.Function(argCount, vm.stackTop-argCount, vm)
 			vm.stackTop -= argCount + 1
 			vm.stack[vm.stackTop] = res
@@ -1982,47 +2318,91 @@ func (vm *VM) callValue(callee core.Value, argCount int) bool {
 
 //------------------------------------------------------------------------------------------
 
+// spreadArgs replaces the list or tuple on stack top, the last of argCount
+// arguments, with its elements, and returns the number of arguments that
+// leaves: f(a, *rest) calls f with a and then everything in rest.
+func (vm *VM) spreadArgs(argCount int) (int, bool) {
+
+	top := vm.Peek(0)
+	if !top.IsObj() || top.ObjType() != core.OBJECT_LIST {
+		vm.RunTimeError("Spread argument must be a list or tuple.")
+		return 0, false
+	}
+	items := top.AsList().Get()
+	if vm.stackTop-1+len(items) >= STACK_MAX {
+		vm.RunTimeError("Stack overflow.")
+		return 0, false
+	}
+	vm.stackTop--
+	vm.stackTop += copy(vm.stack[vm.stackTop:], items)
+	return argCount - 1 + len(items), true
+}
+
+//------------------------------------------------------------------------------------------
+
 // invoke performs optimized method calls and module access without separate property lookup.
-// optimised method call/module access
+// optimised method call/module access. cache, if not nil, is the calling
+// instruction's inline cache.
 //
 //go:noinline
-func (vm *VM) invoke(name core.Value, argCount int) bool {
+func (vm *VM) invoke(name core.Value, argCount int, cache *core.InlineCache) bool {
 	receiver := vm.Peek(argCount)
 
-	if receiver.Type == core.VAL_VEC2 ||
-		receiver.Type == core.VAL_VEC3 ||
-		receiver.Type == core.VAL_VEC4 {
+	if receiver.Type() == core.VAL_VEC2 ||
+		receiver.Type() == core.VAL_VEC3 ||
+		receiver.Type() == core.VAL_VEC4 {
 		return vm.VectorMethodCall(receiver, name, argCount)
 	}
 
-	if receiver.Type != core.VAL_OBJ {
+	if !receiver.IsObj() {
 		vm.RunTimeError("Invalid use of '.' operator")
 		return false
 	}
-	if receiver.Obj.IsBuiltIn() {
-		return vm.invokeFromBuiltin(receiver.Obj, name, argCount)
+	if obj := receiver.Obj(); obj.IsBuiltIn() {
+		return vm.invokeFromBuiltin(obj, name, argCount)
 	}
 
-	switch receiver.ObjType {
+	switch receiver.ObjType() {
 
 	case core.OBJECT_INSTANCE:
 		instance := receiver.AsInstance()
 		// A field can shadow a method and may itself hold a callable, so check
 		// fields before method lookup: `this.fn(x)` where fn is a field must
 		// fetch the field value and call it, not look for a method named fn.
-		if field, ok := instance.Fields[int(name.InternedId)]; ok {
+		// The cache remembers which of the two it is for the instance's shape.
+		slot, method, ok := -1, core.NIL_VALUE, false
+		if cache != nil {
+			slot, method, ok = cache.GetShape(instance.Shape)
+		}
+		if !ok {
+			if slot = instance.Shape.Slot(int(name.InternedId())); slot < 0 {
+				if method, ok = instance.Class.Methods[int(name.InternedId())]; !ok {
+					vm.RunTimeError("Undefined method '%s'.", core.GetStringValue(name))
+					return false
+				}
+			}
+			if cache != nil {
+				if slot >= 0 {
+					cache.PutField(instance.Shape, slot)
+				} else {
+					cache.PutMethod(instance.Shape, method)
+				}
+			}
+		}
+		if slot >= 0 {
+			field := instance.Slots[slot]
 			vm.stack[vm.stackTop-argCount-1] = field
 			return vm.callValue(field, argCount)
 		}
-		return vm.invokeFromClass(instance.Class, name, argCount, false)
+		return vm.call(method.AsClosure(), argCount)
 	case core.OBJECT_CLASS:
 		class := receiver.AsClass()
-		return vm.invokeFromClass(class, name, argCount, true)
+		return vm.invokeFromClass(class, name, argCount, true, cache)
 	case core.OBJECT_MODULE:
 		module := receiver.AsModule()
 		return vm.invokeFromModule(module, name, argCount)
 	case core.OBJECT_NATIVE, core.OBJECT_LIST, core.OBJECT_DICT, core.OBJECT_STRING:
-		return vm.invokeFromBuiltin(receiver.Obj, name, argCount)
+		return vm.invokeFromBuiltin(receiver.Obj(), name, argCount)
 	default:
 		vm.RunTimeError("Invalid use of '.' operator")
 		return false
@@ -2033,16 +2413,25 @@ func (vm *VM) invoke(name core.Value, argCount int) bool {
 //------------------------------------------------------------------------------------------
 
 // invokeFromClass calls a method from a specific class, handling both static and instance methods.
+// The method found is recorded in cache, if not nil, and looked up there first.
 //
 //go:noinline
-func (vm *VM) invokeFromClass(class *core.ClassObject, name core.Value, argCount int, isStatic bool) bool {
-	i := int(name.InternedId)
+func (vm *VM) invokeFromClass(class *core.ClassObject, name core.Value, argCount int, isStatic bool, cache *core.InlineCache) bool {
+	if cache != nil {
+		if method, ok := cache.Get(class, isStatic); ok {
+			return vm.call(method.AsClosure(), argCount)
+		}
+	}
+	i := int(name.InternedId())
 	if isStatic {
 		method, ok := class.StaticMethods[i]
 		if !ok {
 			vm.RunTimeError("Undefined static method '%s'.", core.GetStringValue(name))
 			return false
 		}
+		if cache != nil {
+			cache.Put(class, true, method)
+		}
 		return vm.call(method.AsClosure(), argCount)
 	}
 	method, ok := class.Methods[i]
@@ -2050,6 +2439,9 @@ func (vm *VM) invokeFromClass(class *core.ClassObject, name core.Value, argCount
 		vm.RunTimeError("Undefined method '%s'.", core.GetStringValue(name))
 		return false
 	}
+	if cache != nil {
+		cache.Put(class, false, method)
+	}
 	return vm.call(method.AsClosure(), argCount)
 }
 
@@ -2058,10 +2450,12 @@ func (vm *VM) invokeFromClass(class *core.ClassObject, name core.Value, argCount
 // invokeFromModule calls a function from a loaded module by name.
 func (vm *VM) invokeFromModule(module *core.ModuleObject, name core.Value, argCount int) bool {
 
-	fn, ok := module.Environment.GetVar(int(name.InternedId))
+	fn, ok := moduleAttr(module, int(name.InternedId()))
 	if !ok {
 		n := core.GetStringValue(name)
-		vm.RunTimeError("Undefined module property '%s'.", n)
+		if !vm.partialModuleError(module, n) {
+			vm.RunTimeError("Undefined module property '%s'.", n)
+		}
 		return false
 	}
 	return vm.callValue(fn, argCount)
@@ -2075,7 +2469,7 @@ func (vm *VM) invokeFromBuiltin(obj core.Object, name core.Value, argCount int)
 	n := core.GetStringValue(name)
 	bobj, ok := obj.(core.HasMethods)
 	if ok {
-		method := bobj.GetMethod(int(name.InternedId))
+		method := bobj.GetMethod(int(name.InternedId()))
 		if method != nil {
 			builtin := method.Function
 			res := builtin(argCount, vm.stackTop-argCount, vm)
@@ -2094,12 +2488,12 @@ func (vm *VM) invokeFromBuiltin(obj core.Object, name core.Value, argCount int)
 
 // VectorMethodCall handles method calls on vector types (Vec2, Vec3, Vec4) with optimized operations.
 func (vm *VM) VectorMethodCall(receiver core.Value, name core.Value, argCount int) bool {
-	switch receiver.Type {
+	switch receiver.Type() {
 	case core.VAL_VEC2:
-		if int(name.InternedId) == core.ADD && argCount == 1 {
+		if int(name.InternedId()) == core.ADD && argCount == 1 {
 			// special case for Vec2 addition
 			other := vm.Peek(0)
-			if other.ObjType == core.OBJECT_VEC2 {
+			if other.ObjType() == core.OBJECT_VEC2 {
 				v2 := other.AsVec2()
 				receiver.AsVec2().AddInPlace(v2)
 				vm.pop() // pop the other vector
@@ -2107,10 +2501,10 @@ func (vm *VM) VectorMethodCall(receiver core.Value, name core.Value, argCount in
 			}
 		}
 	case core.VAL_VEC3:
-		if int(name.InternedId) == core.ADD && argCount == 1 {
+		if int(name.InternedId()) == core.ADD && argCount == 1 {
 			// special case for Vec3 addition
 			other := vm.Peek(0)
-			if other.ObjType == core.OBJECT_VEC3 {
+			if other.ObjType() == core.OBJECT_VEC3 {
 				v3 := other.AsVec3()
 				receiver.AsVec3().AddInPlace(v3)
 				vm.pop() // pop the other vector
@@ -2118,10 +2512,10 @@ func (vm *VM) VectorMethodCall(receiver core.Value, name core.Value, argCount in
 			}
 		}
 	case core.VAL_VEC4:
-		if int(name.InternedId) == core.ADD && argCount == 1 {
+		if int(name.InternedId()) == core.ADD && argCount == 1 {
 			// special case for Vec4 addition
 			other := vm.Peek(0)
-			if other.ObjType == core.OBJECT_VEC4 {
+			if other.ObjType() == core.OBJECT_VEC4 {
 				v4 := other.AsVec4()
 				receiver.AsVec4().AddInPlace(v4)
 				vm.pop() // pop the other vector
@@ -2135,11 +2529,16 @@ func (vm *VM) VectorMethodCall(receiver core.Value, name core.Value, argCount in
 }
 
 // bindMethod creates a bound method object that combines an instance with a method from its class.
-func (vm *VM) bindMethod(class *core.ClassObject, stringId int) bool {
-	method, ok := class.Methods[stringId]
+// The method is looked up in, and recorded in, the instruction's inline cache.
+func (vm *VM) bindMethod(class *core.ClassObject, stringId int, cache *core.InlineCache) bool {
+	method, ok := cache.Get(class, false)
 	if !ok {
-		vm.RunTimeError("Undefined property '%s'", core.NameFromID(stringId))
-		return false
+		method, ok = class.Methods[stringId]
+		if !ok {
+			vm.RunTimeError("Undefined property '%s'", core.NameFromID(stringId))
+			return false
+		}
+		cache.Put(class, false, method)
 	}
 	bound := core.MakeBoundMethodObject(vm.Peek(0), method.AsClosure())
 	vm.pop()
@@ -2196,6 +2595,7 @@ func (vm *VM) defineMethod(stringID int, isStatic bool) {
 	} else {
 		class.Methods[stringID] = method
 	}
+	core.ClassesChanged()
 	vm.pop()
 }
 
@@ -2205,7 +2605,8 @@ func (vm *VM) defineMethod(stringID int, isStatic bool) {
 func (vm *VM) defineClassVar(stringID int) {
 	value := vm.Peek(0)
 	class := vm.Peek(1).AsClass()
-	class.Statics[stringID] = value
+	class.SetStatic(stringID, value)
+	core.ClassesChanged()
 	vm.pop()
 }
 
@@ -2216,6 +2617,9 @@ func (vm *VM) call(closure *core.ClosureObject, argCount int) bool {
 	if vm.DebugHook != nil {
 		vm.DebugHook(vm, core.DebugEventCall, closure)
 	}
+	if vm.limits != nil && !vm.checkLimits(1) {
+		return false
+	}
 
 	fn := closure.Function
 	arity := fn.Arity
@@ -2286,15 +2690,13 @@ func (vm *VM) call(closure *core.ClosureObject, argCount int) bool {
 // Only nil and false are falsy in Lox.
 func (vm *VM) isFalsey(v core.Value) bool {
 
-	switch v.Type {
-	case core.VAL_FLOAT:
-		return math.Float64frombits(v.Data) == 0
-	case core.VAL_NIL:
-		return true
-	case core.VAL_BOOL:
-		return v.Data == 0
+	switch {
+	case v.IsBool():
+		return v.Data() == 0
+	case v.IsFloat():
+		return math.Float64frombits(v.Data()) == 0
 	}
-	return true
+	return true // nil, and everything else
 }
 
 //------------------------------------------------------------------------------------------
@@ -2318,11 +2720,7 @@ func (vm *VM) isFalsey(v core.Value) bool {
 // bookkeeping has run.
 func (vm *VM) RaiseExceptionByName(name string, msg string) bool {
 
-	classVal := vm.BuiltIns[core.InternName(name)]
-	classObj := classVal.Obj
-	instance := core.MakeInstanceObject(classObj.(*core.ClassObject))
-	instance.Fields[core.MSG] = core.MakeStringObjectValue(msg, false)
-	return vm.raiseException(core.MakeObjectValue(instance, false))
+	return vm.raiseException(core.MakeObjectValue(vm.newException(name, msg), false))
 }
 
 //------------------------------------------------------------------------------------------
@@ -2363,7 +2761,7 @@ func (vm *VM) raiseException(err core.Value) bool {
 				vm.frame().Ip += 2
 				idx := vm.getCode()[vm.frame().Ip-1]
 				function := vm.frame().Closure.Function
-				id := int(function.Chunk.Constants[idx].InternedId)
+				id := int(function.Chunk.Constants[idx].InternedId())
 				v, ok := function.Environment.GetVar(id)
 				if !ok {
 					v, ok = vm.BuiltIns[id]
@@ -2408,7 +2806,9 @@ func (vm *VM) raiseException(err core.Value) bool {
 
 		if !vm.popFrame() {
 			exc := err.AsInstance()
-			vm.RunTimeError("Uncaught exception: %s : %s ", exc.Class, exc.Fields[core.MSG])
+			vm.uncaught = exc
+			msg, _ := exc.GetField(core.MSG)
+			vm.RunTimeError("Uncaught exception: %s : %s ", exc.Class, msg)
 			return false
 		}
 	}
@@ -2486,10 +2886,22 @@ func (vm *VM) appendStackTrace() {
 
 //------------------------------------------------------------------------------------------
 
+// StackTrace returns the stack trace recorded for the last runtime error, two
+// lines per frame: the location, then the source line.
+func (vm *VM) StackTrace() []string {
+	return vm.stackTrace
+}
+
+// Uncaught returns the exception that ended the last run, or nil if the run
+// succeeded or failed without one (e.g. a wrong argument count for CallClosure).
+func (vm *VM) Uncaught() *core.InstanceObject {
+	return vm.uncaught
+}
+
 // PrintStackTrace outputs the current stack trace to stderr for debugging.
 func (vm *VM) PrintStackTrace() {
 	for _, v := range vm.stackTrace {
-		fmt.Fprintf(os.Stderr, "%s\n", v)
+		fmt.Fprintf(vm.stderr, "%s\n", v)
 	}
 }
 
@@ -2500,9 +2912,12 @@ func (vm *VM) sourceLine(script string, line int) string {
 
 	source := vm.source
 	if script != vm.script {
-		module := getModule(script)
 		moduleCacheMu.Lock()
-		source = globalModuleSource[module]
+		src, ok := globalModuleSource[script]
+		if !ok {
+			src = globalModuleSource[getModule(script)]
+		}
+		source = src
 		moduleCacheMu.Unlock()
 	}
 	lines := strings.Split(source, "\n")
@@ -2515,83 +2930,238 @@ func (vm *VM) sourceLine(script string, line int) string {
 
 //------------------------------------------------------------------------------------------
 
-// importModule loads and executes a Lox module, adding it to the current environment.
+// importModule loads the (dotted, possibly relative) module moduleName and
+// binds it in the current environment under alias. An alias containing a
+// dot is the full name of an `import a.b.c` with no `as`, which binds the
+// top-level package a, as Python does. If the module cannot be found an
+// ImportError is recorded on the VM and INTERPRET_RUNTIME_ERROR returned.
 //
 //go:noinline
 func (vm *VM) importModule(moduleName string, alias string) InterpretResult {
 
 	core.LogFmtLn(core.DEBUG, "Importing module %s as %s\n", moduleName, alias)
-	searchPath := getPath(vm.Args(), moduleName) + ".lox"
-	bytes, err := os.ReadFile(searchPath)
+	module, res := vm.loadModule(moduleName)
+	if res != INTERPRET_OK {
+		return res
+	}
+	if idx := strings.Index(alias, "."); idx >= 0 {
+		alias = alias[:idx]
+		moduleCacheMu.Lock()
+		module = globalModules[alias]
+		moduleCacheMu.Unlock()
+	}
+	v := core.MakeObjectValue(module, false)
+	env := vm.frame().Closure.Function.Environment
+	env.SetVar(core.InternName(alias), v)
+	if slot := vm.frame().Closure.Function.Chunk.SlotForName(alias); slot >= 0 {
+		env.SetGlobal(slot, v)
+	}
+	core.LogFmtLn(core.DEBUG, "ImportModule %s as %s return\n", moduleName, alias)
+	return INTERPRET_OK
+}
+
+//------------------------------------------------------------------------------------------
+
+// loadModule returns the module object for moduleName, loading it and any
+// enclosing packages first if they are not already loaded. Each submodule is
+// also set as an attribute of its parent package.
+func (vm *VM) loadModule(moduleName string) (*core.ModuleObject, InterpretResult) {
+
+	name, err := vm.absoluteModuleName(moduleName)
 	if err != nil {
-		vm.RunTimeError("Could not find module %s.", searchPath)
-		return INTERPRET_RUNTIME_ERROR
+		vm.RunTimeErrorNamed("ImportError", "%v", err)
+		return nil, INTERPRET_RUNTIME_ERROR
 	}
 	moduleCacheMu.Lock()
-	module, ok := globalModules[moduleName]
+	module, ok := globalModules[name]
+	if ok {
+		if _, loading := modulesLoading[name]; loading {
+			if cycle := vm.importCycle(name); cycle != "" {
+				modulesLoading[name] = cycle
+			}
+		}
+	}
 	moduleCacheMu.Unlock()
 	if ok {
-		// module already loaded, just add to the current environment
-		core.LogFmtLn(core.DEBUG, "Module %s already loaded, adding to current environment.\n", moduleName)
-		v := core.MakeObjectValue(module, false)
-		vm.frame().Closure.Function.Environment.SetVar(core.InternName(alias), v)
-		env := vm.frame().Closure.Function.Environment
-		if slot := vm.frame().Closure.Function.Chunk.SlotForName(alias); slot >= 0 {
-			env.SetGlobal(slot, v)
+		core.LogFmtLn(core.DEBUG, "Module %s already loaded.\n", name)
+		return module, INTERPRET_OK
+	}
+
+	var parent *core.ModuleObject
+	dirs := vm.searchPath()
+	leaf := name
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		var res InterpretResult
+		if parent, res = vm.loadModule(name[:idx]); res != INTERPRET_OK {
+			return nil, res
+		}
+		moduleCacheMu.Lock()
+		parentSpec := moduleSpecs[parent.Name]
+		moduleCacheMu.Unlock()
+		if parentSpec.dir == "" {
+			vm.RunTimeErrorNamed("ImportError", "No module named '%s': '%s' is not a package", name, parent.Name)
+			return nil, INTERPRET_RUNTIME_ERROR
 		}
+		dirs = []string{parentSpec.dir}
+		leaf = name[idx+1:]
+	}
+
+	spec, found, tried := findModule(dirs, leaf)
+	if !found && parent == nil && len(vm.Args()) > 0 {
+		// legacy fallback: a bare name anywhere below the main script's directory
+		root := scriptDir(vm.Args()[0])
+		files := findModuleInSubdirs(root, name)
+		if len(files) > 1 {
+			vm.RunTimeErrorNamed("ImportError", "Module name '%s' is ambiguous: found %s", name, strings.Join(files, ", "))
+			return nil, INTERPRET_RUNTIME_ERROR
+		}
+		if len(files) == 1 {
+			spec, found = moduleSpec{file: files[0]}, true
+		}
+		tried = append(tried, root+"/**/"+name+".lox")
+	}
+	if !found {
+		vm.RunTimeErrorNamed("ImportError", "No module named '%s' (searched: %s)", name, strings.Join(tried, ", "))
+		return nil, INTERPRET_RUNTIME_ERROR
+	}
+
+	// Register the module before its body runs: a module it imports, directly
+	// or not, that imports it back gets this partially initialised object
+	// rather than recursing forever.
+	module = core.MakeModuleObject(name, core.NewEnvironment(name))
+	spec.modTime = fileModTime(spec.file)
+	moduleCacheMu.Lock()
+	moduleSpecs[name] = spec
+	globalModules[name] = module
+	modulesLoading[name] = ""
+	moduleCacheMu.Unlock()
+	if parent != nil {
+		parent.Environment.SetVar(core.InternName(leaf), core.MakeObjectValue(module, false))
+	}
+	res := vm.runModule(module, spec)
+	moduleCacheMu.Lock()
+	delete(modulesLoading, name)
+	if res != INTERPRET_OK {
+		delete(globalModules, name)
+		delete(moduleSpecs, name)
+	}
+	moduleCacheMu.Unlock()
+	if res != INTERPRET_OK {
+		if parent != nil {
+			parent.Environment.DeleteVar(core.InternName(leaf))
+		}
+		return nil, res
+	}
+	return module, INTERPRET_OK
+}
+
+//------------------------------------------------------------------------------------------
+
+// runModule runs a module body in a fresh sub-VM, from its .lxc bytecode
+// cache if that is up to date and the VM isn't sandboxed, filling in the
+// already registered module object. The module's environment is attached before the body starts so a
+// cyclic importer sees globals as they are defined. A namespace package has
+// no body and stays empty.
+func (vm *VM) runModule(module *core.ModuleObject, spec moduleSpec) InterpretResult {
+
+	name := module.Name
+	if spec.file == "" {
 		return INTERPRET_OK
 	}
+	source, err := os.ReadFile(spec.file)
+	if err != nil {
+		vm.RunTimeErrorNamed("ImportError", "Could not read module %s: %v", spec.file, err)
+		return INTERPRET_RUNTIME_ERROR
+	}
 	moduleCacheMu.Lock()
-	globalModuleSource[moduleName] = string(bytes)
+	globalModuleSource[name] = string(source)
+	globalModuleSource[spec.file] = string(source)
 	moduleCacheMu.Unlock()
-	subvm := NewVM(searchPath, false)
-	subvm.BuiltIns = vm.BuiltIns
-	subvm.BuiltInModules = vm.BuiltInModules
-	subvm.SetArgs(vm.Args())
-	subvm.ModuleImport = true
+	subvm := vm.moduleVM(spec.file, name)
 	// see if we can load lxc bytecode file for the module.
-	// if so run it
-	if loadedChunk, newEnv, ok := loadLxc(searchPath); ok {
-		core.LogFmtLn(core.DEBUG, "Loaded module %s from bytecode.\n", moduleName)
-		loadedChunk.Filename = moduleName
-		subvm.callLoadedChunk(moduleName, newEnv, loadedChunk)
-		core.LogFmtLn(core.DEBUG, "Completed run of module %s.\n", moduleName)
+	// if not, compile the module source and cache its bytecode
+	var chunk *core.Chunk
+	var env *core.Environment
+	ok := false
+	if vm.sandbox == nil {
+		chunk, env, ok = loadLxc(spec.file)
+	}
+	if ok {
+		core.LogFmtLn(core.DEBUG, "Loaded module %s from bytecode.\n", name)
 	} else {
-		// if not, load the module source, compile it and run it
-		core.LogFmtLn(core.DEBUG, "Compiling module %s from source.\n", moduleName)
-		res, _ := subvm.Interpret(string(bytes), moduleName)
-		if res != INTERPRET_OK {
-			return res
+		core.LogFmtLn(core.DEBUG, "Compiling module %s from source.\n", name)
+		function, diags := compiler.Compile(spec.file, string(source), name)
+		if vm.reportDiagnostics(diags) || function == nil {
+			return INTERPRET_COMPILE_ERROR
 		}
-		core.LogFmtLn(core.DEBUG, "Completed compile/run of module %s.\n", moduleName)
+		b := new(bytes.Buffer)
+		function.Chunk.Serialise(b)
+		writeToLxc(subvm, b)
+		chunk, env = function.Chunk, function.Environment
 	}
-	core.LogFmtLn(core.DEBUG, "Created module object for %s.\n", moduleName)
-	subfn := subvm.Frames[0].Closure.Function
+	chunk.Filename = name
+	env.Name = name
+	module.Environment = env
+	if res := subvm.callLoadedChunk(name, env, chunk); res != INTERPRET_OK {
+		vm.reraiseModuleError(subvm)
+		return res
+	}
+	core.LogFmtLn(core.DEBUG, "Completed run of module %s.\n", name)
 	// Sync final global values into the Vars map so importFunctionFromModule can find them.
-	for slot, name := range subfn.Chunk.GlobalNames {
-		if subfn.Environment.Defined[slot] {
-			subfn.Environment.Vars[core.InternName(name)] = subfn.Environment.Globals[slot]
+	syncModuleVars(env)
+	debug.TraceDumpValue("Dump:", core.MakeObjectValue(module, false))
+	return INTERPRET_OK
+}
+
+// moduleVM creates the sub-VM the body of the module name, in file, runs in
+// on this VM's behalf.
+func (vm *VM) moduleVM(file string, name string) *VM {
+
+	subvm := NewVM(file, false)
+	subvm.BuiltIns = vm.BuiltIns
+	subvm.BuiltInModules = vm.BuiltInModules
+	subvm.inheritStreams(vm)
+	subvm.inheritLimits(vm)
+	subvm.inheritSandbox(vm)
+	subvm.shareMemory(vm)
+	subvm.SetArgs(vm.Args())
+	subvm.ModuleImport = true
+	subvm.importChain = append(append([]string{}, vm.importChain...), name)
+	subvm.ReportDiagnostics = vm.ReportDiagnostics
+	subvm.Warnings = vm.Warnings
+	return subvm
+}
+
+//------------------------------------------------------------------------------------------
+
+// reraiseModuleError passes an exception that escaped a module body on to the
+// importing VM. A built-in exception class is kept, so an ImportError from a
+// circular import can be caught as one; anything else becomes a RunTimeError.
+func (vm *VM) reraiseModuleError(subvm *VM) {
+
+	exc := subvm.uncaught
+	if exc == nil {
+		if subvm.ErrorMsg != "" {
+			vm.RunTimeError("%s", subvm.ErrorMsg)
 		}
+		return
 	}
-	mo := core.MakeModuleObject(moduleName, subfn.Environment)
-
-	moduleCacheMu.Lock()
-	globalModules[moduleName] = mo
-	moduleCacheMu.Unlock()
-	v := core.MakeObjectValue(mo, false)
-	debug.TraceDumpValue("Dump:", v)
-	vm.frame().Closure.Function.Environment.SetVar(core.InternName(alias), v)
-	if slot := vm.frame().Closure.Function.Chunk.SlotForName(alias); slot >= 0 {
-		vm.frame().Closure.Function.Environment.SetGlobal(slot, v)
+	name := exc.Class.Name.Get()
+	if v, ok := vm.BuiltIns[core.InternName(name)]; !ok || !v.IsObj() || v.ObjType() != core.OBJECT_CLASS {
+		name = "RunTimeError"
+	}
+	msg, _ := exc.GetField(core.MSG)
+	if msg.IsStringObject() {
+		vm.RunTimeErrorNamed(name, "%s", msg.AsString().Get())
+	} else {
+		vm.RunTimeErrorNamed(name, "%s", msg.String())
 	}
-	core.LogFmtLn(core.DEBUG, "ImportModule %s as %s return\n", moduleName, alias)
-	return INTERPRET_OK
 }
 
 //------------------------------------------------------------------------------------------
 
 // callLoadedChunk executes a compiled chunk in a new environment with module isolation.
-func (subvm *VM) callLoadedChunk(name string, newEnv *core.Environment, chunk *core.Chunk) {
+func (subvm *VM) callLoadedChunk(name string, newEnv *core.Environment, chunk *core.Chunk) InterpretResult {
 
 	function := core.MakeFunctionObject(name, newEnv)
 	function.Chunk = chunk
@@ -2600,59 +3170,84 @@ func (subvm *VM) callLoadedChunk(name string, newEnv *core.Environment, chunk *c
 	closure := core.MakeClosureObject(function)
 	subvm.push(core.MakeObjectValue(closure, false))
 	subvm.call(closure, 0)
-	_, _ = subvm.run(RUN_TO_COMPLETION)
+	res, _ := subvm.run(RUN_TO_COMPLETION)
+	return res
 }
 
 //------------------------------------------------------------------------------------------
 
-// importFunctionFromModule imports a specific function from a module into the current environment.
-func (vm *VM) importFunctionFromModule(module string, name string) bool {
+// importFunctionFromModule imports a specific function from a module into the current environment,
+// or with name "*" everything the module exports (see moduleExports). A name the module does not
+// define may instead be a submodule of a package (`from . import util`), which is loaded on demand.
+func (vm *VM) importFunctionFromModule(moduleObj *core.ModuleObject, name string) bool {
 
-	moduleId := core.InternName(module)
+	module := moduleObj.Name
 	nameId := core.InternName(name)
 
-	moduleVal, ok := vm.frame().Closure.Function.Environment.GetVar(moduleId)
-	if !ok {
-		vm.RunTimeError("Module '%s' is not imported.", module)
-		return false
-	}
 	currentEnv := vm.frame().Closure.Function.Environment
 	currentChunk := vm.frame().Closure.Function.Chunk
-	if name == "__all__" {
-		// import all functions from the module
-		moduleObj := moduleVal.AsModule()
-		for k, v := range moduleObj.Environment.VarsSnapshot() {
-			if v.Type == core.VAL_OBJ && (v.ObjType == core.OBJECT_CLOSURE ||
-				v.ObjType == core.OBJECT_NATIVE) {
-				currentEnv.SetVar(k, v)
-				// also write to the fast globals slot using a name-based lookup
-				for slot, gname := range currentChunk.GlobalNames {
-					if core.InternName(gname) == k {
-						currentEnv.SetGlobal(slot, v)
-						break
-					}
+	bind := func(id int, v core.Value) {
+		currentEnv.SetVar(id, v)
+		// also write to the fast globals slot using a name-based lookup
+		if slot := currentChunk.SlotForName(core.NameFromID(id)); slot >= 0 {
+			currentEnv.SetGlobal(slot, v)
+		}
+	}
+	if name == "*" {
+		// import all functions from the module, as far as it has got if it is still initialising
+		if isLoading(module) {
+			syncModuleVars(moduleObj.Environment)
+		}
+		if exports, ok := moduleExports(moduleObj); ok {
+			for id := range exports {
+				v, found := moduleAttr(moduleObj, id)
+				if !found {
+					vm.RunTimeErrorNamed("ImportError", "'%s' is exported by module '%s' but not defined", core.NameFromID(id), module)
+					return false
 				}
+				bind(id, v)
+			}
+			return true
+		}
+		for k, v := range moduleObj.Environment.VarsSnapshot() {
+			if v.IsObj() && (v.ObjType() == core.OBJECT_CLOSURE ||
+				v.ObjType() == core.OBJECT_NATIVE) && !strings.HasPrefix(core.NameFromID(k), "_") {
+				bind(k, v)
 			}
 		}
 		return true
 	} else {
 
-		moduleObj := moduleVal.AsModule()
-		fn, ok := moduleObj.Environment.GetVar(nameId)
+		fn, ok := moduleAttr(moduleObj, nameId)
+		if !ok && vm.isPackage(module) {
+			sub, res := vm.loadModule(module + "." + name)
+			if res != INTERPRET_OK {
+				return false
+			}
+			bind(nameId, core.MakeObjectValue(sub, false))
+			return true
+		}
 		if !ok {
-			vm.RunTimeError("Function '%s' not found in module '%s'.", name, module)
+			if !vm.partialModuleError(moduleObj, name) {
+				vm.RunTimeError("Function '%s' not found in module '%s'.", name, module)
+			}
 			return false
 		}
-		t := fn.ObjType
-		if t != core.OBJECT_CLOSURE && t != core.OBJECT_CLASS && t != core.OBJECT_NATIVE {
-			vm.RunTimeError("'%s' not found in module '%s'.", name, module)
+		exports, explicit := moduleExports(moduleObj)
+		if !isExported(moduleObj, name) {
+			if explicit {
+				vm.RunTimeErrorNamed("ImportError", "cannot import name '%s' from module '%s': it is not exported", name, module)
+			} else {
+				vm.RunTimeErrorNamed("ImportError", "cannot import name '%s' from module '%s': it is private", name, module)
+			}
 			return false
 		}
-
-		currentEnv.SetVar(nameId, fn)
-		if slot := currentChunk.SlotForName(name); slot >= 0 {
-			currentEnv.SetGlobal(slot, fn)
+		t := fn.ObjType()
+		if !exports[nameId] && t != core.OBJECT_CLOSURE && t != core.OBJECT_CLASS && t != core.OBJECT_NATIVE && t != core.OBJECT_MODULE {
+			vm.RunTimeError("'%s' not found in module '%s'.", name, module)
+			return false
 		}
+		bind(nameId, fn)
 		return true
 	}
 
@@ -2661,10 +3256,13 @@ func (vm *VM) importFunctionFromModule(module string, name string) bool {
 //------------------------------------------------------------------------------------------
 
 // createList creates a list object from the specified number of values on the stack.
-func (vm *VM) createList(frame *core.CallFrame) {
+func (vm *VM) createList(frame *core.CallFrame) bool {
 
 	itemCount := int(vm.currCode[frame.Ip])
 	frame.Ip++
+	if vm.memory != nil && !vm.Charge(core.ListSize+core.ValueSize*itemCount) {
+		return false
+	}
 	list := []core.Value{}
 
 	for i := 0; i < itemCount; i++ {
@@ -2673,15 +3271,19 @@ func (vm *VM) createList(frame *core.CallFrame) {
 	lo := core.MakeListObject(list, false)
 	vm.stack[vm.stackTop] = core.MakeObjectValue(lo, false)
 	vm.stackTop++
+	return true
 }
 
 //------------------------------------------------------------------------------------------
 
 // createTuple creates an immutable tuple object from the specified number of values on the stack.
-func (vm *VM) createTuple(frame *core.CallFrame) {
+func (vm *VM) createTuple(frame *core.CallFrame) bool {
 
 	itemCount := int(vm.currCode[frame.Ip])
 	frame.Ip++
+	if vm.memory != nil && !vm.Charge(core.ListSize+core.ValueSize*itemCount) {
+		return false
+	}
 	list := []core.Value{}
 
 	for i := 0; i < itemCount; i++ {
@@ -2690,15 +3292,19 @@ func (vm *VM) createTuple(frame *core.CallFrame) {
 	lo := core.MakeListObject(list, true)
 	vm.stack[vm.stackTop] = core.MakeObjectValue(lo, true)
 	vm.stackTop++
+	return true
 }
 
 //------------------------------------------------------------------------------------------
 
 // createDict creates a dictionary object from key-value pairs on the stack.
-func (vm *VM) createDict(frame *core.CallFrame) {
+func (vm *VM) createDict(frame *core.CallFrame) bool {
 
 	itemCount := int(vm.currCode[frame.Ip])
 	frame.Ip++
+	if vm.memory != nil && !vm.Charge(core.DictSize+core.DictEntrySize*itemCount) {
+		return false
+	}
 	dict := map[int]core.Value{}
 
 	for i := 0; i < itemCount; i++ {
@@ -2717,6 +3323,7 @@ func (vm *VM) createDict(frame *core.CallFrame) {
 	do := core.MakeDictObject(dict)
 	vm.stack[vm.stackTop] = core.MakeObjectValue(do, false)
 	vm.stackTop++
+	return true
 }
 
 //------------------------------------------------------------------------------------------
@@ -2728,14 +3335,14 @@ func (vm *VM) index() bool {
 	sv := vm.pop()
 
 	if sv.IsObj() {
-		switch sv.ObjType {
+		switch sv.ObjType() {
 		case core.OBJECT_LIST:
-			if iv.Type != core.VAL_INT {
+			if !iv.IsInt() {
 				vm.RunTimeError("Subscript must be an integer.")
 				return false
 			}
 			t := sv.AsList()
-			idx := int(iv.Data)
+			idx := int(iv.Data())
 			lo, err := t.Index(idx)
 			if err != nil {
 				vm.RunTimeError("%v", err)
@@ -2746,11 +3353,11 @@ func (vm *VM) index() bool {
 			return true
 
 		case core.OBJECT_STRING:
-			if iv.Type != core.VAL_INT {
+			if !iv.IsInt() {
 				vm.RunTimeError("Subscript must be an integer.")
 				return false
 			}
-			idx := int(iv.Data)
+			idx := int(iv.Data())
 			t := sv.AsString()
 			so, err := t.Index(idx)
 			if err != nil {
@@ -2795,16 +3402,16 @@ func (vm *VM) indexAssign() bool {
 	rhs := vm.pop()
 	index := vm.pop()
 	collection := vm.Peek(0)
-	if collection.Type == core.VAL_OBJ {
-		switch collection.ObjType {
+	if collection.IsObj() {
+		switch collection.ObjType() {
 		case core.OBJECT_LIST:
 			t := collection.AsList()
 			if t.Tuple {
 				vm.RunTimeError("Tuples are immutable.")
 				return false
 			}
-			if index.Type == core.VAL_INT {
-				if err := t.AssignToIndex(int(index.Data), rhs); err != nil {
+			if index.IsInt() {
+				if err := t.AssignToIndex(int(index.Data()), rhs); err != nil {
 					vm.RunTimeError("%v", err)
 					return false
 				} else {
@@ -2824,6 +3431,11 @@ func (vm *VM) indexAssign() bool {
 				key = index.String()
 			}
 
+			if vm.memory != nil {
+				if _, ok := t.Items[core.InternName(key)]; !ok && !vm.Charge(core.DictEntrySize) {
+					return false
+				}
+			}
 			t.Set(key, rhs)
 			return true
 		}
@@ -2840,43 +3452,49 @@ func (vm *VM) slice() bool {
 	var from_idx, to_idx int
 
 	v_to := vm.pop()
-	if v_to.Type == core.VAL_NIL {
+	if v_to.IsNil() {
 		to_idx = -1
-	} else if v_to.Type != core.VAL_INT {
+	} else if !v_to.IsInt() {
 		vm.RunTimeError("Invalid type in slice expression.")
 		return false
 	} else {
-		to_idx = int(v_to.Data)
+		to_idx = int(v_to.Data())
 	}
 
 	v_from := vm.pop()
-	if v_from.Type == core.VAL_NIL {
+	if v_from.IsNil() {
 		from_idx = 0
-	} else if v_from.Type != core.VAL_INT {
+	} else if !v_from.IsInt() {
 		vm.RunTimeError("Invalid type in slice expression.")
 		return false
 	} else {
-		from_idx = int(v_from.Data)
+		from_idx = int(v_from.Data())
 	}
 
 	lv := vm.pop()
 	if lv.IsObj() {
-		if lv.ObjType == core.OBJECT_LIST {
+		if lv.ObjType() == core.OBJECT_LIST {
 			lo, err := lv.AsList().Slice(from_idx, to_idx)
 			if err != nil {
 				vm.RunTimeError("%v", err)
 				return false
 			}
+			if vm.memory != nil && !vm.Charge(core.ListSize+core.ValueSize*len(lo.AsList().Items)) {
+				return false
+			}
 			vm.stack[vm.stackTop] = lo
 			vm.stackTop++
 			return true
 
-		} else if lv.ObjType == core.OBJECT_STRING {
+		} else if lv.ObjType() == core.OBJECT_STRING {
 			so, err := lv.AsString().Slice(from_idx, to_idx)
 			if err != nil {
 				vm.RunTimeError("%v", err)
 				return false
 			}
+			if vm.memory != nil && !vm.Charge(core.StringSize+len(so.AsString().Get())) {
+				return false
+			}
 			vm.stack[vm.stackTop] = so
 			vm.stackTop++
 			return true
@@ -2896,29 +3514,29 @@ func (vm *VM) sliceAssign() bool {
 	val := vm.pop() // RHS
 
 	v_to := vm.pop()
-	if v_to.Type == core.VAL_NIL {
+	if v_to.IsNil() {
 		to_idx = -1
-	} else if v_to.Type != core.VAL_INT {
+	} else if !v_to.IsInt() {
 		vm.RunTimeError("Invalid type in slice expression.")
 		return false
 	} else {
-		to_idx = int(v_to.Data)
+		to_idx = int(v_to.Data())
 	}
 
 	v_from := vm.pop()
-	if v_from.Type == core.VAL_NIL {
+	if v_from.IsNil() {
 		from_idx = 0
-	} else if v_from.Type != core.VAL_INT {
+	} else if !v_from.IsInt() {
 		vm.RunTimeError("Invalid type in slice expression.")
 		return false
 	} else {
-		from_idx = int(v_from.Data)
+		from_idx = int(v_from.Data())
 	}
 
 	lv := vm.Peek(0)
 	if lv.IsObj() {
 
-		if lv.ObjType == core.OBJECT_LIST {
+		if lv.ObjType() == core.OBJECT_LIST {
 			lst := lv.AsList()
 			if lst.Tuple {
 				vm.RunTimeError("Tuples are immutable")
@@ -2944,33 +3562,33 @@ func (vm *VM) binarySubtract() bool {
 	v2 := vm.pop()
 	v1 := vm.pop()
 
-	switch v2.Type {
+	switch v2.Type() {
 	case core.VAL_INT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data)-int(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data())-int(v2.Data()), false)
 			vm.stackTop++
 			return true
 		case core.VAL_FLOAT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)-float64(int(v2.Data)), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())-float64(int(v2.Data())), false)
 			vm.stackTop++
 			return true
 		}
 
 	case core.VAL_FLOAT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data))-math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data()))-math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 			return true
 		case core.VAL_FLOAT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)-math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())-math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 			return true
 		}
 
 	case core.VAL_VEC2:
-		if v1.Type != core.VAL_VEC2 {
+		if v1.Type() != core.VAL_VEC2 {
 			vm.RunTimeError("Subtraction type mismatch: %s - %s", v1.String(), v2.String())
 			return false
 		}
@@ -2981,7 +3599,7 @@ func (vm *VM) binarySubtract() bool {
 		return true
 
 	case core.VAL_VEC3:
-		if v1.Type != core.VAL_VEC3 {
+		if v1.Type() != core.VAL_VEC3 {
 			vm.RunTimeError("Subtraction type mismatch: %s - %s", v1.String(), v2.String())
 			return false
 		}
@@ -2992,7 +3610,7 @@ func (vm *VM) binarySubtract() bool {
 		return true
 
 	case core.VAL_VEC4:
-		if v1.Type != core.VAL_VEC4 {
+		if v1.Type() != core.VAL_VEC4 {
 			vm.RunTimeError("Subtraction type mismatch: %s - %s", v1.String(), v2.String())
 			return false
 		}
@@ -3015,14 +3633,14 @@ func (vm *VM) binaryMultiply() bool {
 	v2 := vm.pop()
 	v1 := vm.pop()
 
-	switch v2.Type {
+	switch v2.Type() {
 	case core.VAL_INT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data)*int(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data())*int(v2.Data()), false)
 			vm.stackTop++
 		case core.VAL_FLOAT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)*float64(int(v2.Data)), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())*float64(int(v2.Data())), false)
 			vm.stackTop++
 		case core.VAL_OBJ:
 			if !v1.IsStringObject() {
@@ -3030,19 +3648,23 @@ func (vm *VM) binaryMultiply() bool {
 				return false
 			}
 			s := v1.AsString().Get()
-			vm.stack[vm.stackTop] = vm.stringMultiply(s, int(v2.Data))
+			v, ok := vm.stringMultiply(s, int(v2.Data()))
+			if !ok {
+				return false
+			}
+			vm.stack[vm.stackTop] = v
 			vm.stackTop++
 		default:
 			vm.RunTimeError("Invalid operand for multiply.")
 			return false
 		}
 	case core.VAL_FLOAT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data))*math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data()))*math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 		case core.VAL_FLOAT:
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)*math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())*math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 		default:
 			vm.RunTimeError("Invalid operand for multiply.")
@@ -3053,10 +3675,14 @@ func (vm *VM) binaryMultiply() bool {
 			vm.RunTimeError("Invalid operand for multiply.")
 			return false
 		}
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
 			s := v2.AsString().Get()
-			vm.stack[vm.stackTop] = vm.stringMultiply(s, int(v1.Data))
+			v, ok := vm.stringMultiply(s, int(v1.Data()))
+			if !ok {
+				return false
+			}
+			vm.stack[vm.stackTop] = v
 			vm.stackTop++
 		default:
 			vm.RunTimeError("Invalid operand for multiply.")
@@ -3079,43 +3705,43 @@ func (vm *VM) binaryDivide() bool {
 	v2 := vm.pop()
 	v1 := vm.pop()
 
-	switch v2.Type {
+	switch v2.Type() {
 	case core.VAL_INT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			if v2.Data == 0 {
+			if v2.Data() == 0 {
 				vm.RunTimeError("Division by zero")
 				return false
 			}
-			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data)/int(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data())/int(v2.Data()), false)
 			vm.stackTop++
 			return true
 		case core.VAL_FLOAT:
-			if v2.Data == 0 {
+			if v2.Data() == 0 {
 				vm.RunTimeError("Division by zero")
 				return false
 			}
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)/float64(int(v2.Data)), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())/float64(int(v2.Data())), false)
 			vm.stackTop++
 			return true
 		}
 
 	case core.VAL_FLOAT:
-		switch v1.Type {
+		switch v1.Type() {
 		case core.VAL_INT:
-			if math.Float64frombits(v2.Data) == 0.0 {
+			if math.Float64frombits(v2.Data()) == 0.0 {
 				vm.RunTimeError("Division by zero")
 				return false
 			}
-			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data))/math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(float64(int(v1.Data()))/math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 			return true
 		case core.VAL_FLOAT:
-			if math.Float64frombits(v2.Data) == 0.0 {
+			if math.Float64frombits(v2.Data()) == 0.0 {
 				vm.RunTimeError("Division by zero")
 				return false
 			}
-			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data)/math.Float64frombits(v2.Data), false)
+			vm.stack[vm.stackTop] = core.MakeFloatValue(math.Float64frombits(v1.Data())/math.Float64frombits(v2.Data()), false)
 			vm.stackTop++
 			return true
 		}
@@ -3137,11 +3763,11 @@ func (vm *VM) binaryModulus() bool {
 		vm.RunTimeError("Operands must be integers")
 		return false
 	}
-	if int(v2.Data) == 0 {
+	if int(v2.Data()) == 0 {
 		vm.RunTimeError("Division by zero")
 		return false
 	}
-	vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data)%int(v2.Data), false)
+	vm.stack[vm.stackTop] = core.MakeIntValue(int(v1.Data())%int(v2.Data()), false)
 	vm.stackTop++
 
 	return true
@@ -3150,13 +3776,21 @@ func (vm *VM) binaryModulus() bool {
 //------------------------------------------------------------------------------------------
 
 // stringMultiply creates a new string by repeating the input string x times.
-func (vm *VM) stringMultiply(s string, x int) core.Value {
+// It reports false, having raised MemoryError, if that is over the memory
+// limit or too long to make at all.
+func (vm *VM) stringMultiply(s string, x int) (core.Value, bool) {
 
-	rv := ""
-	for i := 0; i < x; i++ {
-		rv += s
+	if x <= 0 || s == "" {
+		return core.MakeStringObjectValue("", false), true
+	}
+	if x > (math.MaxInt-core.StringSize)/len(s) {
+		vm.RunTimeErrorNamed("MemoryError", "String repetition is too long.")
+		return core.NIL_VALUE, false
+	}
+	if vm.memory != nil && !vm.Charge(core.StringSize+len(s)*x) {
+		return core.NIL_VALUE, false
 	}
-	return core.MakeStringObjectValue(rv, false)
+	return core.MakeStringObjectValue(strings.Repeat(s, x), false), true
 }
 
 // ------------------------------------------------------------------------------------------
@@ -3186,72 +3820,6 @@ func (vm *VM) patchInstruction(ip int, newOp byte) {
 //------------------------------------------------------------------------------------------
 //------------------------------------------------------------------------------------------
 
-// return the path to the given module.
-// first, will look in lox/modules in the lox installation directory defined in LOX_PATH environment var.
-// if not found will look in the directory containing the main module being run, then in any
-// subdirectory of it (recursively), so scripts can group modules into subfolders.
-// getPath constructs the full file path for a module, handling both absolute and relative paths.
-func getPath(args []string, module string) string {
-
-	lox_inst_dir := os.Getenv("LOX_PATH")
-
-	if lox_inst_dir != "" {
-		lox_inst_module_dir := lox_inst_dir + "/src/modules"
-		path := lox_inst_module_dir + "/" + module
-		_, err := os.Stat(path + ".lox")
-		if err == nil {
-			return path
-		}
-	}
-
-	if len(args) == 0 {
-		return module
-	}
-	path := args[0]
-	baseDir := "."
-	if idx := strings.LastIndexAny(path, "/\\"); idx >= 0 {
-		baseDir = path[:idx]
-	}
-
-	sameDir := baseDir + "/" + module
-	if _, err := os.Stat(sameDir + ".lox"); err == nil {
-		return sameDir
-	}
-	if found := findModuleInSubdirs(baseDir, module); found != "" {
-		return found
-	}
-	// not found anywhere: return the same-directory path so the caller's
-	// existing "could not find module" error reports that expected location.
-	return sameDir
-}
-
-// findModuleInSubdirs recursively searches root for a "<module>.lox" file,
-// skipping bytecode cache directories, and returns its path without the
-// extension (matching getPath's other return values), or "" if not found.
-func findModuleInSubdirs(root string, module string) string {
-	target := module + ".lox"
-	found := ""
-	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || found != "" {
-			return nil
-		}
-		if d.IsDir() {
-			if d.Name() == "__loxcache__" {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if d.Name() == target {
-			found = strings.TrimSuffix(path, ".lox")
-			return filepath.SkipAll
-		}
-		return nil
-	})
-	return strings.ReplaceAll(found, "\\", "/")
-}
-
-//------------------------------------------------------------------------------------------
-
 // getModule extracts the module name from a file path by removing the directory and extension.
 func getModule(fullPath string) string {
 	base := filepath.Base(fullPath)      // "foo.lox"
@@ -13,3 +13,14 @@ def run_lox(filename, force_compile=False):
     r    = subprocess.run(cmd, capture_output=True, cwd=TESTS_DIR)
     raw  = r.stdout.replace(b"\r\n", b"\n").replace(b"\r", b"\n")
     return raw.decode("ascii").splitlines()
+
+
+def run_glox(*args):
+    """Run bin/glox with arbitrary arguments (e.g. a subcommand); return
+    (exit code, list of output lines). Relative .lox paths resolve against
+    LOX_DIR."""
+    argv = [os.path.join(LOX_DIR, a) if a.endswith(".lox") and not os.path.isabs(a) else a
+            for a in args]
+    r    = subprocess.run([GLOX] + argv, capture_output=True, cwd=TESTS_DIR)
+    raw  = r.stdout.replace(b"\r\n", b"\n").replace(b"\r", b"\n")
+    return r.returncode, raw.decode("ascii").splitlines()
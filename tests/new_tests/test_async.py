@@ -0,0 +1,63 @@
+from lox_helper import run_lox, run_glox
+
+EXPECTED = [
+    "a start",
+    "b start",
+    "b end",
+    "a end",
+    "a!",
+    "b!",
+    "c start",
+    "d start",
+    "d end",
+    "c end",
+    '[ "c!" , "d!" ]',
+    "42",
+    "true",
+    "slow cancelled: Task was cancelled.",
+    "cleaned up",
+    "true false false",
+    "timeout: Timed out after 0.02 seconds.",
+    "slow cancelled: Task was cancelled.",
+    "cleaned up",
+    "nil",
+    "caught bang",
+    "gather: bang",
+    "result: bang",
+    "6",
+    "6",
+    "42",
+    "thread done",
+    "3",
+    "gather cancelled",
+    "slow cancelled: Task was cancelled.",
+    "cleaned up",
+    "ok",
+    "Can only await a task or future, not 3.",
+    "asyncio.run() can't be called while the event loop is running.",
+    "Deadlock: every task is waiting, and nothing is left to wake one.",
+    "<task nop>",
+    'Uncaught exception: <class Boom> : "bang" ',
+]
+
+
+def test_async():
+    # tasks interleave at each await; cancellation, timeouts and exceptions
+    # are raised inside the awaiting coroutine; a thread's message can be
+    # awaited while other tasks run
+    assert run_lox("async.lox") == EXPECTED
+
+
+def test_async_files(tmp_path):
+    code, lines = run_glox("async_files.lox", str(tmp_path))
+    assert code == 0
+    assert lines == ["[ 5 , nil ]", "hello (copied)", "missing", "nil"]
+    assert (tmp_path / "b.txt").read_text() == "hello (copied)"
+
+
+def test_await_outside_async(tmp_path):
+    script = tmp_path / "bad.lox"
+    script.write_text("func f() {\n    await f();\n}\n")
+    code, lines = run_glox(str(script))
+    assert code != 0
+    assert lines == [f"In {script}: [line 2:5] Error at 'await' : Can't use 'await' outside an async function."]
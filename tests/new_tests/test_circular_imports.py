@@ -0,0 +1,24 @@
+import pytest
+from lox_helper import run_lox
+
+
+# cyclic/ holds modules that import each other: ping/pong only use each
+# other inside functions, early reads a name late has not defined yet, and
+# first/second do the same through `from ... import`.
+@pytest.mark.parametrize("script", ["circular_imports.lox", "circular_imports_ns.lox"])
+def test_circular_imports(script):
+    lines = run_lox(script)
+    assert lines == [
+        "ping/pong",
+        "pong/ping",
+        "cannot access 'answer' from partially initialised module 'cyclic.late' "
+        "(circular import: cyclic.late -> cyclic.early -> cyclic.late)",
+        "late ready",
+        "42",
+        "cannot access 'first' from partially initialised module 'cyclic.first' "
+        "(circular import: cyclic.first -> cyclic.second -> cyclic.first)",
+        # a failed import is not cached, so retrying hits the cycle again
+        "cannot access 'first' from partially initialised module 'cyclic.first' "
+        "(circular import: cyclic.first -> cyclic.second -> cyclic.first)",
+        "nil",
+    ]
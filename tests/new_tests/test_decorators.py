@@ -0,0 +1,30 @@
+import re
+import pytest
+from lox_helper import run_lox
+
+
+@pytest.mark.parametrize("script", ["decorators.lox", "decorators_ns.lox"])
+def test_decorators(script):
+    lines = run_lox(script)
+    assert lines[:7] == [
+        "2584",
+        "19",             # memoize: each fib(n) body runs once
+        "outer:inner:1",
+        "local:10/1",
+        "true",
+        "method:2",
+        "static:2",
+    ]
+    assert re.fullmatch(r'<fn "slow"> took \d+\.\d{3} ms', lines[7])
+    assert lines[8:] == [
+        "3",
+        "call", "7",      # a decorated method reads this
+        "call", "8",      # ... also when bound and called later
+        "20",             # memoized per receiver: double() runs once for c
+        "12",
+        "2",
+        "call", "call", "30",  # super.add() goes through Counter's decorator too
+        "int float string int",
+        "3",              # memoize keys are exact: 1, 1.0 and "1" differ
+        "nil",
+    ]
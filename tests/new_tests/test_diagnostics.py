@@ -0,0 +1,39 @@
+import json
+from lox_helper import run_glox
+
+
+# Parsing recovers after each error, so every mistake in the file is reported,
+# with a column and any related notes.
+def test_multiple_errors_text():
+    code, lines = run_glox("diagnostics_errors.lox")
+    assert code == 65
+    assert [l.split("] ", 1)[1] for l in lines if l.startswith("In ")] == [
+        "Error at '=' : Expect variable name",
+        "Error at 'limit' : Cannot assign to const 'limit'.",
+        "Error at ';' : Expect expression",
+    ]
+    assert lines[0].endswith("diagnostics_errors.lox: [line 2:5] Error at '=' : Expect variable name")
+    assert lines[2] == "    [line 5:11] note : 'limit' is declared const here"
+
+
+def test_multiple_errors_json():
+    code, lines = run_glox("--diagnostics=json", "diagnostics_errors.lox")
+    assert code == 65
+    diags = [json.loads(l) for l in lines]
+    assert [(d["span"]["line"], d["span"]["column"], d["message"]) for d in diags] == [
+        (2, 5, "Expect variable name"),
+        (6, 5, "Cannot assign to const 'limit'."),
+        (8, 12, "Expect expression"),
+    ]
+    assert all(d["severity"] == "error" and d["code"] == "syntax" for d in diags)
+    assert diags[0]["span"]["file"].endswith("diagnostics_errors.lox")
+    assert diags[0]["near"] == "="
+    assert diags[1]["related"][0]["span"]["line"] == 5
+    assert diags[1]["related"][0]["message"] == "'limit' is declared const here"
+
+
+def test_check_json():
+    code, lines = run_glox("check", "--diagnostics=json", "type_errors.lox")
+    assert code == 1
+    diags = [json.loads(l) for l in lines]
+    assert diags and all(d["code"] == "type" for d in diags)
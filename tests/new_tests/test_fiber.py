@@ -0,0 +1,36 @@
+from lox_helper import run_lox
+
+EXPECTED = [
+    "[  ]",
+    "2",
+    '[ "a0" , "b0" ]',
+    '[ "a0" , "b0" , "a1" , "b1" , "a2" ]',
+    "true a done, b done",
+    "0 [  ]",
+    '1 [ "fast" ]',
+    '2 [ "fast" ]',
+    '3 [ "fast" ]',
+    '4 [ "fast" , "slow" ]',
+    '5 [ "fast" , "slow" ]',
+    "1",
+    "3",
+    "3",
+    "caught inside",
+    "tick: boom",
+    "true",
+    "result: Boom: boom",
+    "0 true",
+    "fiber was cancelled",
+    "Not inside a fiber.",
+    "fiber.tick() can't be called from inside a fiber.",
+    "Uncaught exception: <class FiberError> : \"A fiber can't suspend inside a call from a built-in function.\" ",
+    "fiber.spawn() argument must be a function",
+    '[ "one" , "two" ]',
+    "nil",
+]
+
+
+def test_fiber():
+    # fibers interleave at yield and sleep, keep their frames, handlers and
+    # captured locals while suspended, and pass exceptions out through tick
+    assert run_lox("fiber.lox") == EXPECTED
@@ -0,0 +1,67 @@
+import os, shutil
+from lox_helper import run_glox, run_lox, LOX_DIR
+
+FORMATTED = """\
+// glox fmt normalises this file; the test compares it with the output below.
+func scale(xs, k = 2) {
+    var out = []
+    foreach (var x in xs) {
+        out.append(x * k)
+    }
+    return out
+}
+var nums = [1, 2, 3] // the inputs
+if (len(nums) > 2) {
+    print scale(nums)
+} else print "short"
+
+class Counter {
+    init() {
+        this.n = 0
+    }
+    bump(by) {
+        this.n += by
+        return this
+    }
+}
+print Counter().bump(2).bump(3).n
+print format(
+    "%s %s %s %s %s",
+    "a long argument list",
+    "that goes past",
+    "the line width",
+    "of one hundred",
+    "characters"
+)
+"""
+
+
+def test_fmt_check_and_rewrite(tmp_path):
+    path = str(tmp_path / "fmt_unformatted.lox")
+    shutil.copy(os.path.join(LOX_DIR, "fmt_unformatted.lox"), path)
+
+    code, lines = run_glox("fmt", "--check", path)
+    assert code == 1
+    assert lines == [path]
+
+    code, lines = run_glox("fmt", path)
+    assert code == 0 and lines == []
+    with open(path) as f:
+        assert f.read() == FORMATTED
+
+    # Formatting is idempotent, and the formatted script behaves the same.
+    code, lines = run_glox("fmt", "--check", path)
+    assert code == 0 and lines == []
+    _, out = run_glox(path)
+    assert out == run_lox("fmt_unformatted.lox") == [
+        "[ 2 , 4 , 6 ]", "5",
+        "a long argument list that goes past the line width of one hundred characters", "nil"]
+
+
+def test_fmt_reports_syntax_errors(tmp_path):
+    path = tmp_path / "broken.lox"
+    path.write_text("var x = ;\n")
+    code, lines = run_glox("fmt", str(path))
+    assert code == 65
+    assert "Expect expression" in lines[0]
+    assert path.read_text() == "var x = ;\n"
@@ -0,0 +1,30 @@
+"""Constant folding and dead-branch elimination in the compiler."""
+import os, subprocess
+from lox_helper import GLOX, LOX_DIR, TESTS_DIR, run_glox, run_lox
+
+
+EXPECTED = [
+    "11", "3", "3.5", "2", "abc", "true", "false", "true", "nil", "3.14159",
+    "3", "42", "5", "caught", "2", "2",
+]
+
+
+def test_folded_program_output_unchanged():
+    lines = run_lox("fold.lox", force_compile=True)
+    assert lines[:len(EXPECTED)] == EXPECTED, lines
+
+
+def test_same_output_without_optimisation():
+    code, lines = run_glox("--force-compile", "--no-peephole", "fold.lox")
+    assert lines[:len(EXPECTED)] == EXPECTED, lines
+
+
+def test_error_after_folding_reports_its_line():
+    # `2 * 3` folds into one constant; the division by a variable still
+    # fails at run time, on the line it is written.
+    r = subprocess.run([GLOX, "--force-compile", os.path.join(LOX_DIR, "fold.lox")],
+                       capture_output=True, cwd=TESTS_DIR)
+    err = r.stderr.decode()
+    assert r.returncode != 0
+    assert "Division by zero" in r.stdout.decode() + err
+    assert "line 64" in err, err
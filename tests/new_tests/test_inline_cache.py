@@ -0,0 +1,17 @@
+from lox_helper import run_lox
+
+
+def test_inline_cache():
+    lines = run_lox("inline_cache.lox")
+    assert lines[0] == "AAA"                # monomorphic
+    assert lines[1] == "ABCA"               # polymorphic, D inherits A's method
+    assert lines[2] == "ABCAEFAF"           # more classes than the cache holds
+    assert lines[3] == "ABCAEFAF"           # bound methods through the same cache
+    assert lines[4] == "AfieldA"            # a field shadows the cached method
+    assert lines[5] == "1"                  # class variable found on Base
+    assert lines[6] == "2"                  # ... and its new value read
+    assert lines[7] == "3"                  # Sub's own variable shadows Base's
+    assert lines[8] == "2"                  # Base is unaffected
+    assert lines[9] == "static GGstatic G"  # static and instance method at one site
+    assert lines[10] == "H1H2H1"            # a redefined class is a new class
+    assert lines[11] == "RQPQP" * 3         # super calls
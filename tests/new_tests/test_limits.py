@@ -0,0 +1,26 @@
+from lox_helper import run_glox
+
+
+def test_budget():
+    # --budget raises a catchable BudgetExceeded, whose handler can still call
+    # functions; a little after that it is raised again, and uncaught it ends
+    # the run with exit 70.
+    code, lines = run_glox("--budget", "50000", "limits_spin.lox")
+    assert code == 70
+    assert lines[0] == "budget: Instruction budget of 50000 exceeded."
+    assert lines[1] == 'Uncaught exception: <class BudgetExceeded> : "Instruction budget of 50000 exceeded." '
+
+
+def test_timeout():
+    code, lines = run_glox("--timeout", "100ms", "limits_spin.lox")
+    assert code == 70
+    assert lines[0] == "timeout: Execution interrupted: context deadline exceeded."
+    assert lines[1].startswith("Uncaught exception: <class TimeoutError>")
+
+
+def test_bad_limits():
+    # A malformed value is a usage error, not a limit of zero.
+    for flag, value in [("--budget", "lots"), ("--budget", "0"), ("--timeout", "soon")]:
+        code, lines = run_glox(flag, value, "limits_spin.lox")
+        assert code == 1
+        assert lines[0].startswith("Usage: glox")
@@ -0,0 +1,69 @@
+import json
+from lox_helper import run_glox, run_lox
+
+
+def warnings(lines):
+    return [l.split("] ", 1)[1] for l in lines if l.startswith("In ")]
+
+
+# A normal run reports no warnings unless asked for them.
+def test_run_is_quiet():
+    assert run_lox("lint_warnings.lox") == ["4", "6", "3", "nil"]
+
+
+def test_lint_defaults():
+    code, lines = run_glox("lint", "lint_warnings.lox")
+    assert code == 0
+    assert warnings(lines) == [
+        "Warning at 'scale' : Local variable 'scale' is never used. [unused-variable]",
+        "Warning at 'result' : Local variable 'result' shadows an outer local. [shadowing]",
+        "Warning at 'print' : Unreachable code. [unreachable-code]",
+        "Warning at 'n' : Condition is always false: int values are falsey; compare explicitly. [truthiness]",
+    ]
+    assert "    [line 5:9] note : 'result' is declared in an enclosing scope here" in lines
+    assert lines[-1] == "4 warning(s), 0 error(s) found."
+
+
+def test_lint_flags():
+    code, lines = run_glox("lint", "-Wimplicit-declaration", "-Wno-shadowing",
+                           "-Werror=unreachable-code", "lint_warnings.lox")
+    assert code == 1
+    assert warnings(lines) == [
+        "Warning at 'scale' : Local variable 'scale' is never used. [unused-variable]",
+        "Error at 'print' : Unreachable code. [unreachable-code]",
+        "Warning at 'n' : Condition is always false: int values are falsey; compare explicitly. [truthiness]",
+        "Warning at 'total' : Assignment declares 'total'; use 'var total' to declare it explicitly. [implicit-declaration]",
+    ]
+
+
+def test_lint_json():
+    code, lines = run_glox("lint", "--diagnostics=json", "lint_warnings.lox")
+    assert code == 0
+    diags = [json.loads(l) for l in lines]
+    assert [(d["code"], d["span"]["line"], d["span"]["column"]) for d in diags] == [
+        ("unused-variable", 3, 9),
+        ("shadowing", 7, 13),
+        ("unreachable-code", 11, 5),
+        ("truthiness", 16, 9),
+    ]
+    assert all(d["severity"] == "warning" for d in diags)
+
+
+# -W flags on a normal run report the named warnings as it compiles, and
+# -Werror stops it. Truthiness needs the checker's types, so only lint sees
+# a non-literal condition.
+def test_run_with_warning_flags():
+    code, lines = run_glox("-Wunreachable-code", "lint_warnings.lox")
+    assert code == 0
+    assert warnings(lines) == ["Warning at 'print' : Unreachable code. [unreachable-code]"]
+    assert lines[-4:] == ["4", "6", "3", "nil"]
+    code, lines = run_glox("-Werror", "-Wall", "lint_warnings.lox")
+    assert code == 65
+    assert len(warnings(lines)) == 4
+    assert all(w.startswith("Error at") for w in warnings(lines))
+
+
+def test_unknown_warning():
+    code, lines = run_glox("lint", "-Wno-such-thing", "lint_warnings.lox")
+    assert code == 1
+    assert lines[0].startswith("unknown warning 'such-thing'")
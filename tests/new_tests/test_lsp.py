@@ -0,0 +1,64 @@
+import json, os, subprocess
+from lox_helper import GLOX, REPO_ROOT, TESTS_DIR
+
+
+def frame(msg):
+    body = json.dumps(msg).encode()
+    return b"Content-Length: %d\r\n\r\n" % len(body) + body
+
+
+def unframe(out):
+    msgs = []
+    while out:
+        head, _, rest = out.partition(b"\r\n\r\n")
+        length = int(head.split(b":")[1])
+        msgs.append(json.loads(rest[:length]))
+        out = rest[length:]
+    return msgs
+
+
+def lsp_session(requests):
+    """Run `glox lsp` over one scripted session, shut down cleanly, and return
+    (exit code, responses by id, notifications)."""
+    msgs = [{"jsonrpc": "2.0", "id": 0, "method": "initialize", "params": {}}] + requests
+    msgs += [{"jsonrpc": "2.0", "id": 999, "method": "shutdown"}, {"jsonrpc": "2.0", "method": "exit"}]
+    env = dict(os.environ, LOX_PATH=REPO_ROOT)
+    r = subprocess.run([GLOX, "lsp"], input=b"".join(frame(m) for m in msgs),
+                       capture_output=True, cwd=TESTS_DIR, env=env, timeout=30)
+    replies = unframe(r.stdout)
+    return (r.returncode,
+            {m["id"]: m.get("result") for m in replies if "id" in m},
+            [m for m in replies if "id" not in m])
+
+
+def test_lsp_diagnostics_hover_and_definition(tmp_path):
+    (tmp_path / "shapes.lox").write_text("func area(w, h = 1, *rest) {\n    return w * h\n}\n")
+    main = tmp_path / "main.lox"
+    text = "import math\nfrom shapes import area\nprint area(2) + math.sqrt(4)\nvar total = 1 +\n"
+    main.write_text(text)
+    uri = main.as_uri()
+    at = lambda line, ch: {"textDocument": {"uri": uri}, "position": {"line": line, "character": ch}}
+    code, results, notes = lsp_session([
+        {"jsonrpc": "2.0", "method": "textDocument/didOpen",
+         "params": {"textDocument": {"uri": uri, "languageId": "lox", "version": 1, "text": text}}},
+        {"jsonrpc": "2.0", "id": 1, "method": "textDocument/hover", "params": at(2, 7)},
+        {"jsonrpc": "2.0", "id": 2, "method": "textDocument/definition", "params": at(2, 7)},
+        {"jsonrpc": "2.0", "id": 3, "method": "textDocument/definition", "params": at(2, 22)},
+        {"jsonrpc": "2.0", "id": 4, "method": "textDocument/completion", "params": at(2, 21)},
+    ])
+    assert code == 0
+    assert results[0]["capabilities"]["hoverProvider"] is True
+    diags = notes[0]["params"]["diagnostics"]
+    assert len(diags) == 1 and diags[0]["severity"] == 1 and diags[0]["range"]["start"]["line"] == 4
+    assert "func area(w, h = 1, *rest)" in results[1]["contents"]["value"]
+    assert "Takes at least 1 argument." in results[1]["contents"]["value"]
+    assert results[2]["uri"] == (tmp_path / "shapes.lox").as_uri()
+    assert results[2]["range"]["start"] == {"line": 0, "character": 5}
+    assert results[3]["uri"].endswith("/src/modules/math.lox")
+    assert "sqrt" in [item["label"] for item in results[4]]
+
+
+def test_lsp_exit_without_shutdown_fails():
+    r = subprocess.run([GLOX, "lsp"], input=frame({"jsonrpc": "2.0", "method": "exit"}),
+                       capture_output=True, cwd=TESTS_DIR, timeout=30)
+    assert r.returncode == 1 and r.stdout == b""
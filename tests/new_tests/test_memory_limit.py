@@ -0,0 +1,26 @@
+from lox_helper import run_glox
+
+
+def test_memory_limit():
+    # Only what the script still holds counts, so it can recover from a
+    # MemoryError by dropping data.
+    code, lines = run_glox("--max-memory", "1000000", "memory_limit.lox")
+    assert code == 0
+    assert lines == [
+        "200000",
+        "true",
+        "true",
+        "caught: Memory limit of 1000000 bytes exceeded.",
+        "100",
+        "true",
+        "caught: Memory limit of 1000000 bytes exceeded.",
+        "true",
+        "nil",
+    ]
+
+
+def test_bad_memory_limit():
+    for value in ["lots", "0"]:
+        code, lines = run_glox("--max-memory", value, "memory_limit.lox")
+        assert code == 1
+        assert lines[0].startswith("Usage: glox")
@@ -0,0 +1,29 @@
+import pytest
+from lox_helper import run_lox
+
+
+# visibility/shapes.lox uses `export`, colours.lox an __all__ list and
+# codec.lox neither, so its underscore names are private.
+@pytest.mark.parametrize("script", ["module_visibility.lox", "module_visibility_ns.lox"])
+def test_module_visibility(script):
+    lines = run_lox(script)
+    assert lines == [
+        "4",
+        "6",
+        "5",
+        "red/green",
+        "<x>",
+        "helper not imported",
+        "blue not imported",
+        "_wrap not imported",
+        "cannot import name 'helper' from module 'visibility.shapes': it is not exported",
+        "cannot import name 'blue' from module 'visibility.colours': it is not exported",
+        "cannot import name '_wrap' from module 'visibility.codec': it is private",
+        "<y>",
+        "nil",
+    ]
+
+
+def test_export_only_at_top_level():
+    joined = "\n".join(run_lox("export_nested.lox"))
+    assert "Can only export top-level declarations." in joined
@@ -0,0 +1,26 @@
+import pytest
+from lox_helper import run_lox, LOX_DIR
+
+LOX = LOX_DIR.replace("\\", "/")
+
+
+# engine/ is a package with __init__.lox files, tools/ a namespace package
+# (no __init__.lox), and pkg_extra/extras/ is only found via sys.path.
+@pytest.mark.parametrize("script", ["packages.lox", "packages_ns.lox"])
+def test_packages(script):
+    lines = run_lox(script)
+    assert lines[:6] == [
+        "1.0",
+        "batch draws square/square",
+        "render uses helper",
+        "batch draws square/square",
+        "helper",
+        "hi!",
+    ]
+    assert lines[6].startswith("No module named 'extras' (searched: ")
+    assert lines[6].endswith(LOX + "/extras/__init__.lox, " + LOX + "/extras.lox, " + LOX + "/**/extras.lox)")
+    assert lines[7] == "extras found"
+    assert lines[8].startswith("No module named 'engine.missing' (searched: ")
+    assert lines[8].endswith(LOX + "/engine/missing/__init__.lox, " + LOX + "/engine/missing.lox)")
+    assert lines[9] == "attempted relative import '.engine' with no known parent package"
+    assert lines[-1] == "nil"
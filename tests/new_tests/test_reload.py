@@ -0,0 +1,37 @@
+from lox_helper import run_glox
+
+RELOADED = [
+    "v1 3 1",
+    "true",
+    "v2 9 4 2",
+    "true",
+    "compile: Cannot reload module 'hot': {dir}/hot.lox doesn't compile.",
+    "body: bad body",
+    "v2 9",
+    "Cannot reload module 'os': it is not a module loaded from a file.",
+]
+
+
+def test_reload(tmp_path):
+    # sys.reload swaps new code into the functions and classes taken from
+    # the module before; a bad edit is reported and leaves it as it was.
+    code, lines = run_glox("reload.lox", str(tmp_path))
+    assert code == 0
+    assert lines[4].startswith(f"In {tmp_path}/hot.lox: ")
+    del lines[4]
+    assert lines == [l.format(dir=tmp_path) for l in RELOADED] + ["nil"]
+
+
+def test_watch(tmp_path):
+    code, lines = run_glox("--watch", "reload.lox", str(tmp_path), "watch")
+    assert code == 0
+    del lines[4]
+    assert lines == [l.format(dir=tmp_path) for l in RELOADED] + ["v3 -3", "nil"]
+
+
+def test_reload_suspended(tmp_path):
+    # Functions suspended in a fiber or a task when their module is reloaded
+    # finish with the code they started with.
+    code, lines = run_glox("reload_suspended.lox", str(tmp_path))
+    assert code == 0
+    assert lines == ['[ 2 , "step20" ]', '[ 11 , "later200" ]', "nil"]
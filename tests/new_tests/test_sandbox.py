@@ -0,0 +1,36 @@
+from lox_helper import run_glox
+
+
+def test_sandbox():
+    # Files outside the working directory and the process module are
+    # refused with PermissionError; --max-memory ends the doubling string.
+    code, lines = run_glox("--sandbox", "--max-memory", "100000", "sandbox.lox")
+    assert code == 70
+    assert lines[0] == "true"
+    assert lines[1] == "file: open ../../main.go: permission denied"
+    assert lines[2] == "import: Module 'process' is not available in the sandbox."
+    assert lines[3] == 'Uncaught exception: <class MemoryError> : "Memory limit of 100000 bytes exceeded." '
+
+
+def test_max_memory_without_sandbox():
+    # --max-memory works on its own. Unsandboxed, "/" is the host's root and
+    # nothing else is refused.
+    code, lines = run_glox("--max-memory", "100000", "sandbox.lox")
+    assert code == 70
+    assert lines[0] == "false"
+    assert lines[1] == 'Uncaught exception: <class MemoryError> : "Memory limit of 100000 bytes exceeded." '
+
+
+def test_sandbox_search_path(tmp_path):
+    # sys.path is fixed when the sandbox is set up, and no bytecode cache is
+    # written; unsandboxed, the same import succeeds and is cached.
+    (tmp_path / "secret.lox").write_text('var value = "secret";\n')
+    code, lines = run_glox("--sandbox", "sandbox_path.lox", str(tmp_path))
+    assert code == 0
+    assert lines[0] == "import refused"
+    assert not (tmp_path / "__loxcache__").exists()
+
+    code, lines = run_glox("sandbox_path.lox", str(tmp_path))
+    assert code == 0
+    assert lines[0] == "secret"
+    assert (tmp_path / "__loxcache__" / "secret.lxc").exists()
@@ -0,0 +1,12 @@
+from lox_helper import run_lox
+
+
+def test_shapes():
+    lines = run_lox("shapes.lox")
+    assert lines[0] == "20"                     # one read site, several shapes
+    assert lines[1] == "11"                     # same fields, different order
+    assert lines[2] == "780"                    # 40 fields: dictionary mode
+    assert lines[3] == "139"                    # assignment in dictionary mode
+    assert lines[4:7] == ["5", "6", "7"]        # pickled instance keeps its fields
+    assert lines[7] == "139"                    # pickled dictionary-mode instance
+    assert lines[8] == "method field method"    # a field shadows a method
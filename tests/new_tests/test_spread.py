@@ -0,0 +1,22 @@
+from lox_helper import run_lox
+
+
+def test_spread_args():
+    assert run_lox("spread_args.lox") == [
+        "6",
+        "60",             # a tuple spreads like a list
+        "6",
+        "[  ]",           # spreading an empty list passes nothing
+        "[ 1 , 2 , 3 ]",  # spread arguments fill a *rest parameter
+        "13",             # super.mul(*args) and b.mul(*args)
+        "11",
+        "Spread argument must be a list or tuple.",
+        "Expected 3 arguments but got 2.",
+        "nil",
+    ]
+
+
+def test_spread_errors():
+    joined = "\n".join(run_lox("spread_errors.lox"))
+    assert "[line 3:13] Error at ',' : Spread argument must be last." in joined, joined
+    assert "Error at 'init' : Initialisers can't be decorated." in joined, joined
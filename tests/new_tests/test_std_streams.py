@@ -0,0 +1,27 @@
+import pytest
+from lox_helper import run_lox
+
+
+@pytest.mark.parametrize("force_compile", [False, True])
+def test_std_streams(force_compile):
+    # print follows sys.stdout wherever it is pointed -- a buffer here --
+    # and so do stderr_writer() and spawned threads; buffers read back
+    # line by line and can be refilled after running dry.
+    lines = run_lox("std_streams.lox", force_compile=force_compile)
+    assert lines == [
+        "<stdout>",
+        "file",
+        "6",
+        "one",
+        "2",
+        "a",
+        "b",
+        "dry",
+        "c",
+        "true",
+        "Cannot print to a closed file.",
+        "getvalue expects a buffer from os.buffer().",
+        "from thread",
+        "done",
+        "nil",
+    ]
@@ -1,4 +1,4 @@
-from lox_helper import run_lox
+from lox_helper import run_lox, run_glox
 
 
 # nested_module.lox lives in lox/subdir_mods/, not next to subdir_import.lox --
@@ -8,3 +8,16 @@ def test_subdir_import():
     assert lines[0] == "hello world"
     assert lines[1] == "found in subfolder"
     assert lines[-1] == "nil"
+
+
+def test_subdir_import_ambiguous(tmp_path):
+    # Two subdirectories holding the module make the fallback refuse to
+    # pick one.
+    for sub in ["a", "b"]:
+        (tmp_path / sub).mkdir()
+        (tmp_path / sub / "twin.lox").write_text(f'var where = "{sub}";\n')
+    script = tmp_path / "main.lox"
+    script.write_text("try {\n    import twin;\n} except ImportError as e {\n    print e.msg;\n}\n")
+    code, lines = run_glox(str(script))
+    assert code == 0
+    assert lines[0] == f"Module name 'twin' is ambiguous: found {tmp_path}/a/twin.lox, {tmp_path}/b/twin.lox"
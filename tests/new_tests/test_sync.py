@@ -14,6 +14,13 @@ MUTEX_FINALLY_EXPECTED = [
     "nil",
 ]
 
+MUTEX_STACK_EXPECTED = [
+    "before 42 after",
+    "caught SyncError",
+    "done",
+    "nil",
+]
+
 
 @pytest.mark.parametrize("force_compile", [False, True])
 def test_sync_mutex(force_compile):
@@ -31,3 +38,12 @@ def test_sync_mutex_finally(force_compile):
     # afterward instead of hanging forever.
     lines = run_lox("sync_mutex_finally.lox", force_compile=force_compile)
     assert lines == MUTEX_FINALLY_EXPECTED
+
+
+@pytest.mark.parametrize("force_compile", [False, True])
+def test_sync_mutex_stack(force_compile):
+    # locked() runs its closure through VM.CallClosure; the caller's locals
+    # must be intact after a call that returns, and a later exception must
+    # bind to the except clause's variable.
+    lines = run_lox("sync_mutex_stack.lox", force_compile=force_compile)
+    assert lines == MUTEX_STACK_EXPECTED
@@ -37,6 +37,35 @@ POOL_100_EXPECTED = [
     "nil",
 ]
 
+SELECT_EXPECTED = [
+    "100",
+    "1 2",
+    "nil",
+    "nil",
+    "( 1 , nil )",
+    "nil",
+    '( 0 , "x" )',
+    "nil",
+    "select() case 0: send on a closed channel",
+    "channel is closed",
+    "( 0 , nil )",
+    "( 1 , 42 )",
+    "fin",
+    "nil",
+    "select() case 0: thread has already finished",
+    "select() case 0 must be a thread, thread channel or channel, or a [channel, value] pair.",
+    "( true , 7 )",
+    "( false , nil )",
+    "send on a closed channel",
+    "Channel() capacity must be a non-negative integer.",
+    '( 0 , "a" )',
+    "nil",
+    "send on a closed channel",
+    "select() case 0: send on a closed channel",
+    "done",
+    "nil",
+]
+
 
 @pytest.mark.parametrize("force_compile", [False, True])
 def test_thread_basic(force_compile):
@@ -82,3 +111,12 @@ def test_thread_pool_100(force_compile):
     # regardless of scheduling order across the 4 threads.
     lines = run_lox("thread_pool_100.lox", force_compile=force_compile)
     assert lines == POOL_100_EXPECTED
+
+
+@pytest.mark.parametrize("force_compile", [False, True])
+def test_thread_select(force_compile):
+    # thread.select() over standalone channels, threads and a thread's own
+    # channel: receive and send cases, timeouts (0 polls), closed channels
+    # dropping out, and nil once nothing is left to wait on.
+    lines = run_lox("thread_select.lox", force_compile=force_compile)
+    assert lines == SELECT_EXPECTED
@@ -0,0 +1,79 @@
+import os
+
+import pytest
+from lox_helper import LOX_DIR, run_lox, run_glox
+
+EXPECTED = [
+    "7",
+    "x:1",
+    "y:2",
+    "5",
+    "3",
+    "b",
+    "true",
+    "3",
+    "nil",
+]
+
+
+@pytest.mark.parametrize("script", ["type_annotations.lox", "type_annotations_ns.lox"])
+def test_annotations_are_ignored_at_run_time(script):
+    assert run_lox(script) == EXPECTED
+
+
+@pytest.mark.parametrize("script", ["type_annotations.lox", "type_annotations_ns.lox"])
+def test_check_clean(script):
+    code, lines = run_glox("check", script)
+    assert code == 0
+    assert lines == []
+
+
+def test_check_reports_type_errors():
+    code, lines = run_glox("check", "type_errors.lox")
+    assert code == 1
+    errors = [l.split("Type error : ")[1] for l in lines if "Type error" in l]
+    assert errors == [
+        "cannot assign float to variable a of type int",
+        "argument 1 to area: expected float, got int",
+        "area expects 2 arguments, got 1",
+        "argument 1 to _sin: expected float, got int",
+        "cannot assign float to variable s of type string",
+        "Point expects 2 arguments, got 1",
+        "cannot assign string to field x of type float",
+        "argument 1 to scale: expected float, got int",
+        "cannot return string from bad, declared to return int",
+        "operator '+' cannot be applied to string and int (use & to join strings)",
+        "cannot assign nil to variable nope of type int",
+    ]
+    assert lines[-1] == "11 type error(s) found."
+
+
+# Scripts the checker is right to reject: each exists to exercise a
+# compile error, or a run-time error the checker also sees coming.
+CHECK_REJECTS = {
+    "break_outside_loop.lox",
+    "catch_runtime.lox",
+    "catch_runtime_ns.lox",
+    "const_local_assign.lox",
+    "const_local_compound.lox",
+    "const_local_expr.lox",
+    "continue_outside_loop.lox",
+    "diagnostics_errors.lox",
+    "export_nested.lox",
+    "fiber.lox",
+    "oneline_bad.lox",
+    "spread_errors.lox",
+    "sync_mutex_stack.lox",
+    "tuples.lox",
+    "tuples_ns.lox",
+    "type_errors.lox",
+}
+
+
+@pytest.mark.parametrize("script", sorted(
+    f for f in os.listdir(LOX_DIR) if f.endswith(".lox") and f not in CHECK_REJECTS))
+def test_check_accepts_test_scripts(script):
+    # Catches builtin signatures that disagree with the implementations:
+    # a wrong one shows up as a type error in valid code.
+    code, lines = run_glox("check", script)
+    assert code == 0, lines